@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memory an in memory target.
+type memory struct {
+	lock sync.Mutex
+	data map[string]int
+}
+
+func (m *memory) Write(name string, data []byte) error {
+	m.lock.Lock()
+	m.data[name] = len(data)
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *memory) Read(name string) (n int, err error) {
+	var ok bool
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if n, ok = m.data[name]; !ok {
+		err = fmt.Errorf("not found")
+	}
+	return
+}
+
+func (m *memory) Delete(name string) error {
+	m.lock.Lock()
+	delete(m.data, name)
+	m.lock.Unlock()
+	return nil
+}
+
+func TestParseSize(t *testing.T) {
+	var (
+		n   int
+		err error
+	)
+	if n, err = parseSize("4k"); err != nil || n != 4096 {
+		t.Errorf("parseSize(4k) got: %d error(%v)", n, err)
+		t.FailNow()
+	}
+	if n, err = parseSize("2M"); err != nil || n != 2*1024*1024 {
+		t.Errorf("parseSize(2M) got: %d error(%v)", n, err)
+		t.FailNow()
+	}
+	if _, err = parseSize("k"); err == nil {
+		t.Errorf("parseSize(k) no error")
+		t.FailNow()
+	}
+}
+
+func TestDist(t *testing.T) {
+	var (
+		i   int
+		d   *dist
+		err error
+		r   = rand.New(rand.NewSource(1))
+		got = map[string]int{}
+	)
+	if d, err = parseDist("a:1,b:0,c:3", func(string) (int, error) { return 0, nil }); err != nil {
+		t.Errorf("parseDist() error(%v)", err)
+		t.FailNow()
+	}
+	for i = 0; i < 4000; i++ {
+		got[d.pick(r).name]++
+	}
+	if got["b"] != 0 || got["a"] < 800 || got["a"] > 1200 || got["c"] < 2800 {
+		t.Errorf("pick() got: %v", got)
+		t.FailNow()
+	}
+	if _, err = parseDist("a:0", func(string) (int, error) { return 0, nil }); err == nil {
+		t.Errorf("parseDist() no weight no error")
+		t.FailNow()
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var (
+		i int
+		r = new(result)
+	)
+	for i = 100; i > 0; i-- {
+		r.add(time.Duration(i), 1, nil)
+	}
+	if r.percentile(50) != 51 || r.percentile(99) != 100 || r.percentile(100) != 100 {
+		t.Errorf("percentile() got: %v %v %v", r.percentile(50), r.percentile(99), r.percentile(100))
+		t.FailNow()
+	}
+}
+
+func TestBench(t *testing.T) {
+	var (
+		n   int
+		b   *bench
+		r   *result
+		err error
+		out = &bytes.Buffer{}
+		m   = &memory{data: make(map[string]int)}
+	)
+	if b, err = newBench(m, "read:5,write:3,delete:2", "1k:1,2k:1"); err != nil {
+		t.Errorf("newBench() error(%v)", err)
+		t.FailNow()
+	}
+	if err = b.prefill(10); err != nil || len(m.data) != 10 {
+		t.Errorf("prefill() error(%v) got: %d", err, len(m.data))
+		t.FailNow()
+	}
+	b.run(4, 1000, time.Minute)
+	for _, r = range b.results {
+		n += len(r.lats) + r.errs
+	}
+	if n != 1000 {
+		t.Errorf("run() got: %d operations", n)
+		t.FailNow()
+	}
+	report(out, b.results, b.elapsed)
+	if !strings.Contains(out.String(), "read") || !strings.Contains(out.String(), "total: 1000 ops") {
+		t.Errorf("report() got: %s", out)
+		t.FailNow()
+	}
+	b.cleanup()
+	if len(m.data) != 0 {
+		t.Errorf("cleanup() left: %d", len(m.data))
+		t.FailNow()
+	}
+}
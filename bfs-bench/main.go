@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bfs/client"
+	"bfs/libs/log"
+)
+
+const (
+	version = "1.0.0"
+
+	_opRead   = "read"
+	_opWrite  = "write"
+	_opDelete = "delete"
+)
+
+var (
+	directoryAddr string
+	storeAddr     string
+	vid           int
+	bucket        string
+	prefix        string
+	mix           string
+	sizes         string
+	concurrency   int
+	total         int64
+	duration      time.Duration
+	timeout       time.Duration
+	prefill       int
+	cleanup       bool
+)
+
+func init() {
+	flag.StringVar(&directoryAddr, "d", "localhost:6065", " set the directory http addr, benchmark the cluster")
+	flag.StringVar(&storeAddr, "s", "", " set the store api addr, benchmark the volume of the store instead of the cluster")
+	flag.IntVar(&vid, "vid", 1, " set the volume id of the store benchmark")
+	flag.StringVar(&bucket, "b", "test", " set the bucket of the cluster benchmark")
+	flag.StringVar(&prefix, "prefix", "bench/", " set the filename prefix of the cluster benchmark")
+	flag.StringVar(&mix, "mix", "read:70,write:20,delete:10", " set the operation mix, op:weight")
+	flag.StringVar(&sizes, "size", "4k:60,64k:30,1m:10", " set the object size distribution, size:weight")
+	flag.IntVar(&concurrency, "c", 16, " set the concurrent workers")
+	flag.Int64Var(&total, "n", 0, " set the total operations, run for the duration if zero")
+	flag.DurationVar(&duration, "duration", 30*time.Second, " set the benchmark duration")
+	flag.DurationVar(&timeout, "timeout", 5*time.Second, " set the request timeout")
+	flag.IntVar(&prefill, "prefill", 100, " set the objects written before the benchmark, not measured")
+	flag.BoolVar(&cleanup, "cleanup", true, " delete the objects left after the benchmark")
+}
+
+// bfs-bench drive the read/write/delete mix against the cluster or a single
+// store, report the throughput and the latency percentiles.
+func main() {
+	var (
+		err error
+		t   target
+		b   *bench
+	)
+	flag.Parse()
+	defer log.Flush()
+	if storeAddr != "" {
+		t = newStore(storeAddr, int32(vid), timeout)
+		prefix = ""
+	} else {
+		t = newCluster(&client.Config{Directory: directoryAddr, Timeout: timeout}, bucket)
+	}
+	if b, err = newBench(t, mix, sizes); err != nil {
+		fmt.Fprintf(os.Stderr, "bfs-bench: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("bfs-bench [version: %s] workers: %d mix: %s size: %s\n", version, concurrency, mix, sizes)
+	if err = b.prefill(prefill); err != nil {
+		fmt.Fprintf(os.Stderr, "bfs-bench prefill: %v\n", err)
+		os.Exit(1)
+	}
+	b.run(concurrency, total, duration)
+	report(os.Stdout, b.results, b.elapsed)
+	if cleanup {
+		b.cleanup()
+	}
+}
+
+// bench the state of a benchmark, the written names are kept to read and
+// delete.
+type bench struct {
+	t       target
+	mix     *dist
+	sizes   *dist
+	data    []byte
+	seq     int64
+	base    int64
+	lock    sync.Mutex
+	names   []string
+	results map[string]*result
+	elapsed time.Duration
+}
+
+func newBench(t target, mix, sizes string) (b *bench, err error) {
+	var (
+		w   weight
+		max int
+	)
+	b = &bench{t: t, base: time.Now().UnixNano(), results: map[string]*result{
+		_opRead:   new(result),
+		_opWrite:  new(result),
+		_opDelete: new(result),
+	}}
+	if b.mix, err = parseDist(mix, func(op string) (int, error) {
+		if op != _opRead && op != _opWrite && op != _opDelete {
+			return 0, fmt.Errorf("bad operation: %q", op)
+		}
+		return 0, nil
+	}); err != nil {
+		return
+	}
+	if b.sizes, err = parseDist(sizes, parseSize); err != nil {
+		return
+	}
+	for _, w = range b.sizes.ws {
+		if w.value > max {
+			max = w.value
+		}
+	}
+	b.data = make([]byte, max)
+	rand.Read(b.data)
+	return
+}
+
+// name get a new unique name, decimal for the store needle keys.
+func (b *bench) name() string {
+	return prefix + strconv.FormatInt(b.base+atomic.AddInt64(&b.seq, 1), 10)
+}
+
+// pick pick a written name, remove it if del.
+func (b *bench) pick(r *rand.Rand, del bool) (name string) {
+	var i int
+	b.lock.Lock()
+	if len(b.names) > 0 {
+		i = r.Intn(len(b.names))
+		name = b.names[i]
+		if del {
+			b.names[i] = b.names[len(b.names)-1]
+			b.names = b.names[:len(b.names)-1]
+		}
+	}
+	b.lock.Unlock()
+	return
+}
+
+func (b *bench) put(name string) {
+	b.lock.Lock()
+	b.names = append(b.names, name)
+	b.lock.Unlock()
+}
+
+// write write an object of the size distribution.
+func (b *bench) write(r *rand.Rand) (n int, err error) {
+	var name = b.name()
+	n = b.sizes.pick(r).value
+	if err = b.t.Write(name, b.data[:n]); err == nil {
+		b.put(name)
+	}
+	return
+}
+
+// do do an operation of the mix, write if nothing to read or delete.
+func (b *bench) do(r *rand.Rand) {
+	var (
+		n     int
+		err   error
+		name  string
+		start time.Time
+		op    = b.mix.pick(r).name
+	)
+	if op != _opWrite {
+		if name = b.pick(r, op == _opDelete); name == "" {
+			op = _opWrite
+		}
+	}
+	start = time.Now()
+	switch op {
+	case _opRead:
+		n, err = b.t.Read(name)
+	case _opDelete:
+		err = b.t.Delete(name)
+	default:
+		n, err = b.write(r)
+	}
+	if err != nil {
+		log.Errorf("bench %s(%s) error(%v)", op, name, err)
+	}
+	b.results[op].add(time.Since(start), n, err)
+}
+
+// prefill write the objects to read and delete, not measured.
+func (b *bench) prefill(n int) (err error) {
+	var (
+		i int
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	)
+	for i = 0; i < n; i++ {
+		if _, err = b.write(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// run run the workers until n operations done, or for the duration if n
+// is zero.
+func (b *bench) run(workers int, n int64, d time.Duration) {
+	var (
+		i     int
+		done  int64
+		wg    sync.WaitGroup
+		start = time.Now()
+		end   = start.Add(d)
+	)
+	for i = 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			var r = rand.New(rand.NewSource(seed))
+			defer wg.Done()
+			for {
+				if n > 0 && atomic.AddInt64(&done, 1) > n {
+					return
+				}
+				if n <= 0 && time.Now().After(end) {
+					return
+				}
+				b.do(r)
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	wg.Wait()
+	b.elapsed = time.Since(start)
+}
+
+// cleanup delete the objects left.
+func (b *bench) cleanup() {
+	var name string
+	for _, name = range b.names {
+		if err := b.t.Delete(name); err != nil {
+			log.Errorf("cleanup delete(%s) error(%v)", name, err)
+		}
+	}
+	b.names = nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// weight a weighted choice of a distribution.
+type weight struct {
+	name   string
+	value  int
+	weight int
+}
+
+// dist a weighted distribution, e.g "read:70,write:20,delete:10" or
+// "4k:50,64k:40,1m:10".
+type dist struct {
+	ws    []weight
+	total int
+}
+
+// parseDist parse the distribution, the values are parsed by the value func.
+func parseDist(s string, value func(string) (int, error)) (d *dist, err error) {
+	var (
+		w    weight
+		kv   []string
+		item string
+	)
+	d = new(dist)
+	for _, item = range strings.Split(s, ",") {
+		if kv = strings.Split(strings.TrimSpace(item), ":"); len(kv) != 2 {
+			return nil, fmt.Errorf("bad distribution item: %q", item)
+		}
+		w = weight{name: kv[0]}
+		if w.weight, err = strconv.Atoi(kv[1]); err != nil || w.weight < 0 {
+			return nil, fmt.Errorf("bad weight: %q", item)
+		}
+		if w.value, err = value(kv[0]); err != nil {
+			return nil, err
+		}
+		d.ws = append(d.ws, w)
+		d.total += w.weight
+	}
+	if d.total <= 0 {
+		return nil, fmt.Errorf("no weight: %q", s)
+	}
+	return
+}
+
+// pick pick a weighted item.
+func (d *dist) pick(r *rand.Rand) *weight {
+	var (
+		i int
+		n = r.Intn(d.total)
+	)
+	for i = range d.ws {
+		if n -= d.ws[i].weight; n < 0 {
+			break
+		}
+	}
+	return &d.ws[i]
+}
+
+// parseSize parse the size like 512, 4k, 1m.
+func parseSize(s string) (n int, err error) {
+	var unit = 1
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		unit = 1024
+	case "m":
+		unit = 1024 * 1024
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+	if n, err = strconv.Atoi(s); err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size: %q", s)
+	}
+	return n * unit, nil
+}
+
+// result the results of an operation.
+type result struct {
+	lock   sync.Mutex
+	lats   []time.Duration
+	errs   int
+	bytes  int64
+	sorted bool
+}
+
+func (r *result) add(lat time.Duration, n int, err error) {
+	r.lock.Lock()
+	if err != nil {
+		r.errs++
+	} else {
+		r.lats = append(r.lats, lat)
+		r.bytes += int64(n)
+	}
+	r.lock.Unlock()
+}
+
+// percentile get the latency of the percentile, p in [0, 100].
+func (r *result) percentile(p float64) time.Duration {
+	var i int
+	if len(r.lats) == 0 {
+		return 0
+	}
+	if !r.sorted {
+		sort.Slice(r.lats, func(i, j int) bool { return r.lats[i] < r.lats[j] })
+		r.sorted = true
+	}
+	if i = int(p / 100 * float64(len(r.lats))); i >= len(r.lats) {
+		i = len(r.lats) - 1
+	}
+	return r.lats[i]
+}
+
+// report print the throughput and the latency percentiles of the results.
+func report(w io.Writer, results map[string]*result, elapsed time.Duration) {
+	var (
+		op    string
+		ops   []string
+		r     *result
+		secs  = elapsed.Seconds()
+		total int
+	)
+	for op = range results {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	fmt.Fprintf(w, "%-8s %9s %7s %10s %9s %10s %10s %10s %10s %10s\n",
+		"OP", "COUNT", "ERRORS", "OPS/S", "MB/S", "P50", "P90", "P99", "P999", "MAX")
+	for _, op = range ops {
+		if r = results[op]; len(r.lats)+r.errs == 0 {
+			continue
+		}
+		total += len(r.lats) + r.errs
+		fmt.Fprintf(w, "%-8s %9d %7d %10.1f %9.2f %10v %10v %10v %10v %10v\n", op, len(r.lats), r.errs,
+			float64(len(r.lats))/secs, float64(r.bytes)/secs/1024/1024,
+			r.percentile(50), r.percentile(90), r.percentile(99), r.percentile(99.9), r.percentile(100))
+	}
+	fmt.Fprintf(w, "total: %d ops in %v, %.1f ops/s\n", total, elapsed, float64(total)/secs)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bfs/client"
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+)
+
+const (
+	// api
+	_storeGetApi    = "http://%s/get"
+	_storeUploadApi = "http://%s/upload"
+	_storeDelApi    = "http://%s/del"
+
+	_benchMine = "application/octet-stream"
+)
+
+// target the cluster or the store under the benchmark.
+type target interface {
+	Write(name string, data []byte) error
+	// Read read the object, return the read bytes.
+	Read(name string) (int, error)
+	Delete(name string) error
+}
+
+// cluster benchmark the cluster by the sdk, through the directory and
+// the stores.
+type cluster struct {
+	c      *client.Client
+	bucket string
+}
+
+func newCluster(c *client.Config, bucket string) *cluster {
+	return &cluster{c: client.New(c), bucket: bucket}
+}
+
+func (c *cluster) Write(name string, data []byte) error {
+	return c.c.Upload(c.bucket, name, _benchMine, time.Now().Unix(), data)
+}
+
+func (c *cluster) Read(name string) (n int, err error) {
+	var (
+		src io.ReadCloser
+		n64 int64
+	)
+	if src, _, _, err = c.c.Get(c.bucket, name); err != nil {
+		return
+	}
+	n64, err = io.Copy(ioutil.Discard, src)
+	src.Close()
+	return int(n64), err
+}
+
+func (c *cluster) Delete(name string) error {
+	return c.c.Delete(c.bucket, name)
+}
+
+// store benchmark a single store by its api, the needles of the volume are
+// keyed by the names, which must be the decimal keys.
+type store struct {
+	addr   string
+	vid    string
+	cookie string
+	client *http.Client
+}
+
+func newStore(addr string, vid int32, timeout time.Duration) *store {
+	return &store{
+		addr:   addr,
+		vid:    strconv.FormatInt(int64(vid), 10),
+		cookie: "1",
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *store) Write(name string, data []byte) (err error) {
+	var (
+		bw   io.Writer
+		buf  = &bytes.Buffer{}
+		w    = multipart.NewWriter(buf)
+		resp *http.Response
+	)
+	if bw, err = w.CreateFormFile("file", "1.jpg"); err != nil {
+		return
+	}
+	if _, err = bw.Write(data); err != nil {
+		return
+	}
+	w.WriteField("vid", s.vid)
+	w.WriteField("key", name)
+	w.WriteField("cookie", s.cookie)
+	if err = w.Close(); err != nil {
+		return
+	}
+	if resp, err = s.client.Post(fmt.Sprintf(_storeUploadApi, s.addr), w.FormDataContentType(), buf); err != nil {
+		return
+	}
+	return storeRet(resp)
+}
+
+func (s *store) Read(name string) (n int, err error) {
+	var (
+		n64    int64
+		resp   *http.Response
+		params = url.Values{}
+	)
+	params.Set("vid", s.vid)
+	params.Set("key", name)
+	params.Set("cookie", s.cookie)
+	if resp, err = s.client.Get(fmt.Sprintf(_storeGetApi, s.addr) + "?" + params.Encode()); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status: %d", resp.StatusCode)
+	}
+	n64, err = io.Copy(ioutil.Discard, resp.Body)
+	return int(n64), err
+}
+
+func (s *store) Delete(name string) (err error) {
+	var (
+		resp   *http.Response
+		params = url.Values{}
+	)
+	params.Set("vid", s.vid)
+	params.Set("key", name)
+	if resp, err = s.client.Post(fmt.Sprintf(_storeDelApi, s.addr), "application/x-www-form-urlencoded",
+		strings.NewReader(params.Encode())); err != nil {
+		return
+	}
+	return storeRet(resp)
+}
+
+// storeRet get the error of the store response.
+func storeRet(resp *http.Response) (err error) {
+	var ret meta.StoreRet
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status: %d", resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return
+	}
+	if ret.Ret != errors.RetOK {
+		err = fmt.Errorf("ret: %d", ret.Ret)
+	}
+	return
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+)
+
+const (
+	// api
+	_directoryBucketsApi   = "http://%s/buckets"
+	_directoryBucketApi    = "http://%s/bucket"
+	_directoryBucketDelApi = "http://%s/bucket/del"
+	_directoryKeyApi       = "http://%s/bucket/key"
+	_directoryKeyDelApi    = "http://%s/bucket/key/del"
+	_directoryStatsApi     = "http://%s/stats"
+	_storeInfoApi          = "http://%s/info"
+	_storeCompactApi       = "http://%s/compact_volume"
+
+	_defaultMine = "application/octet-stream"
+	_listLimit   = 1000
+)
+
+// upload upload the file or stdin.
+func upload(args []string) (err error) {
+	var (
+		r = io.Reader(os.Stdin)
+		m = mine
+		f *os.File
+	)
+	if len(args) > 2 {
+		if f, err = os.Open(args[2]); err != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+	if m == "" {
+		if m = mime.TypeByExtension(path.Ext(args[1])); m == "" {
+			m = _defaultMine
+		}
+	}
+	return cli.UploadStream(args[0], args[1], m, time.Now().Unix(), r)
+}
+
+// get write the file to the file or stdout.
+func get(args []string) (err error) {
+	var (
+		w = io.Writer(os.Stdout)
+		f *os.File
+	)
+	if len(args) > 2 {
+		if f, err = os.Create(args[2]); err != nil {
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = cli.GetStream(args[0], args[1], w)
+	return
+}
+
+func del(args []string) error {
+	return cli.Delete(args[0], args[1])
+}
+
+func stat(args []string) (err error) {
+	var mf *meta.File
+	if mf, err = cli.Stat(args[0], args[1]); err != nil {
+		return
+	}
+	fmt.Printf("filename: %s\nsize: %d\nmine: %s\nsha1: %s\nmtime: %s\n", args[1], mf.Size, mf.Mine, mf.Sha1, time.Unix(mf.MTime, 0).Format(time.RFC3339))
+	if mf.Name != "" {
+		fmt.Printf("name: %s\n", mf.Name)
+	}
+	return
+}
+
+// list print all the pages of the listing.
+func list(args []string) (err error) {
+	var (
+		prefix string
+		marker string
+		p      string
+		f      *meta.File
+		l      *meta.List
+	)
+	if len(args) > 1 {
+		prefix = args[1]
+	}
+	for {
+		if l, err = cli.List(args[0], prefix, "/", marker, _listLimit); err != nil {
+			return
+		}
+		for _, p = range l.Prefixes {
+			fmt.Printf("%12s  %s\n", "DIR", p)
+		}
+		for _, f = range l.Files {
+			fmt.Printf("%12d  %s\n", f.Size, f.Filename)
+		}
+		if marker = l.Marker; marker == "" {
+			return
+		}
+	}
+}
+
+func buckets(args []string) error {
+	return call("GET", fmt.Sprintf(_directoryBucketsApi, directoryAddr), nil)
+}
+
+func bucket(args []string) error {
+	return call("GET", fmt.Sprintf(_directoryBucketApi, adminAddr), url.Values{"name": {args[0]}})
+}
+
+func createBucket(args []string) error {
+	return call("POST", fmt.Sprintf(_directoryBucketApi, adminAddr), url.Values{"name": {args[0]}, "property": {args[1]}})
+}
+
+func delBucket(args []string) error {
+	return call("POST", fmt.Sprintf(_directoryBucketDelApi, adminAddr), url.Values{"name": {args[0]}})
+}
+
+func addBucketKey(args []string) error {
+	return call("POST", fmt.Sprintf(_directoryKeyApi, adminAddr), url.Values{"name": {args[0]}})
+}
+
+func delBucketKey(args []string) error {
+	return call("POST", fmt.Sprintf(_directoryKeyDelApi, adminAddr), url.Values{"name": {args[0]}, "id": {args[1]}})
+}
+
+// volumes print the volumes of the store from its stat api.
+func volumes(args []string) (err error) {
+	var (
+		v    *volumeInfo
+		info storeInfo
+	)
+	if err = do("GET", fmt.Sprintf(_storeInfoApi, args[0]), nil, &info); err != nil {
+		return
+	}
+	fmt.Printf("%8s  %14s  %12s  %10s  %10s  %8s\n", "VID", "SIZE", "OFFSET", "WRITES", "DELETES", "COMPACT")
+	for _, v = range info.Volumes {
+		fmt.Printf("%8d  %14d  %12d  %10d  %10d  %8v\n", v.Id, v.Block.Size, v.Block.Offset,
+			v.Stats.TotalWriteProcessed, v.Stats.TotalDelProcessed, v.Compact)
+	}
+	fmt.Printf("free volumes: %d\n", len(info.FreeVolumes))
+	return
+}
+
+// compact trigger the online compaction of the volume.
+func compact(args []string) (err error) {
+	if _, err = strconv.ParseInt(args[1], 10, 32); err != nil {
+		return
+	}
+	return call("POST", fmt.Sprintf(_storeCompactApi, args[0]), url.Values{"vid": {args[1]}})
+}
+
+// health print the cluster summary of the directory, or probe the stat api
+// of the stores.
+func health(args []string) (err error) {
+	var (
+		addr string
+		info storeInfo
+		bad  int
+	)
+	if len(args) == 0 {
+		return call("GET", fmt.Sprintf(_directoryStatsApi, directoryAddr), nil)
+	}
+	for _, addr = range args {
+		if err = do("GET", fmt.Sprintf(_storeInfoApi, addr), nil, &info); err != nil {
+			fmt.Printf("%s: down (%v)\n", addr, err)
+			bad++
+			continue
+		}
+		fmt.Printf("%s: ok, version: %s, volumes: %d, free volumes: %d, qps: %d, tps: %d\n", addr, info.Server.Ver,
+			len(info.Volumes), len(info.FreeVolumes), info.Server.Stats.GetQPS, info.Server.Stats.WriteTPS)
+	}
+	if err = nil; bad > 0 {
+		err = fmt.Errorf("%d of %d stores down", bad, len(args))
+	}
+	return
+}
+
+// storeInfo the store stat api response.
+type storeInfo struct {
+	Ret    int `json:"ret"`
+	Server struct {
+		Ver   string `json:"ver"`
+		Stats struct {
+			GetQPS   uint64 `json:"get_qps"`
+			WriteTPS uint64 `json:"write_tps"`
+		} `json:"stats"`
+	} `json:"server"`
+	Volumes     []*volumeInfo `json:"volumes"`
+	FreeVolumes []interface{} `json:"free_volumes"`
+}
+
+type volumeInfo struct {
+	Id    int32 `json:"id"`
+	Block struct {
+		Size   int64  `json:"size"`
+		Offset uint32 `json:"offset"`
+	} `json:"block"`
+	Stats struct {
+		TotalWriteProcessed uint64 `json:"total_write_processed"`
+		TotalDelProcessed   uint64 `json:"total_del_processed"`
+	} `json:"stats"`
+	Compact bool `json:"compact"`
+}
+
+// call do the request and print the indented json response, an error if
+// the ret is not ok.
+func call(method, uri string, params url.Values) (err error) {
+	var (
+		res  json.RawMessage
+		ret  meta.StoreRet
+		buf  bytes.Buffer
+		data []byte
+	)
+	if err = do(method, uri, params, &res); err != nil {
+		return
+	}
+	data = []byte(res)
+	if err = json.Indent(&buf, data, "", "  "); err == nil {
+		data = buf.Bytes()
+	}
+	fmt.Printf("%s\n", data)
+	if err = json.Unmarshal(res, &ret); err == nil && ret.Ret != errors.RetOK {
+		err = fmt.Errorf("ret: %d", ret.Ret)
+	}
+	return
+}
+
+// do do the request, decode the json response into res.
+func do(method, uri string, params url.Values, res interface{}) (err error) {
+	var (
+		body []byte
+		resp *http.Response
+		c    = &http.Client{Timeout: timeout}
+	)
+	if method == "GET" {
+		resp, err = c.Get(uri + "?" + params.Encode())
+	} else {
+		resp, err = c.Post(uri, "application/x-www-form-urlencoded", strings.NewReader(params.Encode()))
+	}
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s status: %d %s", uri, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, res)
+}
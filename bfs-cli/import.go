@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"bfs/client"
+	"bfs/libs/errors"
+)
+
+const (
+	// the files larger are uploaded alone by the stream upload
+	_importFileSize = 4 * 1024 * 1024
+	// the max bytes of a batch
+	_importBatchSize = 32 * 1024 * 1024
+)
+
+// importer upload the files in batches, every batch is one directory request
+// and one append request per store.
+type importer struct {
+	bucket string
+	prefix string
+	batch  []*client.File
+	size   int
+	// results
+	imported int
+	exist    int
+	failed   int
+}
+
+// importFiles import the files of a directory tree or a tar(.gz) archive,
+// named by the prefix and the relative paths.
+func importFiles(args []string) (err error) {
+	var im = &importer{bucket: args[0]}
+	if len(args) > 2 {
+		im.prefix = args[2]
+	}
+	if src := args[1]; strings.HasSuffix(src, ".tar") || strings.HasSuffix(src, ".tar.gz") || strings.HasSuffix(src, ".tgz") {
+		err = im.importTar(src)
+	} else {
+		err = im.importDir(src)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+	fmt.Printf("imported: %d, exist: %d, failed: %d\n", im.imported, im.exist, im.failed)
+	if err == nil && im.failed > 0 {
+		err = fmt.Errorf("%d files failed", im.failed)
+	}
+	return
+}
+
+// importDir import the regular files of the directory tree.
+func (im *importer) importDir(dir string) error {
+	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		var (
+			rel string
+			f   *os.File
+		)
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		if rel, err = filepath.Rel(dir, file); err != nil {
+			return err
+		}
+		if f, err = os.Open(file); err != nil {
+			return err
+		}
+		err = im.add(filepath.ToSlash(rel), fi.ModTime().Unix(), fi.Size(), f)
+		f.Close()
+		return err
+	})
+}
+
+// importTar import the regular files of the tar archive, gzipped if the
+// name ends with gz.
+func (im *importer) importTar(file string) (err error) {
+	var (
+		f   *os.File
+		gr  *gzip.Reader
+		hdr *tar.Header
+		r   io.Reader
+		tr  *tar.Reader
+	)
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer f.Close()
+	if r = f; strings.HasSuffix(file, "gz") {
+		if gr, err = gzip.NewReader(f); err != nil {
+			return
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr = tar.NewReader(r)
+	for {
+		if hdr, err = tr.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err = im.add(strings.TrimPrefix(path.Clean(hdr.Name), "/"), hdr.ModTime.Unix(), hdr.Size, tr); err != nil {
+			return
+		}
+	}
+}
+
+// add add the file to the batch, a large file is uploaded alone.
+func (im *importer) add(name string, mtime, size int64, r io.Reader) (err error) {
+	var (
+		data     []byte
+		m        string
+		filename = im.prefix + name
+	)
+	if m = mime.TypeByExtension(path.Ext(name)); m == "" {
+		m = _defaultMine
+	}
+	if size > _importFileSize {
+		im.result(filename, cli.UploadStream(im.bucket, filename, m, mtime, r))
+		return
+	}
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	im.batch = append(im.batch, &client.File{Filename: filename, Mine: m, MTime: mtime, Data: data})
+	if im.size += len(data); len(im.batch) >= batchNum || im.size >= _importBatchSize {
+		err = im.flush()
+	}
+	return
+}
+
+// flush upload the batch, the directory error stops the import.
+func (im *importer) flush() (err error) {
+	var f *client.File
+	if len(im.batch) == 0 {
+		return
+	}
+	if err = cli.Uploads(im.bucket, im.batch); err == nil {
+		for _, f = range im.batch {
+			im.result(f.Filename, f.Err)
+		}
+	}
+	im.batch, im.size = im.batch[:0], 0
+	return
+}
+
+// result count the result of the file, the existing files are skipped so an
+// import can be rerun.
+func (im *importer) result(filename string, err error) {
+	switch err {
+	case nil:
+		im.imported++
+	case errors.ErrNeedleExist:
+		im.exist++
+	default:
+		im.failed++
+		fmt.Fprintf(os.Stderr, "import %s: %v\n", filename, err)
+	}
+}
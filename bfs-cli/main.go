@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"bfs/client"
+	"bfs/libs/log"
+)
+
+const (
+	version = "1.0.0"
+)
+
+var (
+	directoryAddr string
+	adminAddr     string
+	region        string
+	mine          string
+	timeout       time.Duration
+	batchNum      int
+	cli           *client.Client
+)
+
+// command a sub command, args are the arguments after the name.
+type command struct {
+	usage string
+	nargs int // the minimum number of the arguments
+	do    func(args []string) error
+}
+
+var commands = map[string]*command{
+	"upload":         {"BUCKET FILENAME [FILE]\tupload the file, stdin if no FILE", 2, upload},
+	"get":            {"BUCKET FILENAME [FILE]\tget the file, stdout if no FILE", 2, get},
+	"delete":         {"BUCKET FILENAME\tdelete the file", 2, del},
+	"stat":           {"BUCKET FILENAME\tprint the meta of the file", 2, stat},
+	"list":           {"BUCKET [PREFIX]\tlist the files and the common prefixes by \"/\"", 1, list},
+	"buckets":        {"\tlist the buckets", 0, buckets},
+	"bucket":         {"NAME\tprint the bucket", 1, bucket},
+	"bucket-create":  {"NAME PROPERTY\tcreate the bucket, property 0 public, 1 private read, 2 private write, 3 private", 2, createBucket},
+	"bucket-delete":  {"NAME\tdelete the bucket", 1, delBucket},
+	"bucket-key":     {"NAME\tadd an access key of the bucket", 1, addBucketKey},
+	"bucket-key-del": {"NAME ID\tdelete the access key of the bucket", 2, delBucketKey},
+	"volumes":        {"STORE_STAT_ADDR\tlist the volumes of the store", 1, volumes},
+	"compact":        {"STORE_ADMIN_ADDR VID\tcompact the volume of the store", 2, compact},
+	"health":         {"[STORE_STAT_ADDR...]\tprint the cluster health, or the health of the stores", 0, health},
+	"plan":           {"[-add ID@RACK,...] [-remove ID,...] [-replicas N] [-volumes N] [-f FILE]\tsimulate the store changes, print the volume moves and the balance", 0, plan},
+	"import":         {"BUCKET SRC [PREFIX]\timport the files of the directory or the tar(.gz) SRC, named PREFIX and the relative paths", 2, importFiles},
+}
+
+func init() {
+	flag.StringVar(&directoryAddr, "d", "localhost:6065", " set the directory http addr")
+	flag.StringVar(&adminAddr, "a", "localhost:6069", " set the directory admin http addr, for the bucket commands")
+	flag.StringVar(&region, "r", "", " set the caller region, the stores in it are read first")
+	flag.StringVar(&mine, "m", "", " set the mine of the upload, by the file extension if empty")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, " set the request timeout")
+	flag.IntVar(&batchNum, "batch", 32, " set the files uploaded in one request by import")
+	flag.Usage = usage
+}
+
+// bfs-cli the operator command line tool of the directory and the stores.
+func main() {
+	var (
+		ok   bool
+		err  error
+		cmd  *command
+		args []string
+	)
+	flag.Parse()
+	defer log.Flush()
+	if args = flag.Args(); len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if cmd, ok = commands[args[0]]; !ok || len(args)-1 < cmd.nargs {
+		usage()
+		os.Exit(2)
+	}
+	cli = client.New(&client.Config{Directory: directoryAddr, Region: region, Timeout: timeout})
+	if err = cmd.do(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "bfs-cli %s: %v\n", args[0], err)
+		log.Flush()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	var (
+		name  string
+		names []string
+	)
+	fmt.Fprintf(os.Stderr, "bfs-cli [version: %s]\nusage: bfs-cli [flags] command [arguments]\n\ncommands:\n", version)
+	for name = range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name = range names {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"bfs/libs/meta"
+)
+
+const (
+	_directoryTopologyApi = "http://%s/topology"
+)
+
+// planGroup a group of the simulated cluster, every store holds all the
+// volumes of the group.
+type planGroup struct {
+	id      int
+	stores  []string
+	volumes []*meta.TopologyVolume
+	used    uint64
+	added   bool // formed by the new stores
+}
+
+// planMove a volume copied to the stores of another group.
+type planMove struct {
+	vid  int32
+	used uint64
+	from int
+	to   int
+}
+
+// planCopy the volumes of the group copied to a store joining it.
+type planCopy struct {
+	group   int
+	store   string
+	volumes int
+	bytes   uint64
+}
+
+// planner simulate the capacity changes on the cluster topology, the stores
+// added, removed and the replicas of the groups, then the volumes are moved
+// from the groups removed and the fullest groups to the emptiest ones. the
+// stores of a group never share a failure domain.
+type planner struct {
+	domain      string // rack or zone
+	replicas    int    // the stores of a group
+	slots       int    // the volumes a store holds at most
+	threshold   float64
+	volumeBytes uint64
+	stores      map[string]*meta.Store
+	groups      []*planGroup
+	pool        []string // the stores in no group
+	orphans     []*meta.TopologyVolume
+	from        map[int32]int // the orphan volume:the removed group
+	// results
+	moves    []*planMove
+	copies   []*planCopy
+	leaves   []string // group:store left the groups
+	unplaced []int32
+}
+
+// plan simulate the capacity changes on the topology of the directory, or of
+// the json file, print the group changes, the volume moves and the projected
+// balance, nothing is applied.
+func plan(args []string) (err error) {
+	var (
+		data      []byte
+		t         = new(meta.Topology)
+		p         *planner
+		add       []*meta.Store
+		remove    []string
+		fset      = flag.NewFlagSet("plan", flag.ContinueOnError)
+		file      = fset.String("f", "", " set the topology json file, the directory /topology if empty")
+		adds      = fset.String("add", "", " set the new stores, id@rack (or id@zone) separated by comma")
+		removes   = fset.String("remove", "", " set the removed store ids separated by comma")
+		replicas  = fset.Int("replicas", 0, " set the stores of a group, the most of the groups if 0")
+		slots     = fset.Int("volumes", 0, " set the volumes a store holds at most, the most of the groups if 0")
+		domain    = fset.String("domain", "rack", " set the failure domain, rack or zone")
+		threshold = fset.Float64("threshold", 0.1, " set the used ratio difference of the groups balanced")
+	)
+	if err = fset.Parse(args); err != nil {
+		return
+	}
+	if *file != "" {
+		if data, err = ioutil.ReadFile(*file); err != nil {
+			return
+		}
+		err = json.Unmarshal(data, t)
+	} else {
+		err = do("GET", fmt.Sprintf(_directoryTopologyApi, directoryAddr), nil, t)
+	}
+	if err != nil {
+		return
+	}
+	if add, err = parseStores(*adds, *domain); err != nil {
+		return
+	}
+	if *removes != "" {
+		remove = strings.Split(*removes, ",")
+	}
+	p = newPlanner(t, *domain, *replicas, *slots, *threshold)
+	p.print("current")
+	if err = p.run(add, remove); err != nil {
+		return
+	}
+	p.print("planned")
+	p.printChanges()
+	if len(p.unplaced) > 0 {
+		err = fmt.Errorf("%d volumes can't be placed, add stores or volumes of a store", len(p.unplaced))
+	}
+	return
+}
+
+// parseStores parse the new stores, id@domain separated by comma.
+func parseStores(s, domain string) (stores []*meta.Store, err error) {
+	var (
+		i  int
+		st *meta.Store
+	)
+	if s == "" {
+		return
+	}
+	for _, id := range strings.Split(s, ",") {
+		st = &meta.Store{Id: id}
+		if i = strings.LastIndex(id, "@"); i >= 0 {
+			st.Id = id[:i]
+			if domain == "zone" {
+				st.Zone = id[i+1:]
+			} else {
+				st.Rack = id[i+1:]
+			}
+		}
+		if st.Id == "" {
+			return nil, fmt.Errorf("bad store: %s", id)
+		}
+		stores = append(stores, st)
+	}
+	return
+}
+
+// newPlanner new a planner of the topology, the replicas and the volumes of
+// a store are the most of the groups if 0.
+func newPlanner(t *meta.Topology, domain string, replicas, slots int, threshold float64) (p *planner) {
+	var (
+		s       *meta.Store
+		tg      *meta.TopologyGroup
+		g       *planGroup
+		grouped = make(map[string]bool)
+	)
+	p = &planner{domain: domain, replicas: replicas, slots: slots, threshold: threshold, volumeBytes: t.VolumeBytes}
+	p.stores = make(map[string]*meta.Store, len(t.Stores))
+	p.from = make(map[int32]int)
+	for _, s = range t.Stores {
+		p.stores[s.Id] = s
+	}
+	for _, tg = range t.Groups {
+		g = &planGroup{id: tg.Group, stores: append([]string(nil), tg.Stores...), volumes: append([]*meta.TopologyVolume(nil), tg.Volumes...)}
+		for _, v := range g.volumes {
+			g.used += v.Used
+		}
+		for _, sid := range g.stores {
+			grouped[sid] = true
+		}
+		if replicas == 0 && len(g.stores) > p.replicas {
+			p.replicas = len(g.stores)
+		}
+		if slots == 0 && len(g.volumes) > p.slots {
+			p.slots = len(g.volumes)
+		}
+		p.groups = append(p.groups, g)
+	}
+	for _, s = range t.Stores {
+		if !grouped[s.Id] {
+			p.pool = append(p.pool, s.Id)
+		}
+	}
+	if p.replicas == 0 {
+		p.replicas = 1
+	}
+	if p.slots == 0 {
+		p.slots = 1
+	}
+	return
+}
+
+// failureDomain get the failure domain of the store, the store itself if
+// unknown.
+func (p *planner) failureDomain(sid string) (fd string) {
+	if s, ok := p.stores[sid]; ok {
+		if fd = s.Rack; p.domain == "zone" {
+			fd = s.Zone
+		}
+	}
+	if fd == "" {
+		fd = "store:" + sid
+	}
+	return
+}
+
+// capacity the bytes a group holds at most.
+func (p *planner) capacity() uint64 {
+	return uint64(p.slots) * p.volumeBytes
+}
+
+// ratio the used ratio of the group.
+func (p *planner) ratio(g *planGroup) float64 {
+	if p.capacity() == 0 {
+		return 0
+	}
+	return float64(g.used) / float64(p.capacity())
+}
+
+// run apply the changes to the simulated cluster.
+func (p *planner) run(add []*meta.Store, remove []string) (err error) {
+	var (
+		s       *meta.Store
+		sid     string
+		removed = make(map[string]bool, len(remove))
+	)
+	for _, sid = range remove {
+		if _, ok := p.stores[sid]; !ok {
+			return fmt.Errorf("store: %s not found", sid)
+		}
+		removed[sid] = true
+	}
+	for _, s = range add {
+		if _, ok := p.stores[s.Id]; ok {
+			return fmt.Errorf("store: %s exists", s.Id)
+		}
+		p.stores[s.Id] = s
+		p.pool = append(p.pool, s.Id)
+	}
+	p.pool = filter(p.pool, removed)
+	p.resize(removed)
+	p.fill()
+	p.form()
+	p.place()
+	p.balance()
+	return
+}
+
+// filter get the stores not removed.
+func filter(stores []string, removed map[string]bool) (ss []string) {
+	for _, sid := range stores {
+		if !removed[sid] {
+			ss = append(ss, sid)
+		}
+	}
+	return
+}
+
+// resize remove the stores from the groups, and the extra stores of the
+// groups larger than the replicas, the ones sharing a failure domain first.
+func (p *planner) resize(removed map[string]bool) {
+	var (
+		sid  string
+		fd   string
+		keep []string
+		dups []string
+		seen map[string]bool
+	)
+	for _, g := range p.groups {
+		keep, dups, seen = nil, nil, make(map[string]bool)
+		for _, sid = range g.stores {
+			if removed[sid] {
+				p.leaves = append(p.leaves, fmt.Sprintf("%d:%s removed", g.id, sid))
+				continue
+			}
+			// the distinct domains first
+			if fd = p.failureDomain(sid); seen[fd] {
+				dups = append(dups, sid)
+				continue
+			}
+			seen[fd] = true
+			keep = append(keep, sid)
+		}
+		if keep = append(keep, dups...); len(keep) > p.replicas {
+			for _, sid = range keep[p.replicas:] {
+				p.leaves = append(p.leaves, fmt.Sprintf("%d:%s dropped", g.id, sid))
+				p.pool = append(p.pool, sid)
+			}
+			keep = keep[:p.replicas]
+		}
+		g.stores = keep
+	}
+}
+
+// fill add the stores of the pool to the groups smaller than the replicas,
+// the group is removed if not enough stores of the other domains, its
+// volumes moved to the others.
+func (p *planner) fill() {
+	var (
+		i      int
+		sid    string
+		bytes  uint64
+		groups []*planGroup
+	)
+	for _, g := range p.groups {
+		for len(g.stores) < p.replicas && len(g.stores) > 0 {
+			if i = p.pick(g.stores); i < 0 {
+				break
+			}
+			sid = p.pool[i]
+			p.pool = append(p.pool[:i], p.pool[i+1:]...)
+			g.stores = append(g.stores, sid)
+			bytes = g.used
+			p.copies = append(p.copies, &planCopy{group: g.id, store: sid, volumes: len(g.volumes), bytes: bytes})
+		}
+		if len(g.stores) < p.replicas {
+			for _, sid = range g.stores {
+				p.leaves = append(p.leaves, fmt.Sprintf("%d:%s group removed", g.id, sid))
+			}
+			// the copies to the group never happen
+			p.uncopy(g.id)
+			p.pool = append(p.pool, g.stores...)
+			for _, v := range g.volumes {
+				p.orphans = append(p.orphans, v)
+				p.from[v.Id] = g.id
+			}
+			continue
+		}
+		groups = append(groups, g)
+	}
+	p.groups = groups
+}
+
+// uncopy remove the copies to the group, the stores joined go back to the
+// pool with the group stores.
+func (p *planner) uncopy(gid int) {
+	var copies []*planCopy
+	for _, c := range p.copies {
+		if c.group != gid {
+			copies = append(copies, c)
+		}
+	}
+	p.copies = copies
+}
+
+// pick get the index of the pool store of a domain none of the stores in,
+// the domain of the most pool stores first, -1 if none.
+func (p *planner) pick(stores []string) (ix int) {
+	var (
+		i     int
+		sid   string
+		fd    string
+		used  = make(map[string]bool, len(stores))
+		count = make(map[string]int)
+	)
+	for _, sid = range stores {
+		used[p.failureDomain(sid)] = true
+	}
+	for _, sid = range p.pool {
+		count[p.failureDomain(sid)]++
+	}
+	ix = -1
+	for i, sid = range p.pool {
+		if fd = p.failureDomain(sid); used[fd] {
+			continue
+		}
+		if ix < 0 || count[fd] > count[p.failureDomain(p.pool[ix])] {
+			ix = i
+		}
+	}
+	return
+}
+
+// form form the new groups of the pool stores, the rest are spare.
+func (p *planner) form() {
+	var (
+		i      int
+		id     int
+		stores []string
+	)
+	sort.Strings(p.pool)
+	for _, g := range p.groups {
+		if g.id > id {
+			id = g.id
+		}
+	}
+	for _, c := range p.from {
+		if c > id {
+			id = c
+		}
+	}
+	for len(p.pool) >= p.replicas {
+		stores = nil
+		for len(stores) < p.replicas {
+			if i = p.pick(stores); i < 0 {
+				break
+			}
+			stores = append(stores, p.pool[i])
+			p.pool = append(p.pool[:i], p.pool[i+1:]...)
+		}
+		if len(stores) < p.replicas {
+			p.pool = append(p.pool, stores...)
+			sort.Strings(p.pool)
+			break
+		}
+		id++
+		p.groups = append(p.groups, &planGroup{id: id, stores: stores, added: true})
+	}
+}
+
+// place move the volumes of the removed groups to the emptiest groups with
+// free volumes, the largest first.
+func (p *planner) place() {
+	var g *planGroup
+	sort.SliceStable(p.orphans, func(i, j int) bool { return p.orphans[i].Used > p.orphans[j].Used })
+	for _, v := range p.orphans {
+		if g = p.emptiest(nil); g == nil {
+			p.unplaced = append(p.unplaced, v.Id)
+			continue
+		}
+		g.volumes = append(g.volumes, v)
+		g.used += v.Used
+		p.moves = append(p.moves, &planMove{vid: v.Id, used: v.Used, from: p.from[v.Id], to: g.id})
+	}
+}
+
+// emptiest get the least used group with free volumes except the group, nil
+// if none.
+func (p *planner) emptiest(except *planGroup) (e *planGroup) {
+	for _, g := range p.groups {
+		if g == except || len(g.volumes) >= p.slots {
+			continue
+		}
+		if e == nil || g.used < e.used {
+			e = g
+		}
+	}
+	return
+}
+
+// balance move the volumes from the fullest group to the emptiest one until
+// their used ratios differ no more than the threshold, the volume makes
+// them closest is moved.
+func (p *planner) balance() {
+	var (
+		i, n   int
+		ix     int
+		gap    uint64
+		best   uint64
+		diff   uint64
+		hi, lo *planGroup
+		v      *meta.TopologyVolume
+		max    = len(p.groups) * p.slots
+	)
+	for n = 0; n < max; n++ {
+		hi = nil
+		for _, g := range p.groups {
+			if hi == nil || g.used > hi.used {
+				hi = g
+			}
+		}
+		if hi == nil || len(hi.volumes) == 0 {
+			return
+		}
+		if lo = p.emptiest(hi); lo == nil || lo.used >= hi.used {
+			return
+		}
+		if gap = hi.used - lo.used; p.capacity() == 0 || float64(gap)/float64(p.capacity()) <= p.threshold {
+			return
+		}
+		// the moved volume narrows the gap, closest to half
+		ix = -1
+		for i, v = range hi.volumes {
+			if v.Used == 0 || v.Used >= gap {
+				continue
+			}
+			if diff = absDiff(2*v.Used, gap); ix < 0 || diff < best {
+				ix, best = i, diff
+			}
+		}
+		if ix < 0 {
+			return
+		}
+		v = hi.volumes[ix]
+		hi.volumes = append(hi.volumes[:ix], hi.volumes[ix+1:]...)
+		hi.used -= v.Used
+		lo.volumes = append(lo.volumes, v)
+		lo.used += v.Used
+		p.move(v, hi.id, lo.id)
+	}
+}
+
+// move record the move of the volume, a volume moved again moves once.
+func (p *planner) move(v *meta.TopologyVolume, from, to int) {
+	for i, m := range p.moves {
+		if m.vid != v.Id {
+			continue
+		}
+		if m.to = to; m.from == m.to {
+			p.moves = append(p.moves[:i], p.moves[i+1:]...)
+		}
+		return
+	}
+	p.moves = append(p.moves, &planMove{vid: v.Id, used: v.Used, from: from, to: to})
+}
+
+func absDiff(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// print print the groups and the balance.
+func (p *planner) print(title string) {
+	var (
+		lo, hi float64
+		r      float64
+		used   uint64
+		flag   string
+	)
+	fmt.Printf("%s: replicas: %d, volumes of a store: %d\n", title, p.replicas, p.slots)
+	fmt.Printf("%8s  %8s  %14s  %6s  %s\n", "GROUP", "VOLUMES", "USED", "RATIO", "STORES")
+	for i, g := range p.groups {
+		if flag = ""; g.added {
+			flag = " (new)"
+		}
+		r = p.ratio(g)
+		fmt.Printf("%8d  %8d  %14d  %6.2f  %s%s\n", g.id, len(g.volumes), g.used, r, strings.Join(g.stores, ","), flag)
+		if i == 0 || r < lo {
+			lo = r
+		}
+		if i == 0 || r > hi {
+			hi = r
+		}
+		used += g.used
+	}
+	fmt.Printf("groups: %d, used: %d, ratio min: %.2f max: %.2f\n", len(p.groups), used, lo, hi)
+	if len(p.pool) > 0 {
+		fmt.Printf("spare stores: %s\n", strings.Join(p.pool, ","))
+	}
+	fmt.Println()
+}
+
+// printChanges print the store changes and the volume moves.
+func (p *planner) printChanges() {
+	var bytes uint64
+	for _, l := range p.leaves {
+		fmt.Printf("leave group %s\n", l)
+	}
+	for _, c := range p.copies {
+		fmt.Printf("join group %d:%s, copy %d volumes %d bytes\n", c.group, c.store, c.volumes, c.bytes)
+		bytes += c.bytes
+	}
+	sort.SliceStable(p.moves, func(i, j int) bool { return p.moves[i].vid < p.moves[j].vid })
+	for _, m := range p.moves {
+		fmt.Printf("move volume %d: group %d -> %d, %d bytes\n", m.vid, m.from, m.to, m.used)
+		bytes += m.used * uint64(p.replicas)
+	}
+	for _, vid := range p.unplaced {
+		fmt.Printf("unplaced volume %d\n", vid)
+	}
+	fmt.Printf("moves: %d, joins: %d, copied bytes: %d\n", len(p.moves), len(p.copies), bytes)
+}
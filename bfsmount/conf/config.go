@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"bfs/libs/check"
+	"bfs/libs/time"
+	"math"
+	xtime "time"
+
+	"github.com/BurntSushi/toml"
+)
+
+type Config struct {
+	// directory
+	BfsAddr string
+	// region of the client, reads prefer the replicas in the region
+	Region string
+	// the mounted bucket and the mount point
+	Bucket string
+	Dir    string
+	// create, write and remove the files, else mounted read only
+	Writable bool
+	// the larger files can not be written
+	MaxFileSize int
+	// the directory entries are listed again after
+	Expire time.Duration
+}
+
+// NewConfig new a config.
+func NewConfig(conf string) (c *Config, err error) {
+	c = new(Config)
+	_, err = toml.DecodeFile(conf, c)
+	return
+}
+
+// Check check the config values, return all the problems found.
+func (c *Config) Check() error {
+	var ck = check.New()
+	ck.Addr("BfsAddr", c.BfsAddr)
+	ck.NotEmpty("Bucket", c.Bucket)
+	ck.NotEmpty("Dir", c.Dir)
+	if c.Writable {
+		ck.Range("MaxFileSize", int64(c.MaxFileSize), 1, math.MaxInt32)
+	}
+	ck.Positive("Expire", xtime.Duration(c.Expire))
+	return ck.Err()
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"bfs/bfsmount/conf"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/proxy/bfs"
+	pconf "bfs/proxy/conf"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+const (
+	_delimiter = "/"
+	// the files once list
+	_listLimit = 1000
+	// the same as the proxy
+	_maxFileNameLength = 100
+)
+
+// FS the bucket as a file system, the filename "a/b/c.jpg" is the file c.jpg
+// of the directory a/b, the directories are the common prefixes.
+type FS struct {
+	c    *conf.Config
+	bfs  *bfs.Bfs
+	root *Dir
+	uid  uint32
+	gid  uint32
+}
+
+// NewFS new the file system of the bucket.
+func NewFS(c *conf.Config) (f *FS) {
+	f = &FS{
+		c:   c,
+		bfs: bfs.New(&pconf.Config{BfsAddr: c.BfsAddr, Region: c.Region}),
+		uid: uint32(os.Getuid()),
+		gid: uint32(os.Getgid()),
+	}
+	f.root = newDir(f, "")
+	return
+}
+
+// Root the root directory.
+func (f *FS) Root() (fs.Node, error) {
+	return f.root, nil
+}
+
+// mode the permission of the files, read only if not writable.
+func (f *FS) mode(dir bool) (mode os.FileMode) {
+	if dir {
+		mode = os.ModeDir | 0555
+	} else {
+		mode = 0444
+	}
+	if f.c.Writable {
+		mode |= 0200
+	}
+	return
+}
+
+// errno convert the bfs error.
+func errno(err error) error {
+	if err == errors.ErrNeedleNotExist {
+		return fuse.ENOENT
+	}
+	return fuse.EIO
+}
+
+// Dir a directory, the listed entries are cached for the expire. the made
+// directories and the empty files can not be stored, they are kept in
+// memory until listed or removed.
+type Dir struct {
+	fs     *FS
+	prefix string // "" or "a/b/"
+	lock   sync.Mutex
+	expire time.Time
+	nodes  map[string]fs.Node // listed
+	made   map[string]fs.Node // in memory
+}
+
+func newDir(f *FS, prefix string) *Dir {
+	return &Dir{fs: f, prefix: prefix, nodes: make(map[string]fs.Node), made: make(map[string]fs.Node)}
+}
+
+// load list the entries of the directory if expired, the nodes of the same
+// name are kept, called with the lock held.
+func (d *Dir) load(ctx context.Context) (err error) {
+	var (
+		ok     bool
+		name   string
+		marker string
+		dir    *Dir
+		file   *File
+		l      *meta.List
+		mf     *meta.File
+		nodes  = make(map[string]fs.Node, len(d.nodes))
+	)
+	if time.Now().Before(d.expire) {
+		return
+	}
+	for {
+		if l, err = d.fs.bfs.List(ctx, d.fs.c.Bucket, d.prefix, _delimiter, marker, _listLimit); err != nil {
+			log.Errorf("bfs.List(%s, %s) error(%v)", d.fs.c.Bucket, d.prefix, err)
+			return errno(err)
+		}
+		for _, name = range l.Prefixes {
+			name = path.Base(name)
+			if dir, ok = d.nodes[name].(*Dir); !ok {
+				if dir, ok = d.made[name].(*Dir); !ok {
+					dir = newDir(d.fs, d.prefix+name+_delimiter)
+				}
+			}
+			nodes[name] = dir
+		}
+		for _, mf = range l.Files {
+			name = mf.Filename[len(d.prefix):]
+			if file, ok = d.nodes[name].(*File); !ok {
+				file, ok = d.made[name].(*File)
+			}
+			if ok {
+				file.setMeta(mf)
+			} else {
+				file = &File{dir: d, name: name, mf: mf}
+			}
+			nodes[name] = file
+		}
+		if marker = l.Marker; marker == "" {
+			break
+		}
+	}
+	for name = range nodes {
+		delete(d.made, name)
+	}
+	d.nodes = nodes
+	d.expire = time.Now().Add(time.Duration(d.fs.c.Expire))
+	return
+}
+
+// lookup get the node by the name.
+func (d *Dir) lookup(ctx context.Context, name string) (node fs.Node, err error) {
+	var ok bool
+	if err = d.load(ctx); err != nil {
+		return
+	}
+	if node, ok = d.nodes[name]; !ok {
+		if node, ok = d.made[name]; !ok {
+			err = fuse.ENOENT
+		}
+	}
+	return
+}
+
+// put keep the written file, or the empty one in memory.
+func (d *Dir) put(f *File) {
+	d.lock.Lock()
+	if f.size() > 0 {
+		delete(d.made, f.name)
+		d.nodes[f.name] = f
+	} else {
+		d.made[f.name] = f
+	}
+	d.lock.Unlock()
+}
+
+func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = d.fs.mode(true)
+	a.Uid, a.Gid = d.fs.uid, d.fs.gid
+	return nil
+}
+
+func (d *Dir) Lookup(ctx context.Context, name string) (node fs.Node, err error) {
+	d.lock.Lock()
+	node, err = d.lookup(ctx, name)
+	d.lock.Unlock()
+	return
+}
+
+func (d *Dir) ReadDirAll(ctx context.Context) (des []fuse.Dirent, err error) {
+	var (
+		ok   bool
+		name string
+		node fs.Node
+		ns   map[string]fs.Node
+	)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err = d.load(ctx); err != nil {
+		return
+	}
+	des = make([]fuse.Dirent, 0, len(d.nodes)+len(d.made))
+	for _, ns = range []map[string]fs.Node{d.nodes, d.made} {
+		for name, node = range ns {
+			if _, ok = node.(*Dir); ok {
+				des = append(des, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+			} else {
+				des = append(des, fuse.Dirent{Name: name, Type: fuse.DT_File})
+			}
+		}
+	}
+	return
+}
+
+func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (node fs.Node, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err = d.lookup(ctx, req.Name); err == nil {
+		return nil, fuse.EEXIST
+	} else if err != fuse.ENOENT {
+		return
+	}
+	node = newDir(d.fs, d.prefix+req.Name+_delimiter)
+	d.made[req.Name] = node
+	return node, nil
+}
+
+func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	var f = &File{dir: d, name: req.Name, mf: &meta.File{Filename: d.prefix + req.Name}, writing: true}
+	if len(f.mf.Filename) > _maxFileNameLength {
+		return nil, nil, fuse.Errno(syscall.ENAMETOOLONG)
+	}
+	d.put(f)
+	return f, f, nil
+}
+
+func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
+	var (
+		ok       bool
+		filename = d.prefix + req.Name
+	)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err = d.lookup(ctx, req.Name); err != nil {
+		return
+	}
+	if _, ok = d.made[req.Name]; ok {
+		delete(d.made, req.Name)
+		return nil
+	}
+	// a listed directory has files
+	if req.Dir {
+		return fuse.Errno(syscall.ENOTEMPTY)
+	}
+	if err = d.fs.bfs.Delete(ctx, d.fs.c.Bucket, filename); err != nil && err != errors.ErrNeedleNotExist {
+		log.Errorf("bfs.Delete(%s, %s) error(%v)", d.fs.c.Bucket, filename, err)
+		return errno(err)
+	}
+	delete(d.nodes, req.Name)
+	return nil
+}
+
+// File a file of the bucket, read whole on open and written whole on flush.
+type File struct {
+	dir     *Dir
+	name    string
+	lock    sync.Mutex
+	mf      *meta.File
+	data    []byte
+	writing bool
+	dirty   bool
+}
+
+func (f *File) setMeta(mf *meta.File) {
+	f.lock.Lock()
+	if !f.writing {
+		f.mf = mf
+	}
+	f.lock.Unlock()
+}
+
+func (f *File) size() (size int64) {
+	f.lock.Lock()
+	if f.writing {
+		size = int64(len(f.data))
+	} else {
+		size = f.mf.Size
+	}
+	f.lock.Unlock()
+	return
+}
+
+func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
+	f.lock.Lock()
+	a.Mode = f.dir.fs.mode(false)
+	a.Uid, a.Gid = f.dir.fs.uid, f.dir.fs.gid
+	if f.writing {
+		a.Size = uint64(len(f.data))
+	} else {
+		a.Size = uint64(f.mf.Size)
+	}
+	a.Mtime = time.Unix(0, f.mf.MTime)
+	f.lock.Unlock()
+	return nil
+}
+
+// read read the file from the stores.
+func (f *File) read(ctx context.Context) (data []byte, err error) {
+	var src io.ReadCloser
+	// created empty, not uploaded
+	if f.mf.Key == 0 && f.mf.Sha1 == "" {
+		return
+	}
+	if src, _, _, err = f.dir.fs.bfs.Get(ctx, f.dir.fs.c.Bucket, f.mf.Filename); err != nil {
+		log.Errorf("bfs.Get(%s, %s) error(%v)", f.dir.fs.c.Bucket, f.mf.Filename, err)
+		return nil, errno(err)
+	}
+	data, err = ioutil.ReadAll(src)
+	src.Close()
+	if err != nil {
+		log.Errorf("ioutil.ReadAll(%s, %s) error(%v)", f.dir.fs.c.Bucket, f.mf.Filename, err)
+		return nil, fuse.EIO
+	}
+	return
+}
+
+func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (h fs.Handle, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	// the size of the file uploaded without it is unknown
+	if f.mf.Size == 0 {
+		resp.Flags |= fuse.OpenDirectIO
+	}
+	if req.Flags.IsReadOnly() || f.writing {
+		return f, nil
+	}
+	if req.Flags&fuse.OpenTruncate == 0 {
+		if f.data, err = f.read(ctx); err != nil {
+			return
+		}
+	} else {
+		f.data, f.dirty = nil, true
+	}
+	f.writing = true
+	return f, nil
+}
+
+func (f *File) ReadAll(ctx context.Context) (data []byte, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.writing {
+		return f.data, nil
+	}
+	return f.read(ctx)
+}
+
+func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	var end = int(req.Offset) + len(req.Data)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if end > f.dir.fs.c.MaxFileSize {
+		return fuse.Errno(syscall.EFBIG)
+	}
+	if end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	copy(f.data[req.Offset:], req.Data)
+	resp.Size = len(req.Data)
+	f.dirty = true
+	return nil
+}
+
+func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	f.lock.Lock()
+	if req.Valid.Size() && f.writing && int(req.Size) != len(f.data) {
+		if int(req.Size) > f.dir.fs.c.MaxFileSize {
+			f.lock.Unlock()
+			return fuse.Errno(syscall.EFBIG)
+		}
+		if int(req.Size) < len(f.data) {
+			f.data = f.data[:req.Size]
+		} else {
+			f.data = append(f.data, make([]byte, int(req.Size)-len(f.data))...)
+		}
+		f.dirty = true
+	}
+	f.lock.Unlock()
+	return f.Attr(ctx, &resp.Attr)
+}
+
+// Flush upload the written file, the existed one is deleted first for the
+// upload keeps its needle.
+func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
+	var (
+		mine  string
+		sha   [sha1.Size]byte
+		mtime = time.Now().UnixNano()
+	)
+	f.lock.Lock()
+	if !f.dirty || len(f.data) == 0 {
+		f.lock.Unlock()
+		f.dir.put(f)
+		return nil
+	}
+	if err = f.dir.fs.bfs.Delete(ctx, f.dir.fs.c.Bucket, f.mf.Filename); err != nil && err != errors.ErrNeedleNotExist {
+		log.Errorf("bfs.Delete(%s, %s) error(%v)", f.dir.fs.c.Bucket, f.mf.Filename, err)
+		f.lock.Unlock()
+		return errno(err)
+	}
+	if mine = mime.TypeByExtension(path.Ext(f.name)); mine == "" {
+		mine = http.DetectContentType(f.data)
+	}
+	sha = sha1.Sum(f.data)
+	if err = f.dir.fs.bfs.Upload(ctx, f.dir.fs.c.Bucket, f.mf.Filename, "", mine, hex.EncodeToString(sha[:]), mtime, f.data); err != nil && err != errors.ErrNeedleExist {
+		log.Errorf("bfs.Upload(%s, %s) error(%v)", f.dir.fs.c.Bucket, f.mf.Filename, err)
+		f.lock.Unlock()
+		return errno(err)
+	}
+	f.mf = &meta.File{Filename: f.mf.Filename, Sha1: hex.EncodeToString(sha[:]), Mine: mine, MTime: mtime, Size: int64(len(f.data))}
+	f.dirty = false
+	f.lock.Unlock()
+	f.dir.put(f)
+	return nil
+}
+
+// Release drop the written data, the file is read again then.
+func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	f.lock.Lock()
+	if f.writing && !f.dirty && len(f.data) > 0 {
+		f.data, f.writing = nil, false
+	}
+	f.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"bfs/bfsmount/conf"
+	"bfs/libs/check"
+	"bfs/libs/log"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+const (
+	version = "1.0.0"
+)
+
+var (
+	configFile string
+	testConfig bool
+)
+
+func init() {
+	flag.StringVar(&configFile, "c", "./bfsmount.toml", " set bfsmount config file path")
+	flag.BoolVar(&testConfig, "t", false, " test config and exit")
+}
+
+// bfsmount mount a bucket as a file system by fuse, unmounted on exit.
+func main() {
+	var (
+		c    *conf.Config
+		conn *fuse.Conn
+		opts []fuse.MountOption
+		err  error
+	)
+	flag.Parse()
+	if testConfig {
+		checkConf()
+		return
+	}
+	defer log.Flush()
+	log.Infof("bfsmount [version: %s] start", version)
+	if c, err = conf.NewConfig(configFile); err != nil {
+		log.Errorf("NewConfig(\"%s\") error(%v)", configFile, err)
+		panic(err)
+	}
+	if err = c.Check(); err != nil {
+		log.Errorf("config file %s error(%v)", configFile, err)
+		panic(err)
+	}
+	opts = []fuse.MountOption{fuse.FSName("bfs"), fuse.Subtype("bfs")}
+	if !c.Writable {
+		opts = append(opts, fuse.ReadOnly())
+	}
+	if conn, err = fuse.Mount(c.Dir, opts...); err != nil {
+		log.Errorf("fuse.Mount(%s) error(%v)", c.Dir, err)
+		panic(err)
+	}
+	defer conn.Close()
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+		s := <-ch
+		log.Infof("get a signal %s, unmount %s", s.String(), c.Dir)
+		if err := fuse.Unmount(c.Dir); err != nil {
+			log.Errorf("fuse.Unmount(%s) error(%v)", c.Dir, err)
+		}
+	}()
+	log.Infof("bucket: %s mounted on %s", c.Bucket, c.Dir)
+	if err = fs.Serve(conn, NewFS(c)); err != nil {
+		log.Errorf("fs.Serve(%s) error(%v)", c.Dir, err)
+	}
+}
+
+// checkConf parse and check the config and the directory reachability, then
+// print the effective config, exit non-zero if any problem found.
+func checkConf() {
+	var (
+		c   *conf.Config
+		err error
+	)
+	if c, err = conf.NewConfig(configFile); err == nil {
+		if err = c.Check(); err == nil {
+			ck := check.New()
+			ck.Dial("BfsAddr", []string{c.BfsAddr}, 0)
+			err = ck.Err()
+		}
+		check.Print(os.Stdout, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config file %s test failed:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "config file %s test is successful\n", configFile)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"bfs/libs/meta"
+)
+
+// needle the cached directory lookup of a file, without the stores.
+type needle struct {
+	res    *meta.Response
+	expire time.Time
+}
+
+// volume the cached readable stores of a volume, local is the number of
+// the first stores in the caller region.
+type volume struct {
+	stores []string
+	local  int
+	expire time.Time
+}
+
+// cache the bucket/filename:needle and the vid:stores mappings, the
+// entries expire after ttl and are dropped on read errors.
+type cache struct {
+	ttl     time.Duration
+	lock    sync.RWMutex
+	needles map[string]*needle
+	volumes map[int32]*volume
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{
+		ttl:     ttl,
+		needles: make(map[string]*needle),
+		volumes: make(map[int32]*volume),
+	}
+}
+
+func needleKey(bucket, filename string) string {
+	return bucket + "/" + filename
+}
+
+// needle get the unexpired needle of the file.
+func (c *cache) needle(bucket, filename string) (res *meta.Response) {
+	var (
+		ok bool
+		n  *needle
+	)
+	c.lock.RLock()
+	n, ok = c.needles[needleKey(bucket, filename)]
+	c.lock.RUnlock()
+	if !ok || time.Now().After(n.expire) {
+		return nil
+	}
+	return n.res
+}
+
+// volume get the unexpired stores of the volume.
+func (c *cache) volume(vid int32) (stores []string, local int, ok bool) {
+	var v *volume
+	c.lock.RLock()
+	v, ok = c.volumes[vid]
+	c.lock.RUnlock()
+	if !ok || time.Now().After(v.expire) {
+		return nil, 0, false
+	}
+	return v.stores, v.local, true
+}
+
+// set cache the directory response of the file, the needle and the stores
+// of its volume separately.
+func (c *cache) set(bucket, filename string, res *meta.Response) {
+	var (
+		expire = time.Now().Add(c.ttl)
+		n      = *res
+	)
+	if c.ttl <= 0 {
+		return
+	}
+	n.Stores = nil
+	c.lock.Lock()
+	c.needles[needleKey(bucket, filename)] = &needle{res: &n, expire: expire}
+	if len(res.Stores) > 0 {
+		c.volumes[res.Vid] = &volume{stores: res.Stores, local: res.Local, expire: expire}
+	}
+	c.lock.Unlock()
+}
+
+// setVolume cache the stores of the volume.
+func (c *cache) setVolume(vid int32, stores []string, local int) {
+	if c.ttl <= 0 || len(stores) == 0 {
+		return
+	}
+	c.lock.Lock()
+	c.volumes[vid] = &volume{stores: stores, local: local, expire: time.Now().Add(c.ttl)}
+	c.lock.Unlock()
+}
+
+// delNeedle drop the needle of the file, e.g. deleted or rewritten.
+func (c *cache) delNeedle(bucket, filename string) {
+	c.lock.Lock()
+	delete(c.needles, needleKey(bucket, filename))
+	c.lock.Unlock()
+}
+
+// delVolume drop the stores of the volume, e.g. the stores changed.
+func (c *cache) delVolume(vid int32) {
+	c.lock.Lock()
+	delete(c.volumes, vid)
+	c.lock.Unlock()
+}
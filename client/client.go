@@ -0,0 +1,469 @@
+// Package client is the bfs sdk for the internal services, it resolves the
+// files by the directory and reads them directly from the stores without
+// the proxy, the needles and the stores of the volumes are cached.
+package client
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/region"
+)
+
+const (
+	// api
+	_directoryGetApi     = "http://%s/get"
+	_directoryGetsApi    = "http://%s/gets"
+	_directoryUploadApi  = "http://%s/upload"
+	_directoryUploadsApi = "http://%s/uploads"
+	_directoryDelApi     = "http://%s/del"
+	_directoryListApi    = "http://%s/list"
+	_storeGetApi         = "http://%s/get"
+	_storeUploadApi      = "http://%s/upload"
+	_storeUploadsApi     = "http://%s/uploads"
+	_storeDelApi         = "http://%s/del"
+
+	_defaultTimeout = 5 * time.Second
+)
+
+// Config the sdk config.
+type Config struct {
+	// the directory http addr
+	Directory string
+	// the caller region, the stores in it are read first
+	Region string
+	// the directory and store request timeout, default 5s
+	Timeout time.Duration
+	// the ttl of the cached needles and volumes, no cache if zero
+	Expire time.Duration
+	// the chunk size of the streaming uploads, must be under the store
+	// needle max size, default 8MB
+	ChunkSize int
+}
+
+// Client the bfs client.
+type Client struct {
+	c      *Config
+	client *http.Client
+	cache  *cache
+}
+
+// New new a client.
+func New(c *Config) *Client {
+	var timeout = c.Timeout
+	if timeout <= 0 {
+		timeout = _defaultTimeout
+	}
+	return &Client{
+		c:      c,
+		client: &http.Client{Timeout: timeout},
+		cache:  newCache(c.Expire),
+	}
+}
+
+// Get get the file from the stores, the caller must close the src. the
+// chunks of a chunked file are streamed in order.
+func (c *Client) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	var m *manifest
+	if src, ctlen, mf, err = c.get(bucket, filename); err != nil || mf.Mine != _manifestMine {
+		return
+	}
+	m, err = openManifest(src)
+	src.Close()
+	if err != nil {
+		return
+	}
+	src = &chunkReader{c: c, bucket: bucket, chunks: m.Chunks}
+	ctlen = int(m.Size)
+	mf.Mine, mf.Size, mf.Sha1 = m.Mine, m.Size, m.Sha1
+	return
+}
+
+// get get the needle of the file from the stores.
+func (c *Client) get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	var (
+		res    *meta.Response
+		stores []string
+		local  int
+		cached bool
+	)
+	if res, stores, local, cached, err = c.resolve(bucket, filename); err != nil {
+		return
+	}
+	if src, ctlen, err = c.read(res, stores, local); err != nil && cached {
+		// the file may be deleted, rewritten or the volume moved, resolve
+		// it from the directory again
+		log.Warningf("client read cached bucket: %s filename: %s vid: %d error(%v), retry", bucket, filename, res.Vid, err)
+		c.cache.delNeedle(bucket, filename)
+		c.cache.delVolume(res.Vid)
+		if res, err = c.stat(bucket, filename); err != nil {
+			return
+		}
+		src, ctlen, err = c.read(res, res.Stores, res.Local)
+	}
+	if err != nil {
+		return
+	}
+	mf = file(res)
+	return
+}
+
+// Stat get the meta of the file, the manifest is read for a chunked file.
+func (c *Client) Stat(bucket, filename string) (mf *meta.File, err error) {
+	var (
+		res *meta.Response
+		src io.ReadCloser
+	)
+	if res = c.cache.needle(bucket, filename); res == nil {
+		if res, err = c.stat(bucket, filename); err != nil {
+			return
+		}
+	}
+	if res.Mine != _manifestMine {
+		mf = file(res)
+		return
+	}
+	if src, _, mf, err = c.Get(bucket, filename); err == nil {
+		src.Close()
+	}
+	return
+}
+
+// Upload upload the file to the directory then all the stores.
+func (c *Client) Upload(bucket, filename, mine string, mtime int64, buf []byte) (err error) {
+	var (
+		host   string
+		sum    = sha1.Sum(buf)
+		res    meta.Response
+		sRet   meta.StoreRet
+		params = url.Values{}
+	)
+	params.Set("bucket", bucket)
+	params.Set("filename", filename)
+	params.Set("mine", mine)
+	params.Set("sha1", hex.EncodeToString(sum[:]))
+	params.Set("mtime", strconv.FormatInt(mtime, 10))
+	params.Set("size", strconv.Itoa(len(buf)))
+	if err = c.http("POST", fmt.Sprintf(_directoryUploadApi, c.c.Directory), params, nil, &res); err != nil {
+		return
+	}
+	if res.Ret != errors.RetOK {
+		log.Errorf("client upload directory bucket: %s filename: %s ret: %d", bucket, filename, res.Ret)
+		err = retError(res.Ret)
+		return
+	}
+	c.cache.delNeedle(bucket, filename)
+	params = url.Values{}
+	params.Set("key", strconv.FormatInt(res.Key, 10))
+	params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
+	params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
+	for _, host = range res.Stores {
+		if err = c.http("POST", fmt.Sprintf(_storeUploadApi, host), params, buf, &sRet); err != nil {
+			return
+		}
+		if sRet.Ret != errors.RetOK {
+			log.Errorf("client upload store: %s key: %d vid: %d ret: %d", host, res.Key, res.Vid, sRet.Ret)
+			err = errors.Ret(sRet.Ret)
+			return
+		}
+	}
+	return
+}
+
+// Delete delete the file, and the chunks of a chunked file.
+func (c *Client) Delete(bucket, filename string) (err error) {
+	var (
+		chunk string
+		src   io.ReadCloser
+		res   *meta.Response
+		m     *manifest
+	)
+	if res, err = c.stat(bucket, filename); err != nil {
+		return
+	}
+	if res.Mine == _manifestMine {
+		if src, _, _, err = c.get(bucket, filename); err != nil {
+			return
+		}
+		m, err = openManifest(src)
+		src.Close()
+		if err != nil {
+			return
+		}
+	}
+	if err = c.del(bucket, filename); err != nil || m == nil {
+		return
+	}
+	for _, chunk = range m.Chunks {
+		if err = c.del(bucket, chunk); err != nil && err != errors.ErrNeedleNotExist {
+			return
+		}
+	}
+	err = nil
+	return
+}
+
+// del delete the needle of the file from the directory then all the stores.
+func (c *Client) del(bucket, filename string) (err error) {
+	var (
+		host   string
+		res    meta.Response
+		sRet   meta.StoreRet
+		params = url.Values{}
+	)
+	params.Set("bucket", bucket)
+	params.Set("filename", filename)
+	c.cache.delNeedle(bucket, filename)
+	if err = c.http("POST", fmt.Sprintf(_directoryDelApi, c.c.Directory), params, nil, &res); err != nil {
+		return
+	}
+	if res.Ret != errors.RetOK {
+		log.Errorf("client delete directory bucket: %s filename: %s ret: %d", bucket, filename, res.Ret)
+		err = retError(res.Ret)
+		return
+	}
+	params = url.Values{}
+	params.Set("key", strconv.FormatInt(res.Key, 10))
+	params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
+	for _, host = range res.Stores {
+		if err = c.http("POST", fmt.Sprintf(_storeDelApi, host), params, nil, &sRet); err != nil {
+			return
+		}
+		if sRet.Ret != errors.RetOK {
+			log.Errorf("client delete store: %s key: %d vid: %d ret: %d", host, res.Key, res.Vid, sRet.Ret)
+			err = errors.Ret(sRet.Ret)
+			return
+		}
+	}
+	return
+}
+
+// List list at most limit files of the bucket with the prefix after the
+// marker, the ones containing the delimiter after the prefix are rolled up
+// to the common prefixes.
+func (c *Client) List(bucket, prefix, delimiter, marker string, limit int) (l *meta.List, err error) {
+	var params = url.Values{}
+	params.Set("bucket", bucket)
+	params.Set("prefix", prefix)
+	params.Set("delimiter", delimiter)
+	params.Set("marker", marker)
+	params.Set("limit", strconv.Itoa(limit))
+	l = new(meta.List)
+	if err = c.http("GET", fmt.Sprintf(_directoryListApi, c.c.Directory), params, nil, l); err != nil {
+		return
+	}
+	if l.Ret != errors.RetOK {
+		err = retError(l.Ret)
+	}
+	return
+}
+
+// resolve get the needle and the stores of the file, from the cache if
+// possible, only the stores are resolved if the volume expired.
+func (c *Client) resolve(bucket, filename string) (res *meta.Response, stores []string, local int, cached bool, err error) {
+	var ok bool
+	if res = c.cache.needle(bucket, filename); res != nil {
+		if stores, local, ok = c.cache.volume(res.Vid); !ok {
+			stores, err = c.volume(res.Vid)
+		}
+		if err == nil && len(stores) > 0 {
+			cached = true
+			return
+		}
+	}
+	if res, err = c.stat(bucket, filename); err != nil {
+		return
+	}
+	stores, local = res.Stores, res.Local
+	return
+}
+
+// stat get the needle and the stores of the file from the directory.
+func (c *Client) stat(bucket, filename string) (res *meta.Response, err error) {
+	var params = url.Values{}
+	params.Set("bucket", bucket)
+	params.Set("filename", filename)
+	if c.c.Region != "" {
+		params.Set("region", c.c.Region)
+	}
+	res = new(meta.Response)
+	if err = c.http("GET", fmt.Sprintf(_directoryGetApi, c.c.Directory), params, nil, res); err != nil {
+		return
+	}
+	if res.Ret != errors.RetOK {
+		err = retError(res.Ret)
+		return
+	}
+	c.cache.set(bucket, filename, res)
+	return
+}
+
+// volume get the stores of the volume from the directory.
+func (c *Client) volume(vid int32) (stores []string, err error) {
+	var (
+		res    meta.Responses
+		str    = strconv.FormatInt(int64(vid), 10)
+		params = url.Values{}
+	)
+	params.Set("vid", str)
+	if c.c.Region != "" {
+		params.Set("region", c.c.Region)
+	}
+	if err = c.http("GET", fmt.Sprintf(_directoryGetsApi, c.c.Directory), params, nil, &res); err != nil {
+		return
+	}
+	if res.Ret != errors.RetOK {
+		err = retError(res.Ret)
+		return
+	}
+	stores = res.Volumes[str]
+	// the stores of the caller region are ordered first, but the number is
+	// unknown, read them all as local
+	c.cache.setVolume(vid, stores, 0)
+	return
+}
+
+// read read the needle from the stores in order, the local ones first from
+// a random one.
+func (c *Client) read(res *meta.Response, stores []string, local int) (src io.ReadCloser, ctlen int, err error) {
+	var (
+		store    string
+		uri      string
+		notFound bool
+		resp     *http.Response
+		params   = url.Values{}
+	)
+	params.Set("key", strconv.FormatInt(res.Key, 10))
+	params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
+	params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
+	for _, store = range region.ReadStores(stores, local) {
+		uri = fmt.Sprintf(_storeGetApi, store) + "?" + params.Encode()
+		if resp, err = c.client.Get(uri); err != nil {
+			log.Errorf("client.Get(%s) error(%v)", uri, err)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, int(resp.ContentLength), nil
+		}
+		resp.Body.Close()
+		// the needle may be missing only in the replica
+		if resp.StatusCode == http.StatusNotFound {
+			notFound = true
+		}
+		log.Errorf("client.Get(%s) status: %d", uri, resp.StatusCode)
+	}
+	if notFound {
+		err = errors.ErrNeedleNotExist
+	} else {
+		err = errors.ErrStoreNotAvailable
+	}
+	return
+}
+
+// file get the meta of the file from the directory response.
+func file(res *meta.Response) *meta.File {
+	return &meta.File{MTime: res.MTime, Sha1: res.Sha1, Mine: res.Mine, Name: res.Name, Size: res.Size}
+}
+
+// retError get the error of the directory ret.
+func retError(ret int) error {
+	switch ret {
+	case errors.RetNeedleNotExist:
+		return errors.ErrNeedleNotExist
+	case errors.RetNeedleExist:
+		return errors.ErrNeedleExist
+	case errors.RetBucketQuotaExceeded:
+		return errors.ErrQuotaExceeded
+	}
+	return errors.Ret(ret)
+}
+
+// http do the request, the buf is posted as the "file" part of a multipart
+// form, decode the json response into res.
+func (c *Client) http(method, uri string, params url.Values, buf []byte, res interface{}) (err error) {
+	var bufs [][]byte
+	if buf != nil {
+		bufs = [][]byte{buf}
+	}
+	return c.https(method, uri, params, bufs, res)
+}
+
+// https do the request, the bufs are posted as the "file" parts of a
+// multipart form in order, decode the json response into res.
+func (c *Client) https(method, uri string, params url.Values, bufs [][]byte, res interface{}) (err error) {
+	var (
+		body []byte
+		buf  []byte
+		bw   io.Writer
+		w    *multipart.Writer
+		key  string
+		vals []string
+		val  string
+		req  *http.Request
+		resp *http.Response
+		data = &bytes.Buffer{}
+	)
+	if method == "GET" {
+		req, err = http.NewRequest("GET", uri+"?"+params.Encode(), nil)
+	} else if len(bufs) == 0 {
+		if req, err = http.NewRequest("POST", uri, strings.NewReader(params.Encode())); err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		w = multipart.NewWriter(data)
+		for _, buf = range bufs {
+			if bw, err = w.CreateFormFile("file", "1.jpg"); err != nil {
+				return
+			}
+			if _, err = bw.Write(buf); err != nil {
+				return
+			}
+		}
+		for key, vals = range params {
+			for _, val = range vals {
+				w.WriteField(key, val)
+			}
+		}
+		if err = w.Close(); err != nil {
+			return
+		}
+		if req, err = http.NewRequest("POST", uri, data); err == nil {
+			req.Header.Set("Content-Type", w.FormDataContentType())
+		}
+	}
+	if err != nil {
+		return
+	}
+	if resp, err = c.client.Do(req); err != nil {
+		log.Errorf("client.Do(%s) error(%v)", uri, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("client.Do(%s) status: %d", uri, resp.StatusCode)
+		err = errors.ErrInternal
+		return
+	}
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		log.Errorf("ioutil.ReadAll(%s) error(%v)", uri, err)
+		return
+	}
+	if err = json.Unmarshal(body, res); err != nil {
+		log.Errorf("json.Unmarshal(%s) uri(%s) error(%v)", body, uri, err)
+	}
+	return
+}
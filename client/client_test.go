@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+)
+
+func TestClient(t *testing.T) {
+	var (
+		err   error
+		body  []byte
+		mf    *meta.File
+		gets  int32
+		key   = "1"
+		data  = map[string]string{"1": "hello"}
+		store = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			var (
+				ok bool
+				d  string
+			)
+			if d, ok = data[r.FormValue("key")]; !ok {
+				http.Error(wr, "not found", http.StatusNotFound)
+				return
+			}
+			wr.Write([]byte(d))
+		}))
+		addr = strings.TrimPrefix(store.URL, "http://")
+		dir  = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&gets, 1)
+			if r.FormValue("filename") != "a.txt" {
+				json.NewEncoder(wr).Encode(&meta.Response{Ret: errors.RetNeedleNotExist})
+				return
+			}
+			k, _ := strconv.ParseInt(key, 10, 64)
+			json.NewEncoder(wr).Encode(&meta.Response{Ret: errors.RetOK, Key: k, Vid: 1, Stores: []string{addr}, Mine: "text/plain", Size: 5})
+		}))
+		c = New(&Config{Directory: strings.TrimPrefix(dir.URL, "http://"), Expire: time.Minute})
+	)
+	defer store.Close()
+	defer dir.Close()
+	get := func() string {
+		src, _, f, err := c.Get("b", "a.txt")
+		if err != nil {
+			t.Errorf("Get() error(%v)", err)
+			t.FailNow()
+		}
+		defer src.Close()
+		body, _ = ioutil.ReadAll(src)
+		mf = f
+		return string(body)
+	}
+	if get() != "hello" || mf.Mine != "text/plain" || gets != 1 {
+		t.Errorf("Get() got: %s %v directory gets: %d", body, mf, gets)
+		t.FailNow()
+	}
+	// cached, no directory request
+	if get() != "hello" || gets != 1 {
+		t.Errorf("Get() cached got: %s directory gets: %d", body, gets)
+		t.FailNow()
+	}
+	// the file rewritten to another needle, the cached one is not found
+	key, data = "2", map[string]string{"2": "world"}
+	if get() != "world" || gets != 2 {
+		t.Errorf("Get() rewritten got: %s directory gets: %d", body, gets)
+		t.FailNow()
+	}
+	if _, _, _, err = c.Get("b", "none.txt"); err != errors.ErrNeedleNotExist {
+		t.Errorf("Get() not exist error(%v)", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+)
+
+const (
+	// the mine of the manifest of a chunked file, only the sdk assembles
+	// the chunks, the proxy returns the manifest itself.
+	_manifestMine    = "application/vnd.bfs.manifest+json"
+	_chunkName       = "%s.chunk%d"
+	_defaultChunk    = 8 * 1024 * 1024
+	_maxManifestSize = 1024 * 1024
+)
+
+// manifest the chunks of a file larger than the chunk size.
+type manifest struct {
+	Mine   string   `json:"mine"`
+	Size   int64    `json:"size"`
+	Sha1   string   `json:"sha1"`
+	Chunks []string `json:"chunks"`
+}
+
+// chunkSize get the chunk size, it must be under the store needle max size.
+func (c *Client) chunkSize() int {
+	if c.c.ChunkSize > 0 {
+		return c.c.ChunkSize
+	}
+	return _defaultChunk
+}
+
+// UploadStream upload the file from the reader, only one chunk is buffered,
+// a file larger than the chunk size is uploaded as the chunks and a
+// manifest under the filename.
+func (c *Client) UploadStream(bucket, filename, mine string, mtime int64, r io.Reader) (err error) {
+	var (
+		n      int
+		i      int
+		last   bool
+		name   string
+		data   []byte
+		h      = sha1.New()
+		br     = bufio.NewReader(r)
+		buf    = make([]byte, c.chunkSize())
+		m      = &manifest{Mine: mine}
+		chunks []string
+	)
+	for ; !last; i++ {
+		// the last chunk if no more data
+		if n, err = io.ReadFull(br, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+			last = true
+		} else if err == nil {
+			if _, err = br.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		if err != nil && !last {
+			log.Errorf("UploadStream(%s, %s) read error(%v)", bucket, filename, err)
+			break
+		}
+		err = nil
+		if i == 0 && last {
+			return c.Upload(bucket, filename, mine, mtime, buf[:n])
+		}
+		name = fmt.Sprintf(_chunkName, filename, i)
+		if err = c.Upload(bucket, name, mine, mtime, buf[:n]); err != nil {
+			break
+		}
+		chunks = append(chunks, name)
+		h.Write(buf[:n])
+		m.Size += int64(n)
+	}
+	if err == nil {
+		m.Chunks = chunks
+		m.Sha1 = hex.EncodeToString(h.Sum(nil))
+		if data, err = json.Marshal(m); err == nil {
+			err = c.Upload(bucket, filename, _manifestMine, mtime, data)
+		}
+	}
+	if err != nil {
+		// best effort, the chunks without a manifest are garbage
+		for _, name = range chunks {
+			c.del(bucket, name)
+		}
+	}
+	return
+}
+
+// GetStream write the file to the writer, the chunks of a chunked file are
+// read one by one.
+func (c *Client) GetStream(bucket, filename string, w io.Writer) (mf *meta.File, err error) {
+	var src io.ReadCloser
+	if src, _, mf, err = c.Get(bucket, filename); err != nil {
+		return
+	}
+	defer src.Close()
+	if _, err = io.Copy(w, src); err != nil {
+		log.Errorf("GetStream(%s, %s) error(%v)", bucket, filename, err)
+	}
+	return
+}
+
+// openManifest read the manifest of a chunked file.
+func openManifest(src io.Reader) (m *manifest, err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(io.LimitReader(src, _maxManifestSize)); err != nil {
+		return
+	}
+	m = new(manifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		log.Errorf("json.Unmarshal(%s) error(%v)", data, err)
+		err = errors.ErrInternal
+	}
+	return
+}
+
+// chunkReader read the chunks of a file in order, a chunk is opened only
+// after the previous one is drained.
+type chunkReader struct {
+	c      *Client
+	bucket string
+	chunks []string
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if r.cur, _, _, err = r.c.get(r.bucket, r.chunks[0]); err != nil {
+				return
+			}
+			r.chunks = r.chunks[1:]
+		}
+		if n, err = r.cur.Read(p); err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			err = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return
+	}
+}
+
+func (r *chunkReader) Close() (err error) {
+	if r.cur != nil {
+		err = r.cur.Close()
+		r.cur = nil
+	}
+	r.chunks = nil
+	return
+}
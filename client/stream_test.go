@@ -0,0 +1,163 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+)
+
+// cluster an in memory directory and store.
+type cluster struct {
+	lock  sync.Mutex
+	key   int64
+	files map[string]*meta.Response
+	data  map[string][]byte
+	dir   *httptest.Server
+	store *httptest.Server
+}
+
+func newCluster() (c *cluster) {
+	c = &cluster{files: make(map[string]*meta.Response), data: make(map[string][]byte)}
+	c.store = httptest.NewServer(http.HandlerFunc(c.serveStore))
+	c.dir = httptest.NewServer(http.HandlerFunc(c.serveDirectory))
+	return
+}
+
+func (c *cluster) Close() {
+	c.dir.Close()
+	c.store.Close()
+}
+
+func (c *cluster) serveDirectory(wr http.ResponseWriter, r *http.Request) {
+	var (
+		ok       bool
+		res      *meta.Response
+		filename = r.FormValue("filename")
+	)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if r.URL.Path == "/uploads" {
+		c.uploads(wr, r)
+		return
+	}
+	res, ok = c.files[filename]
+	switch r.URL.Path {
+	case "/upload":
+		if ok {
+			res = &meta.Response{Ret: errors.RetNeedleExist}
+			break
+		}
+		c.key++
+		res = &meta.Response{Ret: errors.RetOK, Key: c.key, Vid: 1, Stores: []string{strings.TrimPrefix(c.store.URL, "http://")}, Mine: r.FormValue("mine")}
+		c.files[filename] = res
+	case "/get", "/del":
+		if !ok {
+			res = &meta.Response{Ret: errors.RetNeedleNotExist}
+		} else if r.URL.Path == "/del" {
+			delete(c.files, filename)
+		}
+	}
+	json.NewEncoder(wr).Encode(res)
+}
+
+// uploads the directory batch upload, the new files share volume 2.
+func (c *cluster) uploads(wr http.ResponseWriter, r *http.Request) {
+	var (
+		ok       bool
+		filename string
+		fres     *meta.Response
+		res      = &meta.Responses{Ret: errors.RetOK}
+	)
+	r.ParseForm()
+	for _, filename = range r.Form["filename"] {
+		if _, ok = c.files[filename]; ok {
+			fres = &meta.Response{Ret: errors.RetNeedleExist}
+		} else {
+			c.key++
+			fres = &meta.Response{Ret: errors.RetOK, Key: c.key, Vid: 2, Stores: []string{strings.TrimPrefix(c.store.URL, "http://")}}
+			c.files[filename] = fres
+		}
+		res.Files = append(res.Files, fres)
+	}
+	json.NewEncoder(wr).Encode(res)
+}
+
+func (c *cluster) serveStore(wr http.ResponseWriter, r *http.Request) {
+	var (
+		ok         bool
+		buf        []byte
+		key        = r.FormValue("key")
+		file, _, _ = r.FormFile("file")
+	)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch r.URL.Path {
+	case "/upload":
+		buf, _ = ioutil.ReadAll(file)
+		c.data[key] = buf
+	case "/uploads":
+		r.ParseMultipartForm(32 << 20)
+		for i, fh := range r.MultipartForm.File["file"] {
+			file, _ = fh.Open()
+			buf, _ = ioutil.ReadAll(file)
+			c.data[r.MultipartForm.Value["keys"][i]] = buf
+		}
+	case "/del":
+		delete(c.data, key)
+	case "/get":
+		if buf, ok = c.data[key]; !ok {
+			http.Error(wr, "not found", http.StatusNotFound)
+			return
+		}
+		wr.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		wr.Write(buf)
+		return
+	}
+	wr.Write([]byte(`{"ret":1}`))
+}
+
+func TestStream(t *testing.T) {
+	var (
+		err  error
+		mf   *meta.File
+		buf  = &bytes.Buffer{}
+		data = []byte("0123456789")
+		cl   = newCluster()
+		c    = New(&Config{Directory: strings.TrimPrefix(cl.dir.URL, "http://"), ChunkSize: 4})
+	)
+	defer cl.Close()
+	if err = c.UploadStream("b", "small", "text/plain", 1, bytes.NewReader(data[:4])); err != nil || len(cl.files) != 1 {
+		t.Errorf("UploadStream() small error(%v) files: %d", err, len(cl.files))
+		t.FailNow()
+	}
+	if err = c.UploadStream("b", "large", "text/plain", 1, bytes.NewReader(data)); err != nil || len(cl.files) != 5 {
+		t.Errorf("UploadStream() large error(%v) files: %d", err, len(cl.files))
+		t.FailNow()
+	}
+	if mf, err = c.GetStream("b", "large", buf); err != nil || buf.String() != string(data) || mf.Mine != "text/plain" || mf.Size != 10 {
+		t.Errorf("GetStream() got: %s %v error(%v)", buf, mf, err)
+		t.FailNow()
+	}
+	if mf, err = c.Stat("b", "large"); err != nil || mf.Size != 10 {
+		t.Errorf("Stat() got: %v error(%v)", mf, err)
+		t.FailNow()
+	}
+	buf.Reset()
+	if _, err = c.GetStream("b", "small", buf); err != nil || buf.String() != "0123" {
+		t.Errorf("GetStream() small got: %s error(%v)", buf, err)
+		t.FailNow()
+	}
+	if err = c.Delete("b", "large"); err != nil || len(cl.files) != 1 || len(cl.data) != 1 {
+		t.Errorf("Delete() error(%v) files: %d data: %d", err, len(cl.files), len(cl.data))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+)
+
+// File a file of the batch upload, Err is the upload result of the file.
+type File struct {
+	Filename string
+	Mine     string
+	MTime    int64
+	Data     []byte
+	Err      error
+}
+
+// Uploads upload the files in one directory request, the new files share
+// one volume and are appended to every store in one request, an existing
+// file is rewritten in its own volume. err is only the directory error, the
+// result of every file is its Err.
+func (c *Client) Uploads(bucket string, fs []*File) (err error) {
+	var (
+		i      int
+		vid    int32
+		sum    [sha1.Size]byte
+		f      *File
+		fres   *meta.Response
+		res    meta.Responses
+		ix     []int
+		vids   = make(map[int32][]int)
+		params = url.Values{}
+	)
+	params.Set("bucket", bucket)
+	for _, f = range fs {
+		sum = sha1.Sum(f.Data)
+		params.Add("filename", f.Filename)
+		params.Add("mine", f.Mine)
+		params.Add("sha1", hex.EncodeToString(sum[:]))
+		params.Add("mtime", strconv.FormatInt(f.MTime, 10))
+		params.Add("size", strconv.Itoa(len(f.Data)))
+	}
+	if err = c.http("POST", fmt.Sprintf(_directoryUploadsApi, c.c.Directory), params, nil, &res); err != nil {
+		return
+	}
+	if res.Ret != errors.RetOK || len(res.Files) != len(fs) {
+		log.Errorf("client uploads directory bucket: %s ret: %d", bucket, res.Ret)
+		if err = retError(res.Ret); err == nil {
+			err = errors.ErrInternal
+		}
+		return
+	}
+	for i, fres = range res.Files {
+		if fres.Ret != errors.RetOK {
+			fs[i].Err = retError(fres.Ret)
+			continue
+		}
+		c.cache.delNeedle(bucket, fs[i].Filename)
+		vids[fres.Vid] = append(vids[fres.Vid], i)
+	}
+	for vid, ix = range vids {
+		if err = c.storeUploads(vid, fs, res.Files, ix); err != nil {
+			for _, i = range ix {
+				fs[i].Err = err
+			}
+		}
+	}
+	return nil
+}
+
+// storeUploads append the files of the indexes to the volume of every store.
+func (c *Client) storeUploads(vid int32, fs []*File, files []*meta.Response, ix []int) (err error) {
+	var (
+		i      int
+		host   string
+		sRet   meta.StoreRet
+		bufs   = make([][]byte, 0, len(ix))
+		params = url.Values{}
+	)
+	params.Set("vid", strconv.FormatInt(int64(vid), 10))
+	for _, i = range ix {
+		params.Add("keys", strconv.FormatInt(files[i].Key, 10))
+		params.Add("cookies", strconv.FormatInt(int64(files[i].Cookie), 10))
+		bufs = append(bufs, fs[i].Data)
+	}
+	for _, host = range files[ix[0]].Stores {
+		if err = c.https("POST", fmt.Sprintf(_storeUploadsApi, host), params, bufs, &sRet); err != nil {
+			return
+		}
+		if sRet.Ret != errors.RetOK {
+			log.Errorf("client uploads store: %s vid: %d ret: %d", host, vid, sRet.Ret)
+			return errors.Ret(sRet.Ret)
+		}
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"bfs/libs/errors"
+)
+
+func TestUploads(t *testing.T) {
+	var (
+		err  error
+		data []byte
+		cl   = newCluster()
+		c    = New(&Config{Directory: strings.TrimPrefix(cl.dir.URL, "http://")})
+		fs   = []*File{
+			{Filename: "a", Mine: "image/jpeg", Data: []byte("aaa")},
+			{Filename: "b", Mine: "image/jpeg", Data: []byte("bbbb")},
+		}
+	)
+	defer cl.Close()
+	if err = c.Uploads("test", fs); err != nil || fs[0].Err != nil || fs[1].Err != nil {
+		t.Errorf("Uploads() error(%v) files: %v %v", err, fs[0].Err, fs[1].Err)
+		t.FailNow()
+	}
+	if cl.files["b"].Vid != 2 || !bytes.Equal(cl.data["2"], []byte("bbbb")) {
+		t.Errorf("Uploads() stored: %v", cl.data)
+		t.FailNow()
+	}
+	if data, err = get(c, "a"); err != nil || string(data) != "aaa" {
+		t.Errorf("Get() got: %s error(%v)", data, err)
+		t.FailNow()
+	}
+	// the existing file is skipped
+	fs = []*File{{Filename: "a", Mine: "image/jpeg", Data: []byte("a")}}
+	if err = c.Uploads("test", fs); err != nil || fs[0].Err != errors.ErrNeedleExist {
+		t.Errorf("Uploads() existing error(%v) file: %v", err, fs[0].Err)
+		t.FailNow()
+	}
+}
+
+func get(c *Client, filename string) (data []byte, err error) {
+	var src io.ReadCloser
+	if src, _, _, err = c.Get("test", filename); err != nil {
+		return
+	}
+	defer src.Close()
+	return ioutil.ReadAll(src)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	_bucketKeyIdSize     = 8  // hex 16
+	_bucketKeySecretSize = 15 // hex 30
+	_bucketMaxKeys       = 8
+)
+
+var (
+	// the bucket is the hbase table bucket_xxx
+	_bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]{0,62}$`)
+	// the methods served by the proxy
+	_corsMethods = map[string]bool{"GET": true, "HEAD": true, "PUT": true, "POST": true, "DELETE": true}
+	// the response headers set by the proxy itself
+	_headerName     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9\-]{0,63}$`)
+	_reservedHeader = map[string]bool{"Content-Length": true, "Content-Type": true, "Etag": true,
+		"Last-Modified": true, "Server": true, "Code": true, "Location": true, "Connection": true,
+		"Transfer-Encoding": true}
+)
+
+// Buckets get all the buckets.
+func (d *Directory) Buckets() (bs []*meta.Bucket, err error) {
+	var names []string
+	if d.config.Zookeeper.BucketRoot == "" {
+		return nil, errors.ErrParam
+	}
+	if names, err = d.zk.Buckets(); err != nil {
+		return nil, errors.ErrZookeeperDataError
+	}
+	return d.loadBuckets(names)
+}
+
+// loadBuckets get the buckets of the names, the deleted ones are skipped.
+func (d *Directory) loadBuckets(names []string) (bs []*meta.Bucket, err error) {
+	var (
+		name string
+		b    *meta.Bucket
+	)
+	sort.Strings(names)
+	for _, name = range names {
+		if b, _, err = d.bucket(name); err != nil {
+			if err == errors.ErrBucketNotFound {
+				// deleted meanwhile
+				err = nil
+				continue
+			}
+			return
+		}
+		bs = append(bs, b)
+	}
+	return
+}
+
+// bucketproc keep the snapshot of the buckets read by the uploads and the
+// deletes, reloaded once a bucket added or deleted, or every PullInterval for
+// the updated ones.
+func (d *Directory) bucketproc() {
+	var (
+		err   error
+		names []string
+		bs    []*meta.Bucket
+		ev    <-chan zk.Event
+	)
+	for {
+		if names, ev, err = d.zk.WatchBuckets(); err != nil {
+			time.Sleep(retrySleep)
+			continue
+		}
+		if bs, err = d.loadBuckets(names); err != nil {
+			// keep the last one
+			time.Sleep(retrySleep)
+			continue
+		}
+		d.setBuckets(bs)
+		select {
+		case <-ev:
+		case <-time.After(d.config.Zookeeper.PullInterval.Duration):
+		}
+	}
+}
+
+// setBuckets replace the snapshot of the buckets.
+func (d *Directory) setBuckets(bs []*meta.Bucket) {
+	var (
+		b  *meta.Bucket
+		mb = make(map[string]*meta.Bucket, len(bs))
+	)
+	for _, b = range bs {
+		mb[b.Name] = b
+	}
+	d.block.Lock()
+	d.buckets.Store(mb)
+	d.block.Unlock()
+}
+
+// setBucket update the bucket in the snapshot, nil deletes it, so the
+// changes by this directory are seen at once.
+func (d *Directory) setBucket(name string, b *meta.Bucket) {
+	var (
+		k   string
+		v   *meta.Bucket
+		old map[string]*meta.Bucket
+		mb  map[string]*meta.Bucket
+	)
+	d.block.Lock()
+	old, _ = d.buckets.Load().(map[string]*meta.Bucket)
+	mb = make(map[string]*meta.Bucket, len(old)+1)
+	for k, v = range old {
+		mb[k] = v
+	}
+	if b != nil {
+		mb[name] = b
+	} else {
+		delete(mb, name)
+	}
+	d.buckets.Store(mb)
+	d.block.Unlock()
+}
+
+// lookupBucket get the bucket from the snapshot, from zookeeper until the
+// snapshot loaded.
+func (d *Directory) lookupBucket(name string) (b *meta.Bucket, err error) {
+	var (
+		ok bool
+		mb map[string]*meta.Bucket
+	)
+	if mb, ok = d.buckets.Load().(map[string]*meta.Bucket); !ok {
+		b, _, err = d.bucket(name)
+		return
+	}
+	if b, ok = mb[name]; !ok {
+		err = errors.ErrBucketNotFound
+	}
+	return
+}
+
+// Bucket get the bucket.
+func (d *Directory) Bucket(name string) (b *meta.Bucket, err error) {
+	if d.config.Zookeeper.BucketRoot == "" {
+		return nil, errors.ErrParam
+	}
+	b, _, err = d.bucket(name)
+	return
+}
+
+// bucket get the bucket and the zk version.
+func (d *Directory) bucket(name string) (b *meta.Bucket, version int32, err error) {
+	var data []byte
+	if data, version, err = d.zk.Bucket(name); err != nil {
+		err = errors.ErrZookeeperDataError
+		return
+	}
+	if data == nil {
+		err = errors.ErrBucketNotFound
+		return
+	}
+	b = new(meta.Bucket)
+	if err = json.Unmarshal(data, b); err != nil {
+		log.Errorf("json.Unmarshal(\"%s\") error(%v)", data, err)
+		err = errors.ErrZookeeperDataError
+	}
+	return
+}
+
+// AddBucket create a bucket with an access key.
+func (d *Directory) AddBucket(b *meta.Bucket) (err error) {
+	var (
+		key  *meta.BucketKey
+		data []byte
+	)
+	if d.config.Zookeeper.BucketRoot == "" || !_bucketName.MatchString(b.Name) ||
+		b.Property < 0 || b.Property > meta.BucketPropertyMax || !meta.ValidOverwrite(b.Overwrite) || b.Trash < 0 {
+		return errors.ErrParam
+	}
+	if key, err = newBucketKey(); err != nil {
+		return
+	}
+	b.Keys = []*meta.BucketKey{key}
+	b.CTime = time.Now().Unix()
+	if data, err = json.Marshal(b); err != nil {
+		return
+	}
+	if err = d.zk.AddBucket(b.Name, data); err != nil {
+		if err == zk.ErrNodeExists {
+			return errors.ErrBucketExist
+		}
+		return errors.ErrZookeeperDataError
+	}
+	d.setBucket(b.Name, b)
+	log.Infof("add bucket: %s property: %d", b.Name, b.Property)
+	return
+}
+
+// DelBucket delete a bucket, the files are not deleted but unreachable.
+func (d *Directory) DelBucket(name string) (err error) {
+	if _, err = d.Bucket(name); err != nil {
+		return
+	}
+	if err = d.zk.DelBucket(name); err != nil {
+		return errors.ErrZookeeperDataError
+	}
+	d.setBucket(name, nil)
+	log.Infof("del bucket: %s", name)
+	return
+}
+
+// AddBucketKey add a new access key to the bucket, for rotating keys.
+func (d *Directory) AddBucketKey(name string) (b *meta.Bucket, err error) {
+	var key *meta.BucketKey
+	if key, err = newBucketKey(); err != nil {
+		return
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		if len(b.Keys) >= _bucketMaxKeys {
+			return errors.ErrParam
+		}
+		b.Keys = append(b.Keys, key)
+		return nil
+	})
+	return
+}
+
+// DelBucketKey delete an access key of the bucket, the last key is kept.
+func (d *Directory) DelBucketKey(name, id string) (b *meta.Bucket, err error) {
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		var (
+			i   int
+			key *meta.BucketKey
+		)
+		for i, key = range b.Keys {
+			if key.Id == id {
+				break
+			}
+		}
+		if key == nil || key.Id != id || len(b.Keys) == 1 {
+			return errors.ErrParam
+		}
+		b.Keys = append(b.Keys[:i], b.Keys[i+1:]...)
+		return nil
+	})
+	return
+}
+
+// SetBucketCORS set the cors rule of the bucket, nil removes it.
+func (d *Directory) SetBucketCORS(name string, cors *meta.BucketCORS) (b *meta.Bucket, err error) {
+	var method string
+	if cors != nil {
+		if len(cors.Origins) == 0 || len(cors.Methods) == 0 || cors.MaxAge < 0 {
+			return nil, errors.ErrParam
+		}
+		for _, method = range cors.Methods {
+			if !_corsMethods[method] {
+				return nil, errors.ErrParam
+			}
+		}
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.CORS = cors
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s cors: %v", name, cors)
+	}
+	return
+}
+
+// SetBucketHeader set the response header policy of the downloads of the
+// bucket, the max-age, the Content-Disposition and the custom headers, which
+// replace the old ones.
+func (d *Directory) SetBucketHeader(name string, cacheControl int64, disposition string, headers map[string]string) (b *meta.Bucket, err error) {
+	var key string
+	if cacheControl < 0 || (disposition != "" && !strings.HasPrefix(disposition, "inline") &&
+		!strings.HasPrefix(disposition, "attachment")) {
+		return nil, errors.ErrParam
+	}
+	for key = range headers {
+		if !_headerName.MatchString(key) || _reservedHeader[http.CanonicalHeaderKey(key)] ||
+			strings.HasPrefix(http.CanonicalHeaderKey(key), "Access-Control-") {
+			return nil, errors.ErrParam
+		}
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.CacheControl = cacheControl
+		b.ContentDisposition = disposition
+		b.Headers = headers
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s cache_control: %d content_disposition: %s headers: %v", name, cacheControl, disposition, headers)
+	}
+	return
+}
+
+// SetBucketOverwrite set the policy of the uploads to an existing filename
+// of the bucket, empty is the default overwrite.
+func (d *Directory) SetBucketOverwrite(name, overwrite string) (b *meta.Bucket, err error) {
+	if !meta.ValidOverwrite(overwrite) {
+		return nil, errors.ErrParam
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.Overwrite = overwrite
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s overwrite: %s", name, overwrite)
+	}
+	return
+}
+
+// SetBucketDedup make the files of the same content uploaded to the bucket
+// share one needle, it can't be disabled as the shared needles are only
+// replaced safely in the dedup buckets.
+func (d *Directory) SetBucketDedup(name string) (b *meta.Bucket, err error) {
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.Dedup = true
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s dedup", name)
+	}
+	return
+}
+
+// SetBucketTrash keep the files deleted from the bucket in the trash for the
+// seconds, they can be undeleted until purged. 0 deletes the files at once,
+// the ones in the trash are kept until expired.
+func (d *Directory) SetBucketTrash(name string, trash int64) (b *meta.Bucket, err error) {
+	if trash < 0 {
+		return nil, errors.ErrParam
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.Trash = trash
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s trash: %d", name, trash)
+	}
+	return
+}
+
+// SetBucketLabels pin the uploads to the bucket to the groups of the stores
+// with all the labels, no labels unpin it. the files already uploaded stay
+// where they are.
+func (d *Directory) SetBucketLabels(name string, labels []string) (b *meta.Bucket, err error) {
+	for _, label := range labels {
+		if label == "" {
+			return nil, errors.ErrParam
+		}
+	}
+	b, err = d.updateBucket(name, func(b *meta.Bucket) error {
+		b.Labels = labels
+		return nil
+	})
+	if err == nil {
+		log.Infof("set bucket: %s labels: %v", name, labels)
+	}
+	return
+}
+
+// updateBucket read, modify and write the bucket by the zk version.
+func (d *Directory) updateBucket(name string, update func(*meta.Bucket) error) (b *meta.Bucket, err error) {
+	var (
+		version int32
+		data    []byte
+	)
+	if d.config.Zookeeper.BucketRoot == "" {
+		return nil, errors.ErrParam
+	}
+	if b, version, err = d.bucket(name); err != nil {
+		return
+	}
+	if err = update(b); err != nil {
+		return
+	}
+	if data, err = json.Marshal(b); err != nil {
+		return
+	}
+	if err = d.zk.SetBucket(name, data, version); err != nil {
+		// zk.ErrBadVersion means updated meanwhile, let the caller retry
+		err = errors.ErrZookeeperDataError
+		return
+	}
+	d.setBucket(name, b)
+	return
+}
+
+// newBucketKey generate a random access key pair.
+func newBucketKey() (key *meta.BucketKey, err error) {
+	var (
+		id     = make([]byte, _bucketKeyIdSize)
+		secret = make([]byte, _bucketKeySecretSize)
+	)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	key = &meta.BucketKey{Id: hex.EncodeToString(id), Secret: hex.EncodeToString(secret)}
+	return
+}
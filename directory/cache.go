@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache a ttl cache of the lookups, the hot reads are served from memory
+// instead of hbase. a nil Cache caches nothing.
+type Cache struct {
+	lock  sync.RWMutex
+	items map[string]*cacheItem
+	ttl   time.Duration
+	max   int
+}
+
+type cacheItem struct {
+	value  interface{}
+	expire time.Time
+}
+
+// NewCache new a cache, nil if ttl is zero.
+func NewCache(ttl time.Duration, max int) (c *Cache) {
+	if ttl <= 0 {
+		return nil
+	}
+	c = &Cache{items: make(map[string]*cacheItem), ttl: ttl, max: max}
+	return
+}
+
+// Get get a unexpired value.
+func (c *Cache) Get(key string) (value interface{}, ok bool) {
+	var item *cacheItem
+	if c == nil {
+		return
+	}
+	c.lock.RLock()
+	item, ok = c.items[key]
+	c.lock.RUnlock()
+	if !ok {
+		return
+	}
+	if time.Now().After(item.expire) {
+		c.Del(key)
+		return nil, false
+	}
+	return item.value, true
+}
+
+// Set set a value, evict some items if the cache is full.
+func (c *Cache) Set(key string, value interface{}) {
+	var (
+		k   string
+		now time.Time
+	)
+	if c == nil {
+		return
+	}
+	now = time.Now()
+	c.lock.Lock()
+	if c.max > 0 && len(c.items) >= c.max {
+		// evict the expired items first, then random ones
+		for k = range c.items {
+			if len(c.items) < c.max && !now.After(c.items[k].expire) {
+				continue
+			}
+			delete(c.items, k)
+			if len(c.items) < c.max/2 {
+				break
+			}
+		}
+	}
+	c.items[key] = &cacheItem{value: value, expire: now.Add(c.ttl)}
+	c.lock.Unlock()
+}
+
+// Del invalidate a value.
+func (c *Cache) Del(key string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	delete(c.items, key)
+	c.lock.Unlock()
+}
+
+// Clear invalidate all the values.
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	c.items = make(map[string]*cacheItem)
+	c.lock.Unlock()
+}
+
+// Len get the number of the cached values.
+func (c *Cache) Len() (n int) {
+	if c == nil {
+		return
+	}
+	c.lock.RLock()
+	n = len(c.items)
+	c.lock.RUnlock()
+	return
+}
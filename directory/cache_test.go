@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var (
+		ok    bool
+		value interface{}
+		c     *Cache
+	)
+	// a nil cache caches nothing
+	if c = NewCache(0, 16); c != nil {
+		t.Errorf("NewCache(0) got: %v, want nil", c)
+		t.FailNow()
+	}
+	c.Set("a", 1)
+	if _, ok = c.Get("a"); ok || c.Len() != 0 {
+		t.Errorf("nil cache got a value")
+		t.FailNow()
+	}
+	c = NewCache(time.Minute, 16)
+	c.Set("a", 1)
+	if value, ok = c.Get("a"); !ok || value.(int) != 1 {
+		t.Errorf("Get(a) value: %v ok: %v", value, ok)
+		t.FailNow()
+	}
+	c.Del("a")
+	if _, ok = c.Get("a"); ok {
+		t.Errorf("Get(a) deleted value got")
+		t.FailNow()
+	}
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if c.Clear(); c.Len() != 0 {
+		t.Errorf("Len() %d after Clear()", c.Len())
+		t.FailNow()
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	var (
+		ok bool
+		c  = NewCache(10*time.Millisecond, 16)
+	)
+	c.Set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok = c.Get("a"); ok {
+		t.Errorf("Get(a) expired value got")
+		t.FailNow()
+	}
+	// deleted when expired
+	if c.Len() != 0 {
+		t.Errorf("Len() %d, want 0", c.Len())
+		t.FailNow()
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	var (
+		ok  bool
+		i   int
+		max = 8
+		c   = NewCache(time.Minute, max)
+	)
+	for i = 0; i < max*2; i++ {
+		c.Set(strconv.Itoa(i), i)
+		if c.Len() > max {
+			t.Errorf("Len() %d, more than max: %d", c.Len(), max)
+			t.FailNow()
+		}
+	}
+	if _, ok = c.Get(strconv.Itoa(max*2 - 1)); !ok {
+		t.Errorf("the last set value evicted")
+		t.FailNow()
+	}
+	// the expired ones evicted first, till half full
+	c = NewCache(10*time.Millisecond, max)
+	for i = 0; i < max; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Set("new", 0)
+	if c.Len() > max/2 {
+		t.Errorf("Len() %d, want at most: %d", c.Len(), max/2)
+		t.FailNow()
+	}
+	if _, ok = c.Get("new"); !ok {
+		t.Errorf("Get(new) not got")
+		t.FailNow()
+	}
+}
@@ -1,21 +1,41 @@
 package conf
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
+	"bfs/libs/trace"
 	"github.com/BurntSushi/toml"
 	"io/ioutil"
+	"math"
 	"os"
 	"time"
 )
 
 type Config struct {
-	Snowflake *Snowflake
-	Zookeeper *Zookeeper
-	HBase     *HBase
+	Snowflake  *Snowflake
+	Zookeeper  *Zookeeper
+	HBase      *HBase
+	Register   *Register
+	Dispatcher *Dispatcher
+	Placement  *Placement
+	Cache      *Cache
+	Quota      *Quota
+	Degraded   *Degraded
+	Trash      *Trash
+	Tiering    *Tiering
 
 	MaxNum      int
 	ApiListen   string
+	SlowLog     duration // log the slower api requests, zero disables
+	RpcListen   string // grpc api, empty disables
+	AdminListen string // bucket api with the access keys, empty disables
 	PprofEnable bool
 	PprofListen string
+
+	// the logging, nil keeps glog
+	Log *log.Config
+	// the tracing, nil exports no spans
+	Tracing *trace.Config
 }
 
 type Snowflake struct {
@@ -32,6 +52,10 @@ type Zookeeper struct {
 	VolumeRoot   string
 	StoreRoot    string
 	GroupRoot    string
+	// buckets, empty disables the bucket api
+	BucketRoot string
+	// the maintenance switch, empty disables the maintenance api
+	MaintenancePath string
 }
 
 type HBase struct {
@@ -42,6 +66,73 @@ type HBase struct {
 	LvsTimeout duration
 }
 
+// Dispatcher choose the group for writes.
+type Dispatcher struct {
+	// weighted-free-space(default), round-robin or least-loaded
+	Policy string
+	// the pitchfork canary volumes, never dispatched for uploads
+	ProbeVolumes []int32
+}
+
+// Placement the failure domain rule of the groups, stores of a group never
+// share a failure domain.
+type Placement struct {
+	// rack(default) or zone
+	Domain string
+}
+
+// Cache the lookup cache, zero ttl disables the cache.
+type Cache struct {
+	FileTTL   duration // bucket/filename -> needle
+	FileMax   int      // max cached files
+	VolumeTTL duration // volume -> stores, also cleared after zk synced
+}
+
+// Degraded the dispatch while zookeeper is unavailable, the last synced
+// snapshot is served until it's too stale. nil serves it forever.
+type Degraded struct {
+	WriteStale duration // uploads & deletes dispatched until, then read only, 0 means read only at once
+	ReadStale  duration // reads dispatched until, 0 means forever
+}
+
+// Quota the write quotas of the buckets, once enabled the usage of every
+// bucket is tracked in hbase.
+type Quota struct {
+	Refresh duration                // reload the usage from hbase interval
+	Buckets map[string]*BucketQuota // bucket:quota
+}
+
+// BucketQuota the quota of a bucket, zero means no limit.
+type BucketQuota struct {
+	Bytes   int64
+	Objects int64
+}
+
+// Trash the purge of the files deleted from the soft delete buckets, nil
+// purges every minute.
+type Trash struct {
+	Interval duration // scan the expired files interval
+	Batch    int      // files scanned once
+}
+
+// Tiering move the needles not accessed for long from the groups of the
+// From labels to the groups of the To labels, nil disables.
+type Tiering struct {
+	From     []string // labels of the groups moved from, e.g ssd
+	To       []string // labels of the groups moved to, e.g hdd
+	Age      duration // the needles not accessed for it are cold
+	Interval duration // scan the cold needles interval
+	Batch    int      // needles of a volume moved once
+}
+
+// Register assigns the self registered stores.
+type Register struct {
+	Racks       []string // racks for the stores which not specified one
+	GroupSize   int      // stores(replicas) of a group
+	Volumes     int      // volumes of a new group
+	FreeVolumes int      // free volumes of a new store data dir
+}
+
 // Code to implement the TextUnmarshaler interface for `duration`:
 type duration struct {
 	time.Duration
@@ -53,6 +144,10 @@ func (d *duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 // NewConfig new a config.
 func NewConfig(conf string) (c *Config, err error) {
 	var (
@@ -69,3 +164,102 @@ func NewConfig(conf string) (c *Config, err error) {
 	err = toml.Unmarshal(blob, c)
 	return
 }
+
+// Check check the config values, return all the problems found.
+func (c *Config) Check() error {
+	var ck = check.New()
+	ck.Addr("ApiListen", c.ApiListen)
+	if c.RpcListen != "" {
+		ck.Addr("RpcListen", c.RpcListen)
+	}
+	if c.AdminListen != "" {
+		ck.Addr("AdminListen", c.AdminListen)
+	}
+	if c.PprofEnable {
+		ck.Addr("PprofListen", c.PprofListen)
+	}
+	ck.Range("MaxNum", int64(c.MaxNum), 1, math.MaxInt16)
+	if c.SlowLog.Duration != 0 {
+		ck.Positive("SlowLog", c.SlowLog.Duration)
+	}
+	if ck.NotNil("Snowflake", c.Snowflake != nil) {
+		ck.Addrs("Snowflake.ZkAddrs", c.Snowflake.ZkAddrs)
+		ck.Positive("Snowflake.ZkTimeout", c.Snowflake.ZkTimeout.Duration)
+		ck.NotEmpty("Snowflake.ZkPath", c.Snowflake.ZkPath)
+	}
+	if ck.NotNil("Zookeeper", c.Zookeeper != nil) {
+		ck.Addrs("Zookeeper.Addrs", c.Zookeeper.Addrs)
+		ck.Positive("Zookeeper.Timeout", c.Zookeeper.Timeout.Duration)
+		ck.Positive("Zookeeper.PullInterval", c.Zookeeper.PullInterval.Duration)
+		ck.NotEmpty("Zookeeper.VolumeRoot", c.Zookeeper.VolumeRoot)
+		ck.NotEmpty("Zookeeper.StoreRoot", c.Zookeeper.StoreRoot)
+		ck.NotEmpty("Zookeeper.GroupRoot", c.Zookeeper.GroupRoot)
+	}
+	if ck.NotNil("HBase", c.HBase != nil) {
+		ck.Addr("HBase.Addr", c.HBase.Addr)
+		ck.Range("HBase.MaxActive", int64(c.HBase.MaxActive), 1, math.MaxInt32)
+		ck.Range("HBase.MaxIdle", int64(c.HBase.MaxIdle), 1, int64(c.HBase.MaxActive))
+		ck.Positive("HBase.Timeout", c.HBase.Timeout.Duration)
+	}
+	if c.Dispatcher != nil {
+		switch c.Dispatcher.Policy {
+		case "", "weighted-free-space", "round-robin", "least-loaded":
+		default:
+			ck.Errorf("Dispatcher.Policy: unknown policy \"%s\"", c.Dispatcher.Policy)
+		}
+	}
+	if c.Cache != nil && c.Cache.FileTTL.Duration > 0 {
+		ck.Range("Cache.FileMax", int64(c.Cache.FileMax), 1, math.MaxInt32)
+	}
+	if c.Placement != nil {
+		switch c.Placement.Domain {
+		case "", "rack", "zone":
+		default:
+			ck.Errorf("Placement.Domain: unknown domain \"%s\"", c.Placement.Domain)
+		}
+	}
+	if c.Degraded != nil && c.Degraded.ReadStale.Duration > 0 &&
+		c.Degraded.ReadStale.Duration < c.Degraded.WriteStale.Duration {
+		ck.Errorf("Degraded.ReadStale: %s must not be less than WriteStale: %s",
+			c.Degraded.ReadStale.Duration, c.Degraded.WriteStale.Duration)
+	}
+	if c.Quota != nil {
+		ck.Positive("Quota.Refresh", c.Quota.Refresh.Duration)
+		for bucket, q := range c.Quota.Buckets {
+			if q == nil || q.Bytes < 0 || q.Objects < 0 {
+				ck.Errorf("Quota.Buckets.%s: quota must not be negative", bucket)
+			}
+		}
+	}
+	if c.Trash != nil {
+		ck.Positive("Trash.Interval", c.Trash.Interval.Duration)
+		ck.Range("Trash.Batch", int64(c.Trash.Batch), 1, math.MaxInt32)
+	}
+	if c.Tiering != nil {
+		if len(c.Tiering.From) == 0 || len(c.Tiering.To) == 0 {
+			ck.Errorf("Tiering.From, Tiering.To: must be set")
+		}
+		ck.Positive("Tiering.Age", c.Tiering.Age.Duration)
+		ck.Positive("Tiering.Interval", c.Tiering.Interval.Duration)
+		ck.Range("Tiering.Batch", int64(c.Tiering.Batch), 1, 100000)
+	}
+	if c.Register != nil {
+		if len(c.Register.Racks) == 0 {
+			ck.Errorf("Register.Racks: must be set")
+		}
+		ck.Range("Register.GroupSize", int64(c.Register.GroupSize), 1, math.MaxInt16)
+		ck.Range("Register.Volumes", int64(c.Register.Volumes), 1, math.MaxInt16)
+		ck.Range("Register.FreeVolumes", int64(c.Register.FreeVolumes), int64(c.Register.Volumes), math.MaxInt16)
+	}
+	if c.Log != nil {
+		if err := c.Log.Check(); err != nil {
+			ck.Errorf("Log: %v", err)
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Check(); err != nil {
+			ck.Errorf("Tracing.%v", err)
+		}
+	}
+	return ck.Err()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// synced mark the snapshot fresh.
+func (d *Directory) synced() {
+	atomic.StoreInt64(&d.syncTime, time.Now().UnixNano())
+	if atomic.SwapInt32(&d.syncFail, 0) == 1 {
+		log.Infof("zookeeper synced, leave degraded mode")
+	}
+}
+
+// syncFailed mark the snapshot stale.
+func (d *Directory) syncFailed() {
+	if atomic.SwapInt32(&d.syncFail, 1) == 0 {
+		log.Warningf("zookeeper sync failed, enter degraded mode, serve the last synced snapshot")
+	}
+}
+
+// Synced check the stores and the volumes are synced from zookeeper once,
+// the snapshot of a degraded directory is still served.
+func (d *Directory) Synced() (err error) {
+	if atomic.LoadInt64(&d.syncTime) == 0 {
+		err = fmt.Errorf("zookeeper not synced yet")
+	}
+	return
+}
+
+// Degraded reports whether the last zookeeper sync failed, and the age of
+// the snapshot.
+func (d *Directory) Degraded() (degraded bool, age time.Duration) {
+	var t = atomic.LoadInt64(&d.syncTime)
+	if t > 0 {
+		age = time.Since(time.Unix(0, t))
+	}
+	degraded = atomic.LoadInt32(&d.syncFail) == 1
+	return
+}
+
+// stale reports whether the snapshot is degraded and older than max, 0 max
+// means any degraded snapshot.
+func (d *Directory) stale(max time.Duration) bool {
+	var (
+		degraded bool
+		age      time.Duration
+	)
+	if degraded, age = d.Degraded(); !degraded {
+		return false
+	}
+	return age >= max
+}
+
+// writable check the cluster is not in maintenance and the snapshot can
+// dispatch writes.
+func (d *Directory) writable() (err error) {
+	if d.Maintenance().Cluster {
+		return errors.ErrMaintenance
+	}
+	if d.config.Degraded != nil && d.stale(d.config.Degraded.WriteStale.Duration) {
+		err = errors.ErrSnapshotStale
+	}
+	return
+}
+
+// readable check the snapshot can dispatch reads.
+func (d *Directory) readable() (err error) {
+	if d.config.Degraded != nil && d.config.Degraded.ReadStale.Duration > 0 &&
+		d.stale(d.config.Degraded.ReadStale.Duration) {
+		err = errors.ErrSnapshotStale
+	}
+	return
+}
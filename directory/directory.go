@@ -6,12 +6,15 @@ import (
 	"bfs/directory/snowflake"
 	myzk "bfs/directory/zk"
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"encoding/json"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	log "github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
@@ -34,12 +37,39 @@ type Directory struct {
 	volume      map[int32]*meta.VolumeState // volume_id:volume_state
 	volumeStore map[int32][]string          // volume_id:store_server_id
 
-	genkey     *snowflake.Genkey  // snowflake client for gen key
+	genkey     keyer              // snowflake client for gen key
 	hBase      *hbase.HBaseClient // hBase client
 	dispatcher *Dispatcher        // dispatch for write or read reqs
 
 	config *conf.Config
 	zk     *myzk.Zookeeper
+
+	rlock     sync.Mutex // serialize store register
+	maxVolume int32      // max volume id, for register alloc
+
+	fileCache   *Cache // bucket/filename:*fileMeta
+	volumeCache *Cache // volume_id:readable stores
+
+	quota *Quota // bucket usage and quota
+
+	syncTime int64 // last zk synced unix nano
+	syncFail int32 // 1: the last zk sync failed, the snapshot is stale
+
+	maintenance atomic.Value // *meta.Maintenance
+
+	block   sync.Mutex   // serialize the updates of the bucket snapshot
+	buckets atomic.Value // name:*meta.Bucket, the snapshot of the buckets
+}
+
+// keyer generate the keys of the needles.
+type keyer interface {
+	Getkey() (int64, error)
+}
+
+// fileMeta the cached hbase lookup.
+type fileMeta struct {
+	n *meta.Needle
+	f *meta.File
 }
 
 // NewDirectory
@@ -56,17 +86,30 @@ func NewDirectory(config *conf.Config) (d *Directory, err error) {
 		return
 	}
 	d.hBase = hbase.NewHBaseClient()
-	d.dispatcher = NewDispatcher()
+	d.dispatcher = NewDispatcher(config)
+	d.quota = NewQuota(config, d.hBase)
+	if config.Cache != nil {
+		d.fileCache = NewCache(config.Cache.FileTTL.Duration, config.Cache.FileMax)
+		d.volumeCache = NewCache(config.Cache.VolumeTTL.Duration, 0)
+	}
 	go d.SyncZookeeper()
+	if config.Zookeeper.BucketRoot != "" {
+		go d.bucketproc()
+		go d.trashproc()
+	}
+	if config.Zookeeper.MaintenancePath != "" {
+		go d.maintenanceproc()
+	}
+	if config.Tiering != nil {
+		go d.tieringproc()
+	}
 	return
 }
 
 // Stores get all the store nodes and set a watcher
-func (d *Directory) syncStores() (ev <-chan zk.Event, err error) {
+func (d *Directory) syncStores() (store map[string]*meta.Store, storeVolume map[string][]int32, ev <-chan zk.Event, err error) {
 	var (
 		storeMeta              *meta.Store
-		store                  map[string]*meta.Store
-		storeVolume            map[string][]int32
 		rack, str, volume      string
 		racks, stores, volumes []string
 		data                   []byte
@@ -108,21 +151,17 @@ func (d *Directory) syncStores() (ev <-chan zk.Event, err error) {
 			store[storeMeta.Id] = storeMeta
 		}
 	}
-	d.store = store
-	d.storeVolume = storeVolume
 	return
 }
 
 // Volumes get all volumes in zk
-func (d *Directory) syncVolumes() (err error) {
+func (d *Directory) syncVolumes() (volume map[int32]*meta.VolumeState, volumeStore map[int32][]string, err error) {
 	var (
 		vid             int
 		str             string
 		volumes, stores []string
 		data            []byte
 		volumeState     *meta.VolumeState
-		volume          map[int32]*meta.VolumeState
-		volumeStore     map[int32][]string
 	)
 	// get all volumes
 	if volumes, err = d.zk.Volumes(); err != nil {
@@ -151,19 +190,15 @@ func (d *Directory) syncVolumes() (err error) {
 		}
 		volumeStore[int32(vid)] = stores
 	}
-	d.volume = volume
-	d.volumeStore = volumeStore
 	return
 }
 
 // syncGroups get all groups and set a watcher.
-func (d *Directory) syncGroups() (err error) {
+func (d *Directory) syncGroups() (group map[int][]string, storeGroup map[string]int, err error) {
 	var (
 		gid            int
 		str            string
 		groups, stores []string
-		group          map[int][]string
-		storeGroup     map[string]int
 	)
 	// get all groups
 	if groups, err = d.zk.Groups(); err != nil {
@@ -185,38 +220,53 @@ func (d *Directory) syncGroups() (err error) {
 			storeGroup[str] = gid
 		}
 	}
-	d.group = group
-	d.storeGroup = storeGroup
 	return
 }
 
 // SyncZookeeper Synchronous zookeeper data to memory
+// the maps are swapped only after all synced, so the last good snapshot is
+// served while zookeeper is unavailable.
 func (d *Directory) SyncZookeeper() {
 	var (
-		sev <-chan zk.Event
-		err error
+		sev         <-chan zk.Event
+		err         error
+		store       map[string]*meta.Store
+		storeVolume map[string][]int32
+		group       map[int][]string
+		storeGroup  map[string]int
+		volume      map[int32]*meta.VolumeState
+		volumeStore map[int32][]string
 	)
 	for {
-		if sev, err = d.syncStores(); err != nil {
+		if store, storeVolume, sev, err = d.syncStores(); err != nil {
 			log.Errorf("syncStores() called error(%v)", err)
+			d.syncFailed()
 			time.Sleep(retrySleep)
 			continue
 		}
-		if err = d.syncGroups(); err != nil {
+		if group, storeGroup, err = d.syncGroups(); err != nil {
 			log.Errorf("syncGroups() called error(%v)", err)
+			d.syncFailed()
 			time.Sleep(retrySleep)
 			continue
 		}
-		if err = d.syncVolumes(); err != nil {
+		if volume, volumeStore, err = d.syncVolumes(); err != nil {
 			log.Errorf("syncVolumes() called error(%v)", err)
+			d.syncFailed()
 			time.Sleep(retrySleep)
 			continue
 		}
-		if err = d.dispatcher.Update(d.group, d.store, d.volume, d.storeVolume); err != nil {
+		if err = d.dispatcher.Update(group, store, volume, storeVolume); err != nil {
 			log.Errorf("Update() called error(%v)", err)
 			time.Sleep(retrySleep)
 			continue
 		}
+		d.store, d.storeVolume = store, storeVolume
+		d.group, d.storeGroup = group, storeGroup
+		d.volume, d.volumeStore = volume, volumeStore
+		d.synced()
+		// stores status or volumes may changed
+		d.volumeCache.Clear()
 		select {
 		case <-sev:
 			log.Infof("stores status change or new store")
@@ -233,42 +283,109 @@ func (d *Directory) cookie() (cookie int32) {
 	return int32(uint16(time.Now().UnixNano())) + 1
 }
 
+// fileKey get the file cache key.
+func fileKey(bucket, filename string) string {
+	return bucket + "/" + filename
+}
+
+// prefixEnd get the least row greater than all the rows with the prefix, nil
+// if no such row.
+func prefixEnd(prefix string) (end []byte) {
+	var i int
+	end = []byte(prefix)
+	for i = len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
 // GetStores get readable stores for http get
-func (d *Directory) GetStores(bucket, filename string) (n *meta.Needle, f *meta.File, stores []string, err error) {
+func (d *Directory) GetStores(bucket, filename string) (n *meta.Needle, f *meta.File, stores []*meta.Store, err error) {
+	var (
+		ok  bool
+		v   interface{}
+		key = fileKey(bucket, filename)
+	)
+	if err = d.readable(); err != nil {
+		return
+	}
+	if v, ok = d.fileCache.Get(key); ok {
+		n, f = v.(*fileMeta).n, v.(*fileMeta).f
+	} else {
+		if n, f, err = d.hBase.Get(bucket, filename); err != nil {
+			log.Errorf("hBase.Get error(%v)", err)
+			if err != errors.ErrNeedleNotExist {
+				err = errors.ErrHBase
+			}
+			return
+		}
+		if n == nil {
+			err = errors.ErrNeedleNotExist
+			return
+		}
+		d.fileCache.Set(key, &fileMeta{n: n, f: f})
+	}
+	stores, err = d.VolumeStores(n.Vid)
+	return
+}
+
+// VolumeStores get readable stores of the volume.
+func (d *Directory) VolumeStores(vid int32) (stores []*meta.Store, err error) {
 	var (
 		store     string
 		svrs      []string
 		storeMeta *meta.Store
 		ok        bool
+		v         interface{}
+		vkey      = strconv.Itoa(int(vid))
 	)
-	if n, f, err = d.hBase.Get(bucket, filename); err != nil {
-		log.Errorf("hBase.Get error(%v)", err)
-		if err != errors.ErrNeedleNotExist {
-			err = errors.ErrHBase
-		}
+	if v, ok = d.volumeCache.Get(vkey); ok {
+		stores = v.([]*meta.Store)
 		return
 	}
-	if n == nil {
-		err = errors.ErrNeedleNotExist
-		return
-	}
-	if svrs, ok = d.volumeStore[n.Vid]; !ok {
+	if svrs, ok = d.volumeStore[vid]; !ok {
 		err = errors.ErrZookeeperDataError
 		return
 	}
-	stores = make([]string, 0, len(svrs))
+	stores = make([]*meta.Store, 0, len(svrs))
 	for _, store = range svrs {
 		if storeMeta, ok = d.store[store]; !ok {
-			log.Errorf("store cannot match store:", store)
+			log.Errorf("store cannot match store: %s", store)
 			continue
 		}
 		if !storeMeta.CanRead() {
 			continue
 		}
-		stores = append(stores, storeMeta.Api)
+		stores = append(stores, storeMeta)
 	}
 	if len(stores) == 0 {
 		err = errors.ErrStoreNotAvailable
+		return
+	}
+	d.volumeCache.Set(vkey, stores)
+	return
+}
+
+// storeApis get the apis of the stores, the stores in the region first,
+// local is the number of them.
+func storeApis(stores []*meta.Store, region string) (apis []string, local int) {
+	var s *meta.Store
+	apis = make([]string, 0, len(stores))
+	if region != "" {
+		for _, s = range stores {
+			if s.Region == region {
+				apis = append(apis, s.Api)
+			}
+		}
+	}
+	local = len(apis)
+	for _, s = range stores {
+		if region == "" || s.Region != region {
+			apis = append(apis, s.Api)
+		}
 	}
 	return
 }
@@ -276,16 +393,49 @@ func (d *Directory) GetStores(bucket, filename string) (n *meta.Needle, f *meta.
 // UploadStores get writable stores for http upload
 func (d *Directory) UploadStores(bucket string, f *meta.File) (n *meta.Needle, stores []string, err error) {
 	var (
+		ns   []*meta.Needle
+		errs []error
+	)
+	if ns, stores, errs, err = d.UploadsStores(bucket, []*meta.File{f}); err != nil {
+		return
+	}
+	n, err = ns[0], errs[0]
+	return
+}
+
+// UploadsStores get writable stores for a batch upload, all the files go to
+// one volume, every file has its own error, e.g. ErrNeedleExist.
+func (d *Directory) UploadsStores(bucket string, fs []*meta.File) (ns []*meta.Needle, stores []string, errs []error, err error) {
+	var (
+		i         int
 		key       int64
+		size      int64
 		vid       int32
 		svrs      []string
 		store     string
 		storeMeta *meta.Store
 		ok        bool
+		f         *meta.File
+		n         *meta.Needle
+		overwrite string
+		dedup     bool
+		labels    []string
 	)
-	if vid, err = d.dispatcher.VolumeId(d.group, d.storeVolume); err != nil {
+	if err = d.writable(); err != nil {
+		return
+	}
+	for _, f = range fs {
+		size += f.Size
+	}
+	if err = d.quota.Check(bucket, size, int64(len(fs))); err != nil {
+		return
+	}
+	overwrite, dedup, labels = d.policy(bucket)
+	if vid, err = d.dispatcher.VolumeId(d.group, d.storeVolume, labels); err != nil {
 		log.Errorf("dispatcher.VolumeId error(%v)", err)
-		err = errors.ErrStoreNotAvailable
+		if err != errors.ErrMaintenance {
+			err = errors.ErrStoreNotAvailable
+		}
 		return
 	}
 	svrs = d.volumeStore[vid]
@@ -297,36 +447,179 @@ func (d *Directory) UploadStores(bucket string, f *meta.File) (n *meta.Needle, s
 		}
 		stores = append(stores, storeMeta.Api)
 	}
-	if key, err = d.genkey.Getkey(); err != nil {
-		log.Errorf("genkey.Getkey() error(%v)", err)
-		err = errors.ErrIdNotAvailable
+	ns = make([]*meta.Needle, len(fs))
+	errs = make([]error, len(fs))
+	for i, f = range fs {
+		if key, err = d.genkey.Getkey(); err != nil {
+			log.Errorf("genkey.Getkey() error(%v)", err)
+			err = errors.ErrIdNotAvailable
+			return
+		}
+		n = new(meta.Needle)
+		n.Key = key
+		n.Vid = vid
+		n.Cookie = d.cookie()
+		n.MTime = f.MTime
+		f.Key = key
+		ns[i] = n
+		errs[i] = d.upload(bucket, overwrite, dedup, f, n)
+		// after written, the lookups meanwhile may cache the old one
+		d.fileCache.Del(fileKey(bucket, f.Filename))
+	}
+	return
+}
+
+// upload put the file of the new needle n, the existing file is handled by
+// the overwrite policy, the usage of the bucket is added.
+func (d *Directory) upload(bucket, overwrite string, dedup bool, f *meta.File, n *meta.Needle) (err error) {
+	if dedup && f.Sha1 != "" {
+		if err = d.link(bucket, f, n); err == errors.ErrFileDedup {
+			d.quota.Add(bucket, f.Size, 1)
+			return
+		}
+	}
+	if err = d.hBase.Put(bucket, f, n); err == nil {
+		if dedup && f.Sha1 != "" {
+			if err1 := d.hBase.Ref(f, n); err1 != nil {
+				// the file is fine, only not shared
+				log.Errorf("hBase.Ref(%s, %d) error(%v)", f.Filename, n.Key, err1)
+			}
+		}
+		d.quota.Add(bucket, f.Size, 1)
+		return
+	}
+	if err == errors.ErrNeedleExist {
+		err = d.exist(bucket, overwrite, dedup, f, n)
+	}
+	if err != nil && err != errors.ErrNeedleExist && err != errors.ErrFileExist && err != errors.ErrFileDedup {
+		log.Errorf("hBase.Put error(%v)", err)
+		err = errors.ErrHBase
+	}
+	return
+}
+
+// policy get the overwrite policy, the dedup and the pinned labels of the
+// bucket, the defaults if the buckets are not managed or the bucket not found.
+func (d *Directory) policy(bucket string) (overwrite string, dedup bool, labels []string) {
+	var (
+		err error
+		b   *meta.Bucket
+	)
+	overwrite = meta.BucketOverwrite
+	if d.config.Zookeeper.BucketRoot == "" {
+		return
+	}
+	if b, err = d.lookupBucket(bucket); err != nil {
+		return
+	}
+	if b.Overwrite != "" {
+		overwrite = b.Overwrite
+	}
+	dedup = b.Dedup
+	labels = b.Labels
+	return
+}
+
+// link put the file to the needle of the same content, ErrFileDedup if
+// linked and n is set to it, the file is uploaded as usual if any other.
+func (d *Directory) link(bucket string, f *meta.File, n *meta.Needle) (err error) {
+	var sn *meta.Needle
+	if sn, err = d.hBase.Dedup(f.Sha1, f.Size); err != nil {
+		if err != errors.ErrNeedleNotExist {
+			log.Errorf("hBase.Dedup(%s, %d) error(%v)", f.Sha1, f.Size, err)
+		}
+		return
+	}
+	if err = d.hBase.Link(bucket, f, sn); err != nil {
 		return
 	}
+	*n = *sn
+	return errors.ErrFileDedup
+}
+
+// exist handle an upload to the existing file by the overwrite policy, the
+// file is rewritten in its own needle if ErrNeedleExist, kept if
+// ErrFileExist, or versioned and put with the new needle if nil. a needle
+// shared by the aliases or the dedup is never rewritten, the file gets the
+// new needle, ErrFileDedup if the same content in a dedup bucket. the usage
+// of the bucket is added by the overwrite.
+func (d *Directory) exist(bucket, overwrite string, dedup bool, f *meta.File, n *meta.Needle) (err error) {
+	var old *meta.File
+	switch overwrite {
+	case meta.BucketReject:
+		err = errors.ErrFileExist
+	case meta.BucketVersion:
+		if err = d.hBase.Version(bucket, f, n); err != nil {
+			return
+		}
+		if dedup && f.Sha1 != "" {
+			if err1 := d.hBase.Ref(f, n); err1 != nil {
+				log.Errorf("hBase.Ref(%s, %d) error(%v)", f.Filename, n.Key, err1)
+			}
+		}
+		// the old one kept as a version
+		d.quota.Add(bucket, f.Size, 1)
+	default:
+		if old, err = d.hBase.Replace(bucket, f, n, dedup); err == nil || err == errors.ErrNeedleExist {
+			// the file replaced, not a new one
+			d.quota.Add(bucket, f.Size-old.Size, 0)
+		}
+	}
+	return
+}
 
-	n = new(meta.Needle)
-	n.Key = key
-	n.Vid = vid
-	n.Cookie = d.cookie()
-	n.MTime = f.MTime
-	f.Key = key
-	if err = d.hBase.Put(bucket, f, n); err != nil {
-		if err != errors.ErrNeedleExist {
-			log.Errorf("hBase.Put error(%v)", err)
+// Alias put the alias of the abucket to the needle of the existing file, no
+// data copied, ErrFileExist if the alias exists.
+func (d *Directory) Alias(bucket, filename, abucket, alias string) (n *meta.Needle, f *meta.File, err error) {
+	if err = d.writable(); err != nil {
+		return
+	}
+	if _, f, err = d.hBase.Get(bucket, filename); err != nil {
+		log.Errorf("hBase.Get error(%v)", err)
+		if err != errors.ErrNeedleNotExist {
 			err = errors.ErrHBase
 		}
+		return
 	}
+	if err = d.quota.Check(abucket, f.Size, 1); err != nil {
+		return
+	}
+	n, f, err = d.hBase.Alias(bucket, filename, abucket, alias)
+	d.fileCache.Del(fileKey(abucket, alias))
+	if err != nil {
+		log.Errorf("hBase.Alias(%s, %s, %s, %s) error(%v)", bucket, filename, abucket, alias, err)
+		switch err {
+		case errors.ErrNeedleExist:
+			err = errors.ErrFileExist
+		case errors.ErrNeedleNotExist:
+		default:
+			err = errors.ErrHBase
+		}
+		return
+	}
+	d.quota.Add(abucket, f.Size, 1)
+	log.Infof("alias bucket: %s filename: %s to bucket: %s filename: %s key: %d", bucket, filename, abucket, alias, n.Key)
 	return
 }
 
-// DelStores get delable stores for http del
+// DelStores get delable stores for http del, no stores if the needle is
+// still shared by other files or the file is kept in the trash of a soft
+// delete bucket.
 func (d *Directory) DelStores(bucket, filename string) (n *meta.Needle, stores []string, err error) {
 	var (
 		ok        bool
+		last      bool
+		trash     int64
 		store     string
 		svrs      []string
 		storeMeta *meta.Store
+		f         *meta.File
+		m         *meta.Maintenance
 	)
-	if n, _, err = d.hBase.Get(bucket, filename); err != nil {
+	if err = d.writable(); err != nil {
+		return
+	}
+	if n, f, err = d.hBase.Get(bucket, filename); err != nil {
 		log.Errorf("hBase.Get error(%v)", err)
 		if err != errors.ErrNeedleNotExist {
 			err = errors.ErrHBase
@@ -337,25 +630,112 @@ func (d *Directory) DelStores(bucket, filename string) (n *meta.Needle, stores [
 		err = errors.ErrNeedleNotExist
 		return
 	}
+	if trash = d.trash(bucket); trash > 0 {
+		// kept in the trash, no stores to delete
+		_, err = d.hBase.Trash(bucket, filename, time.Now().Unix()+trash)
+		d.fileCache.Del(fileKey(bucket, filename))
+		if err != nil {
+			log.Errorf("hBase.Trash error(%v)", err)
+			err = errors.ErrHBase
+			return
+		}
+		d.quota.Add(bucket, -f.Size, -1)
+		return
+	}
 	if svrs, ok = d.volumeStore[n.Vid]; !ok {
 		err = errors.ErrZookeeperDataError
 		return
 	}
 	stores = make([]string, 0, len(svrs))
+	m = d.Maintenance()
 	for _, store = range svrs {
 		if storeMeta, ok = d.store[store]; !ok {
 			err = errors.ErrZookeeperDataError
 			return
 		}
+		if !m.Writable(d.storeGroup[store]) {
+			err = errors.ErrMaintenance
+			return
+		}
 		if !storeMeta.CanWrite() {
 			err = errors.ErrStoreNotAvailable
 			return
 		}
 		stores = append(stores, storeMeta.Api)
 	}
-	if err = d.hBase.Del(bucket, filename); err != nil {
-		log.Errorf("hBase.Del error(%v)", err)
+	_, last, err = d.hBase.Unlink(bucket, filename)
+	d.fileCache.Del(fileKey(bucket, filename))
+	if err != nil {
+		log.Errorf("hBase.Unlink error(%v)", err)
 		err = errors.ErrHBase
+		return
+	}
+	if !last {
+		stores = nil
+	}
+	d.quota.Add(bucket, -f.Size, -1)
+	return
+}
+
+// List list at most limit files of the bucket with the prefix in the
+// filename order after the marker. the filenames containing the delimiter
+// after the prefix are rolled up to one common prefix, marker is set to the
+// last one if there may be more.
+func (d *Directory) List(bucket, prefix, delimiter, marker string, limit int) (l *meta.List, err error) {
+	var (
+		i      int
+		more   bool
+		rolled bool
+		name   string
+		last   string
+		start  []byte
+		stop   = prefixEnd(prefix)
+		fs     []*meta.File
+		f      *meta.File
+	)
+	if err = d.readable(); err != nil {
+		return
+	}
+	l = &meta.List{Files: make([]*meta.File, 0, limit)}
+	if marker < prefix {
+		start = []byte(prefix)
+	} else if delimiter != "" && strings.HasSuffix(marker, delimiter) {
+		// skip the files under the last common prefix
+		start = prefixEnd(marker)
+	} else {
+		start = append([]byte(marker), 0)
+	}
+	for start != nil {
+		if fs, err = d.hBase.Scan(bucket, start, stop, limit); err != nil {
+			log.Errorf("hBase.Scan(%s, %s) error(%v)", bucket, start, err)
+			err = errors.ErrHBase
+			return
+		}
+		more, rolled = len(fs) == limit, false
+		for _, f = range fs {
+			if len(l.Files)+len(l.Prefixes) == limit {
+				l.Marker = last
+				return
+			}
+			name = f.Filename
+			if delimiter != "" {
+				if i = strings.Index(name[len(prefix):], delimiter); i >= 0 {
+					name = name[:len(prefix)+i+len(delimiter)]
+					l.Prefixes = append(l.Prefixes, name)
+					start, last, rolled = prefixEnd(name), name, true
+					break
+				}
+			}
+			l.Files = append(l.Files, f)
+			start, last = append([]byte(name), 0), name
+		}
+		if !more && !rolled {
+			break
+		}
+		if len(l.Files)+len(l.Prefixes) == limit {
+			l.Marker = last
+			break
+		}
 	}
 	return
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bfs/directory/conf"
+	"bfs/libs/errors"
+	"bfs/libs/meta"
 	"testing"
 	"time"
 )
@@ -8,33 +11,217 @@ import (
 func TestDirectory(t *testing.T) {
 	var (
 		err    error
-		config *Config
-		zk     *Zookeeper
+		config *conf.Config
 		d      *Directory
 	)
-	if config, err = NewConfig("./directory.conf"); err != nil {
+	if config, err = conf.NewConfig("./directory.toml"); err != nil {
 		t.Errorf("NewConfig() error(%v)", err)
 		t.FailNow()
 	}
-
-	if zk, err = NewZookeeper([]string{"localhost:2181"}, time.Second*1, "/rack", "/volume", "/group"); err != nil {
-		t.Errorf("NewZookeeper() error(%v)", err)
-		t.FailNow()
-	}
-	if d, err = NewDirectory(config, zk); err != nil {
+	if d, err = NewDirectory(config); err != nil {
 		t.Errorf("NewDirectory() error(%v)", err)
 		t.FailNow()
 	}
-	if _, err = d.syncStores(); err != nil {
+	if _, _, _, err = d.syncStores(); err != nil {
 		t.Errorf("syncStores() error(%v)", err)
 		t.FailNow()
 	}
-	if _, err = d.syncGroups(); err != nil {
+	if _, _, err = d.syncGroups(); err != nil {
 		t.Errorf("syncGroups() error(%v)", err)
 		t.FailNow()
 	}
-	if err = d.syncVolumes(); err != nil {
+	if _, _, err = d.syncVolumes(); err != nil {
 		t.Errorf("syncVolumes() error(%v)", err)
 		t.FailNow()
 	}
 }
+
+func TestDirectoryOverwrite(t *testing.T) {
+	var (
+		err    error
+		d      *Directory
+		h      *fakeHBase
+		n      *meta.Needle
+		f      *meta.File
+		stores []string
+	)
+	for _, dedup := range []bool{false, true} {
+		d, h = newTestDirectory(&meta.Bucket{Name: "test", Dedup: dedup})
+		if _, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "sha1-a", Mine: "image/jpeg", Size: 10}); err != nil {
+			t.Errorf("dedup: %v UploadStores() error(%v)", dedup, err)
+			t.FailNow()
+		}
+		// rewritten in place
+		if _, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "sha1-b", Mine: "image/png", Size: 20}); err != errors.ErrNeedleExist {
+			t.Errorf("dedup: %v UploadStores() overwrite error(%v)", dedup, err)
+			t.FailNow()
+		}
+		if _, f, _, err = d.GetStores("test", "1.jpg"); err != nil {
+			t.Errorf("dedup: %v GetStores() error(%v)", dedup, err)
+			t.FailNow()
+		}
+		if f.Sha1 != "sha1-b" || f.Mine != "image/png" || f.Size != 20 {
+			t.Errorf("dedup: %v file: %+v, want the overwrite", dedup, f)
+			t.FailNow()
+		}
+		if n, stores, err = d.DelStores("test", "1.jpg"); err != nil || len(stores) == 0 {
+			t.Errorf("dedup: %v DelStores() stores: %v error(%v)", dedup, stores, err)
+			t.FailNow()
+		}
+		if _, err = d.hBase.Needle(n.Key); err != errors.ErrNeedleNotExist {
+			t.Errorf("dedup: %v needle: %d not deleted, error(%v)", dedup, n.Key, err)
+			t.FailNow()
+		}
+		if rows := h.rows("bfsmeta", "dedup_"); rows != 0 {
+			t.Errorf("dedup: %v %d dedup rows left", dedup, rows)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDirectoryOverwriteQuota(t *testing.T) {
+	var (
+		err error
+		u   Usage
+		d   *Directory
+	)
+	d, _ = newTestDirectory(&meta.Bucket{Name: "replace"}, &meta.Bucket{Name: "dedup", Dedup: true},
+		&meta.Bucket{Name: "version", Overwrite: meta.BucketVersion})
+	for i, c := range []struct {
+		name    string
+		bucket  string
+		del     bool
+		file    *meta.File
+		err     error
+		bytes   int64
+		objects int64
+	}{
+		{"upload", "replace", false, &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}, nil, 10, 1},
+		{"rewritten in place", "replace", false, &meta.File{Filename: "1.jpg", Sha1: "b", Size: 20}, errors.ErrNeedleExist, 20, 1},
+		{"delete", "replace", true, &meta.File{Filename: "1.jpg"}, nil, 0, 0},
+		{"dedup upload", "dedup", false, &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}, nil, 10, 1},
+		{"dedup link", "dedup", false, &meta.File{Filename: "2.jpg", Sha1: "a", Size: 10}, errors.ErrFileDedup, 20, 2},
+		{"dedup same content", "dedup", false, &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}, errors.ErrFileDedup, 20, 2},
+		{"shared needle replaced", "dedup", false, &meta.File{Filename: "1.jpg", Sha1: "b", Size: 30}, nil, 40, 2},
+		{"dedup delete", "dedup", true, &meta.File{Filename: "1.jpg"}, nil, 10, 1},
+		{"dedup delete last", "dedup", true, &meta.File{Filename: "2.jpg"}, nil, 0, 0},
+		{"version upload", "version", false, &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}, nil, 10, 1},
+		{"versioned", "version", false, &meta.File{Filename: "1.jpg", Sha1: "b", Size: 20}, nil, 30, 2},
+	} {
+		if c.del {
+			_, _, err = d.DelStores(c.bucket, c.file.Filename)
+		} else {
+			_, _, err = d.UploadStores(c.bucket, c.file)
+		}
+		if err != c.err {
+			t.Errorf("%d %s: error(%v), want(%v)", i, c.name, err, c.err)
+			t.FailNow()
+		}
+		if u, err = d.quota.Usage(c.bucket); err != nil {
+			t.Errorf("%d %s: Usage() error(%v)", i, c.name, err)
+			t.FailNow()
+		}
+		if u.Bytes != c.bytes || u.Objects != c.objects {
+			t.Errorf("%d %s: usage bytes: %d objects: %d, want bytes: %d objects: %d", i, c.name, u.Bytes, u.Objects, c.bytes, c.objects)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDirectoryFileCache(t *testing.T) {
+	var (
+		err error
+		d   *Directory
+		f   *meta.File
+	)
+	d, _ = newTestDirectory()
+	d.fileCache = NewCache(time.Minute, 16)
+	for i, c := range []struct {
+		name   string
+		alias  bool
+		del    bool
+		bucket string
+		file   *meta.File
+		err    error
+	}{
+		{"upload", false, false, "test", &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}, nil},
+		{"overwrite", false, false, "test", &meta.File{Filename: "1.jpg", Sha1: "b", Size: 20}, nil},
+		{"alias", true, false, "alias", &meta.File{Filename: "2.jpg", Sha1: "b", Size: 20}, nil},
+		{"delete", false, true, "test", &meta.File{Filename: "1.jpg"}, errors.ErrNeedleNotExist},
+		{"delete alias", false, true, "alias", &meta.File{Filename: "2.jpg"}, errors.ErrNeedleNotExist},
+	} {
+		// cached before written
+		d.GetStores(c.bucket, c.file.Filename)
+		if c.del {
+			_, _, err = d.DelStores(c.bucket, c.file.Filename)
+		} else if c.alias {
+			_, _, err = d.Alias("test", "1.jpg", c.bucket, c.file.Filename)
+		} else {
+			_, _, err = d.UploadStores(c.bucket, c.file)
+		}
+		if err != nil && err != errors.ErrNeedleExist {
+			t.Errorf("%d %s: error(%v)", i, c.name, err)
+			t.FailNow()
+		}
+		if _, f, _, err = d.GetStores(c.bucket, c.file.Filename); err != c.err {
+			t.Errorf("%d %s: GetStores() error(%v), want(%v)", i, c.name, err, c.err)
+			t.FailNow()
+		}
+		if err == nil && (f.Sha1 != c.file.Sha1 || f.Size != c.file.Size) {
+			t.Errorf("%d %s: cached file: %+v, want: %+v", i, c.name, f, c.file)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDirectoryDedup(t *testing.T) {
+	var (
+		err    error
+		d      *Directory
+		h      *fakeHBase
+		n, n1  *meta.Needle
+		stores []string
+	)
+	d, h = newTestDirectory(&meta.Bucket{Name: "test", Dedup: true})
+	if n1, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}); err != nil {
+		t.Errorf("UploadStores() error(%v)", err)
+		t.FailNow()
+	}
+	for i, c := range []struct {
+		name   string
+		del    bool
+		file   *meta.File
+		err    error
+		shared bool // the needle of the first upload
+		stores bool // the needle deleted from the stores
+	}{
+		{"link", false, &meta.File{Filename: "2.jpg", Sha1: "a", Size: 10}, errors.ErrFileDedup, true, false},
+		{"link again", false, &meta.File{Filename: "3.jpg", Sha1: "a", Size: 10}, errors.ErrFileDedup, true, false},
+		{"replace the shared", false, &meta.File{Filename: "1.jpg", Sha1: "b", Size: 20}, nil, false, false},
+		{"unlink", true, &meta.File{Filename: "2.jpg"}, nil, true, false},
+		{"unlink the last", true, &meta.File{Filename: "3.jpg"}, nil, true, true},
+		{"unlink the replaced", true, &meta.File{Filename: "1.jpg"}, nil, false, true},
+	} {
+		if c.del {
+			n, stores, err = d.DelStores("test", c.file.Filename)
+		} else {
+			n, stores, err = d.UploadStores("test", c.file)
+		}
+		if err != c.err {
+			t.Errorf("%d %s: error(%v), want(%v)", i, c.name, err, c.err)
+			t.FailNow()
+		}
+		if (n.Key == n1.Key) != c.shared || (c.del && (len(stores) > 0) != c.stores) {
+			t.Errorf("%d %s: needle: %d stores: %v, want shared: %v deleted: %v", i, c.name, n.Key, stores, c.shared, c.stores)
+			t.FailNow()
+		}
+		if _, err = d.hBase.Needle(n.Key); (err == errors.ErrNeedleNotExist) != c.stores {
+			t.Errorf("%d %s: needle: %d error(%v), want deleted: %v", i, c.name, n.Key, err, c.stores)
+			t.FailNow()
+		}
+	}
+	if rows := h.rows("bfsmeta", "dedup_"); rows != 0 {
+		t.Errorf("%d dedup rows left", rows)
+		t.FailNow()
+	}
+}
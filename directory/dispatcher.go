@@ -1,20 +1,47 @@
 package main
 
 import (
+	"bfs/directory/conf"
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
-	log "github.com/golang/glog"
 	"math/rand"
 	"sync"
 	"time"
 )
 
+const (
+	// dispatch policy
+	PolicyWeightedFreeSpace = "weighted-free-space"
+	PolicyRoundRobin        = "round-robin"
+	PolicyLeastLoaded       = "least-loaded"
+)
+
 // Dispatcher
 // get raw data and processed into memory for http reqs
 type Dispatcher struct {
-	gids  []int // for write eg:  gid:1;2   gids: [1,1,2,2,2,2,2]
+	gids  []int          // for write eg:  gid:1;2   gids: [1,1,2,2,2,2,2]
+	fast  []int          // the gids of the groups without degraded stores
+	slow  []int          // the gids of the groups with degraded stores
+	loads map[int]uint64 // for least-loaded, gid:load
+	next  uint64         // for round-robin
 	rand  *rand.Rand
 	rlock sync.Mutex
+	// policy choose a writable group.
+	policy string
+	// groupSize skip the groups which still waiting stores register, 0
+	// means no limit.
+	groupSize int
+	// domain skip the groups violate the placement rule, empty means no
+	// placement rule.
+	domain string
+	// probes the pitchfork canary volumes, never dispatched.
+	probes map[int32]bool
+	// maintenance the groups in maintenance, never dispatched.
+	maintenance map[int]bool
+	// labels the labels all the stores of the group have, for the pinned
+	// buckets.
+	labels map[int][]string
 }
 
 const (
@@ -25,10 +52,37 @@ const (
 	baseAddDelay      = 100                 // 1s score:   -(1000/baseAddDelay)*addDelayBenchmark == -1000
 )
 
+// groupLoad the write load of a group, the worst store of the group.
+type groupLoad struct {
+	restSpace int    // min free space
+	totalAdd  int    // total write processed, of the min free space store
+	totalDel  int    // total write delay, of the min free space store
+	tps       uint64 // max recent write tps
+	delay     uint64 // max recent write delay(ns) per write
+}
+
 // NewDispatcher
-func NewDispatcher() (d *Dispatcher) {
+func NewDispatcher(c *conf.Config) (d *Dispatcher) {
 	d = new(Dispatcher)
 	d.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	d.policy = PolicyWeightedFreeSpace
+	if c.Dispatcher != nil && c.Dispatcher.Policy != "" {
+		d.policy = c.Dispatcher.Policy
+	}
+	if c.Dispatcher != nil && len(c.Dispatcher.ProbeVolumes) > 0 {
+		d.probes = make(map[int32]bool, len(c.Dispatcher.ProbeVolumes))
+		for _, vid := range c.Dispatcher.ProbeVolumes {
+			d.probes[vid] = true
+		}
+	}
+	if c.Register != nil {
+		d.groupSize = c.Register.GroupSize
+	}
+	if c.Placement != nil {
+		if d.domain = c.Placement.Domain; d.domain == "" {
+			d.domain = domainRack
+		}
+	}
 	return
 }
 
@@ -37,21 +91,31 @@ func (d *Dispatcher) Update(group map[int][]string,
 	store map[string]*meta.Store, volume map[int32]*meta.VolumeState,
 	storeVolume map[string][]int32) (err error) {
 	var (
-		gid                        int
-		i                          int
-		vid                        int32
-		gids                       []int
-		sid                        string
-		stores                     []string
-		restSpace, minScore, score int
-		totalAdd, totalAddDelay    uint64
-		write, ok                  bool
-		storeMeta                  *meta.Store
-		volumeState                *meta.VolumeState
+		gid         int
+		vid         int32
+		gids        []int
+		slows       []int
+		loads       map[int]uint64
+		labels      map[int][]string
+		sid         string
+		stores      []string
+		restSpace   int
+		tps, delay  uint64
+		add, addDel uint64
+		write, ok   bool
+		slow        bool
+		storeMeta   *meta.Store
+		volumeState *meta.VolumeState
+		gl          *groupLoad
 	)
 	gids = []int{}
+	loads = make(map[int]uint64)
+	labels = make(map[int][]string)
 	for gid, stores = range group {
-		write = true
+		if len(stores) < d.groupSize {
+			continue
+		}
+		write, slow = true, false
 		// check all stores can writeable by the group.
 		for _, sid = range stores {
 			if storeMeta, ok = store[sid]; !ok {
@@ -66,13 +130,18 @@ func (d *Dispatcher) Update(group map[int][]string,
 				write = false
 				break
 			}
+			slow = slow || storeMeta.Degraded
 		}
 		if !write {
 			continue
 		}
-		// calc score
+		if fd := conflict(d.domain, stores, store); fd != "" {
+			log.Warningf("group: %d stores share failure domain: %s, skip write", gid, fd)
+			continue
+		}
+		gl = nil
 		for _, sid = range stores {
-			totalAdd, totalAddDelay, restSpace, minScore = 0, 0, 0, 0
+			restSpace, add, addDel, tps, delay = 0, 0, 0, 0, 0
 			// get all volumes by the store.
 			for _, vid = range storeVolume[sid] {
 				volumeState = volume[vid]
@@ -80,23 +149,180 @@ func (d *Dispatcher) Update(group map[int][]string,
 					log.Warningf("volumeState is nil, %d", vid)
 					return
 				}
-				totalAdd = totalAdd + volumeState.TotalWriteProcessed
-				restSpace = restSpace + int(volumeState.FreeSpace)
-				totalAddDelay = totalAddDelay + volumeState.TotalWriteDelay
+				add += volumeState.TotalWriteProcessed
+				addDel += volumeState.TotalWriteDelay
+				restSpace += int(volumeState.FreeSpace)
+				tps += volumeState.WriteTPS
+				delay += volumeState.WriteDelay
+			}
+			if tps > 0 {
+				delay = delay / tps
 			}
-			score = d.calScore(int(totalAdd), int(totalAddDelay), restSpace)
-			if score < minScore || minScore == 0 {
-				minScore = score
+			if gl == nil {
+				gl = &groupLoad{restSpace: restSpace, totalAdd: int(add), totalDel: int(addDel)}
+			} else if restSpace < gl.restSpace {
+				gl.restSpace, gl.totalAdd, gl.totalDel = restSpace, int(add), int(addDel)
+			}
+			if tps > gl.tps {
+				gl.tps = tps
+			}
+			if delay > gl.delay {
+				gl.delay = delay
 			}
 		}
-		for i = 0; i < minScore; i++ {
-			gids = append(gids, gid)
+		if gl == nil || gl.restSpace == 0 {
+			continue
+		}
+		labels[gid] = groupLabels(stores, store)
+		if slow {
+			// the groups with degraded stores only write when no others
+			slows = d.appendGid(slows, loads, gid, gl)
+		} else {
+			gids = d.appendGid(gids, loads, gid, gl)
+		}
+	}
+	d.rlock.Lock()
+	d.fast, d.slow = gids, slows
+	d.loads = loads
+	d.labels = labels
+	d.dispatch()
+	d.rlock.Unlock()
+	return
+}
+
+// groupLabels get the labels all the stores of the group have.
+func groupLabels(stores []string, store map[string]*meta.Store) (labels []string) {
+	for i, sid := range stores {
+		if i == 0 {
+			labels = store[sid].Labels
+			continue
 		}
+		labels = intersect(labels, store[sid].Labels)
 	}
-	d.gids = gids
 	return
 }
 
+// intersect get the labels in both a and b.
+func intersect(a, b []string) (labels []string) {
+	for _, l := range a {
+		if hasLabel(b, l) {
+			labels = append(labels, l)
+		}
+	}
+	return
+}
+
+// hasLabel check the label in labels.
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaintenance skip the groups in maintenance for writes.
+func (d *Dispatcher) SetMaintenance(groups []int) {
+	var m = make(map[int]bool, len(groups))
+	for _, gid := range groups {
+		m[gid] = true
+	}
+	d.rlock.Lock()
+	d.maintenance = m
+	d.dispatch()
+	d.rlock.Unlock()
+}
+
+// dispatch set the groups to write, the ones in maintenance are skipped, the
+// groups with degraded stores only write when no others.
+func (d *Dispatcher) dispatch() {
+	if d.gids = d.skip(d.fast); len(d.gids) == 0 {
+		d.gids = d.skip(d.slow)
+	}
+}
+
+// pin get the groups to write of all the labels, the groups with degraded
+// stores only write when no others.
+func (d *Dispatcher) pin(labels []string) (gids []int) {
+	if gids = d.match(d.skip(d.fast), labels); len(gids) == 0 {
+		gids = d.match(d.skip(d.slow), labels)
+	}
+	return
+}
+
+// match get the groups of all the labels.
+func (d *Dispatcher) match(gids []int, labels []string) (ms []int) {
+	var (
+		gid   int
+		label string
+		ok    bool
+	)
+	for _, gid = range gids {
+		ok = true
+		for _, label = range labels {
+			if !hasLabel(d.labels[gid], label) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			ms = append(ms, gid)
+		}
+	}
+	return
+}
+
+// Labeled check any group of all the labels takes the writes.
+func (d *Dispatcher) Labeled(labels []string) (ok bool) {
+	d.rlock.Lock()
+	ok = len(d.pin(labels)) > 0
+	d.rlock.Unlock()
+	return
+}
+
+// skip skip the groups in maintenance.
+func (d *Dispatcher) skip(gids []int) (ws []int) {
+	if len(d.maintenance) == 0 {
+		return gids
+	}
+	ws = make([]int, 0, len(gids))
+	for _, gid := range gids {
+		if !d.maintenance[gid] {
+			ws = append(ws, gid)
+		}
+	}
+	return
+}
+
+// Writable check any store group takes the writes, the groups in
+// maintenance count, the directory still serves the reads.
+func (d *Dispatcher) Writable() (err error) {
+	d.rlock.Lock()
+	if len(d.fast) == 0 && len(d.slow) == 0 {
+		err = errors.ErrStoreNotAvailable
+	}
+	d.rlock.Unlock()
+	return
+}
+
+// appendGid append the writable group by the policy.
+func (d *Dispatcher) appendGid(gids []int, loads map[int]uint64, gid int, gl *groupLoad) []int {
+	var i int
+	switch d.policy {
+	case PolicyRoundRobin:
+		gids = append(gids, gid)
+	case PolicyLeastLoaded:
+		gids = append(gids, gid)
+		loads[gid] = d.calLoad(gl.tps, gl.delay)
+	default:
+		for i = d.calScore(gl.totalAdd, gl.totalDel, gl.restSpace); i > 0; i-- {
+			gids = append(gids, gid)
+		}
+	}
+	return gids
+}
+
 // cal_score algorithm of calculating score
 func (d *Dispatcher) calScore(totalAdd, totalAddDelay, restSpace int) (score int) {
 	var (
@@ -116,28 +342,75 @@ func (d *Dispatcher) calScore(totalAdd, totalAddDelay, restSpace int) (score int
 	return
 }
 
-// VolumeId get a volume id.
-func (d *Dispatcher) VolumeId(group map[int][]string, storeVolume map[string][]int32) (vid int32, err error) {
+// calLoad algorithm of calculating load, the recent writes weighted by the
+// recent write delay, every addDelayBenchmark ms delay doubles the load.
+func (d *Dispatcher) calLoad(tps, delay uint64) uint64 {
+	return (tps + 1) * (delay/nsToMs/addDelayBenchmark + 1)
+}
+
+// gid choose a group of gids by the policy.
+func (d *Dispatcher) gid(gids []int) (gid int) {
+	var g1, g2 int
+	switch d.policy {
+	case PolicyRoundRobin:
+		gid = gids[d.next%uint64(len(gids))]
+		d.next++
+	case PolicyLeastLoaded:
+		// power of two choices, avoid all writes herd to the least one
+		// between two updates.
+		g1 = gids[d.rand.Intn(len(gids))]
+		g2 = gids[d.rand.Intn(len(gids))]
+		if gid = g1; d.loads[g2] < d.loads[g1] {
+			gid = g2
+		}
+	default:
+		gid = gids[d.rand.Intn(len(gids))]
+	}
+	return
+}
+
+// VolumeId get a volume id, of the groups of all the labels if any.
+func (d *Dispatcher) VolumeId(group map[int][]string, storeVolume map[string][]int32, labels []string) (vid int32, err error) {
 	var (
 		sid    string
 		stores []string
 		gid    int
+		gids   []int
 		vids   []int32
+		vs     []int32
 	)
-	if len(d.gids) == 0 {
-		err = errors.ErrStoreNotAvailable
-		return
-	}
 	d.rlock.Lock()
 	defer d.rlock.Unlock()
-	gid = d.gids[d.rand.Intn(len(d.gids))]
+	if gids = d.gids; len(labels) > 0 {
+		gids = d.pin(labels)
+	}
+	if len(gids) == 0 {
+		if err = errors.ErrStoreNotAvailable; len(d.match(d.fast, labels)) > 0 || len(d.match(d.slow, labels)) > 0 {
+			// all the writable groups (of the labels) in maintenance
+			err = errors.ErrMaintenance
+		}
+		return
+	}
+	gid = d.gid(gids)
 	stores = group[gid]
 	if len(stores) == 0 {
 		err = errors.ErrZookeeperDataError
 		return
 	}
 	sid = stores[0]
-	vids = storeVolume[sid]
+	if vids = storeVolume[sid]; len(d.probes) > 0 {
+		vs = make([]int32, 0, len(vids))
+		for _, vid = range vids {
+			if !d.probes[vid] {
+				vs = append(vs, vid)
+			}
+		}
+		vids = vs
+	}
+	if len(vids) == 0 {
+		err = errors.ErrZookeeperDataError
+		return
+	}
 	vid = vids[d.rand.Intn(len(vids))]
 	return
 }
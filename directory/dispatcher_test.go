@@ -1,35 +1,149 @@
 package main
 
 import (
+	"bfs/directory/conf"
+	"bfs/libs/errors"
+	"bfs/libs/meta"
 	"testing"
-	"time"
-	//	"fmt"
 )
 
 func TestDispatcher(t *testing.T) {
 	var (
-		err    error
-		config *Config
-		zk     *Zookeeper
-		d      *Directory
-		ds     *Dispatcher
+		err         error
+		config      *conf.Config
+		d           *Directory
+		ds          *Dispatcher
+		store       map[string]*meta.Store
+		storeVolume map[string][]int32
+		group       map[int][]string
+		volume      map[int32]*meta.VolumeState
 	)
-	if config, err = NewConfig("./directory.conf"); err != nil {
+	if config, err = conf.NewConfig("./directory.toml"); err != nil {
 		t.Errorf("NewConfig() error(%v)", err)
 		return
 	}
+	if d, err = NewDirectory(config); err != nil {
+		t.Errorf("NewDirectory() error(%v)", err)
+		t.FailNow()
+	}
+	if store, storeVolume, _, err = d.syncStores(); err != nil {
+		t.Errorf("syncStores() error(%v)", err)
+		t.FailNow()
+	}
+	if group, _, err = d.syncGroups(); err != nil {
+		t.Errorf("syncGroups() error(%v)", err)
+		t.FailNow()
+	}
+	if volume, _, err = d.syncVolumes(); err != nil {
+		t.Errorf("syncVolumes() error(%v)", err)
+		t.FailNow()
+	}
+	ds = NewDispatcher(config)
+	if err = ds.Update(group, store, volume, storeVolume); err != nil {
+		t.Errorf("Update() error(%v)", err)
+		t.FailNow()
+	}
+}
 
-	if zk, err = NewZookeeper([]string{"localhost:2181"}, time.Second*1, "/rack", "/volume", "/group"); err != nil {
-		t.Errorf("NewZookeeper() error(%v)", err)
+func TestDispatcherPolicy(t *testing.T) {
+	var (
+		err         error
+		vid         int32
+		ds          *Dispatcher
+		n           map[int32]int
+		group       = map[int][]string{1: []string{"s1"}, 2: []string{"s2"}, 3: []string{"s3"}}
+		storeVolume = map[string][]int32{"s1": []int32{1}, "s2": []int32{2}, "s3": []int32{3}}
+		store       = map[string]*meta.Store{
+			"s1": &meta.Store{Id: "s1", Rack: "rack-a", Status: meta.StoreStatusHealth},
+			"s2": &meta.Store{Id: "s2", Rack: "rack-b", Status: meta.StoreStatusHealth},
+			"s3": &meta.Store{Id: "s3", Rack: "rack-c", Status: meta.StoreStatusRead},
+		}
+	)
+	for _, c := range []struct {
+		policy string
+		volume map[int32]*meta.VolumeState
+		want   func(n map[int32]int) bool
+	}{
+		// every writable group in turn
+		{PolicyRoundRobin, map[int32]*meta.VolumeState{
+			1: &meta.VolumeState{FreeSpace: 1024},
+			2: &meta.VolumeState{FreeSpace: 1024},
+			3: &meta.VolumeState{FreeSpace: 1024},
+		}, func(n map[int32]int) bool { return n[1] == 50 && n[2] == 50 && n[3] == 0 }},
+		// the idle group mostly
+		{PolicyLeastLoaded, map[int32]*meta.VolumeState{
+			1: &meta.VolumeState{FreeSpace: 1024, WriteTPS: 1000, WriteDelay: 1000 * 500 * nsToMs},
+			2: &meta.VolumeState{FreeSpace: 1024},
+			3: &meta.VolumeState{FreeSpace: 1024},
+		}, func(n map[int32]int) bool { return n[2] > n[1] && n[3] == 0 }},
+		// the groups of less than a volume free space never
+		{PolicyWeightedFreeSpace, map[int32]*meta.VolumeState{
+			1: &meta.VolumeState{FreeSpace: 1024},
+			2: &meta.VolumeState{FreeSpace: meta.MaxBlockOffset},
+			3: &meta.VolumeState{FreeSpace: meta.MaxBlockOffset},
+		}, func(n map[int32]int) bool { return n[1] == 0 && n[2] == 100 && n[3] == 0 }},
+	} {
+		ds = NewDispatcher(&conf.Config{Dispatcher: &conf.Dispatcher{Policy: c.policy}})
+		if err = ds.Update(group, store, c.volume, storeVolume); err != nil {
+			t.Errorf("%s: Update() error(%v)", c.policy, err)
+			t.FailNow()
+		}
+		n = make(map[int32]int)
+		for i := 0; i < 100; i++ {
+			if vid, err = ds.VolumeId(group, storeVolume, nil); err != nil {
+				t.Errorf("%s: VolumeId() error(%v)", c.policy, err)
+				t.FailNow()
+			}
+			n[vid]++
+		}
+		if !c.want(n) {
+			t.Errorf("%s: volumes dispatched: %v", c.policy, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDispatcherMaintenance(t *testing.T) {
+	var (
+		err         error
+		vid         int32
+		ds          = NewDispatcher(&conf.Config{Dispatcher: &conf.Dispatcher{Policy: PolicyRoundRobin}})
+		group       = map[int][]string{1: []string{"s1"}, 2: []string{"s2"}}
+		storeVolume = map[string][]int32{"s1": []int32{1}, "s2": []int32{2}}
+		store       = map[string]*meta.Store{
+			"s1": &meta.Store{Id: "s1", Rack: "rack-a", Status: meta.StoreStatusHealth},
+			"s2": &meta.Store{Id: "s2", Rack: "rack-b", Status: meta.StoreStatusHealth},
+		}
+		volume = map[int32]*meta.VolumeState{
+			1: &meta.VolumeState{FreeSpace: 1024},
+			2: &meta.VolumeState{FreeSpace: 1024},
+		}
+	)
+	if err = ds.Update(group, store, volume, storeVolume); err != nil {
+		t.Errorf("Update() error(%v)", err)
 		t.FailNow()
 	}
-	if d, err = NewDirectory(config, zk); err != nil {
-		t.Errorf("NewDirectory() error(%v)", err)
+	ds.SetMaintenance([]int{1})
+	for i := 0; i < 10; i++ {
+		if vid, err = ds.VolumeId(group, storeVolume, nil); err != nil || vid != 2 {
+			t.Errorf("VolumeId() vid: %d error(%v), want the group not in maintenance", vid, err)
+			t.FailNow()
+		}
+	}
+	ds.SetMaintenance([]int{1, 2})
+	if _, err = ds.VolumeId(group, storeVolume, nil); err != errors.ErrMaintenance {
+		t.Errorf("VolumeId() error(%v), want(%v)", err, errors.ErrMaintenance)
 		t.FailNow()
 	}
-	ds = NewDispatcher(d)
-	if err = ds.Update(); err != nil {
+	// no group takes the writes
+	store["s1"].Status, store["s2"].Status = meta.StoreStatusRead, meta.StoreStatusRead
+	ds.SetMaintenance(nil)
+	if err = ds.Update(group, store, volume, storeVolume); err != nil {
 		t.Errorf("Update() error(%v)", err)
 		t.FailNow()
 	}
+	if _, err = ds.VolumeId(group, storeVolume, nil); err != errors.ErrStoreNotAvailable {
+		t.Errorf("VolumeId() error(%v), want(%v)", err, errors.ErrStoreNotAvailable)
+		t.FailNow()
+	}
 }
@@ -0,0 +1,301 @@
+package hbase
+
+import (
+	"bfs/directory/hbase/hbasethrift"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	_dedupPrefix = "dedup_"
+)
+
+var (
+	_columnRefs = []byte("refs")
+)
+
+// Dedup get the needle of the content by the sha1 and the size, hbase.bfsmeta
+// row dedup_sha1_size, the needle rows are sha1 so never conflict.
+func (h *HBaseClient) Dedup(sha1 string, size int64) (n *meta.Needle, err error) {
+	var (
+		c  hbasethrift.THBaseService
+		r  *hbasethrift.TResult_
+		cv *hbasethrift.TColumnValue
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if r, err = c.Get(_table, &hbasethrift.TGet{Row: h.dedupKey(sha1, size)}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	for _, cv = range r.ColumnValues {
+		if cv != nil && bytes.Equal(cv.Family, _familyBasic) && bytes.Equal(cv.Qualifier, _columnKey) && len(cv.Value) == 8 {
+			return h.getNeedle(int64(binary.BigEndian.Uint64(cv.Value)))
+		}
+	}
+	err = errors.ErrNeedleNotExist
+	return
+}
+
+// Link put the file to the existing needle n and add a reference of it,
+// ErrNeedleNotExist if the last reference is removed meanwhile,
+// ErrNeedleExist if the file exists.
+func (h *HBaseClient) Link(bucket string, f *meta.File, n *meta.Needle) (err error) {
+	var (
+		refs int64
+		key  = f.Key
+	)
+	if refs, err = h.incrRefs(n.Key, 1); err != nil {
+		return
+	}
+	if refs <= 1 {
+		h.incrRefs(n.Key, -1)
+		return errors.ErrNeedleNotExist
+	}
+	f.Key = n.Key
+	if err = h.putFile(bucket, f); err != nil {
+		f.Key = key
+		h.incrRefs(n.Key, -1)
+	}
+	return
+}
+
+// Ref add the first reference of the new needle n of the file, and make it
+// the needle of the content if no one is.
+func (h *HBaseClient) Ref(f *meta.File, n *meta.Needle) (err error) {
+	if _, err = h.incrRefs(n.Key, 1); err != nil {
+		return
+	}
+	err = h.putDedup(f.Sha1, f.Size, n.Key)
+	return
+}
+
+// Alias put the file alias of the abucket to the needle of the existing
+// file, the needle is shared like a deduplicated one, ErrNeedleExist if the
+// alias exists.
+func (h *HBaseClient) Alias(bucket, filename, abucket, alias string) (n *meta.Needle, f *meta.File, err error) {
+	if f, err = h.getFile(bucket, filename); err != nil {
+		return
+	}
+	if n, err = h.getNeedle(f.Key); err != nil {
+		return
+	}
+	if err = h.share(f.Key); err != nil {
+		return
+	}
+	f.Filename = alias
+	err = h.Link(abucket, f, n)
+	return
+}
+
+// Replace replace the existing file by the upload f, a needle referenced by
+// other files is never rewritten. ErrFileDedup if the content is the same in
+// a dedup bucket, ErrNeedleExist if the needle is only the file's so
+// rewritten in place, nil if the file is put with the new needle n. n is set
+// to the needle of the file if ErrFileDedup, old is the replaced file.
+func (h *HBaseClient) Replace(bucket string, f *meta.File, n *meta.Needle, dedup bool) (old *meta.File, err error) {
+	var (
+		refs int64
+		on   *meta.Needle
+	)
+	if old, err = h.getFile(bucket, f.Filename); err != nil {
+		return
+	}
+	if dedup && old.Sha1 == f.Sha1 && old.Size == f.Size {
+		if on, err = h.getNeedle(old.Key); err != nil {
+			return
+		}
+		if err = h.Update(bucket, f); err == nil {
+			*n = *on
+			f.Key = on.Key
+			err = errors.ErrFileDedup
+		}
+		return
+	}
+	if refs, err = h.incrRefs(old.Key, -1); err != nil {
+		return
+	}
+	if refs > 0 {
+		// the old needle kept for the others
+		if err = h.delFile(bucket, f.Filename); err != nil {
+			return
+		}
+		if err = h.Put(bucket, f, n); err == nil && dedup {
+			err = h.Ref(f, n)
+		}
+		return
+	}
+	// the needles never shared have no references
+	if _, err = h.incrRefs(old.Key, 1-refs); err != nil {
+		return
+	}
+	// the content changed
+	if old.Sha1 != "" {
+		if err = h.delDedup(old.Sha1, old.Size, old.Key); err != nil {
+			return
+		}
+	}
+	if err = h.Update(bucket, f); err != nil {
+		return
+	}
+	if dedup {
+		err = h.putDedup(f.Sha1, f.Size, old.Key)
+	}
+	if err == nil {
+		err = errors.ErrNeedleExist
+	}
+	return
+}
+
+// Unlink del the file and a reference of its needle, the needle and its
+// dedup row are deleted with the last reference, last reports it. the needles
+// never shared have no references, always the last.
+func (h *HBaseClient) Unlink(bucket, filename string) (f *meta.File, last bool, err error) {
+	var refs int64
+	if f, err = h.getFile(bucket, filename); err != nil {
+		return
+	}
+	if err = h.delFile(bucket, filename); err != nil {
+		return
+	}
+	if refs, err = h.incrRefs(f.Key, -1); err != nil || refs > 0 {
+		return
+	}
+	last = true
+	if err = h.delNeedle(f.Key); err != nil {
+		return
+	}
+	if f.Sha1 != "" {
+		err = h.delDedup(f.Sha1, f.Size, f.Key)
+	}
+	return
+}
+
+// incrRefs add the references of the needle atomically, return the
+// references after added.
+func (h *HBaseClient) incrRefs(key int64, delta int64) (refs int64, err error) {
+	var (
+		c  hbasethrift.THBaseService
+		r  *hbasethrift.TResult_
+		cv *hbasethrift.TColumnValue
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if r, err = c.Increment(_table, &hbasethrift.TIncrement{
+		Row: h.key(key),
+		Columns: []*hbasethrift.TColumnIncrement{
+			&hbasethrift.TColumnIncrement{
+				Family:    _familyBasic,
+				Qualifier: _columnRefs,
+				Amount:    delta,
+			},
+		},
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	for _, cv = range r.ColumnValues {
+		if cv != nil && bytes.Equal(cv.Qualifier, _columnRefs) && len(cv.Value) == 8 {
+			refs = int64(binary.BigEndian.Uint64(cv.Value))
+		}
+	}
+	return
+}
+
+// share set the references of the needle never shared to one, kept if it
+// has any.
+func (h *HBaseClient) share(key int64) (err error) {
+	var (
+		ks   = h.key(key)
+		rbuf = make([]byte, 8)
+		c    hbasethrift.THBaseService
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	binary.BigEndian.PutUint64(rbuf, 1)
+	// put only if absent
+	if _, err = c.CheckAndPut(_table, ks, _familyBasic, _columnRefs, nil, &hbasethrift.TPut{
+		Row: ks,
+		ColumnValues: []*hbasethrift.TColumnValue{
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnRefs,
+				Value:     rbuf,
+			},
+		},
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// putDedup make the needle the one of the content, kept if one exists.
+func (h *HBaseClient) putDedup(sha1 string, size int64, key int64) (err error) {
+	var (
+		ks   = h.dedupKey(sha1, size)
+		kbuf = make([]byte, 8)
+		c    hbasethrift.THBaseService
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	binary.BigEndian.PutUint64(kbuf, uint64(key))
+	// put only if absent
+	if _, err = c.CheckAndPut(_table, ks, _familyBasic, _columnKey, nil, &hbasethrift.TPut{
+		Row: ks,
+		ColumnValues: []*hbasethrift.TColumnValue{
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnKey,
+				Value:     kbuf,
+			},
+		},
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// delDedup del the dedup row of the content if it's still the needle's.
+func (h *HBaseClient) delDedup(sha1 string, size int64, key int64) (err error) {
+	var (
+		ks   = h.dedupKey(sha1, size)
+		kbuf = make([]byte, 8)
+		c    hbasethrift.THBaseService
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	binary.BigEndian.PutUint64(kbuf, uint64(key))
+	if _, err = c.CheckAndDelete(_table, ks, _familyBasic, _columnKey, kbuf, &hbasethrift.TDelete{
+		Row: ks,
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// dedupKey the dedup row of the content.
+func (h *HBaseClient) dedupKey(sha1 string, size int64) []byte {
+	return []byte(fmt.Sprintf("%s%s_%d", _dedupPrefix, sha1, size))
+}
@@ -3,13 +3,13 @@ package hbase
 import (
 	"bfs/directory/hbase/hbasethrift"
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"bytes"
 	"crypto/sha1"
 	"encoding/binary"
+	"fmt"
 	"time"
-
-	log "github.com/golang/glog"
 )
 
 const (
@@ -29,6 +29,8 @@ var (
 	_columnSha1   = []byte("sha1")
 	_columnMine   = []byte("mine")
 	_columnStatus = []byte("status")
+	_columnSize   = []byte("size")
+	_columnName   = []byte("name")
 	// _columnUpdateTime = []byte("update_time")
 )
 
@@ -64,6 +66,38 @@ func (h *HBaseClient) Put(bucket string, f *meta.File, n *meta.Needle) (err erro
 	return
 }
 
+// Update update the sha1, the size, the mine, the mtime and the name of an
+// existing file, whose needle is rewritten in place.
+func (h *HBaseClient) Update(bucket string, f *meta.File) (err error) {
+	var c hbasethrift.THBaseService
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	err = h.updateFile(c, bucket, f)
+	hbasePool.Put(c, err != nil)
+	return
+}
+
+// Version keep the existing file as filename@key, its needle untouched, and
+// put the file with the new needle. not atomic, a failure between keeps the
+// old file in the version only.
+func (h *HBaseClient) Version(bucket string, f *meta.File, n *meta.Needle) (err error) {
+	var old *meta.File
+	if old, err = h.getFile(bucket, f.Filename); err != nil {
+		return
+	}
+	old.Filename = fmt.Sprintf("%s@%d", f.Filename, old.Key)
+	if err = h.putFile(bucket, old); err != nil && err != errors.ErrNeedleExist {
+		return
+	}
+	if err = h.delFile(bucket, f.Filename); err != nil {
+		return
+	}
+	err = h.Put(bucket, f, n)
+	return
+}
+
 // Del del file and needle from hbase
 func (h *HBaseClient) Del(bucket, filename string) (err error) {
 	var (
@@ -79,11 +113,48 @@ func (h *HBaseClient) Del(bucket, filename string) (err error) {
 	return
 }
 
+// Needle get the needle by the key.
+func (h *HBaseClient) Needle(key int64) (n *meta.Needle, err error) {
+	return h.getNeedle(key)
+}
+
+// Move set the volume of the needle copied to the vid, only if it's still in
+// the volume of n, moved reports it.
+func (h *HBaseClient) Move(n *meta.Needle, vid int32) (moved bool, err error) {
+	var (
+		ks   = h.key(n.Key)
+		obuf = make([]byte, 4)
+		vbuf = make([]byte, 4)
+		c    hbasethrift.THBaseService
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	binary.BigEndian.PutUint32(obuf, uint32(n.Vid))
+	binary.BigEndian.PutUint32(vbuf, uint32(vid))
+	if moved, err = c.CheckAndPut(_table, ks, _familyBasic, _columnVid, obuf, &hbasethrift.TPut{
+		Row: ks,
+		ColumnValues: []*hbasethrift.TColumnValue{
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnVid,
+				Value:     vbuf,
+			},
+		},
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
 // getNeedle get meta data from hbase.bfsmeta
 func (h *HBaseClient) getNeedle(key int64) (n *meta.Needle, err error) {
 	var (
 		ks []byte
-		c  *hbasethrift.THBaseServiceClient
+		c  hbasethrift.THBaseService
 		r  *hbasethrift.TResult_
 		cv *hbasethrift.TColumnValue
 	)
@@ -128,7 +199,7 @@ func (h *HBaseClient) putNeedle(n *meta.Needle) (err error) {
 		cbuf  = make([]byte, 4)
 		ubuf  = make([]byte, 8)
 		exist bool
-		c     *hbasethrift.THBaseServiceClient
+		c     hbasethrift.THBaseService
 	)
 	if c, err = hbasePool.Get(); err != nil {
 		log.Errorf("hbasePool.Get() error(%v)", err)
@@ -177,7 +248,7 @@ func (h *HBaseClient) putNeedle(n *meta.Needle) (err error) {
 func (h *HBaseClient) delNeedle(key int64) (err error) {
 	var (
 		ks []byte
-		c  *hbasethrift.THBaseServiceClient
+		c  hbasethrift.THBaseService
 	)
 	if c, err = hbasePool.Get(); err != nil {
 		log.Errorf("hbasePool.Get() error(%v)", err)
@@ -198,9 +269,8 @@ func (h *HBaseClient) delNeedle(key int64) (err error) {
 func (h *HBaseClient) getFile(bucket, filename string) (f *meta.File, err error) {
 	var (
 		ks []byte
-		c  *hbasethrift.THBaseServiceClient
+		c  hbasethrift.THBaseService
 		r  *hbasethrift.TResult_
-		cv *hbasethrift.TColumnValue
 	)
 	if c, err = hbasePool.Get(); err != nil {
 		log.Errorf("hbasePool.Get() error(%v)", err)
@@ -218,7 +288,14 @@ func (h *HBaseClient) getFile(bucket, filename string) (f *meta.File, err error)
 	}
 	f = new(meta.File)
 	f.Filename = filename
-	for _, cv = range r.ColumnValues {
+	parseFile(f, r.ColumnValues)
+	return
+}
+
+// parseFile set the file by the column values of the row.
+func parseFile(f *meta.File, cvs []*hbasethrift.TColumnValue) {
+	var cv *hbasethrift.TColumnValue
+	for _, cv = range cvs {
 		if cv == nil {
 			continue
 		}
@@ -233,9 +310,46 @@ func (h *HBaseClient) getFile(bucket, filename string) (f *meta.File, err error)
 				f.Status = int32(binary.BigEndian.Uint32(cv.Value))
 			} else if bytes.Equal(cv.Qualifier, _columnUpdateTime) {
 				f.MTime = int64(binary.BigEndian.Uint64(cv.Value))
+			} else if bytes.Equal(cv.Qualifier, _columnSize) {
+				f.Size = int64(binary.BigEndian.Uint64(cv.Value))
+			} else if bytes.Equal(cv.Qualifier, _columnName) {
+				f.Name = string(cv.GetValue())
 			}
 		}
 	}
+}
+
+// Scan get at most limit files of the bucket in the filename order from the
+// start row, until the stop row if not empty.
+func (h *HBaseClient) Scan(bucket string, start, stop []byte, limit int) (fs []*meta.File, err error) {
+	var (
+		c  hbasethrift.THBaseService
+		rs []*hbasethrift.TResult_
+		r  *hbasethrift.TResult_
+		f  *meta.File
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if rs, err = c.GetScannerResults(h.tableName(bucket), &hbasethrift.TScan{
+		StartRow: start,
+		StopRow:  stop,
+		Columns:  []*hbasethrift.TColumn{&hbasethrift.TColumn{Family: _familyFile}},
+	}, int32(limit)); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	fs = make([]*meta.File, 0, len(rs))
+	for _, r = range rs {
+		if r == nil || len(r.ColumnValues) == 0 {
+			continue
+		}
+		f = &meta.File{Filename: string(r.Row)}
+		parseFile(f, r.ColumnValues)
+		fs = append(fs, f)
+	}
 	return
 }
 
@@ -246,8 +360,10 @@ func (h *HBaseClient) putFile(bucket string, f *meta.File) (err error) {
 		kbuf  = make([]byte, 8)
 		stbuf = make([]byte, 4)
 		ubuf  = make([]byte, 8)
+		sbuf  = make([]byte, 8)
 		exist bool
-		c     *hbasethrift.THBaseServiceClient
+		cvs   []*hbasethrift.TColumnValue
+		c     hbasethrift.THBaseService
 	)
 	if c, err = hbasePool.Get(); err != nil {
 		log.Errorf("hbasePool.Get() error(%v)", err)
@@ -259,42 +375,55 @@ func (h *HBaseClient) putFile(bucket string, f *meta.File) (err error) {
 		return
 	}
 	if exist {
-		err = h.updateFile(c, bucket, f.Filename, f.Sha1)
-		hbasePool.Put(c, err != nil)
+		hbasePool.Put(c, false)
 		return errors.ErrNeedleExist
 	}
 	binary.BigEndian.PutUint64(kbuf, uint64(f.Key))
 	binary.BigEndian.PutUint32(stbuf, uint32(f.Status))
 	binary.BigEndian.PutUint64(ubuf, uint64(f.MTime))
-	if err = c.Put(h.tableName(bucket), &hbasethrift.TPut{
-		Row: ks,
-		ColumnValues: []*hbasethrift.TColumnValue{
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnKey,
-				Value:     kbuf,
-			},
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnSha1,
-				Value:     []byte(f.Sha1),
-			},
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnMine,
-				Value:     []byte(f.Mine),
-			},
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnStatus,
-				Value:     stbuf,
-			},
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnUpdateTime,
-				Value:     ubuf,
-			},
+	binary.BigEndian.PutUint64(sbuf, uint64(f.Size))
+	cvs = []*hbasethrift.TColumnValue{
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnKey,
+			Value:     kbuf,
 		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnSha1,
+			Value:     []byte(f.Sha1),
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnMine,
+			Value:     []byte(f.Mine),
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnStatus,
+			Value:     stbuf,
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnUpdateTime,
+			Value:     ubuf,
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnSize,
+			Value:     sbuf,
+		},
+	}
+	if f.Name != "" {
+		cvs = append(cvs, &hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnName,
+			Value:     []byte(f.Name),
+		})
+	}
+	if err = c.Put(h.tableName(bucket), &hbasethrift.TPut{
+		Row:          ks,
+		ColumnValues: cvs,
 	}); err != nil {
 		hbasePool.Put(c, true)
 		return
@@ -304,27 +433,48 @@ func (h *HBaseClient) putFile(bucket string, f *meta.File) (err error) {
 }
 
 // updateFile overwriting is bug,  banned
-func (h *HBaseClient) updateFile(c *hbasethrift.THBaseServiceClient, bucket, filename, sha1 string) (err error) {
+func (h *HBaseClient) updateFile(c hbasethrift.THBaseService, bucket string, f *meta.File) (err error) {
 	var (
 		ks   []byte
 		ubuf = make([]byte, 8)
+		sbuf = make([]byte, 8)
+		cvs  []*hbasethrift.TColumnValue
 	)
-	ks = []byte(filename)
+	ks = []byte(f.Filename)
 	binary.BigEndian.PutUint64(ubuf, uint64(time.Now().UnixNano()))
-	err = c.Put(h.tableName(bucket), &hbasethrift.TPut{
-		Row: ks,
-		ColumnValues: []*hbasethrift.TColumnValue{
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnSha1,
-				Value:     []byte(sha1),
-			},
-			&hbasethrift.TColumnValue{
-				Family:    _familyFile,
-				Qualifier: _columnUpdateTime,
-				Value:     ubuf,
-			},
+	binary.BigEndian.PutUint64(sbuf, uint64(f.Size))
+	cvs = []*hbasethrift.TColumnValue{
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnSha1,
+			Value:     []byte(f.Sha1),
 		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnMine,
+			Value:     []byte(f.Mine),
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnUpdateTime,
+			Value:     ubuf,
+		},
+		&hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnSize,
+			Value:     sbuf,
+		},
+	}
+	if f.Name != "" {
+		cvs = append(cvs, &hbasethrift.TColumnValue{
+			Family:    _familyFile,
+			Qualifier: _columnName,
+			Value:     []byte(f.Name),
+		})
+	}
+	err = c.Put(h.tableName(bucket), &hbasethrift.TPut{
+		Row:          ks,
+		ColumnValues: cvs,
 	})
 	return
 }
@@ -333,7 +483,7 @@ func (h *HBaseClient) updateFile(c *hbasethrift.THBaseServiceClient, bucket, fil
 func (h *HBaseClient) delFile(bucket, filename string) (err error) {
 	var (
 		ks []byte
-		c  *hbasethrift.THBaseServiceClient
+		c  hbasethrift.THBaseService
 	)
 	if c, err = hbasePool.Get(); err != nil {
 		log.Errorf("hbasePool.Get() error(%v)", err)
@@ -3,33 +3,31 @@ package hbase
 import (
 	"bfs/directory/conf"
 	"bfs/directory/hbase/hbasethrift"
+	"bfs/libs/log"
 	"git.apache.org/thrift.git/lib/go/thrift"
-	log "github.com/golang/glog"
 )
 
 var (
 	hbasePool *Pool
-	config    *conf.Config
 )
 
 func Init(config *conf.Config) error {
-	config = config
 	// init hbase thrift pool
-	hbasePool = New(func() (c *hbasethrift.THBaseServiceClient, err error) {
+	hbasePool = New(func() (c hbasethrift.THBaseService, err error) {
 		var trans thrift.TTransport
 		if trans, err = thrift.NewTSocketTimeout(config.HBase.Addr, config.HBase.Timeout.Duration); err != nil {
-			log.Error("thrift.NewTSocketTimeout error(%v)", err)
+			log.Errorf("thrift.NewTSocketTimeout error(%v)", err)
 			return
 		}
 		trans = thrift.NewTFramedTransport(trans)
 		c = hbasethrift.NewTHBaseServiceClientFactory(trans, thrift.NewTBinaryProtocolFactoryDefault())
 		if err = trans.Open(); err != nil {
-			log.Error("trans.Open error(%v)", err)
+			log.Errorf("trans.Open error(%v)", err)
 		}
 		return
-	}, func(c *hbasethrift.THBaseServiceClient) error {
-		if c != nil && c.Transport != nil {
-			c.Transport.Close()
+	}, func(c hbasethrift.THBaseService) error {
+		if tc, ok := c.(*hbasethrift.THBaseServiceClient); ok && tc.Transport != nil {
+			tc.Transport.Close()
 		}
 		return nil
 	}, config.HBase.MaxIdle)
@@ -38,5 +36,15 @@ func Init(config *conf.Config) error {
 	return nil
 }
 
+// InitService init the pool of the service instead of the thrift clients,
+// e.g. an in-memory hbase for testing.
+func InitService(s hbasethrift.THBaseService) {
+	hbasePool = New(func() (hbasethrift.THBaseService, error) {
+		return s, nil
+	}, func(hbasethrift.THBaseService) error {
+		return nil
+	}, 1)
+}
+
 func Close() {
 }
@@ -88,17 +88,17 @@ var ErrPoolClosed = errors.New("pool: get on closed pool")
 type Pool struct {
 
 	// Dial is an application supplied function for creating new connections.
-	Dial func() (*hbasethrift.THBaseServiceClient, error)
+	Dial func() (hbasethrift.THBaseService, error)
 
 	// Close is an application supplied functoin for closeing connections.
-	Close func(c *hbasethrift.THBaseServiceClient) error
+	Close func(c hbasethrift.THBaseService) error
 
 	// TestOnBorrow is an optional application supplied function for checking
 	// the health of an idle connection before the connection is used again by
 	// the application. Argument t is the time that the connection was returned
 	// to the pool. If the function returns an error, then the connection is
 	// closed.
-	TestOnBorrow func(c *hbasethrift.THBaseServiceClient, t time.Time) error
+	TestOnBorrow func(c hbasethrift.THBaseService, t time.Time) error
 
 	// Maximum number of idle connections in the pool.
 	MaxIdle int
@@ -122,20 +122,20 @@ type Pool struct {
 }
 
 type idleConn struct {
-	c *hbasethrift.THBaseServiceClient
+	c hbasethrift.THBaseService
 	t time.Time
 }
 
 // New creates a new pool. This function is deprecated. Applications should
 // initialize the Pool fields directly as shown in example.
-func New(dialFn func() (*hbasethrift.THBaseServiceClient, error), closeFn func(c *hbasethrift.THBaseServiceClient) error, maxIdle int) *Pool {
+func New(dialFn func() (hbasethrift.THBaseService, error), closeFn func(c hbasethrift.THBaseService) error, maxIdle int) *Pool {
 	return &Pool{Dial: dialFn, Close: closeFn, MaxIdle: maxIdle}
 }
 
 // Get gets a connection. The application must close the returned connection.
 // This method always returns a valid connection so that applications can defer
 // error handling to the first use of the connection.
-func (p *Pool) Get() (*hbasethrift.THBaseServiceClient, error) {
+func (p *Pool) Get() (hbasethrift.THBaseService, error) {
 	p.mu.Lock()
 	// if closed
 	if p.closed {
@@ -198,7 +198,7 @@ func (p *Pool) Get() (*hbasethrift.THBaseServiceClient, error) {
 }
 
 // Put adds conn back to the pool, use forceClose to close the connection forcely
-func (p *Pool) Put(c *hbasethrift.THBaseServiceClient, forceClose bool) error {
+func (p *Pool) Put(c hbasethrift.THBaseService, forceClose bool) error {
 	if !forceClose {
 		p.mu.Lock()
 		if !p.closed {
@@ -0,0 +1,315 @@
+package hbase
+
+import (
+	"bfs/directory/hbase/hbasethrift"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	_trashPrefix = "trash_"
+)
+
+var (
+	_columnBucket = []byte("bucket")
+	_columnFile   = []byte("file")
+	_columnExpire = []byte("expire")
+)
+
+// TrashPrefix the prefix of the trash rows of the bucket, of all the buckets
+// if empty.
+func TrashPrefix(bucket string) string {
+	if bucket == "" {
+		return _trashPrefix
+	}
+	return _trashPrefix + bucket + "/"
+}
+
+// TrashRow the row of the trashed file, hbase.bfsmeta row
+// trash_bucket/filename@key, the bucket names have no "/".
+func TrashRow(bucket, filename string, key int64) []byte {
+	return []byte(fmt.Sprintf("%s%s@%d", TrashPrefix(bucket), filename, key))
+}
+
+// Trash move the file to the trash until expire, the reference of its needle
+// is kept by the trash, the file is deleted for ever by Purge. a row of the
+// same needle in the trash, e.g. the file uploaded again to the dedup needle
+// and deleted again, keeps only one reference and is renewed.
+func (h *HBaseClient) Trash(bucket, filename string, expire int64) (t *meta.TrashFile, err error) {
+	var (
+		added bool
+		f     *meta.File
+	)
+	if f, err = h.getFile(bucket, filename); err != nil {
+		return
+	}
+	t = &meta.TrashFile{File: f, Bucket: bucket, Expire: expire}
+	if added, err = h.addTrash(t); err != nil {
+		return
+	}
+	if err = h.delFile(bucket, filename); err != nil {
+		if !added {
+			return
+		}
+		if err1 := h.delTrash(t); err1 != nil {
+			log.Errorf("delTrash(%s, %s) error(%v)", bucket, filename, err1)
+		}
+		return
+	}
+	if !added {
+		if _, err = h.incrRefs(f.Key, -1); err != nil {
+			return
+		}
+		err = h.putTrash(t)
+	}
+	return
+}
+
+// GetTrash get the trashed file of the needle key.
+func (h *HBaseClient) GetTrash(bucket, filename string, key int64) (t *meta.TrashFile, err error) {
+	var (
+		c hbasethrift.THBaseService
+		r *hbasethrift.TResult_
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if r, err = c.Get(_table, &hbasethrift.TGet{Row: TrashRow(bucket, filename, key)}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	if t = parseTrash(r.ColumnValues); t == nil {
+		err = errors.ErrNeedleNotExist
+	}
+	return
+}
+
+// TrashScan get at most limit trashed files in the row order from the start
+// row until the stop row.
+func (h *HBaseClient) TrashScan(start, stop []byte, limit int) (ts []*meta.TrashFile, err error) {
+	var (
+		c  hbasethrift.THBaseService
+		rs []*hbasethrift.TResult_
+		r  *hbasethrift.TResult_
+		t  *meta.TrashFile
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if rs, err = c.GetScannerResults(_table, &hbasethrift.TScan{
+		StartRow: start,
+		StopRow:  stop,
+		Columns:  []*hbasethrift.TColumn{&hbasethrift.TColumn{Family: _familyBasic}},
+	}, int32(limit)); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	ts = make([]*meta.TrashFile, 0, len(rs))
+	for _, r = range rs {
+		if r == nil {
+			continue
+		}
+		if t = parseTrash(r.ColumnValues); t != nil {
+			ts = append(ts, t)
+		}
+	}
+	return
+}
+
+// Undelete put the trashed file back to its bucket, ErrNeedleExist if a file
+// of the filename is uploaded after deleted, the file is kept in the trash,
+// ErrNeedleNotExist if it's purged or undeleted meanwhile.
+func (h *HBaseClient) Undelete(t *meta.TrashFile) (err error) {
+	if err = h.claimTrash(t); err != nil {
+		return
+	}
+	if err = h.putFile(t.Bucket, t.File); err != nil {
+		if err1 := h.putTrash(t); err1 != nil {
+			log.Errorf("putTrash(%s, %s) error(%v)", t.Bucket, t.Filename, err1)
+		}
+	}
+	return
+}
+
+// Purge del the trashed file for ever and the reference of its needle, the
+// needle and its dedup row are deleted with the last reference, n is the
+// deleted needle then. ErrNeedleNotExist if it's purged or undeleted
+// meanwhile.
+func (h *HBaseClient) Purge(t *meta.TrashFile) (n *meta.Needle, err error) {
+	var refs int64
+	if err = h.claimTrash(t); err != nil {
+		return
+	}
+	if refs, err = h.incrRefs(t.Key, -1); err != nil || refs > 0 {
+		return
+	}
+	if n, err = h.getNeedle(t.Key); err != nil {
+		return
+	}
+	if err = h.delNeedle(t.Key); err != nil {
+		return
+	}
+	if t.Sha1 != "" {
+		err = h.delDedup(t.Sha1, t.Size, t.Key)
+	}
+	return
+}
+
+// parseTrash get the trashed file by the column values of the row, nil if
+// not a trash row.
+func parseTrash(cvs []*hbasethrift.TColumnValue) (t *meta.TrashFile) {
+	var (
+		cv   *hbasethrift.TColumnValue
+		file []byte
+	)
+	t = &meta.TrashFile{}
+	for _, cv = range cvs {
+		if cv == nil || !bytes.Equal(cv.Family, _familyBasic) {
+			continue
+		}
+		if bytes.Equal(cv.Qualifier, _columnBucket) {
+			t.Bucket = string(cv.GetValue())
+		} else if bytes.Equal(cv.Qualifier, _columnFile) {
+			file = cv.GetValue()
+		} else if bytes.Equal(cv.Qualifier, _columnExpire) && len(cv.Value) == 8 {
+			t.Expire = int64(binary.BigEndian.Uint64(cv.Value))
+		}
+	}
+	if file == nil || t.Expire == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(file, &t.File); err != nil {
+		log.Errorf("json.Unmarshal(%s) error(%v)", file, err)
+		return nil
+	}
+	return
+}
+
+// trashPut the put of the trash row of the file.
+func trashPut(t *meta.TrashFile) (p *hbasethrift.TPut, err error) {
+	var (
+		file []byte
+		ebuf = make([]byte, 8)
+	)
+	if file, err = json.Marshal(t.File); err != nil {
+		return
+	}
+	binary.BigEndian.PutUint64(ebuf, uint64(t.Expire))
+	p = &hbasethrift.TPut{
+		Row: TrashRow(t.Bucket, t.Filename, t.Key),
+		ColumnValues: []*hbasethrift.TColumnValue{
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnBucket,
+				Value:     []byte(t.Bucket),
+			},
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnFile,
+				Value:     file,
+			},
+			&hbasethrift.TColumnValue{
+				Family:    _familyBasic,
+				Qualifier: _columnExpire,
+				Value:     ebuf,
+			},
+		},
+	}
+	return
+}
+
+// putTrash put the trash row of the file.
+func (h *HBaseClient) putTrash(t *meta.TrashFile) (err error) {
+	var (
+		p *hbasethrift.TPut
+		c hbasethrift.THBaseService
+	)
+	if p, err = trashPut(t); err != nil {
+		return
+	}
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if err = c.Put(_table, p); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// addTrash put the trash row of the file only if absent, added reports it.
+func (h *HBaseClient) addTrash(t *meta.TrashFile) (added bool, err error) {
+	var (
+		p *hbasethrift.TPut
+		c hbasethrift.THBaseService
+	)
+	if p, err = trashPut(t); err != nil {
+		return
+	}
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if added, err = c.CheckAndPut(_table, p.Row, _familyBasic, _columnExpire, nil, p); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// delTrash del the trash row of the file.
+func (h *HBaseClient) delTrash(t *meta.TrashFile) (err error) {
+	var c hbasethrift.THBaseService
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if err = c.DeleteSingle(_table, &hbasethrift.TDelete{
+		Row: TrashRow(t.Bucket, t.Filename, t.Key),
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	return
+}
+
+// claimTrash del the trash row if it's still there, only one of the
+// directories undeleting or purging the file at the same time wins,
+// ErrNeedleNotExist for the others.
+func (h *HBaseClient) claimTrash(t *meta.TrashFile) (err error) {
+	var (
+		ok   bool
+		row  = TrashRow(t.Bucket, t.Filename, t.Key)
+		ebuf = make([]byte, 8)
+		c    hbasethrift.THBaseService
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	binary.BigEndian.PutUint64(ebuf, uint64(t.Expire))
+	if ok, err = c.CheckAndDelete(_table, row, _familyBasic, _columnExpire, ebuf, &hbasethrift.TDelete{
+		Row: row,
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	if !ok {
+		err = errors.ErrNeedleNotExist
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package hbase
+
+import (
+	"bfs/directory/hbase/hbasethrift"
+	"bfs/libs/log"
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	_usagePrefix = "usage_"
+)
+
+var (
+	_columnBytes   = []byte("bytes")
+	_columnObjects = []byte("objects")
+)
+
+// Usage get the used bytes and objects of the bucket, hbase.bfsmeta row
+// usage_xxx, the needle rows are sha1 so never conflict.
+func (h *HBaseClient) Usage(bucket string) (size, count int64, err error) {
+	var (
+		c hbasethrift.THBaseService
+		r *hbasethrift.TResult_
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if r, err = c.Get(_table, &hbasethrift.TGet{Row: h.usageKey(bucket)}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	size, count = h.usage(r)
+	return
+}
+
+// IncrUsage add the used bytes and objects of the bucket atomically, return
+// the usage after added.
+func (h *HBaseClient) IncrUsage(bucket string, size, count int64) (nsize, ncount int64, err error) {
+	var (
+		c hbasethrift.THBaseService
+		r *hbasethrift.TResult_
+	)
+	if c, err = hbasePool.Get(); err != nil {
+		log.Errorf("hbasePool.Get() error(%v)", err)
+		return
+	}
+	if r, err = c.Increment(_table, &hbasethrift.TIncrement{
+		Row: h.usageKey(bucket),
+		Columns: []*hbasethrift.TColumnIncrement{
+			&hbasethrift.TColumnIncrement{
+				Family:    _familyBasic,
+				Qualifier: _columnBytes,
+				Amount:    size,
+			},
+			&hbasethrift.TColumnIncrement{
+				Family:    _familyBasic,
+				Qualifier: _columnObjects,
+				Amount:    count,
+			},
+		},
+	}); err != nil {
+		hbasePool.Put(c, true)
+		return
+	}
+	hbasePool.Put(c, false)
+	nsize, ncount = h.usage(r)
+	return
+}
+
+// usage parse the usage row.
+func (h *HBaseClient) usage(r *hbasethrift.TResult_) (size, count int64) {
+	var cv *hbasethrift.TColumnValue
+	for _, cv = range r.ColumnValues {
+		if cv == nil || !bytes.Equal(cv.Family, _familyBasic) || len(cv.Value) != 8 {
+			continue
+		}
+		if bytes.Equal(cv.Qualifier, _columnBytes) {
+			size = int64(binary.BigEndian.Uint64(cv.Value))
+		} else if bytes.Equal(cv.Qualifier, _columnObjects) {
+			count = int64(binary.BigEndian.Uint64(cv.Value))
+		}
+	}
+	return
+}
+
+// usageKey the usage row of the bucket.
+func (h *HBaseClient) usageKey(bucket string) []byte {
+	return []byte(_usagePrefix + bucket)
+}
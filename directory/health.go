@@ -0,0 +1,15 @@
+package main
+
+import (
+	"bfs/libs/health"
+)
+
+// newHealth the readiness of the directory: the stores and the volumes
+// synced from zookeeper, zookeeper connected, and any store group writable.
+func newHealth(d *Directory) (h *health.Health) {
+	h = health.New()
+	h.Add("recovery", d.Synced)
+	h.Add("zookeeper", d.zk.Ping)
+	h.Add("stores", d.dispatcher.Writable)
+	return
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
+	"bfs/libs/reqid"
 	"encoding/json"
-	log "github.com/golang/glog"
 	"net/http"
 	"time"
 )
 
+// errorResponse fill the error info of the ret, the status is always 200,
+// the callers check the ret.
+func errorResponse(res *meta.Response) {
+	var info *errors.Info
+	if res.Ret == errors.RetOK {
+		return
+	}
+	info = errors.Error(res.Ret).Info()
+	res.Component, res.Msg, res.Retryable = info.Component, info.Msg, info.Retryable
+}
+
 // HttpGetWriter
 func HttpGetWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res *meta.Response) {
 	var (
@@ -15,6 +28,7 @@ func HttpGetWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res
 		byteJson []byte
 		ret      = res.Ret
 	)
+	errorResponse(res)
 	if byteJson, err = json.Marshal(res); err != nil {
 		log.Errorf("json.Marshal(\"%v\") failed (%v)", res, err)
 		return
@@ -24,8 +38,8 @@ func HttpGetWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res
 		log.Errorf("HttpWriter Write error(%v)", err)
 		return
 	}
-	log.Infof("%s path:%s(params:%s,time:%f,ret:%v)", r.Method,
-		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret)
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v,req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, reqid.FromContext(r.Context()))
 }
 
 // HttpUploadWriter
@@ -35,6 +49,7 @@ func HttpUploadWriter(r *http.Request, wr http.ResponseWriter, start time.Time,
 		byteJson []byte
 		ret      = res.Ret
 	)
+	errorResponse(res)
 	if byteJson, err = json.Marshal(res); err != nil {
 		log.Errorf("json.Marshal(\"%v\") failed (%v)", res, err)
 		return
@@ -44,8 +59,8 @@ func HttpUploadWriter(r *http.Request, wr http.ResponseWriter, start time.Time,
 		log.Errorf("HttpWriter Write error(%v)", err)
 		return
 	}
-	log.Infof("%s path:%s(params:%s,time:%f,ret:%v)", r.Method,
-		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret)
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v,req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, reqid.FromContext(r.Context()))
 }
 
 // HttpDelWriter
@@ -55,6 +70,46 @@ func HttpDelWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res
 		byteJson []byte
 		ret      = res.Ret
 	)
+	errorResponse(res)
+	if byteJson, err = json.Marshal(res); err != nil {
+		log.Errorf("json.Marshal(\"%v\") failed (%v)", res, err)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	if _, err = wr.Write(byteJson); err != nil {
+		log.Errorf("HttpWriter Write error(%v)", err)
+		return
+	}
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v,req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, reqid.FromContext(r.Context()))
+}
+
+// HttpRegisterWriter
+func HttpRegisterWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res **meta.Register) {
+	var (
+		err      error
+		byteJson []byte
+		ret      = (*res).Ret
+	)
+	if byteJson, err = json.Marshal(*res); err != nil {
+		log.Errorf("json.Marshal(\"%v\") failed (%v)", *res, err)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	if _, err = wr.Write(byteJson); err != nil {
+		log.Errorf("HttpWriter Write error(%v)", err)
+		return
+	}
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v,req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, reqid.FromContext(r.Context()))
+}
+
+// HttpJsonWriter write the json response, ret is the response ret for log.
+func HttpJsonWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res interface{}, ret *int) {
+	var (
+		err      error
+		byteJson []byte
+	)
 	if byteJson, err = json.Marshal(res); err != nil {
 		log.Errorf("json.Marshal(\"%v\") failed (%v)", res, err)
 		return
@@ -64,6 +119,6 @@ func HttpDelWriter(r *http.Request, wr http.ResponseWriter, start time.Time, res
 		log.Errorf("HttpWriter Write error(%v)", err)
 		return
 	}
-	log.Infof("%s path:%s(params:%s,time:%f,ret:%v)", r.Method,
-		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret)
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v,req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), *ret, reqid.FromContext(r.Context()))
 }
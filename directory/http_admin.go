@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/reqid"
+	"bfs/libs/trace"
+	"net/http"
+)
+
+// StartAdminApi start admin api http listen, the bucket management and the
+// access keys of the buckets, it must only be reachable by the operators and
+// the proxies.
+func StartAdminApi(addr string, d *Directory) {
+	var s = &server{d: d}
+	go func() {
+		var (
+			err      error
+			serveMux = http.NewServeMux()
+		)
+		serveMux.HandleFunc("/buckets", s.buckets)
+		serveMux.HandleFunc("/bucket", s.bucket)
+		serveMux.HandleFunc("/bucket/del", s.delBucket)
+		serveMux.HandleFunc("/bucket/keys", s.bucketKeys)
+		serveMux.HandleFunc("/bucket/key", s.addBucketKey)
+		serveMux.HandleFunc("/bucket/key/del", s.delBucketKey)
+		serveMux.HandleFunc("/bucket/cors", s.bucketCORS)
+		serveMux.HandleFunc("/bucket/header", s.bucketHeader)
+		serveMux.HandleFunc("/bucket/overwrite", s.bucketOverwrite)
+		serveMux.HandleFunc("/bucket/dedup", s.bucketDedup)
+		serveMux.HandleFunc("/bucket/trash", s.bucketTrash)
+		serveMux.HandleFunc("/bucket/labels", s.bucketLabels)
+		if err = http.ListenAndServe(addr, trace.Handler(reqid.Handler(serveMux))); err != nil {
+			log.Errorf("http.ListenAndServe(\"%s\") error(%v)", addr, err)
+			return
+		}
+	}()
+	return
+}
@@ -2,37 +2,60 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
+	"bfs/libs/reqid"
+	"bfs/libs/slow"
+	"bfs/libs/trace"
 	"encoding/json"
+	"go.opentelemetry.io/otel/attribute"
 	"net/http"
 	"time"
 
 	"strconv"
-
-	log "github.com/golang/glog"
+	"strings"
 )
 
 const (
 	_pingOk = 0
+	// the default and max files once list
+	_listLimit = 1000
 )
 
 type server struct {
 	d *Directory
+	// the slow requests, nil logs nothing
+	slow *slow.Log
 }
 
 // StartApi start api http listen.
 func StartApi(addr string, d *Directory) {
-	var s = &server{d: d}
+	var s = &server{d: d, slow: slow.New(d.config.SlowLog.Duration)}
 	go func() {
 		var (
 			err      error
 			serveMux = http.NewServeMux()
 		)
 		serveMux.HandleFunc("/get", s.get)
+		serveMux.HandleFunc("/gets", s.gets)
 		serveMux.HandleFunc("/upload", s.upload)
+		serveMux.HandleFunc("/uploads", s.uploads)
 		serveMux.HandleFunc("/del", s.del)
+		serveMux.HandleFunc("/alias", s.alias)
+		serveMux.HandleFunc("/undelete", s.undelete)
+		serveMux.HandleFunc("/trash", s.trash)
+		serveMux.HandleFunc("/list", s.list)
 		serveMux.HandleFunc("/ping", s.ping)
-		if err = http.ListenAndServe(addr, serveMux); err != nil {
+		serveMux.HandleFunc("/register", s.register)
+		serveMux.HandleFunc("/rebalance", s.rebalance)
+		serveMux.HandleFunc("/quota", s.quota)
+		serveMux.HandleFunc("/stats", s.stats)
+		serveMux.HandleFunc("/topology", s.topology)
+		serveMux.HandleFunc("/maintenance", s.maintenance)
+		serveMux.HandleFunc("/buckets", s.buckets)
+		serveMux.HandleFunc("/log/level", log.Handler)
+		newHealth(d).Register(serveMux)
+		if err = http.ListenAndServe(addr, trace.Handler(reqid.Handler(serveMux))); err != nil {
 			log.Errorf("http.ListenAndServe(\"%s\") error(%v)", addr, err)
 			return
 		}
@@ -42,14 +65,10 @@ func StartApi(addr string, d *Directory) {
 
 func (s *server) get(wr http.ResponseWriter, r *http.Request) {
 	var (
-		ok       bool
 		bucket   string
 		filename string
 		res      meta.Response
-		n        *meta.Needle
-		f        *meta.File
-		uerr     errors.Error
-		err      error
+		tr       = s.slow.Start()
 	)
 	if r.Method != "GET" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
@@ -63,17 +82,45 @@ func (s *server) get(wr http.ResponseWriter, r *http.Request) {
 		http.Error(wr, "bad request", http.StatusBadRequest)
 		return
 	}
+	defer tr.End(r)
 	defer HttpGetWriter(r, wr, time.Now(), &res)
-	if n, f, res.Stores, err = s.d.GetStores(bucket, filename); err != nil {
+	getFile(s.d, bucket, filename, r.FormValue("region"), &res)
+	tr.Phase("lookup")
+	traceFile(r, bucket, filename, &res)
+	return
+}
+
+// getFile get readable stores of the file, the stores in the region first.
+func getFile(d *Directory, bucket, filename, region string, res *meta.Response) {
+	var (
+		n      *meta.Needle
+		f      *meta.File
+		stores []*meta.Store
+		err    error
+	)
+	if n, f, stores, err = d.GetStores(bucket, filename); err != nil {
 		log.Errorf("GetStores() error(%v)", err)
-		if uerr, ok = err.(errors.Error); ok {
-			res.Ret = int(uerr)
-		} else {
-			res.Ret = errors.RetInternalErr
-		}
+		res.Ret = retCode(err)
 		return
 	}
+	res.Stores, res.Local = storeApis(stores, region)
 	res.Ret = errors.RetOK
+	fileResponse(res, n, f)
+}
+
+// traceFile set the file and its volume to the span of the request.
+func traceFile(r *http.Request, bucket, filename string, res *meta.Response) {
+	trace.Set(r.Context(), attribute.String("bfs.bucket", bucket), attribute.String("bfs.file", filename),
+		attribute.Int64("bfs.vid", int64(res.Vid)))
+}
+
+// retCode get the ret of the error.
+func retCode(err error) int {
+	return int(errors.From(err))
+}
+
+// fileResponse fill the response by the needle and file.
+func fileResponse(res *meta.Response, n *meta.Needle, f *meta.File) {
 	res.Key = n.Key
 	res.Cookie = n.Cookie
 	res.Vid = n.Vid
@@ -84,19 +131,88 @@ func (s *server) get(wr http.ResponseWriter, r *http.Request) {
 		res.MTime = n.MTime
 	}
 	res.Sha1 = f.Sha1
+	res.Name = f.Name
+	res.Size = f.Size
+}
+
+// gets resolve the files of a bucket and the volumes in one request.
+func (s *server) gets(wr http.ResponseWriter, r *http.Request) {
+	var (
+		i         int
+		id        int64
+		vid       int32
+		bucket    string
+		filename  string
+		region    string
+		str       string
+		stores    []*meta.Store
+		filenames []string
+		strs      []string
+		vids      []int32
+		fres      *meta.Response
+		err       error
+		res       = new(meta.Responses)
+		tr        = s.slow.Start()
+	)
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	filenames = r.Form["filename"]
+	region = r.FormValue("region")
+	strs = r.Form["vid"]
+	if bucket = r.FormValue("bucket"); bucket == "" && len(filenames) > 0 {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(filenames)+len(strs) == 0 || len(filenames)+len(strs) > s.d.config.MaxNum {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	for _, str = range strs {
+		if id, err = strconv.ParseInt(str, 10, 32); err != nil {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+		vids = append(vids, int32(id))
+	}
+	defer tr.End(r)
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	res.Files = make([]*meta.Response, 0, len(filenames))
+	for _, filename = range filenames {
+		fres = &meta.Response{Filename: filename}
+		res.Files = append(res.Files, fres)
+		getFile(s.d, bucket, filename, region, fres)
+		errorResponse(fres)
+	}
+	if len(vids) > 0 {
+		res.Volumes = make(map[string][]string, len(vids))
+	}
+	for i, vid = range vids {
+		// the unavailable volumes have no stores
+		if stores, err = s.d.VolumeStores(vid); err != nil {
+			log.Errorf("VolumeStores(%d) error(%v)", vid, err)
+		}
+		res.Volumes[strs[i]], _ = storeApis(stores, region)
+	}
+	tr.Phase("lookup")
+	res.Ret = errors.RetOK
 	return
 }
 
 func (s *server) upload(wr http.ResponseWriter, r *http.Request) {
 	var (
 		err      error
-		n        *meta.Needle
 		f        *meta.File
 		bucket   string
 		res      meta.Response
-		ok       bool
-		uerr     errors.Error
 		mtimeStr string
+		sizeStr  string
+		tr       = s.slow.Start()
 	)
 	if r.Method != "POST" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
@@ -127,29 +243,152 @@ func (s *server) upload(wr http.ResponseWriter, r *http.Request) {
 		http.Error(wr, "bad request", http.StatusBadRequest)
 		return
 	}
+	// optional, the original filename for the downloads
+	f.Name = r.FormValue("name")
+	// optional, the file size counted by the bucket quota
+	if sizeStr = r.FormValue("size"); sizeStr != "" {
+		if f.Size, err = strconv.ParseInt(sizeStr, 10, 64); err != nil || f.Size < 0 {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	defer tr.End(r)
 	defer HttpUploadWriter(r, wr, time.Now(), &res)
+	uploadFile(s.d, bucket, f, &res)
+	tr.Phase("lookup")
+	traceFile(r, bucket, f.Filename, &res)
+	return
+}
 
+// uploads get writable stores for a batch of files in one request, the new
+// files share one volume.
+func (s *server) uploads(wr http.ResponseWriter, r *http.Request) {
+	var (
+		i         int
+		err       error
+		bucket    string
+		filenames []string
+		sha1s     []string
+		mines     []string
+		mtimes    []string
+		sizes     []string
+		names     []string
+		f         *meta.File
+		fs        []*meta.File
+		ns        []*meta.Needle
+		stores    []string
+		errs      []error
+		fres      *meta.Response
+		res       = new(meta.Responses)
+		tr        = s.slow.Start()
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	if bucket = r.FormValue("bucket"); bucket == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	filenames = r.Form["filename"]
+	sha1s = r.Form["sha1"]
+	mines = r.Form["mine"]
+	mtimes = r.Form["mtime"]
+	sizes = r.Form["size"]
+	names = r.Form["name"]
+	if len(filenames) == 0 || len(filenames) > s.d.config.MaxNum ||
+		len(sha1s) != len(filenames) || len(mines) != len(filenames) || len(mtimes) != len(filenames) {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	// optional, the file sizes counted by the bucket quota and the original
+	// filenames
+	if (len(sizes) != 0 && len(sizes) != len(filenames)) || (len(names) != 0 && len(names) != len(filenames)) {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	fs = make([]*meta.File, len(filenames))
+	for i = range filenames {
+		f = &meta.File{Filename: filenames[i], Sha1: sha1s[i], Mine: mines[i]}
+		if f.Filename == "" || f.Sha1 == "" || f.Mine == "" {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+		if f.MTime, err = strconv.ParseInt(mtimes[i], 10, 64); err != nil {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(sizes) != 0 {
+			if f.Size, err = strconv.ParseInt(sizes[i], 10, 64); err != nil || f.Size < 0 {
+				http.Error(wr, "bad request", http.StatusBadRequest)
+				return
+			}
+		}
+		if len(names) != 0 {
+			f.Name = names[i]
+		}
+		fs[i] = f
+	}
+	defer tr.End(r)
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	ns, stores, errs, err = s.d.UploadsStores(bucket, fs)
+	tr.Phase("lookup")
+	if err != nil {
+		log.Errorf("UploadsStores() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Files = make([]*meta.Response, 0, len(fs))
+	for i, f = range fs {
+		fres = &meta.Response{Filename: f.Filename}
+		res.Files = append(res.Files, fres)
+		uploadResponse(s.d, bucket, f, ns[i], stores, errs[i], fres)
+		errorResponse(fres)
+	}
 	res.Ret = errors.RetOK
-	if n, res.Stores, err = s.d.UploadStores(bucket, f); err != nil {
+	return
+}
+
+// uploadFile get writable stores for the file, the stores of the existing
+// file if the file exists.
+func uploadFile(d *Directory, bucket string, f *meta.File, res *meta.Response) {
+	var (
+		n      *meta.Needle
+		stores []string
+		err    error
+	)
+	n, stores, err = d.UploadStores(bucket, f)
+	uploadResponse(d, bucket, f, n, stores, err, res)
+}
+
+// uploadResponse fill the response by the upload result of the file.
+func uploadResponse(d *Directory, bucket string, f *meta.File, n *meta.Needle, apis []string, err error, res *meta.Response) {
+	var stores []*meta.Store
+	res.Ret = errors.RetOK
+	res.Stores = apis
+	if err == errors.ErrFileDedup {
+		// the needle of the same content, nothing to write
+		res.Ret = errors.RetFileDedup
+		res.Stores = nil
+		err = nil
+	}
+	if err != nil {
 		if err == errors.ErrNeedleExist {
 			// update file data
 			res.Ret = errors.RetNeedleExist
-			if n, _, res.Stores, err = s.d.GetStores(bucket, f.Filename); err != nil {
+			if n, _, stores, err = d.GetStores(bucket, f.Filename); err != nil {
 				log.Errorf("GetStores() error(%v)", err)
-				if uerr, ok = err.(errors.Error); ok {
-					res.Ret = int(uerr)
-				} else {
-					res.Ret = errors.RetInternalErr
-				}
+				res.Ret = retCode(err)
 				return
 			}
+			res.Stores, _ = storeApis(stores, "")
 		} else {
 			log.Errorf("UploadStores() error(%v)", err)
-			if uerr, ok = err.(errors.Error); ok {
-				res.Ret = int(uerr)
-			} else {
-				res.Ret = errors.RetInternalErr
-			}
+			res.Ret = retCode(err)
 			return
 		}
 	}
@@ -160,18 +399,14 @@ func (s *server) upload(wr http.ResponseWriter, r *http.Request) {
 	if f.MTime > 0 {
 		res.MTime = f.MTime
 	}
-	return
 }
 
 func (s *server) del(wr http.ResponseWriter, r *http.Request) {
 	var (
-		err      error
-		n        *meta.Needle
 		bucket   string
 		filename string
 		res      meta.Response
-		ok       bool
-		uerr     errors.Error
+		tr       = s.slow.Start()
 	)
 	if r.Method != "POST" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
@@ -185,9 +420,191 @@ func (s *server) del(wr http.ResponseWriter, r *http.Request) {
 		http.Error(wr, "bad request", http.StatusBadRequest)
 		return
 	}
+	defer tr.End(r)
 	defer HttpDelWriter(r, wr, time.Now(), &res)
-	if n, res.Stores, err = s.d.DelStores(bucket, filename); err != nil {
+	delFile(s.d, bucket, filename, &res)
+	tr.Phase("lookup")
+	traceFile(r, bucket, filename, &res)
+	return
+}
+
+// delFile get delable stores of the file.
+func delFile(d *Directory, bucket, filename string, res *meta.Response) {
+	var (
+		n   *meta.Needle
+		err error
+	)
+	if n, res.Stores, err = d.DelStores(bucket, filename); err != nil {
 		log.Errorf("DelStores() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Ret = errors.RetOK
+	res.Key = n.Key
+	res.Cookie = n.Cookie
+	res.Vid = n.Vid
+}
+
+// alias put an alias to the needle of the file, in the same bucket if no
+// alias_bucket.
+func (s *server) alias(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		bucket  string
+		abucket string
+		n       *meta.Needle
+		f       *meta.File
+		res     meta.Response
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bucket, res.Filename = r.FormValue("bucket"), r.FormValue("alias")
+	if abucket = r.FormValue("alias_bucket"); abucket == "" {
+		abucket = bucket
+	}
+	if bucket == "" || r.FormValue("filename") == "" || res.Filename == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpUploadWriter(r, wr, time.Now(), &res)
+	if n, f, err = s.d.Alias(bucket, r.FormValue("filename"), abucket, res.Filename); err != nil {
+		log.Errorf("Alias() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Ret = errors.RetOK
+	fileResponse(&res, n, f)
+}
+
+// undelete put the file deleted from the soft delete bucket back, the key
+// chooses one of the files deleted of the filename, the latest if no key.
+func (s *server) undelete(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		key      int64
+		bucket   string
+		filename string
+		str      string
+		t        *meta.TrashFile
+		res      = new(meta.Trash)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bucket, filename = r.FormValue("bucket"), r.FormValue("filename")
+	if bucket == "" || filename == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	if str = r.FormValue("key"); str != "" {
+		if key, err = strconv.ParseInt(str, 10, 64); err != nil {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if t, err = s.d.Undelete(bucket, filename, key); err != nil {
+		log.Errorf("Undelete(%s, %s, %d) error(%v)", bucket, filename, key, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Files = []*meta.TrashFile{t}
+	res.Ret = errors.RetOK
+	return
+}
+
+// trash list the files deleted from the soft delete bucket in the trash.
+func (s *server) trash(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		bucket string
+		str    string
+		l      *meta.Trash
+		limit  = _listLimit
+		res    = new(meta.Trash)
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if bucket = r.FormValue("bucket"); bucket == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	if str = r.FormValue("limit"); str != "" {
+		if limit, err = strconv.Atoi(str); err != nil || limit <= 0 || limit > _listLimit {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if l, err = s.d.Trash(bucket, r.FormValue("marker"), limit); err != nil {
+		log.Errorf("Trash(%s) error(%v)", bucket, err)
+		res.Ret = retCode(err)
+		return
+	}
+	*res = *l
+	res.Ret = errors.RetOK
+	return
+}
+
+// list list the files of a bucket by the prefix, rolled up by the delimiter.
+func (s *server) list(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		bucket string
+		str    string
+		l      *meta.List
+		limit  = _listLimit
+		res    = new(meta.List)
+		tr     = s.slow.Start()
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if bucket = r.FormValue("bucket"); bucket == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	if str = r.FormValue("limit"); str != "" {
+		if limit, err = strconv.Atoi(str); err != nil || limit <= 0 || limit > _listLimit {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	defer tr.End(r)
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	l, err = s.d.List(bucket, r.FormValue("prefix"), r.FormValue("delimiter"), r.FormValue("marker"), limit)
+	tr.Phase("list")
+	if err != nil {
+		log.Errorf("List(%s) error(%v)", bucket, err)
+		res.Ret = retCode(err)
+		return
+	}
+	*res = *l
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) register(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		ok   bool
+		uerr errors.Error
+		res  = new(meta.Register)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpRegisterWriter(r, wr, time.Now(), &res)
+	if res, err = s.d.Register(r.FormValue("id"), r.FormValue("rack"), r.FormValue("zone")); err != nil {
+		log.Errorf("Register() error(%v)", err)
+		res = new(meta.Register)
 		if uerr, ok = err.(errors.Error); ok {
 			res.Ret = int(uerr)
 		} else {
@@ -196,9 +613,142 @@ func (s *server) del(wr http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res.Ret = errors.RetOK
-	res.Key = n.Key
-	res.Cookie = n.Cookie
-	res.Vid = n.Vid
+	return
+}
+
+func (s *server) rebalance(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		ok   bool
+		uerr errors.Error
+		rb   *Rebalance
+		res  = new(Rebalance)
+	)
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	// GET reports, POST applies
+	if rb, err = s.d.Rebalance(r.Method == "POST"); err != nil {
+		log.Errorf("Rebalance() error(%v)", err)
+		if uerr, ok = err.(errors.Error); ok {
+			res.Ret = int(uerr)
+		} else {
+			res.Ret = errors.RetInternalErr
+		}
+		return
+	}
+	*res = *rb
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) quota(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		bucket string
+		u      Usage
+		res    = new(Usage)
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if bucket = r.FormValue("bucket"); bucket == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if s.d.quota == nil {
+		res.Ret = errors.RetParamErr
+		return
+	}
+	if u, err = s.d.quota.Usage(bucket); err != nil {
+		log.Errorf("Usage() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	*res = u
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) stats(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		str      string
+		nearFull = defaultNearFull
+		res      = new(ClusterStats)
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if str = r.FormValue("near_full"); str != "" {
+		if nearFull, err = strconv.ParseFloat(str, 64); err != nil || nearFull <= 0 || nearFull > 1 {
+			http.Error(wr, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	*res = *s.d.Stats(nearFull)
+	res.SlowRequests = s.slow.Count()
+	res.Ret = errors.RetOK
+	return
+}
+
+// topology get the stores, groups and volumes, for the capacity planning.
+func (s *server) topology(wr http.ResponseWriter, r *http.Request) {
+	var res = new(meta.Topology)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	*res = *s.d.Topology()
+	res.Ret = errors.RetOK
+	return
+}
+
+// maintenance get or switch by POST the maintenance, cluster=1 rejects all
+// the writes, groups=1,2 the writes of the groups, cluster=0 and no groups
+// switch it off.
+func (s *server) maintenance(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		gid    int
+		str    string
+		groups []int
+		m      *meta.Maintenance
+		res    = new(meta.MaintenanceRet)
+	)
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if r.Method == "GET" {
+		res.Maintenance = s.d.Maintenance()
+		res.Ret = errors.RetOK
+		return
+	}
+	if str = r.FormValue("groups"); str != "" {
+		for _, str = range strings.Split(str, ",") {
+			if gid, err = strconv.Atoi(str); err != nil {
+				res.Ret = errors.RetParamErr
+				return
+			}
+			groups = append(groups, gid)
+		}
+	}
+	if m, err = s.d.SetMaintenance(r.FormValue("cluster") == "1", groups, r.FormValue("reason")); err != nil {
+		log.Errorf("SetMaintenance() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Maintenance = m
+	res.Ret = errors.RetOK
 	return
 }
 
@@ -218,3 +768,372 @@ func (s *server) ping(wr http.ResponseWriter, r *http.Request) {
 	}
 	return
 }
+
+// buckets list the buckets without the secrets of the access keys.
+func (s *server) buckets(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		b   *meta.Bucket
+		key *meta.BucketKey
+		res = new(meta.Buckets)
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if res.Buckets, err = s.d.Buckets(); err != nil {
+		log.Errorf("Buckets() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	for _, b = range res.Buckets {
+		for _, key = range b.Keys {
+			key.Secret = ""
+		}
+	}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketKeys get the access keys of all the buckets, for the proxies.
+func (s *server) bucketKeys(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		b   *meta.Bucket
+		bs  []*meta.Bucket
+		res = new(meta.BucketKeys)
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if bs, err = s.d.Buckets(); err != nil {
+		log.Errorf("Buckets() error(%v)", err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Keys = make(map[string][]*meta.BucketKey, len(bs))
+	for _, b = range bs {
+		res.Keys[b.Name] = b.Keys
+	}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucket get the bucket by GET, create the bucket by POST.
+func (s *server) bucket(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		name string
+		str  string
+		b    = new(meta.Bucket)
+		res  = new(meta.Buckets)
+	)
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if name = r.FormValue("name"); name == "" {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if r.Method == "GET" {
+		b, err = s.d.Bucket(name)
+	} else {
+		b.Name = name
+		b.Domain = r.FormValue("domain")
+		b.PurgeCDN = r.FormValue("purge_cdn") == "1"
+		b.Overwrite = r.FormValue("overwrite")
+		b.Dedup = r.FormValue("dedup") == "1"
+		if str = r.FormValue("trash"); str != "" {
+			if b.Trash, err = strconv.ParseInt(str, 10, 64); err != nil {
+				res.Ret = errors.RetParamErr
+				return
+			}
+		}
+		if b.Property, err = strconv.Atoi(r.FormValue("property")); err != nil {
+			res.Ret = errors.RetParamErr
+			return
+		}
+		if str = r.FormValue("cache_control"); str != "" {
+			if b.CacheControl, err = strconv.ParseInt(str, 10, 64); err != nil {
+				res.Ret = errors.RetParamErr
+				return
+			}
+		}
+		err = s.d.AddBucket(b)
+	}
+	if err != nil {
+		log.Errorf("bucket(%s, %s) error(%v)", r.Method, name, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) delBucket(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		res = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if err = s.d.DelBucket(r.FormValue("name")); err != nil {
+		log.Errorf("DelBucket(%s) error(%v)", r.FormValue("name"), err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) addBucketKey(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		b   *meta.Bucket
+		res = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if b, err = s.d.AddBucketKey(r.FormValue("name")); err != nil {
+		log.Errorf("AddBucketKey(%s) error(%v)", r.FormValue("name"), err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+func (s *server) delBucketKey(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		b   *meta.Bucket
+		res = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	if b, err = s.d.DelBucketKey(r.FormValue("name"), r.FormValue("id")); err != nil {
+		log.Errorf("DelBucketKey(%s, %s) error(%v)", r.FormValue("name"), r.FormValue("id"), err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketCORS set the cors rule of the bucket, no origin removes it.
+func (s *server) bucketCORS(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		str  string
+		name string
+		b    *meta.Bucket
+		cors *meta.BucketCORS
+		res  = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	if len(r.Form["origin"]) > 0 {
+		cors = &meta.BucketCORS{Origins: r.Form["origin"], Methods: r.Form["method"], Headers: r.Form["header"]}
+		if str = r.FormValue("max_age"); str != "" {
+			if cors.MaxAge, err = strconv.ParseInt(str, 10, 64); err != nil {
+				res.Ret = errors.RetParamErr
+				return
+			}
+		}
+	}
+	if b, err = s.d.SetBucketCORS(name, cors); err != nil {
+		log.Errorf("SetBucketCORS(%s, %v) error(%v)", name, cors, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketOverwrite set the policy of the uploads to an existing filename of
+// the bucket, overwrite, reject or version.
+func (s *server) bucketOverwrite(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		name      string
+		overwrite string
+		b         *meta.Bucket
+		res       = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	overwrite = r.FormValue("overwrite")
+	if b, err = s.d.SetBucketOverwrite(name, overwrite); err != nil {
+		log.Errorf("SetBucketOverwrite(%s, %s) error(%v)", name, overwrite, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketDedup make the uploads of the same content to the bucket share one
+// needle.
+func (s *server) bucketDedup(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		name string
+		b    *meta.Bucket
+		res  = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	if b, err = s.d.SetBucketDedup(name); err != nil {
+		log.Errorf("SetBucketDedup(%s) error(%v)", name, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketTrash keep the files deleted from the bucket in the trash for the
+// seconds, 0 deletes them at once.
+func (s *server) bucketTrash(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		name  string
+		trash int64
+		b     *meta.Bucket
+		res   = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	if trash, err = strconv.ParseInt(r.FormValue("trash"), 10, 64); err != nil {
+		res.Ret = errors.RetParamErr
+		return
+	}
+	if b, err = s.d.SetBucketTrash(name, trash); err != nil {
+		log.Errorf("SetBucketTrash(%s, %d) error(%v)", name, trash, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketLabels pin the uploads to the bucket to the groups of the stores with
+// all the labels, repeatable, no labels unpin it.
+func (s *server) bucketLabels(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		name   string
+		labels []string
+		b      *meta.Bucket
+		res    = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	labels = r.Form["label"]
+	if b, err = s.d.SetBucketLabels(name, labels); err != nil {
+		log.Errorf("SetBucketLabels(%s, %v) error(%v)", name, labels, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
+
+// bucketHeader set the response header policy of the bucket, the custom
+// headers are "name: value", repeatable.
+func (s *server) bucketHeader(wr http.ResponseWriter, r *http.Request) {
+	var (
+		i            int
+		err          error
+		str          string
+		name         string
+		cacheControl int64
+		headers      map[string]string
+		b            *meta.Bucket
+		res          = new(meta.Buckets)
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		http.Error(wr, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer HttpJsonWriter(r, wr, time.Now(), res, &res.Ret)
+	name = r.FormValue("name")
+	if str = r.FormValue("cache_control"); str != "" {
+		if cacheControl, err = strconv.ParseInt(str, 10, 64); err != nil {
+			res.Ret = errors.RetParamErr
+			return
+		}
+	}
+	if len(r.Form["header"]) > 0 {
+		headers = make(map[string]string, len(r.Form["header"]))
+	}
+	for _, str = range r.Form["header"] {
+		if i = strings.Index(str, ":"); i < 1 {
+			res.Ret = errors.RetParamErr
+			return
+		}
+		headers[strings.TrimSpace(str[:i])] = strings.TrimSpace(str[i+1:])
+	}
+	if b, err = s.d.SetBucketHeader(name, cacheControl, r.FormValue("content_disposition"), headers); err != nil {
+		log.Errorf("SetBucketHeader(%s) error(%v)", name, err)
+		res.Ret = retCode(err)
+		return
+	}
+	res.Buckets = []*meta.Bucket{b}
+	res.Ret = errors.RetOK
+	return
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bfs/directory/conf"
+	"bfs/libs/meta"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -13,35 +15,29 @@ import (
 func TestHTTPAPI(t *testing.T) {
 	var (
 		err    error
-		config *Config
-		zk     *Zookeeper
+		config *conf.Config
 		d      *Directory
 		key    int64
 		cookie int32
 		body   []byte
 		url    string
 		resp   *http.Response
-		res    Response
+		res    meta.Response
 		buf    = &bytes.Buffer{}
 	)
-	if config, err = NewConfig("./directory.conf"); err != nil {
+	if config, err = conf.NewConfig("./directory.toml"); err != nil {
 		t.Errorf("NewConfig() error(%v)", err)
 		t.FailNow()
 	}
-
-	if zk, err = NewZookeeper([]string{"123.56.108.22:2181"}, time.Second*15, "/rack", "/volume", "/group"); err != nil {
-		t.Errorf("NewZookeeper() error(%v)", err)
-		t.FailNow()
-	}
-	if d, err = NewDirectory(config, zk); err != nil {
+	if d, err = NewDirectory(config); err != nil {
 		t.Errorf("NewDirectory() error(%v)", err)
 		t.FailNow()
 	}
 	StartApi(config.ApiListen, d)
 	time.Sleep(1 * time.Second)
 	buf.Reset()
-	buf.WriteString("num=1")
-	if resp, err = http.Post("http://172.16.13.86:6065/upload", "application/x-www-form-urlencoded", buf); err != nil {
+	buf.WriteString("bucket=test&filename=test.jpg&sha1=a9993e364706816aba3e25717850c26c9cd0d89d&mine=image/jpeg&mtime=1")
+	if resp, err = http.Post("http://"+config.ApiListen+"/upload", "application/x-www-form-urlencoded", buf); err != nil {
 		t.Errorf("http.Post error(%v)", err)
 		t.FailNow()
 	}
@@ -58,11 +54,11 @@ func TestHTTPAPI(t *testing.T) {
 		t.Errorf("json.Unmarshal error(%v)", err)
 		t.FailNow()
 	}
-	key = res.Keys[0]
+	key = res.Key
 	cookie = res.Cookie
 	fmt.Println("put vid:", res.Vid)
 	buf.Reset()
-	url = fmt.Sprintf("http://172.16.13.86:6065/get?key=%d&cookie=%d", key, cookie)
+	url = fmt.Sprintf("http://%s/get?bucket=test&filename=test.jpg", config.ApiListen)
 	if resp, err = http.Get(url); err != nil {
 		t.Errorf("http ERROR error(%v)", err)
 		t.FailNow()
@@ -79,10 +75,14 @@ func TestHTTPAPI(t *testing.T) {
 		t.Errorf("json.Unmarshal error(%v)", err)
 		t.FailNow()
 	}
+	if res.Key != key || res.Cookie != cookie {
+		t.Errorf("get key: %d cookie: %d, want key: %d cookie: %d", res.Key, res.Cookie, key, cookie)
+		t.FailNow()
+	}
 	fmt.Println("get vid:", res.Vid)
 	buf.Reset()
-	buf.WriteString(fmt.Sprintf("key=%d&cookie=%d", key, cookie))
-	if resp, err = http.Post("http://172.16.13.86:6065/del", "application/x-www-form-urlencoded", buf); err != nil {
+	buf.WriteString("bucket=test&filename=test.jpg")
+	if resp, err = http.Post("http://"+config.ApiListen+"/del", "application/x-www-form-urlencoded", buf); err != nil {
 		t.Errorf("http.Post error(%v)", err)
 		t.FailNow()
 	}
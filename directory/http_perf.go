@@ -1,9 +1,10 @@
 package main
 
 import (
-	log "github.com/golang/glog"
 	"net/http"
 	_ "net/http/pprof"
+
+	"bfs/libs/log"
 )
 
 // StartPprof start a golang pprof.
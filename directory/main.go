@@ -2,17 +2,23 @@ package main
 
 import (
 	"bfs/directory/conf"
+	"bfs/libs/check"
+	"bfs/libs/log"
+	"bfs/libs/trace"
 	"flag"
-	log "github.com/golang/glog"
+	"fmt"
+	"os"
 	"runtime"
 )
 
 var (
 	configFile string
+	testConfig bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "c", "./directory.toml", " set directory config file path")
+	flag.BoolVar(&testConfig, "t", false, " test config and exit")
 }
 
 func main() {
@@ -22,6 +28,10 @@ func main() {
 		err error
 	)
 	flag.Parse()
+	if testConfig {
+		checkConf()
+		return
+	}
 	defer log.Flush()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	log.Infof("bfs directory start")
@@ -29,6 +39,15 @@ func main() {
 		log.Errorf("NewConfig(\"%s\") error(%v)", configFile, err)
 		return
 	}
+	if err = log.Init(c.Log); err != nil {
+		log.Errorf("log.Init() error(%v)", err)
+		return
+	}
+	if err = trace.Init(c.Tracing, "bfs-directory"); err != nil {
+		log.Errorf("trace.Init() error(%v)", err)
+		return
+	}
+	defer trace.Close()
 	log.Infof("new directory...")
 	if d, err = NewDirectory(c); err != nil {
 		log.Errorf("NewDirectory() failed, Quit now error(%v)", err)
@@ -36,6 +55,17 @@ func main() {
 	}
 	log.Infof("init http api...")
 	StartApi(c.ApiListen, d)
+	if c.AdminListen != "" {
+		log.Infof("init http admin api...")
+		StartAdminApi(c.AdminListen, d)
+	}
+	if c.RpcListen != "" {
+		log.Infof("init grpc api...")
+		if err = StartRpc(c.RpcListen, d); err != nil {
+			log.Errorf("StartRpc() failed, Quit now error(%v)", err)
+			return
+		}
+	}
 	if c.PprofEnable {
 		log.Infof("init http pprof...")
 		StartPprof(c.PprofListen)
@@ -43,3 +73,27 @@ func main() {
 	StartSignal()
 	return
 }
+
+// checkConf parse and check the config, zookeeper and hbase reachability,
+// then print the effective config, exit non-zero if any problem found.
+func checkConf() {
+	var (
+		c   *conf.Config
+		err error
+	)
+	if c, err = conf.NewConfig(configFile); err == nil {
+		if err = c.Check(); err == nil {
+			ck := check.New()
+			ck.Dial("Snowflake.ZkAddrs", c.Snowflake.ZkAddrs, c.Snowflake.ZkTimeout.Duration)
+			ck.Dial("Zookeeper.Addrs", c.Zookeeper.Addrs, c.Zookeeper.Timeout.Duration)
+			ck.Dial("HBase.Addr", []string{c.HBase.Addr}, c.HBase.Timeout.Duration)
+			err = ck.Err()
+		}
+		check.Print(os.Stdout, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config file %s test failed:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "config file %s test is successful\n", configFile)
+}
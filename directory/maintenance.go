@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"encoding/json"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Maintenance get the maintenance switch, all off if not in maintenance.
+func (d *Directory) Maintenance() (m *meta.Maintenance) {
+	if m, _ = d.maintenance.Load().(*meta.Maintenance); m == nil {
+		m = new(meta.Maintenance)
+	}
+	return
+}
+
+// SetMaintenance switch the maintenance of the cluster or the groups in
+// zookeeper, all off if not cluster and no groups.
+func (d *Directory) SetMaintenance(cluster bool, groups []int, reason string) (m *meta.Maintenance, err error) {
+	var data []byte
+	if d.config.Zookeeper.MaintenancePath == "" {
+		return nil, errors.ErrParam
+	}
+	m = &meta.Maintenance{Cluster: cluster, Groups: groups, Reason: reason, Time: time.Now().Unix()}
+	if data, err = json.Marshal(m); err != nil {
+		return
+	}
+	if err = d.zk.SetMaintenance(data); err != nil {
+		return nil, errors.ErrZookeeperDataError
+	}
+	// this directory at once, the others by the watch
+	d.setMaintenance(m)
+	return
+}
+
+// setMaintenance apply the maintenance switch.
+func (d *Directory) setMaintenance(m *meta.Maintenance) {
+	var old = d.Maintenance()
+	d.maintenance.Store(m)
+	d.dispatcher.SetMaintenance(m.Groups)
+	if m.Time != old.Time {
+		log.Infof("maintenance cluster: %t groups: %v reason: %s", m.Cluster, m.Groups, m.Reason)
+	}
+}
+
+// maintenanceproc follow the maintenance switch in zookeeper, every
+// directory watches it, so the proxies get ErrMaintenance of the writes
+// from any of them.
+func (d *Directory) maintenanceproc() {
+	var (
+		err  error
+		data []byte
+		ev   <-chan zk.Event
+		m    *meta.Maintenance
+	)
+	for {
+		if data, ev, err = d.zk.Maintenance(); err != nil {
+			time.Sleep(retrySleep)
+			continue
+		}
+		m = new(meta.Maintenance)
+		if len(data) > 0 {
+			if err = json.Unmarshal(data, m); err != nil {
+				log.Errorf("json.Unmarshal(%s) error(%v)", data, err)
+				// keep the last one
+				m = d.Maintenance()
+			}
+		}
+		d.setMaintenance(m)
+		select {
+		case <-ev:
+		case <-time.After(d.config.Zookeeper.PullInterval.Duration):
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	domainRack = "rack"
+	domainZone = "zone"
+)
+
+const (
+	_storeCloneApi = "http://%s/clone_volume"
+)
+
+// Violation a group has stores share a failure domain.
+type Violation struct {
+	Group   int      `json:"group"`
+	Domain  string   `json:"domain"`
+	Stores  []string `json:"stores"`
+	Volumes []int32  `json:"volumes"`
+}
+
+// Move move a store from a group to another.
+type Move struct {
+	Store string `json:"store"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+}
+
+// Clone a volume of the new group cloned to a moved store.
+type Clone struct {
+	Store  string `json:"store"`
+	Volume int32  `json:"volume"`
+	Src    string `json:"src"`
+}
+
+// Rebalance the placement violations and the proposed moves, the clones
+// started and whether the moves are applied if applying.
+type Rebalance struct {
+	Ret        int          `json:"ret"`
+	Violations []*Violation `json:"violations"`
+	Moves      []*Move      `json:"moves"`
+	Clones     []*Clone     `json:"clones,omitempty"`
+	Applied    bool         `json:"applied"`
+}
+
+// failureDomain get the failure domain of the store, empty means unknown.
+func failureDomain(domain string, s *meta.Store) string {
+	if domain == domainZone {
+		return s.Zone
+	}
+	return s.Rack
+}
+
+// conflict get the failure domain shared by the stores, empty if none.
+func conflict(domain string, stores []string, store map[string]*meta.Store) (fd string) {
+	var (
+		ok   bool
+		sid  string
+		s    *meta.Store
+		seen = make(map[string]struct{}, len(stores))
+	)
+	if domain == "" {
+		return
+	}
+	for _, sid = range stores {
+		if s, ok = store[sid]; !ok || s == nil {
+			continue
+		}
+		if fd = failureDomain(domain, s); fd == "" {
+			continue
+		}
+		if _, ok = seen[fd]; ok {
+			return
+		}
+		seen[fd] = struct{}{}
+	}
+	return ""
+}
+
+// placementDomain get the configured failure domain, empty if no placement
+// rule.
+func (d *Directory) placementDomain() string {
+	if d.config.Placement == nil {
+		return ""
+	}
+	if d.config.Placement.Domain == "" {
+		return domainRack
+	}
+	return d.config.Placement.Domain
+}
+
+// Rebalance detect the groups and volumes violate the placement rule, then
+// propose store swaps between groups which make both groups valid, the
+// moves are applied if apply, see move.
+func (d *Directory) Rebalance(apply bool) (r *Rebalance, err error) {
+	var (
+		gid, h   int
+		i, j     int
+		fd       string
+		sid      string
+		vid      int32
+		gids     []int
+		stores   []string
+		svrs     []string
+		v        *Violation
+		domain   = d.placementDomain()
+		store    = d.store
+		group    = make(map[int][]string, len(d.group))
+		volumes  = make(map[int][]int32)
+		storeGrp = d.storeGroup
+		swapped  bool
+	)
+	if apply {
+		d.rlock.Lock()
+		defer d.rlock.Unlock()
+	}
+	r = new(Rebalance)
+	if domain == "" {
+		return
+	}
+	for gid, stores = range d.group {
+		group[gid] = append([]string(nil), stores...)
+		gids = append(gids, gid)
+	}
+	sort.Ints(gids)
+	// the volumes replicas share a failure domain
+	for vid, svrs = range d.volumeStore {
+		if fd = conflict(domain, svrs, store); fd == "" || len(svrs) == 0 {
+			continue
+		}
+		gid = storeGrp[svrs[0]]
+		volumes[gid] = append(volumes[gid], vid)
+	}
+	for _, gid = range gids {
+		if fd = conflict(domain, group[gid], store); fd == "" {
+			continue
+		}
+		v = &Violation{Group: gid, Domain: fd, Stores: group[gid], Volumes: volumes[gid]}
+		sort.Sort(int32s(v.Volumes))
+		r.Violations = append(r.Violations, v)
+	}
+	// greedy swap a conflict store with a store of another group
+	for _, gid = range gids {
+		for conflict(domain, group[gid], store) != "" {
+			swapped = false
+			for i, sid = range group[gid] {
+				if !d.conflictStore(domain, group[gid], i) {
+					continue
+				}
+				for _, h = range gids {
+					if h == gid {
+						continue
+					}
+					for j = range group[h] {
+						if swapped = d.trySwap(domain, group, gid, i, h, j); swapped {
+							r.Moves = append(r.Moves, &Move{Store: sid, From: gid, To: h},
+								&Move{Store: group[gid][i], From: h, To: gid})
+							break
+						}
+					}
+					if swapped {
+						break
+					}
+				}
+				if swapped {
+					break
+				}
+			}
+			if !swapped {
+				log.Warningf("group: %d violates the placement rule, no swap found", gid)
+				break
+			}
+		}
+	}
+	if apply && len(r.Moves) > 0 {
+		err = d.move(r)
+	}
+	return
+}
+
+// netMoves merge the moves of a store into one, the stores back to their
+// groups are dropped.
+func netMoves(moves []*Move) (ms []*Move) {
+	var (
+		ok   bool
+		m, n *Move
+		net  []*Move
+		last = make(map[string]*Move, len(moves))
+	)
+	for _, m = range moves {
+		if n, ok = last[m.Store]; ok {
+			n.To = m.To
+			continue
+		}
+		n = &Move{Store: m.Store, From: m.From, To: m.To}
+		last[m.Store] = n
+		net = append(net, n)
+	}
+	for _, n = range net {
+		if n.From != n.To {
+			ms = append(ms, n)
+		}
+	}
+	return
+}
+
+// move clone the volumes of the new groups the moved stores miss by the
+// store clone_volume api, the memberships are swapped in zookeeper only
+// after no volume is missed, so apply again till applied. the groups of the
+// moves must be in maintenance, or the writes during the clones are lost.
+func (d *Directory) move(r *Rebalance) (err error) {
+	var (
+		ok      bool
+		missed  bool
+		i       int
+		vid     int32
+		vids    []int32
+		m       *Move
+		c       *Clone
+		has     map[int32]struct{}
+		mt      = d.Maintenance()
+		moves   = netMoves(r.Moves)
+		volumes = make([][]int32, len(moves))
+	)
+	for _, m = range moves {
+		if mt.Writable(m.From) || mt.Writable(m.To) {
+			return errors.ErrRebalanceWritable
+		}
+	}
+	for i, m = range moves {
+		if volumes[i], err = d.moveVolumes(m); err != nil {
+			return
+		}
+		has = make(map[int32]struct{}, len(d.storeVolume[m.Store]))
+		for _, vid = range d.storeVolume[m.Store] {
+			has[vid] = struct{}{}
+		}
+		for _, vid = range volumes[i] {
+			if _, ok = has[vid]; ok {
+				continue
+			}
+			missed = true
+			if c, err = d.cloneVolume(m, vid); err != nil {
+				return
+			}
+			r.Clones = append(r.Clones, c)
+		}
+	}
+	if missed {
+		return
+	}
+	for i, m = range moves {
+		vids = vids[:0]
+		has = make(map[int32]struct{}, len(volumes[i]))
+		for _, vid = range volumes[i] {
+			if err = d.zk.AddVolumeStore(vid, m.Store, nil); err != nil {
+				return
+			}
+			has[vid] = struct{}{}
+		}
+		// the volumes of the former group
+		for vid = range d.volumeStore {
+			if _, ok = has[vid]; !ok && d.volumeHas(vid, m.Store) {
+				vids = append(vids, vid)
+			}
+		}
+		for _, vid = range vids {
+			if err = d.zk.DelVolumeStore(vid, m.Store); err != nil {
+				return
+			}
+		}
+		if err = d.zk.AddGroupStore(m.To, m.Store); err != nil {
+			return
+		}
+		if err = d.zk.DelGroupStore(m.From, m.Store); err != nil {
+			return
+		}
+		log.Infof("rebalance store: %s, group: %d to %d, volumes: %v", m.Store, m.From, m.To, volumes[i])
+	}
+	r.Applied = true
+	return
+}
+
+// moveVolumes get the volumes of the new group of the moved store.
+func (d *Directory) moveVolumes(m *Move) (vids []int32, err error) {
+	var (
+		sid    string
+		stores []string
+	)
+	for _, sid = range d.group[m.To] {
+		if sid != m.Store {
+			stores = append(stores, sid)
+		}
+	}
+	if len(stores) == 0 {
+		return
+	}
+	vids, _, err = d.groupVolumes(stores)
+	return
+}
+
+// volumeHas reports whether the store is a replica of the volume.
+func (d *Directory) volumeHas(vid int32, sid string) bool {
+	for _, s := range d.volumeStore[vid] {
+		if s == sid {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneVolume clone the volume from a store of the new group to the moved
+// store, the clone runs in the store background.
+func (d *Directory) cloneVolume(m *Move, vid int32) (c *Clone, err error) {
+	var (
+		ok     bool
+		sid    string
+		src    *meta.Store
+		s      *meta.Store
+		uri    string
+		resp   *http.Response
+		sRet   meta.StoreRet
+		params = url.Values{}
+	)
+	if s, ok = d.store[m.Store]; !ok || s.Admin == "" {
+		log.Errorf("clone volume: %d, store: %s not available", vid, m.Store)
+		return nil, errors.ErrStoreNotAvailable
+	}
+	for _, sid = range d.volumeStore[vid] {
+		if sid == m.Store || d.storeGroup[sid] != m.To {
+			continue
+		}
+		if src, ok = d.store[sid]; ok && src.Admin != "" {
+			break
+		}
+		src = nil
+	}
+	if src == nil {
+		log.Errorf("clone volume: %d, no store of group: %d to clone from", vid, m.To)
+		return nil, errors.ErrStoreNotAvailable
+	}
+	params.Set("vid", strconv.Itoa(int(vid)))
+	params.Set("nvid", strconv.Itoa(int(vid)))
+	params.Set("src", src.Admin)
+	params.Set("live", "1")
+	uri = fmt.Sprintf(_storeCloneApi, s.Admin)
+	if resp, err = _storeClient.PostForm(uri, params); err != nil {
+		log.Errorf("http.PostForm(%s) error(%v)", uri, err)
+		return nil, errors.ErrStoreNotAvailable
+	}
+	err = json.NewDecoder(resp.Body).Decode(&sRet)
+	resp.Body.Close()
+	if err != nil {
+		log.Errorf("clone volume: %d store: %s error(%v)", vid, uri, err)
+		return nil, errors.ErrStoreNotAvailable
+	}
+	// cloned already, the heartbeat not reported yet
+	if sRet.Ret != errors.RetOK && sRet.Ret != errors.RetVolumeExist {
+		log.Errorf("clone volume: %d store: %s ret: %d", vid, uri, sRet.Ret)
+		return nil, errors.Error(sRet.Ret)
+	}
+	log.Infof("clone volume: %d from store: %s to store: %s", vid, src.Id, s.Id)
+	return &Clone{Store: s.Id, Volume: vid, Src: src.Id}, nil
+}
+
+// conflictStore reports whether the i-th store shares a failure domain with
+// a former store of the group.
+func (d *Directory) conflictStore(domain string, stores []string, i int) bool {
+	var (
+		ok bool
+		j  int
+		s  *meta.Store
+		fd string
+	)
+	if s, ok = d.store[stores[i]]; !ok || s == nil {
+		return false
+	}
+	if fd = failureDomain(domain, s); fd == "" {
+		return false
+	}
+	for j = 0; j < i; j++ {
+		if s, ok = d.store[stores[j]]; ok && s != nil && failureDomain(domain, s) == fd {
+			return true
+		}
+	}
+	return false
+}
+
+// trySwap swap group[g][i] and group[h][j] if both groups are valid after
+// swapping.
+func (d *Directory) trySwap(domain string, group map[int][]string, g, i, h, j int) bool {
+	var (
+		gs = append([]string(nil), group[g]...)
+		hs = append([]string(nil), group[h]...)
+	)
+	gs[i], hs[j] = hs[j], gs[i]
+	if conflict(domain, gs, d.store) != "" || conflict(domain, hs, d.store) != "" {
+		return false
+	}
+	group[g], group[h] = gs, hs
+	return true
+}
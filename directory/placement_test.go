@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bfs/directory/conf"
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+	"reflect"
+	"testing"
+)
+
+var testStores = map[string]*meta.Store{
+	"s1": &meta.Store{Id: "s1", Rack: "rack-a", Zone: "zone-a"},
+	"s2": &meta.Store{Id: "s2", Rack: "rack-a", Zone: "zone-a"},
+	"s3": &meta.Store{Id: "s3", Rack: "rack-b", Zone: "zone-a"},
+	"s4": &meta.Store{Id: "s4", Rack: "rack-c", Zone: "zone-b"},
+	"s5": &meta.Store{Id: "s5"},
+}
+
+func TestConflict(t *testing.T) {
+	for i, c := range []struct {
+		domain string
+		stores []string
+		fd     string
+	}{
+		{domainRack, []string{"s1", "s3"}, ""},
+		{domainRack, []string{"s1", "s2"}, "rack-a"},
+		{domainRack, []string{"s3", "s1", "s2"}, "rack-a"},
+		{domainZone, []string{"s1", "s3"}, "zone-a"},
+		{domainZone, []string{"s3", "s4"}, ""},
+		// no placement rule
+		{"", []string{"s1", "s2"}, ""},
+		// unknown domain or store never conflicts
+		{domainRack, []string{"s5", "s5"}, ""},
+		{domainRack, []string{"s1", "s6", "s6"}, ""},
+	} {
+		if fd := conflict(c.domain, c.stores, testStores); fd != c.fd {
+			t.Errorf("%d: conflict(%s, %v) got: %s, want: %s", i, c.domain, c.stores, fd, c.fd)
+			t.FailNow()
+		}
+	}
+}
+
+func TestRegisterGroup(t *testing.T) {
+	var (
+		d = &Directory{
+			config: &conf.Config{Register: &conf.Register{GroupSize: 2}},
+			store:  testStores,
+		}
+		group = map[int][]string{1: []string{"s1"}, 2: []string{"s3", "s4"}, 3: []string{"s2"}}
+	)
+	for i, c := range []struct {
+		domain string
+		store  *meta.Store
+		gid    int
+	}{
+		// the first group not full without the failure domain
+		{"", &meta.Store{Id: "s6", Rack: "rack-c"}, 1},
+		// the rack by default
+		{"", &meta.Store{Id: "s6", Rack: "rack-a"}, 4},
+		{domainZone, &meta.Store{Id: "s6", Rack: "rack-c", Zone: "zone-b"}, 1},
+		{domainZone, &meta.Store{Id: "s6", Rack: "rack-c", Zone: "zone-a"}, 4},
+	} {
+		if d.config.Placement = nil; c.domain != "" {
+			d.config.Placement = &conf.Placement{Domain: c.domain}
+		}
+		if gid := d.registerGroup(group, c.store); gid != c.gid {
+			t.Errorf("%d: registerGroup(%+v) got: %d, want: %d", i, c.store, gid, c.gid)
+			t.FailNow()
+		}
+	}
+	if len(group[1]) != 1 {
+		t.Errorf("group: %v changed", group)
+		t.FailNow()
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	var (
+		err error
+		r   *Rebalance
+		d   = &Directory{
+			config:      &conf.Config{Placement: &conf.Placement{}},
+			store:       testStores,
+			group:       map[int][]string{1: []string{"s1", "s2"}, 2: []string{"s3", "s4"}},
+			storeGroup:  map[string]int{"s1": 1, "s2": 1, "s3": 2, "s4": 2},
+			volumeStore: map[int32][]string{1: []string{"s1", "s2"}, 2: []string{"s3", "s4"}},
+		}
+	)
+	if r, err = d.Rebalance(false); err != nil {
+		t.Errorf("Rebalance() error(%v)", err)
+		t.FailNow()
+	}
+	if len(r.Violations) != 1 || !reflect.DeepEqual(r.Violations[0], &Violation{Group: 1, Domain: "rack-a", Stores: []string{"s1", "s2"}, Volumes: []int32{1}}) {
+		t.Errorf("violations: %+v", r.Violations)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(r.Moves, []*Move{&Move{Store: "s2", From: 1, To: 2}, &Move{Store: "s3", From: 2, To: 1}}) || r.Applied {
+		t.Errorf("moves: %+v applied: %v", r.Moves, r.Applied)
+		t.FailNow()
+	}
+	// the groups are writable
+	if _, err = d.Rebalance(true); err != errors.ErrRebalanceWritable {
+		t.Errorf("Rebalance(true) error(%v), want(%v)", err, errors.ErrRebalanceWritable)
+		t.FailNow()
+	}
+}
+
+func TestNetMoves(t *testing.T) {
+	var ms = netMoves([]*Move{
+		&Move{Store: "s1", From: 1, To: 2},
+		&Move{Store: "s2", From: 2, To: 1},
+		&Move{Store: "s1", From: 2, To: 3},
+		&Move{Store: "s3", From: 3, To: 2},
+		&Move{Store: "s2", From: 1, To: 2},
+	})
+	if !reflect.DeepEqual(ms, []*Move{&Move{Store: "s1", From: 1, To: 3}, &Move{Store: "s3", From: 3, To: 2}}) {
+		t.Errorf("netMoves() got: %+v", ms)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bfs/directory/conf"
+	"bfs/directory/hbase"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"sync"
+	"time"
+)
+
+// Quota track the usage of the buckets in hbase and enforce the bucket
+// quotas for uploads. a nil Quota tracks nothing.
+type Quota struct {
+	hBase   *hbase.HBaseClient
+	limits  map[string]*conf.BucketQuota
+	refresh time.Duration
+	lock    sync.Mutex
+	usages  map[string]*Usage // bucket:usage
+}
+
+// Usage the usage and quota of a bucket.
+type Usage struct {
+	Ret     int    `json:"ret"`
+	Bucket  string `json:"bucket"`
+	Bytes   int64  `json:"bytes"`
+	Objects int64  `json:"objects"`
+	// quota, 0 means no limit
+	MaxBytes   int64 `json:"max_bytes"`
+	MaxObjects int64 `json:"max_objects"`
+
+	expire time.Time
+}
+
+// NewQuota new a quota, nil if not configured.
+func NewQuota(c *conf.Config, h *hbase.HBaseClient) (q *Quota) {
+	if c.Quota == nil {
+		return nil
+	}
+	q = &Quota{hBase: h, limits: c.Quota.Buckets, refresh: c.Quota.Refresh.Duration}
+	q.usages = make(map[string]*Usage)
+	return
+}
+
+// Usage get the usage of the bucket, reload from hbase if expired.
+func (q *Quota) Usage(bucket string) (u Usage, err error) {
+	var (
+		ok    bool
+		cu    *Usage
+		limit *conf.BucketQuota
+	)
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	cu, ok = q.usages[bucket]
+	if ok && time.Now().Before(cu.expire) {
+		u = *cu
+		q.lock.Unlock()
+		return
+	}
+	q.lock.Unlock()
+	u.Bucket = bucket
+	if limit = q.limits[bucket]; limit != nil {
+		u.MaxBytes, u.MaxObjects = limit.Bytes, limit.Objects
+	}
+	if u.Bytes, u.Objects, err = q.hBase.Usage(bucket); err != nil {
+		log.Errorf("hBase.Usage(\"%s\") error(%v)", bucket, err)
+		err = errors.ErrHBase
+		return
+	}
+	q.set(&u)
+	return
+}
+
+// set cache the usage.
+func (q *Quota) set(u *Usage) {
+	var cu = *u
+	cu.expire = time.Now().Add(q.refresh)
+	q.lock.Lock()
+	q.usages[u.Bucket] = &cu
+	q.lock.Unlock()
+}
+
+// Check check the bucket has room for count new files of the total size.
+func (q *Quota) Check(bucket string, size, count int64) (err error) {
+	var u Usage
+	if q == nil || q.limits[bucket] == nil {
+		return
+	}
+	if u, err = q.Usage(bucket); err != nil {
+		return
+	}
+	if (u.MaxBytes > 0 && u.Bytes+size > u.MaxBytes) ||
+		(u.MaxObjects > 0 && u.Objects+count > u.MaxObjects) {
+		log.Warningf("bucket: %s quota exceeded, bytes: %d/%d, objects: %d/%d", bucket,
+			u.Bytes, u.MaxBytes, u.Objects, u.MaxObjects)
+		err = errors.ErrBucketQuotaExceeded
+	}
+	return
+}
+
+// Add add the usage of the bucket, negative for the deleted files.
+func (q *Quota) Add(bucket string, size, count int64) {
+	var (
+		err   error
+		u     = Usage{Bucket: bucket}
+		limit *conf.BucketQuota
+	)
+	if q == nil {
+		return
+	}
+	if u.Bytes, u.Objects, err = q.hBase.IncrUsage(bucket, size, count); err != nil {
+		// the usage drifts, not fail the write which already done
+		log.Errorf("hBase.IncrUsage(\"%s\", %d, %d) error(%v)", bucket, size, count, err)
+		return
+	}
+	if limit = q.limits[bucket]; limit != nil {
+		u.MaxBytes, u.MaxObjects = limit.Bytes, limit.Objects
+	}
+	q.set(&u)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/uuid"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// Register register a store, assign it a rack, a group and the volumes of
+// the group, a registered store gets the same assignment again.
+func (d *Directory) Register(id, rack, zone string) (r *meta.Register, err error) {
+	var (
+		ok     bool
+		g, gid int
+		vid    int32
+		sid    string
+		data   []byte
+		stores []string
+		vids   []int32
+		group  map[int][]string
+		c      = d.config.Register
+	)
+	if c == nil {
+		err = errors.ErrRegisterDisabled
+		return
+	}
+	d.rlock.Lock()
+	defer d.rlock.Unlock()
+	if id == "" {
+		if id, err = uuid.New(); err != nil {
+			log.Errorf("uuid.New() error(%v)", err)
+			return
+		}
+	}
+	if group, err = d.zkGroups(); err != nil {
+		return
+	}
+	gid = -1
+	for g, stores = range group {
+		for _, sid = range stores {
+			if sid == id {
+				gid = g
+			}
+		}
+	}
+	if rack == "" {
+		rack = d.registerRack(id)
+	}
+	if gid < 0 {
+		gid = d.registerGroup(group, &meta.Store{Id: id, Rack: rack, Zone: zone})
+	}
+	if vids, ok, err = d.groupVolumes(group[gid]); err != nil {
+		return
+	}
+	if !ok {
+		// a new group, alloc new volumes
+		for vid = d.maxVolume + 1; len(vids) < c.Volumes; vid++ {
+			vids = append(vids, vid)
+		}
+	}
+	if data, err = json.Marshal(&meta.VolumeState{FreeSpace: meta.MaxBlockOffset}); err != nil {
+		log.Errorf("json.Marshal() error(%v)", err)
+		return
+	}
+	for _, vid = range vids {
+		if err = d.zk.AddVolumeStore(vid, id, data); err != nil {
+			return
+		}
+	}
+	if err = d.zk.AddGroupStore(gid, id); err != nil {
+		return
+	}
+	log.Infof("register store: %s, rack: %s, group: %d, volumes: %v", id, rack, gid, vids)
+	r = &meta.Register{
+		Id:          id,
+		Rack:        rack,
+		Group:       gid,
+		Volumes:     vids,
+		FreeVolumes: c.FreeVolumes,
+	}
+	return
+}
+
+// zkGroups get the groups from zookeeper, the memory one may be stale.
+func (d *Directory) zkGroups() (group map[int][]string, err error) {
+	var (
+		gid    int
+		str    string
+		groups []string
+		stores []string
+	)
+	if groups, err = d.zk.Groups(); err != nil {
+		return
+	}
+	group = make(map[int][]string, len(groups))
+	for _, str = range groups {
+		if gid, err = strconv.Atoi(str); err != nil {
+			log.Errorf("wrong group:%s", str)
+			err = nil
+			continue
+		}
+		if stores, err = d.zk.GroupStores(str); err != nil {
+			return
+		}
+		group[gid] = stores
+	}
+	return
+}
+
+// groupVolumes get the volumes of the stores from zookeeper, ok is false if
+// the stores own no volume, also set the max volume id.
+func (d *Directory) groupVolumes(stores []string) (vids []int32, ok bool, err error) {
+	var (
+		vid     int
+		str     string
+		sid     string
+		volumes []string
+		vstores []string
+		in      = make(map[string]struct{}, len(stores))
+	)
+	for _, sid = range stores {
+		in[sid] = struct{}{}
+	}
+	if volumes, err = d.zk.Volumes(); err != nil {
+		return
+	}
+	for _, str = range volumes {
+		if vid, err = strconv.Atoi(str); err != nil {
+			log.Errorf("wrong volume:%s", str)
+			err = nil
+			continue
+		}
+		if int32(vid) > d.maxVolume {
+			d.maxVolume = int32(vid)
+		}
+		if vstores, err = d.zk.VolumeStores(str); err != nil {
+			return
+		}
+		for _, sid = range vstores {
+			if _, ok = in[sid]; ok {
+				vids = append(vids, int32(vid))
+				break
+			}
+		}
+	}
+	ok = len(vids) > 0
+	sort.Sort(int32s(vids))
+	return
+}
+
+// registerRack get the registered rack of the store or the rack which has
+// fewest stores.
+func (d *Directory) registerRack(id string) (rack string) {
+	var (
+		ok    bool
+		n     int
+		r     string
+		s     *meta.Store
+		racks = make(map[string]int)
+	)
+	if s, ok = d.store[id]; ok {
+		return s.Rack
+	}
+	for _, s = range d.store {
+		racks[s.Rack]++
+	}
+	for _, r = range d.config.Register.Racks {
+		if rack == "" || racks[r] < n {
+			rack, n = r, racks[r]
+		}
+	}
+	return
+}
+
+// registerGroup get a group which isn't full and has no store in the same
+// failure domain, or a new group.
+func (d *Directory) registerGroup(group map[int][]string, s *meta.Store) int {
+	var (
+		max    int
+		gid    int
+		gids   []int
+		stores []string
+		store  = map[string]*meta.Store{s.Id: s}
+		domain = d.placementDomain()
+	)
+	if domain == "" {
+		domain = domainRack
+	}
+	for _, ss := range d.store {
+		if ss.Id != s.Id {
+			store[ss.Id] = ss
+		}
+	}
+	for gid = range group {
+		gids = append(gids, gid)
+		if gid > max {
+			max = gid
+		}
+	}
+	sort.Ints(gids)
+	for _, gid = range gids {
+		if stores = group[gid]; len(stores) >= d.config.Register.GroupSize {
+			continue
+		}
+		// copy, never append to the backing array of the group
+		if conflict(domain, append(append([]string(nil), stores...), s.Id), store) == "" {
+			return gid
+		}
+	}
+	return max + 1
+}
+
+type int32s []int32
+
+func (s int32s) Len() int           { return len(s) }
+func (s int32s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/reqid"
+	"bfs/libs/rpc"
+	"bfs/libs/trace"
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errRpcParam = status.Error(codes.InvalidArgument, errors.ErrParam.Error())
+)
+
+// rpcServer the grpc api, the same as the http api.
+type rpcServer struct {
+	d *Directory
+}
+
+// StartRpc start grpc api listen.
+func StartRpc(addr string, d *Directory) (err error) {
+	var (
+		l net.Listener
+		s = grpc.NewServer(grpc.ChainUnaryInterceptor(trace.UnaryServer, reqid.UnaryServer),
+			grpc.ChainStreamInterceptor(trace.StreamServer, reqid.StreamServer))
+	)
+	if l, err = net.Listen("tcp", addr); err != nil {
+		log.Errorf("net.Listen(\"%s\") error(%v)", addr, err)
+		return
+	}
+	rpc.RegisterDirectoryServer(s, &rpcServer{d: d})
+	go func() {
+		if err := s.Serve(l); err != nil {
+			log.Errorf("grpc.Serve(\"%s\") error(%v)", addr, err)
+		}
+	}()
+	return
+}
+
+// rpcLog log the request like the http api.
+func rpcLog(method string, in interface{}, start time.Time, res *meta.Response) {
+	log.Infof("RPC method:%s(params:%+v,time:%f,ret:%v)", method, in,
+		time.Now().Sub(start).Seconds(), res.Ret)
+}
+
+// rpcFile check the bucket and filename of the request.
+func rpcFile(ctx context.Context, bucket, filename string) (err error) {
+	// the caller gave up, no need to touch hbase
+	if err = ctx.Err(); err != nil {
+		err = status.FromContextError(err).Err()
+		return
+	}
+	if bucket == "" || filename == "" {
+		err = errRpcParam
+	}
+	return
+}
+
+func (s *rpcServer) Get(ctx context.Context, in *rpc.GetRequest) (res *meta.Response, err error) {
+	if err = rpcFile(ctx, in.Bucket, in.Filename); err != nil {
+		return
+	}
+	res = new(meta.Response)
+	defer rpcLog("Get", in, time.Now(), res)
+	getFile(s.d, in.Bucket, in.Filename, in.Region, res)
+	return
+}
+
+func (s *rpcServer) Upload(ctx context.Context, in *rpc.UploadRequest) (res *meta.Response, err error) {
+	if err = rpcFile(ctx, in.Bucket, in.Filename); err != nil {
+		return
+	}
+	if in.Sha1 == "" || in.Mine == "" || in.Size < 0 {
+		err = errRpcParam
+		return
+	}
+	res = new(meta.Response)
+	defer rpcLog("Upload", in, time.Now(), res)
+	uploadFile(s.d, in.Bucket, &meta.File{Filename: in.Filename, Sha1: in.Sha1, Mine: in.Mine, MTime: in.MTime, Size: in.Size, Name: in.Name}, res)
+	return
+}
+
+func (s *rpcServer) Del(ctx context.Context, in *rpc.GetRequest) (res *meta.Response, err error) {
+	if err = rpcFile(ctx, in.Bucket, in.Filename); err != nil {
+		return
+	}
+	res = new(meta.Response)
+	defer rpcLog("Del", in, time.Now(), res)
+	delFile(s.d, in.Bucket, in.Filename, res)
+	return
+}
+
+// Gets reply every get request of the stream in order, a bad request gets
+// a RetParamErr response instead of breaking the stream, the stream ends
+// when the deadline exceeded.
+func (s *rpcServer) Gets(stream rpc.Directory_GetsServer) (err error) {
+	var (
+		in  *rpc.GetRequest
+		res *meta.Response
+	)
+	for {
+		if in, err = stream.Recv(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if res, err = s.Get(stream.Context(), in); err != nil {
+			if err != errRpcParam {
+				return
+			}
+			res = &meta.Response{Ret: errors.RetParamErr}
+		}
+		res.Filename = in.Filename
+		if err = stream.Send(res); err != nil {
+			return
+		}
+	}
+}
+
+// Uploads reply every upload request of the stream in order.
+func (s *rpcServer) Uploads(stream rpc.Directory_UploadsServer) (err error) {
+	var (
+		in  *rpc.UploadRequest
+		res *meta.Response
+	)
+	for {
+		if in, err = stream.Recv(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if res, err = s.Upload(stream.Context(), in); err != nil {
+			if err != errRpcParam {
+				return
+			}
+			res = &meta.Response{Ret: errors.RetParamErr}
+		}
+		res.Filename = in.Filename
+		if err = stream.Send(res); err != nil {
+			return
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	log "github.com/golang/glog"
 	"os"
 	"os/signal"
 	"syscall"
+
+	"bfs/libs/log"
 )
 
 // StartSignal register signals handler.
@@ -2,8 +2,9 @@ package snowflake
 
 import (
 	"errors"
-	log "github.com/golang/glog"
 	"time"
+
+	"bfs/libs/log"
 )
 
 const (
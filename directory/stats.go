@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bfs/libs/meta"
+	"sort"
+	"time"
+)
+
+const (
+	// group health
+	groupHealthy  = "healthy"  // all stores read & write
+	groupReadOnly = "readonly" // all stores read, some can't write
+	groupDegraded = "degraded" // some stores can't read
+	groupDown     = "down"     // no store can read
+
+	volumeBytes = uint64(meta.MaxBlockOffset) * meta.BlockPadding
+
+	defaultNearFull = 0.9
+)
+
+// ClusterStats the cluster summary aggregated from the store heartbeats
+// (zookeeper), capacity counts every volume once whatever the replicas.
+type ClusterStats struct {
+	Ret          int            `json:"ret"`
+	Stores       int            `json:"stores"`
+	StoresDown   []string       `json:"stores_down"`
+	StoresRO     []string       `json:"stores_readonly"`
+	StoresSlow   []string       `json:"stores_degraded"`
+	Volumes      int            `json:"volumes"`
+	VolumesFull  []int32        `json:"volumes_near_full"`
+	Capacity     uint64         `json:"capacity"`
+	Free         uint64         `json:"free"`
+	WriteTPS     uint64         `json:"write_tps"`
+	Groups       []*GroupStats  `json:"groups"`
+	GroupsHealth map[string]int `json:"groups_health"`
+	// zookeeper unavailable, the snapshot is SyncAge seconds old
+	Degraded bool    `json:"degraded"`
+	SyncAge  float64 `json:"sync_age"`
+	// the api requests slower than the SlowLog
+	SlowRequests uint64 `json:"slow_requests"`
+}
+
+// GroupStats the summary of a group.
+type GroupStats struct {
+	Group    int      `json:"group"`
+	Health   string   `json:"health"`
+	Stores   []string `json:"stores"`
+	Volumes  int      `json:"volumes"`
+	Capacity uint64   `json:"capacity"`
+	Free     uint64   `json:"free"`
+}
+
+// Stats aggregate the cluster stats, the volumes whose used ratio is above
+// nearFull are reported.
+func (d *Directory) Stats(nearFull float64) (s *ClusterStats) {
+	var (
+		ok          bool
+		gid         int
+		sid         string
+		vid         int32
+		gids        []int
+		sids        []string
+		stores      []string
+		svrs        []string
+		free        uint64
+		age         time.Duration
+		g           *GroupStats
+		vs          *meta.VolumeState
+		storeMeta   *meta.Store
+		store       = d.store
+		group       = d.group
+		volume      = d.volume
+		volumeStore = d.volumeStore
+		storeGroup  = d.storeGroup
+		groups      = make(map[int]*GroupStats, len(group))
+	)
+	s = &ClusterStats{GroupsHealth: make(map[string]int)}
+	s.Degraded, age = d.Degraded()
+	s.SyncAge = age.Seconds()
+	s.Stores = len(store)
+	for sid = range store {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	for _, sid = range sids {
+		if storeMeta = store[sid]; !storeMeta.CanRead() {
+			s.StoresDown = append(s.StoresDown, sid)
+		} else if !storeMeta.CanWrite() {
+			s.StoresRO = append(s.StoresRO, sid)
+		}
+		if storeMeta.Degraded {
+			s.StoresSlow = append(s.StoresSlow, sid)
+		}
+	}
+	for gid, stores = range group {
+		g = &GroupStats{Group: gid, Stores: stores, Health: groupHealth(stores, store)}
+		groups[gid] = g
+		gids = append(gids, gid)
+		s.GroupsHealth[g.Health]++
+	}
+	sort.Ints(gids)
+	for vid, vs = range volume {
+		free = uint64(vs.FreeSpace) * meta.BlockPadding
+		s.Volumes++
+		s.Capacity += volumeBytes
+		s.Free += free
+		s.WriteTPS += vs.WriteTPS
+		if float64(volumeBytes-free) > nearFull*float64(volumeBytes) {
+			s.VolumesFull = append(s.VolumesFull, vid)
+		}
+		if svrs = volumeStore[vid]; len(svrs) == 0 {
+			continue
+		}
+		if gid, ok = storeGroup[svrs[0]]; !ok {
+			continue
+		}
+		if g, ok = groups[gid]; ok {
+			g.Volumes++
+			g.Capacity += volumeBytes
+			g.Free += free
+		}
+	}
+	sort.Sort(int32s(s.VolumesFull))
+	for _, gid = range gids {
+		s.Groups = append(s.Groups, groups[gid])
+	}
+	return
+}
+
+// groupHealth get the health of the group by the stores status.
+func groupHealth(stores []string, store map[string]*meta.Store) string {
+	var (
+		ok        bool
+		sid       string
+		read      int
+		write     int
+		storeMeta *meta.Store
+	)
+	for _, sid = range stores {
+		if storeMeta, ok = store[sid]; !ok || storeMeta == nil {
+			continue
+		}
+		if storeMeta.CanRead() {
+			read++
+		}
+		if storeMeta.CanWrite() {
+			write++
+		}
+	}
+	switch {
+	case read == 0:
+		return groupDown
+	case read < len(stores):
+		return groupDegraded
+	case write < len(stores):
+		return groupReadOnly
+	}
+	return groupHealthy
+}
+
+// Topology get the stores, groups and volumes of the last synced snapshot,
+// the volumes of a group are ordered by id.
+func (d *Directory) Topology() (t *meta.Topology) {
+	var (
+		ok          bool
+		gid         int
+		sid         string
+		vid         int32
+		gids        []int
+		stores      []string
+		svrs        []string
+		g           *meta.TopologyGroup
+		vs          *meta.VolumeState
+		store       = d.store
+		group       = d.group
+		volume      = d.volume
+		volumeStore = d.volumeStore
+		storeGroup  = d.storeGroup
+		groups      = make(map[int]*meta.TopologyGroup, len(group))
+	)
+	t = &meta.Topology{VolumeBytes: volumeBytes}
+	for sid = range store {
+		t.Stores = append(t.Stores, store[sid])
+	}
+	sort.Sort(meta.StoreList(t.Stores))
+	for gid, stores = range group {
+		groups[gid] = &meta.TopologyGroup{Group: gid, Stores: stores}
+		gids = append(gids, gid)
+	}
+	sort.Ints(gids)
+	for vid, vs = range volume {
+		if svrs = volumeStore[vid]; len(svrs) == 0 {
+			continue
+		}
+		if gid, ok = storeGroup[svrs[0]]; !ok {
+			continue
+		}
+		if g, ok = groups[gid]; ok {
+			g.Volumes = append(g.Volumes, &meta.TopologyVolume{Id: vid, Used: volumeBytes - uint64(vs.FreeSpace)*meta.BlockPadding})
+		}
+	}
+	for _, gid = range gids {
+		g = groups[gid]
+		sort.Slice(g.Volumes, func(i, j int) bool { return g.Volumes[i].Id < g.Volumes[j].Id })
+		t.Groups = append(t.Groups, g)
+	}
+	return
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bfs/directory/conf"
+	"bfs/directory/hbase"
+	"bfs/directory/hbase/hbasethrift"
+	"bfs/libs/meta"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// fakeColumn the family and the qualifier of a column.
+type fakeColumn struct {
+	family    string
+	qualifier string
+}
+
+// fakeHBase an in-memory hbase, only the calls of the directory are
+// implemented.
+type fakeHBase struct {
+	lock   sync.Mutex
+	tables map[string]map[string]map[fakeColumn][]byte // table:row:column:value
+}
+
+func newFakeHBase() *fakeHBase {
+	return &fakeHBase{tables: make(map[string]map[string]map[fakeColumn][]byte)}
+}
+
+var errNotImplemented = errors.New("not implemented")
+
+// match check the column is one of the columns, any if no columns.
+func match(c fakeColumn, columns []*hbasethrift.TColumn) bool {
+	if len(columns) == 0 {
+		return true
+	}
+	for _, tc := range columns {
+		if c.family == string(tc.Family) && (tc.Qualifier == nil || c.qualifier == string(tc.Qualifier)) {
+			return true
+		}
+	}
+	return false
+}
+
+// result get the columns of the row in order.
+func (h *fakeHBase) result(row string, cs map[fakeColumn][]byte, columns []*hbasethrift.TColumn) (r *hbasethrift.TResult_) {
+	r = &hbasethrift.TResult_{Row: []byte(row), ColumnValues: []*hbasethrift.TColumnValue{}}
+	for c, v := range cs {
+		if match(c, columns) {
+			r.ColumnValues = append(r.ColumnValues, &hbasethrift.TColumnValue{Family: []byte(c.family), Qualifier: []byte(c.qualifier), Value: v})
+		}
+	}
+	sort.Slice(r.ColumnValues, func(i, j int) bool {
+		if c := bytes.Compare(r.ColumnValues[i].Family, r.ColumnValues[j].Family); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(r.ColumnValues[i].Qualifier, r.ColumnValues[j].Qualifier) < 0
+	})
+	return
+}
+
+func (h *fakeHBase) row(table []byte, row []byte, create bool) (cs map[fakeColumn][]byte) {
+	var rows = h.tables[string(table)]
+	if rows == nil {
+		if !create {
+			return nil
+		}
+		rows = make(map[string]map[fakeColumn][]byte)
+		h.tables[string(table)] = rows
+	}
+	if cs = rows[string(row)]; cs == nil && create {
+		cs = make(map[fakeColumn][]byte)
+		rows[string(row)] = cs
+	}
+	return
+}
+
+// check check the column has the value, absent if value is nil.
+func (h *fakeHBase) check(table, row, family, qualifier, value []byte) bool {
+	var (
+		ok bool
+		v  []byte
+	)
+	v, ok = h.row(table, row, false)[fakeColumn{string(family), string(qualifier)}]
+	if value == nil {
+		return !ok
+	}
+	return ok && bytes.Equal(v, value)
+}
+
+func (h *fakeHBase) put(table []byte, tput *hbasethrift.TPut) {
+	var cs = h.row(table, tput.Row, true)
+	for _, cv := range tput.ColumnValues {
+		cs[fakeColumn{string(cv.Family), string(cv.Qualifier)}] = append([]byte(nil), cv.Value...)
+	}
+}
+
+func (h *fakeHBase) del(table []byte, tdelete *hbasethrift.TDelete) {
+	var cs = h.row(table, tdelete.Row, false)
+	for c := range cs {
+		if match(c, tdelete.Columns) {
+			delete(cs, c)
+		}
+	}
+	if len(cs) == 0 {
+		delete(h.tables[string(table)], string(tdelete.Row))
+	}
+}
+
+func (h *fakeHBase) Exists(table []byte, tget *hbasethrift.TGet) (r bool, err error) {
+	h.lock.Lock()
+	r = len(h.result(string(tget.Row), h.row(table, tget.Row, false), tget.Columns).ColumnValues) > 0
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) Get(table []byte, tget *hbasethrift.TGet) (r *hbasethrift.TResult_, err error) {
+	h.lock.Lock()
+	r = h.result(string(tget.Row), h.row(table, tget.Row, false), tget.Columns)
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) GetMultiple(table []byte, tgets []*hbasethrift.TGet) (r []*hbasethrift.TResult_, err error) {
+	return nil, errNotImplemented
+}
+
+func (h *fakeHBase) Put(table []byte, tput *hbasethrift.TPut) (err error) {
+	h.lock.Lock()
+	h.put(table, tput)
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) CheckAndPut(table []byte, row []byte, family []byte, qualifier []byte, value []byte, tput *hbasethrift.TPut) (r bool, err error) {
+	h.lock.Lock()
+	if r = h.check(table, row, family, qualifier, value); r {
+		h.put(table, tput)
+	}
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) PutMultiple(table []byte, tputs []*hbasethrift.TPut) (err error) {
+	return errNotImplemented
+}
+
+func (h *fakeHBase) DeleteSingle(table []byte, tdelete *hbasethrift.TDelete) (err error) {
+	h.lock.Lock()
+	h.del(table, tdelete)
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) DeleteMultiple(table []byte, tdeletes []*hbasethrift.TDelete) (r []*hbasethrift.TDelete, err error) {
+	return nil, errNotImplemented
+}
+
+func (h *fakeHBase) CheckAndDelete(table []byte, row []byte, family []byte, qualifier []byte, value []byte, tdelete *hbasethrift.TDelete) (r bool, err error) {
+	h.lock.Lock()
+	if r = h.check(table, row, family, qualifier, value); r {
+		h.del(table, tdelete)
+	}
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) Increment(table []byte, tincrement *hbasethrift.TIncrement) (r *hbasethrift.TResult_, err error) {
+	var (
+		c  fakeColumn
+		v  []byte
+		cs map[fakeColumn][]byte
+	)
+	h.lock.Lock()
+	cs = h.row(table, tincrement.Row, true)
+	r = &hbasethrift.TResult_{Row: tincrement.Row}
+	for _, ci := range tincrement.Columns {
+		c = fakeColumn{string(ci.Family), string(ci.Qualifier)}
+		if v = cs[c]; len(v) != 8 {
+			v = make([]byte, 8)
+		}
+		binary.BigEndian.PutUint64(v, binary.BigEndian.Uint64(v)+uint64(ci.Amount))
+		cs[c] = v
+		r.ColumnValues = append(r.ColumnValues, &hbasethrift.TColumnValue{Family: ci.Family, Qualifier: ci.Qualifier, Value: append([]byte(nil), v...)})
+	}
+	h.lock.Unlock()
+	return
+}
+
+func (h *fakeHBase) Append(table []byte, tappend *hbasethrift.TAppend) (r *hbasethrift.TResult_, err error) {
+	return nil, errNotImplemented
+}
+
+func (h *fakeHBase) OpenScanner(table []byte, tscan *hbasethrift.TScan) (r int32, err error) {
+	return 0, errNotImplemented
+}
+
+func (h *fakeHBase) GetScannerRows(scannerId int32, numRows int32) (r []*hbasethrift.TResult_, err error) {
+	return nil, errNotImplemented
+}
+
+func (h *fakeHBase) CloseScanner(scannerId int32) (err error) {
+	return errNotImplemented
+}
+
+func (h *fakeHBase) MutateRow(table []byte, trowMutations *hbasethrift.TRowMutations) (err error) {
+	return errNotImplemented
+}
+
+func (h *fakeHBase) GetScannerResults(table []byte, tscan *hbasethrift.TScan, numRows int32) (r []*hbasethrift.TResult_, err error) {
+	var (
+		row  string
+		rows []string
+		tr   *hbasethrift.TResult_
+	)
+	h.lock.Lock()
+	for row = range h.tables[string(table)] {
+		if row >= string(tscan.StartRow) && (len(tscan.StopRow) == 0 || row < string(tscan.StopRow)) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Strings(rows)
+	for _, row = range rows {
+		if len(r) == int(numRows) {
+			break
+		}
+		if tr = h.result(row, h.tables[string(table)][row], tscan.Columns); len(tr.ColumnValues) > 0 {
+			r = append(r, tr)
+		}
+	}
+	h.lock.Unlock()
+	return
+}
+
+// rows get the number of the rows of the table with the prefix.
+func (h *fakeHBase) rows(table, prefix string) (n int) {
+	h.lock.Lock()
+	for row := range h.tables[table] {
+		if len(row) >= len(prefix) && row[:len(prefix)] == prefix {
+			n++
+		}
+	}
+	h.lock.Unlock()
+	return
+}
+
+// testKeyer generate the keys in order.
+type testKeyer struct {
+	lock sync.Mutex
+	key  int64
+}
+
+func (k *testKeyer) Getkey() (key int64, err error) {
+	k.lock.Lock()
+	k.key++
+	key = k.key
+	k.lock.Unlock()
+	return
+}
+
+// newTestDirectory new a directory of a writable store of one volume on the
+// in-memory hbase, the buckets are managed if any.
+func newTestDirectory(bs ...*meta.Bucket) (d *Directory, h *fakeHBase) {
+	var (
+		config = &conf.Config{
+			Zookeeper:  &conf.Zookeeper{},
+			Dispatcher: &conf.Dispatcher{Policy: PolicyRoundRobin},
+			Quota:      &conf.Quota{},
+		}
+		store = map[string]*meta.Store{
+			"s1": &meta.Store{Id: "s1", Rack: "rack-a", Api: "localhost:6062", Status: meta.StoreStatusHealth},
+		}
+		volume = map[int32]*meta.VolumeState{
+			1: &meta.VolumeState{FreeSpace: 1024},
+		}
+	)
+	if len(bs) > 0 {
+		config.Zookeeper.BucketRoot = "/bucket"
+	}
+	h = newFakeHBase()
+	hbase.InitService(h)
+	d = &Directory{config: config, genkey: &testKeyer{}}
+	d.hBase = hbase.NewHBaseClient()
+	d.dispatcher = NewDispatcher(config)
+	d.quota = NewQuota(config, d.hBase)
+	d.store, d.storeVolume = store, map[string][]int32{"s1": []int32{1}}
+	d.group, d.storeGroup = map[int][]string{1: []string{"s1"}}, map[string]int{"s1": 1}
+	d.volume, d.volumeStore = volume, map[int32][]string{1: []string{"s1"}}
+	d.dispatcher.Update(d.group, d.store, d.volume, d.storeVolume)
+	d.setBuckets(bs)
+	return
+}
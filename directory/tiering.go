@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"time"
+)
+
+// tieringproc move the cold needles to the groups of the To labels every
+// interval, the directory must be the only one running it.
+func (d *Directory) tieringproc() {
+	for {
+		time.Sleep(d.config.Tiering.Interval.Duration)
+		if d.writable() != nil {
+			continue
+		}
+		d.tier()
+	}
+}
+
+// tier move the cold needles of the volumes of the groups of the From labels,
+// a needle is cold only if cold on all the readable replicas.
+func (d *Directory) tier() {
+	var (
+		err    error
+		gid    int
+		vid    int32
+		key    int64
+		keys   []int64
+		to     []string
+		stores []string
+		bs     []*meta.Bucket
+		c      = d.config.Tiering
+	)
+	if d.config.Zookeeper.BucketRoot != "" {
+		// the pins of the buckets must be kept
+		if bs, err = d.Buckets(); err != nil {
+			log.Errorf("Buckets() error(%v)", err)
+			return
+		}
+	}
+	for gid, stores = range d.group {
+		if !d.tierFrom(stores) {
+			continue
+		}
+		if to = tierTo(c.To, groupLabels(stores, d.store), bs); !d.dispatcher.Labeled(to) {
+			log.Warningf("tiering group: %d no writable group of the labels: %v", gid, to)
+			continue
+		}
+		for _, vid = range d.storeVolume[stores[0]] {
+			if d.dispatcher.probes[vid] {
+				continue
+			}
+			if keys, err = d.cold(vid); err != nil {
+				continue
+			}
+			for _, key = range keys {
+				d.tierNeedle(vid, key, to)
+			}
+		}
+	}
+}
+
+// tierFrom check all the stores of the group have the From labels.
+func (d *Directory) tierFrom(stores []string) bool {
+	var (
+		ok     bool
+		sid    string
+		label  string
+		labels []string
+	)
+	if len(stores) == 0 {
+		return false
+	}
+	for _, sid = range stores {
+		if _, ok = d.store[sid]; !ok {
+			return false
+		}
+	}
+	labels = groupLabels(stores, d.store)
+	for _, label = range d.config.Tiering.From {
+		if !hasLabel(labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// tierTo get the labels of the groups moved to, the To labels and the labels
+// of all the buckets which may be pinned to the group of the labels, so the
+// needles of a pinned bucket never leave its labels.
+func tierTo(to, labels []string, bs []*meta.Bucket) (ls []string) {
+	var (
+		ok    bool
+		label string
+		b     *meta.Bucket
+	)
+	ls = append(ls, to...)
+	for _, b = range bs {
+		if len(b.Labels) == 0 {
+			continue
+		}
+		ok = true
+		for _, label = range b.Labels {
+			if !hasLabel(labels, label) {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		for _, label = range b.Labels {
+			if !hasLabel(ls, label) {
+				ls = append(ls, label)
+			}
+		}
+	}
+	return
+}
+
+// cold list the cold keys of the volume on all its readable replicas, the
+// access times are of the reads each replica served.
+func (d *Directory) cold(vid int32) (keys []int64, err error) {
+	var (
+		ok    bool
+		first = true
+		sid   string
+		ks    []int64
+		s     *meta.Store
+		c     = d.config.Tiering
+	)
+	for _, sid = range d.volumeStore[vid] {
+		if s, ok = d.store[sid]; !ok || !s.CanRead() {
+			continue
+		}
+		if ks, err = s.Cold(vid, c.Age.Duration, c.Batch); err != nil {
+			log.Errorf("store: %s Cold(%d) error(%v)", sid, vid, err)
+			return nil, err
+		}
+		if first {
+			keys, first = ks, false
+		} else {
+			keys = intersectKeys(keys, ks)
+		}
+		if len(keys) == 0 {
+			return
+		}
+	}
+	return
+}
+
+// intersectKeys get the keys in both a and b.
+func intersectKeys(a, b []int64) (keys []int64) {
+	var (
+		key int64
+		in  = make(map[int64]struct{}, len(b))
+	)
+	for _, key = range b {
+		in[key] = struct{}{}
+	}
+	for _, key = range a {
+		if _, ok := in[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// tierNeedle copy the needle of the volume to a volume of the labels, then
+// switch it in hbase. the old copy is still read by the cached lookups, it's
+// deleted when listed cold again, after the caches expired.
+func (d *Directory) tierNeedle(vid int32, key int64, to []string) {
+	var (
+		err   error
+		moved bool
+		nvid  int32
+		data  []byte
+		n     *meta.Needle
+	)
+	if n, err = d.hBase.Needle(key); err != nil {
+		// the file deleted, the stores failed then, left as it was
+		if err != errors.ErrNeedleNotExist {
+			log.Errorf("hBase.Needle(%d) error(%v)", key, err)
+		}
+		return
+	}
+	if n.Vid != vid {
+		// moved before, the old copy left
+		d.delNeedle(&meta.Needle{Key: key, Vid: vid})
+		log.Infof("tiering del needle: %d volume: %d, moved to volume: %d", key, vid, n.Vid)
+		return
+	}
+	if data, err = d.readNeedle(n); err != nil {
+		return
+	}
+	if nvid, err = d.dispatcher.VolumeId(d.group, d.storeVolume, to); err != nil {
+		log.Errorf("dispatcher.VolumeId(%v) error(%v)", to, err)
+		return
+	}
+	if nvid == vid {
+		return
+	}
+	if err = d.writeNeedle(nvid, n, data); err == nil {
+		// the needle may be deleted or moved meanwhile
+		if moved, err = d.hBase.Move(n, nvid); err != nil {
+			log.Errorf("hBase.Move(%d, %d) error(%v)", key, nvid, err)
+		}
+	}
+	if !moved {
+		d.delNeedle(&meta.Needle{Key: key, Vid: nvid})
+		return
+	}
+	log.Infof("tiering move needle: %d volume: %d to volume: %d", key, vid, nvid)
+}
+
+// readNeedle read the needle from any readable store of its volume.
+func (d *Directory) readNeedle(n *meta.Needle) (data []byte, err error) {
+	var (
+		ok  bool
+		sid string
+		s   *meta.Store
+	)
+	err = errors.ErrStoreNotAvailable
+	for _, sid = range d.volumeStore[n.Vid] {
+		if s, ok = d.store[sid]; !ok || !s.CanRead() {
+			continue
+		}
+		if data, err = s.Read(n.Vid, n.Key, n.Cookie); err == nil {
+			return
+		}
+		log.Errorf("store: %s Read(%d, %d) error(%v)", sid, n.Vid, n.Key, err)
+	}
+	return
+}
+
+// writeNeedle write the needle to all the stores of the volume.
+func (d *Directory) writeNeedle(vid int32, n *meta.Needle, data []byte) (err error) {
+	var (
+		ok  bool
+		sid string
+		s   *meta.Store
+	)
+	if len(d.volumeStore[vid]) == 0 {
+		return errors.ErrZookeeperDataError
+	}
+	for _, sid = range d.volumeStore[vid] {
+		if s, ok = d.store[sid]; !ok {
+			return errors.ErrZookeeperDataError
+		}
+		if err = s.Write(vid, n.Key, n.Cookie, data); err != nil {
+			log.Errorf("store: %s Write(%d, %d) error(%v)", sid, vid, n.Key, err)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bfs/directory/hbase"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	_trashInterval = time.Minute
+	_trashBatch    = 1000
+	_storeDelApi   = "http://%s/del"
+)
+
+var (
+	_storeClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// trash get the seconds the deleted files of the bucket are kept in the
+// trash, 0 if deleted at once or the buckets are not managed.
+func (d *Directory) trash(bucket string) int64 {
+	var (
+		err error
+		b   *meta.Bucket
+	)
+	if d.config.Zookeeper.BucketRoot == "" {
+		return 0
+	}
+	if b, err = d.lookupBucket(bucket); err != nil {
+		return 0
+	}
+	return b.Trash
+}
+
+// Undelete put the file deleted from the soft delete bucket back, the latest
+// deleted one if key is 0. ErrFileExist if a file of the filename is
+// uploaded after deleted.
+func (d *Directory) Undelete(bucket, filename string, key int64) (t *meta.TrashFile, err error) {
+	if err = d.writable(); err != nil {
+		return
+	}
+	if key == 0 {
+		t, err = d.lastTrash(bucket, filename)
+	} else {
+		t, err = d.hBase.GetTrash(bucket, filename, key)
+	}
+	if err == nil {
+		err = d.hBase.Undelete(t)
+	}
+	if err != nil {
+		if err == errors.ErrNeedleExist {
+			err = errors.ErrFileExist
+		} else if err != errors.ErrNeedleNotExist {
+			log.Errorf("hBase.Undelete(%s, %s, %d) error(%v)", bucket, filename, key, err)
+			err = errors.ErrHBase
+		}
+		return
+	}
+	d.fileCache.Del(fileKey(bucket, filename))
+	d.quota.Add(bucket, t.Size, 1)
+	log.Infof("undelete bucket: %s file: %s key: %d", bucket, filename, t.Key)
+	return
+}
+
+// lastTrash get the latest deleted file of the filename in the trash.
+func (d *Directory) lastTrash(bucket, filename string) (t *meta.TrashFile, err error) {
+	var (
+		prefix = hbase.TrashPrefix(bucket) + filename + "@"
+		ts     []*meta.TrashFile
+	)
+	// the filenames with "@" share the prefix
+	if ts, err = d.hBase.TrashScan([]byte(prefix), prefixEnd(prefix), _trashBatch); err != nil {
+		return
+	}
+	for _, tf := range ts {
+		if tf.Filename == filename && (t == nil || tf.Expire > t.Expire) {
+			t = tf
+		}
+	}
+	if t == nil {
+		err = errors.ErrNeedleNotExist
+	}
+	return
+}
+
+// Trash list at most limit deleted files of the bucket in the trash in the
+// filename order after the marker, marker is set to the last one if there
+// may be more.
+func (d *Directory) Trash(bucket, marker string, limit int) (l *meta.Trash, err error) {
+	var (
+		prefix = hbase.TrashPrefix(bucket)
+		start  = []byte(prefix)
+	)
+	if err = d.readable(); err != nil {
+		return
+	}
+	if marker != "" {
+		start = append([]byte(prefix+marker), 0)
+	}
+	l = &meta.Trash{}
+	if l.Files, err = d.hBase.TrashScan(start, prefixEnd(prefix), limit); err != nil {
+		log.Errorf("hBase.TrashScan(%s) error(%v)", start, err)
+		err = errors.ErrHBase
+		return
+	}
+	if len(l.Files) == limit {
+		l.Marker = fmt.Sprintf("%s@%d", l.Files[limit-1].Filename, l.Files[limit-1].Key)
+	}
+	return
+}
+
+// trashproc purge the expired files of the trash for ever, every directory
+// runs it, a file is purged by only one of them.
+func (d *Directory) trashproc() {
+	var (
+		interval = _trashInterval
+		batch    = _trashBatch
+	)
+	if d.config.Trash != nil {
+		interval, batch = d.config.Trash.Interval.Duration, d.config.Trash.Batch
+	}
+	for {
+		time.Sleep(interval)
+		if d.writable() != nil {
+			continue
+		}
+		d.purgeTrash(batch)
+	}
+}
+
+// purgeTrash scan all the trash and purge the expired files, the needle of
+// the last reference is deleted from its stores.
+func (d *Directory) purgeTrash(batch int) {
+	var (
+		err    error
+		now    = time.Now().Unix()
+		prefix = hbase.TrashPrefix("")
+		start  = []byte(prefix)
+		stop   = prefixEnd(prefix)
+		ts     []*meta.TrashFile
+		t      *meta.TrashFile
+		n      *meta.Needle
+	)
+	for {
+		if ts, err = d.hBase.TrashScan(start, stop, batch); err != nil {
+			log.Errorf("hBase.TrashScan(%s) error(%v)", start, err)
+			return
+		}
+		for _, t = range ts {
+			if t.Expire > now {
+				continue
+			}
+			if n, err = d.hBase.Purge(t); err != nil {
+				if err != errors.ErrNeedleNotExist {
+					log.Errorf("hBase.Purge(%s, %s, %d) error(%v)", t.Bucket, t.Filename, t.Key, err)
+				}
+				continue
+			}
+			log.Infof("purge bucket: %s file: %s key: %d", t.Bucket, t.Filename, t.Key)
+			if n != nil {
+				d.delNeedle(n)
+			}
+		}
+		if len(ts) < batch {
+			return
+		}
+		t = ts[len(ts)-1]
+		start = append(hbase.TrashRow(t.Bucket, t.Filename, t.Key), 0)
+	}
+}
+
+// delNeedle del the needle from all the stores of its volume, the failed
+// ones are only logged, the needle is never read again.
+func (d *Directory) delNeedle(n *meta.Needle) {
+	var (
+		ok     bool
+		err    error
+		id     string
+		uri    string
+		s      *meta.Store
+		resp   *http.Response
+		sRet   meta.StoreRet
+		params = url.Values{}
+	)
+	params.Set("key", strconv.FormatInt(n.Key, 10))
+	params.Set("vid", strconv.FormatInt(int64(n.Vid), 10))
+	for _, id = range d.volumeStore[n.Vid] {
+		if s, ok = d.store[id]; !ok {
+			log.Errorf("del needle: %d store: %s not found", n.Key, id)
+			continue
+		}
+		uri = fmt.Sprintf(_storeDelApi, s.Api)
+		sRet = meta.StoreRet{}
+		if resp, err = _storeClient.PostForm(uri, params); err != nil {
+			log.Errorf("http.PostForm(%s) error(%v)", uri, err)
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(&sRet)
+		resp.Body.Close()
+		if err != nil || sRet.Ret != errors.RetOK {
+			log.Errorf("del needle: %d store: %s ret: %d error(%v)", n.Key, uri, sRet.Ret, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bfs/directory/hbase"
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+	"testing"
+	"time"
+)
+
+func TestTrashAgain(t *testing.T) {
+	var (
+		err    error
+		d      *Directory
+		h      *fakeHBase
+		n      *meta.Needle
+		stores []string
+		ts     []*meta.TrashFile
+	)
+	d, h = newTestDirectory(&meta.Bucket{Name: "test", Dedup: true, Trash: 3600})
+	for i, c := range []struct {
+		name string
+		del  bool
+		err  error
+	}{
+		{"upload", false, nil},
+		{"trash", true, nil},
+		{"upload again to the dedup needle", false, errors.ErrFileDedup},
+		{"trash again", true, nil},
+	} {
+		if c.del {
+			_, stores, err = d.DelStores("test", "1.jpg")
+		} else {
+			_, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10})
+		}
+		if err != c.err || len(stores) != 0 {
+			t.Errorf("%d %s: stores: %v error(%v), want(%v)", i, c.name, stores, err, c.err)
+			t.FailNow()
+		}
+	}
+	if ts, err = d.hBase.TrashScan([]byte(hbase.TrashPrefix("test")), nil, 10); err != nil || len(ts) != 1 {
+		t.Errorf("TrashScan() trash: %d error(%v), want one", len(ts), err)
+		t.FailNow()
+	}
+	// the last reference purged
+	if n, err = d.hBase.Purge(ts[0]); err != nil || n == nil {
+		t.Errorf("Purge() needle: %v error(%v)", n, err)
+		t.FailNow()
+	}
+	if _, err = d.hBase.Needle(n.Key); err != errors.ErrNeedleNotExist {
+		t.Errorf("needle: %d not deleted, error(%v)", n.Key, err)
+		t.FailNow()
+	}
+	if rows := h.rows("bfsmeta", "dedup_"); rows != 0 {
+		t.Errorf("%d dedup rows left", rows)
+		t.FailNow()
+	}
+}
+
+func TestTrashUndelete(t *testing.T) {
+	var (
+		err error
+		d   *Directory
+		tf  *meta.TrashFile
+		l   *meta.Trash
+		f   *meta.File
+	)
+	d, _ = newTestDirectory(&meta.Bucket{Name: "test", Trash: 3600})
+	if _, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "a", Size: 10}); err != nil {
+		t.Errorf("UploadStores() error(%v)", err)
+		t.FailNow()
+	}
+	if _, _, err = d.DelStores("test", "1.jpg"); err != nil {
+		t.Errorf("DelStores() error(%v)", err)
+		t.FailNow()
+	}
+	if _, _, _, err = d.GetStores("test", "1.jpg"); err != errors.ErrNeedleNotExist {
+		t.Errorf("GetStores() trashed file error(%v)", err)
+		t.FailNow()
+	}
+	if l, err = d.Trash("test", "", 10); err != nil || len(l.Files) != 1 || l.Files[0].Filename != "1.jpg" {
+		t.Errorf("Trash() files: %v error(%v)", l, err)
+		t.FailNow()
+	}
+	if tf, err = d.Undelete("test", "1.jpg", 0); err != nil || tf.Sha1 != "a" {
+		t.Errorf("Undelete() file: %v error(%v)", tf, err)
+		t.FailNow()
+	}
+	if _, f, _, err = d.GetStores("test", "1.jpg"); err != nil || f.Sha1 != "a" {
+		t.Errorf("GetStores() undeleted file: %v error(%v)", f, err)
+		t.FailNow()
+	}
+	if _, err = d.Undelete("test", "1.jpg", 0); err != errors.ErrNeedleNotExist {
+		t.Errorf("Undelete() again error(%v)", err)
+		t.FailNow()
+	}
+	// uploaded after deleted
+	d.DelStores("test", "1.jpg")
+	if _, _, err = d.UploadStores("test", &meta.File{Filename: "1.jpg", Sha1: "b", Size: 20}); err != nil {
+		t.Errorf("UploadStores() error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = d.Undelete("test", "1.jpg", 0); err != errors.ErrFileExist {
+		t.Errorf("Undelete() error(%v), want(%v)", err, errors.ErrFileExist)
+		t.FailNow()
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	var (
+		err error
+		d   *Directory
+		h   *fakeHBase
+		n   *meta.Needle
+		l   *meta.Trash
+	)
+	d, h = newTestDirectory(&meta.Bucket{Name: "test", Dedup: true, Trash: 3600})
+	for _, name := range []string{"1.jpg", "2.jpg", "3.jpg"} {
+		if n, _, err = d.UploadStores("test", &meta.File{Filename: name, Sha1: "a", Size: 10}); err != nil && err != errors.ErrFileDedup {
+			t.Errorf("UploadStores(%s) error(%v)", name, err)
+			t.FailNow()
+		}
+	}
+	// expired and unexpired
+	for i, c := range []struct {
+		name   string
+		expire int64
+	}{
+		{"1.jpg", 1},
+		{"2.jpg", 1},
+		{"3.jpg", time.Now().Unix() + 3600},
+	} {
+		if _, err = d.hBase.Trash("test", c.name, c.expire); err != nil {
+			t.Errorf("%d: Trash(%s) error(%v)", i, c.name, err)
+			t.FailNow()
+		}
+	}
+	d.purgeTrash(1)
+	if l, err = d.Trash("test", "", 10); err != nil || len(l.Files) != 1 || l.Files[0].Filename != "3.jpg" {
+		t.Errorf("Trash() files: %v error(%v), want the unexpired", l, err)
+		t.FailNow()
+	}
+	// referenced by the trash
+	if _, err = d.hBase.Needle(n.Key); err != nil {
+		t.Errorf("needle: %d error(%v)", n.Key, err)
+		t.FailNow()
+	}
+	if _, err = d.hBase.Purge(l.Files[0]); err != nil {
+		t.Errorf("Purge() error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = d.hBase.Needle(n.Key); err != errors.ErrNeedleNotExist {
+		t.Errorf("needle: %d not deleted, error(%v)", n.Key, err)
+		t.FailNow()
+	}
+	if rows := h.rows("bfsmeta", "dedup_"); rows != 0 {
+		t.Errorf("%d dedup rows left", rows)
+		t.FailNow()
+	}
+}
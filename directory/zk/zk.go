@@ -2,9 +2,12 @@ package zk
 
 import (
 	"bfs/directory/conf"
-	log "github.com/golang/glog"
+	"bfs/libs/log"
+	"fmt"
 	"github.com/samuel/go-zookeeper/zk"
 	"path"
+	"strconv"
+	"strings"
 )
 
 type Zookeeper struct {
@@ -117,7 +120,188 @@ func (z *Zookeeper) GroupStores(group string) (nodes []string, err error) {
 	return
 }
 
+// createPath create a zookeeper path, the last node with the data.
+func (z *Zookeeper) createPath(fpath string, data []byte) (err error) {
+	var (
+		i     int
+		d     []byte
+		str   string
+		tpath string
+		strs  = strings.Split(fpath, "/")[1:]
+	)
+	for i, str = range strs {
+		tpath = path.Join(tpath, "/", str)
+		if i == len(strs)-1 {
+			d = data
+		}
+		if _, err = z.c.Create(tpath, d, 0, zk.WorldACL(zk.PermAll)); err != nil {
+			if err != zk.ErrNodeExists {
+				log.Errorf("zk.Create(\"%s\") error(%v)", tpath, err)
+				return
+			}
+			err = nil
+		}
+	}
+	return
+}
+
+// AddGroupStore add a store into the group.
+func (z *Zookeeper) AddGroupStore(group int, store string) (err error) {
+	return z.createPath(path.Join(z.config.Zookeeper.GroupRoot, strconv.Itoa(group), store), nil)
+}
+
+// AddVolumeStore add a store into the volume, create the volume with the
+// data if not exists.
+func (z *Zookeeper) AddVolumeStore(volume int32, store string, data []byte) (err error) {
+	var vpath = path.Join(z.config.Zookeeper.VolumeRoot, strconv.Itoa(int(volume)))
+	if err = z.createPath(vpath, data); err != nil {
+		return
+	}
+	return z.createPath(path.Join(vpath, store), nil)
+}
+
+// DelGroupStore delete a store from the group, nothing if not in.
+func (z *Zookeeper) DelGroupStore(group int, store string) (err error) {
+	var spath = path.Join(z.config.Zookeeper.GroupRoot, strconv.Itoa(group), store)
+	if err = z.c.Delete(spath, -1); err == zk.ErrNoNode {
+		err = nil
+	} else if err != nil {
+		log.Errorf("zk.Delete(\"%s\") error(%v)", spath, err)
+	}
+	return
+}
+
+// DelVolumeStore delete a store from the volume, nothing if not in.
+func (z *Zookeeper) DelVolumeStore(volume int32, store string) (err error) {
+	var spath = path.Join(z.config.Zookeeper.VolumeRoot, strconv.Itoa(int(volume)), store)
+	if err = z.c.Delete(spath, -1); err == zk.ErrNoNode {
+		err = nil
+	} else if err != nil {
+		log.Errorf("zk.Delete(\"%s\") error(%v)", spath, err)
+	}
+	return
+}
+
+// Ping check the session of the zookeeper connection.
+func (z *Zookeeper) Ping() (err error) {
+	var s zk.State
+	if s = z.c.State(); s != zk.StateHasSession {
+		err = fmt.Errorf("zookeeper %s", s)
+	}
+	return
+}
+
 // Close close the zookeeper connection.
 func (z *Zookeeper) Close() {
 	z.c.Close()
 }
+
+// Buckets get all the bucket names.
+func (z *Zookeeper) Buckets() (nodes []string, err error) {
+	if nodes, _, err = z.c.Children(z.config.Zookeeper.BucketRoot); err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		log.Errorf("zk.Children(\"%s\") error(%v)", z.config.Zookeeper.BucketRoot, err)
+	}
+	return
+}
+
+// WatchBuckets get all the bucket names and watch the added or deleted ones.
+func (z *Zookeeper) WatchBuckets() (nodes []string, ev <-chan zk.Event, err error) {
+	var broot = z.config.Zookeeper.BucketRoot
+	if nodes, _, ev, err = z.c.ChildrenW(broot); err != nil {
+		if err != zk.ErrNoNode {
+			log.Errorf("zk.ChildrenW(\"%s\") error(%v)", broot, err)
+			return
+		}
+		// watch the creation by the first bucket
+		if _, _, ev, err = z.c.ExistsW(broot); err != nil {
+			log.Errorf("zk.ExistsW(\"%s\") error(%v)", broot, err)
+		}
+	}
+	return
+}
+
+// Bucket get the bucket data and version, nil data if not exists.
+func (z *Zookeeper) Bucket(name string) (data []byte, version int32, err error) {
+	var (
+		stat  *zk.Stat
+		bpath = path.Join(z.config.Zookeeper.BucketRoot, name)
+	)
+	if data, stat, err = z.c.Get(bpath); err != nil {
+		if err == zk.ErrNoNode {
+			return nil, 0, nil
+		}
+		log.Errorf("zk.Get(\"%s\") error(%v)", bpath, err)
+		return
+	}
+	version = stat.Version
+	return
+}
+
+// AddBucket create the bucket, zk.ErrNodeExists if exists.
+func (z *Zookeeper) AddBucket(name string, data []byte) (err error) {
+	var bpath = path.Join(z.config.Zookeeper.BucketRoot, name)
+	if err = z.createPath(z.config.Zookeeper.BucketRoot, nil); err != nil {
+		return
+	}
+	if _, err = z.c.Create(bpath, data, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+		log.Errorf("zk.Create(\"%s\") error(%v)", bpath, err)
+	}
+	return
+}
+
+// SetBucket update the bucket if the version matches.
+func (z *Zookeeper) SetBucket(name string, data []byte, version int32) (err error) {
+	var bpath = path.Join(z.config.Zookeeper.BucketRoot, name)
+	if _, err = z.c.Set(bpath, data, version); err != nil {
+		log.Errorf("zk.Set(\"%s\") error(%v)", bpath, err)
+	}
+	return
+}
+
+// DelBucket delete the bucket.
+func (z *Zookeeper) DelBucket(name string) (err error) {
+	var bpath = path.Join(z.config.Zookeeper.BucketRoot, name)
+	if err = z.c.Delete(bpath, -1); err != nil && err != zk.ErrNoNode {
+		log.Errorf("zk.Delete(\"%s\") error(%v)", bpath, err)
+	}
+	return
+}
+
+// Maintenance get the maintenance switch and watch it, nil if not exists.
+func (z *Zookeeper) Maintenance() (data []byte, ev <-chan zk.Event, err error) {
+	var (
+		ok    bool
+		mpath = z.config.Zookeeper.MaintenancePath
+	)
+	if data, _, ev, err = z.c.GetW(mpath); err != nil {
+		if err != zk.ErrNoNode {
+			log.Errorf("zk.GetW(\"%s\") error(%v)", mpath, err)
+			return
+		}
+		// watch the creation
+		if ok, _, ev, err = z.c.ExistsW(mpath); err != nil {
+			log.Errorf("zk.ExistsW(\"%s\") error(%v)", mpath, err)
+		} else if ok {
+			// created meanwhile
+			if data, _, err = z.c.Get(mpath); err != nil {
+				log.Errorf("zk.Get(\"%s\") error(%v)", mpath, err)
+			}
+		}
+	}
+	return
+}
+
+// SetMaintenance set the maintenance switch.
+func (z *Zookeeper) SetMaintenance(data []byte) (err error) {
+	var mpath = z.config.Zookeeper.MaintenancePath
+	if err = z.createPath(mpath, data); err != nil {
+		return
+	}
+	if _, err = z.c.Set(mpath, data, -1); err != nil {
+		log.Errorf("zk.Set(\"%s\") error(%v)", mpath, err)
+	}
+	return
+}
@@ -0,0 +1,86 @@
+// Package addr handles the host:port addresses of the bfs components, the
+// IPv6 literals are bracketed, e.g. [::1]:6062, and the listeners on all the
+// interfaces serve both IPv4 and IPv6.
+package addr
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Advertise get the address dialed by the other components for the listen
+// address, the host is replaced by host if not empty, else by a local ip
+// when listening on all the interfaces, of the IPv6 family first if the
+// listen host is an IPv6 literal.
+func Advertise(listen, host string) (addr string, err error) {
+	var (
+		lhost, port string
+		ip          net.IP
+	)
+	if lhost, port, err = net.SplitHostPort(listen); err != nil {
+		return
+	}
+	if host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"); host != "" {
+		lhost = host
+	} else if ip = net.ParseIP(lhost); lhost == "" || (ip != nil && ip.IsUnspecified()) {
+		if lhost, err = local(ip != nil && ip.To4() == nil); err != nil {
+			return
+		}
+	}
+	return net.JoinHostPort(lhost, port), nil
+}
+
+// local get the first global unicast ip of the interfaces, of the IPv6
+// family first if v6, else of the IPv4 family first.
+func local(v6 bool) (host string, err error) {
+	var (
+		ip    net.IP
+		other net.IP
+		addrs []net.Addr
+	)
+	if addrs, err = net.InterfaceAddrs(); err != nil {
+		return
+	}
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || !n.IP.IsGlobalUnicast() {
+			continue
+		}
+		if (n.IP.To4() == nil) == v6 {
+			if ip == nil {
+				ip = n.IP
+			}
+		} else if other == nil {
+			other = n.IP
+		}
+	}
+	if ip == nil {
+		ip = other
+	}
+	if ip == nil {
+		err = fmt.Errorf("no global unicast ip of the interfaces")
+		return
+	}
+	return ip.String(), nil
+}
+
+// Host get the host of the address, the address itself if no port, the
+// brackets of the IPv6 literal are removed.
+func Host(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// IP get the canonical ip of the address with or without a port, the IPv4
+// mapped IPv6 ip of a dual-stack listener as IPv4, the host itself if not
+// an ip.
+func IP(addr string) string {
+	var host = Host(addr)
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
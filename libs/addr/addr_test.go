@@ -0,0 +1,53 @@
+package addr
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAdvertise(t *testing.T) {
+	var (
+		err  error
+		addr string
+		host string
+	)
+	for _, c := range [][3]string{
+		{"10.0.0.1:6062", "", "10.0.0.1:6062"},
+		{"[fd00::1]:6062", "", "[fd00::1]:6062"},
+		{":6062", "store1.bfs", "store1.bfs:6062"},
+		{"0.0.0.0:6062", "fd00::2", "[fd00::2]:6062"},
+		{"[::]:6062", "[fd00::3]", "[fd00::3]:6062"},
+	} {
+		if addr, err = Advertise(c[0], c[1]); err != nil || addr != c[2] {
+			t.Errorf("Advertise(%s, %s) = %s error(%v), expect %s", c[0], c[1], addr, err, c[2])
+			t.FailNow()
+		}
+	}
+	if _, err = Advertise("localhost", ""); err == nil {
+		t.Errorf("Advertise(localhost) expect error")
+		t.FailNow()
+	}
+	// a local ip if any
+	if addr, err = Advertise(":6062", ""); err == nil {
+		if host, _, err = net.SplitHostPort(addr); err != nil || net.ParseIP(host) == nil {
+			t.Errorf("Advertise(:6062) = %s error(%v)", addr, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestIP(t *testing.T) {
+	for _, c := range [][2]string{
+		{"10.0.0.1:6062", "10.0.0.1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"[fd00::1]:6062", "fd00::1"},
+		{"fd00::1", "fd00::1"},
+		{"[::ffff:10.0.0.1]:6062", "10.0.0.1"},
+		{"store1.bfs:6062", "store1.bfs"},
+	} {
+		if ip := IP(c[0]); ip != c[1] {
+			t.Errorf("IP(%s) = %s, expect %s", c[0], ip, c[1])
+			t.FailNow()
+		}
+	}
+}
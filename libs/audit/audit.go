@@ -0,0 +1,65 @@
+// Package audit passes who made a request, the access key and the client
+// ip, from the proxy to the stores by the headers, so the stores can audit
+// the needle mutations.
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"bfs/libs/addr"
+)
+
+const (
+	HeaderKey = "X-Bfs-Key"
+	HeaderIP  = "X-Bfs-Client-Ip"
+)
+
+type clientKey struct{}
+
+// Client who made a request.
+type Client struct {
+	Key string // the access key id, empty if public
+	IP  string
+}
+
+// NewContext new a context of the client.
+func NewContext(ctx context.Context, key, ip string) context.Context {
+	return context.WithValue(ctx, clientKey{}, &Client{Key: key, IP: ip})
+}
+
+// FromContext get the client of the context, nil if none.
+func FromContext(ctx context.Context) (c *Client) {
+	c, _ = ctx.Value(clientKey{}).(*Client)
+	return
+}
+
+// Inject set the client of ctx to the headers of the request.
+func Inject(ctx context.Context, req *http.Request) {
+	var c = FromContext(ctx)
+	if c == nil {
+		return
+	}
+	if c.Key != "" {
+		req.Header.Set(HeaderKey, c.Key)
+	}
+	if c.IP != "" {
+		req.Header.Set(HeaderIP, c.IP)
+	}
+}
+
+// FromRequest get the client of the headers, the ip is the remote addr if
+// not passed.
+func FromRequest(r *http.Request) (c *Client) {
+	c = &Client{Key: r.Header.Get(HeaderKey), IP: r.Header.Get(HeaderIP)}
+	if c.IP == "" {
+		c.IP = RemoteIP(r)
+	}
+	return
+}
+
+// RemoteIP get the ip of the remote addr, the IPv4 clients of a dual-stack
+// listener as IPv4.
+func RemoteIP(r *http.Request) string {
+	return addr.IP(r.RemoteAddr)
+}
@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var (
+		c   *Client
+		req *http.Request
+		ctx = context.Background()
+	)
+	req, _ = http.NewRequest("POST", "http://127.0.0.1:6062/del", nil)
+	req.RemoteAddr = "10.0.0.1:52100"
+	// not passed
+	Inject(ctx, req)
+	if c = FromRequest(req); c.Key != "" || c.IP != "10.0.0.1" {
+		t.Errorf("client: %+v not match", c)
+		t.FailNow()
+	}
+	Inject(NewContext(ctx, "221bce6492eba70f", "192.168.1.2"), req)
+	if c = FromRequest(req); c.Key != "221bce6492eba70f" || c.IP != "192.168.1.2" {
+		t.Errorf("client: %+v not match", c)
+		t.FailNow()
+	}
+}
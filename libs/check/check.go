@@ -0,0 +1,156 @@
+// Package check collects config problems found by the `-t` dry-run of every
+// bfs binary, so bad deploys fail fast instead of at the first request.
+package check
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Checker accumulates config problems.
+type Checker struct {
+	errs []string
+}
+
+// New new a config checker.
+func New() *Checker {
+	return new(Checker)
+}
+
+// Errorf add a problem.
+func (c *Checker) Errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Sprintf(format, args...))
+}
+
+// NotNil check the config section exists.
+func (c *Checker) NotNil(name string, ok bool) bool {
+	if !ok {
+		c.Errorf("%s: section missing", name)
+	}
+	return ok
+}
+
+// NotEmpty check the string value is set.
+func (c *Checker) NotEmpty(name, v string) {
+	if v == "" {
+		c.Errorf("%s: must be set", name)
+	}
+}
+
+// Range check min <= v <= max.
+func (c *Checker) Range(name string, v, min, max int64) {
+	if v < min || v > max {
+		c.Errorf("%s: %d out of range [%d, %d]", name, v, min, max)
+	}
+}
+
+// Positive check the duration is greater than zero.
+func (c *Checker) Positive(name string, d time.Duration) {
+	if d <= 0 {
+		c.Errorf("%s: %s must be positive", name, d)
+	}
+}
+
+// Addr check the value is a valid host:port.
+func (c *Checker) Addr(name, addr string) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		c.Errorf("%s: invalid addr \"%s\" (%v)", name, addr, err)
+	}
+}
+
+// Addrs check the list is not empty and every item is a valid host:port.
+func (c *Checker) Addrs(name string, addrs []string) {
+	if len(addrs) == 0 {
+		c.Errorf("%s: must be set", name)
+		return
+	}
+	for _, addr := range addrs {
+		c.Addr(name, addr)
+	}
+}
+
+// Dir check the directory exists and is writable.
+func (c *Checker) Dir(name, dir string) {
+	var (
+		fi  os.FileInfo
+		f   *os.File
+		err error
+	)
+	if fi, err = os.Stat(dir); err != nil {
+		c.Errorf("%s: %v", name, err)
+		return
+	}
+	if !fi.IsDir() {
+		c.Errorf("%s: \"%s\" not a directory", name, dir)
+		return
+	}
+	if f, err = ioutil.TempFile(dir, ".bfs_check"); err != nil {
+		c.Errorf("%s: \"%s\" not writable (%v)", name, dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// File check the file can be created or appended, which means it either
+// exists and is writable or its directory is writable.
+func (c *Checker) File(name, file string) {
+	var (
+		f   *os.File
+		err error
+	)
+	if file == "" {
+		c.Errorf("%s: must be set", name)
+		return
+	}
+	if _, err = os.Stat(file); os.IsNotExist(err) {
+		c.Dir(name, filepath.Dir(file))
+		return
+	}
+	if f, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0664); err != nil {
+		c.Errorf("%s: %v", name, err)
+		return
+	}
+	f.Close()
+}
+
+// Dial check at least one of the addrs is reachable.
+func (c *Checker) Dial(name string, addrs []string, timeout time.Duration) {
+	var (
+		conn net.Conn
+		err  error
+		errs []string
+	)
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	for _, addr := range addrs {
+		if conn, err = net.DialTimeout("tcp", addr, timeout); err == nil {
+			conn.Close()
+			return
+		}
+		errs = append(errs, err.Error())
+	}
+	c.Errorf("%s: no reachable addr (%s)", name, strings.Join(errs, "; "))
+}
+
+// Err return all the problems as one error, nil if none.
+func (c *Checker) Err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(c.errs, "\n"))
+}
+
+// Print print the effective config as toml.
+func Print(w io.Writer, c interface{}) error {
+	return toml.NewEncoder(w).Encode(c)
+}
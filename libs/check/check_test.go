@@ -0,0 +1,54 @@
+package check
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	var (
+		ck  = New()
+		err error
+	)
+	ck.NotEmpty("a", "x")
+	ck.Range("b", 1, 1, 10)
+	ck.Positive("c", time.Second)
+	ck.Addr("d", "localhost:80")
+	ck.Dir("e", os.TempDir())
+	if err = ck.Err(); err != nil {
+		t.Errorf("ck.Err() error(%v)", err)
+		t.FailNow()
+	}
+	ck.NotEmpty("a", "")
+	ck.Range("b", 11, 1, 10)
+	ck.Positive("c", 0)
+	ck.Addr("d", "localhost")
+	ck.Dir("e", "/not/exist/dir")
+	ck.NotNil("f", false)
+	if err = ck.Err(); err == nil {
+		t.Errorf("ck.Err() expect error")
+		t.FailNow()
+	}
+	if n := len(strings.Split(err.Error(), "\n")); n != 6 {
+		t.Errorf("problems: %d not match", n)
+		t.FailNow()
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		c   = struct{ Addr string }{Addr: "localhost:80"}
+	)
+	if err := Print(&buf, c); err != nil {
+		t.Errorf("Print() error(%v)", err)
+		t.FailNow()
+	}
+	if !strings.Contains(buf.String(), "Addr = \"localhost:80\"") {
+		t.Errorf("Print() output: %s not match", buf.String())
+		t.FailNow()
+	}
+}
@@ -2,6 +2,8 @@ package errors
 
 const (
 	RetOK                 = 1
+	RetRequestCanceled    = 65531
+	RetRequestTimeout     = 65532
 	RetServiceUnavailable = 65533
 	RetParamErr           = 65534
 	RetInternalErr        = 65535
@@ -15,6 +17,8 @@ var (
 	ErrParam              = Error(RetParamErr)
 	ErrInternal           = Error(RetInternalErr)
 	ErrServiceUnavailable = Error(RetServiceUnavailable)
+	ErrRequestTimeout     = Error(RetRequestTimeout)
+	ErrRequestCanceled    = Error(RetRequestCanceled)
 
 	ErrNeedleExist = Error(RetNeedleExist)
 )
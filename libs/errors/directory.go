@@ -9,6 +9,22 @@ const (
 	RetStoreNotAvailable = 30300
 	// zookeeper
 	RetZookeeperDataError = 30400
+	// register
+	RetRegisterDisabled = 30500
+	// quota
+	RetBucketQuotaExceeded = 30600
+	// degraded
+	RetSnapshotStale = 30700
+	// bucket
+	RetBucketExist    = 30800
+	RetBucketNotFound = 30801
+	// file
+	RetFileExist = 30900
+	RetFileDedup = 30901
+	// maintenance
+	RetMaintenance = 31000
+	// rebalance
+	RetRebalanceWritable = 31100
 )
 
 var (
@@ -20,4 +36,20 @@ var (
 	ErrStoreNotAvailable = Error(RetStoreNotAvailable)
 	// zookeeper
 	ErrZookeeperDataError = Error(RetZookeeperDataError)
+	// register
+	ErrRegisterDisabled = Error(RetRegisterDisabled)
+	// quota
+	ErrBucketQuotaExceeded = Error(RetBucketQuotaExceeded)
+	// degraded
+	ErrSnapshotStale = Error(RetSnapshotStale)
+	// bucket
+	ErrBucketExist    = Error(RetBucketExist)
+	ErrBucketNotFound = Error(RetBucketNotFound)
+	// file
+	ErrFileExist = Error(RetFileExist)
+	ErrFileDedup = Error(RetFileDedup)
+	// maintenance
+	ErrMaintenance = Error(RetMaintenance)
+	// rebalance
+	ErrRebalanceWritable = Error(RetRebalanceWritable)
 )
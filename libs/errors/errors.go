@@ -1,20 +1,123 @@
 package errors
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Error the error code of bfs, the proxy codes are the http statuses, the
+// store ones are in [2000, 9000), the directory ones in [30000, 40000).
 type Error int
 
 func (e Error) Error() string {
-	return errorMsg[int(e)]
+	if msg, ok := errorMsg[int(e)]; ok {
+		return msg
+	}
+	return fmt.Sprintf("unknown error code: %d", int(e))
+}
+
+// Component get the component of the error, store, directory, proxy or
+// common.
+func (e Error) Component() string {
+	switch {
+	case e >= 400 && e < 500:
+		return "proxy"
+	case e >= 2000 && e < 9000:
+		return "store"
+	case e >= 30000 && e < 40000:
+		return "directory"
+	}
+	return "common"
+}
+
+// Retryable report whether the request may succeed later or on another
+// replica, like an unavailable store or a compacting volume.
+func (e Error) Retryable() bool {
+	return e.Status() == http.StatusServiceUnavailable
+}
+
+// Status get the http status of the error.
+func (e Error) Status() int {
+	if e >= 400 && e < 500 {
+		return int(e)
+	}
+	if s, ok := errorStatus[int(e)]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// Info the json body of the error.
+type Info struct {
+	Ret       int    `json:"ret"`
+	Component string `json:"component"`
+	Msg       string `json:"msg"`
+	Retryable bool   `json:"retryable"`
+}
+
+// Info get the json body of the error.
+func (e Error) Info() *Info {
+	return &Info{Ret: int(e), Component: e.Component(), Msg: e.Error(), Retryable: e.Retryable()}
+}
+
+// From get the code of the error, ErrInternal if not an Error.
+func From(err error) Error {
+	if e, ok := err.(Error); ok {
+		return e
+	}
+	return ErrInternal
+}
+
+// Status get the http status of the error, 200 if nil.
+func Status(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return From(err).Status()
+}
+
+// Retryable report whether the request failed by the error may be retried.
+func Retryable(err error) bool {
+	return err != nil && From(err).Retryable()
+}
+
+// Context get the error of the done context, nil if not done, the request
+// past its deadline is retryable, the canceled one is not.
+func Context(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrRequestTimeout
+	}
+	return ErrRequestCanceled
+}
+
+// Ret get the error of the ret of a response, nil if ok, ErrInternal if
+// the ret is unknown.
+func Ret(ret int) error {
+	if ret == RetOK {
+		return nil
+	}
+	if _, ok := errorMsg[ret]; ok {
+		return Error(ret)
+	}
+	return ErrInternal
 }
 
 var (
 	errorMsg = map[int]string{
 		/* ========================= Store ========================= */
 		// common
-		RetOK:          "ok",
-		RetParamErr:    "store param error",
-		RetInternalErr: "internal server error",
+		RetOK:              "ok",
+		RetParamErr:        "store param error",
+		RetInternalErr:     "internal server error",
+		RetRequestTimeout:  "request timeout",
+		RetRequestCanceled: "request canceled",
 		// api
 		RetUploadMaxFile: "exceed upload max file num",
+		RetDelMaxFile:    "exceed delete max file num",
 		// block
 		RetSuperBlockMagic:      "super block magic not match",
 		RetSuperBlockVer:        "super block ver not match",
@@ -60,6 +163,8 @@ var (
 		RetVolumeInCompact: "volume in compacting",
 		RetVolumeClosed:    "volume closed",
 		RetVolumeBatch:     "volume exceed batch write number",
+		RetVolumeQuota:     "volume exceed quota",
+		RetVolumeHandover:  "volume handed over to the new process",
 		/* ========================= Store ========================= */
 		/* ========================= Directory ========================= */
 		// hbase
@@ -70,6 +175,21 @@ var (
 		RetStoreNotAvailable: "store not available",
 		// zookeeper
 		RetZookeeperDataError: "zookeeper data error",
+		// register
+		RetRegisterDisabled: "store register disabled",
+		// quota
+		RetBucketQuotaExceeded: "bucket quota exceeded",
+		// degraded
+		RetSnapshotStale: "zookeeper unavailable, snapshot too stale",
+		// bucket
+		RetBucketExist:    "bucket exist",
+		RetBucketNotFound: "bucket not found",
+		RetFileExist:      "file exist, overwrite rejected by the bucket",
+		RetFileDedup:      "file deduplicated, no data to write",
+		// maintenance
+		RetMaintenance: "cluster in maintenance, writes rejected",
+		// rebalance
+		RetRebalanceWritable: "groups of the moves not in maintenance",
 		/* ========================= Directory ========================= */
 		/* ========================= Proxy ========================= */
 		// common
@@ -77,7 +197,47 @@ var (
 		RetAuthFailed:     "authorization failed",
 		RetUrlBad:         "bad url",
 		// upload
-		RetFileTooLarge: "file too large",
+		RetQuotaExceeded: "quota exceeded",
+		RetFileTooLarge:  "file too large",
 		/* ========================= Proxy ========================= */
 	}
+	// the http status of the errors not 500, the 503 ones are retryable
+	errorStatus = map[int]int{
+		RetOK:                 http.StatusOK,
+		RetParamErr:           http.StatusBadRequest,
+		RetServiceUnavailable: http.StatusServiceUnavailable,
+		RetRequestTimeout:     http.StatusServiceUnavailable,
+		// store
+		RetUploadMaxFile:     http.StatusBadRequest,
+		RetDelMaxFile:        http.StatusBadRequest,
+		RetNeedleExist:       http.StatusConflict,
+		RetNeedleNotExist:    http.StatusNotFound,
+		RetNeedleDeleted:     http.StatusNotFound,
+		RetNeedleCookie:      http.StatusNotFound,
+		RetNeedleTooLarge:    http.StatusRequestEntityTooLarge,
+		RetRingFull:          http.StatusServiceUnavailable,
+		RetStoreNoFreeVolume: http.StatusInsufficientStorage,
+		RetStoreFileExist:    http.StatusConflict,
+		RetVolumeExist:       http.StatusConflict,
+		RetVolumeNotExist:    http.StatusNotFound,
+		RetVolumeDel:         http.StatusNotFound,
+		RetVolumeInCompact:   http.StatusServiceUnavailable,
+		RetVolumeClosed:      http.StatusServiceUnavailable,
+		RetVolumeBatch:       http.StatusBadRequest,
+		RetVolumeQuota:       http.StatusInsufficientStorage,
+		RetVolumeHandover:    http.StatusServiceUnavailable,
+		// directory
+		RetHBase:               http.StatusServiceUnavailable,
+		RetIdNotAvailable:      http.StatusServiceUnavailable,
+		RetStoreNotAvailable:   http.StatusServiceUnavailable,
+		RetRegisterDisabled:    http.StatusForbidden,
+		RetBucketQuotaExceeded: http.StatusForbidden,
+		RetSnapshotStale:       http.StatusServiceUnavailable,
+		RetBucketExist:         http.StatusConflict,
+		RetBucketNotFound:      http.StatusNotFound,
+		RetFileExist:           http.StatusConflict,
+		RetFileDedup:           http.StatusOK,
+		RetMaintenance:         http.StatusServiceUnavailable,
+		RetRebalanceWritable:   http.StatusConflict,
+	}
 )
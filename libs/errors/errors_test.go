@@ -0,0 +1,64 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	var (
+		err   error
+		cases = map[error]int{
+			nil:                     http.StatusOK,
+			ErrNeedleNotExist:       http.StatusNotFound,
+			ErrNeedleDeleted:        http.StatusNotFound,
+			ErrVolumeInCompact:      http.StatusServiceUnavailable,
+			ErrStoreNotAvailable:    http.StatusServiceUnavailable,
+			ErrBucketQuotaExceeded:  http.StatusForbidden,
+			ErrQuotaExceeded:        http.StatusForbidden,
+			ErrNeedleTooLarge:       http.StatusRequestEntityTooLarge,
+			ErrFileDedup:            http.StatusOK,
+			ErrInternal:             http.StatusInternalServerError,
+			fmt.Errorf("not bfs"):   http.StatusInternalServerError,
+			Error(RetSuperBlockVer): http.StatusInternalServerError,
+		}
+	)
+	for err = range cases {
+		if Status(err) != cases[err] {
+			t.Errorf("Status(%v) got: %d, expected: %d", err, Status(err), cases[err])
+			t.FailNow()
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	var info *Info
+	if info = ErrVolumeClosed.Info(); info.Component != "store" || !info.Retryable || info.Ret != RetVolumeClosed {
+		t.Errorf("Info() got: %+v", info)
+		t.FailNow()
+	}
+	if info = ErrBucketNotFound.Info(); info.Component != "directory" || info.Retryable {
+		t.Errorf("Info() got: %+v", info)
+		t.FailNow()
+	}
+	if info = ErrUrlBad.Info(); info.Component != "proxy" || info.Ret != http.StatusBadRequest {
+		t.Errorf("Info() got: %+v", info)
+		t.FailNow()
+	}
+	if Retryable(nil) || Retryable(ErrNeedleExist) || !Retryable(ErrHBase) {
+		t.Errorf("Retryable() wrong")
+		t.FailNow()
+	}
+}
+
+func TestRet(t *testing.T) {
+	if Ret(RetOK) != nil || Ret(RetNeedleNotExist) != ErrNeedleNotExist || Ret(123456) != ErrInternal {
+		t.Errorf("Ret() wrong")
+		t.FailNow()
+	}
+	if Error(123456).Error() != "unknown error code: 123456" {
+		t.Errorf("Error() got: %s", Error(123456).Error())
+		t.FailNow()
+	}
+}
@@ -6,7 +6,8 @@ const (
 	RetAuthFailed     = 401
 	RetBucketNotExist = 404
 	// upload
-	RetFileTooLarge = 413
+	RetQuotaExceeded = 403
+	RetFileTooLarge  = 413
 )
 
 var (
@@ -15,5 +16,6 @@ var (
 	ErrAuthFailed     = Error(RetAuthFailed)
 	ErrBucketNotExist = Error(RetBucketNotExist)
 	// upload
-	ErrFileTooLarge = Error(RetFileTooLarge)
+	ErrQuotaExceeded = Error(RetQuotaExceeded)
+	ErrFileTooLarge  = Error(RetFileTooLarge)
 )
@@ -48,6 +48,8 @@ const (
 	RetVolumeInCompact = 8003
 	RetVolumeClosed    = 8004
 	RetVolumeBatch     = 8005
+	RetVolumeQuota     = 8006
+	RetVolumeHandover  = 8007
 )
 
 var (
@@ -97,4 +99,6 @@ var (
 	ErrVolumeInCompact = Error(RetVolumeInCompact)
 	ErrVolumeClosed    = Error(RetVolumeClosed)
 	ErrVolumeBatch     = Error(RetVolumeBatch)
+	ErrVolumeQuota     = Error(RetVolumeQuota)
+	ErrVolumeHandover  = Error(RetVolumeHandover)
 )
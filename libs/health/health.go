@@ -0,0 +1,91 @@
+// Package health is the liveness and the readiness of a bfs component, for
+// the probes of the load balancers and the orchestrators, /healthz is ok as
+// long as the process serves http, /readyz is ok only if all the checks of
+// the component pass, e.g. the volumes recovered and zookeeper connected.
+package health
+
+import (
+	"bfs/libs/log"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	_ok = "ok"
+)
+
+// Health the readiness checks of a component.
+type Health struct {
+	names  []string
+	checks []func() error
+}
+
+// Status the result of the checks, the error of a failed check, or ok.
+type Status struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// New new a health without checks, always ready.
+func New() *Health {
+	return &Health{}
+}
+
+// Add add a readiness check, a nil error means ready, it must be quick as
+// run by every probe.
+func (h *Health) Add(name string, check func() error) {
+	h.names = append(h.names, name)
+	h.checks = append(h.checks, check)
+}
+
+// Status run the checks.
+func (h *Health) Status() (s *Status) {
+	var (
+		i   int
+		err error
+	)
+	s = &Status{Ready: true, Checks: make(map[string]string, len(h.checks))}
+	for i = 0; i < len(h.checks); i++ {
+		if err = h.checks[i](); err != nil {
+			s.Ready = false
+			s.Checks[h.names[i]] = err.Error()
+		} else {
+			s.Checks[h.names[i]] = _ok
+		}
+	}
+	return
+}
+
+// Register register the /healthz and /readyz of the mux.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+}
+
+// Healthz the liveness, nothing checked.
+func Healthz(wr http.ResponseWriter, r *http.Request) {
+	wr.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	wr.Write([]byte(_ok))
+}
+
+// Readyz the readiness, 503 if any check fails, the checks are in the
+// json body.
+func (h *Health) Readyz(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		body []byte
+		s    = h.Status()
+	)
+	if body, err = json.Marshal(s); err != nil {
+		log.Errorf("json.Marshal(%v) error(%v)", s, err)
+		http.Error(wr, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	if !s.Ready {
+		wr.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if _, err = wr.Write(body); err != nil {
+		log.Errorf("wr.Write() error(%v)", err)
+	}
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	var (
+		err   error
+		ready bool
+		resp  *http.Response
+		s     = new(Status)
+		h     = New()
+		mux   = http.NewServeMux()
+		srv   = httptest.NewServer(mux)
+	)
+	defer srv.Close()
+	h.Register(mux)
+	h.Add("zookeeper", func() error {
+		if !ready {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+	if resp, err = http.Get(srv.URL + "/healthz"); err != nil {
+		t.Errorf("http.Get() error(%v)", err)
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("healthz: %d not ok", resp.StatusCode)
+		t.FailNow()
+	}
+	if resp, err = http.Get(srv.URL + "/readyz"); err != nil {
+		t.Errorf("http.Get() error(%v)", err)
+		t.FailNow()
+	}
+	err = json.NewDecoder(resp.Body).Decode(s)
+	resp.Body.Close()
+	if err != nil {
+		t.Errorf("json.Decode() error(%v)", err)
+		t.FailNow()
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || s.Ready || s.Checks["zookeeper"] != "not connected" {
+		t.Errorf("readyz: %d %v not unavailable", resp.StatusCode, s)
+		t.FailNow()
+	}
+	ready = true
+	if s = h.Status(); !s.Ready || s.Checks["zookeeper"] != _ok {
+		t.Errorf("status: %v not ready", s)
+		t.FailNow()
+	}
+}
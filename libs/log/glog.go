@@ -0,0 +1,27 @@
+package log
+
+import (
+	"github.com/golang/glog"
+)
+
+// glogger the glog backend, configured by the glog flags.
+type glogger struct{}
+
+func (glogger) Output(calldepth int, lv Level, msg string) {
+	switch lv {
+	case ErrorLevel:
+		glog.ErrorDepth(calldepth+1, msg)
+	case WarnLevel:
+		glog.WarningDepth(calldepth+1, msg)
+	default:
+		glog.InfoDepth(calldepth+1, msg)
+	}
+}
+
+func (glogger) Flush() {
+	glog.Flush()
+}
+
+func (glogger) V(level int32) bool {
+	return bool(glog.V(glog.Level(level)))
+}
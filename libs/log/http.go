@@ -0,0 +1,32 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Handler get the level, or set it by the level param of a POST, for the
+// admin apis.
+//
+// e.g curl -d "level=debug" "http://localhost:6063/log_level"
+func Handler(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		lv  Level
+	)
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if lv, err = ParseLevel(r.FormValue("level")); err != nil {
+			http.Error(wr, err.Error(), http.StatusBadRequest)
+			return
+		}
+		SetLevel(lv)
+		Infof("log level set to %s by %s", lv, r.RemoteAddr)
+	default:
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	fmt.Fprintf(wr, "{\"ret\":1,\"level\":\"%s\"}", GetLevel())
+}
@@ -0,0 +1,238 @@
+// Package log is the logging of bfs, it keeps the glog style api and writes
+// to a pluggable backend, glog by default, the level can be changed at run
+// time.
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level the logging level.
+type Level int32
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var _levels = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if s, ok := _levels[l]; ok {
+		return s
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel parse the level name.
+func ParseLevel(s string) (l Level, err error) {
+	var name string
+	for l, name = range _levels {
+		if strings.EqualFold(s, name) {
+			return
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return WarnLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level: %q", s)
+}
+
+// Logger the logging backend, calldepth is the number of the frames above
+// the caller of Output to the logging call site.
+type Logger interface {
+	Output(calldepth int, lv Level, msg string)
+	Flush()
+}
+
+// verboser the backends with their own verbosity, like glog -v.
+type verboser interface {
+	V(level int32) bool
+}
+
+// NewFunc new a backend by the format, e.g text or json.
+type NewFunc func(format string) (Logger, error)
+
+var (
+	_level    = int32(InfoLevel)
+	_lock     sync.RWMutex
+	_logger   Logger = glogger{}
+	_backends        = map[string]NewFunc{
+		"glog": func(string) (Logger, error) { return glogger{}, nil },
+	}
+)
+
+// Register register a backend by the name.
+func Register(name string, f NewFunc) {
+	_lock.Lock()
+	_backends[name] = f
+	_lock.Unlock()
+}
+
+// SetLogger set the backend, for the embedders.
+func SetLogger(l Logger) {
+	_lock.Lock()
+	_logger = l
+	_lock.Unlock()
+}
+
+func logger() (l Logger) {
+	_lock.RLock()
+	l = _logger
+	_lock.RUnlock()
+	return
+}
+
+// SetLevel set the lowest level logged.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&_level, int32(l))
+}
+
+// GetLevel get the lowest level logged.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&_level))
+}
+
+// Config the logging config, nil keeps glog at the info level.
+type Config struct {
+	// glog, slog or any registered backend
+	Backend string
+	// debug, info, warn or error
+	Level string
+	// the format of the backend, text or json for slog
+	Format string
+}
+
+// Check check the level and the backend.
+func (c *Config) Check() (err error) {
+	var ok bool
+	if c.Level != "" {
+		if _, err = ParseLevel(c.Level); err != nil {
+			return
+		}
+	}
+	if c.Backend != "" {
+		_lock.RLock()
+		_, ok = _backends[c.Backend]
+		_lock.RUnlock()
+		if !ok {
+			err = fmt.Errorf("unknown log backend: %q", c.Backend)
+		}
+	}
+	return
+}
+
+// Init set the backend and the level by the config.
+func Init(c *Config) (err error) {
+	var (
+		ok bool
+		lv Level
+		f  NewFunc
+		l  Logger
+	)
+	if c == nil {
+		return
+	}
+	if c.Level != "" {
+		if lv, err = ParseLevel(c.Level); err != nil {
+			return
+		}
+		SetLevel(lv)
+	}
+	if c.Backend == "" {
+		return
+	}
+	_lock.RLock()
+	f, ok = _backends[c.Backend]
+	_lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown log backend: %q", c.Backend)
+	}
+	if l, err = f(c.Format); err != nil {
+		return
+	}
+	SetLogger(l)
+	return
+}
+
+func output(lv Level, msg string) {
+	if lv < GetLevel() {
+		return
+	}
+	// output <- Infof <- the call site
+	logger().Output(2, lv, msg)
+}
+
+func voutput(msg string) {
+	logger().Output(2, InfoLevel, msg)
+}
+
+// Verbose the result of V, logs only if true.
+type Verbose bool
+
+// V report whether the verbose logs of the level are enabled, by the debug
+// level or the verbosity of the backend.
+func V(level int32) Verbose {
+	var (
+		ok bool
+		v  verboser
+	)
+	if GetLevel() <= DebugLevel {
+		return true
+	}
+	if v, ok = logger().(verboser); ok {
+		return Verbose(v.V(level))
+	}
+	return false
+}
+
+func (v Verbose) Info(args ...interface{}) {
+	if v {
+		voutput(fmt.Sprint(args...))
+	}
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v {
+		voutput(fmt.Sprintf(format, args...))
+	}
+}
+
+func Info(args ...interface{}) {
+	output(InfoLevel, fmt.Sprint(args...))
+}
+
+func Infof(format string, args ...interface{}) {
+	output(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func Warning(args ...interface{}) {
+	output(WarnLevel, fmt.Sprint(args...))
+}
+
+func Warningf(format string, args ...interface{}) {
+	output(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func Error(args ...interface{}) {
+	output(ErrorLevel, fmt.Sprint(args...))
+}
+
+func Errorf(format string, args ...interface{}) {
+	output(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+// Flush flush the buffered logs of the backend.
+func Flush() {
+	logger().Flush()
+}
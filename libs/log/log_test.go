@@ -0,0 +1,75 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// memory the backend keeping the logs.
+type memory struct {
+	logs []string
+}
+
+func (m *memory) Output(calldepth int, lv Level, msg string) {
+	m.logs = append(m.logs, lv.String()+" "+msg)
+}
+
+func (m *memory) Flush() {}
+
+func TestLog(t *testing.T) {
+	var (
+		err error
+		m   = &memory{}
+	)
+	SetLogger(m)
+	defer SetLogger(glogger{})
+	defer SetLevel(InfoLevel)
+	Infof("a %d", 1)
+	Warning("b")
+	V(1).Infof("c")
+	SetLevel(ErrorLevel)
+	Info("d")
+	Errorf("e")
+	SetLevel(DebugLevel)
+	V(2).Info("f")
+	if strings.Join(m.logs, ",") != "info a 1,warn b,error e,info f" {
+		t.Errorf("logs got: %v", m.logs)
+		t.FailNow()
+	}
+	if err = Init(&Config{Backend: "none"}); err == nil {
+		t.Errorf("Init() unknown backend no error")
+		t.FailNow()
+	}
+	if err = (&Config{Level: "verbose"}).Check(); err == nil {
+		t.Errorf("Check() unknown level no error")
+		t.FailNow()
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var (
+		wr *httptest.ResponseRecorder
+		r  *http.Request
+	)
+	defer SetLevel(InfoLevel)
+	SetLogger(&memory{})
+	defer SetLogger(glogger{})
+	r = httptest.NewRequest("POST", "/log/level", strings.NewReader(url.Values{"level": {"warn"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	wr = httptest.NewRecorder()
+	Handler(wr, r)
+	if wr.Code != http.StatusOK || GetLevel() != WarnLevel || !strings.Contains(wr.Body.String(), `"level":"warn"`) {
+		t.Errorf("Handler() got: %d %s level: %s", wr.Code, wr.Body, GetLevel())
+		t.FailNow()
+	}
+	r = httptest.NewRequest("POST", "/log/level", strings.NewReader("level=loud"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	wr = httptest.NewRecorder()
+	if Handler(wr, r); wr.Code != http.StatusBadRequest {
+		t.Errorf("Handler() bad level got: %d", wr.Code)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,62 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+)
+
+func init() {
+	Register("slog", func(format string) (l Logger, err error) {
+		var h slog.Handler
+		switch format {
+		case "", "text":
+			h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+		case "json":
+			h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+		default:
+			return nil, fmt.Errorf("unknown slog format: %q", format)
+		}
+		return NewSlog(slog.New(h)), nil
+	})
+}
+
+// slogger the log/slog backend.
+type slogger struct {
+	l *slog.Logger
+}
+
+// NewSlog new a backend writing to the slog logger.
+func NewSlog(l *slog.Logger) Logger {
+	return &slogger{l: l}
+}
+
+var _slogLevels = map[Level]slog.Level{
+	DebugLevel: slog.LevelDebug,
+	InfoLevel:  slog.LevelInfo,
+	WarnLevel:  slog.LevelWarn,
+	ErrorLevel: slog.LevelError,
+}
+
+func (s *slogger) Output(calldepth int, lv Level, msg string) {
+	var (
+		r   slog.Record
+		pcs [1]uintptr
+		ctx = context.Background()
+	)
+	if !s.l.Enabled(ctx, _slogLevels[lv]) {
+		return
+	}
+	// skip runtime.Callers and Output
+	runtime.Callers(calldepth+2, pcs[:])
+	r = slog.NewRecord(time.Now(), _slogLevels[lv], msg, pcs[0])
+	s.l.Handler().Handle(ctx, r)
+}
+
+func (s *slogger) Flush() {}
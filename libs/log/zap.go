@@ -0,0 +1,56 @@
+//go:build zap
+// +build zap
+
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register("zap", func(format string) (l Logger, err error) {
+		var z *zap.Logger
+		switch format {
+		case "", "json":
+			z, err = zap.NewProduction()
+		case "text":
+			z, err = zap.NewDevelopment()
+		default:
+			err = fmt.Errorf("unknown zap format: %q", format)
+		}
+		if err != nil {
+			return
+		}
+		return NewZap(z), nil
+	})
+}
+
+// zapper the zap backend, only built with the zap tag.
+type zapper struct {
+	l *zap.Logger
+}
+
+// NewZap new a backend writing to the zap logger.
+func NewZap(l *zap.Logger) Logger {
+	// zap.Logger <- Output <- output <- Infof <- the call site
+	return &zapper{l: l.WithOptions(zap.AddCallerSkip(3))}
+}
+
+func (z *zapper) Output(calldepth int, lv Level, msg string) {
+	switch lv {
+	case DebugLevel:
+		z.l.Debug(msg)
+	case InfoLevel:
+		z.l.Info(msg)
+	case WarnLevel:
+		z.l.Warn(msg)
+	default:
+		z.l.Error(msg)
+	}
+}
+
+func (z *zapper) Flush() {
+	z.l.Sync()
+}
@@ -0,0 +1,69 @@
+package meta
+
+const (
+	// bucket property bit, 0 public, 1 private
+	BucketPrivateReadBit  = 0
+	BucketPrivateWriteBit = 1
+	BucketPropertyMax     = (1 << BucketPrivateReadBit) | (1 << BucketPrivateWriteBit)
+	// the policies of the uploads to an existing filename
+	BucketOverwrite = "overwrite" // rewrite the needle of the file, the default
+	BucketReject    = "reject"    // keep the file, the upload fails
+	BucketVersion   = "version"   // keep the old file as filename@key, write a new needle
+)
+
+// Bucket the bucket meta in zookeeper.
+type Bucket struct {
+	Name string `json:"name"`
+	// bit 0: read, bit 1: write, 0 public 1 private
+	Property     int          `json:"property"`
+	Keys         []*BucketKey `json:"keys"`
+	Domain       string       `json:"domain,omitempty"`
+	PurgeCDN     bool         `json:"purge_cdn"`
+	CacheControl int64        `json:"cache_control,omitempty"`
+	// the response headers of the downloads, Headers override the others
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	CORS               *BucketCORS       `json:"cors,omitempty"`
+	CTime              int64             `json:"ctime"`
+	// the policy of the uploads to an existing filename, overwrite if empty
+	Overwrite string `json:"overwrite,omitempty"`
+	// the files of the same content share one needle, can't be disabled
+	Dedup bool `json:"dedup,omitempty"`
+	// the seconds the deleted files are kept in the trash, 0 deletes at once
+	Trash int64 `json:"trash,omitempty"`
+	// the uploads only go to the groups of the stores with all the labels,
+	// any group if empty
+	Labels []string `json:"labels,omitempty"`
+}
+
+// ValidOverwrite check the overwrite policy, empty is the default.
+func ValidOverwrite(policy string) bool {
+	return policy == "" || policy == BucketOverwrite || policy == BucketReject || policy == BucketVersion
+}
+
+// BucketCORS the cors rule of the bucket, "*" allows any origin.
+type BucketCORS struct {
+	Origins []string `json:"origins"`
+	Methods []string `json:"methods"`
+	Headers []string `json:"headers,omitempty"`
+	MaxAge  int64    `json:"max_age,omitempty"`
+}
+
+// BucketKey an access key pair of the bucket, the secret is only served by
+// the directory admin api.
+type BucketKey struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Buckets the response of the bucket apis.
+type Buckets struct {
+	Ret     int       `json:"ret"`
+	Buckets []*Bucket `json:"buckets"`
+}
+
+// BucketKeys the access keys of all the buckets, bucket:keys.
+type BucketKeys struct {
+	Ret  int                     `json:"ret"`
+	Keys map[string][]*BucketKey `json:"keys"`
+}
@@ -2,4 +2,6 @@ package meta
 
 const (
 	MaxBlockOffset = uint32(4294967295)
+	// BlockPadding the unit of the block offset in bytes
+	BlockPadding = 8
 )
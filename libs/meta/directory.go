@@ -5,14 +5,64 @@ type StoreRet struct {
 	Ret int `json:"ret"`
 }
 
+// StoreKeys the response of the store apis listing the keys.
+type StoreKeys struct {
+	Ret  int     `json:"ret"`
+	Keys []int64 `json:"keys"`
+}
+
 // Response
 type Response struct {
-	Ret    int      `json:"ret"`
-	Key    int64    `json:"key"`
-	Cookie int32    `json:"cookie"`
-	Vid    int32    `json:"vid"`
-	Stores []string `json:"stores"`
-	MTime  int64    `json:"update_time"`
-	Sha1   string   `json:"sha1"`
-	Mine   string   `json:"mine"`
+	Ret      int      `json:"ret"`
+	Filename string   `json:"filename,omitempty"`
+	Key      int64    `json:"key"`
+	Cookie   int32    `json:"cookie"`
+	Vid      int32    `json:"vid"`
+	Stores   []string `json:"stores"`
+	Local    int      `json:"local,omitempty"` // the first stores in the caller region
+	MTime    int64    `json:"update_time"`
+	Sha1     string   `json:"sha1"`
+	Mine     string   `json:"mine"`
+	Name     string   `json:"name,omitempty"`
+	Size     int64    `json:"size,omitempty"`
+	// the error of the ret, see errors.Info
+	Component string `json:"component,omitempty"`
+	Msg       string `json:"msg,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+// Responses batched lookup response, every file has its own ret, volumes
+// is volume_id:readable stores.
+type Responses struct {
+	Ret     int                 `json:"ret"`
+	Files   []*Response         `json:"files"`
+	Volumes map[string][]string `json:"volumes,omitempty"`
+}
+
+// List bucket listing response, prefixes are the common prefixes of the
+// rolled up files, marker is the start of the next page if truncated.
+type List struct {
+	Ret      int      `json:"ret"`
+	Files    []*File  `json:"files"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Marker   string   `json:"marker,omitempty"`
+}
+
+// Trash trash listing response, marker is the start of the next page if
+// truncated.
+type Trash struct {
+	Ret    int          `json:"ret"`
+	Files  []*TrashFile `json:"files"`
+	Marker string       `json:"marker,omitempty"`
+}
+
+// Register store register response, the store saves it locally and applies
+// it on every start.
+type Register struct {
+	Ret         int     `json:"ret"`
+	Id          string  `json:"id"`
+	Rack        string  `json:"rack"`
+	Group       int     `json:"group"`
+	Volumes     []int32 `json:"volumes"`
+	FreeVolumes int     `json:"free_volumes"`
 }
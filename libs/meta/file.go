@@ -8,4 +8,14 @@ type File struct {
 	Mine     string `json:"mine"`
 	Status   int32  `json:"status"`
 	MTime    int64  `json:"update_time"`
+	Size     int64  `json:"size"`
+	Name     string `json:"name,omitempty"` // the original filename for the downloads
+}
+
+// TrashFile a file deleted from a soft delete bucket, kept in the trash until
+// expire, the unix seconds.
+type TrashFile struct {
+	*File
+	Bucket string `json:"bucket"`
+	Expire int64  `json:"expire"`
 }
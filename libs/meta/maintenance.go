@@ -0,0 +1,30 @@
+package meta
+
+// Maintenance the read only switch of the cluster or the groups in
+// zookeeper, the writes are rejected while the reads are still served, e.g.
+// during the migrations, the zookeeper upgrades or the capacity emergencies.
+type Maintenance struct {
+	Cluster bool   `json:"cluster"`
+	Groups  []int  `json:"groups,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Time    int64  `json:"time,omitempty"` // unix, the last switched
+}
+
+// Writable reports whether the group takes the writes.
+func (m *Maintenance) Writable(gid int) bool {
+	if m.Cluster {
+		return false
+	}
+	for _, g := range m.Groups {
+		if g == gid {
+			return false
+		}
+	}
+	return true
+}
+
+// MaintenanceRet the response of the maintenance api.
+type MaintenanceRet struct {
+	Ret int `json:"ret"`
+	*Maintenance
+}
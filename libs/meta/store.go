@@ -2,13 +2,18 @@ package meta
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
-
-	log "github.com/golang/glog"
 )
 
 const (
@@ -27,6 +32,10 @@ const (
 	statAPI  = "http://%s/info"
 	getAPI   = "http://%s/get?key=%d&cookie=%d&vid=%d"
 	probeAPI = "http://%s/probe?vid=%d"
+	readAPI  = "http://%s/get?key=%d&cookie=%d&vid=%d"
+	writeAPI = "http://%s/upload"
+	delAPI   = "http://%s/del"
+	coldAPI  = "http://%s/cold_needles?vid=%d&age=%d&limit=%d"
 )
 
 var (
@@ -59,7 +68,14 @@ type Store struct {
 	Api    string `json:"api"`
 	Id     string `json:"id"`
 	Rack   string `json:"rack"`
+	Zone   string `json:"zone,omitempty"`
+	Region string `json:"region,omitempty"`
 	Status int    `json:"status"`
+	// the hardware or the compliance labels, e.g ssd, pinned buckets only
+	// write to the groups of all the labels
+	Labels []string `json:"labels,omitempty"`
+	// persistently slow, marked by pitchfork
+	Degraded bool `json:"degraded,omitempty"`
 }
 
 func (s *Store) String() string {
@@ -70,9 +86,13 @@ Stat:   %s
 Admin:  %s
 Api:    %s
 Rack:   %s
+Zone:   %s
+Region: %s
+Labels: %v
 Status: %d
+Degraded: %t
 -----------------------------
-`, s.Id, s.Stat, s.Admin, s.Api, s.Rack, s.Status)
+`, s.Id, s.Stat, s.Admin, s.Api, s.Rack, s.Zone, s.Region, s.Labels, s.Status, s.Degraded)
 }
 
 // statAPI get stat http api.
@@ -100,7 +120,7 @@ func (s *Store) Info() (vs []*Volume, err error) {
 		url  = s.statAPI()
 	)
 	if req, err = http.NewRequest("GET", url, nil); err != nil {
-		log.Info("http.NewRequest(GET,%s) error(%v)", url, err)
+		log.Infof("http.NewRequest(GET,%s) error(%v)", url, err)
 		return
 	}
 	if resp, err = _client.Do(req); err != nil {
@@ -133,7 +153,7 @@ func (s *Store) Head(vid int32) (err error) {
 	)
 	url = s.probeAPI(vid)
 	if req, err = http.NewRequest("HEAD", url, nil); err != nil {
-		log.Info("http.NewRequest(GET,%s) error(%v)", url, err)
+		log.Infof("http.NewRequest(GET,%s) error(%v)", url, err)
 		return
 	}
 	if resp, err = _client.Do(req); err != nil {
@@ -156,3 +176,139 @@ func (s *Store) CanWrite() bool {
 func (s *Store) CanRead() bool {
 	return s.Status == StoreStatusRead || s.Status == StoreStatusHealth
 }
+
+// Dial check the stat, api and admin ports accept tcp connections.
+func (s *Store) Dial(timeout time.Duration) (err error) {
+	var (
+		addr string
+		conn net.Conn
+	)
+	for _, addr = range []string{s.Stat, s.Api, s.Admin} {
+		if conn, err = net.DialTimeout("tcp", addr, timeout); err != nil {
+			log.Errorf("net.DialTimeout(\"%s\") error(%v)", addr, err)
+			return
+		}
+		conn.Close()
+	}
+	return
+}
+
+// Write write a needle to the store volume directly.
+func (s *Store) Write(vid int32, key int64, cookie int32, data []byte) (err error) {
+	var (
+		w     *multipart.Writer
+		fw    io.Writer
+		buf   = &bytes.Buffer{}
+		resp  *http.Response
+		ret   = new(StoreRet)
+		uri   = fmt.Sprintf(writeAPI, s.Api)
+		ctype string
+	)
+	w = multipart.NewWriter(buf)
+	w.WriteField("vid", strconv.FormatInt(int64(vid), 10))
+	w.WriteField("key", strconv.FormatInt(key, 10))
+	w.WriteField("cookie", strconv.FormatInt(int64(cookie), 10))
+	if fw, err = w.CreateFormFile("file", "probe"); err != nil {
+		return
+	}
+	if _, err = fw.Write(data); err != nil {
+		return
+	}
+	ctype = w.FormDataContentType()
+	if err = w.Close(); err != nil {
+		return
+	}
+	if resp, err = _client.Post(uri, ctype, buf); err != nil {
+		log.Errorf("_client.Post(%s) error(%v)", uri, err)
+		return
+	}
+	err = storeRet(resp, ret)
+	return
+}
+
+// Read read a needle from the store volume directly.
+func (s *Store) Read(vid int32, key int64, cookie int32) (data []byte, err error) {
+	var (
+		resp *http.Response
+		uri  = fmt.Sprintf(readAPI, s.Api, key, cookie, vid)
+	)
+	if resp, err = _client.Get(uri); err != nil {
+		log.Errorf("_client.Get(%s) error(%v)", uri, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			err = errors.ErrNeedleNotExist
+		} else {
+			err = errors.ErrInternal
+		}
+		return
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+// Delete delete a needle from the store volume directly.
+func (s *Store) Delete(vid int32, key int64) (err error) {
+	var (
+		resp   *http.Response
+		ret    = new(StoreRet)
+		uri    = fmt.Sprintf(delAPI, s.Api)
+		params = url.Values{}
+	)
+	params.Set("vid", strconv.FormatInt(int64(vid), 10))
+	params.Set("key", strconv.FormatInt(key, 10))
+	if resp, err = _client.PostForm(uri, params); err != nil {
+		log.Errorf("_client.PostForm(%s) error(%v)", uri, err)
+		return
+	}
+	err = storeRet(resp, ret)
+	return
+}
+
+// Cold list at most limit keys of the store volume not accessed in the age.
+func (s *Store) Cold(vid int32, age time.Duration, limit int) (keys []int64, err error) {
+	var (
+		resp *http.Response
+		ret  = new(StoreKeys)
+		uri  = fmt.Sprintf(coldAPI, s.Admin, vid, int64(age/time.Second), limit)
+	)
+	if resp, err = _client.Get(uri); err != nil {
+		log.Errorf("_client.Get(%s) error(%v)", uri, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = errors.ErrInternal
+		return
+	}
+	if err = json.NewDecoder(resp.Body).Decode(ret); err != nil {
+		return
+	}
+	if ret.Ret != errors.RetOK {
+		err = errors.Error(ret.Ret)
+		return
+	}
+	keys = ret.Keys
+	return
+}
+
+// storeRet parse the store response.
+func storeRet(resp *http.Response, ret *StoreRet) (err error) {
+	var body []byte
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.ErrInternal
+	}
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if err = json.Unmarshal(body, ret); err != nil {
+		return
+	}
+	if ret.Ret != errors.RetOK {
+		err = errors.Error(ret.Ret)
+	}
+	return
+}
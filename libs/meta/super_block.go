@@ -7,6 +7,7 @@ const (
 type SuperBlock struct {
 	File    string `json:"file"`
 	Offset  uint32 `json:"offset"`
+	Size    int64  `json:"size"`
 	LastErr error  `json:"last_err"`
 	Ver     byte   `json:"ver"`
 	Padding uint32 `json:"padding"`
@@ -0,0 +1,23 @@
+package meta
+
+// Topology the stores, groups and volumes of the cluster from zookeeper, for
+// the capacity planning.
+type Topology struct {
+	Ret         int              `json:"ret"`
+	Stores      []*Store         `json:"stores"`
+	Groups      []*TopologyGroup `json:"groups"`
+	VolumeBytes uint64           `json:"volume_bytes"` // the max bytes of a volume
+}
+
+// TopologyGroup a group and the volumes written to all its stores.
+type TopologyGroup struct {
+	Group   int               `json:"group"`
+	Stores  []string          `json:"stores"`
+	Volumes []*TopologyVolume `json:"volumes"`
+}
+
+// TopologyVolume a volume and its used bytes.
+type TopologyVolume struct {
+	Id   int32  `json:"id"`
+	Used uint64 `json:"used"`
+}
@@ -6,6 +6,36 @@ type Volume struct {
 	Id    int32       `json:"id"`
 	Block *SuperBlock `json:"block"`
 	Stats *stat.Stats `json:"stats"`
+	// the max bytes of the block, no quota if zero
+	Quota int64 `json:"quota,omitempty"`
+}
+
+// Full check the block full or the quota reached.
+func (v *Volume) Full() bool {
+	return v.Block.Full() || (v.Quota > 0 && v.Quota-v.Block.Size < int64(blockLeftSpace))
+}
+
+// FreeSpace cal rest space of volume in the block offsets, limited by the
+// quota.
+func (v *Volume) FreeSpace() (free uint32) {
+	var (
+		left    int64
+		padding = int64(v.Block.Padding)
+	)
+	free = v.Block.FreeSpace()
+	if v.Quota <= 0 {
+		return
+	}
+	if padding == 0 {
+		padding = BlockPadding
+	}
+	if left = (v.Quota - v.Block.Size) / padding; left < 0 {
+		left = 0
+	}
+	if left < int64(free) {
+		free = uint32(left)
+	}
+	return
 }
 
 type Volumes struct {
@@ -17,4 +47,7 @@ type VolumeState struct {
 	TotalWriteProcessed uint64 `json:"total_write_processed"`
 	TotalWriteDelay     uint64 `json:"total_write_delay"`
 	FreeSpace           uint32 `json:"free_space"`
+	// recent(last second) write load
+	WriteTPS   uint64 `json:"write_tps"`
+	WriteDelay uint64 `json:"write_delay"`
 }
@@ -0,0 +1,44 @@
+// Package region orders the replicas of a needle to read, the stores of the
+// reader region first.
+package region
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// random store node
+	_rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	_lock sync.Mutex
+)
+
+// ReadStores order the stores to read, the local(same region) stores first
+// from a random one, the other regions only after all the local stores
+// failed. local is the number of the local stores ahead of the others, all
+// stores are local if no region.
+func ReadStores(stores []string, local int) (ss []string) {
+	if local <= 0 || local > len(stores) {
+		local = len(stores)
+	}
+	ss = make([]string, 0, len(stores))
+	ss = appendRotate(ss, stores[:local])
+	ss = appendRotate(ss, stores[local:])
+	return
+}
+
+// appendRotate append the stores from a random one.
+func appendRotate(ss, stores []string) []string {
+	var i, ix int
+	if len(stores) == 0 {
+		return ss
+	}
+	_lock.Lock()
+	ix = _rand.Intn(len(stores))
+	_lock.Unlock()
+	for i = 0; i < len(stores); i++ {
+		ss = append(ss, stores[(ix+i)%len(stores)])
+	}
+	return ss
+}
@@ -0,0 +1,37 @@
+package region
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReadStores(t *testing.T) {
+	var ss []string
+	for i, c := range []struct {
+		stores []string
+		local  int
+		head   int // the local stores read first
+	}{
+		{[]string{"a", "b", "c"}, 1, 1},
+		{[]string{"a", "b", "c"}, 2, 2},
+		// no region
+		{[]string{"a", "b", "c"}, 0, 3},
+		{[]string{"a", "b", "c"}, 4, 3},
+		{nil, 0, 0},
+	} {
+		ss = ReadStores(c.stores, c.local)
+		if !sameStores(ss[:c.head], c.stores[:c.head]) || !sameStores(ss[c.head:], c.stores[c.head:]) {
+			t.Errorf("%d: ReadStores(%v, %d) got: %v", i, c.stores, c.local, ss)
+			t.FailNow()
+		}
+	}
+}
+
+// sameStores check the stores are the same in any order.
+func sameStores(a, b []string) bool {
+	var as, bs = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	return strings.Join(as, ",") == strings.Join(bs, ",")
+}
@@ -0,0 +1,141 @@
+// Package reqid correlates the logs of a request across the proxy, the
+// directory and the stores by the X-Request-ID header: the id of the client
+// is accepted or a new one generated, passed on to the calls, replied in
+// the response header, set to the span and logged by every server.
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"bfs/libs/trace"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	Header = "X-Request-ID"
+	// the grpc metadata key, lower case
+	metadataKey = "x-request-id"
+	// the span attribute
+	attrKey = "bfs.request_id"
+	// the longest id accepted from the client
+	maxSize = 64
+)
+
+type idKey struct{}
+
+// New generate a random request id.
+func New() string {
+	var b = make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether the id of the client is accepted, printable ascii
+// without spaces and not longer than maxSize.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxSize {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext new a context of the request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext get the request id of the context, empty if none.
+func FromContext(ctx context.Context) (id string) {
+	id, _ = ctx.Value(idKey{}).(string)
+	return
+}
+
+// Inject set the request id of ctx to the headers of the request.
+func Inject(ctx context.Context, req *http.Request) {
+	if id := FromContext(ctx); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// Handler get the request id of the caller, or generate one, the handlers
+// get it from the request context, it's replied in the response header and
+// set to the span, so trace.Handler must wrap it.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+		var id = r.Header.Get(Header)
+		if !Valid(id) {
+			id = New()
+		}
+		wr.Header().Set(Header, id)
+		trace.Set(r.Context(), attribute.String(attrKey, id))
+		h.ServeHTTP(wr, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// outgoing add the request id of ctx to the outgoing metadata.
+func outgoing(ctx context.Context) context.Context {
+	if id := FromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, metadataKey, id)
+	}
+	return ctx
+}
+
+// incoming get the request id of the grpc call, or generate one.
+func incoming(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vs := md.Get(metadataKey); len(vs) > 0 {
+			id = vs[0]
+		}
+	}
+	if !Valid(id) {
+		id = New()
+	}
+	trace.Set(ctx, attribute.String(attrKey, id))
+	return NewContext(ctx, id)
+}
+
+// UnaryClient pass the request id of the grpc calls by the metadata.
+func UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamClient pass the request id of the grpc streams by the metadata.
+func StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoing(ctx), desc, cc, method, opts...)
+}
+
+// UnaryServer get the request id of the grpc calls, after the trace one.
+func UnaryServer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(incoming(ctx), req)
+}
+
+// StreamServer get the request id of the grpc streams, after the trace one.
+func StreamServer(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	return handler(srv, &serverStream{ServerStream: ss, ctx: incoming(ss.Context())})
+}
+
+// serverStream a grpc stream with the request id.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,55 @@
+package reqid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var (
+		id  string
+		req *http.Request
+		wr  *httptest.ResponseRecorder
+		h   = Handler(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			id = FromContext(r.Context())
+		}))
+	)
+	// generated
+	wr = httptest.NewRecorder()
+	h.ServeHTTP(wr, httptest.NewRequest("PUT", "/b/f", nil))
+	if id == "" || wr.Header().Get(Header) != id {
+		t.Errorf("id: %s header: %s not match", id, wr.Header().Get(Header))
+		t.FailNow()
+	}
+	// accepted
+	wr = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/b/f", nil)
+	req.Header.Set(Header, "abc-123")
+	h.ServeHTTP(wr, req)
+	if id != "abc-123" || wr.Header().Get(Header) != id {
+		t.Errorf("id: %s not accepted", id)
+		t.FailNow()
+	}
+	// invalid, replaced
+	req.Header.Set(Header, strings.Repeat("a", maxSize+1))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if id == "" || len(id) > maxSize {
+		t.Errorf("id: %s not replaced", id)
+		t.FailNow()
+	}
+	// passed on
+	req, _ = http.NewRequest("POST", "http://127.0.0.1:6065/upload", nil)
+	Inject(context.Background(), req)
+	if req.Header.Get(Header) != "" {
+		t.Errorf("empty id injected")
+		t.FailNow()
+	}
+	Inject(NewContext(context.Background(), "abc-123"), req)
+	if req.Header.Get(Header) != "abc-123" {
+		t.Errorf("id not injected")
+		t.FailNow()
+	}
+}
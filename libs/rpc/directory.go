@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"bfs/libs/meta"
+	"bfs/libs/reqid"
+	"bfs/libs/trace"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	_directoryService = "bfs.Directory"
+)
+
+// GetRequest get or delete a file, the stores in the region first for get.
+type GetRequest struct {
+	Bucket   string `json:"bucket"`
+	Filename string `json:"filename"`
+	Region   string `json:"region,omitempty"`
+}
+
+// UploadRequest upload a file.
+type UploadRequest struct {
+	Bucket   string `json:"bucket"`
+	Filename string `json:"filename"`
+	Sha1     string `json:"sha1"`
+	Mine     string `json:"mine"`
+	MTime    int64  `json:"mtime"`
+	Size     int64  `json:"size"`
+	Name     string `json:"name,omitempty"`
+}
+
+// DirectoryServer the directory grpc service, the same as the http api, the
+// streaming variants reply every request in order.
+type DirectoryServer interface {
+	Get(context.Context, *GetRequest) (*meta.Response, error)
+	Upload(context.Context, *UploadRequest) (*meta.Response, error)
+	Del(context.Context, *GetRequest) (*meta.Response, error)
+	Gets(Directory_GetsServer) error
+	Uploads(Directory_UploadsServer) error
+}
+
+// Directory_GetsServer the server side of the Gets stream.
+type Directory_GetsServer interface {
+	Send(*meta.Response) error
+	Recv() (*GetRequest, error)
+	grpc.ServerStream
+}
+
+// Directory_UploadsServer the server side of the Uploads stream.
+type Directory_UploadsServer interface {
+	Send(*meta.Response) error
+	Recv() (*UploadRequest, error)
+	grpc.ServerStream
+}
+
+// RegisterDirectoryServer register the directory service.
+func RegisterDirectoryServer(s *grpc.Server, srv DirectoryServer) {
+	s.RegisterService(&_directoryServiceDesc, srv)
+}
+
+var _directoryServiceDesc = grpc.ServiceDesc{
+	ServiceName: _directoryService,
+	HandlerType: (*DirectoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: _directoryGetHandler},
+		{MethodName: "Upload", Handler: _directoryUploadHandler},
+		{MethodName: "Del", Handler: _directoryDelHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Gets", Handler: _directoryGetsHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "Uploads", Handler: _directoryUploadsHandler, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+func _directoryGetHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var in = new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DirectoryServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + _directoryService + "/Get"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DirectoryServer).Get(ctx, req.(*GetRequest))
+	})
+}
+
+func _directoryUploadHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var in = new(UploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DirectoryServer).Upload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + _directoryService + "/Upload"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DirectoryServer).Upload(ctx, req.(*UploadRequest))
+	})
+}
+
+func _directoryDelHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var in = new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DirectoryServer).Del(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + _directoryService + "/Del"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DirectoryServer).Del(ctx, req.(*GetRequest))
+	})
+}
+
+func _directoryGetsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DirectoryServer).Gets(&directoryGetsServer{stream})
+}
+
+func _directoryUploadsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DirectoryServer).Uploads(&directoryUploadsServer{stream})
+}
+
+type directoryGetsServer struct {
+	grpc.ServerStream
+}
+
+func (s *directoryGetsServer) Send(m *meta.Response) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *directoryGetsServer) Recv() (*GetRequest, error) {
+	var m = new(GetRequest)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type directoryUploadsServer struct {
+	grpc.ServerStream
+}
+
+func (s *directoryUploadsServer) Send(m *meta.Response) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *directoryUploadsServer) Recv() (*UploadRequest, error) {
+	var m = new(UploadRequest)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DirectoryClient the client of the directory grpc service.
+type DirectoryClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewDirectoryClient new a directory client on the connection.
+func NewDirectoryClient(cc *grpc.ClientConn) *DirectoryClient {
+	return &DirectoryClient{cc: cc}
+}
+
+// Dial dial the directory grpc service, the trace context and the request id
+// of the calls are passed by the metadata.
+func Dial(addr string) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.CallContentSubtype(Codec)),
+		grpc.WithChainUnaryInterceptor(trace.UnaryClient, reqid.UnaryClient),
+		grpc.WithChainStreamInterceptor(trace.StreamClient, reqid.StreamClient))
+}
+
+// Get get readable stores of a file.
+func (c *DirectoryClient) Get(ctx context.Context, in *GetRequest) (out *meta.Response, err error) {
+	out = new(meta.Response)
+	err = c.cc.Invoke(ctx, "/"+_directoryService+"/Get", in, out)
+	return
+}
+
+// Upload get writable stores for a file.
+func (c *DirectoryClient) Upload(ctx context.Context, in *UploadRequest) (out *meta.Response, err error) {
+	out = new(meta.Response)
+	err = c.cc.Invoke(ctx, "/"+_directoryService+"/Upload", in, out)
+	return
+}
+
+// Del get delable stores of a file.
+func (c *DirectoryClient) Del(ctx context.Context, in *GetRequest) (out *meta.Response, err error) {
+	out = new(meta.Response)
+	err = c.cc.Invoke(ctx, "/"+_directoryService+"/Del", in, out)
+	return
+}
+
+// Gets open a stream resolves many files, the responses are in the order
+// of the requests.
+func (c *DirectoryClient) Gets(ctx context.Context) (*DirectoryStream, error) {
+	return c.stream(ctx, 0)
+}
+
+// Uploads open a stream gets writable stores for many files.
+func (c *DirectoryClient) Uploads(ctx context.Context) (*DirectoryStream, error) {
+	return c.stream(ctx, 1)
+}
+
+func (c *DirectoryClient) stream(ctx context.Context, i int) (s *DirectoryStream, err error) {
+	var (
+		cs   grpc.ClientStream
+		desc = &_directoryServiceDesc.Streams[i]
+	)
+	if cs, err = c.cc.NewStream(ctx, desc, "/"+_directoryService+"/"+desc.StreamName); err != nil {
+		return
+	}
+	s = &DirectoryStream{cs}
+	return
+}
+
+// DirectoryStream the client side of the Gets and Uploads stream, Send a
+// *GetRequest to Gets, a *UploadRequest to Uploads.
+type DirectoryStream struct {
+	grpc.ClientStream
+}
+
+// Send send a request.
+func (s *DirectoryStream) Send(m interface{}) error {
+	return s.ClientStream.SendMsg(m)
+}
+
+// Recv receive the response of a request.
+func (s *DirectoryStream) Recv() (m *meta.Response, err error) {
+	m = new(meta.Response)
+	if err = s.ClientStream.RecvMsg(m); err != nil {
+		m = nil
+	}
+	return
+}
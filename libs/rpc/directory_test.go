@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"bfs/libs/meta"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+type testServer struct{}
+
+func (testServer) Get(ctx context.Context, in *GetRequest) (*meta.Response, error) {
+	return &meta.Response{Ret: 1, Filename: in.Filename, Vid: 1, Stores: []string{"localhost:6062"}}, nil
+}
+
+func (testServer) Upload(ctx context.Context, in *UploadRequest) (*meta.Response, error) {
+	return &meta.Response{Ret: 1, Filename: in.Filename, MTime: in.MTime}, nil
+}
+
+func (testServer) Del(ctx context.Context, in *GetRequest) (*meta.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s testServer) Gets(stream Directory_GetsServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		res, _ := s.Get(stream.Context(), in)
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func (testServer) Uploads(stream Directory_UploadsServer) error {
+	return nil
+}
+
+func TestDirectory(t *testing.T) {
+	var (
+		err    error
+		l      net.Listener
+		cc     *grpc.ClientConn
+		res    *meta.Response
+		stream *DirectoryStream
+		s      = grpc.NewServer()
+		ctx    = context.Background()
+	)
+	if l, err = net.Listen("tcp", "localhost:0"); err != nil {
+		t.Errorf("net.Listen() error(%v)", err)
+		t.FailNow()
+	}
+	RegisterDirectoryServer(s, testServer{})
+	go s.Serve(l)
+	defer s.Stop()
+	if cc, err = Dial(l.Addr().String()); err != nil {
+		t.Errorf("Dial() error(%v)", err)
+		t.FailNow()
+	}
+	defer cc.Close()
+	c := NewDirectoryClient(cc)
+	if res, err = c.Get(ctx, &GetRequest{Bucket: "test", Filename: "1.jpg"}); err != nil {
+		t.Errorf("Get() error(%v)", err)
+		t.FailNow()
+	}
+	if res.Ret != 1 || res.Filename != "1.jpg" || len(res.Stores) != 1 {
+		t.Errorf("Get() res: %+v", res)
+		t.FailNow()
+	}
+	if res, err = c.Upload(ctx, &UploadRequest{Bucket: "test", Filename: "1.jpg", MTime: 10}); err != nil || res.MTime != 10 {
+		t.Errorf("Upload() res: %+v error(%v)", res, err)
+		t.FailNow()
+	}
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = c.Del(tctx, &GetRequest{Bucket: "test", Filename: "1.jpg"}); err == nil {
+		t.Errorf("Del() deadline not exceeded")
+		t.FailNow()
+	}
+	if stream, err = c.Gets(ctx); err != nil {
+		t.Errorf("Gets() error(%v)", err)
+		t.FailNow()
+	}
+	for _, filename := range []string{"1.jpg", "2.jpg"} {
+		if err = stream.Send(&GetRequest{Bucket: "test", Filename: filename}); err != nil {
+			t.Errorf("Send() error(%v)", err)
+			t.FailNow()
+		}
+		if res, err = stream.Recv(); err != nil || res.Filename != filename {
+			t.Errorf("Recv() res: %+v error(%v)", res, err)
+			t.FailNow()
+		}
+	}
+	stream.CloseSend()
+	if _, err = stream.Recv(); err != io.EOF {
+		t.Errorf("Recv() error(%v), want EOF", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,103 @@
+package slow
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/reqid"
+	"bytes"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Log log the requests slower than the threshold with the time of their
+// phases, so the tail latency is found without tracing every request. a nil
+// Log logs nothing.
+type Log struct {
+	threshold time.Duration
+	count     uint64
+}
+
+// New new a slow log, nil if the threshold is not positive.
+func New(threshold time.Duration) *Log {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Log{threshold: threshold}
+}
+
+// Count get the slow requests logged.
+func (l *Log) Count() uint64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.count)
+}
+
+// phase a named part of a request.
+type phase struct {
+	name string
+	d    time.Duration
+}
+
+// Trace the phases of a request, a nil Trace records nothing.
+type Trace struct {
+	l      *Log
+	start  time.Time
+	last   time.Time
+	phases []phase
+}
+
+// Start start a trace of a request, nil if the log is nil.
+func (l *Log) Start() *Trace {
+	if l == nil {
+		return nil
+	}
+	var now = time.Now()
+	return &Trace{l: l, start: now, last: now}
+}
+
+// Phase end the phase since the last one, e.g. lookup, read or write.
+func (t *Trace) Phase(name string) {
+	if t == nil {
+		return
+	}
+	var now = time.Now()
+	t.phases = append(t.phases, phase{name: name, d: now.Sub(t.last)})
+	t.last = now
+}
+
+// End log the request if slower than the threshold, the time after the
+// last phase, usually the response written by the deferred writer, is the
+// reply phase.
+func (t *Trace) End(r *http.Request) {
+	var (
+		p      phase
+		d      time.Duration
+		n      uint64
+		params string
+		buf    bytes.Buffer
+	)
+	if t == nil {
+		return
+	}
+	if d = time.Since(t.start); d < t.l.threshold {
+		return
+	}
+	n = atomic.AddUint64(&t.l.count, 1)
+	if len(t.phases) > 0 {
+		t.Phase("reply")
+	}
+	for _, p = range t.phases {
+		buf.WriteByte(' ')
+		buf.WriteString(p.name)
+		buf.WriteByte(':')
+		buf.WriteString(p.d.String())
+	}
+	if r.Form != nil {
+		params = r.Form.Encode()
+	} else {
+		params = r.URL.RawQuery
+	}
+	log.Warningf("slow request(%d): %s path:%s(params:%s,time:%s,phases:%s,req_id:%s)", n, r.Method,
+		r.URL.Path, params, d, bytes.TrimSpace(buf.Bytes()), reqid.FromContext(r.Context()))
+}
@@ -0,0 +1,43 @@
+package slow
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlow(t *testing.T) {
+	var (
+		l  *Log
+		tr *Trace
+		r  = httptest.NewRequest("GET", "/get?vid=1", nil)
+	)
+	// nil records nothing
+	if l = New(0); l != nil {
+		t.Error("New(0) not nil")
+		t.FailNow()
+	}
+	tr = l.Start()
+	tr.Phase("read")
+	tr.End(r)
+	if l.Count() != 0 {
+		t.Errorf("count: %d not match", l.Count())
+		t.FailNow()
+	}
+	l = New(time.Millisecond)
+	tr = l.Start()
+	tr.Phase("read")
+	tr.End(r)
+	if l.Count() != 0 {
+		t.Errorf("count: %d not match", l.Count())
+		t.FailNow()
+	}
+	tr = l.Start()
+	time.Sleep(2 * time.Millisecond)
+	tr.Phase("read")
+	tr.End(r)
+	if l.Count() != 1 || len(tr.phases) != 2 || tr.phases[0].d < time.Millisecond {
+		t.Errorf("count: %d not match", l.Count())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,109 @@
+package stat
+
+import (
+	"sync"
+	"time"
+)
+
+// Point the stats of an interval, usually a minute, the rates are per
+// second and the delays are the averages of an operation in nanoseconds.
+type Point struct {
+	Time        int64  `json:"time"`
+	GetQPS      uint64 `json:"get_qps"`
+	WriteTPS    uint64 `json:"write_tps"`
+	DelTPS      uint64 `json:"del_tps"`
+	ReadFlow    uint64 `json:"read_flow"`
+	WriteFlow   uint64 `json:"write_flow"`
+	WriteErrors uint64 `json:"write_errors"`
+	GetDelay    uint64 `json:"get_delay"`
+	WriteDelay  uint64 `json:"write_delay"`
+	DelDelay    uint64 `json:"del_delay"`
+}
+
+// NewPoint new a point of the interval d ended at t by the totals of the
+// stats at the start and the end, a total gone down, such as the merged
+// totals after a volume deleted, counts as zero.
+func NewPoint(t time.Time, d time.Duration, start, end *Stats) (p *Point) {
+	var (
+		secs = uint64(d / time.Second)
+		sub  = func(a, b uint64) uint64 {
+			if a < b {
+				return 0
+			}
+			return a - b
+		}
+		avg = func(delay, n uint64) uint64 {
+			if n == 0 {
+				return 0
+			}
+			return delay / n
+		}
+		gets   = sub(end.TotalGetProcessed, start.TotalGetProcessed)
+		writes = sub(end.TotalWriteProcessed, start.TotalWriteProcessed)
+		dels   = sub(end.TotalDelProcessed, start.TotalDelProcessed)
+	)
+	if secs == 0 {
+		secs = 1
+	}
+	p = &Point{Time: t.Unix()}
+	p.GetQPS = gets / secs
+	p.WriteTPS = writes / secs
+	p.DelTPS = dels / secs
+	p.ReadFlow = sub(end.TotalReadBytes, start.TotalReadBytes) / secs
+	p.WriteFlow = sub(end.TotalWriteBytes, start.TotalWriteBytes) / secs
+	p.WriteErrors = sub(end.TotalWriteErrors, start.TotalWriteErrors)
+	p.GetDelay = avg(sub(end.TotalGetDelay, start.TotalGetDelay), gets)
+	p.WriteDelay = avg(sub(end.TotalWriteDelay, start.TotalWriteDelay), writes)
+	p.DelDelay = avg(sub(end.TotalDelDelay, start.TotalDelDelay), dels)
+	return
+}
+
+// History a ring of the latest points.
+type History struct {
+	lock   sync.RWMutex
+	points []*Point
+	next   int
+	full   bool
+}
+
+// NewHistory new a history of the latest n points.
+func NewHistory(n int) *History {
+	return &History{points: make([]*Point, n)}
+}
+
+// Add add a point, the oldest is dropped if full.
+func (h *History) Add(p *Point) {
+	h.lock.Lock()
+	if len(h.points) > 0 {
+		h.points[h.next] = p
+		if h.next++; h.next == len(h.points) {
+			h.next, h.full = 0, true
+		}
+	}
+	h.lock.Unlock()
+}
+
+// Points get the points since the unix time, the oldest first.
+func (h *History) Points(since int64) (ps []*Point) {
+	var (
+		i, n int
+		p    *Point
+	)
+	h.lock.RLock()
+	if n = h.next; h.full {
+		n = len(h.points)
+	}
+	ps = make([]*Point, 0, n)
+	for i = 0; i < n; i++ {
+		if h.full {
+			p = h.points[(h.next+i)%len(h.points)]
+		} else {
+			p = h.points[i]
+		}
+		if p.Time >= since {
+			ps = append(ps, p)
+		}
+	}
+	h.lock.RUnlock()
+	return
+}
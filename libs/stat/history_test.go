@@ -0,0 +1,37 @@
+package stat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	var (
+		i  int64
+		ps []*Point
+		p  *Point
+		h  = NewHistory(3)
+		s  = &Stats{}
+		s1 = &Stats{TotalGetProcessed: 120, TotalGetDelay: 1200}
+	)
+	if p = NewPoint(time.Unix(60, 0), time.Minute, s, s1); p.GetQPS != 2 || p.GetDelay != 10 {
+		t.Errorf("point: %v not match", p)
+		t.FailNow()
+	}
+	// a total gone down counts as zero
+	if p = NewPoint(time.Unix(60, 0), time.Minute, s1, s); p.GetQPS != 0 || p.GetDelay != 0 {
+		t.Errorf("point: %v not match", p)
+		t.FailNow()
+	}
+	for i = 1; i <= 5; i++ {
+		h.Add(&Point{Time: i})
+	}
+	if ps = h.Points(0); len(ps) != 3 || ps[0].Time != 3 || ps[2].Time != 5 {
+		t.Errorf("points: %d not match", len(ps))
+		t.FailNow()
+	}
+	if ps = h.Points(5); len(ps) != 1 || ps[0].Time != 5 {
+		t.Errorf("points: %d not match", len(ps))
+		t.FailNow()
+	}
+}
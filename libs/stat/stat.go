@@ -24,6 +24,10 @@ type Stats struct {
 	FlushTPS                uint64 `json:"flush_tps"`
 	lastTotalFlushProcessed uint64 `json:"-"`
 	TotalCompactProcessed   uint64 `json:"total_compact_processed"`
+	// errors
+	TotalWriteErrors     uint64 `json:"total_write_errors"`
+	WriteErrors          uint64 `json:"write_errors"`
+	lastTotalWriteErrors uint64 `json:"-"`
 	// bytes
 	TotalTransferedBytes     uint64 `json:"total_transfered_bytes"`
 	TransferedFlow           uint64 `json:"transfered_flow"`
@@ -70,6 +74,9 @@ func (s *Stats) Calc() {
 	s.TotalCommandsProcessed = s.TotalWriteProcessed + s.TotalDelProcessed +
 		s.TotalGetProcessed + s.TotalFlushProcessed +
 		s.TotalCompactProcessed
+	// errors
+	s.WriteErrors = s.TotalWriteErrors - s.lastTotalWriteErrors
+	s.lastTotalWriteErrors = s.TotalWriteErrors
 	// bytes
 	s.ReadFlow = s.TotalReadBytes - s.lastTotalReadBytes
 	s.lastTotalReadBytes = s.TotalReadBytes
@@ -104,6 +111,8 @@ func (s *Stats) Merge(s1 *Stats) {
 	s.TotalGetProcessed += s1.TotalGetProcessed
 	s.TotalFlushProcessed += s1.TotalFlushProcessed
 	s.TotalCompactProcessed += s1.TotalCompactProcessed
+	// errors
+	s.TotalWriteErrors += s1.TotalWriteErrors
 	// bytes
 	s.TotalReadBytes += s1.TotalReadBytes
 	s.TotalWriteBytes += s1.TotalWriteBytes
@@ -124,6 +133,8 @@ func (s *Stats) Reset() {
 	s.TotalGetProcessed = 0
 	s.TotalFlushProcessed = 0
 	s.TotalCompactProcessed = 0
+	// errors
+	s.TotalWriteErrors = 0
 	// bytes
 	s.TotalReadBytes = 0
 	s.TotalWriteBytes = 0
@@ -148,6 +159,8 @@ type Info struct {
 	TotalConnectionsReceived uint64 `json:"total_connections_received"`
 	ConnectedClients         uint64 `json:"connected_clients"`
 	BlockedClients           uint64 `json:"blocked_clients"`
+	// the requests slower than the slow log threshold
+	SlowRequests uint64 `json:"slow_requests"`
 	// stats
 	Stats *Stats `json:"stats"`
 }
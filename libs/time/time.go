@@ -43,3 +43,8 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	}
 	return err
 }
+
+// MarshalText marshal duration to text, like 1s, 500ms.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(xtime.Duration(d).String()), nil
+}
@@ -0,0 +1,106 @@
+package time
+
+import (
+	"fmt"
+	"strings"
+	xtime "time"
+)
+
+var (
+	_weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// Window a weekly time window, like "Mon-Fri 01:00-06:00", the days are the
+// ranges or the lists of Sun to Sat, or "*" for every day, a window ends the
+// next day if the end is not after the start, e.g. "* 22:00-06:00".
+type Window struct {
+	days  [7]bool
+	start int // the minutes of the day
+	end   int
+}
+
+// ParseWindow parse a window.
+func ParseWindow(s string) (w *Window, err error) {
+	var fields = strings.Fields(s)
+	w = new(Window)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("window: \"%s\" not \"days hh:mm-hh:mm\"", s)
+	}
+	if err = w.parseDays(fields[0]); err != nil {
+		return nil, fmt.Errorf("window: \"%s\" %v", s, err)
+	}
+	if err = w.parseTimes(fields[1]); err != nil {
+		return nil, fmt.Errorf("window: \"%s\" %v", s, err)
+	}
+	return
+}
+
+// parseDays parse the days, like "*", "Sat,Sun" or "Mon-Fri".
+func (w *Window) parseDays(s string) (err error) {
+	var (
+		ok          bool
+		i, from, to int
+		ds          []string
+	)
+	if s == "*" {
+		for i = range w.days {
+			w.days[i] = true
+		}
+		return
+	}
+	for _, d := range strings.Split(strings.ToLower(s), ",") {
+		ds = strings.SplitN(d, "-", 2)
+		if from, ok = _weekdays[ds[0]]; !ok {
+			return fmt.Errorf("bad day: %s", ds[0])
+		}
+		to = from
+		if len(ds) == 2 {
+			if to, ok = _weekdays[ds[1]]; !ok {
+				return fmt.Errorf("bad day: %s", ds[1])
+			}
+		}
+		for i = from; ; i = (i + 1) % 7 {
+			w.days[i] = true
+			if i == to {
+				break
+			}
+		}
+	}
+	return
+}
+
+// parseTimes parse the start and the end, like "01:00-06:00".
+func (w *Window) parseTimes(s string) (err error) {
+	var ts = strings.SplitN(s, "-", 2)
+	if len(ts) != 2 {
+		return fmt.Errorf("bad times: %s", s)
+	}
+	if w.start, err = parseClock(ts[0]); err != nil {
+		return
+	}
+	w.end, err = parseClock(ts[1])
+	return
+}
+
+// parseClock parse "hh:mm" to the minutes of the day, "24:00" is the end of
+// the day.
+func parseClock(s string) (m int, err error) {
+	var h, n int
+	if _, err = fmt.Sscanf(s, "%d:%d", &h, &n); err != nil || h < 0 || n < 0 || n > 59 || h*60+n > 24*60 {
+		return 0, fmt.Errorf("bad time: %s", s)
+	}
+	return h*60 + n, nil
+}
+
+// In reports whether t is in the window, by the local time.
+func (w *Window) In(t xtime.Time) bool {
+	var (
+		m = t.Hour()*60 + t.Minute()
+		d = int(t.Weekday())
+	)
+	if w.start < w.end {
+		return w.days[d] && m >= w.start && m < w.end
+	}
+	// started the day before
+	return (w.days[d] && m >= w.start) || (w.days[(d+6)%7] && m < w.end)
+}
@@ -0,0 +1,50 @@
+package time
+
+import (
+	"testing"
+	xtime "time"
+)
+
+func TestWindow(t *testing.T) {
+	var (
+		w   *Window
+		err error
+		// 2016-10-17 is a Monday
+		at = func(day, h, m int) xtime.Time {
+			return xtime.Date(2016, 10, 16+day, h, m, 0, 0, xtime.Local)
+		}
+		cases = []struct {
+			window string
+			t      xtime.Time
+			in     bool
+		}{
+			{"Mon-Fri 01:00-06:00", at(1, 1, 0), true},
+			{"Mon-Fri 01:00-06:00", at(1, 6, 0), false},
+			{"Mon-Fri 01:00-06:00", at(0, 2, 0), false},
+			{"Sat,Sun 00:00-24:00", at(6, 23, 59), true},
+			{"Fri-Mon 00:00-24:00", at(0, 12, 0), true},
+			{"Fri-Mon 00:00-24:00", at(3, 12, 0), false},
+			{"* 22:00-06:00", at(3, 23, 0), true},
+			{"* 22:00-06:00", at(3, 5, 59), true},
+			{"* 22:00-06:00", at(3, 12, 0), false},
+			{"Sun 22:00-06:00", at(1, 5, 0), true},
+			{"Sun 22:00-06:00", at(2, 5, 0), false},
+		}
+	)
+	for _, c := range cases {
+		if w, err = ParseWindow(c.window); err != nil {
+			t.Errorf("ParseWindow(%s) error(%v)", c.window, err)
+			t.FailNow()
+		}
+		if w.In(c.t) != c.in {
+			t.Errorf("window: %s at %v in: %t", c.window, c.t, !c.in)
+			t.FailNow()
+		}
+	}
+	for _, s := range []string{"", "Mon", "Mon 01:00", "Foo 01:00-02:00", "* 25:00-26:00", "* 01:60-02:00"} {
+		if _, err = ParseWindow(s); err == nil {
+			t.Errorf("ParseWindow(%s) passed", s)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package trace is the distributed tracing of bfs by OpenTelemetry, the
+// spans of a request are passed proxy -> directory -> store by the w3c
+// trace context headers, and exported to an OTLP receiver, e.g. jaeger.
+package trace
+
+import (
+	"bfs/libs/log"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	_tracer     = otel.Tracer("bfs")
+	_propagator = propagation.TraceContext{}
+	_provider   *sdktrace.TracerProvider
+)
+
+// Config the tracing, the spans are exported to the OTLP http receiver.
+type Config struct {
+	// host:port of the OTLP http receiver, e.g. jaeger "localhost:4318"
+	Endpoint string
+	// plain http to the receiver
+	Insecure bool
+	// the ratio of the new traces sampled, 0 means all, the traces of the
+	// callers follow their sampling
+	Ratio float64
+}
+
+// Check check the endpoint and the ratio.
+func (c *Config) Check() (err error) {
+	if c.Endpoint == "" {
+		return fmt.Errorf("Endpoint: must be set")
+	}
+	if c.Ratio < 0 || c.Ratio > 1 {
+		return fmt.Errorf("Ratio: %v out of [0, 1]", c.Ratio)
+	}
+	return
+}
+
+// Init export the spans of the service, a nil config exports nothing but
+// the trace context of the callers is still passed on.
+func Init(c *Config, service string) (err error) {
+	var (
+		exp     sdktrace.SpanExporter
+		sampler = sdktrace.AlwaysSample()
+		opts    []otlptracehttp.Option
+	)
+	otel.SetTextMapPropagator(_propagator)
+	if c == nil {
+		return
+	}
+	opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if exp, err = otlptracehttp.New(context.Background(), opts...); err != nil {
+		log.Errorf("otlptracehttp.New(\"%s\") error(%v)", c.Endpoint, err)
+		return
+	}
+	if c.Ratio > 0 {
+		sampler = sdktrace.TraceIDRatioBased(c.Ratio)
+	}
+	_provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(_provider)
+	return
+}
+
+// Close export the spans left, at most a few seconds.
+func Close() {
+	var (
+		err    error
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if _provider == nil {
+		return
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = _provider.Shutdown(ctx); err != nil {
+		log.Errorf("trace shutdown error(%v)", err)
+	}
+}
+
+// Handler trace the requests of h, the span of a request is the child of
+// the caller one in the headers, the handlers get it from the request
+// context.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+		var (
+			span otrace.Span
+			ctx  = _propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		)
+		ctx, span = _tracer.Start(ctx, r.URL.Path, otrace.WithSpanKind(otrace.SpanKindServer),
+			otrace.WithAttributes(attribute.String("http.method", r.Method)))
+		defer span.End()
+		h.ServeHTTP(wr, r.WithContext(ctx))
+	})
+}
+
+// Start start a child span of ctx, e.g. a phase of the request, the span
+// must be ended.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, otrace.Span) {
+	return _tracer.Start(ctx, name, otrace.WithAttributes(attrs...))
+}
+
+// Client start a span of a call to another server, the span must be ended.
+func Client(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, otrace.Span) {
+	return _tracer.Start(ctx, name, otrace.WithSpanKind(otrace.SpanKindClient), otrace.WithAttributes(attrs...))
+}
+
+// Set set the attributes of the span of ctx, e.g. the store and volume.
+func Set(ctx context.Context, attrs ...attribute.KeyValue) {
+	otrace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// End end the span, marked failed if err.
+func End(span otrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject pass the trace context of ctx to the server by the request headers.
+func Inject(ctx context.Context, req *http.Request) {
+	_propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// metadataCarrier the grpc metadata as the carrier of the trace context.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if vs := metadata.MD(c).Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() (keys []string) {
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return
+}
+
+// UnaryClient pass the trace context of the grpc calls by the metadata.
+func UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+	var span otrace.Span
+	ctx, span = Client(ctx, method)
+	err = invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	End(span, err)
+	return
+}
+
+// StreamClient pass the trace context of the grpc streams by the metadata.
+func StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoing(ctx), desc, cc, method, opts...)
+}
+
+// outgoing add the trace context of ctx to the outgoing metadata.
+func outgoing(ctx context.Context) context.Context {
+	var md, _ = metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	_propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// incoming get the span of the grpc call, the child of the caller one in
+// the metadata.
+func incoming(ctx context.Context, method string) (context.Context, otrace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = _propagator.Extract(ctx, metadataCarrier(md))
+	}
+	return _tracer.Start(ctx, method, otrace.WithSpanKind(otrace.SpanKindServer))
+}
+
+// UnaryServer trace the grpc calls.
+func UnaryServer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (res interface{}, err error) {
+	var span otrace.Span
+	ctx, span = incoming(ctx, info.FullMethod)
+	res, err = handler(ctx, req)
+	End(span, err)
+	return
+}
+
+// StreamServer trace the grpc streams, the span covers the whole stream.
+func StreamServer(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+	var (
+		span otrace.Span
+		ctx  context.Context
+	)
+	ctx, span = incoming(ss.Context(), info.FullMethod)
+	err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	End(span, err)
+	return
+}
+
+// serverStream a grpc stream with the traced context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
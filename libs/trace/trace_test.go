@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	otrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTrace(t *testing.T) {
+	var (
+		err  error
+		req  *http.Request
+		resp *http.Response
+		md   metadata.MD
+		got  otrace.TraceID
+		sc   = otrace.NewSpanContext(otrace.SpanContextConfig{
+			TraceID:    otrace.TraceID{1, 2, 3},
+			SpanID:     otrace.SpanID{4, 5, 6},
+			TraceFlags: otrace.FlagsSampled,
+		})
+		ctx = otrace.ContextWithRemoteSpanContext(context.Background(), sc)
+		srv = httptest.NewServer(Handler(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			got = otrace.SpanContextFromContext(r.Context()).TraceID()
+		})))
+	)
+	defer srv.Close()
+	if err = Init(nil, "test"); err != nil {
+		t.Errorf("Init() error(%v)", err)
+		t.FailNow()
+	}
+	if req, err = http.NewRequest("GET", srv.URL+"/get", nil); err != nil {
+		t.Errorf("http.NewRequest() error(%v)", err)
+		t.FailNow()
+	}
+	Inject(ctx, req)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Errorf("http.Do() error(%v)", err)
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if got != sc.TraceID() {
+		t.Errorf("trace id: %s not match", got)
+		t.FailNow()
+	}
+	// grpc
+	md, _ = metadata.FromOutgoingContext(outgoing(ctx))
+	ctx, _ = incoming(metadata.NewIncomingContext(context.Background(), md), "/bfs.Directory/Get")
+	if got = otrace.SpanContextFromContext(ctx).TraceID(); got != sc.TraceID() {
+		t.Errorf("grpc trace id: %s not match", got)
+		t.FailNow()
+	}
+	if err = (&Config{Endpoint: "localhost:4318", Ratio: 2}).Check(); err == nil {
+		t.Error("ratio 2 passed the check")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,203 @@
+// Package upgrade is the zero-downtime upgrade of a binary in place, the
+// old process starts the new binary with its listening sockets, waits for
+// it to be ready, then drains its requests and exits, the new process
+// accepts on the same sockets, so no connection is refused.
+package upgrade
+
+import (
+	"bfs/libs/log"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the addrs of the inherited listeners, in the order of their fds
+	_envListeners = "BFS_UPGRADE_LISTENERS"
+	// the fd of the pipe written when the new process is ready
+	_envReady = "BFS_UPGRADE_READY"
+	// the first inherited fd, after stdin, stdout and stderr
+	_firstFd = 3
+)
+
+var (
+	// ErrNotListener the listener has no file, e.g. unix or tls.
+	ErrNotListener = errors.New("upgrade: listener has no file")
+	// ErrExited the new process exited before ready.
+	ErrExited = errors.New("upgrade: new process exited before ready")
+	// ErrTimeout the new process is not ready in time, it is killed.
+	ErrTimeout = errors.New("upgrade: new process not ready in time")
+
+	_inherited = make(map[string]*os.File)
+	_ready     *os.File
+)
+
+func init() {
+	var (
+		i    int
+		fd   uint64
+		err  error
+		addr string
+	)
+	if v := os.Getenv(_envListeners); v != "" {
+		for i, addr = range strings.Split(v, ",") {
+			_inherited[addr] = os.NewFile(uintptr(_firstFd+i), addr)
+		}
+	}
+	if v := os.Getenv(_envReady); v != "" {
+		if fd, err = strconv.ParseUint(v, 10, 32); err == nil {
+			_ready = os.NewFile(uintptr(fd), "upgrade-ready")
+		}
+	}
+	os.Unsetenv(_envListeners)
+	os.Unsetenv(_envReady)
+}
+
+// fileListener a listener the fd of which can be passed to a process.
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Inherited reports whether the process is started by an upgrade.
+func Inherited() bool {
+	return _ready != nil
+}
+
+// Listen listen on the tcp addr, the socket inherited from the old process
+// is used if any.
+func Listen(addr string) (l net.Listener, err error) {
+	var (
+		ok bool
+		f  *os.File
+	)
+	if f, ok = _inherited[addr]; ok {
+		delete(_inherited, addr)
+		l, err = net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Errorf("net.FileListener(%s) error(%v)", addr, err)
+		}
+		return
+	}
+	if l, err = net.Listen("tcp", addr); err != nil {
+		log.Errorf("net.Listen(%s) error(%v)", addr, err)
+	}
+	return
+}
+
+// Ready tell the old process the new one is ready, the old one then drains
+// and exits, nothing if the process is not started by an upgrade.
+func Ready() (err error) {
+	if _ready == nil {
+		return
+	}
+	if _, err = _ready.Write([]byte{1}); err != nil {
+		log.Errorf("upgrade ready error(%v)", err)
+	}
+	_ready.Close()
+	_ready = nil
+	// the listeners not used by the new config
+	for addr, f := range _inherited {
+		f.Close()
+		delete(_inherited, addr)
+	}
+	return
+}
+
+// Files dup the fds of the listeners by the addrs, so the listeners can be
+// closed while the new process is started.
+func Files(ls map[string]net.Listener) (fs map[string]*os.File, err error) {
+	var (
+		ok   bool
+		addr string
+		f    *os.File
+		l    net.Listener
+		fl   fileListener
+	)
+	fs = make(map[string]*os.File, len(ls))
+	for addr, l = range ls {
+		if fl, ok = l.(fileListener); !ok {
+			err = ErrNotListener
+		} else if f, err = fl.File(); err != nil {
+			log.Errorf("listener(%s).File() error(%v)", addr, err)
+		}
+		if err != nil {
+			Close(fs)
+			return nil, err
+		}
+		fs[addr] = f
+	}
+	return
+}
+
+// Close close the dup fds.
+func Close(fs map[string]*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
+
+// Start start the new binary of the same path and args with the fds of the
+// listeners, and wait until it is ready, the new process is killed if not
+// ready in the timeout.
+func Start(fs map[string]*os.File, timeout time.Duration) (p *os.Process, err error) {
+	var (
+		path  string
+		addrs []string
+		files []*os.File
+		r, w  *os.File
+		env   []string
+		ch    = make(chan error, 1)
+	)
+	if path, err = os.Executable(); err != nil {
+		log.Errorf("os.Executable() error(%v)", err)
+		return
+	}
+	files = []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	for addr, f := range fs {
+		addrs = append(addrs, addr)
+		files = append(files, f)
+	}
+	if r, w, err = os.Pipe(); err != nil {
+		log.Errorf("os.Pipe() error(%v)", err)
+		return
+	}
+	defer r.Close()
+	env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", _envListeners, strings.Join(addrs, ",")),
+		fmt.Sprintf("%s=%d", _envReady, len(files)))
+	files = append(files, w)
+	p, err = os.StartProcess(path, os.Args, &os.ProcAttr{Env: env, Files: files})
+	w.Close()
+	if err != nil {
+		log.Errorf("os.StartProcess(\"%s\") error(%v)", path, err)
+		return
+	}
+	go func() {
+		// EOF if the new process exits before ready
+		var b = make([]byte, 1)
+		if _, err := r.Read(b); err != nil {
+			ch <- ErrExited
+			return
+		}
+		ch <- nil
+	}()
+	select {
+	case err = <-ch:
+	case <-time.After(timeout):
+		p.Kill()
+		err = ErrTimeout
+	}
+	if err != nil {
+		log.Errorf("upgrade: new process(%d) error(%v)", p.Pid, err)
+		go p.Wait()
+		p = nil
+		return
+	}
+	log.Infof("upgrade: new process(%d) ready", p.Pid)
+	return
+}
@@ -0,0 +1,58 @@
+package upgrade
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// the new process of TestUpgrade
+	if Inherited() {
+		for addr := range _inherited {
+			if _, err := Listen(addr); err != nil {
+				os.Exit(1)
+			}
+		}
+		Ready()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestUpgrade(t *testing.T) {
+	var (
+		err error
+		l   net.Listener
+		fs  map[string]*os.File
+		p   *os.Process
+		ps  *os.ProcessState
+	)
+	if Inherited() {
+		t.Error("inherited without upgrade")
+		t.FailNow()
+	}
+	if err = Ready(); err != nil {
+		t.Errorf("Ready() error(%v)", err)
+		t.FailNow()
+	}
+	if l, err = Listen("127.0.0.1:0"); err != nil {
+		t.Errorf("Listen() error(%v)", err)
+		t.FailNow()
+	}
+	defer l.Close()
+	if fs, err = Files(map[string]net.Listener{l.Addr().String(): l}); err != nil {
+		t.Errorf("Files() error(%v)", err)
+		t.FailNow()
+	}
+	defer Close(fs)
+	if p, err = Start(fs, 10*time.Second); err != nil {
+		t.Errorf("Start() error(%v)", err)
+		t.FailNow()
+	}
+	if ps, err = p.Wait(); err != nil || !ps.Success() {
+		t.Errorf("new process: %v error(%v)", ps, err)
+		t.FailNow()
+	}
+}
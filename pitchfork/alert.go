@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bfs/libs/addr"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/pitchfork/conf"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// alert kind
+	alertStoreDown      = "store_down"
+	alertStoreReadOnly  = "store_readonly"
+	alertStoreDegraded  = "store_degraded"
+	alertVolumeReadOnly = "volume_readonly"
+	// alert status
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+
+	_alertChanSize = 1024
+)
+
+// Alert a state transition of a store or a volume of it.
+type Alert struct {
+	Kind    string `json:"kind"`
+	Status  string `json:"status"`
+	Store   string `json:"store"`
+	Volume  int32  `json:"volume,omitempty"`
+	Host    string `json:"host"`
+	Message string `json:"message"`
+	Time    int64  `json:"time"`
+}
+
+// Alerter post the alerts to the webhooks and mail, an alert keeps firing
+// is only repeated every repeat interval. a nil Alerter alerts nothing.
+type Alerter struct {
+	c      *conf.Alert
+	client *http.Client
+	lock   sync.Mutex
+	fired  map[string]time.Time // kind_store_volume:last fired
+	ch     chan *Alert
+}
+
+// NewAlerter new an alerter, nil if not configured.
+func NewAlerter(c *conf.Config) (a *Alerter) {
+	if c.Alert == nil {
+		return nil
+	}
+	a = &Alerter{c: c.Alert}
+	a.client = &http.Client{Timeout: c.Alert.Timeout.Duration}
+	a.fired = make(map[string]time.Time)
+	a.ch = make(chan *Alert, _alertChanSize)
+	go a.sendproc()
+	return
+}
+
+// check fire or resolve the alert by the state of the store or the volume,
+// the volume is 0 for the store alerts.
+func (a *Alerter) check(kind string, store *meta.Store, vid int32, firing bool, msg string) {
+	var (
+		ok   bool
+		last time.Time
+		now  = time.Now()
+		key  = fmt.Sprintf("%s_%s_%d", kind, store.Id, vid)
+		al   *Alert
+	)
+	if a == nil {
+		return
+	}
+	a.lock.Lock()
+	last, ok = a.fired[key]
+	if firing && (!ok || now.Sub(last) >= a.c.Repeat.Duration) {
+		a.fired[key] = now
+		al = &Alert{Kind: kind, Status: alertFiring, Store: store.Id, Volume: vid, Host: store.Stat, Message: msg, Time: now.Unix()}
+	} else if !firing && ok {
+		delete(a.fired, key)
+		al = &Alert{Kind: kind, Status: alertResolved, Store: store.Id, Volume: vid, Host: store.Stat, Time: now.Unix()}
+	}
+	a.lock.Unlock()
+	if al == nil {
+		return
+	}
+	select {
+	case a.ch <- al:
+	default:
+		log.Errorf("alert chan full, drop alert: %s %s store: %s volume: %d", al.Kind, al.Status, al.Store, al.Volume)
+	}
+}
+
+// Store check all the alerts of the store.
+func (a *Alerter) Store(store *meta.Store) {
+	a.check(alertStoreDown, store, 0, store.Status == meta.StoreStatusFail, "store can not read or write")
+	a.check(alertStoreReadOnly, store, 0, store.Status == meta.StoreStatusRead, "store is read-only")
+	a.check(alertStoreDegraded, store, 0, store.Degraded, "store probe latency breached")
+}
+
+// Volume check the alerts of the volume of the store, read-only once the
+// block is full or the quota reached.
+func (a *Alerter) Volume(store *meta.Store, volume *meta.Volume) {
+	a.check(alertVolumeReadOnly, store, volume.Id, volume.Full(), "volume is read-only, full or quota reached")
+}
+
+// sendproc send the alerts one by one.
+func (a *Alerter) sendproc() {
+	var (
+		err  error
+		hook string
+		al   *Alert
+	)
+	for {
+		al = <-a.ch
+		log.Warningf("alert: %s %s store: %s volume: %d host: %s", al.Kind, al.Status, al.Store, al.Volume, al.Host)
+		for _, hook = range a.c.Webhooks {
+			if err = a.post(hook, al); err != nil {
+				log.Errorf("alert post(%s) error(%v)", hook, err)
+			}
+		}
+		if a.c.Smtp != nil {
+			if err = a.mail(al); err != nil {
+				log.Errorf("alert mail(%v) error(%v)", a.c.Smtp.To, err)
+			}
+		}
+	}
+}
+
+// post post the alert json to the webhook.
+func (a *Alerter) post(hook string, al *Alert) (err error) {
+	var (
+		body []byte
+		resp *http.Response
+	)
+	if body, err = json.Marshal(al); err != nil {
+		return
+	}
+	if resp, err = a.client.Post(hook, "application/json", bytes.NewReader(body)); err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("http status: %d", resp.StatusCode)
+	}
+	return
+}
+
+// mail send the alert mail.
+func (a *Alerter) mail(al *Alert) (err error) {
+	var (
+		auth    smtp.Auth
+		c       = a.c.Smtp
+		subject = fmt.Sprintf("[bfs] %s %s: %s", al.Status, al.Kind, al.Store)
+		msg     string
+	)
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, addr.Host(c.Addr))
+	}
+	msg = fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\nstore: %s\r\nvolume: %d\r\nhost: %s\r\nstatus: %s\r\nmessage: %s\r\ntime: %s\r\n",
+		c.From, strings.Join(c.To, ","), subject, al.Store, al.Volume, al.Host, al.Status, al.Message,
+		time.Unix(al.Time, 0).Format(time.RFC3339))
+	return smtp.SendMail(c.Addr, auth, c.From, c.To, []byte(msg))
+}
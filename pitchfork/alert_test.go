@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"bfs/libs/meta"
+	"bfs/pitchfork/conf"
+)
+
+func TestAlerterCheck(t *testing.T) {
+	var (
+		al    *Alert
+		a     = &Alerter{c: &conf.Alert{}, fired: make(map[string]time.Time), ch: make(chan *Alert, 16)}
+		store = &meta.Store{Id: "s1", Stat: "localhost:6062"}
+	)
+	a.c.Repeat.Duration = time.Minute
+	for i, c := range []struct {
+		name   string
+		kind   string
+		vid    int32
+		firing bool
+		ago    time.Duration // the last fired before
+		status string        // empty if no alert
+	}{
+		{"firing", alertStoreDown, 0, true, 0, alertFiring},
+		{"repeat within", alertStoreDown, 0, true, 0, ""},
+		{"repeat within, nearly", alertStoreDown, 0, true, 59 * time.Second, ""},
+		{"repeat after", alertStoreDown, 0, true, time.Minute, alertFiring},
+		{"other kind", alertStoreReadOnly, 0, true, 0, alertFiring},
+		{"resolving", alertStoreDown, 0, false, 0, alertResolved},
+		{"resolved", alertStoreDown, 0, false, 0, ""},
+		{"firing again", alertStoreDown, 0, true, 0, alertFiring},
+		{"volume firing", alertVolumeReadOnly, 1, true, 0, alertFiring},
+		{"other volume", alertVolumeReadOnly, 2, true, 0, alertFiring},
+		{"volume repeat within", alertVolumeReadOnly, 1, true, 0, ""},
+		{"volume resolving", alertVolumeReadOnly, 1, false, 0, alertResolved},
+		{"other volume repeat within", alertVolumeReadOnly, 2, true, 0, ""},
+	} {
+		key := fmt.Sprintf("%s_%s_%d", c.kind, store.Id, c.vid)
+		if last, ok := a.fired[key]; ok {
+			a.fired[key] = last.Add(-c.ago)
+		}
+		a.check(c.kind, store, c.vid, c.firing, "msg")
+		select {
+		case al = <-a.ch:
+		default:
+			al = nil
+		}
+		if c.status == "" {
+			if al != nil {
+				t.Errorf("%d %s: unexpected alert: %v", i, c.name, al)
+				t.FailNow()
+			}
+			continue
+		}
+		if al == nil || al.Kind != c.kind || al.Status != c.status || al.Store != store.Id || al.Volume != c.vid {
+			t.Errorf("%d %s: alert: %v, want kind: %s status: %s volume: %d", i, c.name, al, c.kind, c.status, c.vid)
+			t.FailNow()
+		}
+	}
+}
+
+func TestAlerterVolume(t *testing.T) {
+	var (
+		al    *Alert
+		a     = &Alerter{c: &conf.Alert{}, fired: make(map[string]time.Time), ch: make(chan *Alert, 16)}
+		store = &meta.Store{Id: "s1", Stat: "localhost:6062"}
+	)
+	a.c.Repeat.Duration = time.Minute
+	a.Volume(store, &meta.Volume{Id: 3, Block: &meta.SuperBlock{Padding: 8, Size: 1024}})
+	if len(a.ch) != 0 {
+		t.Errorf("writable volume alerted")
+		t.FailNow()
+	}
+	// the quota reached
+	a.Volume(store, &meta.Volume{Id: 3, Block: &meta.SuperBlock{Padding: 8, Size: 1024}, Quota: 1024})
+	if al = <-a.ch; al.Kind != alertVolumeReadOnly || al.Status != alertFiring || al.Volume != 3 {
+		t.Errorf("alert: %v, want volume read-only firing", al)
+		t.FailNow()
+	}
+	// the quota raised
+	a.Volume(store, &meta.Volume{Id: 3, Block: &meta.SuperBlock{Padding: 8, Size: 1024}, Quota: 1 << 30})
+	if al = <-a.ch; al.Kind != alertVolumeReadOnly || al.Status != alertResolved || al.Volume != 3 {
+		t.Errorf("alert: %v, want volume read-only resolved", al)
+		t.FailNow()
+	}
+	// a nil alerter alerts nothing
+	a = nil
+	a.Volume(store, &meta.Volume{Id: 3, Block: &meta.SuperBlock{Padding: 8}, Quota: 1})
+}
@@ -1,8 +1,11 @@
 package conf
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
 	"github.com/BurntSushi/toml"
 	"io/ioutil"
+	"math"
 	"os"
 	"time"
 )
@@ -10,6 +13,14 @@ import (
 type Config struct {
 	Store     *Store
 	Zookeeper *Zookeeper
+	Health    *Health
+	Demote    *Demote
+	Alert     *Alert
+	Probe     *Probe
+	// the logging, nil keeps glog
+	Log *log.Config
+	// the /healthz and /readyz listen, disabled if empty
+	HttpListen string
 }
 
 type Store struct {
@@ -18,6 +29,71 @@ type Store struct {
 	RackCheckInterval   duration
 }
 
+// Health the latency health scoring of the stores, nil disables.
+type Health struct {
+	// probes in the rolling window
+	Window int
+	// probe latency above is slow
+	ReadSlow  duration
+	WriteSlow duration
+	// score(ratio of fast probes) below marks the store degraded
+	Degraded float64
+}
+
+// Demote the automatic read-only demotion of the stores by the write error
+// rate, nil disables.
+type Demote struct {
+	// write errors/(errors+writes) between two probes above demotes
+	ErrorRate float64
+	// ignore the errors fewer than
+	MinErrors int
+	// restore writable after no errors for
+	Probation duration
+}
+
+// Alert the alerts of the store state transitions, nil disables.
+type Alert struct {
+	// http callbacks, post the alert json
+	Webhooks []string
+	Timeout  duration
+	// repeat a firing alert every
+	Repeat duration
+	// optional mail
+	Smtp *Smtp
+}
+
+type Smtp struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Probe the probe strategies of the stores, nil uses the store check
+// intervals and fails the store on the first failure.
+type Probe struct {
+	// http stat, runs every Store.StoreCheckInterval
+	Stat *ProbeRule
+	// random real needle read, default every Store.NeedleCheckInterval
+	Needle *ProbeRule
+	// tcp connect, optional
+	Tcp *ProbeRule
+	// write, read and delete a needle on the probe volume, optional
+	Canary *ProbeRule
+}
+
+// ProbeRule the interval and failure threshold of a probe.
+type ProbeRule struct {
+	Interval duration
+	// consecutive failures fail the store, default 1
+	Failures int
+	// tcp connect timeout
+	Timeout duration
+	// canary probe volume
+	Vid int32
+}
+
 type Zookeeper struct {
 	VolumeRoot    string
 	StoreRoot     string
@@ -37,6 +113,10 @@ func (d *duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 // NewConfig new a config.
 func NewConfig(conf string) (c *Config, err error) {
 	var (
@@ -53,3 +133,76 @@ func NewConfig(conf string) (c *Config, err error) {
 	err = toml.Unmarshal(blob, c)
 	return
 }
+
+// Check check the config values, return all the problems found.
+func (c *Config) Check() error {
+	var ck = check.New()
+	if ck.NotNil("Store", c.Store != nil) {
+		ck.Positive("Store.StoreCheckInterval", c.Store.StoreCheckInterval.Duration)
+		ck.Positive("Store.NeedleCheckInterval", c.Store.NeedleCheckInterval.Duration)
+		ck.Positive("Store.RackCheckInterval", c.Store.RackCheckInterval.Duration)
+	}
+	if ck.NotNil("Zookeeper", c.Zookeeper != nil) {
+		ck.Addrs("Zookeeper.Addrs", c.Zookeeper.Addrs)
+		ck.Positive("Zookeeper.Timeout", c.Zookeeper.Timeout.Duration)
+		ck.NotEmpty("Zookeeper.VolumeRoot", c.Zookeeper.VolumeRoot)
+		ck.NotEmpty("Zookeeper.StoreRoot", c.Zookeeper.StoreRoot)
+		ck.NotEmpty("Zookeeper.PitchforkRoot", c.Zookeeper.PitchforkRoot)
+	}
+	if c.Health != nil {
+		ck.Range("Health.Window", int64(c.Health.Window), 1, 1024)
+		ck.Positive("Health.ReadSlow", c.Health.ReadSlow.Duration)
+		ck.Positive("Health.WriteSlow", c.Health.WriteSlow.Duration)
+		if c.Health.Degraded <= 0 || c.Health.Degraded > 1 {
+			ck.Errorf("Health.Degraded: %f must be in (0, 1]", c.Health.Degraded)
+		}
+	}
+	if c.Demote != nil {
+		if c.Demote.ErrorRate <= 0 || c.Demote.ErrorRate > 1 {
+			ck.Errorf("Demote.ErrorRate: %f must be in (0, 1]", c.Demote.ErrorRate)
+		}
+		ck.Range("Demote.MinErrors", int64(c.Demote.MinErrors), 1, math.MaxInt32)
+		ck.Positive("Demote.Probation", c.Demote.Probation.Duration)
+	}
+	if c.Alert != nil {
+		if len(c.Alert.Webhooks) == 0 && c.Alert.Smtp == nil {
+			ck.Errorf("Alert: no Webhooks or Smtp")
+		}
+		ck.Positive("Alert.Timeout", c.Alert.Timeout.Duration)
+		ck.Positive("Alert.Repeat", c.Alert.Repeat.Duration)
+		if c.Alert.Smtp != nil {
+			ck.Addr("Alert.Smtp.Addr", c.Alert.Smtp.Addr)
+			ck.NotEmpty("Alert.Smtp.From", c.Alert.Smtp.From)
+			if len(c.Alert.Smtp.To) == 0 {
+				ck.Errorf("Alert.Smtp.To: must be set")
+			}
+		}
+	}
+	if c.Probe != nil {
+		if c.Probe.Stat != nil {
+			ck.Range("Probe.Stat.Failures", int64(c.Probe.Stat.Failures), 0, math.MaxInt32)
+		}
+		if c.Probe.Needle != nil {
+			ck.Range("Probe.Needle.Failures", int64(c.Probe.Needle.Failures), 0, math.MaxInt32)
+		}
+		if c.Probe.Tcp != nil {
+			ck.Positive("Probe.Tcp.Interval", c.Probe.Tcp.Interval.Duration)
+			ck.Positive("Probe.Tcp.Timeout", c.Probe.Tcp.Timeout.Duration)
+			ck.Range("Probe.Tcp.Failures", int64(c.Probe.Tcp.Failures), 0, math.MaxInt32)
+		}
+		if c.Probe.Canary != nil {
+			ck.Positive("Probe.Canary.Interval", c.Probe.Canary.Interval.Duration)
+			ck.Range("Probe.Canary.Failures", int64(c.Probe.Canary.Failures), 0, math.MaxInt32)
+			ck.Range("Probe.Canary.Vid", int64(c.Probe.Canary.Vid), 1, math.MaxInt32)
+		}
+	}
+	if c.HttpListen != "" {
+		ck.Addr("HttpListen", c.HttpListen)
+	}
+	if c.Log != nil {
+		if err := c.Log.Check(); err != nil {
+			ck.Errorf("Log: %v", err)
+		}
+	}
+	return ck.Err()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"time"
+)
+
+// demote the write errors of a store since the last probe.
+type demote struct {
+	errors uint64 // total write errors
+	writes uint64 // total write processed
+	until  time.Time
+}
+
+// writeErrors sum the total write errors and writes of the store.
+func writeErrors(volumes []*meta.Volume) (errors, writes uint64) {
+	var volume *meta.Volume
+	for _, volume = range volumes {
+		errors += volume.Stats.TotalWriteErrors
+		writes += volume.Stats.TotalWriteProcessed
+	}
+	return
+}
+
+// delta the counter increased since last, the store restarted if less.
+func delta(cur, last uint64) uint64 {
+	if cur < last {
+		return cur
+	}
+	return cur - last
+}
+
+// demoted check the write error rate of the store since the last probe,
+// the store is read-only until a clean probation passed once the rate
+// crossed the threshold.
+func (p *Pitchfork) demoted(store *meta.Store, volumes []*meta.Volume) bool {
+	var (
+		ok             bool
+		now            = time.Now()
+		errs, writes   uint64
+		derrs, dwrites uint64
+		d              *demote
+		c              = p.config.Demote
+	)
+	if c == nil {
+		return false
+	}
+	errs, writes = writeErrors(volumes)
+	p.dlock.Lock()
+	defer p.dlock.Unlock()
+	if d, ok = p.demotes[store.Id]; !ok {
+		d = &demote{errors: errs, writes: writes}
+		p.demotes[store.Id] = d
+		return false
+	}
+	derrs, dwrites = delta(errs, d.errors), delta(writes, d.writes)
+	d.errors, d.writes = errs, writes
+	if derrs >= uint64(c.MinErrors) && float64(derrs) > c.ErrorRate*float64(derrs+dwrites) {
+		if now.After(d.until) {
+			log.Warningf("store: %s write errors: %d, writes: %d, demote read-only", store.Id, derrs, dwrites)
+		}
+		d.until = now.Add(c.Probation.Duration)
+		return true
+	}
+	if d.until.IsZero() {
+		return false
+	}
+	if now.After(d.until) {
+		log.Infof("store: %s clean for %s, restore writable", store.Id, c.Probation.Duration)
+		d.until = time.Time{}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"time"
+)
+
+// health the rolling probe latency of a store.
+type health struct {
+	slows []bool // ring of the probes, true means slow
+	next  int
+	n     int
+	slow  int
+}
+
+// add add a probe into the window.
+func (h *health) add(slow bool) {
+	if h.n == len(h.slows) {
+		if h.slows[h.next] {
+			h.slow--
+		}
+	} else {
+		h.n++
+	}
+	if h.slows[h.next] = slow; slow {
+		h.slow++
+	}
+	h.next = (h.next + 1) % len(h.slows)
+}
+
+// full reports whether the window is full.
+func (h *health) full() bool {
+	return h.n == len(h.slows)
+}
+
+// score the ratio of the fast probes in the window.
+func (h *health) score() float64 {
+	if h.n == 0 {
+		return 1
+	}
+	return 1 - float64(h.slow)/float64(h.n)
+}
+
+// writeLatency the recent write latency of the store, reported by the
+// volumes stats.
+func writeLatency(volumes []*meta.Volume) time.Duration {
+	var (
+		tps, delay uint64
+		volume     *meta.Volume
+	)
+	for _, volume = range volumes {
+		tps += volume.Stats.WriteTPS
+		delay += volume.Stats.WriteDelay
+	}
+	if tps == 0 {
+		return 0
+	}
+	return time.Duration(delay / tps)
+}
+
+// score add the probe latency into the store's window, mark the store
+// degraded when its score keeps below the threshold for a whole window.
+// failed probes count as slow.
+func (p *Pitchfork) score(store *meta.Store, read, write time.Duration, failed bool) {
+	var (
+		ok   bool
+		s    float64
+		h    *health
+		c    = p.config.Health
+		slow bool
+	)
+	if c == nil {
+		return
+	}
+	slow = failed || read > c.ReadSlow.Duration || write > c.WriteSlow.Duration
+	p.hlock.Lock()
+	if h, ok = p.healths[store.Id]; !ok {
+		h = &health{slows: make([]bool, c.Window)}
+		p.healths[store.Id] = h
+	}
+	h.add(slow)
+	s = h.score()
+	if !store.Degraded && h.full() && s < c.Degraded {
+		store.Degraded = true
+		log.Warningf("store: %s score: %.2f (read: %s, write: %s), mark degraded", store.Id, s, read, write)
+	} else if store.Degraded && s >= c.Degraded {
+		store.Degraded = false
+		log.Infof("store: %s score: %.2f, recover from degraded", store.Id, s)
+	}
+	p.hlock.Unlock()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	ihealth "bfs/libs/health"
+	"bfs/libs/log"
+	"net/http"
+)
+
+// StartHttp start the /healthz and /readyz of the pitchfork, ready if
+// zookeeper connected.
+func StartHttp(addr string, p *Pitchfork) {
+	var (
+		h   = ihealth.New()
+		mux = http.NewServeMux()
+	)
+	h.Add("zookeeper", p.zk.Ping)
+	h.Register(mux)
+	go func() {
+		var err error
+		if err = http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("http.ListenAndServe(\"%s\") error(%v)", addr, err)
+			return
+		}
+	}()
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
 	"bfs/pitchfork/conf"
 	"flag"
-	log "github.com/golang/glog"
+	"fmt"
+	"os"
 )
 
 var (
 	configFile string
+	testConfig bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "c", "./pitchfork.toml", " set pitchfork config file path")
+	flag.BoolVar(&testConfig, "t", false, " test config and exit")
 }
 
 func main() {
@@ -21,12 +26,20 @@ func main() {
 		err    error
 	)
 	flag.Parse()
+	if testConfig {
+		checkConf()
+		return
+	}
 	defer log.Flush()
 	log.Infof("bfs pitchfork start")
 	if config, err = conf.NewConfig(configFile); err != nil {
 		log.Errorf("NewConfig(\"%s\") error(%v)", configFile, err)
 		return
 	}
+	if err = log.Init(config.Log); err != nil {
+		log.Errorf("log.Init() error(%v)", err)
+		return
+	}
 	log.Infof("register pitchfork...")
 	if p, err = NewPitchfork(config); err != nil {
 		log.Errorf("pitchfork NewPitchfork() failed, Quit now")
@@ -34,6 +47,31 @@ func main() {
 	}
 	log.Infof("starts probe stores...")
 	go p.Probe()
+	if config.HttpListen != "" {
+		StartHttp(config.HttpListen, p)
+	}
 	StartSignal()
 	return
 }
+
+// checkConf parse and check the config, zookeeper reachability, then print
+// the effective config, exit non-zero if any problem found.
+func checkConf() {
+	var (
+		c   *conf.Config
+		err error
+	)
+	if c, err = conf.NewConfig(configFile); err == nil {
+		if err = c.Check(); err == nil {
+			ck := check.New()
+			ck.Dial("Zookeeper.Addrs", c.Zookeeper.Addrs, c.Zookeeper.Timeout.Duration)
+			err = ck.Err()
+		}
+		check.Print(os.Stdout, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config file %s test failed:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "config file %s test is successful\n", configFile)
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"bfs/pitchfork/conf"
 	myzk "bfs/pitchfork/zk"
 	"encoding/json"
+	"hash/fnv"
 	"sort"
+	"sync"
 	"time"
 
-	log "github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
@@ -23,6 +25,16 @@ type Pitchfork struct {
 	ID     string
 	config *conf.Config
 	zk     *myzk.Zookeeper
+	// latency health of the stores, store id:health
+	hlock   sync.Mutex
+	healths map[string]*health
+	// write errors of the stores, store id:demote
+	dlock   sync.Mutex
+	demotes map[string]*demote
+	alerter *Alerter
+	// consecutive probe failures, store id:kind:failures
+	plock sync.Mutex
+	fails map[string]map[string]int
 }
 
 // NewPitchfork new pitchfork.
@@ -30,6 +42,10 @@ func NewPitchfork(config *conf.Config) (p *Pitchfork, err error) {
 	var id string
 	p = &Pitchfork{}
 	p.config = config
+	p.healths = make(map[string]*health)
+	p.demotes = make(map[string]*demote)
+	p.alerter = NewAlerter(config)
+	p.fails = make(map[string]map[string]int)
 	if p.zk, err = myzk.NewZookeeper(config); err != nil {
 		log.Errorf("NewZookeeper() failed, Quit now")
 		return
@@ -110,6 +126,10 @@ func (p *Pitchfork) Probe() {
 			time.Sleep(_retrySleep)
 			continue
 		}
+		if err = p.rejoin(pitchforks); err != nil {
+			time.Sleep(_retrySleep)
+			continue
+		}
 		if stores = p.divide(pitchforks, stores); err != nil || len(stores) == 0 {
 			time.Sleep(_retrySleep)
 			continue
@@ -118,6 +138,12 @@ func (p *Pitchfork) Probe() {
 		for _, store = range stores {
 			go p.checkHealth(store, stop)
 			go p.checkNeedles(store, stop)
+			if p.rule(probeTcp) != nil {
+				go p.checkProbe(probeTcp, store, tcp, stop)
+			}
+			if p.rule(probeCanary) != nil {
+				go p.checkProbe(probeCanary, store, canary, stop)
+			}
 		}
 		select {
 		case <-sev:
@@ -131,40 +157,57 @@ func (p *Pitchfork) Probe() {
 	}
 }
 
-// divide a set of stores between a set of pitchforks.
-func (p *Pitchfork) divide(pitchforks []string, stores []*meta.Store) []*meta.Store {
+// divide a set of stores between a set of pitchforks, every store goes to
+// the pitchfork with the highest hash of (pitchfork, store), so all the
+// pitchforks agree without a leader, and only the stores of a died (or new)
+// pitchfork move.
+func (p *Pitchfork) divide(pitchforks []string, stores []*meta.Store) (res []*meta.Store) {
 	var (
-		n, m        int
-		ss, ps      int
-		first, last int
-		node        string
-		store       *meta.Store
-		sm          = make(map[string][]*meta.Store)
+		h, max uint64
+		owner  string
+		node   string
+		store  *meta.Store
 	)
-	ss = len(stores)
-	ps = len(pitchforks)
-	if ss == 0 || ps == 0 || ss < ps {
-		return nil
-	}
-	n = ss / ps
-	m = ss % ps
-	first = 0
-	for _, node = range pitchforks {
-		last = first + n
-		if m > 0 {
-			// let front node add one more
-			last++
-			m--
-		}
-		if last > ss {
-			last = ss
+	for _, store = range stores {
+		max, owner = 0, ""
+		for _, node = range pitchforks {
+			if h = rendezvous(node, store.Id); owner == "" || h > max {
+				max, owner = h, node
+			}
 		}
-		for _, store = range stores[first:last] {
-			sm[node] = append(sm[node], store)
+		if owner == p.ID {
+			res = append(res, store)
 		}
-		first = last
 	}
-	return sm[p.ID]
+	return
+}
+
+// rendezvous the hash of the pitchfork and store.
+func rendezvous(node, store string) uint64 {
+	var h = fnv.New64a()
+	h.Write([]byte(node))
+	h.Write([]byte{'/'})
+	h.Write([]byte(store))
+	return h.Sum64()
+}
+
+// rejoin register the pitchfork again if its node lost, eg. the zookeeper
+// session expired.
+func (p *Pitchfork) rejoin(pitchforks []string) (err error) {
+	var (
+		i  int
+		id string
+	)
+	if i = sort.SearchStrings(pitchforks, p.ID); i < len(pitchforks) && pitchforks[i] == p.ID {
+		return
+	}
+	if id, err = p.init(); err != nil {
+		log.Errorf("pitchfork: %s rejoin error(%v)", p.ID, err)
+		return
+	}
+	log.Warningf("pitchfork: %s node lost, rejoin as: %s", p.ID, id)
+	p.ID = id
+	return
 }
 
 // checkHealth check the store health.
@@ -172,6 +215,11 @@ func (p *Pitchfork) checkHealth(store *meta.Store, stop chan struct{}) {
 	var (
 		err       error
 		status, i int
+		degraded  bool
+		failed    bool
+		down, ro  bool
+		start     time.Time
+		read      time.Duration
 		volume    *meta.Volume
 		volumes   []*meta.Volume
 	)
@@ -185,32 +233,50 @@ func (p *Pitchfork) checkHealth(store *meta.Store, stop chan struct{}) {
 			break
 		}
 		status = store.Status
+		degraded = store.Degraded
 		store.Status = meta.StoreStatusHealth
 		for i = 0; i < _retryCount; i++ {
+			start = time.Now()
 			if volumes, err = store.Info(); err == nil {
+				read = time.Since(start)
 				break
 			}
 			time.Sleep(_retrySleep)
 		}
+		p.score(store, read, writeLatency(volumes), err != nil)
+		failed = p.probed(store, probeStat, err)
 		if err == nil {
 			for _, volume = range volumes {
+				p.alerter.Volume(store, volume)
 				if volume.Block.LastErr != nil {
 					log.Infof("get store block.lastErr:%s host:%s", volume.Block.LastErr, store.Stat)
 					store.Status = meta.StoreStatusFail
 					break
-				} else if volume.Block.Full() {
-					log.Infof("block: %s, offset: %d", volume.Block.File, volume.Block.Offset)
+				} else if volume.Full() {
+					log.Infof("block: %s, offset: %d, size: %d, quota: %d", volume.Block.File, volume.Block.Offset, volume.Block.Size, volume.Quota)
 					store.Status = meta.StoreStatusRead
 				}
 				if err = p.zk.SetVolumeState(volume); err != nil {
 					log.Errorf("zk.SetVolumeState() error(%v)", err)
 				}
 			}
-		} else {
+			if p.demoted(store, volumes) && store.Status == meta.StoreStatusHealth {
+				store.Status = meta.StoreStatusRead
+			}
+		} else if failed {
 			log.Errorf("get store info failed, retry host:%s", store.Stat)
 			store.Status = meta.StoreStatusFail
+		} else {
+			// below the failure threshold, keep the status
+			store.Status = status
 		}
-		if status != store.Status {
+		if down, ro = p.probeFailed(store); down {
+			store.Status = meta.StoreStatusFail
+		} else if ro && store.Status == meta.StoreStatusHealth {
+			store.Status = meta.StoreStatusRead
+		}
+		p.alerter.Store(store)
+		if status != store.Status || degraded != store.Degraded {
 			if err = p.zk.SetStore(store); err != nil {
 				log.Errorf("update store zk status failed, retry")
 				continue
@@ -222,18 +288,23 @@ func (p *Pitchfork) checkHealth(store *meta.Store, stop chan struct{}) {
 // checkNeedles check the store health.
 func (p *Pitchfork) checkNeedles(store *meta.Store, stop chan struct{}) {
 	var (
-		err     error
-		status  int
-		volume  *meta.Volume
-		volumes []*meta.Volume
+		err      error
+		status   int
+		volume   *meta.Volume
+		volumes  []*meta.Volume
+		r        = p.rule(probeNeedle)
+		interval = p.config.Store.NeedleCheckInterval.Duration
 	)
+	if r != nil && r.Interval.Duration > 0 {
+		interval = r.Interval.Duration
+	}
 	log.Infof("checkNeedles job start")
 	for {
 		select {
 		case <-stop:
 			log.Infof("checkNeedles job stop")
 			return
-		case <-time.After(p.config.Store.NeedleCheckInterval.Duration):
+		case <-time.After(interval):
 			break
 		}
 		if volumes, err = store.Info(); err != nil {
@@ -242,17 +313,20 @@ func (p *Pitchfork) checkNeedles(store *meta.Store, stop chan struct{}) {
 		}
 		status = store.Status
 		for _, volume = range volumes {
-			if err = volume.Block.LastErr; err != nil {
+			if volume.Block.LastErr != nil {
 				// ignore volume error
+				err = nil
 				break
 			}
 			// ignore timeout
 			if err = store.Head(volume.Id); err == errors.ErrInternal {
-				store.Status = meta.StoreStatusFail
-				goto failed
+				break
 			}
+			err = nil
+		}
+		if p.probed(store, probeNeedle, err) {
+			store.Status = meta.StoreStatusFail
 		}
-	failed:
 		if status != store.Status {
 			if err = p.zk.SetStore(store); err != nil {
 				log.Errorf("update store zk status failed, retry")
@@ -1,23 +1,22 @@
 package main
 
 import (
+	"bfs/libs/meta"
 	"bfs/pitchfork/conf"
-	myzk "bfs/store/zk"
 	"fmt"
 	"testing"
-	"time"
 )
 
 func TestPitchfork(t *testing.T) {
 
 	var (
-		config        *Config
-		zk            *Zookeeper
-		p             *Pitchfork
-		storelist     StoreList
-		store         *Store
-		pitchforklist PitchforkList
-		err           error
+		config     *conf.Config
+		p          *Pitchfork
+		stores     []*meta.Store
+		store      *meta.Store
+		pitchforks []string
+		id         string
+		err        error
 	)
 
 	if config, err = conf.NewConfig(configFile); err != nil {
@@ -25,40 +24,27 @@ func TestPitchfork(t *testing.T) {
 		return
 	}
 
-	if zk, err = myzk.NewZookeeper([]string{"localhost:2181"}, time.Second*1); err != nil {
-		t.Errorf("NewZookeeper() error(%v)", err)
+	if p, err = NewPitchfork(config); err != nil {
+		t.Errorf("NewPitchfork() error(%v)", err)
 		t.FailNow()
 	}
 
-	p = NewPitchfork(zk, config)
-	if err = p.Register(); err != nil {
-		t.Errorf("pitchfork Register() failed, Quit now")
-		t.FailNow()
-	}
-
-	storelist, _, err = p.WatchGetStores()
+	stores, _, err = p.watchStores()
 	if err != nil {
-		t.Errorf("pitchfork WatchGetStores() failed, Quit now")
+		t.Errorf("pitchfork watchStores() failed, Quit now")
 		t.FailNow()
 	}
-	for _, store = range storelist {
-		fmt.Println(store.rack, store.ID, store.host, store.status)
+	for _, store = range stores {
+		fmt.Println(store.Rack, store.Id, store.Stat, store.Status)
 	}
 
-	pitchforklist, _, err = p.WatchGetPitchforks()
+	pitchforks, _, err = p.watch()
 	if err != nil {
-		t.Errorf("pitchfork WatchGetPitchforks() failed, Quit now")
+		t.Errorf("pitchfork watch() failed, Quit now")
 		t.FailNow()
 	}
-	for _, p = range pitchforklist {
-		fmt.Println(p.ID)
-	}
-
-	for _, store = range storelist {
-		if err = p.getStore(store); err != nil {
-			t.Errorf("probeStore() called error(%v)", err)
-			t.FailNow()
-		}
+	for _, id = range pitchforks {
+		fmt.Println(id)
 	}
 
 }
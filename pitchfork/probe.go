@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/pitchfork/conf"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// probe kind
+	probeStat   = "stat"
+	probeNeedle = "needle"
+	probeTcp    = "tcp"
+	probeCanary = "canary"
+
+	// canary needle, the keys generated by the directory are positive
+	_canaryKey  = -1
+	_canarySize = 64
+)
+
+// rule get the probe rule of the kind, nil if not configured.
+func (p *Pitchfork) rule(kind string) *conf.ProbeRule {
+	if p.config.Probe == nil {
+		return nil
+	}
+	switch kind {
+	case probeStat:
+		return p.config.Probe.Stat
+	case probeNeedle:
+		return p.config.Probe.Needle
+	case probeTcp:
+		return p.config.Probe.Tcp
+	case probeCanary:
+		return p.config.Probe.Canary
+	}
+	return nil
+}
+
+// probed count the consecutive failures of the probe, reports whether the
+// failures reach the threshold of the kind, 1 if not configured.
+func (p *Pitchfork) probed(store *meta.Store, kind string, err error) (failed bool) {
+	var (
+		ok    bool
+		fails map[string]int
+	)
+	p.plock.Lock()
+	if fails, ok = p.fails[store.Id]; !ok {
+		fails = make(map[string]int)
+		p.fails[store.Id] = fails
+	}
+	if err == nil {
+		delete(fails, kind)
+	} else {
+		fails[kind]++
+		failed = p.probeReached(kind, fails[kind])
+	}
+	p.plock.Unlock()
+	if err != nil {
+		log.Errorf("store: %s probe: %s failed(%v) error(%v)", store.Id, kind, failed, err)
+	}
+	return
+}
+
+// probeFailed reports the store status required by the failing probes, the
+// failed canary only stops the writes.
+func (p *Pitchfork) probeFailed(store *meta.Store) (down, readonly bool) {
+	var (
+		kind  string
+		fails map[string]int
+	)
+	p.plock.Lock()
+	fails = p.fails[store.Id]
+	for _, kind = range []string{probeNeedle, probeTcp} {
+		if p.probeReached(kind, fails[kind]) {
+			down = true
+		}
+	}
+	readonly = p.probeReached(probeCanary, fails[probeCanary])
+	p.plock.Unlock()
+	return
+}
+
+// probeReached reports whether the failures reach the threshold.
+func (p *Pitchfork) probeReached(kind string, fails int) bool {
+	var r = p.rule(kind)
+	if fails == 0 {
+		return false
+	}
+	if r == nil || r.Failures <= 0 {
+		return true
+	}
+	return fails >= r.Failures
+}
+
+// checkProbe run the probe of the kind every interval of the rule.
+func (p *Pitchfork) checkProbe(kind string, store *meta.Store, probe func(*meta.Store, *conf.ProbeRule) error, stop chan struct{}) {
+	var r = p.rule(kind)
+	log.Infof("probe %s job start", kind)
+	for {
+		select {
+		case <-stop:
+			log.Infof("probe %s job stop", kind)
+			return
+		case <-time.After(r.Interval.Duration):
+			break
+		}
+		p.probed(store, kind, probe(store, r))
+	}
+}
+
+// tcp probe the store ports accept connections.
+func tcp(store *meta.Store, r *conf.ProbeRule) error {
+	return store.Dial(r.Timeout.Duration)
+}
+
+// canary write, read back and delete a small needle on the probe volume.
+func canary(store *meta.Store, r *conf.ProbeRule) (err error) {
+	var (
+		read   []byte
+		cookie = rand.Int31()
+		data   = make([]byte, _canarySize)
+	)
+	rand.Read(data)
+	if err = store.Write(r.Vid, _canaryKey, cookie, data); err != nil {
+		return
+	}
+	if read, err = store.Read(r.Vid, _canaryKey, cookie); err != nil {
+		return
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("canary needle of volume: %d mismatch", r.Vid)
+	}
+	err = store.Delete(r.Vid, _canaryKey)
+	return
+}
@@ -5,7 +5,7 @@ import (
 	"os/signal"
 	"syscall"
 
-	log "github.com/golang/glog"
+	"bfs/libs/log"
 )
 
 // StartSignal register signals handler.
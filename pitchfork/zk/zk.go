@@ -1,11 +1,11 @@
 package zk
 
 import (
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"bfs/pitchfork/conf"
 	"encoding/json"
 	"fmt"
-	log "github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
 	"path"
 )
@@ -56,7 +56,7 @@ func (z *Zookeeper) setRoot() (err error) {
 	return
 }
 
-// SetStore update store status.
+// SetStore update store status and degraded.
 func (z *Zookeeper) SetStore(s *meta.Store) (err error) {
 	var (
 		data  []byte
@@ -74,6 +74,7 @@ func (z *Zookeeper) SetStore(s *meta.Store) (err error) {
 		}
 	}
 	store.Status = s.Status
+	store.Degraded = s.Degraded
 	if data, err = json.Marshal(store); err != nil {
 		log.Errorf("json.Marshal() error(%v)", err)
 		return err
@@ -128,9 +129,11 @@ func (z *Zookeeper) SetVolumeState(volume *meta.Volume) (err error) {
 		vstate = &meta.VolumeState{
 			TotalWriteProcessed: volume.Stats.TotalWriteProcessed,
 			TotalWriteDelay:     volume.Stats.TotalWriteDelay,
+			WriteTPS:            volume.Stats.WriteTPS,
+			WriteDelay:          volume.Stats.WriteDelay,
 		}
 	)
-	vstate.FreeSpace = volume.Block.FreeSpace()
+	vstate.FreeSpace = volume.FreeSpace()
 	spath = path.Join(z.config.Zookeeper.VolumeRoot, fmt.Sprintf("%d", volume.Id))
 	if d, err = json.Marshal(vstate); err != nil {
 		log.Errorf("json.Marshal() error(%v)", err)
@@ -142,6 +145,15 @@ func (z *Zookeeper) SetVolumeState(volume *meta.Volume) (err error) {
 	return
 }
 
+// Ping check the session of the zookeeper connection.
+func (z *Zookeeper) Ping() (err error) {
+	var s zk.State
+	if s = z.c.State(); s != zk.StateHasSession {
+		err = fmt.Errorf("zookeeper %s", s)
+	}
+	return
+}
+
 // Close close the zookeeper connection.
 func (z *Zookeeper) Close() {
 	z.c.Close()
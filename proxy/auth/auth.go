@@ -15,8 +15,9 @@ import (
 )
 
 const (
-	_authExpire = 900                // 15min
-	_template   = "%s\n%s\n%s\n%d\n" // method bucket filename expire
+	_authExpire  = 900                 // 15min
+	_template    = "%s\n%s\n%s\n%d\n"  // method bucket filename expire
+	_urlTemplate = "URL\n%s\n%s\n%d\n" // bucket filename expire
 )
 
 type Auth struct {
@@ -33,17 +34,19 @@ func New(c *conf.Config) (a *Auth, err error) {
 func (a *Auth) Authorize(item *ibucket.Item, method, bucket, file, token string) (err error) {
 	// token keyid:sign:time
 	var (
+		ok     bool
 		expire int64
 		delta  int64
 		now    int64
 		keyId  string
+		secret string
 		ss     = strings.Split(token, ":")
 	)
 	if len(ss) != 3 {
 		return errors.ErrAuthFailed
 	}
 	keyId = ss[0]
-	if keyId != item.KeyId {
+	if secret, ok = item.Secret(keyId); !ok {
 		return errors.ErrAuthFailed
 	}
 	if expire, err = strconv.ParseInt(ss[2], 10, 64); err != nil {
@@ -59,7 +62,7 @@ func (a *Auth) Authorize(item *ibucket.Item, method, bucket, file, token string)
 	if delta > _authExpire {
 		return errors.ErrAuthFailed
 	}
-	err = a.sign(ss[1], method, bucket, file, item.KeySecret, expire)
+	err = a.sign(ss[1], method, bucket, file, secret, expire)
 	return
 }
 
@@ -76,3 +79,25 @@ func (a *Auth) sign(src, method, bucket, file, keySecret string, expire int64) (
 	}
 	return
 }
+
+// SignURL sign a download url of the file, valid until expire(unix time).
+func (a *Auth) SignURL(item *ibucket.Item, bucket, file string, expire int64) string {
+	var mac = hmac.New(sha1.New, []byte(item.KeySecret))
+	mac.Write([]byte(fmt.Sprintf(_urlTemplate, bucket, file, expire)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyURL verify the signature and expires of a signed download url.
+func (a *Auth) VerifyURL(item *ibucket.Item, bucket, file, sign, expires string) (err error) {
+	var expire int64
+	if expire, err = strconv.ParseInt(expires, 10, 64); err != nil {
+		return errors.ErrAuthFailed
+	}
+	if expire < time.Now().Unix() {
+		return errors.ErrAuthFailed
+	}
+	if !hmac.Equal([]byte(a.SignURL(item, bucket, file, expire)), []byte(sign)) {
+		return errors.ErrAuthFailed
+	}
+	return
+}
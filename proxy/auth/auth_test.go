@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"bfs/libs/errors"
+	ibucket "bfs/proxy/bucket"
+	"bfs/proxy/conf"
+)
+
+func TestSignURL(t *testing.T) {
+	var (
+		err    error
+		a      *Auth
+		sign   string
+		bad    []byte
+		expire = time.Now().Unix() + 60
+		item   = &ibucket.Item{Name: "test", KeyId: "221bce6492eba70f", KeySecret: "6eb80603e85842542f9736eb13b7e3"}
+	)
+	if a, err = New(&conf.Config{}); err != nil {
+		t.Errorf("New() error(%v)", err)
+		t.FailNow()
+	}
+	sign = a.SignURL(item, "test", "1.jpg", expire)
+	if sign != a.SignURL(item, "test", "1.jpg", expire) {
+		t.Errorf("SignURL() not stable")
+		t.FailNow()
+	}
+	// change a char of the signature
+	if bad = []byte(sign); bad[0] == 'A' {
+		bad[0] = 'B'
+	} else {
+		bad[0] = 'A'
+	}
+	for _, c := range []struct {
+		name    string
+		bucket  string
+		file    string
+		sign    string
+		expires string
+		err     error
+	}{
+		{"valid", "test", "1.jpg", sign, strconv.FormatInt(expire, 10), nil},
+		{"expired", "test", "1.jpg", a.SignURL(item, "test", "1.jpg", expire-120), strconv.FormatInt(expire-120, 10), errors.ErrAuthFailed},
+		{"tampered sign", "test", "1.jpg", string(bad), strconv.FormatInt(expire, 10), errors.ErrAuthFailed},
+		{"empty sign", "test", "1.jpg", "", strconv.FormatInt(expire, 10), errors.ErrAuthFailed},
+		{"wrong bucket", "test2", "1.jpg", sign, strconv.FormatInt(expire, 10), errors.ErrAuthFailed},
+		{"wrong file", "test", "2.jpg", sign, strconv.FormatInt(expire, 10), errors.ErrAuthFailed},
+		{"longer expires", "test", "1.jpg", sign, strconv.FormatInt(expire+60, 10), errors.ErrAuthFailed},
+		{"malformed expires", "test", "1.jpg", sign, "abc", errors.ErrAuthFailed},
+		{"empty expires", "test", "1.jpg", sign, "", errors.ErrAuthFailed},
+	} {
+		if err = a.VerifyURL(item, c.bucket, c.file, c.sign, c.expires); err != c.err {
+			t.Errorf("%s: VerifyURL() error(%v), want(%v)", c.name, err, c.err)
+			t.FailNow()
+		}
+	}
+	// signed by another secret
+	if err = a.VerifyURL(&ibucket.Item{Name: "test", KeySecret: "x"}, "test", "1.jpg", sign, strconv.FormatInt(expire, 10)); err != errors.ErrAuthFailed {
+		t.Errorf("VerifyURL() another secret error(%v)", err)
+		t.FailNow()
+	}
+}
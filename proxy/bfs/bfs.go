@@ -2,35 +2,51 @@ package bfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"bfs/libs/audit"
 	"bfs/libs/errors"
+	"bfs/libs/health"
+	"bfs/libs/log"
 	"bfs/libs/meta"
+	"bfs/libs/region"
+	"bfs/libs/reqid"
+	"bfs/libs/rpc"
+	"bfs/libs/trace"
 	"bfs/proxy/conf"
 
 	itime "github.com/Terry-Mao/marmot/time"
-	log "github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
+	otrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 const (
 	// api
-	_directoryGetApi    = "http://%s/get"
-	_directoryUploadApi = "http://%s/upload"
-	_directoryDelApi    = "http://%s/del"
-	_storeGetApi        = "http://%s/get"
-	_storeUploadApi     = "http://%s/upload"
-	_storeDelApi        = "http://%s/del"
+	_directoryGetApi     = "http://%s/get"
+	_directoryGetsApi    = "http://%s/gets"
+	_directoryUploadApi  = "http://%s/upload"
+	_directoryUploadsApi = "http://%s/uploads"
+	_directoryDelApi     = "http://%s/del"
+	_directoryListApi    = "http://%s/list"
+	_directoryAliasApi   = "http://%s/alias"
+	_directoryReadyApi   = "http://%s/readyz"
+	_storeGetApi         = "http://%s/get"
+	_storeUploadApi      = "http://%s/upload"
+	_storeUploadsApi     = "http://%s/uploads"
+	_storeDelApi         = "http://%s/del"
 )
 
 var (
@@ -48,107 +64,152 @@ var (
 		Transport: _transport,
 	}
 	_canceler = _transport.CancelRequest
-	// random store node
-	_rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 )
 
 type Bfs struct {
-	c *conf.Config
+	c   *conf.Config
+	rpc *rpc.DirectoryClient
+	// the demoted replicas, store:expire
+	dlock   sync.Mutex
+	demoted map[string]time.Time
+	// the replicas not yet written of the acked uploads
+	debt debt
 }
 
 func New(c *conf.Config) (b *Bfs) {
+	var (
+		err error
+		cc  *grpc.ClientConn
+	)
 	b = &Bfs{}
 	b.c = c
+	b.demoted = make(map[string]time.Time)
+	if c.BfsRpcAddr != "" {
+		if cc, err = rpc.Dial(c.BfsRpcAddr); err != nil {
+			log.Errorf("rpc.Dial(\"%s\") error(%v), use http api", c.BfsRpcAddr, err)
+			return
+		}
+		b.rpc = rpc.NewDirectoryClient(cc)
+	}
 	return
 }
 
 // Get
-func (b *Bfs) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mtime int64, sha1, mine string, err error) {
+func (b *Bfs) Get(ctx context.Context, bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	var res *meta.Response
+	if res, mf, err = b.Stat(ctx, bucket, filename); err != nil {
+		return
+	}
+	src, ctlen, err = b.Read(ctx, res)
+	return
+}
+
+// Stat get the needle and the meta of the file from the directory.
+func (b *Bfs) Stat(ctx context.Context, bucket, filename string) (res *meta.Response, mf *meta.File, err error) {
 	var (
-		i, ix, l int
-		uri      string
-		req      *http.Request
-		resp     *http.Response
-		res      meta.Response
-		params   = url.Values{}
+		uri    string
+		params = url.Values{}
 	)
+	res = new(meta.Response)
 	params.Set("bucket", bucket)
 	params.Set("filename", filename)
+	if b.c.Region != "" {
+		params.Set("region", b.c.Region)
+	}
 	uri = fmt.Sprintf(_directoryGetApi, b.c.BfsAddr)
-	if err = Http("GET", uri, params, nil, &res); err != nil {
+	if err = b.directory(ctx, "GET", _directoryGetApi, params, res); err != nil {
 		log.Errorf("GET called Http error(%v)", err)
 		return
 	}
 	if res.Ret != errors.RetOK {
 		log.Errorf("http.Get directory res.Ret: %d %s", res.Ret, uri)
-		if res.Ret == errors.RetNeedleNotExist {
-			err = errors.ErrNeedleNotExist
-		} else {
-			err = errors.ErrInternal
-		}
+		err = errors.Ret(res.Ret)
 		return
 	}
-	mtime = res.MTime
-	sha1 = res.Sha1
-	mine = res.Mine
-	params = url.Values{}
-	l = len(res.Stores)
-	ix = _rand.Intn(l)
-	for i = 0; i < l; i++ {
-		params.Set("key", strconv.FormatInt(res.Key, 10))
-		params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
-		params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
-		uri = fmt.Sprintf(_storeGetApi, res.Stores[(ix+i)%l]) + "?" + params.Encode()
-		if req, err = http.NewRequest("GET", uri, nil); err != nil {
-			continue
-		}
-		td := _timer.Start(5*time.Second, func() {
-			_canceler(req)
-		})
-		if resp, err = _client.Do(req); err != nil {
-			log.Errorf("_client.do(%s) error(%v)", uri, err)
-			continue
-		}
-		td.Stop()
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			continue
-		}
-		src = resp.Body
-		ctlen = int(resp.ContentLength)
-		break
-	}
-	if err == nil {
-		if resp.StatusCode == http.StatusServiceUnavailable {
-			err = errors.ErrStoreNotAvailable
-		} else if resp.StatusCode == http.StatusNotFound {
-			err = errors.ErrNeedleNotExist
-		}
+	mf = &meta.File{MTime: res.MTime, Sha1: res.Sha1, Mine: res.Mine, Name: res.Name, Size: res.Size}
+	return
+}
+
+// Read read the needle from the replicas of the directory response.
+func (b *Bfs) Read(ctx context.Context, res *meta.Response) (src io.ReadCloser, ctlen int, err error) {
+	var (
+		resp   *http.Response
+		params = url.Values{}
+	)
+	params.Set("key", strconv.FormatInt(res.Key, 10))
+	params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
+	params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
+	if resp, err = b.read(ctx, region.ReadStores(res.Stores, res.Local), params.Encode()); err != nil {
+		log.Errorf("read() key: %d vid: %d error(%v)", res.Key, res.Vid, err)
+		return
+	}
+	src = resp.Body
+	ctlen = int(resp.ContentLength)
+	return
+}
+
+// Gets resolve the stores of the files in one directory request, every
+// response has its own ret.
+func (b *Bfs) Gets(ctx context.Context, bucket string, filenames []string) (files []*meta.Response, err error) {
+	var (
+		uri    string
+		res    meta.Responses
+		params = url.Values{}
+	)
+	params.Set("bucket", bucket)
+	params["filename"] = filenames
+	if b.c.Region != "" {
+		params.Set("region", b.c.Region)
+	}
+	if b.rpc != nil {
+		return b.rpcGets(ctx, bucket, filenames)
+	}
+	uri = fmt.Sprintf(_directoryGetsApi, b.c.BfsAddr)
+	if err = Http(ctx, "POST", uri, params, nil, &res); err != nil {
+		log.Errorf("Gets called Http error(%v)", err)
+		return
+	}
+	if res.Ret != errors.RetOK {
+		log.Errorf("http.Post directory res.Ret: %d %s", res.Ret, uri)
+		err = errors.Ret(res.Ret)
+		return
 	}
+	files = res.Files
 	return
 }
 
 // Upload
-func (b *Bfs) Upload(bucket, filename, mine, sha1 string, mtime int64, buf []byte) (err error) {
+func (b *Bfs) Upload(ctx context.Context, bucket, filename, name, mine, sha1 string, mtime int64, buf []byte) (err error) {
 	var (
 		params = url.Values{}
 		uri    string
-		host   string
 		res    meta.Response
-		sRet   meta.StoreRet
 	)
 	params.Set("bucket", bucket)
 	params.Set("filename", filename)
 	params.Set("mine", mine)
 	params.Set("sha1", sha1)
 	params.Set("mtime", strconv.FormatInt(mtime, 10))
+	params.Set("size", strconv.Itoa(len(buf)))
+	if name != "" {
+		params.Set("name", name)
+	}
 	uri = fmt.Sprintf(_directoryUploadApi, b.c.BfsAddr)
-	if err = Http("POST", uri, params, nil, &res); err != nil {
+	if err = b.directory(ctx, "POST", _directoryUploadApi, params, &res); err != nil {
+		return
+	}
+	if res.Ret == errors.RetFileDedup {
+		// the needle of the same content shared, nothing to write
+		log.Infof("bfs.upload bucket:%s filename:%s key:%d dedup", bucket, filename, res.Key)
 		return
 	}
 	if res.Ret != errors.RetOK && res.Ret != errors.RetNeedleExist {
 		log.Errorf("http.Post directory res.Ret: %d %s", res.Ret, uri)
-		err = errors.ErrInternal
+		if res.Ret == errors.RetBucketQuotaExceeded {
+			err = errors.ErrQuotaExceeded
+		} else {
+			err = errors.Ret(res.Ret)
+		}
 		return
 	}
 	// same sha1sum.
@@ -157,20 +218,10 @@ func (b *Bfs) Upload(bucket, filename, mine, sha1 string, mtime int64, buf []byt
 		return
 	}
 
-	params = url.Values{}
-	for _, host = range res.Stores {
-		params.Set("key", strconv.FormatInt(res.Key, 10))
-		params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
-		params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
-		uri = fmt.Sprintf(_storeUploadApi, host)
-		if err = Http("POST", uri, params, buf, &sRet); err != nil {
-			return
-		}
-		if sRet.Ret != 1 {
-			log.Errorf("http.Post store sRet.Ret: %d  %s %d %d %d", sRet.Ret, uri, res.Key, res.Cookie, res.Vid)
-			err = errors.ErrInternal
-			return
-		}
+	if err = b.replicate(ctx, res.Stores, res.Vid, []int64{res.Key}, func(ctx context.Context, host string) error {
+		return b.storeUpload(ctx, host, &res, buf)
+	}); err != nil {
+		return
 	}
 	if res.Ret == errors.RetNeedleExist {
 		err = errors.ErrNeedleExist
@@ -182,8 +233,152 @@ func (b *Bfs) Upload(bucket, filename, mine, sha1 string, mtime int64, buf []byt
 	return
 }
 
-// Delete
-func (b *Bfs) Delete(bucket, filename string) (err error) {
+// storeUpload write the needle of the upload to the store.
+func (b *Bfs) storeUpload(ctx context.Context, host string, res *meta.Response, buf []byte) (err error) {
+	var (
+		uri    = fmt.Sprintf(_storeUploadApi, host)
+		params = url.Values{}
+		sRet   meta.StoreRet
+	)
+	params.Set("key", strconv.FormatInt(res.Key, 10))
+	params.Set("cookie", strconv.FormatInt(int64(res.Cookie), 10))
+	params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
+	if err = Http(ctx, "POST", uri, params, buf, &sRet); err != nil {
+		return
+	}
+	if sRet.Ret != 1 {
+		log.Errorf("http.Post store sRet.Ret: %d  %s %d %d %d", sRet.Ret, uri, res.Key, res.Cookie, res.Vid)
+		err = errors.Ret(sRet.Ret)
+	}
+	return
+}
+
+// File a file of the batch upload, Err is the upload result of the file.
+type File struct {
+	Filename string
+	Name     string // the original filename
+	Mine     string
+	Sha1     string
+	MTime    int64
+	Data     []byte
+	Err      error
+}
+
+// Uploads upload the files in one directory request by the http api, the
+// new files share one volume and are written to every store in one request,
+// an existing file is rewritten in its own volume.
+func (b *Bfs) Uploads(ctx context.Context, bucket string, fs []*File) (err error) {
+	var (
+		i      int
+		uri    string
+		f      *File
+		fres   *meta.Response
+		res    meta.Responses
+		keys   []int64
+		vids   = make(map[int32][]int)
+		params = url.Values{}
+	)
+	params.Set("bucket", bucket)
+	for _, f = range fs {
+		params.Add("filename", f.Filename)
+		params.Add("mine", f.Mine)
+		params.Add("sha1", f.Sha1)
+		params.Add("mtime", strconv.FormatInt(f.MTime, 10))
+		params.Add("size", strconv.Itoa(len(f.Data)))
+		params.Add("name", f.Name)
+	}
+	uri = fmt.Sprintf(_directoryUploadsApi, b.c.BfsAddr)
+	if err = Http(ctx, "POST", uri, params, nil, &res); err != nil {
+		log.Errorf("Uploads called Http error(%v)", err)
+		return
+	}
+	if res.Ret != errors.RetOK || len(res.Files) != len(fs) {
+		log.Errorf("http.Post directory res.Ret: %d %s", res.Ret, uri)
+		if res.Ret == errors.RetBucketQuotaExceeded {
+			err = errors.ErrQuotaExceeded
+		} else if err = errors.Ret(res.Ret); err == nil {
+			err = errors.ErrInternal
+		}
+		return
+	}
+	for i, fres = range res.Files {
+		f = fs[i]
+		switch fres.Ret {
+		case errors.RetOK:
+		case errors.RetFileDedup:
+			if fres.MTime > 0 {
+				f.MTime = fres.MTime
+			}
+			continue
+		case errors.RetNeedleExist:
+			f.Err = errors.ErrNeedleExist
+			// same sha1sum.
+			if strings.HasPrefix(f.Filename, f.Sha1) {
+				continue
+			}
+		case errors.RetBucketQuotaExceeded:
+			f.Err = errors.ErrQuotaExceeded
+			continue
+		default:
+			log.Errorf("http.Post directory file: %s res.Ret: %d %s", f.Filename, fres.Ret, uri)
+			f.Err = errors.Ret(fres.Ret)
+			continue
+		}
+		vids[fres.Vid] = append(vids[fres.Vid], i)
+	}
+	// vid and ix are used by the writes in the background
+	for vid, ix := range vids {
+		keys = make([]int64, 0, len(ix))
+		for _, i = range ix {
+			keys = append(keys, res.Files[i].Key)
+		}
+		if err = b.replicate(ctx, res.Files[ix[0]].Stores, vid, keys, func(ctx context.Context, host string) error {
+			return b.storeUploads(ctx, host, vid, fs, res.Files, ix)
+		}); err != nil {
+			for _, i = range ix {
+				fs[i].Err = err
+			}
+			err = nil
+			continue
+		}
+		for _, i = range ix {
+			if fres = res.Files[i]; fres.MTime > 0 {
+				fs[i].MTime = fres.MTime
+			}
+			log.Infof("bfs.uploads bucket:%s filename:%s key:%d cookie:%d vid:%d", bucket, fs[i].Filename, fres.Key, fres.Cookie, fres.Vid)
+		}
+	}
+	return
+}
+
+// storeUploads write the files of the indexes to the volume of the store.
+func (b *Bfs) storeUploads(ctx context.Context, host string, vid int32, fs []*File, files []*meta.Response, ix []int) (err error) {
+	var (
+		i      int
+		uri    = fmt.Sprintf(_storeUploadsApi, host)
+		bufs   = make([][]byte, 0, len(ix))
+		params = url.Values{}
+		sRet   meta.StoreRet
+	)
+	params.Set("vid", strconv.FormatInt(int64(vid), 10))
+	for _, i = range ix {
+		params.Add("keys", strconv.FormatInt(files[i].Key, 10))
+		params.Add("cookies", strconv.FormatInt(int64(files[i].Cookie), 10))
+		bufs = append(bufs, fs[i].Data)
+	}
+	if err = Https(ctx, uri, params, bufs, &sRet); err != nil {
+		return
+	}
+	if sRet.Ret != 1 {
+		log.Errorf("http.Post store sRet.Ret: %d  %s vid: %d", sRet.Ret, uri, vid)
+		err = errors.Ret(sRet.Ret)
+	}
+	return
+}
+
+// Delete del the file, the needle is kept on the stores while shared by
+// other files, then no stores in the response.
+func (b *Bfs) Delete(ctx context.Context, bucket, filename string) (err error) {
 	var (
 		params = url.Values{}
 		host   string
@@ -194,17 +389,13 @@ func (b *Bfs) Delete(bucket, filename string) (err error) {
 	params.Set("bucket", bucket)
 	params.Set("filename", filename)
 	uri = fmt.Sprintf(_directoryDelApi, b.c.BfsAddr)
-	if err = Http("POST", uri, params, nil, &res); err != nil {
+	if err = b.directory(ctx, "POST", _directoryDelApi, params, &res); err != nil {
 		log.Errorf("Delete called Http error(%v)", err)
 		return
 	}
 	if res.Ret != errors.RetOK {
 		log.Errorf("http.Get directory res.Ret: %d %s", res.Ret, uri)
-		if res.Ret == errors.RetNeedleNotExist {
-			err = errors.ErrNeedleNotExist
-		} else {
-			err = errors.ErrInternal
-		}
+		err = errors.Ret(res.Ret)
 		return
 	}
 
@@ -213,36 +404,95 @@ func (b *Bfs) Delete(bucket, filename string) (err error) {
 		params.Set("key", strconv.FormatInt(res.Key, 10))
 		params.Set("vid", strconv.FormatInt(int64(res.Vid), 10))
 		uri = fmt.Sprintf(_storeDelApi, host)
-		if err = Http("POST", uri, params, nil, &sRet); err != nil {
+		if err = Http(ctx, "POST", uri, params, nil, &sRet); err != nil {
 			log.Errorf("Update called Http error(%v)", err)
 			return
 		}
 		if sRet.Ret != 1 {
 			log.Errorf("Delete store sRet.Ret: %d  %s", sRet.Ret, uri)
-			err = errors.ErrInternal
+			err = errors.Ret(sRet.Ret)
 			return
 		}
 	}
 	return
 }
 
+// List list at most limit files of the bucket with the prefix after the
+// marker, the ones containing the delimiter after the prefix are rolled up
+// to the common prefixes.
+func (b *Bfs) List(ctx context.Context, bucket, prefix, delimiter, marker string, limit int) (res *meta.List, err error) {
+	var (
+		params = url.Values{}
+		uri    = fmt.Sprintf(_directoryListApi, b.c.BfsAddr)
+	)
+	params.Set("bucket", bucket)
+	params.Set("prefix", prefix)
+	params.Set("delimiter", delimiter)
+	params.Set("marker", marker)
+	params.Set("limit", strconv.Itoa(limit))
+	res = new(meta.List)
+	if err = Http(ctx, "GET", uri, params, nil, res); err != nil {
+		log.Errorf("List called Http error(%v)", err)
+		return
+	}
+	if res.Ret != errors.RetOK {
+		log.Errorf("http.Get directory res.Ret: %d %s", res.Ret, uri)
+		err = errors.Ret(res.Ret)
+	}
+	return
+}
+
+// Alias put the alias of the file in the same bucket, sharing its needle,
+// no data copied.
+func (b *Bfs) Alias(ctx context.Context, bucket, filename, alias string) (err error) {
+	var (
+		params = url.Values{}
+		uri    = fmt.Sprintf(_directoryAliasApi, b.c.BfsAddr)
+		res    meta.Response
+	)
+	params.Set("bucket", bucket)
+	params.Set("filename", filename)
+	params.Set("alias", alias)
+	if err = Http(ctx, "POST", uri, params, nil, &res); err != nil {
+		log.Errorf("Alias called Http error(%v)", err)
+		return
+	}
+	if res.Ret != errors.RetOK {
+		log.Errorf("http.Post directory res.Ret: %d %s", res.Ret, uri)
+		err = errors.Ret(res.Ret)
+		return
+	}
+	log.Infof("bfs.alias bucket:%s filename:%s alias:%s key:%d", bucket, filename, alias, res.Key)
+	return
+}
+
 // Ping
 func (b *Bfs) Ping() error {
 	return nil
 }
 
-// Http params
-func Http(method, uri string, params url.Values, buf []byte, res interface{}) (err error) {
+// Ready check the directory is ready by its readiness.
+func (b *Bfs) Ready(ctx context.Context) (err error) {
 	var (
-		body    []byte
-		w       *multipart.Writer
-		bw      io.Writer
-		bufdata = &bytes.Buffer{}
-		req     *http.Request
-		resp    *http.Response
-		ru      string
-		enc     string
-		ctype   string
+		req *http.Request
+		uri = fmt.Sprintf(_directoryReadyApi, b.c.BfsAddr)
+		s   = new(health.Status)
+	)
+	if req, err = http.NewRequest("GET", uri, nil); err != nil {
+		return
+	}
+	if err = do(ctx, req, uri, s); err == nil && !s.Ready {
+		err = fmt.Errorf("directory not ready")
+	}
+	return
+}
+
+// Http params, the trace context of ctx is passed to the server.
+func Http(ctx context.Context, method, uri string, params url.Values, buf []byte, res interface{}) (err error) {
+	var (
+		req *http.Request
+		ru  string
+		enc string
 	)
 	enc = params.Encode()
 	if enc != "" {
@@ -259,26 +509,61 @@ func Http(method, uri string, params url.Values, buf []byte, res interface{}) (e
 			}
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		} else {
-			w = multipart.NewWriter(bufdata)
-			if bw, err = w.CreateFormFile("file", "1.jpg"); err != nil {
-				return
-			}
-			if _, err = bw.Write(buf); err != nil {
-				return
-			}
-			for key, _ := range params {
-				w.WriteField(key, params.Get(key))
-			}
-			ctype = w.FormDataContentType()
-			if err = w.Close(); err != nil {
-				return
-			}
-			if req, err = http.NewRequest("POST", uri, bufdata); err != nil {
-				return
-			}
-			req.Header.Set("Content-Type", ctype)
+			return Https(ctx, uri, params, [][]byte{buf}, res)
+		}
+	}
+	return do(ctx, req, ru, res)
+}
+
+// Https post the params and the bufs as the "file" parts of a multipart form.
+func Https(ctx context.Context, uri string, params url.Values, bufs [][]byte, res interface{}) (err error) {
+	var (
+		key     string
+		value   string
+		values  []string
+		buf     []byte
+		w       *multipart.Writer
+		bw      io.Writer
+		bufdata = &bytes.Buffer{}
+		req     *http.Request
+	)
+	w = multipart.NewWriter(bufdata)
+	for _, buf = range bufs {
+		if bw, err = w.CreateFormFile("file", "1.jpg"); err != nil {
+			return
 		}
+		if _, err = bw.Write(buf); err != nil {
+			return
+		}
+	}
+	for key, values = range params {
+		for _, value = range values {
+			w.WriteField(key, value)
+		}
+	}
+	if err = w.Close(); err != nil {
+		return
 	}
+	if req, err = http.NewRequest("POST", uri, bufdata); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return do(ctx, req, uri, res)
+}
+
+// do do the request in a span of ctx, decode the json response into res.
+func do(ctx context.Context, req *http.Request, ru string, res interface{}) (err error) {
+	var (
+		body []byte
+		resp *http.Response
+		span otrace.Span
+	)
+	ctx, span = trace.Client(ctx, req.URL.Path, attribute.String("bfs.server", req.URL.Host))
+	defer func() { trace.End(span, err) }()
+	req = req.WithContext(ctx)
+	trace.Inject(ctx, req)
+	audit.Inject(ctx, req)
+	reqid.Inject(ctx, req)
 	td := _timer.Start(5*time.Second, func() {
 		_canceler(req)
 	})
@@ -0,0 +1,273 @@
+package bfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/reqid"
+	"bfs/libs/trace"
+
+	"go.opentelemetry.io/otel/attribute"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+const _readTimeout = 5 * time.Second
+
+// readResult the response of a replica.
+type readResult struct {
+	store string
+	resp  *http.Response
+	err   error
+}
+
+// cancelBody cancel the request after the body closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	b.cancel()
+	return
+}
+
+// demote move the replica to the end of the reads for the demote duration.
+func (b *Bfs) demote(store string) {
+	if b.c.Read == nil || b.c.Read.Demote <= 0 {
+		return
+	}
+	b.dlock.Lock()
+	b.demoted[store] = time.Now().Add(time.Duration(b.c.Read.Demote))
+	b.dlock.Unlock()
+	log.Warningf("store: %s demoted for %v", store, b.c.Read.Demote)
+}
+
+// promote order the stores, the demoted replicas last.
+func (b *Bfs) promote(stores []string) (ss []string) {
+	var (
+		ok     bool
+		store  string
+		expire time.Time
+		now    = time.Now()
+		slow   []string
+	)
+	ss = make([]string, 0, len(stores))
+	b.dlock.Lock()
+	for _, store = range stores {
+		if expire, ok = b.demoted[store]; ok && now.Before(expire) {
+			slow = append(slow, store)
+			continue
+		} else if ok {
+			delete(b.demoted, store)
+		}
+		ss = append(ss, store)
+	}
+	b.dlock.Unlock()
+	ss = append(ss, slow...)
+	return
+}
+
+// readStore get the needle from the store in a span of ctx, the request is
+// canceled if no response in the read timeout.
+func (b *Bfs) readStore(ctx context.Context, store, query string, ch chan *readResult) {
+	var (
+		cancel context.CancelFunc
+		span   otrace.Span
+		req    *http.Request
+		uri    = fmt.Sprintf(_storeGetApi, store) + "?" + query
+		res    = &readResult{store: store}
+	)
+	ctx, span = trace.Client(ctx, "/get", attribute.String("bfs.server", store))
+	defer func() { trace.End(span, res.err) }()
+	ctx, cancel = context.WithCancel(ctx)
+	if req, res.err = http.NewRequest("GET", uri, nil); res.err != nil {
+		cancel()
+		ch <- res
+		return
+	}
+	req = req.WithContext(ctx)
+	trace.Inject(ctx, req)
+	reqid.Inject(ctx, req)
+	td := time.AfterFunc(_readTimeout, cancel)
+	if res.resp, res.err = _client.Do(req); res.err != nil {
+		log.Errorf("_client.do(%s) error(%v)", uri, res.err)
+		cancel()
+	} else {
+		res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancel}
+	}
+	td.Stop()
+	ch <- res
+}
+
+// read read the replicas in order, the next replica is read if the current
+// one fails or gets no response in the read budget, the slow one is given
+// up, or still raced with the next one if hedge. the failed and slow
+// replicas are demoted.
+func (b *Bfs) read(ctx context.Context, stores []string, query string) (resp *http.Response, err error) {
+	var (
+		i        int
+		pending  int
+		notFound bool
+		budget   time.Duration
+		hedge    bool
+		timer    *time.Timer
+		repair   bool
+		timeout  <-chan time.Time
+		res      *readResult
+		corrupt  []string
+		ch       = make(chan *readResult, len(stores))
+	)
+	if b.c.Read != nil {
+		budget, hedge, repair = time.Duration(b.c.Read.Budget), b.c.Read.Hedge, b.c.Read.Repair
+	}
+	stores = b.promote(stores)
+	for i < len(stores) || pending > 0 {
+		if pending == 0 {
+			go b.readStore(ctx, stores[i], query, ch)
+			i++
+			pending++
+			if budget > 0 {
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.NewTimer(budget)
+				timeout = timer.C
+			}
+		}
+		select {
+		case res = <-ch:
+			pending--
+			if res.err == nil && res.resp.StatusCode == http.StatusOK {
+				if timer != nil {
+					timer.Stop()
+				}
+				// give up the slower replicas
+				go drain(ch, pending)
+				if len(corrupt) > 0 {
+					res.resp.Body = &repairBody{ReadCloser: res.resp.Body, size: res.resp.ContentLength,
+						repair: func(data []byte) { b.repair(corrupt, query, data) }}
+				}
+				return res.resp, nil
+			}
+			if res.err == nil {
+				if repair && corrupted(res.resp) {
+					corrupt = append(corrupt, res.store)
+				}
+				res.resp.Body.Close()
+				// the needle may be missing only in the replica
+				if res.resp.StatusCode == http.StatusNotFound {
+					notFound = true
+					continue
+				}
+			}
+			b.demote(res.store)
+		case <-timeout:
+			timeout = nil
+			log.Warningf("store: %s read exceeded the budget: %v", stores[i-1], budget)
+			b.demote(stores[i-1])
+			if i == len(stores) {
+				continue
+			}
+			if !hedge {
+				go drain(ch, pending)
+				ch = make(chan *readResult, len(stores))
+				pending = 0
+				continue
+			}
+			go b.readStore(ctx, stores[i], query, ch)
+			i++
+			pending++
+			timer = time.NewTimer(budget)
+			timeout = timer.C
+		}
+	}
+	if notFound {
+		err = errors.ErrNeedleNotExist
+	} else {
+		err = errors.ErrStoreNotAvailable
+	}
+	return
+}
+
+// corrupted reports whether the replica failed by a checksum mismatch.
+func corrupted(resp *http.Response) bool {
+	var info errors.Info
+	if resp.StatusCode != http.StatusInternalServerError {
+		return false
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&info) != nil {
+		return false
+	}
+	return info.Ret == errors.RetNeedleChecksum
+}
+
+// repairBody keep the data of the needle read, the repair is called with it
+// once the body is read to the end and closed.
+type repairBody struct {
+	io.ReadCloser
+	buf    bytes.Buffer
+	size   int64
+	closed bool
+	repair func(data []byte)
+}
+
+func (b *repairBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return
+}
+
+func (b *repairBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	if !b.closed && int64(b.buf.Len()) == b.size {
+		go b.repair(b.buf.Bytes())
+	}
+	b.closed = true
+	return
+}
+
+// repair rewrite the needle of the query to the corrupted replicas by the
+// data read from a good one, the store appends it and tombstones the bad
+// copy like an overwrite.
+func (b *Bfs) repair(stores []string, query string, data []byte) {
+	var (
+		err    error
+		store  string
+		params url.Values
+		sRet   meta.StoreRet
+	)
+	if params, err = url.ParseQuery(query); err != nil {
+		log.Errorf("url.ParseQuery(%s) error(%v)", query, err)
+		return
+	}
+	for _, store = range stores {
+		if err = Https(context.Background(), fmt.Sprintf(_storeUploadApi, store), params, [][]byte{data}, &sRet); err == nil && sRet.Ret != errors.RetOK {
+			err = errors.Ret(sRet.Ret)
+		}
+		if err != nil {
+			log.Errorf("store: %s repair %s error(%v)", store, query, err)
+			continue
+		}
+		log.Warningf("store: %s repaired %s of %d bytes", store, query, len(data))
+	}
+}
+
+// drain close the responses of the given up reads.
+func drain(ch chan *readResult, pending int) {
+	var res *readResult
+	for ; pending > 0; pending-- {
+		if res = <-ch; res.err == nil {
+			res.resp.Body.Close()
+		}
+	}
+}
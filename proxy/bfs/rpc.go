@@ -0,0 +1,90 @@
+package bfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/rpc"
+)
+
+// directory call the directory api by grpc if enabled, else by http.
+func (b *Bfs) directory(ctx context.Context, method, api string, params url.Values, res *meta.Response) (err error) {
+	var (
+		r      *meta.Response
+		cancel context.CancelFunc
+		gr     *rpc.GetRequest
+	)
+	if b.rpc == nil {
+		return Http(ctx, method, fmt.Sprintf(api, b.c.BfsAddr), params, nil, res)
+	}
+	ctx, cancel = context.WithTimeout(ctx, time.Duration(b.c.BfsTimeout))
+	defer cancel()
+	gr = &rpc.GetRequest{Bucket: params.Get("bucket"), Filename: params.Get("filename"), Region: params.Get("region")}
+	switch api {
+	case _directoryGetApi:
+		r, err = b.rpc.Get(ctx, gr)
+	case _directoryDelApi:
+		r, err = b.rpc.Del(ctx, gr)
+	case _directoryUploadApi:
+		ur := &rpc.UploadRequest{Bucket: gr.Bucket, Filename: gr.Filename, Sha1: params.Get("sha1"), Mine: params.Get("mine"), Name: params.Get("name")}
+		if ur.MTime, err = strconv.ParseInt(params.Get("mtime"), 10, 64); err != nil {
+			return
+		}
+		if ur.Size, err = strconv.ParseInt(params.Get("size"), 10, 64); err != nil {
+			return
+		}
+		r, err = b.rpc.Upload(ctx, ur)
+	}
+	if err != nil {
+		log.Errorf("rpc %s(%v) error(%v)", api, gr, err)
+		return
+	}
+	*res = *r
+	return
+}
+
+// rpcGets resolve the files by the grpc stream, the deadline is for the
+// whole batch.
+func (b *Bfs) rpcGets(ctx context.Context, bucket string, filenames []string) (files []*meta.Response, err error) {
+	var (
+		filename string
+		res      *meta.Response
+		stream   *rpc.DirectoryStream
+		cancel   context.CancelFunc
+	)
+	ctx, cancel = context.WithTimeout(ctx, time.Duration(b.c.BfsTimeout))
+	defer cancel()
+	if stream, err = b.rpc.Gets(ctx); err != nil {
+		log.Errorf("rpc.Gets() error(%v)", err)
+		return
+	}
+	// the directory replies while the requests are sending
+	go func() {
+		for _, filename := range filenames {
+			if err := stream.Send(&rpc.GetRequest{Bucket: bucket, Filename: filename, Region: b.c.Region}); err != nil {
+				log.Errorf("stream.Send(%s) error(%v)", filename, err)
+				return
+			}
+		}
+		stream.CloseSend()
+	}()
+	files = make([]*meta.Response, 0, len(filenames))
+	for _, filename = range filenames {
+		if res, err = stream.Recv(); err != nil {
+			if err == io.EOF {
+				err = errors.ErrInternal
+			}
+			log.Errorf("stream.Recv(%s) error(%v)", filename, err)
+			return
+		}
+		files = append(files, res)
+	}
+	return
+}
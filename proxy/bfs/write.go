@@ -0,0 +1,180 @@
+package bfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bfs/libs/log"
+)
+
+const (
+	// the consistency levels of the uploads, the replicas acked before the
+	// upload returns, the rest are written in the background
+	ConsistencyOne    = "one"
+	ConsistencyQuorum = "quorum"
+	ConsistencyAll    = "all"
+	// the header of the consistency level of an upload
+	HeaderConsistency = "X-Bfs-Consistency"
+
+	_writeRetries = 3
+	_debtLost     = 1024
+)
+
+type consistencyKey struct{}
+
+// ValidConsistency check the consistency level, empty is the default.
+func ValidConsistency(level string) bool {
+	return level == "" || level == ConsistencyOne || level == ConsistencyQuorum || level == ConsistencyAll
+}
+
+// WithConsistency the uploads of ctx are acked by the level, empty uses the
+// default of the config.
+func WithConsistency(ctx context.Context, level string) context.Context {
+	if level == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, consistencyKey{}, level)
+}
+
+// consistency get the consistency level of the uploads of ctx.
+func (b *Bfs) consistency(ctx context.Context) string {
+	if level, ok := ctx.Value(consistencyKey{}).(string); ok {
+		return level
+	}
+	if b.c.Write != nil && b.c.Write.Consistency != "" {
+		return b.c.Write.Consistency
+	}
+	return ConsistencyAll
+}
+
+// acks the replicas of n acked by the level.
+func acks(level string, n int) int {
+	switch level {
+	case ConsistencyOne:
+		if n > 0 {
+			return 1
+		}
+	case ConsistencyQuorum:
+		return n/2 + 1
+	}
+	return n
+}
+
+// Replica the needles of a volume failed to write to the store after the
+// upload acked.
+type Replica struct {
+	Store string  `json:"store"`
+	Vid   int32   `json:"vid"`
+	Keys  []int64 `json:"keys"`
+	Time  int64   `json:"time"`
+}
+
+// Debt the repair debt of the uploads acked before written to all the
+// replicas, the lost ones must be repaired, e.g. by a re-upload.
+type Debt struct {
+	Pending int64      `json:"pending"` // the replicas being written
+	Failed  int64      `json:"failed"`  // the replicas failed after the retries
+	Lost    []*Replica `json:"lost"`    // the latest failed replicas
+}
+
+// debt the repair debt tracked by the proxy.
+type debt struct {
+	lock sync.Mutex
+	d    Debt
+}
+
+func (d *debt) add(pending int64) {
+	d.lock.Lock()
+	d.d.Pending += pending
+	d.lock.Unlock()
+}
+
+func (d *debt) lose(r *Replica) {
+	d.lock.Lock()
+	d.d.Pending--
+	d.d.Failed++
+	if d.d.Lost = append(d.d.Lost, r); len(d.d.Lost) > _debtLost {
+		d.d.Lost = d.d.Lost[len(d.d.Lost)-_debtLost:]
+	}
+	d.lock.Unlock()
+}
+
+// Debt get the repair debt of the uploads of the lower consistency levels.
+func (b *Bfs) Debt() (d *Debt) {
+	b.debt.lock.Lock()
+	d = &Debt{Pending: b.debt.d.Pending, Failed: b.debt.d.Failed}
+	d.Lost = append([]*Replica{}, b.debt.d.Lost...)
+	b.debt.lock.Unlock()
+	return
+}
+
+// replicate write the needles of the volume to every store by put, return
+// once the replicas of the consistency level of ctx are written, the first
+// error if they can't be. the all level writes the stores one by one, the
+// others at the same time, the rest in the background after acked, retried
+// and counted in the debt if failed.
+func (b *Bfs) replicate(ctx context.Context, stores []string, vid int32, keys []int64, put func(ctx context.Context, host string) error) (err error) {
+	var (
+		ok, failed int
+		host       string
+		need       = acks(b.consistency(ctx), len(stores))
+		ch         = make(chan error, len(stores))
+	)
+	if need == len(stores) {
+		for _, host = range stores {
+			if err = put(ctx, host); err != nil {
+				return
+			}
+		}
+		return
+	}
+	// outlives the request
+	ctx = context.WithoutCancel(ctx)
+	b.debt.add(int64(len(stores)))
+	for _, host = range stores {
+		go b.replica(ctx, host, vid, keys, put, ch)
+	}
+	for range stores {
+		if e := <-ch; e == nil {
+			ok++
+		} else {
+			failed++
+			if err == nil {
+				err = e
+			}
+		}
+		if ok == need {
+			return nil
+		}
+		if failed > len(stores)-need {
+			return
+		}
+	}
+	return
+}
+
+// replica write the replica, the result of the first try is sent to ch, then
+// retried in the background if failed.
+func (b *Bfs) replica(ctx context.Context, host string, vid int32, keys []int64, put func(ctx context.Context, host string) error, ch chan<- error) {
+	var (
+		i       int
+		err     error
+		retries = _writeRetries
+	)
+	if b.c.Write != nil {
+		retries = b.c.Write.Retries
+	}
+	err = put(ctx, host)
+	ch <- err
+	for i = 1; err != nil && i <= retries; i++ {
+		time.Sleep(time.Duration(i) * time.Second)
+		err = put(ctx, host)
+	}
+	if err != nil {
+		log.Errorf("replicate store: %s vid: %d keys: %v error(%v), need repair", host, vid, keys, err)
+		b.debt.lose(&Replica{Store: host, Vid: vid, Keys: keys, Time: time.Now().Unix()})
+		return
+	}
+	b.debt.add(-1)
+}
@@ -1,9 +1,17 @@
 package bucket
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
 
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/proxy/conf"
 )
 
 const (
@@ -15,15 +23,28 @@ const (
 	_privateRead      = int(1 << _privateReadBit)
 	_privateWrite     = int(1 << _privateWriteBit)
 	_privateReadWrite = int(_privateRead | _privateWrite)
+
+	_bucketsApi = "http://%s/buckets"
+	_keysApi    = "http://%s/bucket/keys"
+)
+
+var (
+	_client = &http.Client{Timeout: 5 * time.Second}
 )
 
 // bucket_name  property  key_id  key_secret
 type Bucket struct {
+	lock sync.RWMutex
 	data map[string]*Item
+	c    *conf.Config
 }
 
+// Header the response header policy of the downloads, the custom headers
+// override the others.
 type Header struct {
-	CacheControl int64
+	CacheControl       int64
+	ContentDisposition string
+	Custom             http.Header
 }
 
 type Item struct {
@@ -33,8 +54,11 @@ type Item struct {
 	Domain    string
 	PurgeCDN  bool
 	Header    *Header
+	CORS      *CORS
 	// property   第0位：读 (0表示共有，1表示私有)  第1位：写 (0表示共有，1表示私有)
 	property int
+	// all the access keys, key_id:key_secret
+	keys map[string]string
 }
 
 func (i *Item) String() string {
@@ -49,6 +73,15 @@ func (i *Item) readPublic() bool {
 	return i.property&_privateRead == 0
 }
 
+// Secret get the secret of the access key.
+func (i *Item) Secret(keyId string) (secret string, ok bool) {
+	if keyId == i.KeyId {
+		return i.KeySecret, true
+	}
+	secret, ok = i.keys[keyId]
+	return
+}
+
 // Public check the item is public or not.
 func (i *Item) Public(read bool) bool {
 	if read {
@@ -57,10 +90,19 @@ func (i *Item) Public(read bool) bool {
 	return i.writePublic()
 }
 
-// New a bucket.
-func New() (b *Bucket, err error) {
+// New a bucket, the buckets are loaded from the directory if BucketRefresh
+// set, else only the test bucket.
+func New(c *conf.Config) (b *Bucket, err error) {
 	var item *Item
 	b = new(Bucket)
+	b.c = c
+	if c.BucketRefresh > 0 {
+		if err = b.load(); err != nil {
+			return
+		}
+		go b.loadproc()
+		return
+	}
 	b.data = make(map[string]*Item)
 	// bucket test
 	item = new(Item)
@@ -73,10 +115,109 @@ func New() (b *Bucket, err error) {
 	return
 }
 
+// newItem convert the directory bucket meta, the first key is the primary.
+func newItem(mb *meta.Bucket) (item *Item) {
+	var (
+		name  string
+		value string
+		key   *meta.BucketKey
+	)
+	item = new(Item)
+	item.Name = mb.Name
+	item.property = mb.Property
+	item.Domain = mb.Domain
+	item.PurgeCDN = mb.PurgeCDN
+	if mb.CacheControl > 0 || mb.ContentDisposition != "" || len(mb.Headers) > 0 {
+		item.Header = &Header{CacheControl: mb.CacheControl, ContentDisposition: mb.ContentDisposition}
+	}
+	if len(mb.Headers) > 0 {
+		item.Header.Custom = make(http.Header, len(mb.Headers))
+		for name, value = range mb.Headers {
+			item.Header.Custom.Set(name, value)
+		}
+	}
+	item.CORS = newCORS(mb.CORS)
+	item.keys = make(map[string]string, len(mb.Keys))
+	for _, key = range mb.Keys {
+		if item.KeyId == "" {
+			item.KeyId, item.KeySecret = key.Id, key.Secret
+		}
+		item.keys[key.Id] = key.Secret
+	}
+	return
+}
+
+// load load all the buckets from the directory, the access keys from the
+// directory admin api.
+func (b *Bucket) load() (err error) {
+	var (
+		mb   *meta.Bucket
+		res  = new(meta.Buckets)
+		keys = new(meta.BucketKeys)
+		data = make(map[string]*Item)
+	)
+	if err = get(fmt.Sprintf(_bucketsApi, b.c.BfsAddr), res, &res.Ret); err != nil {
+		return
+	}
+	if err = get(fmt.Sprintf(_keysApi, b.c.BfsAdminAddr), keys, &keys.Ret); err != nil {
+		return
+	}
+	for _, mb = range res.Buckets {
+		// the bucket created meanwhile has no keys until the next load
+		mb.Keys = keys.Keys[mb.Name]
+		data[mb.Name] = newItem(mb)
+	}
+	b.lock.Lock()
+	b.data = data
+	b.lock.Unlock()
+	return
+}
+
+// get get the json response of the directory api.
+func get(uri string, res interface{}, ret *int) (err error) {
+	var (
+		body []byte
+		resp *http.Response
+	)
+	if resp, err = _client.Get(uri); err != nil {
+		log.Errorf("_client.Get(%s) error(%v)", uri, err)
+		return
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if err = json.Unmarshal(body, res); err != nil {
+		// the body may have the secrets
+		log.Errorf("json.Unmarshal(%s) error(%v)", uri, err)
+		return
+	}
+	if *ret != errors.RetOK {
+		log.Errorf("directory %s ret: %d", uri, *ret)
+		return errors.Error(*ret)
+	}
+	return
+}
+
+// loadproc reload the buckets every BucketRefresh, keep the last buckets
+// if failed.
+func (b *Bucket) loadproc() {
+	var err error
+	for {
+		time.Sleep(time.Duration(b.c.BucketRefresh))
+		if err = b.load(); err != nil {
+			log.Errorf("bucket load() error(%v)", err)
+		}
+	}
+}
+
 // Get get a bucket, if not exist then error.
 func (b *Bucket) Get(name string) (item *Item, err error) {
 	var ok bool
-	if item, ok = b.data[name]; !ok {
+	b.lock.RLock()
+	item, ok = b.data[name]
+	b.lock.RUnlock()
+	if !ok {
 		err = errors.ErrBucketNotExist
 	}
 	return
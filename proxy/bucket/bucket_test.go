@@ -0,0 +1,62 @@
+package bucket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bfs/libs/meta"
+	"bfs/proxy/conf"
+)
+
+func TestNewItem(t *testing.T) {
+	var item *Item
+	if item = newItem(&meta.Bucket{Name: "a"}); item.Header != nil || item.CORS != nil {
+		t.Errorf("newItem() header: %v cors: %v", item.Header, item.CORS)
+		t.FailNow()
+	}
+	item = newItem(&meta.Bucket{Name: "a", ContentDisposition: "attachment",
+		Headers: map[string]string{"x-robots-tag": "noindex"}})
+	if item.Header == nil || item.Header.CacheControl != 0 || item.Header.ContentDisposition != "attachment" ||
+		item.Header.Custom.Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("newItem() header: %v", item.Header)
+		t.FailNow()
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var (
+		err    error
+		ok     bool
+		secret string
+		item   *Item
+		b      = new(Bucket)
+		api    = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			wr.Write([]byte(`{"ret":1,"buckets":[{"name":"a","property":2,"keys":[{"id":"k1"}]},{"name":"b","property":0,"keys":[]}]}`))
+		}))
+		admin = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			wr.Write([]byte(`{"ret":1,"keys":{"a":[{"id":"k1","secret":"s1"},{"id":"k2","secret":"s2"}]}}`))
+		}))
+	)
+	defer api.Close()
+	defer admin.Close()
+	b.c = &conf.Config{BfsAddr: strings.TrimPrefix(api.URL, "http://"), BfsAdminAddr: strings.TrimPrefix(admin.URL, "http://")}
+	if err = b.load(); err != nil {
+		t.Errorf("load() error(%v)", err)
+		t.FailNow()
+	}
+	if item, err = b.Get("a"); err != nil || item.KeyId != "k1" || item.KeySecret != "s1" {
+		t.Errorf("Get(a) item: %v error(%v)", item, err)
+		t.FailNow()
+	}
+	if secret, ok = item.Secret("k2"); !ok || secret != "s2" {
+		t.Errorf("Secret(k2) secret: %s ok: %v", secret, ok)
+		t.FailNow()
+	}
+	// created after the keys loaded
+	if item, err = b.Get("b"); err != nil || item.KeyId != "" || !item.Public(false) {
+		t.Errorf("Get(b) item: %v error(%v)", item, err)
+		t.FailNow()
+	}
+}
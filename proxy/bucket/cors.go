@@ -0,0 +1,102 @@
+package bucket
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bfs/libs/meta"
+)
+
+const (
+	_corsAny = "*"
+	// the response headers read by the browser scripts
+	_corsExposeHeaders = "Code, Location, ETag"
+)
+
+// CORS the cors rule of the bucket, a nil CORS allows no cross origin
+// request.
+type CORS struct {
+	origins      map[string]bool
+	anyOrigin    bool
+	methods      map[string]bool
+	headers      map[string]bool
+	anyHeader    bool
+	allowMethods string
+	maxAge       string
+}
+
+// newCORS convert the directory bucket cors, nil if not set.
+func newCORS(mc *meta.BucketCORS) (c *CORS) {
+	var s string
+	if mc == nil || len(mc.Origins) == 0 {
+		return nil
+	}
+	c = &CORS{
+		origins: make(map[string]bool, len(mc.Origins)),
+		methods: make(map[string]bool, len(mc.Methods)),
+		headers: make(map[string]bool, len(mc.Headers)),
+	}
+	for _, s = range mc.Origins {
+		if s == _corsAny {
+			c.anyOrigin = true
+		}
+		c.origins[s] = true
+	}
+	for _, s = range mc.Methods {
+		c.methods[strings.ToUpper(s)] = true
+	}
+	for _, s = range mc.Headers {
+		if s == _corsAny {
+			c.anyHeader = true
+		}
+		c.headers[http.CanonicalHeaderKey(s)] = true
+	}
+	c.allowMethods = strings.ToUpper(strings.Join(mc.Methods, ", "))
+	if mc.MaxAge > 0 {
+		c.maxAge = strconv.FormatInt(mc.MaxAge, 10)
+	}
+	return
+}
+
+// allowOrigin reports whether the origin is allowed.
+func (c *CORS) allowOrigin(origin string) bool {
+	return c != nil && origin != "" && (c.anyOrigin || c.origins[origin])
+}
+
+// Preflight check the preflight request by the origin, the requested
+// method and headers, set the response headers if allowed.
+func (c *CORS) Preflight(h http.Header, origin, method, headers string) bool {
+	var s string
+	if !c.allowOrigin(origin) || !c.methods[method] {
+		return false
+	}
+	if !c.anyHeader && headers != "" {
+		for _, s = range strings.Split(headers, ",") {
+			if s = strings.TrimSpace(s); s != "" && !c.headers[http.CanonicalHeaderKey(s)] {
+				return false
+			}
+		}
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	h.Add("Vary", "Origin")
+	return true
+}
+
+// Actual set the response headers of the cross origin request if the
+// origin and method are allowed.
+func (c *CORS) Actual(h http.Header, origin, method string) {
+	if !c.allowOrigin(origin) || !c.methods[method] {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Expose-Headers", _corsExposeHeaders)
+	h.Add("Vary", "Origin")
+}
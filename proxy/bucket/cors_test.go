@@ -0,0 +1,63 @@
+package bucket
+
+import (
+	"net/http"
+	"testing"
+
+	"bfs/libs/meta"
+)
+
+func TestCORS(t *testing.T) {
+	var (
+		h = http.Header{}
+		c = newCORS(&meta.BucketCORS{
+			Origins: []string{"http://a.com"},
+			Methods: []string{"get", "PUT"},
+			Headers: []string{"authorization", "Content-Type"},
+			MaxAge:  600,
+		})
+	)
+	if newCORS(nil) != nil || newCORS(&meta.BucketCORS{}) != nil {
+		t.Errorf("newCORS() empty rule not nil")
+		t.FailNow()
+	}
+	if !c.Preflight(h, "http://a.com", "PUT", "Authorization, content-type") {
+		t.Errorf("Preflight() not allowed")
+		t.FailNow()
+	}
+	if h.Get("Access-Control-Allow-Origin") != "http://a.com" || h.Get("Access-Control-Allow-Methods") != "GET, PUT" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Preflight() headers: %v", h)
+		t.FailNow()
+	}
+	if c.Preflight(http.Header{}, "http://b.com", "GET", "") {
+		t.Errorf("Preflight() origin allowed")
+		t.FailNow()
+	}
+	if c.Preflight(http.Header{}, "http://a.com", "DELETE", "") {
+		t.Errorf("Preflight() method allowed")
+		t.FailNow()
+	}
+	if c.Preflight(http.Header{}, "http://a.com", "GET", "X-Foo") {
+		t.Errorf("Preflight() header allowed")
+		t.FailNow()
+	}
+	h = http.Header{}
+	c.Actual(h, "http://a.com", "GET")
+	if h.Get("Access-Control-Allow-Origin") != "http://a.com" || h.Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("Actual() headers: %v", h)
+		t.FailNow()
+	}
+	h = http.Header{}
+	c = newCORS(&meta.BucketCORS{Origins: []string{"*"}, Methods: []string{"GET"}, Headers: []string{"*"}})
+	if !c.Preflight(h, "http://b.com", "GET", "X-Foo") || h.Get("Access-Control-Allow-Headers") != "X-Foo" {
+		t.Errorf("Preflight() any: %v", h)
+		t.FailNow()
+	}
+	// nil allows nothing
+	c = nil
+	if c.Preflight(http.Header{}, "http://a.com", "GET", "") {
+		t.Errorf("Preflight() nil allowed")
+		t.FailNow()
+	}
+}
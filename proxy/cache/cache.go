@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"bfs/libs/log"
 	"bfs/libs/memcache"
 	"bfs/libs/meta"
 
-	log "github.com/golang/glog"
 	gm "golang/gomemcache/memcache"
 )
 
@@ -1,10 +1,16 @@
 package conf
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
 	"bfs/libs/memcache"
 	"bfs/libs/time"
+	"bfs/libs/trace"
+	"fmt"
+	"math"
 	"path"
 	"strings"
+	xtime "time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -17,12 +23,31 @@ type Config struct {
 	HttpAddr string
 	// directory
 	BfsAddr string
+	// directory grpc, empty uses the http api
+	BfsRpcAddr string
+	// directory grpc deadline
+	BfsTimeout time.Duration
+	// reload the buckets from the directory every, 0 uses the test bucket
+	BucketRefresh time.Duration
+	// directory admin api, the access keys of the buckets are loaded from
+	BfsAdminAddr string
+	// region of the proxy, reads prefer the replicas in the region
+	Region string
+	// replica reads, nil reads the replicas one by one until ok
+	Read *Read
+	// replica writes, nil writes all the replicas before the uploads return
+	Write *Write
 	// download domain
 	Domain string
 	// location prefix
 	Prefix string
 	// file
 	MaxFileSize int
+	// log the requests slower than it, disabled if zero
+	SlowLog time.Duration
+	// max files of a multipart POST upload, 0 disables it, no more than the
+	// directory MaxNum
+	MaxUploadNum int
 	// aliyun
 	AliyunKeyId     string
 	AliyunKeySecret string
@@ -39,6 +64,108 @@ type Config struct {
 	Mc       *memcache.Config
 	// limit rate
 	Limit *Limit
+	// limit rate by the access key, bucket and client ip, nil disables
+	RateLimit *RateLimit
+	// thumbnail, nil disables
+	Image *Image
+	// read-through cache of the hot files, nil disables
+	DiskCache *DiskCache
+	// webdav of the buckets, nil disables
+	WebDAV *WebDAV
+	// the request middlewares, nil disables
+	Hook *Hook
+	// the object created and deleted events, nil publishes none
+	Notify *Notify
+	// the logging, nil keeps glog
+	Log *log.Config
+	// the tracing, nil exports no spans
+	Tracing *trace.Config
+}
+
+// Hook the request middlewares called in order before and after the
+// uploads and before the downloads, by the registered names, the built in
+// ones are sniff, callout and audit.
+type Hook struct {
+	Names []string
+	// the config of the hooks, name:key:value
+	Config map[string]map[string]string
+}
+
+// Notify publish the object created and deleted events to the sinks in the
+// background, at least once, an event is dropped when the queue is full or
+// its sink still fails after the retries.
+type Notify struct {
+	// the events buffered, 10000 by default
+	Queue int
+	// the events of a request to a sink, 100 by default
+	Batch int
+	// the retries of a failed request
+	Retries int
+	Sinks   []*NotifySink
+}
+
+// NotifySink a sink of the events.
+type NotifySink struct {
+	// webhook posts the json array of the events to the Url, nsq publishes
+	// them to the Topic by the nsqd http Url, kafka by the kafka rest proxy
+	// Url
+	Kind  string
+	Url   string
+	Topic string
+	// the buckets and the event types published, all if empty
+	Buckets []string
+	Events  []string
+	// the request timeout, 5s by default
+	Timeout time.Duration
+}
+
+// WebDAV the buckets by webdav under the prefix, /prefix/bucket/filename,
+// authorized by the basic auth of the bucket access key id and secret.
+type WebDAV struct {
+	// not the Prefix, a bucket of the same name is hidden
+	Prefix string
+}
+
+// DiskCache the lru cache of the hot files in the local dir, validated by
+// the sha1 (ETag) of the directory on every read.
+type DiskCache struct {
+	// in memory if empty, not the Image.CacheDir
+	Dir string
+	// the total bytes
+	Size int64
+	// the larger files are not cached
+	MaxFileSize int64
+}
+
+// Image the thumbnail of the images by ?w=..&h=..&q=..&crop=1.
+type Image struct {
+	// max width or height
+	MaxSize int
+	// the lru cache of the thumbnails in bytes, in CacheDir or memory if empty
+	CacheSize int64
+	CacheDir  string
+}
+
+// Read the failover of the replica reads.
+type Read struct {
+	// the next replica is read if no response in the budget, 0 only on error
+	Budget time.Duration
+	// race the slow replica with the next one, else give it up
+	Hedge bool
+	// the failed or slow replica is read last for
+	Demote time.Duration
+	// rewrite the needle to the replicas failed by a checksum mismatch with
+	// the data read from a good one
+	Repair bool
+}
+
+// Write the consistency of the replica writes of the uploads.
+type Write struct {
+	// the replicas acked before an upload returns, one, quorum or all, the
+	// default of the uploads without the X-Bfs-Consistency header
+	Consistency string
+	// the retries of a replica failed in the background
+	Retries int
 }
 
 // Limit limit rate
@@ -47,6 +174,22 @@ type Limit struct {
 	Brust int
 }
 
+// RateLimit the token bucket limits of every access key, bucket and client
+// ip, a nil limit does not limit the kind, the exceeded requests get 429.
+type RateLimit struct {
+	Key    *Limit
+	Bucket *Limit
+	IP     *Limit
+	// the specific limits of the access keys and buckets
+	Keys    map[string]*Limit
+	Buckets map[string]*Limit
+	// the header of the client ip set by the front proxy, e.g. X-Real-IP,
+	// empty uses the remote addr
+	IPHeader string
+	// drop the limiters idle for, longer than Brust/Rate
+	Expire time.Duration
+}
+
 // NewConfig new a config.
 func NewConfig(conf string) (c *Config, err error) {
 	c = new(Config)
@@ -59,5 +202,150 @@ func NewConfig(conf string) (c *Config, err error) {
 		// http://domain/ covert to http://domain
 		c.Domain = strings.TrimRight(c.Domain, "/")
 	}
+	if c.WebDAV != nil {
+		c.WebDAV.Prefix = path.Join("/", c.WebDAV.Prefix) + "/"
+	}
 	return
 }
+
+// Check check the config values, return all the problems found.
+func (c *Config) Check() error {
+	var ck = check.New()
+	ck.Addr("HttpAddr", c.HttpAddr)
+	ck.Addr("BfsAddr", c.BfsAddr)
+	if c.BfsRpcAddr != "" {
+		ck.Addr("BfsRpcAddr", c.BfsRpcAddr)
+		ck.Positive("BfsTimeout", xtime.Duration(c.BfsTimeout))
+	}
+	if c.BucketRefresh != 0 {
+		ck.Positive("BucketRefresh", xtime.Duration(c.BucketRefresh))
+		ck.Addr("BfsAdminAddr", c.BfsAdminAddr)
+	}
+	if c.PprofEnable {
+		ck.Addr("PprofListen", c.PprofListen)
+	}
+	ck.Range("MaxFileSize", int64(c.MaxFileSize), 1, math.MaxInt32)
+	if c.SlowLog != 0 {
+		ck.Positive("SlowLog", xtime.Duration(c.SlowLog))
+	}
+	if c.MaxUploadNum != 0 {
+		ck.Range("MaxUploadNum", int64(c.MaxUploadNum), 1, math.MaxInt16)
+	}
+	ck.Range("PurgeMaxSize", int64(c.PurgeMaxSize), 1, math.MaxInt32)
+	ck.Positive("ExpireMc", xtime.Duration(c.ExpireMc))
+	if ck.NotNil("Mc", c.Mc != nil) {
+		ck.Addr("Mc.Addr", c.Mc.Addr)
+		ck.Range("Mc.Active", int64(c.Mc.Active), 1, math.MaxInt32)
+		ck.Range("Mc.Idle", int64(c.Mc.Idle), 1, int64(c.Mc.Active))
+	}
+	if ck.NotNil("Limit", c.Limit != nil) {
+		if c.Limit.Rate <= 0 {
+			ck.Errorf("Limit.Rate: %f must be positive", c.Limit.Rate)
+		}
+		ck.Range("Limit.Brust", int64(c.Limit.Brust), 1, math.MaxInt32)
+	}
+	if c.RateLimit != nil {
+		c.RateLimit.check(ck)
+	}
+	if c.Read != nil && (c.Read.Budget < 0 || c.Read.Demote < 0) {
+		ck.Errorf("Read.Budget: %v and Read.Demote: %v must not be negative", c.Read.Budget, c.Read.Demote)
+	}
+	if c.Write != nil {
+		switch c.Write.Consistency {
+		case "", "one", "quorum", "all":
+		default:
+			ck.Errorf("Write.Consistency: unknown level \"%s\"", c.Write.Consistency)
+		}
+		ck.Range("Write.Retries", int64(c.Write.Retries), 0, math.MaxInt16)
+	}
+	if c.DiskCache != nil {
+		ck.Range("DiskCache.Size", c.DiskCache.Size, 1, math.MaxInt64)
+		ck.Range("DiskCache.MaxFileSize", c.DiskCache.MaxFileSize, 1, c.DiskCache.Size)
+		if c.Image != nil && c.Image.CacheDir != "" && path.Clean(c.Image.CacheDir) == path.Clean(c.DiskCache.Dir) {
+			ck.Errorf("DiskCache.Dir: %s must not be the Image.CacheDir", c.DiskCache.Dir)
+		}
+	}
+	if c.Notify != nil {
+		c.Notify.check(ck)
+	}
+	if c.WebDAV != nil && (c.WebDAV.Prefix == "/" || c.WebDAV.Prefix == c.Prefix) {
+		ck.Errorf("WebDAV.Prefix: %s must not be / or the Prefix", c.WebDAV.Prefix)
+	}
+	if c.Image != nil {
+		ck.Range("Image.MaxSize", int64(c.Image.MaxSize), 1, 10000)
+		ck.Range("Image.CacheSize", c.Image.CacheSize, 1, math.MaxInt64)
+	}
+	if c.Log != nil {
+		if err := c.Log.Check(); err != nil {
+			ck.Errorf("Log: %v", err)
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Check(); err != nil {
+			ck.Errorf("Tracing.%v", err)
+		}
+	}
+	return ck.Err()
+}
+
+// check check the sinks.
+func (n *Notify) check(ck *check.Checker) {
+	var (
+		i int
+		s *NotifySink
+		e string
+	)
+	ck.Range("Notify.Queue", int64(n.Queue), 0, math.MaxInt32)
+	ck.Range("Notify.Batch", int64(n.Batch), 0, math.MaxInt16)
+	ck.Range("Notify.Retries", int64(n.Retries), 0, math.MaxInt16)
+	if len(n.Sinks) == 0 {
+		ck.Errorf("Notify.Sinks: must be set")
+	}
+	for i, s = range n.Sinks {
+		switch s.Kind {
+		case "webhook":
+		case "nsq", "kafka":
+			ck.NotEmpty(fmt.Sprintf("Notify.Sinks[%d].Topic", i), s.Topic)
+		default:
+			ck.Errorf("Notify.Sinks[%d].Kind: unknown sink \"%s\"", i, s.Kind)
+		}
+		ck.NotEmpty(fmt.Sprintf("Notify.Sinks[%d].Url", i), s.Url)
+		for _, e = range s.Events {
+			if e != "ObjectCreated" && e != "ObjectDeleted" {
+				ck.Errorf("Notify.Sinks[%d].Events: unknown event \"%s\"", i, e)
+			}
+		}
+		if s.Timeout < 0 {
+			ck.Errorf("Notify.Sinks[%d].Timeout: %v must not be negative", i, s.Timeout)
+		}
+	}
+}
+
+// check check the limits.
+func (r *RateLimit) check(ck *check.Checker) {
+	var (
+		name string
+		l    *Limit
+	)
+	ck.Positive("RateLimit.Expire", xtime.Duration(r.Expire))
+	r.Key.check(ck, "RateLimit.Key")
+	r.Bucket.check(ck, "RateLimit.Bucket")
+	r.IP.check(ck, "RateLimit.IP")
+	for name, l = range r.Keys {
+		l.check(ck, "RateLimit.Keys."+name)
+	}
+	for name, l = range r.Buckets {
+		l.check(ck, "RateLimit.Buckets."+name)
+	}
+}
+
+// check check the limit, nil is valid.
+func (l *Limit) check(ck *check.Checker, name string) {
+	if l == nil {
+		return
+	}
+	if l.Rate <= 0 {
+		ck.Errorf("%s.Rate: %f must be positive", name, l.Rate)
+	}
+	ck.Range(name+".Brust", int64(l.Brust), 1, math.MaxInt32)
+}
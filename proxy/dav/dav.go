@@ -0,0 +1,470 @@
+package dav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+
+	"golang.org/x/net/webdav"
+)
+
+const (
+	_delimiter = "/"
+	// the files once list
+	_listLimit = 1000
+	// the max entries of a directory
+	_maxEntries = 10000
+)
+
+// Storage the files of the buckets.
+type Storage interface {
+	Get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error)
+	Stat(bucket, filename string) (mf *meta.File, err error)
+	List(bucket, prefix, delimiter, marker string, limit int) (l *meta.List, err error)
+	Upload(bucket, filename, name, mine, sha1 string, buf []byte) (err error)
+	Delete(bucket, filename string) (err error)
+	Alias(bucket, filename, alias string) (err error)
+}
+
+// FS the webdav file system of the buckets, the name is /bucket/filename and
+// the directories are simulated by the "/" in the filenames. the made
+// directories and the empty files can not be stored, they are kept in memory
+// until a file is put under or they are removed.
+type FS struct {
+	s       Storage
+	maxSize int
+	maxName int
+	lock    sync.RWMutex
+	empty   map[string]bool // bucket/filename:dir
+}
+
+// New new a file system, the files are no more than max size and the
+// filenames no longer than max name.
+func New(s Storage, maxSize, maxName int) *FS {
+	return &FS{s: s, maxSize: maxSize, maxName: maxName, empty: make(map[string]bool)}
+}
+
+// split split the name to the bucket and the filename.
+func split(name string) (bucket, filename string) {
+	var i int
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if i = strings.Index(name, _delimiter); i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
+
+// getEmpty get the in memory entry.
+func (f *FS) getEmpty(key string) (dir, ok bool) {
+	f.lock.RLock()
+	dir, ok = f.empty[key]
+	f.lock.RUnlock()
+	return
+}
+
+// setEmpty keep the entry in memory.
+func (f *FS) setEmpty(key string, dir bool) {
+	f.lock.Lock()
+	f.empty[key] = dir
+	f.lock.Unlock()
+}
+
+// delEmpty drop the entry and the ones under it, and the parents if only
+// the parents are given, which exist by the put file now.
+func (f *FS) delEmpty(key string, parents bool) {
+	var k string
+	f.lock.Lock()
+	delete(f.empty, key)
+	for k = range f.empty {
+		if strings.HasPrefix(k, key+_delimiter) {
+			delete(f.empty, k)
+		}
+	}
+	for parents {
+		if key = path.Dir(key); key == "." || !strings.Contains(key, _delimiter) {
+			break
+		}
+		delete(f.empty, key)
+	}
+	f.lock.Unlock()
+}
+
+// Mkdir make a directory, kept in memory until a file is put under.
+func (f *FS) Mkdir(ctx context.Context, name string, perm os.FileMode) (err error) {
+	var (
+		bucket, filename = split(name)
+		dir              string
+	)
+	if filename == "" {
+		return os.ErrExist
+	}
+	if _, err = f.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	if dir = path.Dir(filename); dir != "." {
+		if _, err = f.Stat(ctx, path.Join(bucket, dir)); err != nil {
+			return
+		}
+	}
+	f.setEmpty(bucket+_delimiter+filename, true)
+	return nil
+}
+
+// OpenFile open the file to read, or to put on close if any write flag.
+func (f *FS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	var (
+		err              error
+		fi               os.FileInfo
+		bucket, filename = split(name)
+	)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+		if bucket == "" || filename == "" || len(filename) > f.maxName {
+			return nil, os.ErrPermission
+		}
+		return &file{fs: f, bucket: bucket, filename: filename, info: &fileInfo{name: path.Base(filename)}, w: &bytes.Buffer{}}, nil
+	}
+	if fi, err = f.Stat(ctx, name); err != nil {
+		return nil, err
+	}
+	return &file{fs: f, bucket: bucket, filename: filename, info: fi.(*fileInfo)}, nil
+}
+
+// RemoveAll remove the file, or all the files under the directory.
+func (f *FS) RemoveAll(ctx context.Context, name string) (err error) {
+	var (
+		marker           string
+		l                *meta.List
+		mf               *meta.File
+		bucket, filename = split(name)
+	)
+	// the buckets are not removed by webdav
+	if filename == "" {
+		return os.ErrPermission
+	}
+	f.delEmpty(bucket+_delimiter+filename, false)
+	if err = f.s.Delete(bucket, filename); err != errors.ErrNeedleNotExist {
+		return
+	}
+	for {
+		if l, err = f.s.List(bucket, filename+_delimiter, "", marker, _listLimit); err != nil {
+			return
+		}
+		for _, mf = range l.Files {
+			if err = f.s.Delete(bucket, mf.Filename); err != nil && err != errors.ErrNeedleNotExist {
+				return
+			}
+		}
+		if marker = l.Marker; marker == "" {
+			return nil
+		}
+	}
+}
+
+// Rename rename the file in the bucket by an alias and delete, no data
+// copied, the directories except the in memory ones can not be renamed.
+func (f *FS) Rename(ctx context.Context, oldName, newName string) (err error) {
+	var (
+		ok     bool
+		dir    bool
+		fi     os.FileInfo
+		ob, of = split(oldName)
+		nb, nf = split(newName)
+		oldKey = ob + _delimiter + of
+		newKey = nb + _delimiter + nf
+	)
+	if ob != nb || of == "" || nf == "" || len(nf) > f.maxName {
+		return os.ErrPermission
+	}
+	if dir, ok = f.getEmpty(oldKey); ok {
+		f.delEmpty(oldKey, false)
+		f.setEmpty(newKey, dir)
+		return nil
+	}
+	if fi, err = f.Stat(ctx, oldName); err != nil {
+		return
+	}
+	if fi.IsDir() {
+		return os.ErrPermission
+	}
+	// the alias never overwrites, delete the existed file first
+	if err = f.s.Delete(nb, nf); err != nil && err != errors.ErrNeedleNotExist {
+		return
+	}
+	if err = f.s.Alias(ob, of, nf); err != nil {
+		return convert(err)
+	}
+	f.delEmpty(newKey, true)
+	if err = f.s.Delete(ob, of); err == errors.ErrNeedleNotExist {
+		err = nil
+	}
+	return
+}
+
+// Stat get the file info, the name is a directory if any file under it.
+func (f *FS) Stat(ctx context.Context, name string) (fi os.FileInfo, err error) {
+	var (
+		ok               bool
+		dir              bool
+		mf               *meta.File
+		l                *meta.List
+		bucket, filename = split(name)
+	)
+	if filename == "" {
+		return &fileInfo{name: path.Base("/" + bucket), dir: true}, nil
+	}
+	if dir, ok = f.getEmpty(bucket + _delimiter + filename); ok {
+		return &fileInfo{name: path.Base(filename), dir: dir}, nil
+	}
+	if mf, err = f.s.Stat(bucket, filename); err == nil {
+		return newFileInfo(path.Base(filename), mf), nil
+	} else if err != errors.ErrNeedleNotExist {
+		return
+	}
+	if l, err = f.s.List(bucket, filename+_delimiter, _delimiter, "", 1); err != nil {
+		return
+	}
+	if len(l.Files)+len(l.Prefixes) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return &fileInfo{name: path.Base(filename), dir: true}, nil
+}
+
+// put put the file, the empty one is kept in memory.
+func (f *FS) put(bucket, filename string, data []byte) (err error) {
+	var (
+		mine string
+		sha  [sha1.Size]byte
+		key  = bucket + _delimiter + filename
+	)
+	if len(data) == 0 {
+		f.setEmpty(key, false)
+		return nil
+	}
+	// the upload keeps the needle of the existed file, delete it first
+	if err = f.s.Delete(bucket, filename); err != nil && err != errors.ErrNeedleNotExist {
+		return
+	}
+	if mine = mime.TypeByExtension(path.Ext(filename)); mine == "" {
+		mine = http.DetectContentType(data)
+	}
+	sha = sha1.Sum(data)
+	if err = f.s.Upload(bucket, filename, "", mine, hex.EncodeToString(sha[:]), data); err != nil && err != errors.ErrNeedleExist {
+		return
+	}
+	f.delEmpty(key, true)
+	return nil
+}
+
+// readdir get the entries of the directory, the directories first.
+func (f *FS) readdir(bucket, filename string) (fis []os.FileInfo, err error) {
+	var (
+		k      string
+		dir    bool
+		marker string
+		prefix string
+		l      *meta.List
+		mf     *meta.File
+		key    string
+	)
+	// the buckets are not listed
+	if bucket == "" {
+		return
+	}
+	if filename != "" {
+		prefix = filename + _delimiter
+	}
+	for len(fis) < _maxEntries {
+		if l, err = f.s.List(bucket, prefix, _delimiter, marker, _listLimit); err != nil {
+			return nil, convert(err)
+		}
+		for _, k = range l.Prefixes {
+			fis = append(fis, &fileInfo{name: strings.TrimSuffix(k[len(prefix):], _delimiter), dir: true})
+		}
+		for _, mf = range l.Files {
+			fis = append(fis, newFileInfo(mf.Filename[len(prefix):], mf))
+		}
+		if marker = l.Marker; marker == "" {
+			break
+		}
+	}
+	key = bucket + _delimiter + prefix
+	f.lock.RLock()
+	for k, dir = range f.empty {
+		if strings.HasPrefix(k, key) && !strings.Contains(k[len(key):], _delimiter) {
+			fis = append(fis, &fileInfo{name: k[len(key):], dir: dir})
+		}
+	}
+	f.lock.RUnlock()
+	return
+}
+
+// convert convert the not exist error to the os one.
+func convert(err error) error {
+	if err == errors.ErrNeedleNotExist {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+// fileInfo the info of a file or a simulated directory.
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime int64 // nanoseconds
+	dir   bool
+	mine  string
+	sha1  string
+}
+
+func newFileInfo(name string, mf *meta.File) *fileInfo {
+	return &fileInfo{name: name, size: mf.Size, mtime: mf.MTime, mine: mf.Mine, sha1: mf.Sha1}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(0, fi.mtime) }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ContentType the mine of the file, so the file is not read by propfind.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.mine == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.mine, nil
+}
+
+// ETag the sha1 of the file, the same as the proxy download.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.sha1 == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.sha1 + `"`, nil
+}
+
+// file a webdav file, read from the storage on the first read, or put to
+// the storage on close if opened to write.
+type file struct {
+	fs       *FS
+	bucket   string
+	filename string
+	info     *fileInfo
+	r        *bytes.Reader
+	w        *bytes.Buffer
+	fis      []os.FileInfo
+	loaded   bool
+}
+
+// load read the file data.
+func (f *file) load() (err error) {
+	var (
+		data []byte
+		src  io.ReadCloser
+	)
+	if f.info.dir || f.w != nil {
+		return os.ErrInvalid
+	}
+	if f.r != nil {
+		return
+	}
+	if f.info.size > 0 || f.info.sha1 != "" {
+		if src, _, _, err = f.fs.s.Get(f.bucket, f.filename); err != nil {
+			return convert(err)
+		}
+		data, err = ioutil.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return
+		}
+	}
+	f.r = bytes.NewReader(data)
+	return
+}
+
+func (f *file) Read(p []byte) (n int, err error) {
+	if err = f.load(); err != nil {
+		return
+	}
+	return f.r.Read(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (n int64, err error) {
+	if err = f.load(); err != nil {
+		return
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) Write(p []byte) (n int, err error) {
+	if f.w == nil {
+		return 0, os.ErrPermission
+	}
+	if f.w.Len()+len(p) > f.fs.maxSize {
+		return 0, errors.ErrFileTooLarge
+	}
+	return f.w.Write(p)
+}
+
+// Readdir get the entries of the directory, all if count <= 0.
+func (f *file) Readdir(count int) (fis []os.FileInfo, err error) {
+	if !f.info.dir {
+		return nil, os.ErrInvalid
+	}
+	if !f.loaded {
+		if f.fis, err = f.fs.readdir(f.bucket, f.filename); err != nil {
+			return
+		}
+		f.loaded = true
+	}
+	if count <= 0 {
+		fis, f.fis = f.fis, nil
+		return
+	}
+	if len(f.fis) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.fis) {
+		count = len(f.fis)
+	}
+	fis, f.fis = f.fis[:count], f.fis[count:]
+	return
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	var sha [sha1.Size]byte
+	if f.w != nil {
+		sha = sha1.Sum(f.w.Bytes())
+		f.info.size, f.info.sha1, f.info.mtime = int64(f.w.Len()), hex.EncodeToString(sha[:]), time.Now().UnixNano()
+	}
+	return f.info, nil
+}
+
+// Close put the written file.
+func (f *file) Close() error {
+	if f.w == nil {
+		return nil
+	}
+	return f.fs.put(f.bucket, f.filename, f.w.Bytes())
+}
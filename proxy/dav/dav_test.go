@@ -0,0 +1,175 @@
+package dav
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"bfs/libs/errors"
+	"bfs/libs/meta"
+
+	"golang.org/x/net/webdav"
+)
+
+// storage the in memory files of a bucket.
+type storage map[string][]byte
+
+func (s storage) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	if mf, err = s.Stat(bucket, filename); err != nil {
+		return
+	}
+	return ioutil.NopCloser(bytes.NewReader(s[filename])), len(s[filename]), mf, nil
+}
+
+func (s storage) Stat(bucket, filename string) (mf *meta.File, err error) {
+	var (
+		ok   bool
+		data []byte
+	)
+	if data, ok = s[filename]; !ok {
+		return nil, errors.ErrNeedleNotExist
+	}
+	return &meta.File{Filename: filename, Size: int64(len(data)), Sha1: "sha1", Mine: "text/plain"}, nil
+}
+
+func (s storage) List(bucket, prefix, delimiter, marker string, limit int) (l *meta.List, err error) {
+	var (
+		i     int
+		name  string
+		names []string
+		seen  = map[string]bool{}
+	)
+	for name = range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	l = &meta.List{}
+	for _, name = range names {
+		if !strings.HasPrefix(name, prefix) || name <= marker {
+			continue
+		}
+		if i = strings.Index(name[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			if name = name[:len(prefix)+i+1]; !seen[name] {
+				seen[name] = true
+				l.Prefixes = append(l.Prefixes, name)
+			}
+			continue
+		}
+		l.Files = append(l.Files, &meta.File{Filename: name, Size: int64(len(s[name]))})
+	}
+	return
+}
+
+func (s storage) Upload(bucket, filename, name, mine, sha1 string, buf []byte) (err error) {
+	s[filename] = buf
+	return
+}
+
+func (s storage) Alias(bucket, filename, alias string) (err error) {
+	if _, ok := s[filename]; !ok {
+		return errors.ErrNeedleNotExist
+	}
+	s[alias] = s[filename]
+	return
+}
+
+func (s storage) Delete(bucket, filename string) (err error) {
+	if _, ok := s[filename]; !ok {
+		return errors.ErrNeedleNotExist
+	}
+	delete(s, filename)
+	return
+}
+
+func TestSplit(t *testing.T) {
+	var bucket, filename string
+	if bucket, filename = split("/b/a/c.txt"); bucket != "b" || filename != "a/c.txt" {
+		t.Errorf("split() got: %s %s", bucket, filename)
+		t.FailNow()
+	}
+	if bucket, filename = split("/b/"); bucket != "b" || filename != "" {
+		t.Errorf("split() got: %s %s", bucket, filename)
+		t.FailNow()
+	}
+	if bucket, filename = split("/"); bucket != "" || filename != "" {
+		t.Errorf("split() got: %s %s", bucket, filename)
+		t.FailNow()
+	}
+}
+
+func TestFS(t *testing.T) {
+	var (
+		resp *http.Response
+		body []byte
+		s    = storage{"a/1.txt": []byte("1"), "a/b/2.txt": []byte("22"), "3.txt": []byte("333")}
+		h    = &webdav.Handler{Prefix: "/dav", FileSystem: New(s, 8, 100), LockSystem: webdav.NewMemLS()}
+		srv  = httptest.NewServer(h)
+	)
+	defer srv.Close()
+	do := func(method, path, dst string, body []byte) (resp *http.Response) {
+		var (
+			err error
+			req *http.Request
+		)
+		if req, err = http.NewRequest(method, srv.URL+path, bytes.NewReader(body)); err != nil {
+			t.Errorf("http.NewRequest() error(%v)", err)
+			t.FailNow()
+		}
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "1")
+		}
+		if dst != "" {
+			req.Header.Set("Destination", srv.URL+dst)
+		}
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Errorf("Do(%s %s) error(%v)", method, path, err)
+			t.FailNow()
+		}
+		return
+	}
+	resp = do("PROPFIND", "/dav/b/a/", "", nil)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus || !strings.Contains(string(body), "/dav/b/a/1.txt") ||
+		!strings.Contains(string(body), "/dav/b/a/b/") {
+		t.Errorf("PROPFIND got: %d %s", resp.StatusCode, body)
+		t.FailNow()
+	}
+	if resp = do("PUT", "/dav/b/c/4.txt", "", []byte("4444")); resp.StatusCode != http.StatusCreated || string(s["c/4.txt"]) != "4444" {
+		t.Errorf("PUT got: %d %v", resp.StatusCode, s)
+		t.FailNow()
+	}
+	if resp = do("PUT", "/dav/b/5.txt", "", []byte("too large file")); resp.StatusCode == http.StatusCreated {
+		t.Errorf("PUT too large got: %d", resp.StatusCode)
+		t.FailNow()
+	}
+	resp = do("GET", "/dav/b/3.txt", "", nil)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "333" {
+		t.Errorf("GET got: %d %s", resp.StatusCode, body)
+		t.FailNow()
+	}
+	if resp = do("MOVE", "/dav/b/3.txt", "/dav/b/a/3.txt", nil); resp.StatusCode != http.StatusCreated ||
+		s["3.txt"] != nil || string(s["a/3.txt"]) != "333" {
+		t.Errorf("MOVE got: %d %v", resp.StatusCode, s)
+		t.FailNow()
+	}
+	if resp = do("MKCOL", "/dav/b/d", "", nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("MKCOL got: %d", resp.StatusCode)
+		t.FailNow()
+	}
+	if resp = do("PROPFIND", "/dav/b/d", "", nil); resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("PROPFIND made dir got: %d", resp.StatusCode)
+		t.FailNow()
+	}
+	if resp = do("DELETE", "/dav/b/a", "", nil); resp.StatusCode != http.StatusNoContent || len(s) != 1 {
+		t.Errorf("DELETE got: %d %v", resp.StatusCode, s)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"bfs/libs/health"
+)
+
+// newHealth the readiness of the proxy: the directory ready, the memcache is
+// only a cache so not checked.
+func newHealth(srv *Service) (h *health.Health) {
+	h = health.New()
+	h.Add("directory", srv.Ready)
+	return
+}
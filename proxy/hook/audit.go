@@ -0,0 +1,42 @@
+package hook
+
+import (
+	"strings"
+
+	"bfs/libs/log"
+)
+
+func init() {
+	Register("audit", newAudit)
+}
+
+// audit log the uploads and downloads with the client.
+type audit struct {
+	Nop
+}
+
+func newAudit(c map[string]string) (Hook, error) {
+	return audit{}, nil
+}
+
+func (audit) PostUpload(r *Request, f *File, err error) {
+	log.Infof("audit: %s bucket: %s, file: %s, sha1: %s, size: %d, remote: %s, key: %s, error(%v)",
+		r.Method, r.Bucket, f.Filename, f.Sha1, len(f.Data), r.RemoteAddr, keyId(r), err)
+}
+
+func (audit) PreDownload(r *Request) error {
+	log.Infof("audit: %s bucket: %s, file: %s, remote: %s, key: %s", r.Method, r.Bucket, r.Filename, r.RemoteAddr, keyId(r))
+	return nil
+}
+
+// keyId get the access key id of the token, keyid:sign:time.
+func keyId(r *Request) string {
+	var ss []string
+	if r.Header == nil {
+		return ""
+	}
+	if ss = strings.Split(r.Header.Get("Authorization"), ":"); len(ss) != 3 {
+		return ""
+	}
+	return ss[0]
+}
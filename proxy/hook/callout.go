@@ -0,0 +1,100 @@
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bfs/libs/log"
+)
+
+const (
+	_calloutTimeout = 5 * time.Second
+	_calloutMaxSize = 64 * 1024 * 1024
+)
+
+func init() {
+	Register("callout", newCallout)
+}
+
+// callout post the uploading file to the url, e.g. a virus scanner or a
+// watermarker. a 2xx with a body replaces the data and the mine, a 2xx
+// without keeps them, a 4xx rejects the upload by 403, others and the
+// failed callouts reject it by 503.
+type callout struct {
+	Nop
+	url     string
+	maxSize int64
+	client  *http.Client
+}
+
+// newCallout new the callout by the url, the timeout (5s by default) and
+// the max_size of the replaced data (64MB by default, the proxy MaxFileSize
+// is checked again).
+func newCallout(c map[string]string) (h Hook, err error) {
+	var (
+		timeout = _calloutTimeout
+		cl      = &callout{url: c["url"], maxSize: _calloutMaxSize}
+	)
+	if cl.url == "" {
+		return nil, fmt.Errorf("url must be set")
+	}
+	if c["timeout"] != "" {
+		if timeout, err = time.ParseDuration(c["timeout"]); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout: %s invalid", c["timeout"])
+		}
+	}
+	if c["max_size"] != "" {
+		if cl.maxSize, err = strconv.ParseInt(c["max_size"], 10, 64); err != nil || cl.maxSize <= 0 {
+			return nil, fmt.Errorf("max_size: %s invalid", c["max_size"])
+		}
+	}
+	cl.client = &http.Client{Timeout: timeout}
+	return cl, nil
+}
+
+func (cl *callout) PreUpload(r *Request, f *File) (err error) {
+	var (
+		data []byte
+		req  *http.Request
+		resp *http.Response
+	)
+	if req, err = http.NewRequest("POST", cl.url, bytes.NewReader(f.Data)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", f.Mine)
+	req.Header.Set("X-Bfs-Bucket", r.Bucket)
+	req.Header.Set("X-Bfs-Filename", f.Filename)
+	if resp, err = cl.client.Do(req); err != nil {
+		log.Errorf("callout(%s, %s/%s) error(%v)", cl.url, r.Bucket, f.Filename, err)
+		return Status(http.StatusServiceUnavailable)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		log.Warningf("callout(%s, %s/%s) rejected: %d", cl.url, r.Bucket, f.Filename, resp.StatusCode)
+		return Status(http.StatusForbidden)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Errorf("callout(%s, %s/%s) status: %d", cl.url, r.Bucket, f.Filename, resp.StatusCode)
+		return Status(http.StatusServiceUnavailable)
+	}
+	if data, err = ioutil.ReadAll(io.LimitReader(resp.Body, cl.maxSize+1)); err != nil {
+		log.Errorf("callout(%s, %s/%s) read error(%v)", cl.url, r.Bucket, f.Filename, err)
+		return Status(http.StatusServiceUnavailable)
+	}
+	if int64(len(data)) > cl.maxSize {
+		log.Errorf("callout(%s, %s/%s) replaced data larger than %d", cl.url, r.Bucket, f.Filename, cl.maxSize)
+		return Status(http.StatusServiceUnavailable)
+	}
+	if len(data) > 0 {
+		f.Data = data
+		if resp.Header.Get("Content-Type") != "" {
+			f.Mine = resp.Header.Get("Content-Type")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package hook
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"bfs/proxy/conf"
+)
+
+// Request the hooked request of a file.
+type Request struct {
+	Method   string
+	Bucket   string
+	Filename string
+	// the client request header, empty of the webdav
+	Header     http.Header
+	RemoteAddr string
+}
+
+// NewRequest new the hooked request.
+func NewRequest(r *http.Request, bucket, filename string) *Request {
+	return &Request{Method: r.Method, Bucket: bucket, Filename: filename, Header: r.Header, RemoteAddr: r.RemoteAddr}
+}
+
+// File the uploading file.
+type File struct {
+	// the filename, empty or ends with "/" is named by the sha1 after the
+	// pre upload
+	Filename string
+	Mine     string
+	// set after the pre upload
+	Sha1 string
+	Data []byte
+}
+
+// Hook the middleware of the proxy requests, e.g. content-type sniffing,
+// virus scanning callouts, watermarking or audit logging.
+type Hook interface {
+	// PreUpload called before the upload, it may change the mine and data of
+	// the file, the error rejects the upload.
+	PreUpload(r *Request, f *File) error
+	// PostUpload called after the upload with its result.
+	PostUpload(r *Request, f *File, err error)
+	// PreDownload called before the download, the error rejects it.
+	PreDownload(r *Request) error
+}
+
+// Nop the hook does nothing, embedded by the hooks implementing only some
+// of the methods.
+type Nop struct{}
+
+func (Nop) PreUpload(r *Request, f *File) error       { return nil }
+func (Nop) PostUpload(r *Request, f *File, err error) {}
+func (Nop) PreDownload(r *Request) error              { return nil }
+
+// Status the error rejects the request with the http status, other errors
+// reply 500.
+type Status int
+
+func (s Status) Error() string {
+	return fmt.Sprintf("hook: rejected %d %s", int(s), http.StatusText(int(s)))
+}
+
+// Code get the http status of the hook error.
+func Code(err error) int {
+	var (
+		ok bool
+		s  Status
+	)
+	if s, ok = err.(Status); ok {
+		return int(s)
+	}
+	return http.StatusInternalServerError
+}
+
+// NewFunc new a hook by its config.
+type NewFunc func(c map[string]string) (Hook, error)
+
+var (
+	hooksMu sync.Mutex
+	hooks   = make(map[string]NewFunc)
+)
+
+// Register make a hook available by the name, it panics if called twice
+// with the same name.
+func Register(name string, f NewFunc) {
+	var dup bool
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if _, dup = hooks[name]; dup {
+		panic("hook: Register called twice for " + name)
+	}
+	hooks[name] = f
+}
+
+// Names get the names of the registered hooks.
+func Names() (names []string) {
+	var name string
+	hooksMu.Lock()
+	for name = range hooks {
+		names = append(names, name)
+	}
+	hooksMu.Unlock()
+	sort.Strings(names)
+	return
+}
+
+// Chain the hooks called in order, a nil Chain calls nothing.
+type Chain struct {
+	hooks []Hook
+}
+
+// New new the chain of the configured hooks, nil if none.
+func New(c *conf.Config) (ch *Chain, err error) {
+	var (
+		ok   bool
+		name string
+		f    NewFunc
+		h    Hook
+	)
+	if c.Hook == nil || len(c.Hook.Names) == 0 {
+		return
+	}
+	ch = &Chain{}
+	for _, name = range c.Hook.Names {
+		hooksMu.Lock()
+		f, ok = hooks[name]
+		hooksMu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("hook: unknown hook %s", name)
+		}
+		if h, err = f(c.Hook.Config[name]); err != nil {
+			return nil, fmt.Errorf("hook: new %s error(%v)", name, err)
+		}
+		ch.hooks = append(ch.hooks, h)
+	}
+	return
+}
+
+// PreUpload call the pre uploads in order, stop at the first error.
+func (ch *Chain) PreUpload(r *Request, f *File) (err error) {
+	var h Hook
+	if ch == nil {
+		return
+	}
+	for _, h = range ch.hooks {
+		if err = h.PreUpload(r, f); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// PostUpload call the post uploads in order.
+func (ch *Chain) PostUpload(r *Request, f *File, err error) {
+	var h Hook
+	if ch == nil {
+		return
+	}
+	for _, h = range ch.hooks {
+		h.PostUpload(r, f, err)
+	}
+}
+
+// PreDownload call the pre downloads in order, stop at the first error.
+func (ch *Chain) PreDownload(r *Request) (err error) {
+	var h Hook
+	if ch == nil {
+		return
+	}
+	for _, h = range ch.hooks {
+		if err = h.PreDownload(r); err != nil {
+			return
+		}
+	}
+	return
+}
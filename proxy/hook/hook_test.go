@@ -0,0 +1,98 @@
+package hook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bfs/proxy/conf"
+)
+
+func TestChain(t *testing.T) {
+	var (
+		err error
+		ch  *Chain
+		f   = &File{Filename: "a/1.png", Mine: _mineOctetStream, Data: []byte("data")}
+		r   = &Request{Method: "PUT", Bucket: "b", Filename: "a/1.png"}
+	)
+	// nil calls nothing
+	if err = ch.PreUpload(r, f); err != nil || ch.PreDownload(r) != nil {
+		t.Errorf("nil Chain error(%v)", err)
+		t.FailNow()
+	}
+	if ch, err = New(&conf.Config{}); err != nil || ch != nil {
+		t.Errorf("New() not configured: %v error(%v)", ch, err)
+		t.FailNow()
+	}
+	if _, err = New(&conf.Config{Hook: &conf.Hook{Names: []string{"none"}}}); err == nil {
+		t.Errorf("New() unknown hook no error")
+		t.FailNow()
+	}
+	if ch, err = New(&conf.Config{Hook: &conf.Hook{Names: []string{"sniff", "audit"}}}); err != nil {
+		t.Errorf("New() error(%v)", err)
+		t.FailNow()
+	}
+	if err = ch.PreUpload(r, f); err != nil || f.Mine != "image/png" {
+		t.Errorf("PreUpload() mine: %s error(%v)", f.Mine, err)
+		t.FailNow()
+	}
+	ch.PostUpload(r, f, nil)
+	if err = ch.PreDownload(r); err != nil {
+		t.Errorf("PreDownload() error(%v)", err)
+		t.FailNow()
+	}
+	if Code(Status(http.StatusForbidden)) != http.StatusForbidden || Code(fmt.Errorf("x")) != http.StatusInternalServerError {
+		t.Errorf("Code() wrong")
+		t.FailNow()
+	}
+}
+
+func TestCallout(t *testing.T) {
+	var (
+		err error
+		h   Hook
+		f   *File
+		r   = &Request{Method: "PUT", Bucket: "b"}
+		srv = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			switch string(body) {
+			case "virus":
+				http.Error(wr, "", http.StatusNotAcceptable)
+			case "mark":
+				wr.Header().Set("Content-Type", "image/jpeg")
+				wr.Write([]byte("marked"))
+			case "down":
+				http.Error(wr, "", http.StatusInternalServerError)
+			}
+		}))
+	)
+	defer srv.Close()
+	if _, err = newCallout(map[string]string{}); err == nil {
+		t.Errorf("newCallout() no url no error")
+		t.FailNow()
+	}
+	if h, err = newCallout(map[string]string{"url": srv.URL, "timeout": "1s"}); err != nil {
+		t.Errorf("newCallout() error(%v)", err)
+		t.FailNow()
+	}
+	f = &File{Filename: "1.jpg", Mine: "image/png", Data: []byte("clean")}
+	if err = h.PreUpload(r, f); err != nil || string(f.Data) != "clean" || f.Mine != "image/png" {
+		t.Errorf("PreUpload(clean) got: %s %s error(%v)", f.Mine, f.Data, err)
+		t.FailNow()
+	}
+	f = &File{Filename: "1.jpg", Mine: "image/png", Data: []byte("mark")}
+	if err = h.PreUpload(r, f); err != nil || string(f.Data) != "marked" || f.Mine != "image/jpeg" {
+		t.Errorf("PreUpload(mark) got: %s %s error(%v)", f.Mine, f.Data, err)
+		t.FailNow()
+	}
+	if err = h.PreUpload(r, &File{Data: []byte("virus")}); Code(err) != http.StatusForbidden {
+		t.Errorf("PreUpload(virus) error(%v)", err)
+		t.FailNow()
+	}
+	if err = h.PreUpload(r, &File{Data: []byte("down")}); Code(err) != http.StatusServiceUnavailable {
+		t.Errorf("PreUpload(down) error(%v)", err)
+		t.FailNow()
+	}
+}
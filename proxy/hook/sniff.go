@@ -0,0 +1,35 @@
+package hook
+
+import (
+	"mime"
+	"net/http"
+	"path"
+)
+
+const _mineOctetStream = "application/octet-stream"
+
+func init() {
+	Register("sniff", newSniff)
+}
+
+// sniff set the mine of the file uploaded as application/octet-stream or
+// without one, by the filename extension, else the data.
+type sniff struct {
+	Nop
+}
+
+func newSniff(c map[string]string) (Hook, error) {
+	return sniff{}, nil
+}
+
+func (sniff) PreUpload(r *Request, f *File) error {
+	var mine string
+	if f.Mine != "" && f.Mine != _mineOctetStream {
+		return nil
+	}
+	if mine = mime.TypeByExtension(path.Ext(f.Filename)); mine == "" {
+		mine = http.DetectContentType(f.Data)
+	}
+	f.Mine = mine
+	return nil
+}
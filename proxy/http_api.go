@@ -1,26 +1,46 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"bfs/libs/audit"
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/reqid"
+	"bfs/libs/slow"
+	"bfs/libs/trace"
+	"bfs/libs/upgrade"
 	"bfs/proxy/auth"
 	"bfs/proxy/bfs"
 	ibucket "bfs/proxy/bucket"
 	"bfs/proxy/conf"
+	"bfs/proxy/dav"
+	"bfs/proxy/hook"
+	iimage "bfs/proxy/image"
+	"bfs/proxy/limit"
+	"bfs/proxy/lru"
 
-	log "github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/webdav"
 )
 
 const (
@@ -30,6 +50,14 @@ const (
 	_expires = 20 * 365 * 24 * 3600
 
 	_maxFileNameLength = 100
+	_maxNameLength     = 255
+
+	// the PUT of the header puts an alias of the file in it, no body
+	_aliasHeader = "X-Bfs-Alias"
+
+	// signed url
+	_signExpire    = 3600
+	_signMaxExpire = 7 * 24 * 3600
 )
 
 type server struct {
@@ -38,34 +66,72 @@ type server struct {
 	auth   *auth.Auth
 	c      *conf.Config
 	srv    *Service
+	thumbs *lru.Cache
+	limit  *limit.Limiter
+	// webdav, nil disables
+	dav *webdav.Handler
+	// the request middlewares, nil calls nothing
+	hooks *hook.Chain
+	// the slow requests, nil logs nothing
+	slow *slow.Log
 }
 
-// StartAPI init the http module.
-func StartAPI(c *conf.Config) (err error) {
-	var s = &server{
-		srv: NewService(c),
-	}
+// StartAPI init the http module, the socket of the old process is used if
+// upgraded, the server and its listener are returned for the next upgrade.
+func StartAPI(c *conf.Config) (svr *http.Server, l net.Listener, err error) {
+	var s = &server{}
 	s.c = c
+	s.slow = slow.New(time.Duration(c.SlowLog))
+	if s.srv, err = NewService(c); err != nil {
+		return
+	}
 	s.bfs = bfs.New(c)
-	if s.bucket, err = ibucket.New(); err != nil {
+	if s.bucket, err = ibucket.New(c); err != nil {
 		return
 	}
 	if s.auth, err = auth.New(c); err != nil {
 		return
 	}
-	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc("/", s.do)
-		mux.HandleFunc("/ping", s.ping)
-		server := &http.Server{
-			Addr:         c.HttpAddr,
-			Handler:      mux,
-			ReadTimeout:  _httpServerReadTimeout,
-			WriteTimeout: _httpServerWriteTimeout,
-		}
-		if err := server.ListenAndServe(); err != nil {
+	s.limit = limit.New(c)
+	if s.hooks, err = hook.New(c); err != nil {
+		return
+	}
+	if c.Image != nil {
+		if s.thumbs, err = lru.New(c.Image.CacheDir, c.Image.CacheSize); err != nil {
 			return
 		}
+	}
+	if c.WebDAV != nil {
+		s.dav = &webdav.Handler{
+			Prefix:     strings.TrimSuffix(c.WebDAV.Prefix, "/"),
+			FileSystem: dav.New(&hookStorage{Service: s.srv, c: c, hooks: s.hooks}, c.MaxFileSize, _maxFileNameLength),
+			LockSystem: webdav.NewMemLS(),
+			Logger:     davLog,
+		}
+	}
+	if l, err = upgrade.Listen(c.HttpAddr); err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.do)
+	mux.HandleFunc("/ping", s.ping)
+	mux.HandleFunc("/sign", s.sign)
+	mux.HandleFunc("/debt", s.debt)
+	mux.HandleFunc("/notify", s.notify)
+	newHealth(s.srv).Register(mux)
+	if s.dav != nil {
+		mux.HandleFunc(c.WebDAV.Prefix, s.webdav)
+	}
+	svr = &http.Server{
+		Addr:         c.HttpAddr,
+		Handler:      trace.Handler(reqid.Handler(mux)),
+		ReadTimeout:  _httpServerReadTimeout,
+		WriteTimeout: _httpServerWriteTimeout,
+	}
+	go func() {
+		if err := svr.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf("server.Serve() error(%v)", err)
+		}
 	}()
 	return
 }
@@ -77,6 +143,10 @@ func (s *server) do(wr http.ResponseWriter, r *http.Request) {
 		bucket string
 		file   string
 		token  string
+		keyId  string
+		sign   string
+		origin string
+		ip     string
 		status int
 		err    error
 		h      handler
@@ -89,14 +159,30 @@ func (s *server) do(wr http.ResponseWriter, r *http.Request) {
 		h = s.download
 		read = true
 	case "PUT":
-		h = s.upload
+		if h = s.upload; r.Header.Get(_aliasHeader) != "" {
+			h = s.alias
+		}
+		upload = true
+	case "POST":
+		if s.c.MaxUploadNum == 0 {
+			http.Error(wr, "", http.StatusMethodNotAllowed)
+			return
+		}
+		h = s.uploads
 		upload = true
 	case "DELETE":
 		h = s.delete
+	case "OPTIONS":
+		h = s.preflight
+		upload = true
 	default:
 		http.Error(wr, "", http.StatusMethodNotAllowed)
 		return
 	}
+	if ip = s.limit.IP(r); !s.limit.Allow(limit.KindIP, ip) {
+		tooManyRequests(wr)
+		return
+	}
 	if bucket, file, status = s.parseURI(r, upload); status != http.StatusOK {
 		http.Error(wr, "", status)
 		return
@@ -105,13 +191,35 @@ func (s *server) do(wr http.ResponseWriter, r *http.Request) {
 		http.Error(wr, "", http.StatusRequestEntityTooLarge)
 		return
 	}
+	trace.Set(r.Context(), attribute.String("bfs.bucket", bucket), attribute.String("bfs.file", file))
 	if item, err = s.bucket.Get(bucket); err != nil {
 		log.Errorf("bucket.Get(%s) error(%v)", bucket, err)
 		http.Error(wr, "", http.StatusNotFound)
 		return
 	}
-	// item not public must use authorize
+	if !s.limit.Allow(limit.KindBucket, bucket) {
+		tooManyRequests(wr)
+		return
+	}
+	// the cors preflight is not authorized
+	if r.Method == "OPTIONS" {
+		h(item, bucket, file, wr, r)
+		return
+	}
+	if origin = r.Header.Get("Origin"); origin != "" {
+		item.CORS.Actual(wr.Header(), origin, r.Method)
+	}
+	// item not public must use authorize, a signed url only can read
 	if !item.Public(read) {
+		if sign = r.URL.Query().Get("signature"); read && sign != "" {
+			if err = s.auth.VerifyURL(item, bucket, file, sign, r.URL.Query().Get("expires")); err != nil {
+				log.Errorf("verifyURL(%s, %s, %s) by item: %v error(%v)", bucket, file, sign, item, err)
+				http.Error(wr, "", http.StatusUnauthorized)
+				return
+			}
+			h(item, bucket, file, wr, r)
+			return
+		}
 		token = r.URL.Query().Get("token")
 		if token == "" {
 			token = r.Header.Get("Authorization")
@@ -121,14 +229,29 @@ func (s *server) do(wr http.ResponseWriter, r *http.Request) {
 			http.Error(wr, "", http.StatusUnauthorized)
 			return
 		}
+		// token keyid:sign:time
+		if keyId = strings.SplitN(token, ":", 2)[0]; !s.limit.Allow(limit.KindKey, keyId) {
+			tooManyRequests(wr)
+			return
+		}
+	}
+	// the stores audit the writes and the deletes by who made them
+	if ip == "" {
+		ip = audit.RemoteIP(r)
 	}
-	h(item, bucket, file, wr, r)
+	h(item, bucket, file, wr, r.WithContext(audit.NewContext(r.Context(), keyId, ip)))
 	return
 }
 
-func httpLog(method, uri string, bucket, file *string, start time.Time, status *int, err *error) {
-	log.Infof("%s: %s, bucket: %s, file: %s, time: %f, status: %d, error(%v)",
-		method, uri, *bucket, *file, time.Now().Sub(start).Seconds(), *status, *err)
+func httpLog(method string, r *http.Request, bucket, file *string, start time.Time, status *int, err *error) {
+	log.Infof("%s: %s, bucket: %s, file: %s, time: %f, status: %d, req_id: %s, error(%v)",
+		method, r.URL.Path, *bucket, *file, time.Now().Sub(start).Seconds(), *status, reqid.FromContext(r.Context()), *err)
+}
+
+// tooManyRequests reply the request limited by the rate limit.
+func tooManyRequests(wr http.ResponseWriter) {
+	wr.Header().Set("Retry-After", "1")
+	http.Error(wr, "", http.StatusTooManyRequests)
 }
 
 // set reponse header.
@@ -188,47 +311,171 @@ func (s *server) getURI(bucket, file string) (uri string) {
 // download.
 func (s *server) download(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
 	var (
-		mtime      int64
-		ctlen      int
-		mine       string
-		sha1       string
-		start      = time.Now()
-		src        io.ReadCloser
-		status     = http.StatusOK
-		err        error
-		bucketItem *ibucket.Item
+		mtime  int64
+		ctlen  int
+		mine   string
+		sha1   string
+		start  = time.Now()
+		src    io.ReadCloser
+		status = http.StatusOK
+		err    error
+		mf     *meta.File
+		opt    *iimage.Option
+		tr     = s.slow.Start()
 	)
-	defer httpLog("download", r.URL.Path, &bucket, &file, start, &status, &err)
-	if src, ctlen, mtime, sha1, mine, err = s.srv.Get(bucket, file); err == nil {
+	defer tr.End(r)
+	defer httpLog("download", r, &bucket, &file, start, &status, &err)
+	if s.thumbs != nil {
+		if opt, err = iimage.Parse(r.URL.Query(), s.c.Image.MaxSize); err != nil {
+			status = http.StatusBadRequest
+			http.Error(wr, "", status)
+			return
+		}
+	}
+	if err = s.hooks.PreDownload(hook.NewRequest(r, bucket, file)); err != nil {
+		status = hook.Code(err)
+		http.Error(wr, "", status)
+		return
+	}
+	src, ctlen, mf, err = s.srv.GetContext(r.Context(), bucket, file)
+	tr.Phase("get")
+	if err == nil {
+		mtime, sha1, mine = mf.MTime, mf.Sha1, mf.Mine
+		if opt != nil && iimage.Supported(mine) {
+			src, ctlen, mine, err = s.thumbnail(bucket, file, sha1, src, opt)
+			sha1 += "-" + opt.String()
+			tr.Phase("thumbnail")
+		}
+	}
+	if err == nil && sha1 != "" && r.Header.Get("If-None-Match") == sha1 {
+		// the client has the same file
+		if src != nil {
+			src.Close()
+		}
+		status = http.StatusNotModified
+		wr.Header().Set("Etag", sha1)
+		wr.WriteHeader(status)
+		return
+	}
+	if err == nil {
 		wr.Header().Set("Content-Length", strconv.Itoa(ctlen))
 		wr.Header().Set("Content-Type", mine)
 		wr.Header().Set("Server", "bfs")
 		wr.Header().Set("Last-Modified", time.Unix(0, mtime).Format(http.TimeFormat))
 		wr.Header().Set("Etag", sha1)
-		bucketItem, err = s.bucket.Get(bucket)
-		if err == nil && bucketItem.Header != nil {
-			wr.Header().Set("Cache-Control", fmt.Sprintf("max-age=%v", bucketItem.Header.CacheControl))
-			wr.Header().Set("Expires", time.Unix(bucketItem.Header.CacheControl, time.Now().UnixNano()).Format(http.TimeFormat))
-		} else {
-			wr.Header().Set("Cache-Control", "max-age=315360000")
-			wr.Header().Set("Expires", time.Unix(_expires, mtime).Format(http.TimeFormat))
+		setHeader(wr.Header(), item.Header, mtime)
+		if r.URL.Query().Get("download") == "1" {
+			wr.Header().Set("Content-Disposition", attachment(mf.Name, file))
 		}
 		if src != nil {
 			if r.Method == "GET" {
 				io.Copy(wr, src)
 			}
 			src.Close()
+			tr.Phase("write")
 		}
 	} else {
-		if err == errors.ErrNeedleNotExist {
-			status = http.StatusNotFound
-		} else if err == errors.ErrStoreNotAvailable {
-			status = http.StatusServiceUnavailable
+		status = errors.Status(err)
+		http.Error(wr, err.Error(), status)
+	}
+	return
+}
+
+// setHeader set the response headers of the download by the header policy
+// of the bucket.
+func setHeader(h http.Header, bh *ibucket.Header, mtime int64) {
+	var (
+		name   string
+		values []string
+	)
+	if bh != nil && bh.CacheControl > 0 {
+		h.Set("Cache-Control", fmt.Sprintf("max-age=%v", bh.CacheControl))
+		h.Set("Expires", time.Now().Add(time.Duration(bh.CacheControl)*time.Second).UTC().Format(http.TimeFormat))
+	} else {
+		h.Set("Cache-Control", "max-age=315360000")
+		h.Set("Expires", time.Unix(_expires, mtime).Format(http.TimeFormat))
+	}
+	if bh == nil {
+		return
+	}
+	if bh.ContentDisposition != "" {
+		h.Set("Content-Disposition", bh.ContentDisposition)
+	}
+	for name, values = range bh.Custom {
+		h[name] = values
+	}
+}
+
+// attachment get the Content-Disposition to save the file by the original
+// filename, the base of the file if no.
+func attachment(name, file string) (cd string) {
+	if name == "" {
+		name = path.Base(file)
+	}
+	if cd = mime.FormatMediaType("attachment", map[string]string{"filename": name}); cd == "" {
+		cd = "attachment"
+	}
+	return
+}
+
+// consistency get the upload context of the consistency level of the
+// request, by the X-Bfs-Consistency header or the consistency param, false
+// if unknown.
+func consistency(r *http.Request) (ctx context.Context, ok bool) {
+	var level = r.Header.Get(bfs.HeaderConsistency)
+	if level == "" {
+		// not FormValue, the body is the file
+		level = r.URL.Query().Get("consistency")
+	}
+	if !bfs.ValidConsistency(level) {
+		return nil, false
+	}
+	return bfs.WithConsistency(r.Context(), level), true
+}
+
+// originName get the original filename by the Content-Disposition of the
+// upload, e.g. attachment; filename="a.jpg", empty if no.
+func originName(cd string) (name string) {
+	var (
+		err    error
+		params map[string]string
+	)
+	if cd == "" {
+		return
+	}
+	if _, params, err = mime.ParseMediaType(cd); err != nil {
+		log.Errorf("mime.ParseMediaType(%s) error(%v)", cd, err)
+		return
+	}
+	if name = path.Base(params["filename"]); name == "." || name == "/" || len(name) > _maxNameLength {
+		name = ""
+	}
+	return
+}
+
+// thumbnail get the thumbnail of the file from the cache, else resize and
+// cache it.
+func (s *server) thumbnail(bucket, file, sha1 string, src io.ReadCloser, opt *iimage.Option) (dst io.ReadCloser, ctlen int, mine string, err error) {
+	var (
+		ok   bool
+		data []byte
+		mf   *meta.File
+		key  = iimage.Key(bucket, file, sha1, opt)
+	)
+	if data, mf, ok = s.thumbs.Get(key); ok {
+		mine = mf.Mine
+	} else {
+		data, mine, err = iimage.Thumbnail(src, opt)
+		if err != nil {
+			log.Errorf("Thumbnail(%s, %s, %s) error(%v)", bucket, file, opt, err)
 		} else {
-			status = http.StatusInternalServerError
+			s.thumbs.Set(key, &meta.File{Mine: mine}, data)
 		}
-		http.Error(wr, err.Error(), status)
 	}
+	if src != nil {
+		src.Close()
+	}
+	dst, ctlen = ioutil.NopCloser(bytes.NewReader(data)), len(data)
 	return
 }
 
@@ -240,26 +487,31 @@ func retCode(wr http.ResponseWriter, status *int) {
 // upload upload file.
 func (s *server) upload(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
 	var (
-		ok       bool
 		body     []byte
 		mine     string
 		location string
 		sha1sum  string
 		ext      string
+		ok       bool
 		sha      [sha1.Size]byte
 		err      error
-		uerr     errors.Error
+		ctx      context.Context
+		hr       *hook.Request
+		hf       *hook.File
 		status   = http.StatusOK
 		start    = time.Now()
+		tr       = s.slow.Start()
 	)
-	defer httpLog("upload", r.URL.Path, &bucket, &file, start, &status, &err)
+	defer tr.End(r)
+	defer httpLog("upload", r, &bucket, &file, start, &status, &err)
 	defer retCode(wr, &status)
-	if mine = r.Header.Get("Content-Type"); mine == "" {
+	if mine = r.Header.Get("Content-Type"); mine == "" && s.hooks == nil {
 		status = http.StatusBadRequest
 		return
 	}
-	if ext = path.Base(mine); ext == "jpeg" {
-		ext = "jpg"
+	if ctx, ok = consistency(r); !ok {
+		status = http.StatusBadRequest
+		return
 	}
 	if body, err = ioutil.ReadAll(r.Body); err != nil {
 		status = http.StatusBadRequest
@@ -267,6 +519,7 @@ func (s *server) upload(item *ibucket.Item, bucket, file string, wr http.Respons
 		return
 	}
 	r.Body.Close()
+	tr.Phase("recv")
 	length := len(body)
 	if length > s.c.MaxFileSize {
 		status = http.StatusRequestEntityTooLarge
@@ -277,18 +530,35 @@ func (s *server) upload(item *ibucket.Item, bucket, file string, wr http.Respons
 		log.Errorf("file size equals 0")
 		return
 	}
+	hr, hf = hook.NewRequest(r, bucket, file), &hook.File{Filename: file, Mine: mine, Data: body}
+	if err = s.hooks.PreUpload(hr, hf); err != nil {
+		status = hook.Code(err)
+		return
+	}
+	if mine, body = hf.Mine, hf.Data; mine == "" || len(body) == 0 {
+		status = http.StatusBadRequest
+		return
+	}
+	if len(body) > s.c.MaxFileSize {
+		status = http.StatusRequestEntityTooLarge
+		return
+	}
+	if ext = path.Base(mine); ext == "jpeg" {
+		ext = "jpg"
+	}
 	sha = sha1.Sum(body)
 	sha1sum = hex.EncodeToString(sha[:])
 	// if empty filename or endwith "/": dir
 	if file == "" || strings.HasSuffix(file, "/") {
 		file += sha1sum + "." + ext
 	}
-	if err = s.srv.Upload(bucket, file, mine, sha1sum, body); err != nil && err != errors.ErrNeedleExist {
-		if uerr, ok = (err).(errors.Error); ok {
-			status = int(uerr)
-		} else {
-			status = http.StatusInternalServerError
-		}
+	tr.Phase("hook")
+	err = s.srv.UploadContext(ctx, bucket, file, originName(r.Header.Get("Content-Disposition")), mine, sha1sum, body)
+	tr.Phase("upload")
+	hf.Filename, hf.Sha1 = file, sha1sum
+	s.hooks.PostUpload(hr, hf, err)
+	if err != nil && err != errors.ErrNeedleExist {
+		status = errors.Status(err)
 		return
 	}
 	location = s.getURI(bucket, file)
@@ -298,25 +568,210 @@ func (s *server) upload(item *ibucket.Item, bucket, file string, wr http.Respons
 }
 
 // delete
-func (s *server) delete(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
+// uploadResult the result of a file of the multipart upload.
+type uploadResult struct {
+	Filename string `json:"filename"`
+	Location string `json:"location,omitempty"`
+	ETag     string `json:"etag,omitempty"`
+	Code     int    `json:"code"`
+}
+
+// uploads upload the files of a multipart form under the dir in one
+// request, every file part is named by its filename or sha1sum.ext, the
+// response is the json of the results.
+func (s *server) uploads(item *ibucket.Item, bucket, dir string, wr http.ResponseWriter, r *http.Request) {
 	var (
+		body   []byte
+		mine   string
+		ext    string
+		sha    [sha1.Size]byte
+		err    error
+		mr     *multipart.Reader
+		part   *multipart.Part
+		f      *bfs.File
+		fs     []*bfs.File
+		rs     []*uploadResult
+		hr     *hook.Request
+		hf     *hook.File
+		ferr   error
 		ok     bool
+		ctx    context.Context
+		status = http.StatusOK
+		start  = time.Now()
+		tr     = s.slow.Start()
+	)
+	defer tr.End(r)
+	defer httpLog("uploads", r, &bucket, &dir, start, &status, &err)
+	defer retCode(wr, &status)
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	if ctx, ok = consistency(r); !ok {
+		status = http.StatusBadRequest
+		return
+	}
+	if mr, err = r.MultipartReader(); err != nil {
+		status = http.StatusBadRequest
+		return
+	}
+	hr = hook.NewRequest(r, bucket, dir)
+	for {
+		if part, err = mr.NextPart(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+		// skip the form fields
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		if len(fs) >= s.c.MaxUploadNum {
+			status = http.StatusRequestEntityTooLarge
+			return
+		}
+		if mine = part.Header.Get("Content-Type"); mine == "" && s.hooks == nil {
+			status = http.StatusBadRequest
+			return
+		}
+		body, err = ioutil.ReadAll(io.LimitReader(part, int64(s.c.MaxFileSize)+1))
+		part.Close()
+		if err != nil {
+			log.Errorf("ioutil.ReadAll(part) error(%s)", err)
+			status = http.StatusBadRequest
+			return
+		}
+		if len(body) > s.c.MaxFileSize {
+			status = http.StatusRequestEntityTooLarge
+			return
+		}
+		if len(body) == 0 {
+			log.Errorf("file: %s size equals 0", part.FileName())
+			status = http.StatusBadRequest
+			return
+		}
+		hf = &hook.File{Filename: dir + strings.TrimLeft(path.Base("/"+part.FileName()), "/"), Mine: mine, Data: body}
+		if err = s.hooks.PreUpload(hr, hf); err != nil {
+			status = hook.Code(err)
+			return
+		}
+		if mine, body = hf.Mine, hf.Data; mine == "" || len(body) == 0 {
+			status = http.StatusBadRequest
+			return
+		}
+		if len(body) > s.c.MaxFileSize {
+			status = http.StatusRequestEntityTooLarge
+			return
+		}
+		sha = sha1.Sum(body)
+		f = &bfs.File{Mine: mine, Sha1: hex.EncodeToString(sha[:]), Data: body}
+		f.Name = originName(part.Header.Get("Content-Disposition"))
+		if f.Filename = path.Base(part.FileName()); f.Filename == "." || f.Filename == "/" {
+			if ext = path.Base(mine); ext == "jpeg" {
+				ext = "jpg"
+			}
+			f.Filename = f.Sha1 + "." + ext
+		}
+		if f.Filename = dir + f.Filename; len(f.Filename) > _maxFileNameLength {
+			status = http.StatusRequestEntityTooLarge
+			return
+		}
+		fs = append(fs, f)
+	}
+	r.Body.Close()
+	if len(fs) == 0 {
+		status = http.StatusBadRequest
+		return
+	}
+	tr.Phase("recv")
+	err = s.srv.UploadsContext(ctx, bucket, fs)
+	tr.Phase("upload")
+	for _, f = range fs {
+		if ferr = f.Err; err != nil {
+			ferr = err
+		}
+		s.hooks.PostUpload(hr, &hook.File{Filename: f.Filename, Mine: f.Mine, Sha1: f.Sha1, Data: f.Data}, ferr)
+	}
+	if err != nil {
+		status = errors.Status(err)
+		return
+	}
+	rs = make([]*uploadResult, 0, len(fs))
+	for _, f = range fs {
+		rs = append(rs, s.uploadResult(bucket, f))
+	}
+	if body, err = json.Marshal(rs); err != nil {
+		status = http.StatusInternalServerError
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json")
+	retCode(wr, &status)
+	wr.Write(body)
+	return
+}
+
+// uploadResult get the result of the uploaded file.
+func (s *server) uploadResult(bucket string, f *bfs.File) (res *uploadResult) {
+	res = &uploadResult{Filename: f.Filename, Code: http.StatusOK}
+	if f.Err != nil && f.Err != errors.ErrNeedleExist {
+		res.Code = errors.Status(f.Err)
+		return
+	}
+	res.Location = s.getURI(bucket, f.Filename)
+	res.ETag = f.Sha1
+	return
+}
+
+// preflight answer the cors preflight by the cors rule of the bucket.
+func (s *server) preflight(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
+	if !item.CORS.Preflight(wr.Header(), r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method"),
+		r.Header.Get("Access-Control-Request-Headers")) {
+		log.Errorf("preflight(%s, %s) origin: %s not allowed", bucket, file, r.Header.Get("Origin"))
+		http.Error(wr, "", http.StatusForbidden)
+		return
+	}
+	wr.WriteHeader(http.StatusNoContent)
+}
+
+// alias put the file as an alias of the file of the X-Bfs-Alias header in
+// the bucket, they share one needle, no data uploaded or copied.
+func (s *server) alias(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
+	var (
 		err    error
-		uerr   errors.Error
 		status = http.StatusOK
 		start  = time.Now()
+		src    = r.Header.Get(_aliasHeader)
 	)
-	defer httpLog("delete", r.URL.Path, &bucket, &file, start, &status, &err)
-	if err = s.srv.Delete(bucket, file); err != nil {
-		if err == errors.ErrNeedleNotExist {
-			status = http.StatusNotFound
+	defer httpLog("alias", r, &bucket, &file, start, &status, &err)
+	defer retCode(wr, &status)
+	if file == "" || strings.HasSuffix(file, "/") || len(src) > _maxFileNameLength {
+		status = http.StatusBadRequest
+		return
+	}
+	if err = s.srv.AliasContext(r.Context(), bucket, src, file); err != nil {
+		status = errors.Status(err)
+		return
+	}
+	wr.Header().Set("Location", s.getURI(bucket, file))
+	return
+}
+
+func (s *server) delete(item *ibucket.Item, bucket, file string, wr http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		status = http.StatusOK
+		start  = time.Now()
+		tr     = s.slow.Start()
+	)
+	defer tr.End(r)
+	defer httpLog("delete", r, &bucket, &file, start, &status, &err)
+	err = s.srv.DeleteContext(r.Context(), bucket, file)
+	tr.Phase("delete")
+	if err != nil {
+		if status = errors.Status(err); status == http.StatusNotFound {
 			http.Error(wr, "", status)
-		} else {
-			if uerr, ok = (err).(errors.Error); ok {
-				status = int(uerr)
-			} else {
-				status = http.StatusInternalServerError
-			}
 		}
 	} else {
 		wr.Header().Set("Code", strconv.Itoa(status))
@@ -324,7 +779,216 @@ func (s *server) delete(item *ibucket.Item, bucket, file string, wr http.Respons
 	return
 }
 
+// sign mint a signed download url of the file, the url expires in the
+// expires(seconds) and can be handed out without the key secret.
+func (s *server) sign(wr http.ResponseWriter, r *http.Request) {
+	var (
+		bucket   string
+		file     string
+		token    string
+		expires  int64
+		byteJSON []byte
+		item     *ibucket.Item
+		params   = r.URL.Query()
+		res      = map[string]interface{}{}
+		err      error
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if bucket, file = params.Get("bucket"), params.Get("file"); bucket == "" || file == "" {
+		http.Error(wr, "", http.StatusBadRequest)
+		return
+	}
+	if params.Get("expires") == "" {
+		expires = _signExpire
+	} else if expires, err = strconv.ParseInt(params.Get("expires"), 10, 64); err != nil ||
+		expires <= 0 || expires > _signMaxExpire {
+		log.Errorf("sign expires: %s error(%v)", params.Get("expires"), err)
+		http.Error(wr, "", http.StatusBadRequest)
+		return
+	}
+	if item, err = s.bucket.Get(bucket); err != nil {
+		log.Errorf("bucket.Get(%s) error(%v)", bucket, err)
+		http.Error(wr, "", http.StatusNotFound)
+		return
+	}
+	// only who can read the file can sign it
+	if token = r.Header.Get("Authorization"); token == "" {
+		token = params.Get("token")
+	}
+	if err = s.auth.Authorize(item, "GET", bucket, file, token); err != nil {
+		log.Errorf("authorize(GET, %s, %s, %s) by item: %v error(%v)", bucket, file, token, item, err)
+		http.Error(wr, "", http.StatusUnauthorized)
+		return
+	}
+	expires += time.Now().Unix()
+	res["url"] = fmt.Sprintf("%s?expires=%d&signature=%s", s.getURI(bucket, file), expires,
+		s.auth.SignURL(item, bucket, file, expires))
+	res["expires"] = expires
+	if byteJSON, err = json.Marshal(res); err != nil {
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	wr.Write(byteJSON)
+}
+
+// webdav serve the buckets by webdav, the bucket not public is authorized
+// by the basic auth of the access key id and secret, the copy and move are
+// only in the bucket.
+func (s *server) webdav(wr http.ResponseWriter, r *http.Request) {
+	var (
+		ok     bool
+		bucket string
+		keyId  string
+		secret string
+		ks     string
+		err    error
+		item   *ibucket.Item
+		dst    *url.URL
+		read   = false
+	)
+	switch r.Method {
+	case "OPTIONS", "HEAD", "GET", "PROPFIND":
+		read = true
+	}
+	if !s.limit.Allow(limit.KindIP, s.limit.IP(r)) {
+		tooManyRequests(wr)
+		return
+	}
+	// uri: /prefix/bucket/file...
+	if bucket = davBucket(s.c.WebDAV.Prefix, r.URL.Path); bucket == "" {
+		http.Error(wr, "", http.StatusNotFound)
+		return
+	}
+	if item, err = s.bucket.Get(bucket); err != nil {
+		log.Errorf("bucket.Get(%s) error(%v)", bucket, err)
+		http.Error(wr, "", http.StatusNotFound)
+		return
+	}
+	if !s.limit.Allow(limit.KindBucket, bucket) {
+		tooManyRequests(wr)
+		return
+	}
+	if r.Header.Get("Destination") != "" {
+		if dst, err = url.Parse(r.Header.Get("Destination")); err != nil || davBucket(s.c.WebDAV.Prefix, dst.Path) != bucket {
+			log.Errorf("webdav %s(%s) destination: %s not in the bucket", r.Method, r.URL.Path, r.Header.Get("Destination"))
+			http.Error(wr, "", http.StatusForbidden)
+			return
+		}
+	}
+	if !item.Public(read) {
+		if keyId, secret, ok = r.BasicAuth(); ok {
+			ks, ok = item.Secret(keyId)
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(ks), []byte(secret)) != 1 {
+			log.Errorf("webdav %s(%s) by key: %s authorize failed", r.Method, r.URL.Path, keyId)
+			wr.Header().Set("WWW-Authenticate", `Basic realm="bfs"`)
+			http.Error(wr, "", http.StatusUnauthorized)
+			return
+		}
+		if !s.limit.Allow(limit.KindKey, keyId) {
+			tooManyRequests(wr)
+			return
+		}
+	}
+	s.dav.ServeHTTP(wr, r)
+}
+
+// hookStorage the webdav storage calling the request middlewares.
+type hookStorage struct {
+	*Service
+	c     *conf.Config
+	hooks *hook.Chain
+}
+
+func (s *hookStorage) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	if err = s.hooks.PreDownload(&hook.Request{Method: "GET", Bucket: bucket, Filename: filename}); err != nil {
+		return
+	}
+	return s.Service.Get(bucket, filename)
+}
+
+func (s *hookStorage) Upload(bucket, filename, name, mine, sha1sum string, buf []byte) (err error) {
+	var (
+		sha [sha1.Size]byte
+		r   = &hook.Request{Method: "PUT", Bucket: bucket, Filename: filename}
+		f   = &hook.File{Filename: filename, Mine: mine, Data: buf}
+	)
+	if s.hooks == nil {
+		return s.Service.Upload(bucket, filename, name, mine, sha1sum, buf)
+	}
+	if err = s.hooks.PreUpload(r, f); err != nil {
+		return
+	}
+	if len(f.Data) == 0 {
+		return errors.ErrParam
+	}
+	if len(f.Data) > s.c.MaxFileSize {
+		return errors.ErrFileTooLarge
+	}
+	sha = sha1.Sum(f.Data)
+	f.Sha1 = hex.EncodeToString(sha[:])
+	err = s.Service.Upload(bucket, filename, name, f.Mine, f.Sha1, f.Data)
+	s.hooks.PostUpload(r, f, err)
+	return
+}
+
+// davBucket get the bucket of the webdav path.
+func davBucket(prefix, p string) string {
+	if !strings.HasPrefix(p, prefix) {
+		return ""
+	}
+	return strings.SplitN(p[len(prefix):], "/", 2)[0]
+}
+
+func davLog(r *http.Request, err error) {
+	if err != nil {
+		log.Errorf("webdav %s(%s) error(%v)", r.Method, r.URL.Path, err)
+	}
+}
+
 // monitorPing sure program now runs correctly, when return http status 200.
+// debt get the repair debt of the uploads acked before written to all the
+// replicas.
+func (s *server) debt(wr http.ResponseWriter, r *http.Request) {
+	var (
+		byteJSON []byte
+		err      error
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if byteJSON, err = json.Marshal(s.srv.Debt()); err != nil {
+		log.Errorf("json.Marshal() error(%v)", err)
+		http.Error(wr, "", http.StatusInternalServerError)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	wr.Write(byteJSON)
+}
+
+// notify get the counters of the object events published to the sinks.
+func (s *server) notify(wr http.ResponseWriter, r *http.Request) {
+	var (
+		byteJSON []byte
+		err      error
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if byteJSON, err = json.Marshal(s.srv.Notify()); err != nil {
+		log.Errorf("json.Marshal() error(%v)", err)
+		http.Error(wr, "", http.StatusInternalServerError)
+		return
+	}
+	wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+	wr.Write(byteJSON)
+}
+
 func (s *server) ping(wr http.ResponseWriter, r *http.Request) {
 	var (
 		byteJSON []byte
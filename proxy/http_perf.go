@@ -1,18 +1,25 @@
 package main
 
 import (
-	log "github.com/golang/glog"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+
+	"bfs/libs/log"
+	"bfs/libs/upgrade"
 )
 
-// StartPprof start a golang pprof.
-func StartPprof(addr string) {
+// StartPprof start a golang pprof, with the log level api.
+func StartPprof(addr string) (l net.Listener) {
+	var err error
+	http.HandleFunc("/log/level", log.Handler)
+	if l, err = upgrade.Listen(addr); err != nil {
+		return nil
+	}
 	go func() {
-		var err error
-		if err = http.ListenAndServe(addr, nil); err != nil {
-			log.Errorf("http.ListenAndServe(\"%s\") error(%v)", addr, err)
-			return
+		if err := http.Serve(l, nil); err != nil {
+			log.Errorf("http.Serve(\"%s\") error(%v)", addr, err)
 		}
 	}()
+	return
 }
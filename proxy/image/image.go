@@ -0,0 +1,143 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"strconv"
+
+	"bfs/libs/errors"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	_mineJpeg = "image/jpeg"
+	_minePng  = "image/png"
+	_mineWebp = "image/webp"
+
+	_defaultQuality = 85
+)
+
+// Option the thumbnail option, w or h 0 keeps the ratio.
+type Option struct {
+	W    int
+	H    int
+	Q    int
+	Crop bool
+}
+
+func (o *Option) String() string {
+	return fmt.Sprintf("w%d_h%d_q%d_c%t", o.W, o.H, o.Q, o.Crop)
+}
+
+// Key the cache key of the thumbnail of the file.
+func Key(bucket, file, sha1sum string, o *Option) string {
+	return bucket + "/" + file + "/" + sha1sum + "/" + o.String()
+}
+
+// Supported reports whether the image type can be thumbnailed.
+func Supported(mine string) bool {
+	return mine == _mineJpeg || mine == _minePng || mine == _mineWebp
+}
+
+// Parse parse the option from the query ?w=..&h=..&q=..&crop=1, nil if no
+// w and h, the size is limited by max.
+func Parse(params url.Values, max int) (o *Option, err error) {
+	var str string
+	if params.Get("w") == "" && params.Get("h") == "" {
+		return
+	}
+	o = &Option{Q: _defaultQuality, Crop: params.Get("crop") == "1"}
+	if str = params.Get("w"); str != "" {
+		if o.W, err = strconv.Atoi(str); err != nil || o.W < 0 || o.W > max {
+			return nil, errors.ErrParam
+		}
+	}
+	if str = params.Get("h"); str != "" {
+		if o.H, err = strconv.Atoi(str); err != nil || o.H < 0 || o.H > max {
+			return nil, errors.ErrParam
+		}
+	}
+	if str = params.Get("q"); str != "" {
+		if o.Q, err = strconv.Atoi(str); err != nil || o.Q < 1 || o.Q > 100 {
+			return nil, errors.ErrParam
+		}
+	}
+	if o.W == 0 && o.H == 0 {
+		return nil, errors.ErrParam
+	}
+	return
+}
+
+// Thumbnail resize the image by the option, crop to fill the size if crop
+// else fit in it, never enlarge. png keeps png, jpeg and webp output jpeg.
+func Thumbnail(src io.Reader, o *Option) (dst []byte, mine string, err error) {
+	var (
+		format string
+		img    image.Image
+		sr     image.Rectangle
+		w, h   int
+		out    *image.RGBA
+		buf    = &bytes.Buffer{}
+	)
+	if img, format, err = image.Decode(src); err != nil {
+		return
+	}
+	sr, w, h = fit(img.Bounds(), o)
+	out = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(out, out.Bounds(), img, sr, draw.Src, nil)
+	if format == "png" {
+		mine = _minePng
+		err = png.Encode(buf, out)
+	} else {
+		mine = _mineJpeg
+		err = jpeg.Encode(buf, out, &jpeg.Options{Quality: o.Q})
+	}
+	dst = buf.Bytes()
+	return
+}
+
+// fit get the source rect and the thumbnail size.
+func fit(b image.Rectangle, o *Option) (sr image.Rectangle, w, h int) {
+	var (
+		sw, sh = b.Dx(), b.Dy()
+		cw, ch int
+	)
+	sr, w, h = b, o.W, o.H
+	switch {
+	case w == 0:
+		w = sw * h / sh
+	case h == 0:
+		h = sh * w / sw
+	case o.Crop:
+		// crop the center to the ratio of the size
+		if cw, ch = sw, sw*h/w; ch > sh {
+			cw, ch = sh*w/h, sh
+		}
+		sr = image.Rect(b.Min.X+(sw-cw)/2, b.Min.Y+(sh-ch)/2, b.Min.X+(sw+cw)/2, b.Min.Y+(sh+ch)/2)
+		sw, sh = cw, ch
+	default:
+		// fit in the size
+		if sw*h > sh*w {
+			h = sh * w / sw
+		} else {
+			w = sw * h / sh
+		}
+	}
+	if w > sw || h > sh {
+		w, h = sw, sh
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return
+}
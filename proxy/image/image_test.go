@@ -0,0 +1,85 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var (
+		o   *Option
+		err error
+	)
+	if o, err = Parse(url.Values{}, 100); err != nil || o != nil {
+		t.Errorf("Parse() no size got: %v error(%v)", o, err)
+		t.FailNow()
+	}
+	if o, err = Parse(url.Values{"w": {"50"}, "crop": {"1"}}, 100); err != nil || o.W != 50 || o.H != 0 || !o.Crop || o.Q != _defaultQuality {
+		t.Errorf("Parse() got: %v error(%v)", o, err)
+		t.FailNow()
+	}
+	if _, err = Parse(url.Values{"w": {"200"}}, 100); err == nil {
+		t.Errorf("Parse() exceed max size no error")
+		t.FailNow()
+	}
+	if _, err = Parse(url.Values{"w": {"10"}, "q": {"0"}}, 100); err == nil {
+		t.Errorf("Parse() bad quality no error")
+		t.FailNow()
+	}
+}
+
+func TestFit(t *testing.T) {
+	var (
+		sr   image.Rectangle
+		w, h int
+		b    = image.Rect(0, 0, 400, 200)
+	)
+	if _, w, h = fit(b, &Option{W: 100}); w != 100 || h != 50 {
+		t.Errorf("fit(w) got: %dx%d", w, h)
+		t.FailNow()
+	}
+	if _, w, h = fit(b, &Option{W: 100, H: 100}); w != 100 || h != 50 {
+		t.Errorf("fit(w, h) got: %dx%d", w, h)
+		t.FailNow()
+	}
+	if sr, w, h = fit(b, &Option{W: 100, H: 100, Crop: true}); w != 100 || h != 100 || sr != image.Rect(100, 0, 300, 200) {
+		t.Errorf("fit(crop) got: %v %dx%d", sr, w, h)
+		t.FailNow()
+	}
+	if _, w, h = fit(b, &Option{W: 800}); w != 400 || h != 200 {
+		t.Errorf("fit(enlarge) got: %dx%d", w, h)
+		t.FailNow()
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	var (
+		err  error
+		mine string
+		dst  []byte
+		img  image.Image
+		src  = image.NewRGBA(image.Rect(0, 0, 64, 32))
+		buf  = &bytes.Buffer{}
+	)
+	src.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	if err = png.Encode(buf, src); err != nil {
+		t.Errorf("png.Encode() error(%v)", err)
+		t.FailNow()
+	}
+	if dst, mine, err = Thumbnail(buf, &Option{W: 16, Q: 80}); err != nil {
+		t.Errorf("Thumbnail() error(%v)", err)
+		t.FailNow()
+	}
+	if mine != _minePng {
+		t.Errorf("Thumbnail() mine: %s", mine)
+		t.FailNow()
+	}
+	if img, err = png.Decode(bytes.NewReader(dst)); err != nil || img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+		t.Errorf("Thumbnail() got: %v error(%v)", img.Bounds(), err)
+		t.FailNow()
+	}
+}
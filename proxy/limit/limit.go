@@ -0,0 +1,126 @@
+package limit
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"bfs/libs/addr"
+	"bfs/proxy/conf"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limit kind
+	KindKey    = "key"
+	KindBucket = "bucket"
+	KindIP     = "ip"
+)
+
+// Limiter the token bucket rate limiters keyed by the access key, the
+// bucket and the client ip, the idle ones are dropped after the expire.
+// a nil Limiter allows all.
+type Limiter struct {
+	c        *conf.RateLimit
+	lock     sync.Mutex
+	limiters map[string]*limiter // kind_key:limiter
+}
+
+type limiter struct {
+	*rate.Limiter
+	last time.Time
+}
+
+// New new a limiter, nil if not configured.
+func New(c *conf.Config) (l *Limiter) {
+	if c.RateLimit == nil {
+		return nil
+	}
+	l = &Limiter{c: c.RateLimit, limiters: make(map[string]*limiter)}
+	go l.expireproc()
+	return
+}
+
+// rule get the limit of the kind and key, the specific one first.
+func (l *Limiter) rule(kind, key string) (r *conf.Limit) {
+	var ok bool
+	switch kind {
+	case KindKey:
+		if r, ok = l.c.Keys[key]; !ok {
+			r = l.c.Key
+		}
+	case KindBucket:
+		if r, ok = l.c.Buckets[key]; !ok {
+			r = l.c.Bucket
+		}
+	case KindIP:
+		r = l.c.IP
+	}
+	return
+}
+
+// Allow reports whether a request of the key can happen now, the kind
+// without limit allows all.
+func (l *Limiter) Allow(kind, key string) bool {
+	var (
+		ok  bool
+		r   *conf.Limit
+		lim *limiter
+		now = time.Now()
+		k   = kind + "_" + key
+	)
+	if l == nil || key == "" {
+		return true
+	}
+	if r = l.rule(kind, key); r == nil {
+		return true
+	}
+	l.lock.Lock()
+	if lim, ok = l.limiters[k]; !ok {
+		lim = &limiter{Limiter: rate.NewLimiter(rate.Limit(r.Rate), r.Brust)}
+		l.limiters[k] = lim
+	}
+	lim.last = now
+	l.lock.Unlock()
+	return lim.AllowN(now, 1)
+}
+
+// IP get the client ip by the ip header of the front proxy, the first of
+// the list, else the remote addr.
+func (l *Limiter) IP(r *http.Request) (ip string) {
+	if l == nil {
+		return
+	}
+	if l.c.IPHeader != "" {
+		// the header may have a port, or an IPv6 literal in brackets
+		if ip = strings.TrimSpace(strings.Split(r.Header.Get(l.c.IPHeader), ",")[0]); ip != "" {
+			return addr.IP(ip)
+		}
+	}
+	return addr.IP(r.RemoteAddr)
+}
+
+// expire drop the limiters idle since the time.
+func (l *Limiter) expire(since time.Time) {
+	var (
+		k   string
+		lim *limiter
+	)
+	l.lock.Lock()
+	for k, lim = range l.limiters {
+		if lim.last.Before(since) {
+			delete(l.limiters, k)
+		}
+	}
+	l.lock.Unlock()
+}
+
+// expireproc drop the idle limiters every expire.
+func (l *Limiter) expireproc() {
+	for {
+		time.Sleep(time.Duration(l.c.Expire))
+		l.expire(time.Now().Add(-time.Duration(l.c.Expire)))
+	}
+}
@@ -0,0 +1,55 @@
+package limit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	xtime "bfs/libs/time"
+	"bfs/proxy/conf"
+)
+
+func TestLimiter(t *testing.T) {
+	var (
+		l *Limiter
+		r = &http.Request{RemoteAddr: "10.0.0.1:1234", Header: http.Header{}}
+		c = &conf.Config{RateLimit: &conf.RateLimit{
+			Bucket:  &conf.Limit{Rate: 1, Brust: 2},
+			Buckets: map[string]*conf.Limit{"big": {Rate: 1, Brust: 3}},
+			Expire:  xtime.Duration(time.Minute),
+		}}
+	)
+	if !l.Allow(KindBucket, "a") || l.IP(r) != "" {
+		t.Errorf("nil Limiter limited")
+		t.FailNow()
+	}
+	l = New(c)
+	if !l.Allow(KindBucket, "a") || !l.Allow(KindBucket, "a") || l.Allow(KindBucket, "a") {
+		t.Errorf("Allow(bucket) not limited by brust")
+		t.FailNow()
+	}
+	if !l.Allow(KindBucket, "big") || !l.Allow(KindBucket, "big") || !l.Allow(KindBucket, "big") || l.Allow(KindBucket, "big") {
+		t.Errorf("Allow(bucket) not limited by the specific brust")
+		t.FailNow()
+	}
+	// no ip limit
+	if !l.Allow(KindIP, l.IP(r)) {
+		t.Errorf("Allow(ip) limited")
+		t.FailNow()
+	}
+	if l.IP(r) != "10.0.0.1" {
+		t.Errorf("IP() got: %s", l.IP(r))
+		t.FailNow()
+	}
+	c.RateLimit.IPHeader = "X-Forwarded-For"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.2")
+	if l.IP(r) != "1.2.3.4" {
+		t.Errorf("IP() header got: %s", l.IP(r))
+		t.FailNow()
+	}
+	l.expire(time.Now().Add(time.Second))
+	if !l.Allow(KindBucket, "a") {
+		t.Errorf("Allow(bucket) limited after expire")
+		t.FailNow()
+	}
+}
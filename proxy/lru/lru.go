@@ -0,0 +1,135 @@
+package lru
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"bfs/libs/log"
+	"bfs/libs/meta"
+)
+
+// Cache the lru cache of the files, in memory or in the local dir, limited
+// by the total bytes.
+type Cache struct {
+	dir   string
+	max   int64
+	size  int64
+	lock  sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type item struct {
+	key  string
+	mf   *meta.File
+	size int64
+	data []byte // nil if on disk
+}
+
+// New new a cache, in memory if dir empty.
+func New(dir string, max int64) (c *Cache, err error) {
+	var (
+		name  string
+		names []string
+	)
+	c = &Cache{dir: dir, max: max, lru: list.New(), items: make(map[string]*list.Element)}
+	if dir == "" {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	// the files of last run are not indexed, start clean
+	if names, err = filepath.Glob(filepath.Join(dir, strings.Repeat("[0-9a-f]", sha1.Size*2))); err != nil {
+		return
+	}
+	for _, name = range names {
+		os.Remove(name)
+	}
+	return
+}
+
+// path the local file of the key.
+func (c *Cache) path(key string) string {
+	var h = sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:]))
+}
+
+// Get get the file.
+func (c *Cache) Get(key string) (data []byte, mf *meta.File, ok bool) {
+	var (
+		err error
+		e   *list.Element
+		it  *item
+	)
+	c.lock.Lock()
+	if e, ok = c.items[key]; ok {
+		c.lru.MoveToFront(e)
+		it = e.Value.(*item)
+		data, mf = it.data, it.mf
+	}
+	c.lock.Unlock()
+	if !ok || c.dir == "" {
+		return
+	}
+	if data, err = ioutil.ReadFile(c.path(key)); err != nil {
+		log.Errorf("ioutil.ReadFile(%s) error(%v)", c.path(key), err)
+		c.Del(key)
+		ok = false
+	}
+	return
+}
+
+// Set set the file, evict the least recently used if full.
+func (c *Cache) Set(key string, mf *meta.File, data []byte) {
+	var (
+		err error
+		it  = &item{key: key, mf: mf, size: int64(len(data))}
+	)
+	if it.size > c.max {
+		return
+	}
+	if c.dir == "" {
+		it.data = data
+	} else if err = ioutil.WriteFile(c.path(key), data, 0644); err != nil {
+		log.Errorf("ioutil.WriteFile(%s) error(%v)", c.path(key), err)
+		return
+	}
+	c.lock.Lock()
+	if e, ok := c.items[key]; ok {
+		c.size -= e.Value.(*item).size
+		c.lru.Remove(e)
+	}
+	c.items[key] = c.lru.PushFront(it)
+	c.size += it.size
+	for c.size > c.max {
+		c.evict(c.lru.Back())
+	}
+	c.lock.Unlock()
+}
+
+// Del delete the key.
+func (c *Cache) Del(key string) {
+	c.lock.Lock()
+	if e, ok := c.items[key]; ok {
+		c.evict(e)
+	}
+	c.lock.Unlock()
+}
+
+// evict remove the element, under the lock.
+func (c *Cache) evict(e *list.Element) {
+	var it = e.Value.(*item)
+	c.lru.Remove(e)
+	delete(c.items, it.key)
+	c.size -= it.size
+	if c.dir != "" {
+		os.Remove(c.path(it.key))
+	}
+}
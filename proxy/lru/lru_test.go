@@ -0,0 +1,52 @@
+package lru
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"bfs/libs/meta"
+)
+
+func TestCache(t *testing.T) {
+	var (
+		ok   bool
+		err  error
+		dir  string
+		data []byte
+		c    *Cache
+		mf   = &meta.File{Mine: "image/png"}
+	)
+	if dir, err = ioutil.TempDir("", "bfs_lru"); err != nil {
+		t.Errorf("ioutil.TempDir() error(%v)", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	for _, dir = range []string{"", dir} {
+		if c, err = New(dir, 8); err != nil {
+			t.Errorf("New(%s) error(%v)", dir, err)
+			t.FailNow()
+		}
+		c.Set("a", mf, []byte("1234"))
+		c.Set("b", mf, []byte("5678"))
+		if data, _, ok = c.Get("a"); !ok || string(data) != "1234" {
+			t.Errorf("Get(a) got: %s, %v", data, ok)
+			t.FailNow()
+		}
+		// b is the least recently used
+		c.Set("c", mf, []byte("9"))
+		if _, _, ok = c.Get("b"); ok {
+			t.Errorf("Get(b) not evicted")
+			t.FailNow()
+		}
+		if _, _, ok = c.Get("a"); !ok {
+			t.Errorf("Get(a) evicted")
+			t.FailNow()
+		}
+		c.Del("a")
+		if _, _, ok = c.Get("a"); ok {
+			t.Errorf("Get(a) not deleted")
+			t.FailNow()
+		}
+	}
+}
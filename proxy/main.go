@@ -1,60 +1,102 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
+	"bfs/libs/check"
+	"bfs/libs/log"
+	"bfs/libs/trace"
+	"bfs/libs/upgrade"
 	"bfs/proxy/conf"
-
-	log "github.com/golang/glog"
 )
 
 const (
 	version = "1.0.0"
+
+	// the wait for the new process of an upgrade
+	_upgradeTimeout = 1 * time.Minute
+	// the wait for the requests in flight of the old process
+	_drainTimeout = 30 * time.Second
 )
 
 var (
 	configFile string
+	testConfig bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "c", "./proxy.toml", " set directory config file path")
+	flag.BoolVar(&testConfig, "t", false, " test config and exit")
 }
 
 func main() {
 	var (
 		c   *conf.Config
+		svr *http.Server
+		l   net.Listener
+		ls  = make(map[string]net.Listener)
 		err error
 	)
 	flag.Parse()
+	if testConfig {
+		checkConf()
+		return
+	}
 	defer log.Flush()
 	log.Infof("bfs proxy [version: %s] start", version)
 	if c, err = conf.NewConfig(configFile); err != nil {
 		log.Errorf("NewConfig(\"%s\") error(%v)", configFile, err)
 		panic(err)
 	}
+	if err = log.Init(c.Log); err != nil {
+		log.Errorf("log.Init() error(%v)", err)
+		panic(err)
+	}
+	if err = trace.Init(c.Tracing, "bfs-proxy"); err != nil {
+		log.Errorf("trace.Init() error(%v)", err)
+		panic(err)
+	}
+	defer trace.Close()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	// init http
-	if err = StartAPI(c); err != nil {
+	if svr, l, err = StartAPI(c); err != nil {
 		log.Errorf("http.Init() error(%v)", err)
 		panic(err)
 	}
+	ls[c.HttpAddr] = l
 	if c.PprofEnable {
 		log.Infof("init http pprof...")
-		StartPprof(c.PprofListen)
+		if l = StartPprof(c.PprofListen); l != nil {
+			ls[c.PprofListen] = l
+		}
 	}
+	// the old process drains and exits if upgraded
+	upgrade.Ready()
 
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGSTOP)
+	signal.Notify(ch, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGSTOP, syscall.SIGUSR2)
 	for {
 		s := <-ch
 		log.Infof("get a signal %s", s.String())
 		switch s {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGSTOP, syscall.SIGINT:
 			return
+		case syscall.SIGUSR2:
+			// upgrade to the new binary in place
+			if err = handover(svr, ls); err != nil {
+				log.Errorf("upgrade error(%v)", err)
+				continue
+			}
+			return
 		case syscall.SIGHUP:
 			// TODO reload
 		default:
@@ -62,3 +104,55 @@ func main() {
 		}
 	}
 }
+
+// handover start the new binary with the listeners, and drain the requests
+// in flight once it is ready, then the old process exits.
+func handover(svr *http.Server, ls map[string]net.Listener) (err error) {
+	var (
+		fs     map[string]*os.File
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if fs, err = upgrade.Files(ls); err != nil {
+		return
+	}
+	defer upgrade.Close(fs)
+	if _, err = upgrade.Start(fs, _upgradeTimeout); err != nil {
+		return
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), _drainTimeout)
+	defer cancel()
+	if err = svr.Shutdown(ctx); err != nil {
+		log.Errorf("server.Shutdown() error(%v)", err)
+	}
+	for _, l := range ls {
+		l.Close()
+	}
+	return nil
+}
+
+// checkConf parse and check the config, directory and memcache reachability,
+// then print the effective config, exit non-zero if any problem found.
+func checkConf() {
+	var (
+		c   *conf.Config
+		err error
+	)
+	if c, err = conf.NewConfig(configFile); err == nil {
+		if err = c.Check(); err == nil {
+			ck := check.New()
+			ck.Dial("BfsAddr", []string{c.BfsAddr}, 0)
+			if c.BfsRpcAddr != "" {
+				ck.Dial("BfsRpcAddr", []string{c.BfsRpcAddr}, time.Duration(c.BfsTimeout))
+			}
+			ck.Dial("Mc.Addr", []string{c.Mc.Addr}, time.Duration(c.Mc.DialTimeout))
+			err = ck.Err()
+		}
+		check.Print(os.Stdout, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config file %s test failed:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "config file %s test is successful\n", configFile)
+}
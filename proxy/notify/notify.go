@@ -0,0 +1,204 @@
+// Package notify publishes the object created and deleted events of the
+// proxy to the webhook, nsq or kafka sinks, so the downstream pipelines,
+// e.g. thumbnailing or indexing, react without polling.
+package notify
+
+import (
+	"sync/atomic"
+	"time"
+
+	"bfs/libs/log"
+	"bfs/proxy/conf"
+)
+
+const (
+	// the event types
+	ObjectCreated = "ObjectCreated"
+	ObjectDeleted = "ObjectDeleted"
+
+	_queue   = 10000
+	_batch   = 100
+	_timeout = 5 * time.Second
+	// the first retry backoff, doubled every retry
+	_backoff = 100 * time.Millisecond
+)
+
+// Event an object created or deleted, the uploads, the aliases and the
+// webdav puts create the objects.
+type Event struct {
+	Type     string `json:"type"`
+	Bucket   string `json:"bucket"`
+	Filename string `json:"filename"`
+	Sha1     string `json:"sha1,omitempty"`
+	Mine     string `json:"mine,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Time     int64  `json:"time"` // unix nano
+}
+
+// Sink send the events in one request.
+type Sink interface {
+	Send(es []*Event) error
+}
+
+// sink a sink and the events it publishes.
+type sink struct {
+	Sink
+	name    string
+	buckets map[string]bool // all if nil
+	events  map[string]bool // all if nil
+}
+
+// match reports whether the sink publishes the event.
+func (s *sink) match(e *Event) bool {
+	return (s.buckets == nil || s.buckets[e.Bucket]) && (s.events == nil || s.events[e.Type])
+}
+
+// Stat the counters of the events.
+type Stat struct {
+	Published int64 `json:"published"`
+	Sent      int64 `json:"sent"`    // sent to a sink
+	Failed    int64 `json:"failed"`  // failed to send to a sink after the retries
+	Dropped   int64 `json:"dropped"` // the queue was full
+}
+
+// Notifier publish the events to the sinks by a background goroutine, a nil
+// Notifier publishes nothing.
+type Notifier struct {
+	c     *conf.Notify
+	sinks []*sink
+	ch    chan *Event
+	stat  Stat
+}
+
+// New new a notifier of the sinks, nil if not configured.
+func New(c *conf.Config) (n *Notifier, err error) {
+	var (
+		s  *sink
+		sc *conf.NotifySink
+		qn = _queue
+	)
+	if c.Notify == nil || len(c.Notify.Sinks) == 0 {
+		return
+	}
+	if c.Notify.Queue > 0 {
+		qn = c.Notify.Queue
+	}
+	n = &Notifier{c: c.Notify, ch: make(chan *Event, qn)}
+	for _, sc = range c.Notify.Sinks {
+		s = &sink{name: sc.Kind + ":" + sc.Url}
+		if s.Sink, err = newSink(sc); err != nil {
+			return nil, err
+		}
+		if len(sc.Buckets) > 0 {
+			s.buckets = set(sc.Buckets)
+		}
+		if len(sc.Events) > 0 {
+			s.events = set(sc.Events)
+		}
+		n.sinks = append(n.sinks, s)
+	}
+	go n.sendproc()
+	return
+}
+
+func set(ss []string) (m map[string]bool) {
+	m = make(map[string]bool, len(ss))
+	for _, s := range ss {
+		m[s] = true
+	}
+	return
+}
+
+// Publish queue the event, dropped if the queue is full, never blocks.
+func (n *Notifier) Publish(e *Event) {
+	if n == nil {
+		return
+	}
+	if e.Time == 0 {
+		e.Time = time.Now().UnixNano()
+	}
+	select {
+	case n.ch <- e:
+		atomic.AddInt64(&n.stat.Published, 1)
+	default:
+		atomic.AddInt64(&n.stat.Dropped, 1)
+		log.Warningf("notify queue full, drop %s bucket: %s file: %s", e.Type, e.Bucket, e.Filename)
+	}
+}
+
+// Stat get the counters of the events, nil if not configured.
+func (n *Notifier) Stat() *Stat {
+	if n == nil {
+		return nil
+	}
+	return &Stat{
+		Published: atomic.LoadInt64(&n.stat.Published),
+		Sent:      atomic.LoadInt64(&n.stat.Sent),
+		Failed:    atomic.LoadInt64(&n.stat.Failed),
+		Dropped:   atomic.LoadInt64(&n.stat.Dropped),
+	}
+}
+
+// sendproc send the queued events in batches, the events queued meanwhile
+// are sent in the next batch.
+func (n *Notifier) sendproc() {
+	var (
+		e     *Event
+		es    []*Event
+		batch = _batch
+	)
+	if n.c.Batch > 0 {
+		batch = n.c.Batch
+	}
+	for e = range n.ch {
+		es = append(es[:0], e)
+	batch:
+		for len(es) < batch {
+			select {
+			case e = <-n.ch:
+				es = append(es, e)
+			default:
+				break batch
+			}
+		}
+		n.send(es)
+	}
+}
+
+// send send the events to every sink publishing them, in order.
+func (n *Notifier) send(es []*Event) {
+	var (
+		s   *sink
+		e   *Event
+		ses []*Event
+	)
+	for _, s = range n.sinks {
+		ses = ses[:0]
+		for _, e = range es {
+			if s.match(e) {
+				ses = append(ses, e)
+			}
+		}
+		if len(ses) == 0 {
+			continue
+		}
+		if err := n.retry(s, ses); err != nil {
+			atomic.AddInt64(&n.stat.Failed, int64(len(ses)))
+			log.Errorf("notify sink: %s events: %d error(%v)", s.name, len(ses), err)
+			continue
+		}
+		atomic.AddInt64(&n.stat.Sent, int64(len(ses)))
+	}
+}
+
+// retry send the events to the sink, retried with the backoff.
+func (n *Notifier) retry(s *sink, es []*Event) (err error) {
+	var backoff = _backoff
+	for i := 0; ; i++ {
+		if err = s.Send(es); err == nil || i >= n.c.Retries {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
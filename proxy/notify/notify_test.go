@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bfs/proxy/conf"
+)
+
+// testSink record the requests of a sink.
+type testSink struct {
+	lock   sync.Mutex
+	paths  []string
+	bodies []string
+	fails  int
+}
+
+func (ts *testSink) ServeHTTP(wr http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if ts.fails > 0 {
+		ts.fails--
+		wr.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	ts.paths = append(ts.paths, r.URL.RequestURI())
+	ts.bodies = append(ts.bodies, string(body))
+}
+
+func (ts *testSink) requests() (paths, bodies []string) {
+	ts.lock.Lock()
+	paths, bodies = ts.paths, ts.bodies
+	ts.lock.Unlock()
+	return
+}
+
+func TestNotifier(t *testing.T) {
+	var (
+		err    error
+		n      *Notifier
+		es     []*Event
+		paths  []string
+		bodies []string
+		hook   = &testSink{fails: 1}
+		nsq    = &testSink{}
+		hsvr   = httptest.NewServer(hook)
+		nsvr   = httptest.NewServer(nsq)
+	)
+	defer hsvr.Close()
+	defer nsvr.Close()
+	if n, err = New(&conf.Config{}); err != nil || n != nil {
+		t.Errorf("New() not configured = %v error(%v)", n, err)
+		t.FailNow()
+	}
+	// nil publishes nothing
+	n.Publish(&Event{Type: ObjectCreated})
+	if n, err = New(&conf.Config{Notify: &conf.Notify{Retries: 1, Sinks: []*conf.NotifySink{
+		{Kind: "webhook", Url: hsvr.URL + "/events"},
+		{Kind: "nsq", Url: nsvr.URL, Topic: "bfs", Buckets: []string{"b1"}, Events: []string{ObjectDeleted}},
+	}}}); err != nil {
+		t.Errorf("New() error(%v)", err)
+		t.FailNow()
+	}
+	n.Publish(&Event{Type: ObjectCreated, Bucket: "b1", Filename: "f1", Sha1: "s1", Size: 1})
+	n.Publish(&Event{Type: ObjectDeleted, Bucket: "b1", Filename: "f1"})
+	n.Publish(&Event{Type: ObjectDeleted, Bucket: "b2", Filename: "f2"})
+	for i := 0; i < 100 && n.Stat().Sent < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := n.Stat(); st.Published != 3 || st.Sent != 4 || st.Failed != 0 || st.Dropped != 0 {
+		t.Errorf("stat: %+v", st)
+		t.FailNow()
+	}
+	// the webhook gets all, retried once
+	_, bodies = hook.requests()
+	for _, body := range bodies {
+		var bes []*Event
+		if err = json.Unmarshal([]byte(body), &bes); err != nil {
+			t.Errorf("json.Unmarshal(%s) error(%v)", body, err)
+			t.FailNow()
+		}
+		es = append(es, bes...)
+	}
+	if len(es) != 3 || es[0].Type != ObjectCreated || es[0].Filename != "f1" || es[0].Time == 0 || es[2].Bucket != "b2" {
+		t.Errorf("webhook events: %v", es)
+		t.FailNow()
+	}
+	// the nsq gets the deletes of b1 by mpub
+	if paths, bodies = nsq.requests(); len(paths) != 1 || paths[0] != "/mpub?topic=bfs" || strings.Count(bodies[0], "\n") != 0 ||
+		!strings.Contains(bodies[0], `"type":"ObjectDeleted","bucket":"b1"`) {
+		t.Errorf("nsq paths: %v bodies: %v", paths, bodies)
+		t.FailNow()
+	}
+}
+
+func TestKafkaBody(t *testing.T) {
+	var (
+		err  error
+		body []byte
+		rs   struct {
+			Records []struct {
+				Key   string
+				Value *Event
+			}
+		}
+	)
+	if body, err = kafkaBody([]*Event{{Type: ObjectCreated, Bucket: "b", Filename: "f"}}); err != nil {
+		t.Errorf("kafkaBody() error(%v)", err)
+		t.FailNow()
+	}
+	if err = json.Unmarshal(body, &rs); err != nil || len(rs.Records) != 1 || rs.Records[0].Key != "b/f" || rs.Records[0].Value.Type != ObjectCreated {
+		t.Errorf("kafkaBody() = %s error(%v)", body, err)
+		t.FailNow()
+	}
+}
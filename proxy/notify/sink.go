@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bfs/proxy/conf"
+)
+
+const (
+	_nsqPubApi   = "%s/mpub?topic=%s"
+	_kafkaPubApi = "%s/topics/%s"
+	_kafkaType   = "application/vnd.kafka.json.v2+json"
+)
+
+// newSink new the sink of the kind.
+func newSink(c *conf.NotifySink) (s Sink, err error) {
+	var (
+		timeout = time.Duration(c.Timeout)
+		h       = &httpSink{}
+		u       = strings.TrimSuffix(c.Url, "/")
+	)
+	if timeout == 0 {
+		timeout = _timeout
+	}
+	h.client = &http.Client{Timeout: timeout}
+	switch c.Kind {
+	case "webhook":
+		h.url, h.ctype, h.body = c.Url, "application/json", webhookBody
+	case "nsq":
+		h.url, h.ctype, h.body = fmt.Sprintf(_nsqPubApi, u, url.QueryEscape(c.Topic)), "text/plain", nsqBody
+	case "kafka":
+		h.url, h.ctype, h.body = fmt.Sprintf(_kafkaPubApi, u, url.PathEscape(c.Topic)), _kafkaType, kafkaBody
+	default:
+		return nil, fmt.Errorf("notify: unknown sink %s", c.Kind)
+	}
+	return h, nil
+}
+
+// httpSink post the events in the body of the sink to the url, a 2xx is ok.
+type httpSink struct {
+	url    string
+	ctype  string
+	body   func(es []*Event) ([]byte, error)
+	client *http.Client
+}
+
+func (h *httpSink) Send(es []*Event) (err error) {
+	var (
+		body []byte
+		resp *http.Response
+	)
+	if body, err = h.body(es); err != nil {
+		return
+	}
+	if resp, err = h.client.Post(h.url, h.ctype, bytes.NewReader(body)); err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = fmt.Errorf("notify: %s status: %d", h.url, resp.StatusCode)
+	}
+	return
+}
+
+// webhookBody the json array of the events.
+func webhookBody(es []*Event) ([]byte, error) {
+	return json.Marshal(es)
+}
+
+// nsqBody an event json a line, the body of the nsqd mpub.
+func nsqBody(es []*Event) (body []byte, err error) {
+	var b []byte
+	for i, e := range es {
+		if b, err = json.Marshal(e); err != nil {
+			return
+		}
+		if i > 0 {
+			body = append(body, '\n')
+		}
+		body = append(body, b...)
+	}
+	return
+}
+
+// kafkaBody the records of the kafka rest proxy, keyed by the bucket and
+// the filename, the events of an object are in one partition.
+func kafkaBody(es []*Event) ([]byte, error) {
+	type record struct {
+		Key   string `json:"key"`
+		Value *Event `json:"value"`
+	}
+	var rs = struct {
+		Records []*record `json:"records"`
+	}{Records: make([]*record, 0, len(es))}
+	for _, e := range es {
+		rs.Records = append(rs.Records, &record{Key: e.Bucket + "/" + e.Filename, Value: e})
+	}
+	return json.Marshal(rs)
+}
@@ -2,17 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"time"
 
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"bfs/proxy/bfs"
 	"bfs/proxy/cache"
 	"bfs/proxy/conf"
+	"bfs/proxy/lru"
+	"bfs/proxy/notify"
 
-	log "github.com/golang/glog"
 	"golang.org/x/time/rate"
 )
 
@@ -20,20 +23,34 @@ const _mcMaxLength = 1024 * 1024 // memcache max value is 1MB
 
 // Service .
 type Service struct {
+	c         *conf.Config
 	cache     *cache.Cache
 	bfs       *bfs.Bfs
 	cacheChan chan func()
 	rl        *rate.Limiter
+	// read-through local cache of the hot files, nil disables
+	disk *lru.Cache
+	// the object events, nil publishes none
+	notify *notify.Notifier
 }
 
 // NewService new service
-func NewService(c *conf.Config) (s *Service) {
+func NewService(c *conf.Config) (s *Service, err error) {
 	s = &Service{
+		c:         c,
 		cache:     cache.New(c.Mc, time.Duration(c.ExpireMc)),
 		bfs:       bfs.New(c),
 		rl:        rate.NewLimiter(rate.Limit(c.Limit.Rate), c.Limit.Brust),
 		cacheChan: make(chan func(), 1024),
 	}
+	if c.DiskCache != nil {
+		if s.disk, err = lru.New(c.DiskCache.Dir, c.DiskCache.Size); err != nil {
+			return
+		}
+	}
+	if s.notify, err = notify.New(c); err != nil {
+		return
+	}
 	go s.cacheproc()
 	return
 }
@@ -53,65 +70,201 @@ func (s *Service) cacheproc() {
 }
 
 // Get get
-func (s *Service) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mtime int64, sha1, mine string, err error) {
-	var (
-		mf *meta.File
-		bs []byte
-	)
+func (s *Service) Get(bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	return s.GetContext(context.Background(), bucket, filename)
+}
+
+// GetContext get the file, the bfs requests are in the trace of ctx.
+func (s *Service) GetContext(ctx context.Context, bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	var bs []byte
 	if mf, err = s.cache.Meta(bucket, filename); err == nil && mf != nil {
 		if bs, err = s.cache.File(bucket, filename); err == nil && len(bs) > 0 {
-			mtime = mf.MTime
-			sha1 = mf.Sha1
-			mine = mf.Mine
 			ctlen = len(bs)
 			src = ioutil.NopCloser(bytes.NewReader(bs))
 			return
 		}
 	}
+	if s.disk != nil {
+		return s.diskGet(ctx, bucket, filename)
+	}
 	if !s.rl.Allow() {
 		err = errors.ErrServiceUnavailable
 		log.Errorf("service.bfs.Get.RateLimit(%s,%s),error(%v)", bucket, filename, err)
 		return
 	}
 	// get from bfs
-	if src, ctlen, mtime, sha1, mine, err = s.bfs.Get(bucket, filename); err != nil {
+	if src, ctlen, mf, err = s.bfs.Get(ctx, bucket, filename); err != nil {
 		log.Errorf("service.bfs.Get(%s,%s),error(%v)", bucket, filename, err)
 	}
 	return
 }
 
+// diskGet get the file through the disk cache, the cached file is valid if
+// its sha1 (the ETag) is the same as the directory one, else read again.
+func (s *Service) diskGet(ctx context.Context, bucket, filename string) (src io.ReadCloser, ctlen int, mf *meta.File, err error) {
+	var (
+		ok   bool
+		data []byte
+		cmf  *meta.File
+		res  *meta.Response
+		key  = bucket + "/" + filename
+	)
+	if res, mf, err = s.bfs.Stat(ctx, bucket, filename); err != nil {
+		log.Errorf("service.bfs.Stat(%s,%s),error(%v)", bucket, filename, err)
+		return
+	}
+	if data, cmf, ok = s.disk.Get(key); ok && mf.Sha1 != "" && cmf.Sha1 == mf.Sha1 {
+		src, ctlen = ioutil.NopCloser(bytes.NewReader(data)), len(data)
+		return
+	}
+	if !s.rl.Allow() {
+		err = errors.ErrServiceUnavailable
+		log.Errorf("service.bfs.Get.RateLimit(%s,%s),error(%v)", bucket, filename, err)
+		return
+	}
+	if src, ctlen, err = s.bfs.Read(ctx, res); err != nil {
+		log.Errorf("service.bfs.Read(%s,%s),error(%v)", bucket, filename, err)
+		return
+	}
+	if mf.Sha1 == "" || ctlen < 0 || int64(ctlen) > s.c.DiskCache.MaxFileSize {
+		return
+	}
+	data, err = ioutil.ReadAll(src)
+	src.Close()
+	if err != nil {
+		log.Errorf("ioutil.ReadAll(%s,%s) error(%v)", bucket, filename, err)
+		return
+	}
+	s.disk.Set(key, mf, data)
+	src, ctlen = ioutil.NopCloser(bytes.NewReader(data)), len(data)
+	return
+}
+
 // Upload upload
-func (s *Service) Upload(bucket, filename, mine, sha1 string, buf []byte) (err error) {
+func (s *Service) Upload(bucket, filename, name, mine, sha1 string, buf []byte) (err error) {
+	return s.UploadContext(context.Background(), bucket, filename, name, mine, sha1, buf)
+}
+
+// UploadContext upload the file, the bfs requests are in the trace of ctx.
+func (s *Service) UploadContext(ctx context.Context, bucket, filename, name, mine, sha1 string, buf []byte) (err error) {
 	var (
 		mtime = time.Now().UnixNano()
 		mf    *meta.File
 	)
-	if err = s.bfs.Upload(bucket, filename, mine, sha1, mtime, buf); err != nil && err != errors.ErrNeedleExist {
+	if err = s.bfs.Upload(ctx, bucket, filename, name, mine, sha1, mtime, buf); err != nil && err != errors.ErrNeedleExist {
 		log.Errorf("service.bfs.Upload(%s,%s),error(%s)", bucket, filename, err)
 		return
 	}
+	// the same file uploaded again is not created
+	if err == nil {
+		s.notify.Publish(&notify.Event{Type: notify.ObjectCreated, Bucket: bucket, Filename: filename, Sha1: sha1, Mine: mine, Size: int64(len(buf)), Time: mtime})
+	}
 	mf = &meta.File{
 		MTime: mtime,
 		Sha1:  sha1,
 		Mine:  mine,
+		Name:  name,
+		Size:  int64(len(buf)),
 	}
 	if len(buf) < _mcMaxLength {
-		s.addCache(func() {
-			s.cache.SetMeta(bucket, filename, mf)
-			s.cache.SetFile(bucket, filename, buf)
-		})
+		s.cacheFile(bucket, filename, mf, buf)
+	}
+	return
+}
+
+// Uploads upload the files in one batch, every file has its own result.
+func (s *Service) Uploads(bucket string, fs []*bfs.File) (err error) {
+	return s.UploadsContext(context.Background(), bucket, fs)
+}
+
+// UploadsContext upload the files in one batch, the bfs requests are in the
+// trace of ctx.
+func (s *Service) UploadsContext(ctx context.Context, bucket string, fs []*bfs.File) (err error) {
+	var (
+		f     *bfs.File
+		mtime = time.Now().UnixNano()
+	)
+	for _, f = range fs {
+		f.MTime = mtime
+	}
+	if err = s.bfs.Uploads(ctx, bucket, fs); err != nil {
+		log.Errorf("service.bfs.Uploads(%s) error(%v)", bucket, err)
+		return
+	}
+	for _, f = range fs {
+		if f.Err == nil {
+			s.notify.Publish(&notify.Event{Type: notify.ObjectCreated, Bucket: bucket, Filename: f.Filename, Sha1: f.Sha1, Mine: f.Mine, Size: int64(len(f.Data)), Time: f.MTime})
+		}
+		if (f.Err != nil && f.Err != errors.ErrNeedleExist) || len(f.Data) >= _mcMaxLength {
+			continue
+		}
+		s.cacheFile(bucket, f.Filename, &meta.File{MTime: f.MTime, Sha1: f.Sha1, Mine: f.Mine, Name: f.Name, Size: int64(len(f.Data))}, f.Data)
 	}
 	return
 }
 
+// cacheFile cache the meta and data of the uploaded file.
+func (s *Service) cacheFile(bucket, filename string, mf *meta.File, buf []byte) {
+	s.addCache(func() {
+		s.cache.SetMeta(bucket, filename, mf)
+		s.cache.SetFile(bucket, filename, buf)
+	})
+}
+
 // Delete delete
 func (s *Service) Delete(bucket, filename string) (err error) {
-	if err = s.bfs.Delete(bucket, filename); err != nil {
+	return s.DeleteContext(context.Background(), bucket, filename)
+}
+
+// DeleteContext delete the file, the bfs requests are in the trace of ctx.
+func (s *Service) DeleteContext(ctx context.Context, bucket, filename string) (err error) {
+	if err = s.bfs.Delete(ctx, bucket, filename); err != nil {
 		log.Errorf("service.bfs.Delete(%s,%s),error(%v)", bucket, filename, err)
 		return
 	}
+	s.notify.Publish(&notify.Event{Type: notify.ObjectDeleted, Bucket: bucket, Filename: filename})
 	s.cache.DelMeta(bucket, filename)
 	s.cache.DelFile(bucket, filename)
+	if s.disk != nil {
+		s.disk.Del(bucket + "/" + filename)
+	}
+	return
+}
+
+// Alias put the alias of the file, the cached one of the alias dropped.
+func (s *Service) Alias(bucket, filename, alias string) (err error) {
+	return s.AliasContext(context.Background(), bucket, filename, alias)
+}
+
+// AliasContext put the alias of the file, the bfs requests are in the trace
+// of ctx.
+func (s *Service) AliasContext(ctx context.Context, bucket, filename, alias string) (err error) {
+	if err = s.bfs.Alias(ctx, bucket, filename, alias); err != nil {
+		log.Errorf("service.bfs.Alias(%s,%s,%s),error(%v)", bucket, filename, alias, err)
+		return
+	}
+	s.notify.Publish(&notify.Event{Type: notify.ObjectCreated, Bucket: bucket, Filename: alias})
+	s.cache.DelMeta(bucket, alias)
+	s.cache.DelFile(bucket, alias)
+	if s.disk != nil {
+		s.disk.Del(bucket + "/" + alias)
+	}
+	return
+}
+
+// Stat get the meta of the file from the directory.
+func (s *Service) Stat(bucket, filename string) (mf *meta.File, err error) {
+	if _, mf, err = s.bfs.Stat(context.Background(), bucket, filename); err != nil && err != errors.ErrNeedleNotExist {
+		log.Errorf("service.bfs.Stat(%s,%s),error(%v)", bucket, filename, err)
+	}
+	return
+}
+
+// List list the files of the bucket by the prefix.
+func (s *Service) List(bucket, prefix, delimiter, marker string, limit int) (l *meta.List, err error) {
+	if l, err = s.bfs.List(context.Background(), bucket, prefix, delimiter, marker, limit); err != nil {
+		log.Errorf("service.bfs.List(%s,%s),error(%v)", bucket, prefix, err)
+	}
 	return
 }
 
@@ -123,3 +276,19 @@ func (s *Service) Ping() (err error) {
 	err = s.cache.Ping()
 	return
 }
+
+// Ready check the directory is ready.
+func (s *Service) Ready() error {
+	return s.bfs.Ready(context.Background())
+}
+
+// Debt the repair debt of the uploads acked before written to all the
+// replicas.
+func (s *Service) Debt() *bfs.Debt {
+	return s.bfs.Debt()
+}
+
+// Notify the counters of the object events, nil if not configured.
+func (s *Service) Notify() *notify.Stat {
+	return s.notify.Stat()
+}
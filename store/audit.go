@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bfs/libs/audit"
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/reqid"
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	_auditUpload = "upload"
+	_auditDel    = "del"
+	// the records of a query, by default and at most
+	_auditLimit    = 100
+	_auditMaxLimit = 10000
+)
+
+// auditRecord a needle mutation, a json line of the audit file.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Op        string    `json:"op"`
+	Vid       int32     `json:"vid"`
+	Key       int64     `json:"key"`
+	Size      int32     `json:"size,omitempty"`
+	AccessKey string    `json:"access_key,omitempty"`
+	IP        string    `json:"ip"`
+	Ret       int       `json:"ret"`
+	RequestId string    `json:"request_id,omitempty"`
+}
+
+// auditLog the append-only audit trail of the writes and the deletes of the
+// needles, with who made them, the access key and the client ip passed by
+// the proxy. the file is reopened on SIGHUP, so it can be rotated and
+// shipped by the log tools. a nil auditLog records nothing.
+type auditLog struct {
+	file string
+	lock sync.Mutex
+	f    *os.File
+}
+
+// newAuditLog new an audit log appended to the file, nil if no file.
+func newAuditLog(file string) (a *auditLog, err error) {
+	if file == "" {
+		return
+	}
+	a = &auditLog{file: file}
+	err = a.reopen()
+	return
+}
+
+// reopen reopen the file, e.g. after it's rotated.
+func (a *auditLog) reopen() (err error) {
+	var f *os.File
+	if a == nil {
+		return
+	}
+	if f, err = os.OpenFile(a.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664); err != nil {
+		log.Errorf("os.OpenFile(\"%s\") error(%v)", a.file, err)
+		return
+	}
+	a.lock.Lock()
+	if a.f != nil {
+		a.f.Close()
+	}
+	a.f = f
+	a.lock.Unlock()
+	return
+}
+
+// add append the mutation of the needle by the request, err is its result.
+func (a *auditLog) add(r *http.Request, op string, vid, key, size int64, err error) {
+	var (
+		raw  []byte
+		err1 error
+		c    *audit.Client
+		rec  *auditRecord
+	)
+	if a == nil {
+		return
+	}
+	c = audit.FromRequest(r)
+	rec = &auditRecord{Time: time.Now(), Op: op, Vid: int32(vid), Key: key, Size: int32(size),
+		AccessKey: c.Key, IP: c.IP, Ret: errors.RetOK, RequestId: reqid.FromContext(r.Context())}
+	if err != nil {
+		rec.Ret = errors.From(err).Info().Ret
+	}
+	if raw, err1 = json.Marshal(rec); err1 != nil {
+		log.Errorf("json.Marshal() error(%v)", err1)
+		return
+	}
+	raw = append(raw, '\n')
+	a.lock.Lock()
+	if _, err1 = a.f.Write(raw); err1 != nil {
+		log.Errorf("f.Write(\"%s\") error(%v)", a.file, err1)
+	}
+	a.lock.Unlock()
+}
+
+// query get the latest limit records matched since the time, the oldest
+// first, only the current file is read.
+func (a *auditLog) query(since time.Time, limit int, match func(*auditRecord) bool) (rs []*auditRecord, err error) {
+	var (
+		f   *os.File
+		sc  *bufio.Scanner
+		rec *auditRecord
+	)
+	if f, err = os.Open(a.file); err != nil {
+		log.Errorf("os.Open(\"%s\") error(%v)", a.file, err)
+		return
+	}
+	defer f.Close()
+	sc = bufio.NewScanner(f)
+	for sc.Scan() {
+		rec = new(auditRecord)
+		if err = json.Unmarshal(sc.Bytes(), rec); err != nil {
+			// the last line may be torn by a crash
+			log.Warningf("audit: \"%s\" bad line(%s) error(%v)", a.file, sc.Bytes(), err)
+			err = nil
+			continue
+		}
+		if rec.Time.Before(since) || !match(rec) {
+			continue
+		}
+		if rs = append(rs, rec); len(rs) > limit {
+			rs = rs[1:]
+		}
+	}
+	if err = sc.Err(); err != nil {
+		log.Errorf("audit: \"%s\" scan error(%v)", a.file, err)
+	}
+	return
+}
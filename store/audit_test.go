@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bfs/libs/audit"
+	"bfs/libs/errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	var (
+		a    *auditLog
+		err  error
+		rs   []*auditRecord
+		r    *http.Request
+		file = "./test/audit.log"
+		all  = func(*auditRecord) bool { return true }
+	)
+	os.Remove(file)
+	defer os.Remove(file)
+	if a, err = newAuditLog(""); err != nil || a != nil {
+		t.Errorf("newAuditLog() error(%v)", err)
+		t.FailNow()
+	}
+	r, _ = http.NewRequest("POST", "http://127.0.0.1:6062/upload", nil)
+	r.RemoteAddr = "10.0.0.1:52100"
+	// disabled
+	a.add(r, _auditUpload, 1, 1, 1024, nil)
+	if a, err = newAuditLog(file); err != nil {
+		t.Errorf("newAuditLog() error(%v)", err)
+		t.FailNow()
+	}
+	defer a.f.Close()
+	a.add(r, _auditUpload, 1, 1, 1024, nil)
+	r.Header.Set(audit.HeaderKey, "221bce6492eba70f")
+	r.Header.Set(audit.HeaderIP, "192.168.1.2")
+	a.add(r, _auditDel, 1, 2, 0, errors.ErrNeedleNotExist)
+	// rotated
+	if err = a.reopen(); err != nil {
+		t.Errorf("reopen() error(%v)", err)
+		t.FailNow()
+	}
+	a.add(r, _auditDel, 2, 1, 0, nil)
+	if rs, err = a.query(time.Time{}, 10, all); err != nil || len(rs) != 3 {
+		t.Errorf("query() error(%v) records: %d", err, len(rs))
+		t.FailNow()
+	}
+	if rs[0].IP != "10.0.0.1" || rs[0].AccessKey != "" || rs[0].Size != 1024 || rs[0].Ret != errors.RetOK {
+		t.Errorf("record: %+v not match", rs[0])
+		t.FailNow()
+	}
+	if rs[1].IP != "192.168.1.2" || rs[1].AccessKey != "221bce6492eba70f" || rs[1].Ret != errors.RetNeedleNotExist {
+		t.Errorf("record: %+v not match", rs[1])
+		t.FailNow()
+	}
+	// the latest of the key
+	if rs, err = a.query(time.Time{}, 1, func(rec *auditRecord) bool { return rec.Key == 1 }); err != nil || len(rs) != 1 || rs[0].Vid != 2 {
+		t.Errorf("query() error(%v) records: %d", err, len(rs))
+		t.FailNow()
+	}
+	if rs, err = a.query(time.Now().Add(time.Minute), 10, all); err != nil || len(rs) != 0 {
+		t.Errorf("query() error(%v) records: %d", err, len(rs))
+		t.FailNow()
+	}
+}
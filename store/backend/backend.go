@@ -0,0 +1,86 @@
+// Package backend abstracts the file io of the super blocks and the indexes,
+// the local files by default, other backends, e.g. the raw block devices or
+// a network block store, are registered by name and chosen by the config,
+// the needle and the cache logic above is not affected.
+package backend
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// the default backend, the local files
+	Default = "file"
+)
+
+const (
+	// the access pattern advices of the page cache
+	AdviseNormal = iota
+	AdviseSequential
+	AdviseRandom
+	AdviseDontNeed
+)
+
+// File a super block or an index file of a backend, the hints, Allocate,
+// SyncRange, Datasync and Advise, may be no-ops of the backends without
+// them.
+type File interface {
+	io.Reader
+	io.Writer
+	io.ReaderAt
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	// Size get the size of the file.
+	Size() (int64, error)
+	Truncate(size int64) error
+	// Sync commit the data and the metadata.
+	Sync() error
+	// Allocate reserve the space of the size, the file size is kept.
+	Allocate(size int64) error
+	// SyncRange start the write back of the range without waiting.
+	SyncRange(offset, size int64) error
+	// Datasync commit the data.
+	Datasync() error
+	// Advise advise the access pattern of the range, 0 size to the end.
+	Advise(offset, size int64, advice int) error
+}
+
+// Backend the files of the super blocks and the indexes.
+type Backend interface {
+	// Open open the file by the os.O_* flags.
+	Open(name string, flag int) (File, error)
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Exist(name string) bool
+}
+
+var (
+	lock     sync.RWMutex
+	backends = map[string]Backend{Default: Local}
+)
+
+// Register register the backend by name, e.g. in the init of its package,
+// the registered one of the name is replaced.
+func Register(name string, b Backend) {
+	lock.Lock()
+	backends[name] = b
+	lock.Unlock()
+}
+
+// Get get the backend of the name, the default if empty.
+func Get(name string) (b Backend, err error) {
+	var ok bool
+	if name == "" {
+		name = Default
+	}
+	lock.RLock()
+	b, ok = backends[name]
+	lock.RUnlock()
+	if !ok {
+		err = fmt.Errorf("backend: %s not registered", name)
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	var (
+		err  error
+		b    Backend
+		f    File
+		size int64
+		dir  = t.TempDir()
+		file = filepath.Join(dir, "1")
+		buf  = make([]byte, 5)
+	)
+	if b, err = Get(""); err != nil || b != Local {
+		t.Errorf("Get(\"\") error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = Get("none"); err == nil {
+		t.Errorf("Get(none) expect error")
+		t.FailNow()
+	}
+	if f, err = b.Open(file, os.O_RDWR|os.O_CREATE); err != nil {
+		t.Errorf("Open() error(%v)", err)
+		t.FailNow()
+	}
+	if err = f.Allocate(1024); err != nil {
+		t.Errorf("Allocate() error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = f.Write([]byte("hello")); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	if err = f.SyncRange(0, 5); err != nil {
+		t.Errorf("SyncRange() error(%v)", err)
+		t.FailNow()
+	}
+	if err = f.Datasync(); err != nil {
+		t.Errorf("Datasync() error(%v)", err)
+		t.FailNow()
+	}
+	if err = f.Advise(0, 5, AdviseDontNeed); err != nil {
+		t.Errorf("Advise() error(%v)", err)
+		t.FailNow()
+	}
+	// the allocated space is not in the size
+	if size, err = f.Size(); err != nil || size != 5 {
+		t.Errorf("Size() = %d error(%v)", size, err)
+		t.FailNow()
+	}
+	if _, err = f.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, []byte("hello")) {
+		t.Errorf("ReadAt() = %s error(%v)", buf, err)
+		t.FailNow()
+	}
+	f.Close()
+	if err = b.Rename(file, file+"_"); err != nil || b.Exist(file) || !b.Exist(file+"_") {
+		t.Errorf("Rename() error(%v)", err)
+		t.FailNow()
+	}
+	if err = b.Remove(file + "_"); err != nil || b.Exist(file+"_") {
+		t.Errorf("Remove() error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var (
+		err error
+		b   Backend
+	)
+	Register("test", Local)
+	if b, err = Get("test"); err != nil || b != Local {
+		t.Errorf("Get(test) error(%v)", err)
+		t.FailNow()
+	}
+}
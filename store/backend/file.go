@@ -0,0 +1,70 @@
+package backend
+
+import (
+	myos "bfs/store/os"
+	"os"
+)
+
+// Local the local files backend.
+var Local Backend = local{}
+
+type local struct{}
+
+// Open open the local file without updating the access time.
+func (local) Open(name string, flag int) (File, error) {
+	f, err := os.OpenFile(name, flag|myos.O_NOATIME, 0664)
+	if err != nil {
+		return nil, err
+	}
+	return file{f}, nil
+}
+
+func (local) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (local) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (local) Exist(name string) bool {
+	return myos.Exist(name)
+}
+
+// file a local file, the hints by the syscalls.
+type file struct {
+	*os.File
+}
+
+func (f file) Size() (size int64, err error) {
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	return
+}
+
+func (f file) Allocate(size int64) error {
+	return myos.Fallocate(f.Fd(), myos.FALLOC_FL_KEEP_SIZE, 0, size)
+}
+
+func (f file) SyncRange(offset, size int64) error {
+	return myos.Syncfilerange(f.Fd(), offset, size, myos.SYNC_FILE_RANGE_WRITE)
+}
+
+func (f file) Datasync() error {
+	return myos.Fdatasync(f.Fd())
+}
+
+func (f file) Advise(offset, size int64, advice int) error {
+	var advise = myos.POSIX_FADV_NORMAL
+	switch advice {
+	case AdviseSequential:
+		advise = myos.POSIX_FADV_SEQUENTIAL
+	case AdviseRandom:
+		advise = myos.POSIX_FADV_RANDOM
+	case AdviseDontNeed:
+		advise = myos.POSIX_FADV_DONTNEED
+	}
+	return myos.Fadvise(f.Fd(), offset, size, advise)
+}
@@ -2,12 +2,11 @@ package block
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/store/backend"
 	"bfs/store/conf"
 	"bfs/store/needle"
-	myos "bfs/store/os"
-	"bufio"
 	"bytes"
-	log "github.com/golang/glog"
 	"io"
 	"os"
 	"syscall"
@@ -40,6 +39,8 @@ const (
 	// offset aligned 8 bytes, 4GB * needle_padding_size
 	_maxSize   = 4 * 1024 * 1024 * 1024 * needle.PaddingSize
 	_maxOffset = 4294967295
+	// the default bytes of a scan pread
+	_scanBuffer = 32 * 1024 * 1024
 )
 
 var (
@@ -51,8 +52,9 @@ var (
 
 // An Volume contains one superblock and many needles.
 type SuperBlock struct {
-	r       *os.File
-	w       *os.File
+	r       backend.File
+	w       backend.File
+	be      backend.Backend
 	conf    *conf.Config
 	File    string `json:"file"`
 	Offset  uint32 `json:"offset"`
@@ -76,13 +78,17 @@ func NewSuperBlock(file string, c *conf.Config) (b *SuperBlock, err error) {
 	b.write = 0
 	b.syncOffset = 0
 	b.Padding = needle.PaddingSize
-	if b.w, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", file, err)
+	if b.be, err = backend.Get(c.Backend); err != nil {
+		log.Errorf("backend.Get(\"%s\") error(%v)", c.Backend, err)
+		return nil, err
+	}
+	if b.w, err = b.be.Open(file, os.O_WRONLY|os.O_CREATE); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", file, err)
 		b.Close()
 		return nil, err
 	}
-	if b.r, err = os.OpenFile(file, os.O_RDONLY|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", file, err)
+	if b.r, err = b.be.Open(file, os.O_RDONLY); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", file, err)
 		b.Close()
 		return nil, err
 	}
@@ -96,14 +102,13 @@ func NewSuperBlock(file string, c *conf.Config) (b *SuperBlock, err error) {
 
 // init init block file, add/parse meta info.
 func (b *SuperBlock) init() (err error) {
-	var stat os.FileInfo
-	if stat, err = b.r.Stat(); err != nil {
-		log.Errorf("block: %s Stat() error(%v)", b.File, err)
+	if b.Size, err = b.r.Size(); err != nil {
+		log.Errorf("block: %s Size() error(%v)", b.File, err)
 		return
 	}
-	if b.Size = stat.Size(); b.Size == 0 {
-		if err = myos.Fallocate(b.w.Fd(), myos.FALLOC_FL_KEEP_SIZE, 0, _maxSize); err != nil {
-			log.Errorf("block: %s Fallocate() error(%s)", b.File, err)
+	if b.Size == 0 {
+		if err = b.w.Allocate(_maxSize); err != nil {
+			log.Errorf("block: %s Allocate() error(%s)", b.File, err)
 			return
 		}
 		if err = b.writeMeta(); err != nil {
@@ -181,7 +186,6 @@ func (b *SuperBlock) Write(n *needle.Needle) (err error) {
 // flush flush writer buffer.
 func (b *SuperBlock) flush(force bool) (err error) {
 	var (
-		fd     uintptr
 		offset int64
 		size   int64
 	)
@@ -191,24 +195,23 @@ func (b *SuperBlock) flush(force bool) (err error) {
 	b.write = 0
 	offset = needle.BlockOffset(b.syncOffset)
 	size = needle.BlockOffset(b.Offset - b.syncOffset)
-	fd = b.w.Fd()
 	if b.conf.Block.Syncfilerange {
-		if err = myos.Syncfilerange(fd, offset, size, myos.SYNC_FILE_RANGE_WRITE); err != nil {
-			log.Errorf("block: %s Syncfilerange() error(%v)", b.File, err)
+		if err = b.w.SyncRange(offset, size); err != nil {
+			log.Errorf("block: %s SyncRange() error(%v)", b.File, err)
 			b.LastErr = err
 			return
 		}
 	} else {
-		if err = myos.Fdatasync(fd); err != nil {
-			log.Errorf("block: %s Fdatasync() error(%v)", b.File, err)
+		if err = b.w.Datasync(); err != nil {
+			log.Errorf("block: %s Datasync() error(%v)", b.File, err)
 			b.LastErr = err
 			return
 		}
 	}
-	if err = myos.Fadvise(fd, offset, size, myos.POSIX_FADV_DONTNEED); err == nil {
+	if err = b.w.Advise(offset, size, backend.AdviseDontNeed); err == nil {
 		b.syncOffset = b.Offset
 	} else {
-		log.Errorf("block: %s Fadvise() error(%v)", b.File, err)
+		log.Errorf("block: %s Advise() error(%v)", b.File, err)
 		b.LastErr = err
 	}
 	return
@@ -239,6 +242,29 @@ func (b *SuperBlock) ReadAt(n *needle.Needle) (err error) {
 	return
 }
 
+// FirstOffset get the offset of the first needle, after the header.
+func FirstOffset() uint32 {
+	return needle.NeedleOffset(_headerOffset)
+}
+
+// Stream copy the raw needles in [offset, end) to w, 0 offset is the first
+// needle, the needles must be written before end.
+func (b *SuperBlock) Stream(offset, end uint32, w io.Writer) (n int64, err error) {
+	var bso int64
+	if b.LastErr != nil {
+		return 0, b.LastErr
+	}
+	if offset == 0 {
+		offset = FirstOffset()
+	}
+	if offset > end {
+		return 0, errors.ErrSuperBlockOffset
+	}
+	bso = needle.BlockOffset(offset)
+	// pread, the concurrent reads and writes are not affected
+	return io.Copy(w, io.NewSectionReader(b.r, bso, needle.BlockOffset(end)-bso))
+}
+
 // Delete logical del a needls, only update the flag to it.
 func (b *SuperBlock) Delete(offset uint32) (err error) {
 	if b.LastErr != nil {
@@ -252,15 +278,29 @@ func (b *SuperBlock) Delete(offset uint32) (err error) {
 	return
 }
 
-// Scan scan a block file.
-func (b *SuperBlock) Scan(r *os.File, offset uint32, fn func(*needle.Needle, uint32, uint32) error) (err error) {
+// scanBuffer get the bytes of a scan pread, at least a max needle.
+func (b *SuperBlock) scanBuffer() (size int) {
+	if size = b.conf.Block.ScanBuffer; size == 0 {
+		size = _scanBuffer
+	}
+	if size < b.conf.Block.BufferSize {
+		size = b.conf.Block.BufferSize
+	}
+	return
+}
+
+// Scan scan a block file by the large preads, the needles are parsed from
+// the memory, the needle passed to fn is valid only in the call.
+func (b *SuperBlock) Scan(r backend.File, offset uint32, fn func(*needle.Needle, uint32, uint32) error) (err error) {
 	var (
-		so, eo uint32
-		bso    int64
-		fi     os.FileInfo
-		fd     = r.Fd()
-		n      = new(needle.Needle)
-		rd     = bufio.NewReaderSize(r, b.conf.Block.BufferSize)
+		so, eo   uint32
+		bso, ro  int64
+		pos, end int
+		rn       int
+		eof      bool
+		size     int64
+		n        = new(needle.Needle)
+		buf      = make([]byte, b.scanBuffer())
 	)
 	if offset == 0 {
 		offset = needle.NeedleOffset(_headerOffset)
@@ -268,24 +308,43 @@ func (b *SuperBlock) Scan(r *os.File, offset uint32, fn func(*needle.Needle, uin
 	so, eo = offset, offset
 	bso = needle.BlockOffset(so)
 	// advise sequential read
-	if fi, err = r.Stat(); err != nil {
-		log.Errorf("block: %s Stat() error(%v)", b.File)
+	if size, err = r.Size(); err != nil {
+		log.Errorf("block: %s Size() error(%v)", b.File, err)
 		return
 	}
-	if err = myos.Fadvise(fd, bso, fi.Size(), myos.POSIX_FADV_SEQUENTIAL); err != nil {
-		log.Errorf("block: %s Fadvise() error(%v)", b.File)
+	if err = r.Advise(bso, size, backend.AdviseSequential); err != nil {
+		log.Errorf("block: %s Advise() error(%v)", b.File, err)
 		return
 	}
 	log.Infof("scan block: %s from offset: %d", b.File, offset)
-	if _, err = r.Seek(bso, os.SEEK_SET); err != nil {
-		log.Errorf("block: %s Seek() error(%v)", b.File)
-		return
-	}
+	ro = bso
 	for {
-		if err = n.ParseFrom(rd); err != nil {
-			if err != io.EOF {
-				log.Errorf("block: parse needle from offset: %d:%d error(%v)", so, eo, err)
+		if err = n.ParseBytes(buf[pos:end]); err == io.ErrUnexpectedEOF {
+			// a partial needle left at the end of the block is discarded
+			if eof {
+				err = io.EOF
+				break
+			}
+			if pos == 0 && end == len(buf) {
+				log.Errorf("scan block: %s needle at offset: %d larger than the scan buffer", b.File, so)
+				err = errors.ErrNeedleSize
+				break
 			}
+			// move the partial needle ahead then read more
+			end = copy(buf, buf[pos:end])
+			pos = 0
+			rn, err = r.ReadAt(buf[end:], ro)
+			if err != nil && err != io.EOF {
+				log.Errorf("block: %s ReadAt() error(%v)", b.File, err)
+				break
+			}
+			eof = err == io.EOF
+			end += rn
+			ro += int64(rn)
+			continue
+		}
+		if err != nil {
+			log.Errorf("block: parse needle from offset: %d:%d error(%v)", so, eo, err)
 			break
 		}
 		if n.TotalSize > int32(b.conf.BlockMaxSize) {
@@ -301,12 +360,13 @@ func (b *SuperBlock) Scan(r *os.File, offset uint32, fn func(*needle.Needle, uin
 			log.Errorf("block: callback from offset: %d:%d error(%v)", so, eo, err)
 			break
 		}
+		pos += int(n.TotalSize)
 		so = eo
 	}
 	if err == io.EOF {
 		// advise no need page cache
-		if err = myos.Fadvise(fd, bso, needle.BlockOffset(eo-so), myos.POSIX_FADV_DONTNEED); err != nil {
-			log.Errorf("block: %s Fadvise() error(%v)", b.File)
+		if err = r.Advise(bso, needle.BlockOffset(eo-so), backend.AdviseDontNeed); err != nil {
+			log.Errorf("block: %s Advise() error(%v)", b.File, err)
 			return
 		}
 		log.Infof("scan block: %s to offset: %d [ok]", b.File, eo)
@@ -337,8 +397,8 @@ func (b *SuperBlock) Recovery(offset uint32, fn func(*needle.Needle, uint32, uin
 	// POSIX_FADV_RANDOM disables file readahead entirely.
 	// These changes affect the entire file, not just the specified region
 	// (but other open file handles to the same file are unaffected).
-	if err = myos.Fadvise(b.r.Fd(), 0, 0, myos.POSIX_FADV_RANDOM); err != nil {
-		log.Errorf("block: %s Fadvise() error(%v)", b.File)
+	if err = b.r.Advise(0, 0, backend.AdviseRandom); err != nil {
+		log.Errorf("block: %s Advise() error(%v)", b.File, err)
 		return
 	}
 	rsize = needle.BlockOffset(b.Offset)
@@ -365,9 +425,9 @@ func (b *SuperBlock) Compact(offset uint32, fn func(*needle.Needle, uint32, uint
 	if b.LastErr != nil {
 		return b.LastErr
 	}
-	var r *os.File
-	if r, err = os.OpenFile(b.File, os.O_RDONLY|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", b.File, err)
+	var r backend.File
+	if r, err = b.be.Open(b.File, os.O_RDONLY); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", b.File, err)
 		return
 	}
 	if err = b.Scan(r, offset, func(n *needle.Needle, so, eo uint32) error {
@@ -387,12 +447,12 @@ func (b *SuperBlock) Open() (err error) {
 	if !b.closed {
 		return
 	}
-	if b.w, err = os.OpenFile(b.File, os.O_WRONLY|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", b.File, err)
+	if b.w, err = b.be.Open(b.File, os.O_WRONLY); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", b.File, err)
 		return
 	}
-	if b.r, err = os.OpenFile(b.File, os.O_RDONLY|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", b.File, err)
+	if b.r, err = b.be.Open(b.File, os.O_RDONLY); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", b.File, err)
 		b.Close()
 		return
 	}
@@ -436,6 +496,6 @@ func (b *SuperBlock) Destroy() {
 	if !b.closed {
 		b.Close()
 	}
-	os.Remove(b.File)
+	b.be.Remove(b.File)
 	return
 }
@@ -3,6 +3,7 @@ package block
 import (
 	"bfs/store/conf"
 	"bfs/store/needle"
+	"bufio"
 	"bytes"
 	"fmt"
 	"os"
@@ -305,6 +306,127 @@ func TestSuperBlock(t *testing.T) {
 	}
 }
 
+func TestSuperBlockStream(t *testing.T) {
+	var (
+		i, mid int
+		b      *SuperBlock
+		n      *needle.Needle
+		end    uint32
+		err    error
+		rd     *bufio.Reader
+		out    = &bytes.Buffer{}
+		file   = "../test/test_stream.block"
+	)
+	os.Remove(file)
+	defer os.Remove(file)
+	if b, err = NewSuperBlock(file, testConf); err != nil {
+		t.Errorf("NewSuperBlock(\"%s\") error(%v)", file, err)
+		t.FailNow()
+	}
+	defer b.Close()
+	for i = 1; i <= 4; i++ {
+		n = needle.NewWriter(int64(i), int32(i), 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = b.Write(n); err != nil {
+			t.Errorf("b.Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+		if i == 2 {
+			end = b.Offset
+		}
+	}
+	// from the first needle, then catch up from the end
+	if _, err = b.Stream(0, end, out); err != nil {
+		t.Errorf("b.Stream() error(%v)", err)
+		t.FailNow()
+	}
+	mid = out.Len()
+	if _, err = b.Stream(end, b.Offset, out); err != nil {
+		t.Errorf("b.Stream() error(%v)", err)
+		t.FailNow()
+	}
+	if int64(out.Len()) != needle.BlockOffset(b.Offset-FirstOffset()) || mid*2 != out.Len() {
+		t.Errorf("b.Stream() got: %d bytes", out.Len())
+		t.FailNow()
+	}
+	rd = bufio.NewReader(out)
+	n = new(needle.Needle)
+	for i = 1; i <= 4; i++ {
+		if err = n.ParseFrom(rd); err != nil || n.Key != int64(i) || string(n.Data) != "test" {
+			t.Errorf("ParseFrom() got: %v error(%v)", n, err)
+			t.FailNow()
+		}
+	}
+	if _, err = b.Stream(b.Offset+1, b.Offset, out); err == nil {
+		t.Errorf("b.Stream() past the end no error")
+		t.FailNow()
+	}
+}
+
+func TestSuperBlockScan(t *testing.T) {
+	var (
+		i     int
+		b     *SuperBlock
+		n     *needle.Needle
+		f     *os.File
+		err   error
+		keys  []int64
+		data  = bytes.Repeat([]byte("t"), 40)
+		file  = "../test/test_scan.block"
+		c     = *testConf
+		bc    = *testConf.Block
+		parse = func(n *needle.Needle, so, eo uint32) error {
+			if !bytes.Equal(n.Data, data[:n.Key]) {
+				return fmt.Errorf("needle: %d data: %s not match", n.Key, n.Data)
+			}
+			keys = append(keys, n.Key)
+			return nil
+		}
+	)
+	// a small scan buffer, the needles span the preads
+	c.NeedleMaxSize = 64
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	bc.BufferSize = needle.Size(c.NeedleMaxSize)
+	bc.ScanBuffer = 100
+	c.Block = &bc
+	os.Remove(file)
+	defer os.Remove(file)
+	if b, err = NewSuperBlock(file, &c); err != nil {
+		t.Errorf("NewSuperBlock(\"%s\") error(%v)", file, err)
+		t.FailNow()
+	}
+	defer b.Close()
+	for i = 1; i <= 40; i++ {
+		n = needle.NewWriter(int64(i), 1, int32(i))
+		n.ReadFrom(bytes.NewReader(data[:i]))
+		if err = b.Write(n); err != nil {
+			t.Errorf("b.Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	if err = b.flush(true); err != nil {
+		t.Errorf("b.flush() error(%v)", err)
+		t.FailNow()
+	}
+	// a partial needle left at the end is discarded
+	if f, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0664); err != nil {
+		t.Errorf("os.OpenFile() error(%v)", err)
+		t.FailNow()
+	}
+	f.Write(bytes.Repeat([]byte{0x12, 0x34, 0x56, 0x78}, 4))
+	f.Close()
+	if err = b.Scan(b.r, 0, parse); err != nil {
+		t.Errorf("b.Scan() error(%v)", err)
+		t.FailNow()
+	}
+	if len(keys) != 40 || keys[0] != 1 || keys[39] != 40 {
+		t.Errorf("b.Scan() got keys: %v", keys)
+		t.FailNow()
+	}
+}
+
 func compareTestNeedle(t *testing.T, key int64, cookie int32, flag byte, n *needle.Needle, data []byte) (err error) {
 	if !bytes.Equal(n.Data, data) {
 		err = fmt.Errorf("data: %s not match", n.Data)
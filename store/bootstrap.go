@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/store/conf"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	registerAPI = "http://%s/register"
+)
+
+var (
+	_registerClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// register get the rack, serverid and volumes assignment from the saved
+// file or the directory, then fill the zookeeper config, nil if the store
+// not bootstrap by directory.
+func register(c *conf.Config) (r *meta.Register, err error) {
+	var (
+		data   []byte
+		params = url.Values{}
+		resp   *http.Response
+		uri    string
+	)
+	if c.Bootstrap == nil || c.Zookeeper.Rack != "" {
+		return
+	}
+	r = new(meta.Register)
+	if data, err = ioutil.ReadFile(c.Bootstrap.File); err == nil {
+		if err = json.Unmarshal(data, r); err != nil {
+			log.Errorf("json.Unmarshal(\"%s\") error(%v)", data, err)
+			return
+		}
+		c.Zookeeper.Rack, c.Zookeeper.ServerId = r.Rack, r.Id
+		log.Infof("store registered, rack: %s, serverid: %s", r.Rack, r.Id)
+		return
+	} else if !os.IsNotExist(err) {
+		log.Errorf("ioutil.ReadFile(\"%s\") error(%v)", c.Bootstrap.File, err)
+		return
+	}
+	uri = fmt.Sprintf(registerAPI, c.Bootstrap.Directory)
+	params.Set("id", c.Zookeeper.ServerId)
+	params.Set("zone", c.Zookeeper.Zone)
+	if resp, err = _registerClient.PostForm(uri, params); err != nil {
+		log.Errorf("http.PostForm(\"%s\") error(%v)", uri, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("http.PostForm(\"%s\") status: %d", uri, resp.StatusCode)
+		err = errors.ErrInternal
+		return
+	}
+	if data, err = ioutil.ReadAll(resp.Body); err != nil {
+		log.Errorf("ioutil.ReadAll() error(%v)", err)
+		return
+	}
+	if err = json.Unmarshal(data, r); err != nil {
+		log.Errorf("json.Unmarshal(\"%s\") error(%v)", data, err)
+		return
+	}
+	if r.Ret != errors.RetOK {
+		err = errors.Error(r.Ret)
+		log.Errorf("register store error(%v)", err)
+		return
+	}
+	if err = ioutil.WriteFile(c.Bootstrap.File, data, 0664); err != nil {
+		log.Errorf("ioutil.WriteFile(\"%s\") error(%v)", c.Bootstrap.File, err)
+		return
+	}
+	c.Zookeeper.Rack, c.Zookeeper.ServerId = r.Rack, r.Id
+	log.Infof("store register, rack: %s, serverid: %s, group: %d", r.Rack, r.Id, r.Group)
+	return
+}
+
+// Bootstrap create the free volumes for a new store, then add the assigned
+// volumes which not exist.
+func (s *Store) Bootstrap(r *meta.Register) (err error) {
+	var (
+		n   int
+		vid int32
+		dir string
+	)
+	if len(s.FreeVolumes) == 0 && len(s.Volumes()) == 0 {
+		for _, dir = range s.conf.Bootstrap.Dirs {
+			if n, err = s.AddFreeVolume(r.FreeVolumes, dir, dir); err != nil {
+				log.Errorf("AddFreeVolume(%d, \"%s\") error(%v)", r.FreeVolumes, dir, err)
+				return
+			}
+			log.Infof("add %d free volumes in %s", n, dir)
+		}
+	}
+	for _, vid = range r.Volumes {
+		if s.Volume(vid) != nil {
+			continue
+		}
+		if _, err = s.AddVolume(vid); err != nil {
+			log.Errorf("AddVolume(%d) error(%v)", vid, err)
+			return
+		}
+		log.Infof("add volume: %d", vid)
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bfs/store/conf"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	var (
+		n   int
+		err error
+		c   = *testConf
+		zc  = *testConf.Zookeeper
+		ts  = httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, r *http.Request) {
+			n++
+			fmt.Fprintf(wr, `{"ret":1,"id":"%s","rack":"rack-b","group":1,"volumes":[1,2],"free_volumes":4}`, r.FormValue("id"))
+		}))
+		file = "./test/store.register"
+	)
+	defer ts.Close()
+	os.Remove(file)
+	defer os.Remove(file)
+	zc.Rack = ""
+	c.Zookeeper = &zc
+	c.Bootstrap = &conf.Bootstrap{
+		Directory: strings.TrimPrefix(ts.URL, "http://"),
+		File:      file,
+		Dirs:      []string{"./test"},
+	}
+	if _, err = register(&c); err != nil {
+		t.Errorf("register() error(%v)", err)
+		t.FailNow()
+	}
+	if c.Zookeeper.Rack != "rack-b" || c.Zookeeper.ServerId != "store-a" {
+		t.Errorf("register rack: %s, serverid: %s not match", c.Zookeeper.Rack, c.Zookeeper.ServerId)
+		t.FailNow()
+	}
+	// saved assignment reused
+	c.Zookeeper.Rack = ""
+	if r, err := register(&c); err != nil || len(r.Volumes) != 2 || r.FreeVolumes != 4 {
+		t.Errorf("register() error(%v)", err)
+		t.FailNow()
+	}
+	if n != 1 || c.Zookeeper.Rack != "rack-b" {
+		t.Errorf("register directory called: %d times", n)
+		t.FailNow()
+	}
+}
@@ -1,9 +1,16 @@
 package conf
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
+	xtime "bfs/libs/time"
+	"bfs/libs/trace"
+	"bfs/store/backend"
 	"bfs/store/needle"
 	"github.com/BurntSushi/toml"
 	"io/ioutil"
+	"math"
+	"net"
 	"os"
 	"time"
 )
@@ -14,10 +21,21 @@ type Config struct {
 	StatListen  string
 	ApiListen   string
 	AdminListen string
+	// the host or ip registered in zookeeper with the listen ports, e.g.
+	// behind a nat, empty uses the listen hosts, a local ip for the ones on
+	// all the interfaces
+	Advertise string
 
 	NeedleMaxSize int
 	BlockMaxSize  int
 	BatchMaxNum   int
+	// the deadline of an api request, none if zero
+	ApiTimeout Duration
+	// log the api requests slower than it, disabled if zero
+	SlowLog Duration
+	// the storage backend of the super blocks and the indexes registered by
+	// backend.Register, the local files if empty
+	Backend string
 
 	Store     *Store
 	Volume    *Volume
@@ -25,22 +43,56 @@ type Config struct {
 	Index     *Index
 	Limit     *Limit
 	Zookeeper *Zookeeper
+	Bootstrap *Bootstrap
+	// the windows of the compaction and the scrub, nil runs them any time
+	Schedule *Schedule
+	// the logging, nil keeps glog
+	Log *log.Config
+	// the tracing, nil exports no spans
+	Tracing *trace.Config
 }
 
 type Store struct {
 	VolumeIndex     string
 	FreeVolumeIndex string
+	// keep the per-minute stats of the last StatHistory, disabled if zero,
+	// appended to the StatHistoryFile if any to survive a restart
+	StatHistory     Duration
+	StatHistoryFile string
+	// append the writes and the deletes of the needles with who made them
+	// to it, disabled if empty
+	AuditFile string
 }
 
 type Volume struct {
 	SyncDelete      int
 	SyncDeleteDelay Duration
+	// compact the volumes automatically when the garbage ratio reaches it,
+	// one at a time, disabled if zero
+	CompactRatio float64
+	// the interval to check the garbage ratios
+	CompactCheck Duration
+	// count one of every WarmSample reads, the WarmKeys most read needles
+	// are read into the page cache when the volume is opened, disabled if
+	// zero
+	WarmSample int
+	WarmKeys   int
+	// record the access time of one of every AccessSample reads and all
+	// the writes, the needles not accessed for long are listed cold for the
+	// tiering, disabled if zero
+	AccessSample int
+	// the max bytes of a block without its own quota, the room left is for
+	// the compaction and the tombstones, no quota if zero
+	Quota int64
 }
 
 type Block struct {
 	BufferSize    int `toml:"-"`
 	SyncWrite     int
 	Syncfilerange bool
+	// the bytes of a pread when scanning a block for the recovery and the
+	// compact, at least BufferSize, 32MB if not set
+	ScanBuffer int
 }
 
 type Index struct {
@@ -50,16 +102,51 @@ type Index struct {
 	RingBuffer    int
 	SyncWrite     int
 	Syncfilerange bool
+	// write the indexes in zstd frames, the tail uncompressed
+	Compress bool
+	// the adaptive flush, the merged indexes are written once the oldest
+	// is FlushDelay old, or FlushBytes buffered, which signals the merge,
+	// 0 FlushDelay disables it. it replaces SyncWrite and MergeDelay, and
+	// MergeWrite if FlushBytes is set
+	FlushDelay Duration
+	FlushBytes int
 }
 
 type Zookeeper struct {
 	Root     string
 	Rack     string
+	Zone     string
+	Region   string
+	Labels   []string
 	ServerId string
 	Addrs    []string
 	Timeout  Duration
 }
 
+// Bootstrap register the store by directory when the Zookeeper.Rack is
+// empty, the assignment is saved into File and reused after restart.
+type Bootstrap struct {
+	Directory string   // directory api addr
+	File      string   // assignment file
+	Dirs      []string // data dirs of the free volumes
+}
+
+// Schedule the background jobs, the automatic compaction and the scrub, run
+// only in the windows, at most MaxJobs at the same time, their io capped by
+// Bandwidth, a job still running when a window closes is paused.
+type Schedule struct {
+	// like "Mon-Fri 01:00-06:00" or "* 22:00-06:00" of the local time, any
+	// time if empty
+	Windows []string
+	// the jobs at the same time, unlimited if zero
+	MaxJobs int
+	// the bytes per second read by the jobs, unlimited if zero
+	Bandwidth int
+	// read back and verify the checksums of the needles of every volume once
+	// per Scrub, disabled if zero
+	Scrub Duration
+}
+
 type Rate struct {
 	Rate  float64
 	Brust int
@@ -69,6 +156,8 @@ type Limit struct {
 	Read   *Rate
 	Write  *Rate
 	Delete *Rate
+	// the bytes per second of the volume streams, unlimited if nil
+	Stream *Rate
 }
 
 // Code to implement the TextUnmarshaler interface for `Duration`:
@@ -83,6 +172,10 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 // NewConfig new a config.
 func NewConfig(conf string) (c *Config, err error) {
 	var (
@@ -98,7 +191,147 @@ func NewConfig(conf string) (c *Config, err error) {
 	}
 	if err = toml.Unmarshal(blob, c); err == nil {
 		c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
-		c.Block.BufferSize = needle.Size(c.NeedleMaxSize)
+		if c.Block != nil {
+			c.Block.BufferSize = needle.Size(c.NeedleMaxSize)
+		}
 	}
 	return
 }
+
+// Check check the config values, directories and permissions, return all
+// the problems found.
+func (c *Config) Check() error {
+	var ck = check.New()
+	ck.Addr("StatListen", c.StatListen)
+	ck.Addr("ApiListen", c.ApiListen)
+	ck.Addr("AdminListen", c.AdminListen)
+	if c.Pprof {
+		ck.Addr("PprofListen", c.PprofListen)
+	}
+	if _, err := backend.Get(c.Backend); err != nil {
+		ck.Errorf("Backend: %v", err)
+	}
+	if _, _, err := net.SplitHostPort(c.Advertise); err == nil {
+		ck.Errorf("Advertise: \"%s\" must have no port", c.Advertise)
+	}
+	// needle size must fit the int32 needle header
+	ck.Range("NeedleMaxSize", int64(c.NeedleMaxSize), 1, math.MaxInt32-needle.HeaderSize-needle.FooterSize-needle.PaddingSize)
+	ck.Range("BatchMaxNum", int64(c.BatchMaxNum), 1, math.MaxInt16)
+	if c.ApiTimeout.Duration != 0 {
+		ck.Positive("ApiTimeout", c.ApiTimeout.Duration)
+	}
+	if c.SlowLog.Duration != 0 {
+		ck.Positive("SlowLog", c.SlowLog.Duration)
+	}
+	if ck.NotNil("Store", c.Store != nil) {
+		ck.File("Store.VolumeIndex", c.Store.VolumeIndex)
+		ck.File("Store.FreeVolumeIndex", c.Store.FreeVolumeIndex)
+		if c.Store.StatHistory.Duration != 0 {
+			ck.Positive("Store.StatHistory", c.Store.StatHistory.Duration)
+			if c.Store.StatHistoryFile != "" {
+				ck.File("Store.StatHistoryFile", c.Store.StatHistoryFile)
+			}
+		}
+	}
+	if ck.NotNil("Volume", c.Volume != nil) {
+		ck.Range("Volume.SyncDelete", int64(c.Volume.SyncDelete), 1, math.MaxInt32)
+		ck.Positive("Volume.SyncDeleteDelay", c.Volume.SyncDeleteDelay.Duration)
+		if c.Volume.CompactRatio != 0 {
+			if c.Volume.CompactRatio < 0 || c.Volume.CompactRatio > 1 {
+				ck.Errorf("Volume.CompactRatio: %f must be in (0, 1]", c.Volume.CompactRatio)
+			}
+			ck.Positive("Volume.CompactCheck", c.Volume.CompactCheck.Duration)
+		}
+		if c.Volume.WarmSample != 0 {
+			ck.Range("Volume.WarmSample", int64(c.Volume.WarmSample), 1, math.MaxInt32)
+			ck.Range("Volume.WarmKeys", int64(c.Volume.WarmKeys), 1, math.MaxInt32)
+		}
+		ck.Range("Volume.AccessSample", int64(c.Volume.AccessSample), 0, math.MaxInt32)
+		ck.Range("Volume.Quota", c.Volume.Quota, 0, needle.BlockOffset(math.MaxUint32))
+	}
+	if ck.NotNil("Block", c.Block != nil) {
+		ck.Range("Block.SyncWrite", int64(c.Block.SyncWrite), 1, math.MaxInt32)
+		ck.Range("Block.ScanBuffer", int64(c.Block.ScanBuffer), 0, math.MaxInt32)
+	}
+	if ck.NotNil("Index", c.Index != nil) {
+		// at least one index item(key+offset+size) must fit the buffer
+		ck.Range("Index.BufferSize", int64(c.Index.BufferSize), 16, math.MaxInt32)
+		ck.Range("Index.RingBuffer", int64(c.Index.RingBuffer), 1, math.MaxInt32)
+		// merge must be signaled before the ring is full
+		ck.Range("Index.MergeWrite", int64(c.Index.MergeWrite), 1, int64(c.Index.RingBuffer)-1)
+		ck.Range("Index.SyncWrite", int64(c.Index.SyncWrite), 1, math.MaxInt32)
+		ck.Positive("Index.MergeDelay", c.Index.MergeDelay.Duration)
+		if c.Index.FlushDelay.Duration != 0 {
+			ck.Positive("Index.FlushDelay", c.Index.FlushDelay.Duration)
+			// a full buffer is always written, the merge must be signaled
+			// before the ring(16 bytes an index) is full
+			max := int64(c.Index.BufferSize)
+			if ring := int64(c.Index.RingBuffer-1) * 16; ring < max {
+				max = ring
+			}
+			ck.Range("Index.FlushBytes", int64(c.Index.FlushBytes), 0, max)
+		} else if c.Index.FlushBytes != 0 {
+			ck.Errorf("Index.FlushBytes: needs Index.FlushDelay")
+		}
+	}
+	if ck.NotNil("Limit", c.Limit != nil) {
+		for i, r := range []*Rate{c.Limit.Read, c.Limit.Write, c.Limit.Delete} {
+			name := []string{"Limit.Read", "Limit.Write", "Limit.Delete"}[i]
+			if ck.NotNil(name, r != nil) {
+				if r.Rate <= 0 {
+					ck.Errorf("%s.Rate: %f must be positive", name, r.Rate)
+				}
+				ck.Range(name+".Brust", int64(r.Brust), 1, math.MaxInt32)
+			}
+		}
+		if r := c.Limit.Stream; r != nil {
+			if r.Rate <= 0 {
+				ck.Errorf("Limit.Stream.Rate: %f must be positive", r.Rate)
+			}
+			ck.Range("Limit.Stream.Brust", int64(r.Brust), 1, math.MaxInt32)
+		}
+	}
+	if ck.NotNil("Zookeeper", c.Zookeeper != nil) {
+		ck.NotEmpty("Zookeeper.Root", c.Zookeeper.Root)
+		// rack and serverid assigned by directory
+		if c.Bootstrap == nil {
+			ck.NotEmpty("Zookeeper.Rack", c.Zookeeper.Rack)
+			ck.NotEmpty("Zookeeper.ServerId", c.Zookeeper.ServerId)
+		}
+		ck.Addrs("Zookeeper.Addrs", c.Zookeeper.Addrs)
+		ck.Positive("Zookeeper.Timeout", c.Zookeeper.Timeout.Duration)
+	}
+	if c.Bootstrap != nil {
+		ck.Addr("Bootstrap.Directory", c.Bootstrap.Directory)
+		ck.File("Bootstrap.File", c.Bootstrap.File)
+		if len(c.Bootstrap.Dirs) == 0 {
+			ck.Errorf("Bootstrap.Dirs: must be set")
+		}
+		for _, dir := range c.Bootstrap.Dirs {
+			ck.Dir("Bootstrap.Dirs", dir)
+		}
+	}
+	if c.Schedule != nil {
+		for _, w := range c.Schedule.Windows {
+			if _, err := xtime.ParseWindow(w); err != nil {
+				ck.Errorf("Schedule.Windows: %v", err)
+			}
+		}
+		ck.Range("Schedule.MaxJobs", int64(c.Schedule.MaxJobs), 0, math.MaxInt32)
+		ck.Range("Schedule.Bandwidth", int64(c.Schedule.Bandwidth), 0, math.MaxInt32)
+		if c.Schedule.Scrub.Duration != 0 {
+			ck.Positive("Schedule.Scrub", c.Schedule.Scrub.Duration)
+		}
+	}
+	if c.Log != nil {
+		if err := c.Log.Check(); err != nil {
+			ck.Errorf("Log: %v", err)
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Check(); err != nil {
+			ck.Errorf("Tracing.%v", err)
+		}
+	}
+	return ck.Err()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bfs/libs/errors"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+var (
+	_indexColumns  = []string{"key", "offset", "size"}
+	_needleColumns = []string{"key", "cookie", "offset", "size", "total_size", "deleted", "checksum"}
+)
+
+// indexRow an index entry of the dump.
+type indexRow struct {
+	Key    int64  `json:"key"`
+	Offset uint32 `json:"offset"`
+	Size   int32  `json:"size"`
+}
+
+func (r *indexRow) columns() []string {
+	return []string{
+		strconv.FormatInt(r.Key, 10),
+		strconv.FormatUint(uint64(r.Offset), 10),
+		strconv.FormatInt(int64(r.Size), 10),
+	}
+}
+
+// needleRow a needle header of the dump.
+type needleRow struct {
+	Key       int64  `json:"key"`
+	Cookie    int32  `json:"cookie"`
+	Offset    uint32 `json:"offset"`
+	Size      int32  `json:"size"`
+	TotalSize int32  `json:"total_size"`
+	Deleted   bool   `json:"deleted"`
+	Checksum  uint32 `json:"checksum"`
+}
+
+func (r *needleRow) columns() []string {
+	return []string{
+		strconv.FormatInt(r.Key, 10),
+		strconv.FormatInt(int64(r.Cookie), 10),
+		strconv.FormatUint(uint64(r.Offset), 10),
+		strconv.FormatInt(int64(r.Size), 10),
+		strconv.FormatInt(int64(r.TotalSize), 10),
+		strconv.FormatBool(r.Deleted),
+		strconv.FormatUint(uint64(r.Checksum), 10),
+	}
+}
+
+type row interface {
+	columns() []string
+}
+
+// dumper write the rows as json lines or csv with a header line.
+type dumper struct {
+	enc *json.Encoder
+	cw  *csv.Writer
+}
+
+// newDumper new a dumper of the format, json or csv.
+func newDumper(w io.Writer, format string, header []string) (d *dumper, err error) {
+	d = &dumper{}
+	switch format {
+	case "", "json":
+		d.enc = json.NewEncoder(w)
+	case "csv":
+		d.cw = csv.NewWriter(w)
+		err = d.cw.Write(header)
+	default:
+		return nil, errors.ErrParam
+	}
+	return
+}
+
+// contentType get the content type of the format.
+func (d *dumper) contentType() string {
+	if d.cw != nil {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+func (d *dumper) write(r row) (err error) {
+	if d.cw != nil {
+		return d.cw.Write(r.columns())
+	}
+	return d.enc.Encode(r)
+}
+
+// flush flush the buffered csv rows.
+func (d *dumper) flush() (err error) {
+	if d.cw != nil {
+		d.cw.Flush()
+		err = d.cw.Error()
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDumper(t *testing.T) {
+	var (
+		d   *dumper
+		err error
+		buf = &bytes.Buffer{}
+	)
+	if d, err = newDumper(buf, "csv", _indexColumns); err != nil {
+		t.Errorf("newDumper() error(%v)", err)
+		t.FailNow()
+	}
+	d.write(&indexRow{Key: 1, Offset: 2, Size: 40})
+	if err = d.flush(); err != nil || buf.String() != "key,offset,size\n1,2,40\n" || d.contentType() != "text/csv" {
+		t.Errorf("csv got: %q error(%v)", buf.String(), err)
+		t.FailNow()
+	}
+	buf.Reset()
+	if d, err = newDumper(buf, "json", _needleColumns); err != nil {
+		t.Errorf("newDumper() error(%v)", err)
+		t.FailNow()
+	}
+	d.write(&needleRow{Key: 1, Cookie: 2, Offset: 3, Size: 4, TotalSize: 40, Deleted: true, Checksum: 5})
+	if err = d.flush(); err != nil || buf.String() != `{"key":1,"cookie":2,"offset":3,"size":4,"total_size":40,"deleted":true,"checksum":5}`+"\n" {
+		t.Errorf("json got: %q error(%v)", buf.String(), err)
+		t.FailNow()
+	}
+	if _, err = newDumper(buf, "xml", nil); err == nil {
+		t.Errorf("newDumper() unknown format no error")
+		t.FailNow()
+	}
+}
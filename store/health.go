@@ -0,0 +1,15 @@
+package main
+
+import (
+	"bfs/libs/health"
+)
+
+// newHealth the readiness of the store: the volumes recovered and not handed
+// over to an upgrade, zookeeper connected, and any volume writable.
+func newHealth(s *Store) (h *health.Health) {
+	h = health.New()
+	h.Add("recovery", s.Recovered)
+	h.Add("zookeeper", s.Ping)
+	h.Add("volumes", s.Writable)
+	return
+}
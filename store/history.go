@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/stat"
+	"bfs/store/volume"
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// the interval of a history point.
+	historyDuration = 1 * time.Minute
+)
+
+// historyLine a line of the history file, the points of a minute.
+type historyLine struct {
+	Time    int64                 `json:"time"`
+	Server  *stat.Point           `json:"server"`
+	Volumes map[int32]*stat.Point `json:"volumes"`
+}
+
+// history the per-minute points of the server and the volumes, the latest
+// points are kept in the memory and appended to the file if any, so the
+// stats before a crash are still known after the restart.
+type history struct {
+	n       int
+	lock    sync.RWMutex
+	server  *stat.History
+	volumes map[int32]*stat.History
+	// the totals at the last point
+	last     time.Time
+	lastSvr  stat.Stats
+	lastVols map[int32]stat.Stats
+	// the file, rewritten with the kept lines when doubled
+	file    string
+	f       *os.File
+	lines   [][]byte
+	written int
+}
+
+// newHistory new a history of the retention, the points of the file in
+// the retention are loaded.
+func newHistory(retention time.Duration, file string) (h *history, err error) {
+	h = &history{
+		n:        int(retention / historyDuration),
+		volumes:  make(map[int32]*stat.History),
+		lastVols: make(map[int32]stat.Stats),
+		file:     file,
+	}
+	if h.n < 1 {
+		h.n = 1
+	}
+	h.server = stat.NewHistory(h.n)
+	if file == "" {
+		return
+	}
+	if err = h.load(time.Now().Add(-retention).Unix()); err != nil {
+		return
+	}
+	err = h.rewrite()
+	return
+}
+
+// load load the lines of the file since the unix time.
+func (h *history) load(since int64) (err error) {
+	var (
+		f    *os.File
+		sc   *bufio.Scanner
+		line *historyLine
+	)
+	if f, err = os.Open(h.file); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			log.Errorf("os.Open(\"%s\") error(%v)", h.file, err)
+		}
+		return
+	}
+	defer f.Close()
+	sc = bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line = new(historyLine)
+		if err = json.Unmarshal(sc.Bytes(), line); err != nil {
+			// the last line may be torn by a crash
+			log.Warningf("history: \"%s\" bad line(%s) error(%v)", h.file, sc.Bytes(), err)
+			err = nil
+			continue
+		}
+		if line.Time < since {
+			continue
+		}
+		h.add(line, append([]byte(nil), sc.Bytes()...))
+	}
+	if err = sc.Err(); err != nil {
+		log.Errorf("history: \"%s\" scan error(%v)", h.file, err)
+	}
+	return
+}
+
+// rewrite rewrite the file with the kept lines, then append to it.
+func (h *history) rewrite() (err error) {
+	var (
+		f    *os.File
+		line []byte
+		tmp  = h.file + ".tmp"
+	)
+	if f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664); err != nil {
+		log.Errorf("os.OpenFile(\"%s\") error(%v)", tmp, err)
+		return
+	}
+	for _, line = range h.lines {
+		if _, err = f.Write(line); err != nil {
+			log.Errorf("f.Write(\"%s\") error(%v)", tmp, err)
+			f.Close()
+			return
+		}
+	}
+	if err = os.Rename(tmp, h.file); err != nil {
+		log.Errorf("os.Rename(\"%s\") error(%v)", tmp, err)
+		f.Close()
+		return
+	}
+	if h.f != nil {
+		h.f.Close()
+	}
+	h.f, h.written = f, len(h.lines)
+	return
+}
+
+// add add the points of the line, raw is the line in the file.
+func (h *history) add(line *historyLine, raw []byte) {
+	var (
+		ok  bool
+		vid int32
+		p   *stat.Point
+		vh  *stat.History
+	)
+	h.lock.Lock()
+	if line.Server != nil {
+		h.server.Add(line.Server)
+	}
+	for vid, p = range line.Volumes {
+		if p == nil {
+			continue
+		}
+		if vh, ok = h.volumes[vid]; !ok {
+			vh = stat.NewHistory(h.n)
+			h.volumes[vid] = vh
+		}
+		vh.Add(p)
+	}
+	h.lock.Unlock()
+	if h.file == "" {
+		return
+	}
+	if raw[len(raw)-1] != '\n' {
+		raw = append(raw, '\n')
+	}
+	if h.lines = append(h.lines, raw); len(h.lines) > h.n {
+		h.lines = h.lines[len(h.lines)-h.n:]
+	}
+}
+
+// sample add a point if a minute passed since the last one, the first
+// call only saves the totals.
+func (h *history) sample(now time.Time, svr *stat.Stats, volumes map[int32]*volume.Volume) {
+	var (
+		ok    bool
+		err   error
+		vid   int32
+		v     *volume.Volume
+		last  stat.Stats
+		raw   []byte
+		first = h.last.IsZero()
+		d     = now.Sub(h.last)
+		vols  = make(map[int32]stat.Stats, len(volumes))
+		line  = &historyLine{Time: now.Unix(), Volumes: make(map[int32]*stat.Point, len(volumes))}
+	)
+	if !first && d < historyDuration {
+		return
+	}
+	for vid, v = range volumes {
+		vols[vid] = *v.Stats
+		if last, ok = h.lastVols[vid]; ok && !first {
+			line.Volumes[vid] = stat.NewPoint(now, d, &last, v.Stats)
+		}
+	}
+	line.Server = stat.NewPoint(now, d, &h.lastSvr, svr)
+	h.last, h.lastSvr, h.lastVols = now, *svr, vols
+	if first {
+		return
+	}
+	if h.file != "" {
+		if raw, err = json.Marshal(line); err != nil {
+			log.Errorf("json.Marshal() error(%v)", err)
+			return
+		}
+		raw = append(raw, '\n')
+	}
+	h.add(line, raw)
+	if h.f == nil {
+		return
+	}
+	if _, err = h.f.Write(raw); err != nil {
+		log.Errorf("f.Write(\"%s\") error(%v)", h.file, err)
+	}
+	// keep the file at most twice the retention
+	if h.written++; h.written >= 2*h.n {
+		h.rewrite()
+	}
+}
+
+// points get the points of the server, or the volume if vid is not
+// negative, since the unix time, ok is false if the volume has no history.
+func (h *history) points(vid int32, since int64) (ps []*stat.Point, ok bool) {
+	var vh *stat.History
+	if vid < 0 {
+		return h.server.Points(since), true
+	}
+	h.lock.RLock()
+	vh, ok = h.volumes[vid]
+	h.lock.RUnlock()
+	if ok {
+		ps = vh.Points(since)
+	}
+	return
+}
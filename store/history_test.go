@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bfs/libs/stat"
+	"bfs/store/volume"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	var (
+		h    *history
+		err  error
+		ok   bool
+		ps   []*stat.Point
+		file = "./test/stat_history.log"
+		now  = time.Now()
+		s    = &stat.Stats{}
+		vs   = map[int32]*volume.Volume{1: {Stats: &stat.Stats{}}}
+	)
+	os.Remove(file)
+	defer os.Remove(file)
+	if h, err = newHistory(time.Hour, file); err != nil {
+		t.Errorf("newHistory() error(%v)", err)
+		t.FailNow()
+	}
+	h.sample(now, s, vs)
+	s.TotalGetProcessed, vs[1].Stats.TotalGetProcessed = 600, 600
+	// less than a minute
+	h.sample(now.Add(time.Second), s, vs)
+	h.sample(now.Add(time.Minute), s, vs)
+	if ps, _ = h.points(-1, 0); len(ps) != 1 || ps[0].GetQPS != 10 {
+		t.Errorf("server points: %d not match", len(ps))
+		t.FailNow()
+	}
+	h.f.Close()
+	// reload after a restart
+	if h, err = newHistory(time.Hour, file); err != nil {
+		t.Errorf("newHistory() error(%v)", err)
+		t.FailNow()
+	}
+	defer h.f.Close()
+	if ps, ok = h.points(1, 0); !ok || len(ps) != 1 || ps[0].GetQPS != 10 {
+		t.Errorf("volume points: %d not match", len(ps))
+		t.FailNow()
+	}
+	if _, ok = h.points(2, 0); ok {
+		t.Error("volume: 2 history exist")
+		t.FailNow()
+	}
+}
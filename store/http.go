@@ -2,10 +2,16 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/reqid"
+	"bfs/libs/slow"
 	"bfs/libs/stat"
+	"bfs/libs/trace"
+	"bfs/libs/upgrade"
 	"bfs/store/conf"
+	"context"
 	"encoding/json"
-	log "github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/time/rate"
 	"mime/multipart"
 	"net"
@@ -19,14 +25,25 @@ type Server struct {
 	store *Store
 	conf  *conf.Config
 	info  *stat.Info
+	// the per-minute stats, nil if disabled
+	history *history
+	// the slow requests, nil if disabled
+	slow *slow.Log
+	// the audit trail, nil if disabled
+	audit *auditLog
 	// server
-	statSvr  net.Listener
-	adminSvr net.Listener
-	apiSvr   net.Listener
+	statSvr   net.Listener
+	adminSvr  net.Listener
+	apiSvr    net.Listener
+	pprofSvr  net.Listener // nil if disabled
+	statHttp  *http.Server
+	adminHttp *http.Server
+	apiHttp   *http.Server
 	// limit
 	rl *rate.Limiter
 	wl *rate.Limiter
 	dl *rate.Limiter
+	sl *rate.Limiter // nil if unlimited
 }
 
 func NewServer(s *Store, c *conf.Config) (svr *Server, err error) {
@@ -36,28 +53,83 @@ func NewServer(s *Store, c *conf.Config) (svr *Server, err error) {
 		rl:    rate.NewLimiter(rate.Limit(c.Limit.Read.Rate), c.Limit.Read.Brust),
 		wl:    rate.NewLimiter(rate.Limit(c.Limit.Write.Rate), c.Limit.Write.Brust),
 		dl:    rate.NewLimiter(rate.Limit(c.Limit.Delete.Rate), c.Limit.Delete.Brust),
+		slow:  slow.New(c.SlowLog.Duration),
 	}
-	if svr.statSvr, err = net.Listen("tcp", c.StatListen); err != nil {
-		log.Errorf("net.Listen(%s) error(%v)", c.StatListen, err)
+	if c.Limit.Stream != nil {
+		svr.sl = rate.NewLimiter(rate.Limit(c.Limit.Stream.Rate), c.Limit.Stream.Brust)
+	}
+	if c.Store.StatHistory.Duration > 0 {
+		if svr.history, err = newHistory(c.Store.StatHistory.Duration, c.Store.StatHistoryFile); err != nil {
+			return
+		}
+	}
+	if svr.audit, err = newAuditLog(c.Store.AuditFile); err != nil {
+		return
+	}
+	// the sockets of the old process if upgraded
+	if svr.statSvr, err = upgrade.Listen(c.StatListen); err != nil {
 		return
 	}
-	if svr.apiSvr, err = net.Listen("tcp", c.ApiListen); err != nil {
-		log.Errorf("net.Listen(%s) error(%v)", c.ApiListen, err)
+	if svr.apiSvr, err = upgrade.Listen(c.ApiListen); err != nil {
 		return
 	}
-	if svr.adminSvr, err = net.Listen("tcp", c.AdminListen); err != nil {
-		log.Errorf("net.Listen(%s) error(%v)", c.AdminListen, err)
+	if svr.adminSvr, err = upgrade.Listen(c.AdminListen); err != nil {
 		return
 	}
-	go svr.startStat()
-	go svr.startApi()
-	go svr.startAdmin()
+	svr.startStat()
+	svr.startApi()
+	svr.startAdmin()
 	if c.Pprof {
-		go StartPprof(c.PprofListen)
+		if svr.pprofSvr, err = upgrade.Listen(c.PprofListen); err != nil {
+			return
+		}
+		go StartPprof(svr.pprofSvr)
 	}
 	return
 }
 
+// serve serve the http on the listener until closed.
+func serve(name string, server *http.Server, l net.Listener) {
+	if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Errorf("server.Serve() error(%v)", err)
+	}
+	log.Infof("http %s stop", name)
+}
+
+// listeners the listeners by the addrs, handed over to the new process.
+func (s *Server) listeners() (ls map[string]net.Listener) {
+	ls = map[string]net.Listener{
+		s.conf.StatListen:  s.statSvr,
+		s.conf.ApiListen:   s.apiSvr,
+		s.conf.AdminListen: s.adminSvr,
+	}
+	if s.pprofSvr != nil {
+		ls[s.conf.PprofListen] = s.pprofSvr
+	}
+	return
+}
+
+// Shutdown stop accepting, and wait for the requests in flight at most the
+// timeout.
+func (s *Server) Shutdown(timeout time.Duration) {
+	var (
+		err    error
+		server *http.Server
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, server = range []*http.Server{s.apiHttp, s.adminHttp, s.statHttp} {
+		if err = server.Shutdown(ctx); err != nil {
+			log.Errorf("server.Shutdown(%s) error(%v)", server.Addr, err)
+		}
+	}
+	if s.pprofSvr != nil {
+		s.pprofSvr.Close()
+	}
+}
+
 func (s *Server) Close() {
 	if s.statSvr != nil {
 		s.statSvr.Close()
@@ -68,6 +140,9 @@ func (s *Server) Close() {
 	if s.apiSvr != nil {
 		s.apiSvr.Close()
 	}
+	if s.pprofSvr != nil {
+		s.pprofSvr.Close()
+	}
 	return
 }
 
@@ -113,20 +188,19 @@ func checkContentLength(r *http.Request, maxSize int) (err error) {
 
 func HttpPostWriter(r *http.Request, wr http.ResponseWriter, start time.Time, err *error, result map[string]interface{}) {
 	var (
-		ok       bool
 		byteJson []byte
 		err1     error
 		errStr   string
-		uerr     errors.Error
+		info     *errors.Info
 		ret      = errors.RetOK
 	)
 	if *err != nil {
 		errStr = (*err).Error()
-		if uerr, ok = (*err).(errors.Error); ok {
-			ret = int(uerr)
-		} else {
-			ret = errors.RetInternalErr
-		}
+		info = errors.From(*err).Info()
+		ret = info.Ret
+		result["component"] = info.Component
+		result["msg"] = info.Msg
+		result["retryable"] = info.Retryable
 	}
 	result["ret"] = ret
 	if byteJson, err1 = json.Marshal(result); err1 != nil {
@@ -138,18 +212,46 @@ func HttpPostWriter(r *http.Request, wr http.ResponseWriter, start time.Time, er
 		log.Errorf("http Write() error(%v)", err1)
 		return
 	}
-	log.Infof("%s path:%s(params:%s,time:%f,ret:%v[%v])", r.Method,
-		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, errStr)
+	log.Infof("%s path:%s(params:%s,time:%f,ret:%v[%v],req_id:%s)", r.Method,
+		r.URL.Path, r.Form.Encode(), time.Now().Sub(start).Seconds(), ret, errStr, reqid.FromContext(r.Context()))
+}
+
+// trace set the store and the volume to the span of the api request.
+func (s *Server) trace(ctx context.Context, vid int64) {
+	trace.Set(ctx, attribute.String("bfs.store", s.conf.Zookeeper.ServerId), attribute.Int64("bfs.vid", vid))
+}
+
+// context get the context of the api request, done when the client goes
+// away or after the ApiTimeout.
+func (s *Server) context(r *http.Request) (ctx context.Context, cancel context.CancelFunc) {
+	if s.conf.ApiTimeout.Duration > 0 {
+		return context.WithTimeout(r.Context(), s.conf.ApiTimeout.Duration)
+	}
+	return context.WithCancel(r.Context())
 }
 
+// HttpGetWriter write the status of the get, the body of the bfs error is
+// its json info.
 func HttpGetWriter(r *http.Request, wr http.ResponseWriter, start time.Time, err *error, ret *int) {
-	var errStr string
+	var (
+		ok     bool
+		errStr string
+		uerr   errors.Error
+		body   []byte
+	)
 	if *ret != http.StatusOK {
 		if *err != nil {
 			errStr = (*err).Error()
 		}
-		http.Error(wr, errStr, *ret)
+		if uerr, ok = (*err).(errors.Error); ok {
+			body, _ = json.Marshal(uerr.Info())
+			wr.Header().Set("Content-Type", "application/json;charset=utf-8")
+			wr.WriteHeader(*ret)
+			wr.Write(body)
+		} else {
+			http.Error(wr, errStr, *ret)
+		}
 	}
-	log.Infof("%s path:%s(params:%s,time:%f,err:%s,ret:%v[%v])", r.Method,
-		r.URL.Path, r.URL.String(), time.Now().Sub(start).Seconds(), errStr, *ret, errStr)
+	log.Infof("%s path:%s(params:%s,time:%f,err:%s,ret:%v[%v],req_id:%s)", r.Method,
+		r.URL.Path, r.URL.String(), time.Now().Sub(start).Seconds(), errStr, *ret, errStr, reqid.FromContext(r.Context()))
 }
@@ -2,8 +2,17 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/store/block"
+	"bfs/store/index"
+	"bfs/store/needle"
 	"bfs/store/volume"
-	log "github.com/golang/glog"
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,25 +20,26 @@ import (
 
 // startAdmin start admin http listen.
 func (s *Server) startAdmin() {
-	var (
-		err      error
-		serveMux = http.NewServeMux()
-		server   = &http.Server{
-			Addr:    s.conf.AdminListen,
-			Handler: serveMux,
-			// TODO read/write timeout
-		}
-	)
+	var serveMux = http.NewServeMux()
+	s.adminHttp = &http.Server{
+		Addr:    s.conf.AdminListen,
+		Handler: serveMux,
+		// TODO read/write timeout
+	}
 	serveMux.HandleFunc("/probe", s.probe)
 	serveMux.HandleFunc("/bulk_volume", s.bulkVolume)
 	serveMux.HandleFunc("/compact_volume", s.compactVolume)
+	serveMux.HandleFunc("/volume_digest", s.volumeDigest)
+	serveMux.HandleFunc("/volume_stream", s.volumeStream)
+	serveMux.HandleFunc("/clone_volume", s.cloneVolume)
+	serveMux.HandleFunc("/volume_dump", s.volumeDump)
+	serveMux.HandleFunc("/volume_quota", s.volumeQuota)
+	serveMux.HandleFunc("/cold_needles", s.coldNeedles)
 	serveMux.HandleFunc("/add_volume", s.addVolume)
 	serveMux.HandleFunc("/add_free_volume", s.addFreeVolume)
-	if err = server.Serve(s.adminSvr); err != nil {
-		log.Errorf("server.Serve() error(%v)", err)
-	}
-	log.Info("http admin stop")
-	return
+	serveMux.HandleFunc("/audit", s.auditQuery)
+	serveMux.HandleFunc("/log_level", log.Handler)
+	go serve("admin", s.adminHttp, s.adminSvr)
 }
 
 func (s *Server) probe(wr http.ResponseWriter, r *http.Request) {
@@ -52,13 +62,9 @@ func (s *Server) probe(wr http.ResponseWriter, r *http.Request) {
 		ret = http.StatusBadRequest
 		return
 	}
-	if v = s.store.Volumes[int32(vid)]; v != nil {
+	if v = s.store.Volume(int32(vid)); v != nil {
 		if err = v.Probe(); err != nil {
-			if err == errors.ErrNeedleDeleted || err == errors.ErrNeedleNotExist {
-				ret = http.StatusNotFound
-			} else {
-				ret = http.StatusInternalServerError
-			}
+			ret = errors.Status(err)
 		}
 	} else {
 		ret = http.StatusNotFound
@@ -121,6 +127,357 @@ func (s *Server) compactVolume(wr http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// volumeQuota set the max bytes of the block of the volume, no quota if 0.
+func (s *Server) volumeQuota(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		vid   int64
+		quota int64
+		v     *volume.Volume
+		res   = map[string]interface{}{}
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if vid, err = strconv.ParseInt(r.FormValue("vid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", r.FormValue("vid"), err)
+		err = errors.ErrParam
+		return
+	}
+	if quota, err = strconv.ParseInt(r.FormValue("quota"), 10, 64); err != nil ||
+		quota < 0 || quota > needle.BlockOffset(math.MaxUint32) {
+		log.Errorf("volume quota: \"%s\" error(%v)", r.FormValue("quota"), err)
+		err = errors.ErrParam
+		return
+	}
+	if v = s.store.Volume(int32(vid)); v == nil {
+		err = errors.ErrVolumeNotExist
+		return
+	}
+	err = v.SetQuota(quota)
+	return
+}
+
+// volumeDigest digest the needles of the volume in ranges of the keys, the
+// replicas compare the sums to find the diverged ranges.
+func (s *Server) volumeDigest(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err        error
+		vid, n     int64
+		start, end int64
+		str        string
+		v          *volume.Volume
+		d          *volume.Digest
+		res        = map[string]interface{}{}
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if vid, err = strconv.ParseInt(r.FormValue("vid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", r.FormValue("vid"), err)
+		err = errors.ErrParam
+		return
+	}
+	start, end, n = 0, math.MaxInt64, 16
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"start", &start}, {"end", &end}, {"ranges", &n}} {
+		if str = r.FormValue(p.name); str == "" {
+			continue
+		}
+		if *p.v, err = strconv.ParseInt(str, 10, 64); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			err = errors.ErrParam
+			return
+		}
+	}
+	if v = s.store.Volume(int32(vid)); v == nil {
+		err = errors.ErrVolumeNotExist
+		return
+	}
+	// a deep digest reads the whole volume, aborted if the caller goes away
+	if d, err = v.Digest(r.Context(), start, end, int(n), r.FormValue("deep") == "1", r.FormValue("list") == "1"); err == nil {
+		res["digest"] = d
+	}
+	return
+}
+
+// coldNeedles list at most limit keys of the volume not accessed in the age
+// seconds, for the tiering of the directory.
+func (s *Server) coldNeedles(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err           error
+		vid, age, lmt int64
+		v             *volume.Volume
+		res           = map[string]interface{}{}
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"vid", &vid}, {"age", &age}, {"limit", &lmt}} {
+		if *p.v, err = strconv.ParseInt(r.FormValue(p.name), 10, 64); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", r.FormValue(p.name), err)
+			err = errors.ErrParam
+			return
+		}
+	}
+	if vid > math.MaxInt32 || age <= 0 || lmt <= 0 || lmt > _existsMaxKeys {
+		err = errors.ErrParam
+		return
+	}
+	if v = s.store.Volume(int32(vid)); v == nil {
+		err = errors.ErrVolumeNotExist
+		return
+	}
+	res["keys"] = v.Cold(time.Duration(age)*time.Second, int(lmt))
+	return
+}
+
+// volumeStream stream the raw needles of the volume appended since the
+// offset, the X-Bfs-End header is the offset to stream from next time, the
+// stream must restart from 0 if the X-Bfs-Block changes after a compaction.
+// the deletes only flag the needles, see the volume digest.
+func (s *Server) volumeStream(wr http.ResponseWriter, r *http.Request) {
+	var (
+		v           *volume.Volume
+		err         error
+		vid, offset int64
+		start, end  uint32
+		w           io.Writer = wr
+		ret                   = http.StatusOK
+		params                = r.URL.Query()
+		now                   = time.Now()
+	)
+	if r.Method != "GET" {
+		ret = http.StatusMethodNotAllowed
+		http.Error(wr, "method not allowed", ret)
+		return
+	}
+	defer HttpGetWriter(r, wr, now, &err, &ret)
+	if vid, err = strconv.ParseInt(params.Get("vid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", params.Get("vid"), err)
+		ret, err = http.StatusBadRequest, errors.ErrParam
+		return
+	}
+	if str := params.Get("offset"); str != "" {
+		if offset, err = strconv.ParseInt(str, 10, 64); err != nil || offset < 0 || offset > math.MaxUint32 {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			ret, err = http.StatusBadRequest, errors.ErrParam
+			return
+		}
+	}
+	if v = s.store.Volume(int32(vid)); v == nil {
+		ret, err = http.StatusNotFound, errors.ErrVolumeNotExist
+		return
+	}
+	if start, end = uint32(offset), v.Offset(); start == 0 {
+		start = block.FirstOffset()
+	}
+	if start > end {
+		ret, err = http.StatusBadRequest, errors.ErrParam
+		return
+	}
+	wr.Header().Set("Content-Type", "application/octet-stream")
+	wr.Header().Set("Content-Length", strconv.FormatInt(needle.BlockOffset(end)-needle.BlockOffset(start), 10))
+	wr.Header().Set("X-Bfs-Block", v.Block.File)
+	wr.Header().Set("X-Bfs-Offset", strconv.FormatUint(uint64(start), 10))
+	wr.Header().Set("X-Bfs-End", strconv.FormatUint(uint64(end), 10))
+	if s.sl != nil {
+		w = &limitWriter{ctx: r.Context(), w: wr, l: s.sl}
+	}
+	if _, err = v.Block.Stream(start, end, w); err != nil {
+		log.Errorf("volume: %d stream [%d, %d) error(%v)", vid, start, end, err)
+		err = nil // avoid HttpGetWriter write header twice
+	}
+	return
+}
+
+// limitWriter write through the limiter, stop when the ctx is done.
+type limitWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   *rate.Limiter
+}
+
+func (w *limitWriter) Write(p []byte) (n int, err error) {
+	var (
+		nn    int
+		chunk []byte
+	)
+	for len(p) > 0 {
+		if chunk = p; len(chunk) > w.l.Burst() {
+			chunk = chunk[:w.l.Burst()]
+		}
+		if err = w.l.WaitN(w.ctx, len(chunk)); err != nil {
+			return
+		}
+		nn, err = w.w.Write(chunk)
+		if n += nn; err != nil {
+			return
+		}
+		p = p[len(chunk):]
+	}
+	return
+}
+
+// volumeDump dump the index entries or the needle headers of the volume as
+// json lines or csv, for the audits and the cross checks.
+func (s *Server) volumeDump(wr http.ResponseWriter, r *http.Request) {
+	var (
+		v      *volume.Volume
+		d      *dumper
+		err    error
+		vid    int64
+		header = _needleColumns
+		ret    = http.StatusOK
+		params = r.URL.Query()
+		typ    = params.Get("type")
+		now    = time.Now()
+	)
+	if r.Method != "GET" {
+		ret = http.StatusMethodNotAllowed
+		http.Error(wr, "method not allowed", ret)
+		return
+	}
+	defer HttpGetWriter(r, wr, now, &err, &ret)
+	if vid, err = strconv.ParseInt(params.Get("vid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", params.Get("vid"), err)
+		ret, err = http.StatusBadRequest, errors.ErrParam
+		return
+	}
+	if typ == "index" {
+		header = _indexColumns
+	} else if typ != "" && typ != "needle" {
+		ret, err = http.StatusBadRequest, errors.ErrParam
+		return
+	}
+	if v = s.store.Volume(int32(vid)); v == nil {
+		ret, err = http.StatusNotFound, errors.ErrVolumeNotExist
+		return
+	}
+	if d, err = newDumper(wr, params.Get("format"), header); err != nil {
+		ret = http.StatusBadRequest
+		return
+	}
+	wr.Header().Set("Content-Type", d.contentType())
+	if typ == "index" {
+		err = v.ScanIndex(func(ix *index.Index) error {
+			return d.write(&indexRow{Key: ix.Key, Offset: ix.Offset, Size: ix.Size})
+		})
+	} else {
+		err = v.ScanNeedles(func(n *needle.Needle, so, eo uint32) error {
+			return d.write(&needleRow{Key: n.Key, Cookie: n.Cookie, Offset: so, Size: n.Size,
+				TotalSize: n.TotalSize, Deleted: n.Flag == needle.FlagDel, Checksum: n.Checksum})
+		})
+	}
+	if err == nil {
+		err = d.flush()
+	}
+	if err != nil {
+		log.Errorf("volume: %d dump error(%v)", vid, err)
+		err = nil // avoid HttpGetWriter write header twice
+	}
+	return
+}
+
+// cloneVolume clone a local volume or the volume of a remote store by its
+// volume stream to a new volume id.
+func (s *Server) cloneVolume(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		vid, nvid int64
+		v         *volume.Volume
+		rd        io.ReadCloser
+		src       = r.FormValue("src")
+		live      = r.FormValue("live") == "1"
+		res       = map[string]interface{}{}
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if vid, err = strconv.ParseInt(r.FormValue("vid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", r.FormValue("vid"), err)
+		err = errors.ErrParam
+		return
+	}
+	if nvid, err = strconv.ParseInt(r.FormValue("nvid"), 10, 32); err != nil {
+		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", r.FormValue("nvid"), err)
+		err = errors.ErrParam
+		return
+	}
+	if s.store.Volume(int32(nvid)) != nil {
+		err = errors.ErrVolumeExist
+		return
+	}
+	if src == "" {
+		if v = s.store.Volume(int32(vid)); v == nil {
+			err = errors.ErrVolumeNotExist
+			return
+		}
+		rd = streamVolume(v)
+	} else if rd, err = remoteStream(src, vid); err != nil {
+		return
+	}
+	// long time processing, not block, the clone is added when verified.
+	go func() {
+		var n int
+		log.Infof("clone volume: %d from %s:%d start", nvid, src, vid)
+		if n, err = s.store.CloneVolume(int32(nvid), rd, live); err != nil {
+			log.Errorf("s.CloneVolume() error(%v)", err)
+		}
+		rd.Close()
+		log.Infof("clone volume: %d from %s:%d stop, %d needles verified", nvid, src, vid, n)
+	}()
+	return
+}
+
+// streamVolume stream the needles of a local volume.
+func streamVolume(v *volume.Volume) io.ReadCloser {
+	var pr, pw = io.Pipe()
+	go func() {
+		_, err := v.Block.Stream(block.FirstOffset(), v.Offset(), pw)
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// remoteStream stream the needles of a volume from the admin api of a remote
+// store.
+func remoteStream(addr string, vid int64) (rd io.ReadCloser, err error) {
+	var (
+		resp *http.Response
+		info errors.Info
+		uri  = fmt.Sprintf("http://%s/volume_stream?vid=%d", addr, vid)
+	)
+	if resp, err = http.Get(uri); err != nil {
+		log.Errorf("http.Get(\"%s\") error(%v)", uri, err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("http.Get(\"%s\") status: %d", uri, resp.StatusCode)
+		if err = json.NewDecoder(resp.Body).Decode(&info); err == nil {
+			if err = errors.Ret(info.Ret); err == nil {
+				err = errors.ErrInternal
+			}
+		}
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 func (s *Server) addVolume(wr http.ResponseWriter, r *http.Request) {
 	var (
 		err error
@@ -166,3 +523,53 @@ func (s *Server) addFreeVolume(wr http.ResponseWriter, r *http.Request) {
 	res["succeed"] = sn
 	return
 }
+
+// auditQuery get the latest limit audit records since the unix time, of the
+// volume vid and the needle key if any, the oldest first.
+func (s *Server) auditQuery(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		str   string
+		vid   int64 = -1
+		key   int64
+		since int64
+		limit int64 = _auditLimit
+		rs    []*auditRecord
+		res   = map[string]interface{}{}
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if s.audit == nil {
+		err = errors.ErrServiceUnavailable
+		return
+	}
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"vid", &vid}, {"key", &key}, {"since", &since}, {"limit", &limit}} {
+		if str = r.FormValue(p.name); str == "" {
+			continue
+		}
+		if *p.v, err = strconv.ParseInt(str, 10, 64); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			err = errors.ErrParam
+			return
+		}
+	}
+	if limit <= 0 || limit > _auditMaxLimit {
+		err = errors.ErrParam
+		return
+	}
+	if rs, err = s.audit.query(time.Unix(since, 0), int(limit), func(rec *auditRecord) bool {
+		return (vid < 0 || int64(rec.Vid) == vid) && (r.FormValue("key") == "" || rec.Key == key) &&
+			(r.FormValue("request_id") == "" || rec.RequestId == r.FormValue("request_id"))
+	}); err != nil {
+		err = errors.ErrInternal
+		return
+	}
+	res["records"] = rs
+	return
+}
@@ -2,35 +2,40 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/libs/reqid"
+	"bfs/libs/trace"
 	"bfs/store/needle"
 	"bfs/store/volume"
-	log "github.com/golang/glog"
+	"context"
+	otrace "go.opentelemetry.io/otel/trace"
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// the most keys of an exists check
+	_existsMaxKeys = 100000
+)
+
 // startApi start api http listen.
 func (s *Server) startApi() {
-	var (
-		err      error
-		serveMux = http.NewServeMux()
-		server   = &http.Server{
-			Addr:    s.conf.ApiListen,
-			Handler: serveMux,
-			// TODO read/write timeout
-		}
-	)
+	var serveMux = http.NewServeMux()
+	s.apiHttp = &http.Server{
+		Addr:    s.conf.ApiListen,
+		Handler: trace.Handler(reqid.Handler(serveMux)),
+		// TODO read/write timeout
+	}
 	serveMux.HandleFunc("/get", s.get)
 	serveMux.HandleFunc("/upload", s.upload)
 	serveMux.HandleFunc("/uploads", s.uploads)
 	serveMux.HandleFunc("/del", s.del)
-	if err = server.Serve(s.apiSvr); err != nil {
-		log.Errorf("server.Serve() error(%v)", err)
-	}
-	log.Info("http api stop")
-	return
+	serveMux.HandleFunc("/exists", s.exists)
+	newHealth(s.store).Register(serveMux)
+	go serve("api", s.apiHttp, s.apiSvr)
 }
 
 func (s *Server) get(wr http.ResponseWriter, r *http.Request) {
@@ -39,15 +44,20 @@ func (s *Server) get(wr http.ResponseWriter, r *http.Request) {
 		n                *needle.Needle
 		err              error
 		vid, key, cookie int64
+		ctx              context.Context
+		cancel           context.CancelFunc
+		span             otrace.Span
 		ret              = http.StatusOK
 		params           = r.URL.Query()
 		now              = time.Now()
+		tr               = s.slow.Start()
 	)
 	if r.Method != "GET" && r.Method != "HEAD" {
 		ret = http.StatusMethodNotAllowed
 		http.Error(wr, "method not allowed", ret)
 		return
 	}
+	defer tr.End(r)
 	defer HttpGetWriter(r, wr, now, &err, &ret)
 	if !s.rl.Allow() {
 		ret = http.StatusServiceUnavailable
@@ -68,20 +78,24 @@ func (s *Server) get(wr http.ResponseWriter, r *http.Request) {
 		ret = http.StatusBadRequest
 		return
 	}
-	if v = s.store.Volumes[int32(vid)]; v != nil {
-		if n, err = v.Read(key, int32(cookie)); err == nil {
+	ctx, cancel = s.context(r)
+	defer cancel()
+	s.trace(ctx, vid)
+	if v = s.store.Volume(int32(vid)); v != nil {
+		ctx, span = trace.Start(ctx, "volume.read")
+		n, err = v.ReadContext(ctx, key, int32(cookie))
+		trace.End(span, err)
+		tr.Phase("read")
+		if err == nil {
 			wr.Header().Set("Content-Length", strconv.Itoa(len(n.Data)))
 			if _, err = wr.Write(n.Data); err != nil {
 				log.Errorf("wr.Write() error(%v)", err)
 				err = nil // avoid HttpGetWriter write header twice
 			}
+			tr.Phase("write")
 			n.Close()
 		} else {
-			if err == errors.ErrNeedleDeleted || err == errors.ErrNeedleNotExist {
-				ret = http.StatusNotFound
-			} else {
-				ret = http.StatusInternalServerError
-			}
+			ret = errors.Status(err)
 		}
 	} else {
 		ret = http.StatusNotFound
@@ -101,12 +115,17 @@ func (s *Server) upload(wr http.ResponseWriter, r *http.Request) {
 		v      *volume.Volume
 		n      *needle.Needle
 		file   multipart.File
+		ctx    context.Context
+		cancel context.CancelFunc
+		span   otrace.Span
 		res    = map[string]interface{}{}
+		tr     = s.slow.Start()
 	)
 	if r.Method != "POST" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	defer tr.End(r)
 	defer HttpPostWriter(r, wr, time.Now(), &err, res)
 	if !s.wl.Allow() {
 		err = errors.ErrServiceUnavailable
@@ -138,12 +157,20 @@ func (s *Server) upload(wr http.ResponseWriter, r *http.Request) {
 		err = errors.ErrInternal
 		return
 	}
+	tr.Phase("recv")
+	ctx, cancel = s.context(r)
+	defer cancel()
+	s.trace(ctx, vid)
 	if size, err = checkFileSize(file, s.conf.NeedleMaxSize); err == nil {
-		if v = s.store.Volumes[int32(vid)]; v != nil {
+		if v = s.store.Volume(int32(vid)); v != nil {
 			n = needle.NewWriter(key, int32(cookie), int32(size))
 			if err = n.ReadFrom(file); err == nil {
-				err = v.Write(n)
+				ctx, span = trace.Start(ctx, "volume.write")
+				err = v.WriteContext(ctx, n)
+				trace.End(span, err)
+				tr.Phase("write")
 			}
+			s.audit.add(r, _auditUpload, vid, key, size, err)
 			n.Close()
 		} else {
 			err = errors.ErrVolumeNotExist
@@ -164,23 +191,30 @@ func (s *Server) uploads(wr http.ResponseWriter, r *http.Request) {
 		str     string
 		keys    []string
 		cookies []string
+		sizes   []int64
 		v       *volume.Volume
 		file    multipart.File
 		fh      *multipart.FileHeader
 		fhs     []*multipart.FileHeader
 		ns      *needle.Needles
+		ctx     context.Context
+		cancel  context.CancelFunc
+		span    otrace.Span
 		res     = map[string]interface{}{}
+		tr      = s.slow.Start()
 	)
 	if r.Method != "POST" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	defer tr.End(r)
 	defer HttpPostWriter(r, wr, time.Now(), &err, res)
 	if !s.wl.Allow() {
 		err = errors.ErrServiceUnavailable
 		return
 	}
 	str = r.FormValue("vid")
+	tr.Phase("recv")
 	if vid, err = strconv.ParseInt(str, 10, 32); err != nil {
 		log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
 		err = errors.ErrParam
@@ -200,6 +234,9 @@ func (s *Server) uploads(wr http.ResponseWriter, r *http.Request) {
 		err = errors.ErrParam
 		return
 	}
+	ctx, cancel = s.context(r)
+	defer cancel()
+	s.trace(ctx, vid)
 	ns = needle.NewNeedles(nn)
 	for i, fh = range fhs {
 		if key, err = strconv.ParseInt(keys[i], 10, 64); err != nil {
@@ -219,14 +256,23 @@ func (s *Server) uploads(wr http.ResponseWriter, r *http.Request) {
 		if size, err = checkFileSize(file, s.conf.NeedleMaxSize); err == nil {
 			err = ns.ReadFrom(key, int32(cookie), int32(size), file)
 		}
+		sizes = append(sizes, size)
 		file.Close()
 		if err != nil {
 			break
 		}
 	}
+	tr.Phase("parse")
 	if err == nil {
-		if v = s.store.Volumes[int32(vid)]; v != nil {
-			err = v.Writes(ns)
+		if v = s.store.Volume(int32(vid)); v != nil {
+			ctx, span = trace.Start(ctx, "volume.write")
+			err = v.WritesContext(ctx, ns)
+			trace.End(span, err)
+			tr.Phase("write")
+			for i, size = range sizes {
+				key, _ = strconv.ParseInt(keys[i], 10, 64)
+				s.audit.add(r, _auditUpload, vid, key, size, err)
+			}
 		} else {
 			err = errors.ErrVolumeNotExist
 		}
@@ -241,12 +287,17 @@ func (s *Server) del(wr http.ResponseWriter, r *http.Request) {
 		key, vid int64
 		str      string
 		v        *volume.Volume
+		ctx      context.Context
+		cancel   context.CancelFunc
+		span     otrace.Span
 		res      = map[string]interface{}{}
+		tr       = s.slow.Start()
 	)
 	if r.Method != "POST" {
 		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	defer tr.End(r)
 	defer HttpPostWriter(r, wr, time.Now(), &err, res)
 	if !s.dl.Allow() {
 		err = errors.ErrServiceUnavailable
@@ -264,10 +315,83 @@ func (s *Server) del(wr http.ResponseWriter, r *http.Request) {
 		err = errors.ErrParam
 		return
 	}
-	if v = s.store.Volumes[int32(vid)]; v != nil {
-		err = v.Delete(key)
+	ctx, cancel = s.context(r)
+	defer cancel()
+	s.trace(ctx, vid)
+	if v = s.store.Volume(int32(vid)); v != nil {
+		ctx, span = trace.Start(ctx, "volume.del")
+		err = v.DeleteContext(ctx, key)
+		trace.End(span, err)
+		tr.Phase("del")
+		s.audit.add(r, _auditDel, vid, key, 0, err)
 	} else {
 		err = errors.ErrVolumeNotExist
 	}
 	return
 }
+
+// exists check the keys exist in the volume, or in any volume of the store
+// if no vid, only the needles maps are read, for the garbage collectors of
+// the applications to reconcile their databases.
+func (s *Server) exists(wr http.ResponseWriter, r *http.Request) {
+	var (
+		i      int
+		err    error
+		vid    int64
+		key    int64
+		str    string
+		strs   []string
+		keys   []int64
+		found  []bool
+		exists []int64
+		v      *volume.Volume
+		vs     map[int32]*volume.Volume
+		res    = map[string]interface{}{}
+	)
+	if r.Method != "POST" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if strs = strings.Split(r.PostFormValue("keys"), ","); len(strs) > _existsMaxKeys {
+		err = errors.ErrParam
+		return
+	}
+	keys = make([]int64, 0, len(strs))
+	for _, str = range strs {
+		if key, err = strconv.ParseInt(str, 10, 64); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			err = errors.ErrParam
+			return
+		}
+		keys = append(keys, key)
+	}
+	if str = r.PostFormValue("vid"); str != "" {
+		if vid, err = strconv.ParseInt(str, 10, 32); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			err = errors.ErrParam
+			return
+		}
+		if v = s.store.Volume(int32(vid)); v == nil {
+			err = errors.ErrVolumeNotExist
+			return
+		}
+		vs = map[int32]*volume.Volume{v.Id: v}
+	} else {
+		vs = s.store.Volumes()
+	}
+	found = make([]bool, len(keys))
+	for _, v = range vs {
+		for i, ok := range v.Exists(keys) {
+			found[i] = found[i] || ok
+		}
+	}
+	exists = make([]int64, 0, len(keys))
+	for i, key = range keys {
+		if found[i] {
+			exists = append(exists, key)
+		}
+	}
+	res["keys"] = exists
+	return
+}
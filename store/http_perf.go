@@ -1,17 +1,17 @@
 package main
 
 import (
-	log "github.com/golang/glog"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+
+	"bfs/libs/log"
 )
 
 // StartPprof start a golang pprof.
-func StartPprof(addr string) {
+func StartPprof(l net.Listener) {
 	var err error
-	if err = http.ListenAndServe(addr, nil); err != nil {
-		log.Errorf("http.ListenAndServe(\"%s\") error(%v)", addr, err)
-		panic(err)
-		return
+	if err = http.Serve(l, nil); err != nil {
+		log.Errorf("http.Serve(\"%s\") error(%v)", l.Addr(), err)
 	}
 }
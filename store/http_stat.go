@@ -2,11 +2,12 @@ package main
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/stat"
 	"bfs/store/volume"
 	"encoding/json"
-	log "github.com/golang/glog"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -15,15 +16,12 @@ const (
 )
 
 func (s *Server) startStat() {
-	var (
-		err      error
-		serveMux = http.NewServeMux()
-		server   = &http.Server{
-			Addr:    s.conf.StatListen,
-			Handler: serveMux,
-			// TODO read/write timeout
-		}
-	)
+	var serveMux = http.NewServeMux()
+	s.statHttp = &http.Server{
+		Addr:    s.conf.StatListen,
+		Handler: serveMux,
+		// TODO read/write timeout
+	}
 	s.info = &stat.Info{
 		Ver:       Ver,
 		GitSHA1:   GitSHA1,
@@ -32,11 +30,8 @@ func (s *Server) startStat() {
 	}
 	go s.statproc()
 	serveMux.HandleFunc("/info", s.stat)
-	if err = server.Serve(s.statSvr); err != nil {
-		log.Errorf("server.Serve() error(%v)", err)
-	}
-	log.Info("http stat stop")
-	return
+	serveMux.HandleFunc("/history", s.statHistory)
+	go serve("stat", s.statHttp, s.statSvr)
 }
 
 func (s *Server) stat(wr http.ResponseWriter, r *http.Request) {
@@ -48,10 +43,10 @@ func (s *Server) stat(wr http.ResponseWriter, r *http.Request) {
 		err     error
 		data    []byte
 		v       *volume.Volume
-		volumes = make([]*volume.Volume, 0, len(s.store.Volumes))
+		volumes = make([]*volume.Volume, 0, len(s.store.Volumes()))
 		res     = map[string]interface{}{"ret": errors.RetOK}
 	)
-	for _, v = range s.store.Volumes {
+	for _, v = range s.store.Volumes() {
 		volumes = append(volumes, v)
 	}
 	res["server"] = s.info
@@ -67,6 +62,48 @@ func (s *Server) stat(wr http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// statHistory get the per-minute stats of the server, or the volume vid,
+// since the unix time, the oldest first.
+func (s *Server) statHistory(wr http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		ok    bool
+		vid   int64 = -1
+		since int64
+		str   string
+		ps    []*stat.Point
+		res   = map[string]interface{}{}
+	)
+	if r.Method != "GET" {
+		http.Error(wr, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer HttpPostWriter(r, wr, time.Now(), &err, res)
+	if s.history == nil {
+		err = errors.ErrServiceUnavailable
+		return
+	}
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"vid", &vid}, {"since", &since}} {
+		if str = r.FormValue(p.name); str == "" {
+			continue
+		}
+		if *p.v, err = strconv.ParseInt(str, 10, 64); err != nil {
+			log.Errorf("strconv.ParseInt(\"%s\") error(%v)", str, err)
+			err = errors.ErrParam
+			return
+		}
+	}
+	if ps, ok = s.history.points(int32(vid), since); !ok {
+		err = errors.ErrVolumeNotExist
+		return
+	}
+	res["points"] = ps
+	return
+}
+
 // statproc stat the store.
 func (s *Server) statproc() {
 	var (
@@ -79,12 +116,17 @@ func (s *Server) statproc() {
 		*news = *olds
 		s.info.Stats = news // use news instead, for current display
 		olds.Reset()
-		for _, v = range s.store.Volumes {
+		for _, v = range s.store.Volumes() {
 			v.Stats.Calc()
+			v.GarbageRatio = v.Garbage()
 			olds.Merge(v.Stats)
 		}
 		olds.Calc()
 		s.info.Stats = olds
+		s.info.SlowRequests = s.slow.Count()
+		if s.history != nil {
+			s.history.sample(time.Now(), olds, s.store.Volumes())
+		}
 		time.Sleep(statDuration)
 	}
 }
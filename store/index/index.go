@@ -3,15 +3,18 @@ package index
 import (
 	"bfs/libs/encoding/binary"
 	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/store/backend"
 	"bfs/store/conf"
-	myos "bfs/store/os"
 	"bufio"
 	"fmt"
-	log "github.com/golang/glog"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // Index for fast recovery super block needle cache in memory, index is async
@@ -33,6 +36,21 @@ import (
 // key       | needle key (photo id)
 // offset    | needle offset in super block (aligned)
 // size      | needle data size
+//
+// compressed index file format (Index.Compress):
+//  ---------------
+// | super   block |
+//  ---------------
+// |     frame     | ---->    | length (int64) |  zstd data length
+// |     frame     |          | count (uint32) |  indexes in frame
+// |     ......    |          | mark (int32)   |  -1, never a size
+// |     needle    |          | zstd data      |  padded to 16 bytes
+// |     needle    |
+//
+// the last indexes less than a frame are the uncompressed tail, appended
+// like before, the tail is compressed to a frame in place once it's full.
+// the frames and the needles can be mixed, the option can be changed on
+// the existing volumes.
 
 const (
 	// signal command
@@ -50,12 +68,22 @@ const (
 	_sizeOffset   = _offsetOffset + _offsetSize
 	// 100mb
 	_fallocSize = 100 * 1024 * 1024
+	// compressed frame
+	_frameMark    = -1
+	_frameIndexes = 4096
+	_frameSize    = _frameIndexes * _indexSize
+)
+
+var (
+	_zenc, _ = zstd.NewWriter(nil)
+	_zdec, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(_frameSize))
 )
 
 // Indexer used for fast recovery super block needle cache.
 type Indexer struct {
 	wg     sync.WaitGroup
-	f      *os.File
+	f      backend.File
+	be     backend.Backend
 	signal chan int
 	ring   *Ring
 	// buffer
@@ -66,10 +94,18 @@ type Indexer struct {
 	LastErr error  `json:"last_err"`
 	Offset  int64  `json:"offset"`
 	conf    *conf.Config
+	// the Offset written, read by the others
+	written int64
 	// status
 	syncOffset int64
 	closed     bool
 	write      int
+	// the oldest index added since the last merge, unix nano, only for the
+	// adaptive flush
+	first int64
+	// the uncompressed tail
+	tail       []byte
+	tailOffset int64
 }
 
 // Index index data.
@@ -102,7 +138,7 @@ Size:           %d
 
 // NewIndexer new a indexer for async merge index data to disk.
 func NewIndexer(file string, conf *conf.Config) (i *Indexer, err error) {
-	var stat os.FileInfo
+	var size int64
 	i = &Indexer{}
 	i.File = file
 	i.closed = false
@@ -112,17 +148,21 @@ func NewIndexer(file string, conf *conf.Config) (i *Indexer, err error) {
 	i.ring = NewRing(conf.Index.RingBuffer)
 	i.bn = 0
 	i.buf = make([]byte, conf.Index.BufferSize)
-	if i.f, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", file, err)
+	if i.be, err = backend.Get(conf.Backend); err != nil {
+		log.Errorf("backend.Get(\"%s\") error(%v)", conf.Backend, err)
+		return nil, err
+	}
+	if i.f, err = i.be.Open(file, os.O_RDWR|os.O_CREATE); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", file, err)
 		return nil, err
 	}
-	if stat, err = i.f.Stat(); err != nil {
-		log.Errorf("index: %s Stat() error(%v)", i.File, err)
+	if size, err = i.f.Size(); err != nil {
+		log.Errorf("index: %s Size() error(%v)", i.File, err)
 		return nil, err
 	}
-	if stat.Size() == 0 {
-		if err = myos.Fallocate(i.f.Fd(), myos.FALLOC_FL_KEEP_SIZE, 0, _fallocSize); err != nil {
-			log.Errorf("index: %s fallocate() error(err)", i.File, err)
+	if size == 0 {
+		if err = i.f.Allocate(_fallocSize); err != nil {
+			log.Errorf("index: %s Allocate() error(%v)", i.File, err)
 			i.Close()
 			return nil, err
 		}
@@ -158,12 +198,31 @@ func (i *Indexer) Add(key int64, offset uint32, size int32) (err error) {
 	index.Offset = offset
 	index.Size = size
 	i.ring.SetAdv()
-	if i.ring.Buffered() > i.conf.Index.MergeWrite {
+	if i.conf.Index.FlushDelay.Duration > 0 {
+		atomic.CompareAndSwapInt64(&i.first, 0, time.Now().UnixNano())
+	}
+	if i.merging(i.ring.Buffered()) {
 		i.Signal()
 	}
 	return
 }
 
+// merging reports whether the buffered indexes signal the merge, FlushBytes
+// by the adaptive flush, or more than MergeWrite.
+func (i *Indexer) merging(buffered int) bool {
+	var c = i.conf.Index
+	if c.FlushDelay.Duration > 0 && c.FlushBytes > 0 {
+		return buffered*_indexSize >= c.FlushBytes
+	}
+	return buffered > c.MergeWrite
+}
+
+// Written get the offset of the indexes written to the file, safe to call
+// while the merge is running.
+func (i *Indexer) Written() int64 {
+	return atomic.LoadInt64(&i.written)
+}
+
 // Write append index needle to disk.
 // WARN can't concurrency with merge and write.
 // ONLY used in super block recovery!!!!!!!!!!!
@@ -190,11 +249,11 @@ func (i *Indexer) Write(key int64, offset uint32, size int32) (err error) {
 // flush the in-memory data flush to disk.
 func (i *Indexer) flush(force bool) (err error) {
 	var (
-		fd     uintptr
 		offset int64
 		size   int64
 	)
-	if i.write++; !force && i.write < i.conf.Index.SyncWrite {
+	// the adaptive flush is forced by the merge
+	if i.write++; !force && (i.conf.Index.FlushDelay.Duration > 0 || i.write < i.conf.Index.SyncWrite) {
 		return
 	}
 	if _, err = i.f.Write(i.buf[:i.bn]); err != nil {
@@ -202,30 +261,81 @@ func (i *Indexer) flush(force bool) (err error) {
 		log.Errorf("index: %s Write() error(%v)", i.File, err)
 		return
 	}
+	if i.conf.Index.Compress {
+		i.tail = append(i.tail, i.buf[:i.bn]...)
+	}
 	i.Offset += int64(i.bn)
 	i.bn = 0
 	i.write = 0
+	for len(i.tail) >= _frameSize {
+		if err = i.compress(); err != nil {
+			return
+		}
+	}
+	atomic.StoreInt64(&i.written, i.Offset)
 	offset = i.syncOffset
 	size = i.Offset - i.syncOffset
-	fd = i.f.Fd()
 	if i.conf.Index.Syncfilerange {
-		if err = myos.Syncfilerange(fd, offset, size, myos.SYNC_FILE_RANGE_WRITE); err != nil {
+		if err = i.f.SyncRange(offset, size); err != nil {
 			i.LastErr = err
-			log.Errorf("index: %s Syncfilerange() error(%v)", i.File, err)
+			log.Errorf("index: %s SyncRange() error(%v)", i.File, err)
 			return
 		}
 	} else {
-		if err = myos.Fdatasync(fd); err != nil {
+		if err = i.f.Datasync(); err != nil {
 			i.LastErr = err
-			log.Errorf("index: %s Fdatasync() error(%v)", i.File, err)
+			log.Errorf("index: %s Datasync() error(%v)", i.File, err)
 			return
 		}
 	}
-	if err = myos.Fadvise(fd, offset, size, myos.POSIX_FADV_DONTNEED); err == nil {
+	if err = i.f.Advise(offset, size, backend.AdviseDontNeed); err == nil {
 		i.syncOffset = i.Offset
 	} else {
-		log.Errorf("index: %s Fadvise() error(%v)", i.File, err)
+		log.Errorf("index: %s Advise() error(%v)", i.File, err)
+		i.LastErr = err
+	}
+	return
+}
+
+// compress compress the first frame of the tail in place, the rest of the
+// tail is rewritten after the frame.
+func (i *Indexer) compress() (err error) {
+	var (
+		offset = i.tailOffset
+		rest   = i.tail[_frameSize:]
+		frame  = make([]byte, _indexSize, _frameSize)
+		n      int
+	)
+	frame = _zenc.EncodeAll(i.tail[:_frameSize], frame)
+	binary.BigEndian.PutInt64(frame, int64(len(frame)-_indexSize))
+	binary.BigEndian.PutUint32(frame[_offsetOffset:], _frameIndexes)
+	binary.BigEndian.PutInt32(frame[_sizeOffset:], _frameMark)
+	if n = len(frame) % _indexSize; n != 0 {
+		frame = append(frame, make([]byte, _indexSize-n)...)
+	}
+	n = len(frame)
+	frame = append(frame, rest...)
+	if _, err = i.f.WriteAt(frame, offset); err != nil {
+		i.LastErr = err
+		log.Errorf("index: %s WriteAt() error(%v)", i.File, err)
+		return
+	}
+	i.tailOffset = offset + int64(n)
+	i.Offset = i.tailOffset + int64(len(rest))
+	// discard the replaced tail
+	if err = i.f.Truncate(i.Offset); err != nil {
 		i.LastErr = err
+		log.Errorf("index: %s Truncate() error(%v)", i.File, err)
+		return
+	}
+	if _, err = i.f.Seek(i.Offset, os.SEEK_SET); err != nil {
+		i.LastErr = err
+		log.Errorf("index: %s Seek() error(%v)", i.File, err)
+		return
+	}
+	i.tail = i.tail[:copy(i.tail, rest)]
+	if i.syncOffset > offset {
+		i.syncOffset = offset
 	}
 	return
 }
@@ -259,25 +369,33 @@ func (i *Indexer) mergeRing() (err error) {
 // merge merge from ring index data, then write to disk.
 func (i *Indexer) merge() {
 	var (
-		err error
-		sig int
+		err   error
+		sig   int
+		t     int64
+		first int64 // the oldest index merged but not written, unix nano
 	)
 	log.Infof("index: %s write job start", i.File)
 	for {
 		select {
 		case sig = <-i.signal:
-		case <-time.After(i.conf.Index.MergeDelay.Duration):
+		case <-time.After(i.delay(first)):
 			sig = _ready
 		}
 		if sig != _ready {
 			break
 		}
+		if t = atomic.SwapInt64(&i.first, 0); t > 0 && (first == 0 || t < first) {
+			first = t
+		}
 		if err = i.mergeRing(); err != nil {
 			break
 		}
-		if err = i.flush(false); err != nil {
+		if err = i.flush(i.due(first)); err != nil {
 			break
 		}
+		if i.bn == 0 {
+			first = 0
+		}
 	}
 	i.mergeRing()
 	i.flush(true)
@@ -286,23 +404,71 @@ func (i *Indexer) merge() {
 	return
 }
 
+// delay get the time to wait for the next merge, MergeDelay, or the time
+// left before the oldest unwritten index is FlushDelay old by the adaptive
+// flush, so the indexes at risk are bounded by the time under the low
+// traffic.
+func (i *Indexer) delay(first int64) (d time.Duration) {
+	var t int64
+	if d = i.conf.Index.FlushDelay.Duration; d == 0 {
+		return i.conf.Index.MergeDelay.Duration
+	}
+	if t = atomic.LoadInt64(&i.first); t > 0 && (first == 0 || t < first) {
+		first = t
+	}
+	if first > 0 {
+		if d -= time.Since(time.Unix(0, first)); d < 0 {
+			d = 0
+		}
+	}
+	return
+}
+
+// due reports whether the adaptive flush writes the merged indexes, older
+// than FlushDelay, or more than FlushBytes, so the high traffic is written
+// in big batches.
+func (i *Indexer) due(first int64) bool {
+	var c = i.conf.Index
+	if c.FlushDelay.Duration == 0 || i.bn == 0 {
+		return false
+	}
+	return (c.FlushBytes > 0 && i.bn >= c.FlushBytes) ||
+		(first > 0 && time.Since(time.Unix(0, first)) >= c.FlushDelay.Duration)
+}
+
+// Reader open a new reader of the index file, the indexer is not affected.
+func (i *Indexer) Reader() (r backend.File, err error) {
+	if r, err = i.be.Open(i.File, os.O_RDONLY); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", i.File, err)
+	}
+	return
+}
+
 // Scan scan a indexer file.
-func (i *Indexer) Scan(r *os.File, fn func(*Index) error) (err error) {
+func (i *Indexer) Scan(r backend.File, fn func(*Index) error) (err error) {
+	return i.scan(r, func(ix *Index, end int64, frame bool) error {
+		return fn(ix)
+	})
+}
+
+// scan scan a indexer file, end is the offset after the needle or the frame
+// of ix, frame reports ix is compressed.
+func (i *Indexer) scan(r backend.File, fn func(ix *Index, end int64, frame bool) error) (err error) {
 	var (
-		data []byte
-		fi   os.FileInfo
-		fd   = r.Fd()
-		ix   = &Index{}
-		rd   = bufio.NewReaderSize(r, i.conf.Index.BufferSize)
+		data   []byte
+		size   int64
+		offset int64
+		ix     = &Index{}
+		rd     = bufio.NewReaderSize(r, i.conf.Index.BufferSize)
 	)
 	log.Infof("scan index: %s", i.File)
 	// advise sequential read
-	if fi, err = r.Stat(); err != nil {
-		log.Errorf("index: %s Stat() error(%v)", i.File)
+	if size, err = r.Size(); err != nil {
+		log.Errorf("index: %s Size() error(%v)", i.File, err)
 		return
 	}
-	if err = myos.Fadvise(fd, 0, fi.Size(), myos.POSIX_FADV_SEQUENTIAL); err != nil {
-		log.Errorf("index: %s Fadvise() error(%v)", i.File)
+	if err = r.Advise(0, size, backend.AdviseSequential); err != nil {
+		log.Errorf("index: %s Advise() error(%v)", i.File, err)
 		return
 	}
 	if _, err = r.Seek(0, os.SEEK_SET); err != nil {
@@ -313,6 +479,16 @@ func (i *Indexer) Scan(r *os.File, fn func(*Index) error) (err error) {
 		if data, err = rd.Peek(_indexSize); err != nil {
 			break
 		}
+		if binary.BigEndian.Int32(data[_sizeOffset:]) == _frameMark {
+			if data, err = i.frame(rd); err != nil {
+				break
+			}
+			offset += int64(len(data))
+			if err = i.scanFrame(data, offset, fn); err != nil {
+				break
+			}
+			continue
+		}
 		if err = ix.parse(data); err != nil {
 			break
 		}
@@ -324,33 +500,94 @@ func (i *Indexer) Scan(r *os.File, fn func(*Index) error) (err error) {
 		if _, err = rd.Discard(_indexSize); err != nil {
 			break
 		}
+		offset += _indexSize
 		if log.V(1) {
 			log.Info(ix.String())
 		}
-		if err = fn(ix); err != nil {
+		if err = fn(ix, offset, false); err != nil {
 			break
 		}
 	}
 	if err == io.EOF {
 		// advise no need page cache
-		if err = myos.Fadvise(fd, 0, fi.Size(), myos.POSIX_FADV_DONTNEED); err == nil {
+		if err = r.Advise(0, size, backend.AdviseDontNeed); err == nil {
 			err = nil
 			log.Infof("scan index: %s [ok]", i.File)
 			return
 		} else {
-			log.Errorf("index: %s Fadvise() error(%v)", i.File)
+			log.Errorf("index: %s Advise() error(%v)", i.File, err)
 		}
 	}
 	log.Infof("scan index: %s error(%v) [failed]", i.File, err)
 	return
 }
 
+// frame read a whole frame of the reader, the header and the padding
+// included.
+func (i *Indexer) frame(rd *bufio.Reader) (data []byte, err error) {
+	var length, size int64
+	if data, err = rd.Peek(_indexSize); err != nil {
+		return
+	}
+	if length = binary.BigEndian.Int64(data); length <= 0 || length > _frameSize*2 {
+		log.Errorf("scan index: %s frame length: %d error(%v)", i.File, length, errors.ErrIndexSize)
+		err = errors.ErrIndexSize
+		return
+	}
+	if size = _indexSize + length; size%_indexSize != 0 {
+		size += _indexSize - size%_indexSize
+	}
+	data = make([]byte, size)
+	if _, err = io.ReadFull(rd, data); err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+// scanFrame decompress the frame and scan the indexes of it, end is the
+// offset after the frame.
+func (i *Indexer) scanFrame(data []byte, end int64, fn func(ix *Index, end int64, frame bool) error) (err error) {
+	var (
+		buf   []byte
+		count = int(binary.BigEndian.Uint32(data[_offsetOffset:]))
+		ix    = &Index{}
+	)
+	if buf, err = _zdec.DecodeAll(data[_indexSize:_indexSize+binary.BigEndian.Int64(data)], nil); err != nil {
+		log.Errorf("scan index: %s frame error(%v)", i.File, err)
+		return errors.ErrIndexSize
+	}
+	if len(buf) != count*_indexSize {
+		log.Errorf("scan index: %s frame indexes: %d error(%v)", i.File, count, errors.ErrIndexSize)
+		return errors.ErrIndexSize
+	}
+	for ; len(buf) > 0; buf = buf[_indexSize:] {
+		if err = ix.parse(buf); err != nil {
+			return
+		}
+		if ix.Size > int32(i.conf.BlockMaxSize) {
+			log.Errorf("scan index: %s error(%v)", ix, errors.ErrIndexSize)
+			return errors.ErrIndexSize
+		}
+		if log.V(1) {
+			log.Info(ix.String())
+		}
+		if err = fn(ix, end, true); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // Recovery recovery needle cache meta data in memory, index file  will stop
 // at the right parse data offset.
 func (i *Indexer) Recovery(fn func(*Index) error) (err error) {
-	if i.Scan(i.f, func(ix *Index) (err1 error) {
+	var raw int64 // the uncompressed indexes after the frames
+	i.Offset = 0
+	if i.scan(i.f, func(ix *Index, end int64, frame bool) (err1 error) {
 		if err1 = fn(ix); err1 == nil {
-			i.Offset += int64(_indexSize)
+			if i.Offset = end; frame {
+				raw = end
+			}
 		}
 		return
 	}); err != nil {
@@ -359,6 +596,16 @@ func (i *Indexer) Recovery(fn func(*Index) error) (err error) {
 	// reset b.w offset, discard left space which can't parse to a needle
 	if _, err = i.f.Seek(i.Offset, os.SEEK_SET); err != nil {
 		log.Errorf("index: %s Seek() error(%v)", i.File, err)
+		return
+	}
+	// the full frames of the uncompressed indexes are kept
+	i.tailOffset = i.Offset - (i.Offset-raw)%_frameSize
+	i.tail = i.tail[:0]
+	if i.conf.Index.Compress && i.Offset > i.tailOffset {
+		i.tail = make([]byte, i.Offset-i.tailOffset, _frameSize)
+		if _, err = i.f.ReadAt(i.tail, i.tailOffset); err != nil {
+			log.Errorf("index: %s ReadAt() error(%v)", i.File, err)
+		}
 	}
 	return
 }
@@ -368,8 +615,8 @@ func (i *Indexer) Open() (err error) {
 	if !i.closed {
 		return
 	}
-	if i.f, err = os.OpenFile(i.File, os.O_RDWR|myos.O_NOATIME, 0664); err != nil {
-		log.Errorf("os.OpenFile(\"%s\") error(%v)", i.File, err)
+	if i.f, err = i.be.Open(i.File, os.O_RDWR); err != nil {
+		log.Errorf("backend.Open(\"%s\") error(%v)", i.File, err)
 		return
 	}
 	// reset buf
@@ -409,5 +656,5 @@ func (i *Indexer) Destroy() {
 	if !i.closed {
 		i.Close()
 	}
-	os.Remove(i.File)
+	i.be.Remove(i.File)
 }
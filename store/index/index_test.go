@@ -129,3 +129,124 @@ func TestIndex(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestIndexCompress(t *testing.T) {
+	var (
+		i     *Indexer
+		err   error
+		fi    os.FileInfo
+		n     int64
+		count = int64(_frameIndexes*2 + 100)
+		file  = "../test/test_compress.idx"
+		c     = *testConf
+		ic    = *testConf.Index
+	)
+	ic.Compress = true
+	c.Index = &ic
+	os.Remove(file)
+	defer os.Remove(file)
+	if i, err = NewIndexer(file, &c); err != nil {
+		t.Errorf("NewIndexer() error(%v)", err)
+		t.FailNow()
+	}
+	defer i.Close()
+	for n = 0; n < count; n++ {
+		if err = i.Write(n, uint32(n), 8); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+	}
+	if err = i.Flush(); err != nil {
+		t.Errorf("Flush() error(%v)", err)
+		t.FailNow()
+	}
+	if fi, err = os.Stat(file); err != nil || fi.Size() >= count*_indexSize/2 {
+		t.Errorf("index size: %d not compressed", fi.Size())
+		t.FailNow()
+	}
+	if len(i.tail) != 100*_indexSize {
+		t.Errorf("index tail: %d not match", len(i.tail))
+		t.FailNow()
+	}
+	// recovery, then compress the tail with the new indexes
+	n = 0
+	if err = i.Recovery(func(ix *Index) error {
+		if ix.Key != n || ix.Offset != uint32(n) {
+			t.Errorf("index: %s not match %d", ix, n)
+		}
+		n++
+		return nil
+	}); err != nil || n != count {
+		t.Errorf("Recovery() error(%v) indexes: %d", err, n)
+		t.FailNow()
+	}
+	for n = count; n < count+_frameIndexes; n++ {
+		if err = i.Write(n, uint32(n), 8); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+	}
+	if err = i.Flush(); err != nil {
+		t.Errorf("Flush() error(%v)", err)
+		t.FailNow()
+	}
+	n = 0
+	if err = i.Recovery(func(ix *Index) error {
+		if ix.Key != n {
+			t.Errorf("index: %s not match %d", ix, n)
+		}
+		n++
+		return nil
+	}); err != nil || n != count+_frameIndexes {
+		t.Errorf("Recovery() error(%v) indexes: %d", err, n)
+		t.FailNow()
+	}
+	if len(i.tail) != 100*_indexSize {
+		t.Errorf("index tail: %d not match", len(i.tail))
+		t.FailNow()
+	}
+}
+
+func TestIndexAdaptiveFlush(t *testing.T) {
+	var (
+		i    *Indexer
+		err  error
+		file = "../test/test_flush.idx"
+		c    = *testConf
+		ic   = *testConf.Index
+	)
+	// never written by SyncWrite
+	ic.SyncWrite = 1000
+	ic.FlushDelay = conf.Duration{Duration: 100 * time.Millisecond}
+	ic.FlushBytes = 4 * _indexSize
+	c.Index = &ic
+	os.Remove(file)
+	defer os.Remove(file)
+	if i, err = NewIndexer(file, &c); err != nil {
+		t.Errorf("NewIndexer() error(%v)", err)
+		t.FailNow()
+	}
+	defer i.Close()
+	// the low traffic, written by the time
+	if err = i.Add(1, 1, 8); err != nil {
+		t.Errorf("Add() error(%v)", err)
+		t.FailNow()
+	}
+	time.Sleep(300 * time.Millisecond)
+	if i.Written() != _indexSize {
+		t.Errorf("offset: %d, not written by FlushDelay", i.Written())
+		t.FailNow()
+	}
+	// the high traffic, signaled and written by the bytes
+	for key := int64(2); key < 6; key++ {
+		if err = i.Add(key, uint32(key), 8); err != nil {
+			t.Errorf("Add() error(%v)", err)
+			t.FailNow()
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if i.Written() != 5*_indexSize {
+		t.Errorf("offset: %d, not written by FlushBytes", i.Written())
+		t.FailNow()
+	}
+}
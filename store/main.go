@@ -1,27 +1,40 @@
 package main
 
 import (
+	"bfs/libs/check"
+	"bfs/libs/log"
+	"bfs/libs/meta"
+	"bfs/libs/trace"
+	"bfs/libs/upgrade"
 	"bfs/store/conf"
 	"flag"
-	log "github.com/golang/glog"
+	"fmt"
+	"os"
 )
 
 var (
 	configFile string
+	testConfig bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "c", "./store.toml", " set store config file path")
+	flag.BoolVar(&testConfig, "t", false, " test config and exit")
 }
 
 func main() {
 	var (
 		c      *conf.Config
+		r      *meta.Register
 		store  *Store
 		server *Server
 		err    error
 	)
 	flag.Parse()
+	if testConfig {
+		checkConf()
+		return
+	}
 	defer log.Flush()
 	log.Infof("bfs store[%s] start", Ver)
 	defer log.Infof("bfs store[%s] stop", Ver)
@@ -29,16 +42,59 @@ func main() {
 		log.Errorf("NewConfig(\"%s\") error(%v)", configFile, err)
 		return
 	}
+	if err = log.Init(c.Log); err != nil {
+		log.Errorf("log.Init() error(%v)", err)
+		return
+	}
+	if err = trace.Init(c.Tracing, "bfs-store"); err != nil {
+		log.Errorf("trace.Init() error(%v)", err)
+		return
+	}
+	defer trace.Close()
+	if r, err = register(c); err != nil {
+		return
+	}
 	if store, err = NewStore(c); err != nil {
 		return
 	}
+	if r != nil {
+		if err = store.Bootstrap(r); err != nil {
+			return
+		}
+	}
 	if server, err = NewServer(store, c); err != nil {
 		return
 	}
 	if err = store.SetZookeeper(); err != nil {
 		return
 	}
+	// the old process drains and exits if upgraded
+	if err = upgrade.Ready(); err != nil {
+		return
+	}
 	log.Infof("wait signal...")
 	StartSignal(store, server)
 	return
 }
+
+// checkConf parse and check the config, zookeeper reachability, then print
+// the effective config, exit non-zero if any problem found.
+func checkConf() {
+	var (
+		c   *conf.Config
+		err error
+	)
+	if c, err = conf.NewConfig(configFile); err == nil {
+		if err = c.Check(); err == nil {
+			ck := check.New()
+			ck.Dial("Zookeeper.Addrs", c.Zookeeper.Addrs, c.Zookeeper.Timeout.Duration)
+			err = ck.Err()
+		}
+		check.Print(os.Stdout, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config file %s test failed:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "config file %s test is successful\n", configFile)
+}
@@ -346,6 +346,31 @@ func (n *Needle) ParseFrom(rd *bufio.Reader) (err error) {
 	return
 }
 
+// ParseBytes parse a needle from the head of buf, used in scan block from
+// the memory, io.ErrUnexpectedEOF if buf has no whole needle, the needle
+// refers to buf.
+func (n *Needle) ParseBytes(buf []byte) (err error) {
+	var footerOffset int32
+	if len(buf) < _headerSize {
+		return io.ErrUnexpectedEOF
+	}
+	if err = n.parseHeader(buf[:_headerSize]); err != nil {
+		return
+	}
+	if len(buf) < int(n.TotalSize) {
+		return io.ErrUnexpectedEOF
+	}
+	footerOffset = _headerSize + n.Size
+	if err = n.parseData(buf[_headerSize:footerOffset]); err != nil {
+		return
+	}
+	if err = n.parseFooter(buf[footerOffset:n.TotalSize]); err != nil {
+		return
+	}
+	n.buffer = buf[:n.TotalSize]
+	return
+}
+
 // parse Parse needle from inner buffer, usually call after ReadAt.
 func (n *Needle) Parse() (err error) {
 	var dataOffset int32
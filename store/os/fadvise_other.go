@@ -1,4 +1,5 @@
-// +build darwin
+//go:build !linux
+
 package os
 
 const (
@@ -10,6 +11,7 @@ const (
 	POSIX_FADV_DONTNEED   = 0
 )
 
-func Fadvise(fd uintptr, off int64, len int64, advise int) (err error) {
+// Fadvise the advices are only hints, ignored.
+func Fadvise(fd uintptr, off int64, size int64, advise int) (err error) {
 	return
 }
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package os
+
+const (
+	FALLOC_FL_KEEP_SIZE = uint32(0x01) /* default is extend size */
+)
+
+// Fallocate the portable preallocation, the file is extended by truncate,
+// the space is not reserved ahead with FALLOC_FL_KEEP_SIZE, the size must
+// be kept.
+func Fallocate(fd uintptr, mode uint32, off int64, size int64) (err error) {
+	var cur int64
+	if mode&FALLOC_FL_KEEP_SIZE != 0 {
+		return
+	}
+	if cur, err = fsize(fd); err != nil || cur >= off+size {
+		return
+	}
+	return ftruncate(fd, off+size)
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+
+package os
+
+import (
+	"syscall"
+)
+
+func fsize(fd uintptr) (size int64, err error) {
+	var st syscall.Stat_t
+	if err = syscall.Fstat(int(fd), &st); err == nil {
+		size = st.Size
+	}
+	return
+}
+
+func ftruncate(fd uintptr, size int64) error {
+	return syscall.Ftruncate(int(fd), size)
+}
+
+func fsync(fd uintptr) error {
+	return syscall.Fsync(int(fd))
+}
@@ -0,0 +1,23 @@
+package os
+
+import (
+	"syscall"
+)
+
+func fsize(fd uintptr) (size int64, err error) {
+	var fi syscall.ByHandleFileInformation
+	if err = syscall.GetFileInformationByHandle(syscall.Handle(fd), &fi); err == nil {
+		size = int64(fi.FileSizeHigh)<<32 | int64(fi.FileSizeLow)
+	}
+	return
+}
+
+// ftruncate the file pointer is kept.
+func ftruncate(fd uintptr, size int64) error {
+	return syscall.Ftruncate(syscall.Handle(fd), size)
+}
+
+// fsync FlushFileBuffers.
+func fsync(fd uintptr) error {
+	return syscall.Fsync(syscall.Handle(fd))
+}
@@ -1,6 +0,0 @@
-// +build darwin
-package os
-
-func Fdatasync(fd uintptr) (err error) {
-	return
-}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package os
+
+// Fdatasync the data and the metadata are synced.
+func Fdatasync(fd uintptr) (err error) {
+	return fsync(fd)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package os
+
+const (
+	O_NOATIME = 0 // no O_NOATIME
+)
@@ -1,4 +1,5 @@
-// +build darwin
+//go:build !linux
+
 package os
 
 const (
@@ -7,6 +8,8 @@ const (
 	SYNC_FILE_RANGE_WAIT_AFTER  = 4
 )
 
+// Syncfilerange the write back is only started, the Fdatasync later syncs
+// the range, ignored.
 func Syncfilerange(fd uintptr, off int64, n int64, flags int) (err error) {
 	return
 }
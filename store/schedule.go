@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bfs/libs/log"
+	xtime "bfs/libs/time"
+	"bfs/store/conf"
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// the interval to recheck a closed window
+	_scheduleCheck = time.Minute
+)
+
+// scheduler run the background jobs, the automatic compaction and the scrub,
+// only in the windows, at most MaxJobs at the same time, and cap their io.
+type scheduler struct {
+	windows []*xtime.Window // any time if empty
+	jobs    chan struct{}   // the job slots, unlimited if nil
+	bl      *rate.Limiter   // the bandwidth, unlimited if nil
+}
+
+// newScheduler new a scheduler, nil c runs the jobs any time.
+func newScheduler(c *conf.Schedule) (s *scheduler) {
+	var (
+		err error
+		w   *xtime.Window
+	)
+	s = &scheduler{}
+	if c == nil {
+		return
+	}
+	for _, ws := range c.Windows {
+		if w, err = xtime.ParseWindow(ws); err != nil {
+			// never happen, checked by the config
+			log.Errorf("xtime.ParseWindow(%s) error(%v)", ws, err)
+			continue
+		}
+		s.windows = append(s.windows, w)
+	}
+	if c.MaxJobs > 0 {
+		s.jobs = make(chan struct{}, c.MaxJobs)
+	}
+	if c.Bandwidth > 0 {
+		s.bl = rate.NewLimiter(rate.Limit(c.Bandwidth), c.Bandwidth)
+	}
+	return
+}
+
+// open reports whether t is in any window.
+func (s *scheduler) open(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	for _, w := range s.windows {
+		if w.In(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// pause block until a window opens.
+func (s *scheduler) pause() {
+	for !s.open(time.Now()) {
+		time.Sleep(_scheduleCheck)
+	}
+}
+
+// wait block until a window opens and a job slot is free, done must be
+// called when the job finishes.
+func (s *scheduler) wait() {
+	s.pause()
+	if s.jobs != nil {
+		s.jobs <- struct{}{}
+	}
+}
+
+// done free the job slot.
+func (s *scheduler) done() {
+	if s.jobs != nil {
+		<-s.jobs
+	}
+}
+
+// throttle pace a job before it reads n bytes, paused out of the windows.
+func (s *scheduler) throttle(n int32) {
+	s.pause()
+	s.limit(n)
+}
+
+// limit pace a job before it reads n bytes by the bandwidth only, for the
+// jobs asked by the admin, which run at once.
+func (s *scheduler) limit(n int32) {
+	if s.bl == nil {
+		return
+	}
+	if int(n) > s.bl.Burst() {
+		n = int32(s.bl.Burst())
+	}
+	s.bl.WaitN(context.Background(), int(n))
+}
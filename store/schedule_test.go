@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bfs/store/conf"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	var (
+		s   *scheduler
+		now = time.Date(2016, 10, 17, 2, 0, 0, 0, time.Local) // a Monday
+	)
+	if s = newScheduler(nil); !s.open(now) {
+		t.Error("nil schedule closed")
+		t.FailNow()
+	}
+	s.wait()
+	s.throttle(1024)
+	s.done()
+	s = newScheduler(&conf.Schedule{
+		Windows:   []string{"Mon-Fri 01:00-06:00", "Sat,Sun 00:00-24:00"},
+		MaxJobs:   1,
+		Bandwidth: 1024,
+	})
+	if !s.open(now) || s.open(now.Add(6*time.Hour)) || !s.open(now.Add(5*24*time.Hour+12*time.Hour)) {
+		t.Error("schedule windows not matched")
+		t.FailNow()
+	}
+	s.jobs <- struct{}{}
+	select {
+	case s.jobs <- struct{}{}:
+		t.Error("schedule MaxJobs exceeded")
+		t.FailNow()
+	default:
+	}
+	s.done()
+	// a needle larger than the burst
+	s.limit(4096)
+}
@@ -1,35 +1,58 @@
 package main
 
 import (
-	log "github.com/golang/glog"
 	"os"
 	"os/signal"
 	"syscall"
+
+	"bfs/libs/log"
 )
 
 // StartSignal register signals handler.
 func StartSignal(store *Store, server *Server) {
 	var (
-		c chan os.Signal
-		s os.Signal
+		c    chan os.Signal
+		s    os.Signal
+		sigs = append([]os.Signal{syscall.SIGHUP}, _stopSignals...)
 	)
+	if _upgradeSignal != nil {
+		sigs = append(sigs, _upgradeSignal)
+	}
 	c = make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM,
-		syscall.SIGINT, syscall.SIGSTOP)
+	signal.Notify(c, sigs...)
 	// Block until a signal is received.
 	for {
 		s = <-c
 		log.Infof("get a signal %s", s.String())
-		switch s {
-		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGSTOP, syscall.SIGINT:
+		switch {
+		case stopSignal(s):
 			server.Close()
 			store.Close()
 			return
-		case syscall.SIGHUP:
+		case s == _upgradeSignal:
+			// upgrade to the new binary in place
+			if err := server.Upgrade(); err != nil {
+				log.Errorf("upgrade error(%v)", err)
+				continue
+			}
+			store.Close()
+			return
+		case s == syscall.SIGHUP:
 			// TODO reload
-			//return
+			// reopen the rotated audit file
+			server.audit.reopen()
 		default:
 			return
 		}
 	}
 }
+
+// stopSignal reports whether the signal stops the store.
+func stopSignal(s os.Signal) bool {
+	for _, ss := range _stopSignals {
+		if s == ss {
+			return true
+		}
+	}
+	return false
+}
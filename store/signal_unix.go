@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// the signals stopping the store
+	_stopSignals = []os.Signal{syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGSTOP, syscall.SIGINT}
+	// the signal upgrading the binary in place, nil if not supported
+	_upgradeSignal os.Signal = syscall.SIGUSR2
+)
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// the signals stopping the store
+	_stopSignals = []os.Signal{syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT}
+	// no in place upgrade, the listeners can't be passed to the new process
+	_upgradeSignal os.Signal
+)
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"bfs/libs/addr"
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/meta"
+	"bfs/store/backend"
 	"bfs/store/conf"
 	myos "bfs/store/os"
 	"bfs/store/volume"
 	myzk "bfs/store/zk"
 	"fmt"
-	log "github.com/golang/glog"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -44,6 +49,8 @@ const (
 
 var (
 	_compactSleep = time.Second * 10
+	// the interval to look for the volumes due to scrub
+	_scrubCheck = time.Hour
 )
 
 // Store save volumes.
@@ -51,12 +58,20 @@ type Store struct {
 	vf          *os.File
 	fvf         *os.File
 	FreeId      int32
-	Volumes     map[int32]*volume.Volume // split volumes lock
 	FreeVolumes []*volume.Volume
 	zk          *myzk.Zookeeper
 	conf        *conf.Config
+	backend     backend.Backend
 	flock       sync.Mutex // protect FreeId & saveIndex
-	vlock       sync.Mutex // protect Volumes map
+	vlock       sync.Mutex // protect volumes map updates
+	// map[int32]*volume.Volume replaced by copy-on-write, so the lookups of
+	// the requests never take a lock, each volume has its own locks.
+	volumes atomic.Value
+	// handed over to the new process of an upgrade, the volumes and the free
+	// volumes are not changed, protected by both vlock and flock
+	handover bool
+	// the windows and the bandwidth of the compaction and the scrub
+	sched *scheduler
 }
 
 // NewStore
@@ -66,8 +81,13 @@ func NewStore(c *conf.Config) (s *Store, err error) {
 		return
 	}
 	s.conf = c
+	if s.backend, err = backend.Get(c.Backend); err != nil {
+		log.Errorf("backend.Get(\"%s\") error(%v)", c.Backend, err)
+		return
+	}
 	s.FreeId = 0
-	s.Volumes = make(map[int32]*volume.Volume)
+	s.sched = newScheduler(c.Schedule)
+	s.volumes.Store(make(map[int32]*volume.Volume))
 	if s.vf, err = os.OpenFile(c.Store.VolumeIndex, os.O_RDWR|os.O_CREATE|myos.O_NOATIME, 0664); err != nil {
 		log.Errorf("os.OpenFile(\"%s\") error(%v)", c.Store.VolumeIndex, err)
 		s.Close()
@@ -82,6 +102,12 @@ func NewStore(c *conf.Config) (s *Store, err error) {
 		s.Close()
 		return nil, err
 	}
+	if c.Volume.CompactRatio > 0 {
+		go s.compactproc()
+	}
+	if c.Schedule != nil && c.Schedule.Scrub.Duration > 0 {
+		go s.scrubproc()
+	}
 	return
 }
 
@@ -163,13 +189,13 @@ func (s *Store) parseVolumeIndex() (err error) {
 	// local index
 	for i = 0; i < len(lbfs); i++ {
 		id, bfile, ifile = lids[i], lbfs[i], lifs[i]
-		if _, ok = s.Volumes[id]; ok {
+		if s.Volume(id) != nil {
 			continue
 		}
 		if v, err = newVolume(id, bfile, ifile, s.conf); err != nil {
 			return
 		}
-		s.Volumes[id] = v
+		s.addVolume(id, v)
 		if _, ok = zim[id]; !ok {
 			if err = s.zk.AddVolume(id, v.Meta()); err != nil {
 				return
@@ -183,7 +209,7 @@ func (s *Store) parseVolumeIndex() (err error) {
 	// zk index
 	for i = 0; i < len(zbfs); i++ {
 		id, bfile, ifile = zids[i], zbfs[i], zifs[i]
-		if _, ok = s.Volumes[id]; ok {
+		if s.Volume(id) != nil {
 			continue
 		}
 		// if not exists in local
@@ -191,7 +217,7 @@ func (s *Store) parseVolumeIndex() (err error) {
 			if v, err = newVolume(id, bfile, ifile, s.conf); err != nil {
 				return
 			}
-			s.Volumes[id] = v
+			s.addVolume(id, v)
 		}
 	}
 	err = s.saveVolumeIndex()
@@ -271,7 +297,7 @@ func (s *Store) saveVolumeIndex() (err error) {
 		log.Errorf("vf.Seek() error(%v)", err)
 		return
 	}
-	for _, v = range s.Volumes {
+	for _, v = range s.Volumes() {
 		if n, err = s.vf.WriteString(fmt.Sprintf("%s\n", string(v.Meta()))); err != nil {
 			log.Errorf("vf.WriteString() error(%v)", err)
 			return
@@ -290,12 +316,22 @@ func (s *Store) saveVolumeIndex() (err error) {
 
 // SetZookeeper set zookeeper store meta.
 func (s *Store) SetZookeeper() (err error) {
+	var st = new(meta.Store)
+	// the addrs dialed by the directory, the proxies and the pitchfork
+	if st.Stat, err = addr.Advertise(s.conf.StatListen, s.conf.Advertise); err != nil {
+		log.Errorf("addr.Advertise(%s) error(%v)", s.conf.StatListen, err)
+		return
+	}
+	if st.Admin, err = addr.Advertise(s.conf.AdminListen, s.conf.Advertise); err != nil {
+		log.Errorf("addr.Advertise(%s) error(%v)", s.conf.AdminListen, err)
+		return
+	}
+	if st.Api, err = addr.Advertise(s.conf.ApiListen, s.conf.Advertise); err != nil {
+		log.Errorf("addr.Advertise(%s) error(%v)", s.conf.ApiListen, err)
+		return
+	}
 	// update zk store meta
-	if err = s.zk.SetStore(&meta.Store{
-		Stat:  s.conf.StatListen,
-		Admin: s.conf.AdminListen,
-		Api:   s.conf.ApiListen,
-	}); err != nil {
+	if err = s.zk.SetStore(st); err != nil {
 		log.Errorf("zk.SetStore() error(%v)", err)
 		return
 	}
@@ -344,16 +380,20 @@ func (s *Store) AddFreeVolume(n int, bdir, idir string) (sn int, err error) {
 		v            *volume.Volume
 	)
 	s.flock.Lock()
+	if s.handover {
+		s.flock.Unlock()
+		return 0, errors.ErrVolumeHandover
+	}
 	for i = 0; i < n; i++ {
 		s.FreeId++
 		bfile, ifile = s.freeFile(s.FreeId, bdir, idir)
-		if myos.Exist(bfile) || myos.Exist(ifile) {
+		if s.backend.Exist(bfile) || s.backend.Exist(ifile) {
 			continue
 		}
 		if v, err = newVolume(volumeFreeId, bfile, ifile, s.conf); err != nil {
 			// if no free space, delete the file
-			os.Remove(bfile)
-			os.Remove(ifile)
+			s.backend.Remove(bfile)
+			s.backend.Remove(ifile)
 			break
 		}
 		v.Close()
@@ -373,6 +413,10 @@ func (s *Store) freeVolume(id int32) (v *volume.Volume, err error) {
 	)
 	s.flock.Lock()
 	defer s.flock.Unlock()
+	if s.handover {
+		err = errors.ErrVolumeHandover
+		return
+	}
 	if len(s.FreeVolumes) == 0 {
 		err = errors.ErrStoreNoFreeVolume
 		return
@@ -384,20 +428,20 @@ func (s *Store) freeVolume(id int32) (v *volume.Volume, err error) {
 	bdir, idir = filepath.Dir(bfile), filepath.Dir(ifile)
 	for {
 		nbfile, nifile = s.file(id, bdir, idir, i)
-		if !myos.Exist(nbfile) && !myos.Exist(nifile) {
+		if !s.backend.Exist(nbfile) && !s.backend.Exist(nifile) {
 			break
 		}
 		i++
 	}
 	log.Infof("rename block: %s to %s", bfile, nbfile)
 	log.Infof("rename index: %s to %s", ifile, nifile)
-	if err = os.Rename(ifile, nifile); err != nil {
-		log.Errorf("os.Rename(\"%s\", \"%s\") error(%v)", ifile, nifile, err)
+	if err = s.backend.Rename(ifile, nifile); err != nil {
+		log.Errorf("backend.Rename(\"%s\", \"%s\") error(%v)", ifile, nifile, err)
 		v.Destroy()
 		return
 	}
-	if err = os.Rename(bfile, nbfile); err != nil {
-		log.Errorf("os.Rename(\"%s\", \"%s\") error(%v)", bfile, nbfile, err)
+	if err = s.backend.Rename(bfile, nbfile); err != nil {
+		log.Errorf("backend.Rename(\"%s\", \"%s\") error(%v)", bfile, nbfile, err)
 		v.Destroy()
 		return
 	}
@@ -411,26 +455,37 @@ func (s *Store) freeVolume(id int32) (v *volume.Volume, err error) {
 	return
 }
 
+// Volume get the volume by id without any lock.
+func (s *Store) Volume(id int32) *volume.Volume {
+	return s.Volumes()[id]
+}
+
+// Volumes get the current volumes, the map must not be modified.
+func (s *Store) Volumes() map[int32]*volume.Volume {
+	return s.volumes.Load().(map[int32]*volume.Volume)
+}
+
 // addVolume atomic add volume by copy-on-write.
 func (s *Store) addVolume(id int32, nv *volume.Volume) {
 	var (
 		vid     int32
 		v       *volume.Volume
-		volumes = make(map[int32]*volume.Volume, len(s.Volumes)+1)
+		ovs     = s.Volumes()
+		volumes = make(map[int32]*volume.Volume, len(ovs)+1)
 	)
-	for vid, v = range s.Volumes {
+	for vid, v = range ovs {
 		volumes[vid] = v
 	}
 	volumes[id] = nv
 	// goroutine safe replace
-	s.Volumes = volumes
+	s.volumes.Store(volumes)
 }
 
 // AddVolume add a new volume.
 func (s *Store) AddVolume(id int32) (v *volume.Volume, err error) {
 	var ov *volume.Volume
 	// try check exists
-	if ov = s.Volumes[id]; ov != nil {
+	if ov = s.Volume(id); ov != nil {
 		return nil, errors.ErrVolumeExist
 	}
 	// find a free volume
@@ -438,7 +493,9 @@ func (s *Store) AddVolume(id int32) (v *volume.Volume, err error) {
 		return
 	}
 	s.vlock.Lock()
-	if ov = s.Volumes[id]; ov == nil {
+	if s.handover {
+		err = errors.ErrVolumeHandover
+	} else if ov = s.Volume(id); ov == nil {
 		s.addVolume(id, v)
 		if err = s.saveVolumeIndex(); err == nil {
 			err = s.zk.AddVolume(id, v.Meta())
@@ -450,7 +507,7 @@ func (s *Store) AddVolume(id int32) (v *volume.Volume, err error) {
 		err = errors.ErrVolumeExist
 	}
 	s.vlock.Unlock()
-	if err == errors.ErrVolumeExist {
+	if err == errors.ErrVolumeExist || err == errors.ErrVolumeHandover {
 		v.Destroy()
 	}
 	return
@@ -461,21 +518,26 @@ func (s *Store) delVolume(id int32) {
 	var (
 		vid     int32
 		v       *volume.Volume
-		volumes = make(map[int32]*volume.Volume, len(s.Volumes)-1)
+		ovs     = s.Volumes()
+		volumes = make(map[int32]*volume.Volume, len(ovs))
 	)
-	for vid, v = range s.Volumes {
+	for vid, v = range ovs {
 		volumes[vid] = v
 	}
 	delete(volumes, id)
 	// goroutine safe replace
-	s.Volumes = volumes
+	s.volumes.Store(volumes)
 }
 
 // DelVolume del the volume by volume id.
 func (s *Store) DelVolume(id int32) (err error) {
 	var v *volume.Volume
 	s.vlock.Lock()
-	if v = s.Volumes[id]; v != nil {
+	if s.handover {
+		s.vlock.Unlock()
+		return errors.ErrVolumeHandover
+	}
+	if v = s.Volume(id); v != nil {
 		if !v.Compact {
 			s.delVolume(id)
 			if err = s.saveVolumeIndex(); err == nil {
@@ -507,7 +569,9 @@ func (s *Store) BulkVolume(id int32, bfile, ifile string) (err error) {
 		return
 	}
 	s.vlock.Lock()
-	if v = s.Volumes[id]; v == nil {
+	if s.handover {
+		err = errors.ErrVolumeHandover
+	} else if v = s.Volume(id); v == nil {
 		s.addVolume(id, nv)
 		if err = s.saveVolumeIndex(); err == nil {
 			err = s.zk.AddVolume(id, nv.Meta())
@@ -522,14 +586,57 @@ func (s *Store) BulkVolume(id int32, bfile, ifile string) (err error) {
 	return
 }
 
-// CompactVolume compact a super block to another file.
+// CloneVolume clone the raw needles from r to a free volume as the volume
+// id, r streams a local volume or a remote store, the clone is added only
+// after verified, n is the live needles cloned.
+func (s *Store) CloneVolume(id int32, r io.Reader, live bool) (n int, err error) {
+	var v *volume.Volume
+	if s.Volume(id) != nil {
+		return 0, errors.ErrVolumeExist
+	}
+	if v, err = s.freeVolume(id); err != nil {
+		return
+	}
+	if n, err = v.Clone(r, live); err != nil {
+		log.Errorf("clone volume: %d error(%v)", id, err)
+		v.Destroy()
+		return
+	}
+	s.vlock.Lock()
+	if s.handover {
+		err = errors.ErrVolumeHandover
+	} else if s.Volume(id) == nil {
+		s.addVolume(id, v)
+		if err = s.saveVolumeIndex(); err == nil {
+			err = s.zk.AddVolume(id, v.Meta())
+		}
+		if err != nil {
+			log.Errorf("clone volume: %d error(%v), local index or zookeeper index may save failed", id, err)
+		}
+	} else {
+		err = errors.ErrVolumeExist
+	}
+	s.vlock.Unlock()
+	if err == errors.ErrVolumeExist || err == errors.ErrVolumeHandover {
+		v.Destroy()
+	}
+	return
+}
+
+// CompactVolume compact a super block to another file at once, capped by
+// the bandwidth of the schedule.
 func (s *Store) CompactVolume(id int32) (err error) {
+	return s.compactVolume(id, s.sched.limit)
+}
+
+// compactVolume compact a super block to another file, paced by throttle.
+func (s *Store) compactVolume(id int32, throttle func(int32)) (err error) {
 	var (
 		v, nv      *volume.Volume
 		bdir, idir string
 	)
 	// try check volume
-	if v = s.Volumes[id]; v != nil {
+	if v = s.Volume(id); v != nil {
 		if v.Compact {
 			return errors.ErrVolumeInCompact
 		}
@@ -542,13 +649,13 @@ func (s *Store) CompactVolume(id int32) (err error) {
 	}
 	log.Infof("start compact volume: (%d) %s to %s", id, v.Block.File, nv.Block.File)
 	// no lock here, Compact is no side-effect
-	if err = v.StartCompact(nv); err != nil {
+	if err = v.StartCompact(nv, throttle); err != nil {
 		nv.Destroy()
 		v.StopCompact(nil)
 		return
 	}
 	s.vlock.Lock()
-	if v = s.Volumes[id]; v != nil {
+	if v = s.Volume(id); v != nil {
 		log.Infof("stop compact volume: (%d) %s to %s", id, v.Block.File, nv.Block.File)
 		if err = v.StopCompact(nv); err == nil {
 			// WARN no need update volumes map, use same object, only update
@@ -577,6 +684,145 @@ func (s *Store) CompactVolume(id int32) (err error) {
 	return
 }
 
+// compactproc compact the volumes with the garbage ratio over the
+// threshold one at a time, the most garbage first, in the windows of the
+// schedule.
+func (s *Store) compactproc() {
+	var (
+		err    error
+		r      float64
+		v      *volume.Volume
+		vs     []*volume.Volume
+		ratios = make(map[int32]float64)
+	)
+	for {
+		time.Sleep(s.conf.Volume.CompactCheck.Duration)
+		vs = vs[:0]
+		for _, v = range s.Volumes() {
+			if r = v.Garbage(); !v.Compact && r >= s.conf.Volume.CompactRatio {
+				vs = append(vs, v)
+				ratios[v.Id] = r
+			}
+		}
+		sort.Slice(vs, func(i, j int) bool { return ratios[vs[i].Id] > ratios[vs[j].Id] })
+		for _, v = range vs {
+			s.sched.wait()
+			log.Infof("auto compact volume: %d garbage: %.2f", v.Id, ratios[v.Id])
+			if err = s.compactVolume(v.Id, s.sched.throttle); err != nil {
+				log.Errorf("auto compact volume: %d error(%v)", v.Id, err)
+			}
+			s.sched.done()
+		}
+	}
+}
+
+// scrubproc read back and verify the volumes not scrubbed in the last
+// Schedule.Scrub, in the windows of the schedule, at most MaxJobs at the
+// same time with the compaction.
+func (s *Store) scrubproc() {
+	var (
+		due int64
+		v   *volume.Volume
+		wg  sync.WaitGroup
+	)
+	for {
+		due = time.Now().Add(-s.conf.Schedule.Scrub.Duration).UnixNano()
+		for _, v = range s.Volumes() {
+			if v.Compact || v.ScrubTime > due {
+				continue
+			}
+			s.sched.wait()
+			wg.Add(1)
+			go func(v *volume.Volume) {
+				log.Infof("scrub volume: %d", v.Id)
+				if err := v.Scrub(s.sched.throttle); err != nil {
+					log.Errorf("scrub volume: %d error(%v)", v.Id, err)
+				}
+				s.sched.done()
+				wg.Done()
+			}(v)
+		}
+		wg.Wait()
+		time.Sleep(_scrubCheck)
+	}
+}
+
+// Handover hand the volumes over to the new process of an upgrade, the
+// writes are refused and the indexes flushed, the volumes handed over are
+// resumed if any fails, e.g. in compacting.
+func (s *Store) Handover() (err error) {
+	var v *volume.Volume
+	s.vlock.Lock()
+	s.flock.Lock()
+	s.handover = true
+	s.flock.Unlock()
+	s.vlock.Unlock()
+	for _, v = range s.Volumes() {
+		if err = v.Handover(); err != nil {
+			log.Errorf("volume: %d handover error(%v)", v.Id, err)
+			s.Resume()
+			return
+		}
+	}
+	log.Info("store handover")
+	return
+}
+
+// Resume resume the volumes handed over, if the upgrade failed.
+func (s *Store) Resume() {
+	var (
+		err error
+		v   *volume.Volume
+	)
+	for _, v = range s.Volumes() {
+		if err = v.Resume(); err != nil {
+			log.Errorf("volume: %d resume error(%v)", v.Id, err)
+		}
+	}
+	s.vlock.Lock()
+	s.flock.Lock()
+	s.handover = false
+	s.flock.Unlock()
+	s.vlock.Unlock()
+	log.Info("store resume")
+}
+
+// Recovered check the volumes are recovered, none is reopening or handed
+// over to an upgrade.
+func (s *Store) Recovered() (err error) {
+	var v *volume.Volume
+	s.vlock.Lock()
+	if s.handover {
+		err = errors.ErrVolumeHandover
+	}
+	s.vlock.Unlock()
+	if err != nil {
+		return
+	}
+	for _, v = range s.Volumes() {
+		if v.IsClosed() {
+			return fmt.Errorf("volume: %d recovering", v.Id)
+		}
+	}
+	return
+}
+
+// Writable check any volume takes the writes.
+func (s *Store) Writable() (err error) {
+	var v *volume.Volume
+	for _, v = range s.Volumes() {
+		if v.Writable() {
+			return
+		}
+	}
+	return fmt.Errorf("no writable volume")
+}
+
+// Ping check the zookeeper connection.
+func (s *Store) Ping() error {
+	return s.zk.Ping()
+}
+
 // Close close the store.
 // WARN the global variable store must first set nil and reject any other
 // requests then safty close.
@@ -589,7 +835,7 @@ func (s *Store) Close() {
 	if s.fvf != nil {
 		s.fvf.Close()
 	}
-	for _, v = range s.Volumes {
+	for _, v = range s.Volumes() {
 		log.Infof("volume[%d] close", v.Id)
 		v.Close()
 	}
@@ -70,7 +70,7 @@ func TestStore(t *testing.T) {
 		t.Errorf("AddVolume() error(%v)", err)
 		t.FailNow()
 	}
-	if v = s.Volumes[1]; v == nil {
+	if v = s.Volume(1); v == nil {
 		t.Error("Volume(1) not exist")
 		t.FailNow()
 	}
@@ -92,7 +92,7 @@ func TestStore(t *testing.T) {
 		t.Errorf("Bulk(1) error(%v)", err)
 		t.FailNow()
 	}
-	if v = s.Volumes[2]; v == nil {
+	if v = s.Volume(2); v == nil {
 		t.Error("Volume(2) not exist")
 		t.FailNow()
 	}
@@ -116,7 +116,7 @@ func TestStore(t *testing.T) {
 		t.Errorf("Compress(1) error(%v)", err)
 		t.FailNow()
 	}
-	if v = s.Volumes[1]; v == nil {
+	if v = s.Volume(1); v == nil {
 		t.Error("Volume(1) not exist")
 		t.FailNow()
 	}
@@ -127,7 +127,7 @@ func TestStore(t *testing.T) {
 		n.Close()
 	}
 	s.DelVolume(1)
-	if v = s.Volumes[1]; v != nil {
+	if v = s.Volume(1); v != nil {
 		t.Error(err)
 		t.FailNow()
 	}
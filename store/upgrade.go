@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bfs/libs/log"
+	"bfs/libs/upgrade"
+	"os"
+	"time"
+)
+
+const (
+	// the wait for the new process loading the volumes
+	upgradeTimeout = 10 * time.Minute
+	// the wait for the requests in flight of the old process
+	drainTimeout = 30 * time.Second
+)
+
+// Upgrade hand the listeners and the volumes over to the new binary, the
+// writes are refused until the new process is ready, then the old one
+// drains the requests in flight and must exit, the volumes are resumed if
+// the upgrade failed.
+func (s *Server) Upgrade() (err error) {
+	var (
+		p  *os.Process
+		fs map[string]*os.File
+	)
+	if fs, err = upgrade.Files(s.listeners()); err != nil {
+		return
+	}
+	defer upgrade.Close(fs)
+	if err = s.store.Handover(); err != nil {
+		return
+	}
+	if p, err = upgrade.Start(fs, upgradeTimeout); err != nil {
+		s.store.Resume()
+		return
+	}
+	log.Infof("upgrade: drain the requests, the new process(%d) serves", p.Pid)
+	s.Shutdown(drainTimeout)
+	return
+}
@@ -0,0 +1,63 @@
+package volume
+
+import (
+	"bfs/store/needle"
+	"sync/atomic"
+	"time"
+)
+
+// access record the access time of the key for the tiering, one of every
+// Volume.AccessSample reads is recorded, the writes always are.
+func (v *Volume) access(key int64, read bool) {
+	var sample = v.conf.Volume.AccessSample
+	if sample <= 0 || (read && atomic.AddUint64(&v.accesses, 1)%uint64(sample) != 0) {
+		return
+	}
+	v.alock.Lock()
+	v.atimes[key] = uint32(time.Now().Unix())
+	v.alock.Unlock()
+}
+
+// forget drop the access time of the deleted key.
+func (v *Volume) forget(key int64) {
+	if v.conf.Volume.AccessSample <= 0 {
+		return
+	}
+	v.alock.Lock()
+	delete(v.atimes, key)
+	v.alock.Unlock()
+}
+
+// Cold get at most limit keys not accessed in the age, the access times are
+// kept in memory only, so no key is cold until the volume is opened for the
+// age. a key read less than Volume.AccessSample times may look cold.
+func (v *Volume) Cold(age time.Duration, limit int) (keys []int64) {
+	var (
+		ok     bool
+		key    int64
+		nc     int64
+		at     uint32
+		offset uint32
+		before = time.Now().Add(-age).Unix()
+	)
+	if v.conf.Volume.AccessSample <= 0 || v.opened > before {
+		return
+	}
+	v.nlock.RLock()
+	v.alock.Lock()
+	for key, nc = range v.needles {
+		if len(keys) >= limit {
+			break
+		}
+		if offset, _ = needle.Cache(nc); offset == needle.CacheDelOffset {
+			continue
+		}
+		if at, ok = v.atimes[key]; ok && int64(at) > before {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	v.alock.Unlock()
+	v.nlock.RUnlock()
+	return
+}
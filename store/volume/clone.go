@@ -0,0 +1,77 @@
+package volume
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"bfs/store/needle"
+	"bufio"
+	"io"
+)
+
+// sum the cookie and the data checksum of a cloned needle.
+type sum struct {
+	cookie   int32
+	checksum uint32
+}
+
+// Clone write the needles parsed from r, the raw needles of another block,
+// to v, the deleted needles are dropped if live, then read back every live
+// needle of v to verify the checksums, n is the live needles verified.
+func (v *Volume) Clone(r io.Reader, live bool) (n int, err error) {
+	var (
+		ok   bool
+		key  int64
+		s    sum
+		nd   *needle.Needle
+		sums = make(map[int64]sum)
+		rd   = bufio.NewReaderSize(r, v.conf.Block.BufferSize)
+		rn   = new(needle.Needle)
+	)
+	for {
+		if err = rn.ParseFrom(rd); err != nil {
+			if err == io.EOF && rd.Buffered() == 0 {
+				err = nil
+			} else {
+				log.Errorf("volume: %d clone parse needle error(%v)", v.Id, err)
+			}
+			break
+		}
+		if rn.Flag == needle.FlagDel {
+			if _, ok = sums[rn.Key]; !ok && live {
+				continue
+			}
+			// keep the deletion, or drop an older live copy
+			if !live {
+				if err = v.Write(rn); err != nil {
+					break
+				}
+			}
+			if err = v.Delete(rn.Key); err != nil {
+				break
+			}
+			delete(sums, rn.Key)
+			continue
+		}
+		if err = v.Write(rn); err != nil {
+			break
+		}
+		sums[rn.Key] = sum{cookie: rn.Cookie, checksum: rn.Checksum}
+	}
+	if err != nil {
+		return
+	}
+	for key, s = range sums {
+		if nd, err = v.Read(key, s.cookie); err != nil {
+			log.Errorf("volume: %d clone verify needle: %d error(%v)", v.Id, key, err)
+			return
+		}
+		ok = nd.Checksum == s.checksum
+		nd.Close()
+		if !ok {
+			log.Errorf("volume: %d clone verify needle: %d checksum not match", v.Id, key)
+			return n, errors.ErrNeedleChecksum
+		}
+		n++
+	}
+	return
+}
@@ -0,0 +1,183 @@
+package volume
+
+import (
+	"bfs/libs/errors"
+	"bfs/store/block"
+	"bfs/store/needle"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+)
+
+const (
+	// DigestMaxRanges the max ranges of a digest.
+	DigestMaxRanges = 1024
+	// DigestMaxEntries the max entries listed by a digest.
+	DigestMaxEntries = 10000
+)
+
+// Digest the merkle style digest of the needles with the keys in
+// [Start, End), split evenly into ranges, the replicas with the same needles
+// have the same sums, so only the diverged ranges need to be compared again
+// with narrower bounds or resynced.
+type Digest struct {
+	Start  int64    `json:"start"`
+	End    int64    `json:"end"`
+	Deep   bool     `json:"deep"`
+	Count  int      `json:"count"`
+	Sum    string   `json:"sum"`
+	Ranges []*Range `json:"ranges"`
+	// the min and max keys of the volume, the bounds for the replicas
+	MinKey  int64    `json:"min_key"`
+	MaxKey  int64    `json:"max_key"`
+	Entries []*Entry `json:"entries,omitempty"`
+}
+
+// Range the digest of the needles with the keys in [Start, End).
+type Range struct {
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Count int    `json:"count"`
+	Sum   string `json:"sum"`
+}
+
+// Entry a needle of the digest, the cookie and the checksum are read from
+// the block only by a deep digest.
+type Entry struct {
+	Key      int64  `json:"key"`
+	Size     int32  `json:"size"`
+	Deleted  bool   `json:"deleted,omitempty"`
+	Cookie   int32  `json:"cookie,omitempty"`
+	Checksum uint32 `json:"checksum,omitempty"`
+	offset   uint32
+}
+
+// write write the entry to the range hash.
+func (e *Entry) write(h hash.Hash, deep bool) {
+	var buf [21]byte
+	binary.BigEndian.PutUint64(buf[0:], uint64(e.Key))
+	binary.BigEndian.PutUint32(buf[8:], uint32(e.Size))
+	if e.Deleted {
+		buf[12] = needle.FlagDel
+	}
+	if !deep {
+		h.Write(buf[:13])
+		return
+	}
+	binary.BigEndian.PutUint32(buf[13:], uint32(e.Cookie))
+	binary.BigEndian.PutUint32(buf[17:], e.Checksum)
+	h.Write(buf[:])
+}
+
+type entries []*Entry
+
+func (es entries) Len() int           { return len(es) }
+func (es entries) Less(i, j int) bool { return es[i].Key < es[j].Key }
+func (es entries) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+
+// Digest digest the needles with the keys in [start, end) in n ranges, a
+// deep digest reads every needle to compare the cookies and the data
+// checksums, list lists the entries as well.
+func (v *Volume) Digest(ctx context.Context, start, end int64, n int, deep, list bool) (d *Digest, err error) {
+	var (
+		i, j  int
+		ok    bool
+		key   int64
+		nc    int64
+		size  int32
+		off   uint32
+		width uint64
+		es    entries
+		e     *Entry
+		r     *Range
+		h     hash.Hash
+		b     *block.SuperBlock
+		root  = sha1.New()
+	)
+	if start >= end || n < 1 || n > DigestMaxRanges {
+		err = errors.ErrParam
+		return
+	}
+	d = &Digest{Start: start, End: end, Deep: deep}
+	v.nlock.RLock()
+	b = v.Block
+	for key, nc = range v.needles {
+		if !ok || key < d.MinKey {
+			d.MinKey = key
+		}
+		if !ok || key > d.MaxKey {
+			d.MaxKey = key
+		}
+		ok = true
+		if key < start || key >= end {
+			continue
+		}
+		off, size = needle.Cache(nc)
+		es = append(es, &Entry{Key: key, Size: size, Deleted: off == needle.CacheDelOffset, offset: off})
+	}
+	v.nlock.RUnlock()
+	if list && len(es) > DigestMaxEntries {
+		err = errors.ErrParam
+		return
+	}
+	sort.Sort(es)
+	for _, e = range es {
+		if !deep || e.Deleted {
+			continue
+		}
+		if err = errors.Context(ctx); err != nil {
+			return
+		}
+		if err = v.digestNeedle(b, e); err != nil {
+			return
+		}
+	}
+	// split evenly, the last range takes the remainder
+	width = (uint64(end) - uint64(start)) / uint64(n)
+	if width == 0 {
+		width = 1
+	}
+	d.Ranges = make([]*Range, 0, n)
+	for i = 0; i < n; i++ {
+		r = &Range{Start: start + int64(width*uint64(i)), End: start + int64(width*uint64(i+1))}
+		if i == n-1 || r.End > end || r.End < r.Start {
+			r.End = end
+		}
+		h = sha1.New()
+		for ; j < len(es) && es[j].Key < r.End; j++ {
+			es[j].write(h, deep)
+			r.Count++
+		}
+		r.Sum = hex.EncodeToString(h.Sum(nil))
+		root.Write([]byte(r.Sum))
+		d.Ranges = append(d.Ranges, r)
+		if r.End == end {
+			break
+		}
+	}
+	d.Count = len(es)
+	d.Sum = hex.EncodeToString(root.Sum(nil))
+	if list {
+		d.Entries = es
+	}
+	return
+}
+
+// digestNeedle read the cookie and the checksum of the needle at the offset
+// of the snapshot from its block b, the blocks are append only.
+func (v *Volume) digestNeedle(b *block.SuperBlock, e *Entry) (err error) {
+	var n = needle.NewReader(e.Key, needle.NewCache(e.offset, e.Size))
+	defer n.Close()
+	if err = b.ReadAt(n); err != nil {
+		return
+	}
+	if n.Key != e.Key {
+		return errors.ErrNeedleKey
+	}
+	e.Cookie, e.Checksum = n.Cookie, n.Checksum
+	e.Deleted = n.Flag == needle.FlagDel
+	return
+}
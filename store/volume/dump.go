@@ -0,0 +1,37 @@
+package volume
+
+import (
+	"bfs/store/backend"
+	"bfs/store/block"
+	"bfs/store/index"
+	"bfs/store/needle"
+)
+
+// ScanIndex scan the index entries of the volume by a new reader, the
+// volume is not affected.
+func (v *Volume) ScanIndex(fn func(*index.Index) error) (err error) {
+	var (
+		f  backend.File
+		ix *index.Indexer
+	)
+	v.nlock.RLock()
+	ix = v.Indexer
+	v.nlock.RUnlock()
+	if f, err = ix.Reader(); err != nil {
+		return
+	}
+	err = ix.Scan(f, fn)
+	f.Close()
+	return
+}
+
+// ScanNeedles scan the needles of the block by a new reader, so and eo are
+// the offsets of the needle and the next one.
+func (v *Volume) ScanNeedles(fn func(n *needle.Needle, so, eo uint32) error) (err error) {
+	var b *block.SuperBlock
+	v.nlock.RLock()
+	b = v.Block
+	v.nlock.RUnlock()
+	// compact scans the block by a new reader as well
+	return b.Compact(0, fn)
+}
@@ -0,0 +1,78 @@
+package volume
+
+import (
+	"bfs/libs/log"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// the deleted bytes are saved by the delete job beside the block.
+	_garbageExt = ".garbage"
+)
+
+// garbage add the bytes of a deleted or an overwritten needle.
+func (v *Volume) garbage(size int32) {
+	atomic.AddInt64(&v.DeletedBytes, int64(size))
+}
+
+// Garbage get the ratio of the deleted and the overwritten bytes in the
+// block.
+func (v *Volume) Garbage() (ratio float64) {
+	v.lock.RLock()
+	if v.Block != nil && v.Block.Size > 0 {
+		ratio = float64(atomic.LoadInt64(&v.DeletedBytes)) / float64(v.Block.Size)
+	}
+	v.lock.RUnlock()
+	return
+}
+
+// loadGarbage load the saved deleted bytes, the overwritten bytes found by
+// the recovery are used if never saved, the deletes are unknown then, the
+// file is not created until any garbage.
+func (v *Volume) loadGarbage(recovered int64) {
+	var (
+		err  error
+		n    int64
+		data []byte
+		file = v.Block.File + _garbageExt
+	)
+	v.savedBytes = 0
+	if data, err = ioutil.ReadFile(file); err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("ioutil.ReadFile(\"%s\") error(%v)", file, err)
+		}
+		v.DeletedBytes = recovered
+		return
+	}
+	if n, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		log.Errorf("volume: %d garbage: \"%s\" format error", v.Id, data)
+		v.DeletedBytes = recovered
+		return
+	}
+	v.DeletedBytes, v.savedBytes = n, n
+}
+
+// saveGarbage save the deleted bytes if changed.
+func (v *Volume) saveGarbage() {
+	var (
+		err  error
+		n    = atomic.LoadInt64(&v.DeletedBytes)
+		file = v.Block.File + _garbageExt
+	)
+	if n == v.savedBytes {
+		return
+	}
+	if err = ioutil.WriteFile(file+".tmp", []byte(strconv.FormatInt(n, 10)), 0664); err != nil {
+		log.Errorf("ioutil.WriteFile(\"%s\") error(%v)", file, err)
+		return
+	}
+	if err = os.Rename(file+".tmp", file); err != nil {
+		log.Errorf("os.Rename(\"%s\") error(%v)", file, err)
+		return
+	}
+	v.savedBytes = n
+}
@@ -0,0 +1,73 @@
+package volume
+
+import (
+	"bfs/libs/errors"
+	"bfs/libs/log"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the quota set by the admin api is saved beside the block.
+	_quotaExt = ".quota"
+)
+
+// loadQuota load the saved quota, Volume.Quota if never saved.
+func (v *Volume) loadQuota() {
+	var (
+		err  error
+		n    int64
+		data []byte
+		file = v.Block.File + _quotaExt
+	)
+	v.Quota = v.conf.Volume.Quota
+	if data, err = ioutil.ReadFile(file); err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("ioutil.ReadFile(\"%s\") error(%v)", file, err)
+		}
+		return
+	}
+	if n, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil || n < 0 {
+		log.Errorf("volume: %d quota: \"%s\" format error", v.Id, data)
+		return
+	}
+	v.Quota = n
+}
+
+// saveQuota save the quota beside the block.
+func (v *Volume) saveQuota() (err error) {
+	var file = v.Block.File + _quotaExt
+	if err = ioutil.WriteFile(file+".tmp", []byte(strconv.FormatInt(v.Quota, 10)), 0664); err != nil {
+		log.Errorf("ioutil.WriteFile(\"%s\") error(%v)", file, err)
+		return
+	}
+	if err = os.Rename(file+".tmp", file); err != nil {
+		log.Errorf("os.Rename(\"%s\") error(%v)", file, err)
+	}
+	return
+}
+
+// SetQuota set the max bytes of the block, the writes beyond it fail with
+// ErrVolumeQuota, the room left is for the compaction and the tombstones,
+// no quota if zero, saved to survive the restarts.
+func (v *Volume) SetQuota(quota int64) (err error) {
+	if quota < 0 {
+		return errors.ErrParam
+	}
+	v.lock.Lock()
+	v.Quota = quota
+	err = v.saveQuota()
+	v.lock.Unlock()
+	log.Infof("volume: %d set quota: %d error(%v)", v.Id, quota, err)
+	return
+}
+
+// checkQuota check the block has room for the bytes, must hold the lock.
+func (v *Volume) checkQuota(size int64) error {
+	if v.Quota > 0 && v.Block.Size+size > v.Quota {
+		return errors.ErrVolumeQuota
+	}
+	return nil
+}
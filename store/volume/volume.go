@@ -2,13 +2,15 @@ package volume
 
 import (
 	"bfs/libs/errors"
+	"bfs/libs/log"
 	"bfs/libs/stat"
 	"bfs/store/block"
 	"bfs/store/conf"
 	"bfs/store/index"
 	"bfs/store/needle"
+	"context"
 	"fmt"
-	log "github.com/golang/glog"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -31,8 +33,13 @@ func (p uint32Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 // An store server contains many logic Volume, volume is superblock container.
 type Volume struct {
-	wg   sync.WaitGroup
+	wg sync.WaitGroup
+	// lock serializes the appends, deletes and the status changes, the reads
+	// never take it.
 	lock sync.RWMutex
+	// nlock protects the needles map and the block, index pointers swapped by
+	// compact, it is held only for the map access, never during io.
+	nlock sync.RWMutex
 	// meta
 	Id      int32             `json:"id"`
 	Stats   *stat.Stats       `json:"stats"`
@@ -47,8 +54,30 @@ type Volume struct {
 	CompactOffset uint32 `json:"compact_offset"`
 	CompactTime   int64  `json:"compact_time"`
 	compactKeys   []int64
+	// scrub, the last time all the needles read back and verified
+	ScrubTime  int64  `json:"scrub_time"`
+	ScrubError string `json:"scrub_error,omitempty"`
+	// garbage, the bytes of the deleted and the overwritten needles
+	DeletedBytes int64   `json:"deleted_bytes"`
+	GarbageRatio float64 `json:"garbage_ratio"`
+	savedBytes   int64
+	// the max bytes of the block, no quota if zero
+	Quota int64 `json:"quota,omitempty"`
+	// warm, the sampled read counts of the keys
+	reads uint64
+	hits  map[int64]uint32
+	hot   bool
+	hlock sync.Mutex
+	// tiering, the sampled access times(unix seconds) of the keys since
+	// opened
+	accesses uint64
+	atimes   map[int64]uint32
+	opened   int64
+	alock    sync.Mutex
 	// status
 	closed bool
+	// handed over to the new process of an upgrade, read only
+	handover bool
 }
 
 // NewVolume new a volume and init it.
@@ -65,6 +94,9 @@ func NewVolume(id int32, bfile, ifile string, c *conf.Config) (v *Volume, err er
 	v.CompactOffset = 0
 	v.CompactTime = 0
 	v.compactKeys = []int64{}
+	v.hits = make(map[int64]uint32)
+	v.atimes = make(map[int64]uint32)
+	v.opened = time.Now().Unix()
 	// status
 	v.closed = false
 	if v.Block, err = block.NewSuperBlock(bfile, c); err != nil {
@@ -78,6 +110,7 @@ func NewVolume(id int32, bfile, ifile string, c *conf.Config) (v *Volume, err er
 		v.Close()
 		return nil, err
 	}
+	v.warm()
 	v.wg.Add(1)
 	go v.delproc()
 	return
@@ -86,22 +119,38 @@ func NewVolume(id int32, bfile, ifile string, c *conf.Config) (v *Volume, err er
 // init recovery super block from index or super block.
 func (v *Volume) init() (err error) {
 	var (
+		ok         bool
+		nc         int64
 		size       int64
+		garbage    int64
 		offset     uint32
 		lastOffset uint32
 	)
+	// the overwritten needles, the deleted ones are counted once
+	overwrite := func(key int64) {
+		var (
+			off uint32
+			sz  int32
+		)
+		if nc, ok = v.needles[key]; ok {
+			if off, sz = needle.Cache(nc); off != needle.CacheDelOffset {
+				garbage += int64(sz)
+			}
+		}
+	}
 	// recovery from index
 	if err = v.Indexer.Recovery(func(ix *index.Index) error {
 		// must no less than last offset
 		if ix.Offset < lastOffset {
-			log.Error("recovery index: %s lastoffset: %d error(%v)", ix, lastOffset, errors.ErrIndexOffset)
+			log.Errorf("recovery index: %s lastoffset: %d error(%v)", ix, lastOffset, errors.ErrIndexOffset)
 			return errors.ErrIndexOffset
 		}
 		// WARN if index's offset more than the block, discard it.
 		if size = int64(ix.Size) + needle.BlockOffset(ix.Offset); size > v.Block.Size {
-			log.Error("recovery index: %s EOF", ix)
+			log.Errorf("recovery index: %s EOF", ix)
 			return errors.ErrIndexEOF
 		}
+		overwrite(ix.Key)
 		v.needles[ix.Key] = needle.NewCache(ix.Offset, ix.Size)
 		offset = ix.Offset + needle.NeedleOffset(int64(ix.Size))
 		lastOffset = ix.Offset
@@ -117,12 +166,16 @@ func (v *Volume) init() (err error) {
 			}
 		} else {
 			so = needle.CacheDelOffset
+			garbage += int64(n.TotalSize)
 		}
+		overwrite(n.Key)
 		v.needles[n.Key] = needle.NewCache(so, n.TotalSize)
 		return
 	}); err != nil {
 		return
 	}
+	v.loadGarbage(garbage)
+	v.loadQuota()
 	// flush index
 	err = v.Indexer.Flush()
 	return
@@ -154,19 +207,38 @@ func (v *Volume) ParseMeta(line string) (block, index string, id int32, err erro
 	return
 }
 
+// Offset get the offset of the block, the needles before it are written.
+func (v *Volume) Offset() (offset uint32) {
+	v.lock.RLock()
+	offset = v.Block.Offset
+	v.lock.RUnlock()
+	return
+}
+
 // IsClosed reports whether the volume is closed.
 func (v *Volume) IsClosed() bool {
 	return v.closed
 }
 
-func (v *Volume) read(n *needle.Needle) (err error) {
+// Writable reports whether the volume takes the writes, not closed, handed
+// over, failed or full.
+func (v *Volume) Writable() (ok bool) {
+	v.lock.RLock()
+	ok = !v.closed && !v.handover && v.Block.LastErr == nil && v.checkQuota(0) == nil
+	v.lock.RUnlock()
+	return
+}
+
+// read read the needle from the block b, which the cached offset of the
+// needle belongs to.
+func (v *Volume) read(b *block.SuperBlock, n *needle.Needle) (err error) {
 	var (
 		key  = n.Key
 		size = n.TotalSize
 		now  = time.Now().UnixNano()
 	)
 	// pread syscall is atomic, no lock
-	if err = v.Block.ReadAt(n); err != nil {
+	if err = b.ReadAt(n); err != nil {
 		return
 	}
 	if n.Key != key {
@@ -181,9 +253,12 @@ func (v *Volume) read(n *needle.Needle) (err error) {
 	}
 	// needles map may be out-dated, recheck
 	if n.Flag == needle.FlagDel {
-		v.lock.Lock()
-		v.needles[key] = needle.NewCache(needle.CacheDelOffset, size)
-		v.lock.Unlock()
+		v.nlock.Lock()
+		// the block may be swapped by compact meanwhile
+		if v.Block == b {
+			v.needles[key] = needle.NewCache(needle.CacheDelOffset, size)
+		}
+		v.nlock.Unlock()
 		err = errors.ErrNeedleDeleted
 	} else {
 		atomic.AddUint64(&v.Stats.TotalGetProcessed, 1)
@@ -195,20 +270,34 @@ func (v *Volume) read(n *needle.Needle) (err error) {
 
 // Read get a needle by key and cookie and write to wr.
 func (v *Volume) Read(key int64, cookie int32) (n *needle.Needle, err error) {
+	return v.ReadContext(context.Background(), key, cookie)
+}
+
+// ReadContext get a needle by key and cookie, the disk read is skipped if
+// the ctx is done while waiting for the lock.
+func (v *Volume) ReadContext(ctx context.Context, key int64, cookie int32) (n *needle.Needle, err error) {
 	var (
 		ok bool
 		nc int64
+		b  *block.SuperBlock
 	)
-	v.lock.RLock()
+	v.nlock.RLock()
 	if nc, ok = v.needles[key]; !ok {
 		err = errors.ErrNeedleNotExist
 	}
-	v.lock.RUnlock()
+	b = v.Block
+	v.nlock.RUnlock()
+	if err == nil {
+		err = errors.Context(ctx)
+	}
 	if err == nil {
 		if n = needle.NewReader(key, nc); n.Offset != needle.CacheDelOffset {
-			if err = v.read(n); err == nil {
+			if err = v.read(b, n); err == nil {
 				if n.Cookie != cookie {
 					err = errors.ErrNeedleCookie
+				} else {
+					v.hit(key)
+					v.access(key, true)
 				}
 			}
 		} else {
@@ -229,8 +318,9 @@ func (v *Volume) Probe() (err error) {
 		nc  int64
 		key int64
 		n   *needle.Needle
+		b   *block.SuperBlock
 	)
-	v.lock.RLock()
+	v.nlock.RLock()
 	// get a rand key
 	for key, _ = range v.needles {
 		break
@@ -238,10 +328,11 @@ func (v *Volume) Probe() (err error) {
 	if nc, ok = v.needles[key]; !ok {
 		err = errors.ErrNeedleNotExist
 	}
-	v.lock.RUnlock()
+	b = v.Block
+	v.nlock.RUnlock()
 	if err == nil {
 		if n = needle.NewReader(key, nc); n.Offset != needle.CacheDelOffset {
-			err = v.read(n)
+			err = v.read(b, n)
 		} else {
 			err = errors.ErrNeedleDeleted
 		}
@@ -250,21 +341,59 @@ func (v *Volume) Probe() (err error) {
 	return
 }
 
+// Exists check the keys exist in the needles map, no disk io, exists[i] is
+// of keys[i].
+func (v *Volume) Exists(keys []int64) (exists []bool) {
+	var (
+		i      int
+		ok     bool
+		nc     int64
+		offset uint32
+	)
+	exists = make([]bool, len(keys))
+	v.nlock.RLock()
+	for i = range keys {
+		if nc, ok = v.needles[keys[i]]; ok {
+			offset, _ = needle.Cache(nc)
+			exists[i] = offset != needle.CacheDelOffset
+		}
+	}
+	v.nlock.RUnlock()
+	return
+}
+
 // Write add a needle, if key exists append to super block, then update
 // needle cache offset to new offset.
 func (v *Volume) Write(n *needle.Needle) (err error) {
+	return v.WriteContext(context.Background(), n)
+}
+
+// WriteContext add a needle, nothing written if the ctx is done while
+// waiting for the lock.
+func (v *Volume) WriteContext(ctx context.Context, n *needle.Needle) (err error) {
 	var (
 		ok     bool
 		nc     int64
+		size   int32
 		offset uint32
 		now    = time.Now().UnixNano()
 	)
 	v.lock.Lock()
+	if err = v.writable(ctx); err != nil {
+		v.lock.Unlock()
+		return
+	}
 	n.Offset = v.Block.Offset
+	if err = v.checkQuota(int64(n.TotalSize)); err != nil {
+		v.lock.Unlock()
+		return
+	}
 	if err = v.Block.Write(n); err == nil {
 		if err = v.Indexer.Add(n.Key, n.Offset, n.TotalSize); err == nil {
+			v.nlock.Lock()
 			nc, ok = v.needles[n.Key]
 			v.needles[n.Key] = needle.NewCache(n.Offset, n.TotalSize)
+			v.nlock.Unlock()
 		}
 	}
 	v.lock.Unlock()
@@ -273,13 +402,18 @@ func (v *Volume) Write(n *needle.Needle) (err error) {
 			log.Infof("add needle, offset: %d, size: %d", n.Offset, n.TotalSize)
 			log.Info(n)
 		}
+		v.access(n.Key, false)
 		if ok {
-			offset, _ = needle.Cache(nc)
+			if offset, size = needle.Cache(nc); offset != needle.CacheDelOffset {
+				v.garbage(size)
+			}
 			v.del(offset)
 		}
 		atomic.AddUint64(&v.Stats.TotalWriteProcessed, 1)
 		atomic.AddUint64(&v.Stats.TotalWriteBytes, uint64(n.TotalSize))
 		atomic.AddUint64(&v.Stats.TotalWriteDelay, uint64(time.Now().UnixNano()-now))
+	} else if err != errors.ErrSuperBlockNoSpace {
+		atomic.AddUint64(&v.Stats.TotalWriteErrors, 1)
 	}
 	return
 }
@@ -287,15 +421,30 @@ func (v *Volume) Write(n *needle.Needle) (err error) {
 // Writes add needles, if key exists append to super block, then update
 // needle cache offset to new offset.
 func (v *Volume) Writes(ns *needle.Needles) (err error) {
+	return v.WritesContext(context.Background(), ns)
+}
+
+// WritesContext add needles, nothing written if the ctx is done while
+// waiting for the lock.
+func (v *Volume) WritesContext(ctx context.Context, ns *needle.Needles) (err error) {
 	var (
 		ok     bool
 		nc     int64
 		ncs    []int64
+		size   int32
 		offset uint32
 		n      *needle.Needle
 		now    = time.Now().UnixNano()
 	)
 	v.lock.Lock()
+	if err = v.writable(ctx); err != nil {
+		v.lock.Unlock()
+		return
+	}
+	if err = v.checkQuota(int64(ns.TotalSize)); err != nil {
+		v.lock.Unlock()
+		return
+	}
 	for n = ns.Next(); n != nil; n = ns.Next() {
 		offset = v.Block.Offset
 		if err = v.Block.Write(n); err != nil {
@@ -304,10 +453,13 @@ func (v *Volume) Writes(ns *needle.Needles) (err error) {
 		if err = v.Indexer.Add(n.Key, offset, n.TotalSize); err != nil {
 			break
 		}
+		v.nlock.Lock()
 		if nc, ok = v.needles[n.Key]; ok {
 			ncs = append(ncs, nc)
 		}
 		v.needles[n.Key] = needle.NewCache(offset, n.TotalSize)
+		v.nlock.Unlock()
+		v.access(n.Key, false)
 		if log.V(1) {
 			log.Infof("add needle, offset: %d, size: %d", offset, n.TotalSize)
 			log.Info(n)
@@ -316,12 +468,16 @@ func (v *Volume) Writes(ns *needle.Needles) (err error) {
 	v.lock.Unlock()
 	if err == nil {
 		for _, nc = range ncs {
-			offset, _ = needle.Cache(nc)
+			if offset, size = needle.Cache(nc); offset != needle.CacheDelOffset {
+				v.garbage(size)
+			}
 			v.del(offset)
 		}
 		atomic.AddUint64(&v.Stats.TotalWriteProcessed, uint64(ns.Num))
 		atomic.AddUint64(&v.Stats.TotalWriteBytes, uint64(ns.TotalSize))
 		atomic.AddUint64(&v.Stats.TotalWriteDelay, uint64(time.Now().UnixNano()-now))
+	} else if err != errors.ErrSuperBlockNoSpace {
+		atomic.AddUint64(&v.Stats.TotalWriteErrors, 1)
 	}
 	return
 }
@@ -343,6 +499,12 @@ func (v *Volume) del(offset uint32) (err error) {
 // Delete logical delete a needle, update disk needle flag and memory needle
 // cache offset to zero.
 func (v *Volume) Delete(key int64) (err error) {
+	return v.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext logical delete a needle, nothing deleted if the ctx is done
+// while waiting for the lock.
+func (v *Volume) DeleteContext(ctx context.Context, key int64) (err error) {
 	var (
 		ok     bool
 		nc     int64
@@ -350,9 +512,20 @@ func (v *Volume) Delete(key int64) (err error) {
 		offset uint32
 	)
 	v.lock.Lock()
+	if err = v.writable(ctx); err != nil {
+		v.lock.Unlock()
+		return
+	}
+	v.nlock.Lock()
 	if nc, ok = v.needles[key]; ok {
 		if offset, size = needle.Cache(nc); offset != needle.CacheDelOffset {
 			v.needles[key] = needle.NewCache(needle.CacheDelOffset, size)
+		}
+	}
+	v.nlock.Unlock()
+	if ok {
+		if offset != needle.CacheDelOffset {
+			v.garbage(size)
 			// when in compact, must save all del operations.
 			if v.Compact {
 				v.compactKeys = append(v.compactKeys, key)
@@ -365,6 +538,7 @@ func (v *Volume) Delete(key int64) (err error) {
 	}
 	v.lock.Unlock()
 	if err == nil {
+		v.forget(key)
 		err = v.del(offset)
 	}
 	return
@@ -408,6 +582,8 @@ func (v *Volume) delproc() {
 			}
 			offsets = offsets[:0]
 		}
+		v.saveGarbage()
+		v.saveHot()
 		// signal exit
 		if exit {
 			break
@@ -418,9 +594,13 @@ func (v *Volume) delproc() {
 	return
 }
 
-// compact compact v to new v.
-func (v *Volume) compact(nv *Volume) (err error) {
+// compact compact v to new v, throttle is called with the size of each
+// needle read if not nil.
+func (v *Volume) compact(nv *Volume, throttle func(int32)) (err error) {
 	err = v.Block.Compact(v.CompactOffset, func(n *needle.Needle, so, eo uint32) (err1 error) {
+		if throttle != nil {
+			throttle(n.TotalSize)
+		}
 		if n.Flag != needle.FlagDel {
 			if err1 = nv.Write(n); err1 != nil {
 				return
@@ -433,11 +613,14 @@ func (v *Volume) compact(nv *Volume) (err error) {
 }
 
 // Compact copy the super block to another space, and drop the "delete"
-// needle, so this can reduce disk space cost.
-func (v *Volume) StartCompact(nv *Volume) (err error) {
+// needle, so this can reduce disk space cost, throttle paces the copy if
+// not nil.
+func (v *Volume) StartCompact(nv *Volume, throttle func(int32)) (err error) {
 	v.lock.Lock()
 	if v.Compact {
 		err = errors.ErrVolumeInCompact
+	} else if v.handover {
+		err = errors.ErrVolumeHandover
 	} else {
 		v.Compact = true
 	}
@@ -446,7 +629,11 @@ func (v *Volume) StartCompact(nv *Volume) (err error) {
 		return
 	}
 	v.CompactTime = time.Now().UnixNano()
-	if err = v.compact(nv); err != nil {
+	// the live needles fit, the quota is for the new writes only
+	nv.lock.Lock()
+	nv.Quota = 0
+	nv.lock.Unlock()
+	if err = v.compact(nv, throttle); err != nil {
 		return
 	}
 	atomic.AddUint64(&v.Stats.TotalCompactProcessed, 1)
@@ -463,7 +650,8 @@ func (v *Volume) StopCompact(nv *Volume) (err error) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	if nv != nil {
-		if err = v.compact(nv); err != nil {
+		// the tail written meanwhile, not throttled as the writes wait
+		if err = v.compact(nv, nil); err != nil {
 			goto free
 		}
 		for _, key = range v.compactKeys {
@@ -475,9 +663,17 @@ func (v *Volume) StopCompact(nv *Volume) (err error) {
 		v.ch <- _finish
 		v.wg.Wait()
 		// then replace old & new block/index/needles variables
+		v.nlock.Lock()
 		v.Block, nv.Block = nv.Block, v.Block
 		v.Indexer, nv.Indexer = nv.Indexer, v.Indexer
 		v.needles, nv.needles = nv.needles, v.needles
+		v.nlock.Unlock()
+		v.DeletedBytes, nv.DeletedBytes = nv.DeletedBytes, v.DeletedBytes
+		v.savedBytes, nv.savedBytes = nv.savedBytes, v.savedBytes
+		// the quota goes with the new block
+		if v.Quota != v.conf.Volume.Quota {
+			v.saveQuota()
+		}
 		atomic.AddUint64(&v.Stats.TotalCompactDelay, uint64(time.Now().UnixNano()-v.CompactTime))
 		// NOTE MUST restart delproc job
 		v.wg.Add(1)
@@ -491,6 +687,35 @@ free:
 	return
 }
 
+// Scrub read back all the needles of the block and verify their checksums,
+// throttle paces the reads if not nil, the first corrupted needle fails it.
+func (v *Volume) Scrub(throttle func(int32)) (err error) {
+	var (
+		b   *block.SuperBlock
+		now = time.Now().UnixNano()
+	)
+	v.nlock.RLock()
+	b = v.Block
+	v.nlock.RUnlock()
+	// a scan of its own fd, a block swapped by compact meanwhile is still
+	// readable to the end
+	err = b.Compact(0, func(n *needle.Needle, so, eo uint32) error {
+		if throttle != nil {
+			throttle(n.TotalSize)
+		}
+		return nil
+	})
+	v.lock.Lock()
+	v.ScrubTime = now
+	if err != nil {
+		v.ScrubError = err.Error()
+	} else {
+		v.ScrubError = ""
+	}
+	v.lock.Unlock()
+	return
+}
+
 // Open open the closed volume, must called after NewVolume.
 func (v *Volume) Open() (err error) {
 	v.lock.Lock()
@@ -506,7 +731,12 @@ func (v *Volume) Open() (err error) {
 		v.Close()
 		return
 	}
-	if err = v.init(); err != nil {
+	v.nlock.Lock()
+	if err = v.init(); err == nil {
+		v.warm()
+	}
+	v.nlock.Unlock()
+	if err != nil {
 		v.Close()
 		return
 	}
@@ -517,19 +747,61 @@ func (v *Volume) Open() (err error) {
 }
 
 func (v *Volume) close() {
-	if v.ch != nil {
+	// the del job and the index are already done by the handover
+	if v.ch != nil && !v.handover {
 		v.ch <- _finish
 		v.wg.Wait()
 	}
 	if v.Block != nil {
 		v.Block.Close()
 	}
-	if v.Indexer != nil {
+	if v.Indexer != nil && !v.handover {
 		v.Indexer.Close()
 	}
 	v.closed = true
 }
 
+// Handover stop the writes, the deletes and the compaction of the volume,
+// and flush the index, so the new process of an upgrade loads the volume
+// without a recovery of the block, the reads go on until Close.
+func (v *Volume) Handover() (err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.closed || v.handover {
+		return
+	}
+	if v.Compact {
+		return errors.ErrVolumeInCompact
+	}
+	v.handover = true
+	// flush the deletes
+	v.ch <- _finish
+	v.wg.Wait()
+	v.Indexer.Close()
+	return
+}
+
+// Resume reopen the volume handed over, if the upgrade failed.
+func (v *Volume) Resume() (err error) {
+	v.lock.Lock()
+	if !v.handover {
+		v.lock.Unlock()
+		return
+	}
+	v.close()
+	v.handover = false
+	v.lock.Unlock()
+	return v.Open()
+}
+
+// writable check the volume takes the writes, must called with the lock.
+func (v *Volume) writable(ctx context.Context) (err error) {
+	if err = errors.Context(ctx); err == nil && v.handover {
+		err = errors.ErrVolumeHandover
+	}
+	return
+}
+
 // Close close the volume.
 func (v *Volume) Close() {
 	v.lock.Lock()
@@ -545,6 +817,9 @@ func (v *Volume) Destroy() {
 		v.close()
 	}
 	if v.Block != nil {
+		os.Remove(v.Block.File + _garbageExt)
+		os.Remove(v.Block.File + _hotExt)
+		os.Remove(v.Block.File + _quotaExt)
 		v.Block.Destroy()
 	}
 	if v.Indexer != nil {
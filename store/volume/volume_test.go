@@ -5,7 +5,10 @@ import (
 	"bfs/store/conf"
 	"bfs/store/needle"
 	"bytes"
+	"context"
+	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -147,6 +150,682 @@ func TestVolume(t *testing.T) {
 	} else {
 		err = nil
 	}
+	// the deleted and the missing ones not exist
+	if exists := v.Exists([]int64{1, 3, 6, 7}); !exists[0] || exists[1] || !exists[2] || exists[3] {
+		t.Errorf("Exists() = %v not match", exists)
+		t.FailNow()
+	}
+}
+
+func TestVolumeContext(t *testing.T) {
+	var (
+		v      *Volume
+		n      *needle.Needle
+		err    error
+		ctx    context.Context
+		cancel context.CancelFunc
+		bfile  = "../test/test2"
+		ifile  = "../test/test2.idx"
+	)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(2, bfile, ifile, _c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Close()
+	n = needle.NewWriter(1, 1, 4)
+	defer n.Close()
+	if err = n.ReadFrom(bytes.NewBufferString("test")); err != nil {
+		t.Errorf("n.ReadFrom() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = v.ReadContext(ctx, 1, 1); err != errors.ErrRequestCanceled {
+		t.Errorf("ReadContext() canceled error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.DeleteContext(ctx, 1); err != errors.ErrRequestCanceled {
+		t.Errorf("DeleteContext() canceled error(%v)", err)
+		t.FailNow()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if err = v.WriteContext(ctx, n); err != errors.ErrRequestTimeout {
+		t.Errorf("WriteContext() timeout error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = v.Read(1, 1); err != nil {
+		t.Errorf("Read() error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeDigest(t *testing.T) {
+	var (
+		i      int
+		v1, v2 *Volume
+		d1, d2 *Digest
+		n      *needle.Needle
+		err    error
+		ctx    = context.Background()
+		files  = []string{"../test/test3", "../test/test3.idx", "../test/test4", "../test/test4.idx"}
+		ic     = *_ic
+		c      = *_c
+	)
+	// the ring must hold all the writes
+	ic.RingBuffer, ic.MergeWrite = 1024, 512
+	c.Index = &ic
+	for i = 0; i < len(files); i++ {
+		os.Remove(files[i])
+		defer os.Remove(files[i])
+	}
+	if v1, err = NewVolume(3, files[0], files[1], &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v1.Close()
+	if v2, err = NewVolume(3, files[2], files[3], &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v2.Close()
+	// the same needles in different orders
+	for i = 0; i < 100; i++ {
+		n = needle.NewWriter(int64(i), 1, 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v1.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+		n = needle.NewWriter(int64(99-i), 1, 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v2.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	if d1, err = v1.Digest(ctx, 0, 100, 10, true, false); err != nil {
+		t.Errorf("Digest() error(%v)", err)
+		t.FailNow()
+	}
+	if d2, err = v2.Digest(ctx, 0, 100, 10, true, false); err != nil {
+		t.Errorf("Digest() error(%v)", err)
+		t.FailNow()
+	}
+	if d1.Sum != d2.Sum || d1.Count != 100 || len(d1.Ranges) != 10 || d1.MinKey != 0 || d1.MaxKey != 99 {
+		t.Errorf("Digest() got: %+v, %+v", d1, d2)
+		t.FailNow()
+	}
+	// rewrite 42 with other data, delete 77
+	n = needle.NewWriter(42, 1, 4)
+	n.ReadFrom(bytes.NewBufferString("tset"))
+	v2.Write(n)
+	n.Close()
+	v2.Delete(77)
+	if d2, err = v2.Digest(ctx, 0, 100, 10, true, false); err != nil {
+		t.Errorf("Digest() error(%v)", err)
+		t.FailNow()
+	}
+	for i = 0; i < 10; i++ {
+		if (d1.Ranges[i].Sum != d2.Ranges[i].Sum) != (i == 4 || i == 7) {
+			t.Errorf("Digest() range: %d sums: %s %s", i, d1.Ranges[i].Sum, d2.Ranges[i].Sum)
+			t.FailNow()
+		}
+	}
+	// the shallow digest misses the rewrite of the same size
+	if d1, err = v1.Digest(ctx, 40, 50, 1, false, true); err != nil {
+		t.Errorf("Digest() error(%v)", err)
+		t.FailNow()
+	}
+	if d2, err = v2.Digest(ctx, 40, 50, 1, false, true); err != nil {
+		t.Errorf("Digest() error(%v)", err)
+		t.FailNow()
+	}
+	if d1.Sum != d2.Sum || len(d2.Entries) != 10 || d2.Entries[2].Key != 42 {
+		t.Errorf("Digest() got: %+v, %+v", d1, d2)
+		t.FailNow()
+	}
+	if _, err = v1.Digest(ctx, 10, 10, 1, false, false); err != errors.ErrParam {
+		t.Errorf("Digest() empty bounds error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeGarbage(t *testing.T) {
+	var (
+		i       int
+		v       *Volume
+		n       *needle.Needle
+		err     error
+		garbage int64
+		bfile   = "../test/test5"
+		ifile   = "../test/test5.idx"
+		c       = *_c
+	)
+	// the recovery checks the block max size
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	os.Remove(bfile + _garbageExt)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(5, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	// 2 overwritten, 1 deleted
+	for i = 0; i < 6; i++ {
+		n = needle.NewWriter(int64(i%4), 1, 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		garbage = int64(n.TotalSize)
+		n.Close()
+	}
+	if err = v.Delete(3); err != nil {
+		t.Errorf("Delete() error(%v)", err)
+		t.FailNow()
+	}
+	if v.DeletedBytes != 3*garbage || v.Garbage() <= 0.4 {
+		t.Errorf("DeletedBytes: %d garbage: %f", v.DeletedBytes, v.Garbage())
+		t.FailNow()
+	}
+	v.Close()
+	// saved by the delete job
+	if v, err = NewVolume(5, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	if v.DeletedBytes != 3*garbage {
+		t.Errorf("DeletedBytes: %d after restart", v.DeletedBytes)
+		t.FailNow()
+	}
+	v.Destroy()
+	if _, err = os.Stat(bfile + _garbageExt); !os.IsNotExist(err) {
+		t.Errorf("garbage file left error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeWarm(t *testing.T) {
+	var (
+		i     int
+		v     *Volume
+		n     *needle.Needle
+		err   error
+		data  []byte
+		bfile = "../test/test7"
+		ifile = "../test/test7.idx"
+		c     = *_c
+		vc    = *_vc
+	)
+	vc.WarmSample, vc.WarmKeys = 1, 2
+	c.Volume = &vc
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(7, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	for i = 1; i <= 3; i++ {
+		n = needle.NewWriter(int64(i), 1, 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	// key 2 the hottest, then key 3
+	for _, i = range []int{2, 3, 2, 1, 3, 2} {
+		if n, err = v.Read(int64(i), 1); err != nil {
+			t.Errorf("Read() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	v.saveHot()
+	if data, err = ioutil.ReadFile(bfile + _hotExt); err != nil || string(data) != "2\n3\n" {
+		t.Errorf("hot keys: %q error(%v)", data, err)
+		t.FailNow()
+	}
+	v.Close()
+	if v, err = NewVolume(7, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	v.Destroy()
+	if _, err = os.Stat(bfile + _hotExt); !os.IsNotExist(err) {
+		t.Errorf("hot file left error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeCold(t *testing.T) {
+	var (
+		i     int
+		v     *Volume
+		n     *needle.Needle
+		err   error
+		keys  []int64
+		bfile = "../test/test13"
+		ifile = "../test/test13.idx"
+		c     = *_c
+		vc    = *_vc
+	)
+	vc.AccessSample = 1
+	c.Volume = &vc
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(13, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Close()
+	for i = 1; i <= 3; i++ {
+		n = needle.NewWriter(int64(i), 1, 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	if keys = v.Cold(time.Second, 10); len(keys) != 0 {
+		t.Errorf("Cold() = %v, opened just now", keys)
+		t.FailNow()
+	}
+	// opened, written and read long ago
+	v.opened -= 100
+	for key := range v.atimes {
+		v.atimes[key] -= 100
+	}
+	if n, err = v.Read(2, 1); err != nil {
+		t.Errorf("Read() error(%v)", err)
+		t.FailNow()
+	}
+	n.Close()
+	if err = v.Delete(3); err != nil {
+		t.Errorf("Delete() error(%v)", err)
+		t.FailNow()
+	}
+	if keys = v.Cold(time.Minute, 10); len(keys) != 1 || keys[0] != 1 {
+		t.Errorf("Cold() = %v, want [1]", keys)
+		t.FailNow()
+	}
+	if keys = v.Cold(time.Hour, 10); len(keys) != 0 {
+		t.Errorf("Cold() = %v, opened in the age", keys)
+		t.FailNow()
+	}
+}
+
+func TestVolumeQuota(t *testing.T) {
+	var (
+		v     *Volume
+		n     *needle.Needle
+		err   error
+		bfile = "../test/test10"
+		ifile = "../test/test10.idx"
+		c     = *_c
+		vc    = *_vc
+	)
+	vc.Quota = 1 << 20
+	c.Volume = &vc
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(10, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	if v.Quota != vc.Quota {
+		t.Errorf("quota: %d not match", v.Quota)
+		t.FailNow()
+	}
+	n = needle.NewWriter(1, 1, 4)
+	n.ReadFrom(bytes.NewBufferString("test"))
+	defer n.Close()
+	// room for one needle only
+	if err = v.SetQuota(v.Block.Size + int64(n.TotalSize)); err != nil {
+		t.Errorf("SetQuota() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != errors.ErrVolumeQuota {
+		t.Errorf("Write() error(%v) not quota", err)
+		t.FailNow()
+	}
+	if err = v.SetQuota(0); err != nil {
+		t.Errorf("SetQuota() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	v.Close()
+	// the saved quota overrides the default
+	if v, err = NewVolume(10, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	if v.Quota != 0 {
+		t.Errorf("quota: %d not match", v.Quota)
+		t.FailNow()
+	}
+	v.Destroy()
+	if _, err = os.Stat(bfile + _quotaExt); !os.IsNotExist(err) {
+		t.Errorf("quota file left error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeHandover(t *testing.T) {
+	var (
+		v, nv *Volume
+		n     *needle.Needle
+		err   error
+		bfile = "../test/test11"
+		ifile = "../test/test11.idx"
+		c     = *_c
+	)
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(11, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Close()
+	n = needle.NewWriter(1, 1, 4)
+	n.ReadFrom(bytes.NewBufferString("test"))
+	defer n.Close()
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Handover(); err != nil {
+		t.Errorf("Handover() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != errors.ErrVolumeHandover {
+		t.Errorf("Write() error(%v) not handover", err)
+		t.FailNow()
+	}
+	if _, err = v.Read(1, 1); err != nil {
+		t.Errorf("Read() error(%v)", err)
+		t.FailNow()
+	}
+	// the new process loads the flushed index
+	if nv, err = NewVolume(11, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	if _, err = nv.Read(1, 1); err != nil {
+		t.Errorf("Read() error(%v)", err)
+		t.FailNow()
+	}
+	nv.Close()
+	// the upgrade failed
+	if err = v.Resume(); err != nil {
+		t.Errorf("Resume() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeScrub(t *testing.T) {
+	var (
+		i     int
+		v     *Volume
+		n     *needle.Needle
+		f     *os.File
+		buf   []byte
+		err   error
+		bfile = "../test/test12"
+		ifile = "../test/test12.idx"
+		c     = *_c
+	)
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(12, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Close()
+	n = needle.NewWriter(1, 1, 4)
+	n.ReadFrom(bytes.NewBufferString("test"))
+	defer n.Close()
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Scrub(func(int32) { i++ }); err != nil || v.ScrubTime == 0 || v.ScrubError != "" {
+		t.Errorf("Scrub() error(%v)", err)
+		t.FailNow()
+	}
+	if i != 1 {
+		t.Errorf("Scrub() throttled: %d not 1", i)
+		t.FailNow()
+	}
+	// corrupt the data of the needle
+	if buf, err = ioutil.ReadFile(bfile); err != nil {
+		t.Errorf("ioutil.ReadFile() error(%v)", err)
+		t.FailNow()
+	}
+	if f, err = os.OpenFile(bfile, os.O_WRONLY, 0664); err != nil {
+		t.Errorf("os.OpenFile() error(%v)", err)
+		t.FailNow()
+	}
+	_, err = f.WriteAt([]byte("T"), int64(bytes.Index(buf, []byte("test"))))
+	f.Close()
+	if err != nil {
+		t.Errorf("WriteAt() error(%v)", err)
+		t.FailNow()
+	}
+	if err = v.Scrub(nil); err != errors.ErrNeedleChecksum || v.ScrubError == "" {
+		t.Errorf("Scrub() error(%v) not checksum", err)
+		t.FailNow()
+	}
+}
+
+func TestVolumeClone(t *testing.T) {
+	var (
+		i      int
+		cn     int
+		live   bool
+		v, nv  *Volume
+		n      *needle.Needle
+		err    error
+		bfile  = "../test/test8"
+		ifile  = "../test/test8.idx"
+		nbfile = "../test/test9"
+		nifile = "../test/test9.idx"
+		stream = &bytes.Buffer{}
+		c      = *_c
+	)
+	// the scan checks the block max size
+	c.BlockMaxSize = needle.Size(c.NeedleMaxSize)
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(8, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Close()
+	// key 1 overwritten, key 2 deleted
+	for _, i = range []int{1, 2, 3, 1} {
+		n = needle.NewWriter(int64(i), int32(i), 4)
+		n.ReadFrom(bytes.NewBufferString("test"))
+		if err = v.Write(n); err != nil {
+			t.Errorf("Write() error(%v)", err)
+			t.FailNow()
+		}
+		n.Close()
+	}
+	if err = v.Delete(2); err != nil {
+		t.Errorf("Delete() error(%v)", err)
+		t.FailNow()
+	}
+	// wait the delete job flag the needle
+	v.ch <- _finish
+	v.wg.Wait()
+	v.wg.Add(1)
+	go v.delproc()
+	if _, err = v.Block.Stream(0, v.Offset(), stream); err != nil {
+		t.Errorf("Stream() error(%v)", err)
+		t.FailNow()
+	}
+	cn = 0
+	if err = v.ScanNeedles(func(n *needle.Needle, so, eo uint32) error {
+		if n.Flag == needle.FlagDel {
+			cn++
+		}
+		return nil
+	}); err != nil || cn != 2 {
+		t.Errorf("ScanNeedles() deleted: %d error(%v)", cn, err)
+		t.FailNow()
+	}
+	for _, live = range []bool{false, true} {
+		os.Remove(nbfile)
+		os.Remove(nifile)
+		if nv, err = NewVolume(9, nbfile, nifile, &c); err != nil {
+			t.Errorf("NewVolume() error(%v)", err)
+			t.FailNow()
+		}
+		if cn, err = nv.Clone(bytes.NewReader(stream.Bytes()), live); err != nil || cn != 2 {
+			t.Errorf("Clone(%v) got: %d error(%v)", live, cn, err)
+			t.FailNow()
+		}
+		if _, err = nv.Read(2, 2); (live && err != errors.ErrNeedleNotExist) || (!live && err != errors.ErrNeedleDeleted) {
+			t.Errorf("Clone(%v) deleted needle error(%v)", live, err)
+			t.FailNow()
+		}
+		if n, err = nv.Read(1, 1); err != nil {
+			t.Errorf("Clone(%v) Read() error(%v)", live, err)
+			t.FailNow()
+		}
+		n.Close()
+		nv.Destroy()
+	}
+	// a truncated stream fails
+	if nv, err = NewVolume(9, nbfile, nifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer nv.Destroy()
+	if _, err = nv.Clone(bytes.NewReader(stream.Bytes()[:stream.Len()-1]), true); err == nil {
+		t.Errorf("Clone() truncated stream no error")
+		t.FailNow()
+	}
+}
+
+func TestVolumeConcurrent(t *testing.T) {
+	var (
+		i     int
+		v     *Volume
+		n     *needle.Needle
+		err   error
+		wg    sync.WaitGroup
+		errs  = make(chan error, 4)
+		bfile = "../test/test6"
+		ifile = "../test/test6.idx"
+		ic    = *_ic
+		c     = *_c
+	)
+	ic.RingBuffer, ic.MergeWrite = 1024, 512
+	c.Index = &ic
+	os.Remove(bfile)
+	os.Remove(ifile)
+	defer os.Remove(bfile)
+	defer os.Remove(ifile)
+	if v, err = NewVolume(6, bfile, ifile, &c); err != nil {
+		t.Errorf("NewVolume() error(%v)", err)
+		t.FailNow()
+	}
+	defer v.Destroy()
+	n = needle.NewWriter(0, 1, 4)
+	n.ReadFrom(bytes.NewBufferString("test"))
+	if err = v.Write(n); err != nil {
+		t.Errorf("Write() error(%v)", err)
+		t.FailNow()
+	}
+	n.Close()
+	// the reads never wait for the appends
+	v.lock.Lock()
+	if n, err = v.Read(0, 1); err != nil {
+		v.lock.Unlock()
+		t.Errorf("Read() while appending error(%v)", err)
+		t.FailNow()
+	}
+	v.lock.Unlock()
+	n.Close()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i < 200; i++ {
+			n := needle.NewWriter(int64(i), 1, 4)
+			n.ReadFrom(bytes.NewBufferString("test"))
+			if err := v.Write(n); err != nil {
+				errs <- err
+				return
+			}
+			n.Close()
+		}
+	}()
+	for i = 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				n, err := v.Read(0, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+				n.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err = range errs {
+		t.Errorf("concurrent error(%v)", err)
+		t.FailNow()
+	}
 }
 
 /*
@@ -0,0 +1,167 @@
+package volume
+
+import (
+	"bfs/libs/log"
+	"bfs/store/block"
+	"bfs/store/needle"
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// the hottest keys are saved by the delete job beside the block.
+	_hotExt = ".hot"
+)
+
+// hit count a read of the key, one of every Volume.WarmSample reads is
+// counted, the counts are approximate read frequencies.
+func (v *Volume) hit(key int64) {
+	var sample = v.conf.Volume.WarmSample
+	if sample <= 0 || atomic.AddUint64(&v.reads, 1)%uint64(sample) != 0 {
+		return
+	}
+	v.hlock.Lock()
+	v.hits[key]++
+	v.hot = true
+	// keep the map bounded, the cold keys are dropped
+	if len(v.hits) > 4*v.conf.Volume.WarmKeys {
+		v.hits = decay(v.hits, hottest(v.hits, v.conf.Volume.WarmKeys))
+	}
+	v.hlock.Unlock()
+}
+
+// hottest get the n most counted keys, the hottest first.
+func hottest(hits map[int64]uint32, n int) (keys []int64) {
+	var key int64
+	keys = make([]int64, 0, len(hits))
+	for key = range hits {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return hits[keys[i]] > hits[keys[j]] })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return
+}
+
+// decay keep only the counts of the keys, halved so the old hits fade.
+func decay(hits map[int64]uint32, keys []int64) (top map[int64]uint32) {
+	var key int64
+	top = make(map[int64]uint32, len(keys))
+	for _, key = range keys {
+		if hits[key] > 1 {
+			top[key] = hits[key] / 2
+		} else {
+			top[key] = 1
+		}
+	}
+	return
+}
+
+// saveHot save the hottest keys if any new hit, the hottest first.
+func (v *Volume) saveHot() {
+	var (
+		err  error
+		key  int64
+		keys []int64
+		buf  bytes.Buffer
+		file string
+	)
+	v.nlock.RLock()
+	file = v.Block.File + _hotExt
+	v.nlock.RUnlock()
+	v.hlock.Lock()
+	if !v.hot {
+		v.hlock.Unlock()
+		return
+	}
+	keys = hottest(v.hits, v.conf.Volume.WarmKeys)
+	v.hits, v.hot = decay(v.hits, keys), false
+	v.hlock.Unlock()
+	for _, key = range keys {
+		buf.WriteString(strconv.FormatInt(key, 10))
+		buf.WriteByte('\n')
+	}
+	if err = ioutil.WriteFile(file+".tmp", buf.Bytes(), 0664); err != nil {
+		log.Errorf("ioutil.WriteFile(\"%s\") error(%v)", file, err)
+		return
+	}
+	if err = os.Rename(file+".tmp", file); err != nil {
+		log.Errorf("os.Rename(\"%s\") error(%v)", file, err)
+	}
+}
+
+// warm read the saved hottest needles into the page cache, in the block
+// order, so the first reads after a restart hit the memory.
+func (v *Volume) warm() {
+	var (
+		err     error
+		ok      bool
+		key     int64
+		nc      int64
+		f       *os.File
+		sc      *bufio.Scanner
+		n       *needle.Needle
+		b       *block.SuperBlock
+		keys    []int64
+		hot     []int64
+		size    int64
+		now     = time.Now()
+		file    string
+		maxKeys = v.conf.Volume.WarmKeys
+		needles = make(map[int64]int64, maxKeys)
+		offset  = func(key int64) (off uint32) {
+			off, _ = needle.Cache(needles[key])
+			return
+		}
+	)
+	if v.conf.Volume.WarmSample <= 0 {
+		return
+	}
+	v.nlock.RLock()
+	b = v.Block
+	v.nlock.RUnlock()
+	file = b.File + _hotExt
+	if f, err = os.Open(file); err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("os.Open(\"%s\") error(%v)", file, err)
+		}
+		return
+	}
+	defer f.Close()
+	sc = bufio.NewScanner(f)
+	for sc.Scan() && len(hot) < maxKeys {
+		if key, err = strconv.ParseInt(sc.Text(), 10, 64); err != nil {
+			log.Errorf("volume: %d hot key: \"%s\" format error", v.Id, sc.Text())
+			return
+		}
+		hot = append(hot, key)
+	}
+	v.nlock.RLock()
+	for _, key = range hot {
+		if nc, ok = v.needles[key]; ok {
+			needles[key] = nc
+		}
+	}
+	v.nlock.RUnlock()
+	for _, key = range hot {
+		if _, ok = needles[key]; ok && offset(key) != needle.CacheDelOffset {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return offset(keys[i]) < offset(keys[j]) })
+	for _, key = range keys {
+		n = needle.NewReader(key, needles[key])
+		if err = b.ReadAt(n); err == nil {
+			size += int64(n.TotalSize)
+		}
+		n.Close()
+	}
+	log.Infof("volume: %d warm %d needles %d bytes in %s", v.Id, len(keys), size, time.Since(now))
+}
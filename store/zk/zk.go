@@ -1,10 +1,11 @@
 package zk
 
 import (
+	"bfs/libs/log"
 	"bfs/libs/meta"
 	"bfs/store/conf"
 	"encoding/json"
-	log "github.com/golang/glog"
+	"fmt"
 	myzk "github.com/samuel/go-zookeeper/zk"
 	"path"
 	"strconv"
@@ -156,6 +157,9 @@ func (z *Zookeeper) SetStore(s *meta.Store) (err error) {
 	)
 	s.Id = z.conf.Zookeeper.ServerId
 	s.Rack = z.conf.Zookeeper.Rack
+	s.Zone = z.conf.Zookeeper.Zone
+	s.Region = z.conf.Zookeeper.Region
+	s.Labels = z.conf.Zookeeper.Labels
 	s.Status = meta.StoreStatusInit
 	if data, stat, err = z.c.Get(z.fpath); err != nil {
 		log.Errorf("zk.Get(\"%s\") error(%v)", z.fpath, err)
@@ -193,6 +197,15 @@ func (z *Zookeeper) SetRoot() (err error) {
 	return
 }
 
+// Ping check the session of the zookeeper connection.
+func (z *Zookeeper) Ping() (err error) {
+	var s myzk.State
+	if s = z.c.State(); s != myzk.StateHasSession {
+		err = fmt.Errorf("zookeeper %s", s)
+	}
+	return
+}
+
 // Close close the zookeeper connection.
 func (z *Zookeeper) Close() {
 	z.c.Close()